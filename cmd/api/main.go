@@ -1,37 +1,143 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Lender time zones must load on hosts without a zoneinfo database
 
 	"wisetech-lms-api/internal/config"
 	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/repository"
 	"wisetech-lms-api/internal/server"
+	"wisetech-lms-api/internal/storage"
 )
 
 func main() {
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "log pending database migrations and exit without applying them")
+	migrateFiles := flag.Bool("migrate-files", false, "copy locally stored files to STORAGE_BACKEND and exit")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
 	}
 
+	// Everything logs through the configured logger from here on
+	logger := server.NewLogger(cfg, os.Stderr)
+	slog.SetDefault(logger)
+
 	// Initialize database connection
 	db, err := database.NewConnection(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
+	if *migrateDryRun {
+		pending, err := database.RunMigrations(db, database.MigrateOptions{DryRun: true})
+		if err != nil {
+			fatal("Failed to list pending migrations", err)
+		}
+		logger.Info("Pending migrations", "count", len(pending), "versions", pending)
+		return
+	}
+
+	// SIGTERM, sent on every deploy, and SIGINT drain the server and stop the background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Listen straight away so /readyz can report 503 while the schema is migrated
+	srv := server.New(db, cfg, logger)
+	serveErr := make(chan error, 1)
+	if !*migrateFiles {
+		go func() { serveErr <- srv.Run(ctx) }()
+	}
+
 	// Initialize database schema
 	if err := database.InitializeSchema(db); err != nil {
-		log.Fatalf("Failed to initialize database schema: %v", err)
+		fatal("Failed to initialize database schema", err)
+	}
+	if cfg.SeedDefaultPlans {
+		if _, err := database.SeedPlans(db, database.DefaultPlans); err != nil {
+			fatal("Failed to seed default plans", err)
+		}
+	}
+
+	if *migrateFiles {
+		if cfg.StorageBackend == storage.BackendLocal {
+			logger.Error("Set STORAGE_BACKEND to the backend to migrate files to")
+			os.Exit(1)
+		}
+		migration := jobs.NewFileMigration(repository.NewFileRepository(db), server.NewFileStorage(cfg), storage.BackendLocal, cfg.StorageBackend)
+		migration.Logger = logger
+		moved, err := migration.Run(ctx)
+		if err != nil {
+			logger.Error("File migration failed", "moved", moved, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Moved files", "count", moved, "backend", cfg.StorageBackend)
+		return
+	}
+
+	// Start background jobs. Each stops once ctx is cancelled, after finishing the run in progress.
+	var running sync.WaitGroup
+	start := func(job func(context.Context)) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			job(ctx)
+		}()
 	}
+	prefs := repository.NewNotificationPreferenceRepository(db)
+	outbox := jobs.NewOutboxDispatcher(repository.NewOutboxRepository(db), prefs)
+	outbox.Logger = logger
+	start(outbox.Start)
+	notifier := jobs.NewExpiryNotifier(repository.NewLedgerRepository(db), prefs, server.NewMailer(cfg), cfg.SubscriptionNoticeDays)
+	notifier.Logger = logger
+	start(notifier.Start)
 
-	// Create a new server
-	srv := server.New(db, cfg)
+	start(srv.SubscriptionExpiry().Start)
+	start(srv.OrphanSweeper().Start)
+	start(srv.FileScanner().Start)
+	start(srv.ReportMailer().Start)
+	start(srv.EmailDispatcher().Start)
+	start(srv.LoanBookSnapshotter().Start)
+
+	srv.SetReady()
+	err = <-serveErr
+	stop() // Serving failed or drained; either way the jobs stop too
+	waitForJobs(logger, &running, cfg.ShutdownTimeout)
+	if err != nil {
+		db.Close()
+		fatal("Server failed", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// fatal logs err and exits with status 1, without running deferred calls
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	// Start the server
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// waitForJobs waits up to timeout for the background jobs to return
+func waitForJobs(logger *slog.Logger, running *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warn("Background jobs still running; exiting anyway", "timeout", timeout)
 	}
 }
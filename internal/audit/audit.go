@@ -0,0 +1,112 @@
+// Package audit records who changed what in Audit_Log. Handlers call Auditor.Record once a change
+// has succeeded; repositories that must audit in the same transaction as the change build the same
+// row with NewEntry, so every entry carries the account and client address of the request.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// ActorSystem identifies changes made outside any request, such as by background jobs
+const ActorSystem = "system"
+
+// Source is who made the request a change is audited for
+type Source struct {
+	Actor     string // e.g. "account:12" or "admin"; ActorSystem when empty
+	AccountID int    // 0 when no account made the request
+	IP        string
+}
+
+// AccountSource is the source of a request made by an account
+func AccountSource(accountID int, ip string) Source {
+	return Source{Actor: "account:" + strconv.Itoa(accountID), AccountID: accountID, IP: ip}
+}
+
+// sourceContextKey is the context key under which WithSource stores a Source
+type sourceContextKey struct{}
+
+// WithSource returns a copy of ctx carrying the source of its request
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, src)
+}
+
+// SourceFrom returns the source stored by WithSource, or the system source when there is none
+func SourceFrom(ctx context.Context) Source {
+	src, _ := ctx.Value(sourceContextKey{}).(Source)
+	if src.Actor == "" {
+		src.Actor = ActorSystem
+	}
+	return src
+}
+
+// Event is one change to record
+type Event struct {
+	LenderID     int    // 0 for changes outside any lender, such as plan edits
+	Actor        string // Overrides the source's actor when set
+	Action       string // One of the models.Audit* actions
+	ResourceType string
+	ResourceID   int
+	Details      any // Stored as JSON when non-nil
+}
+
+// NewEntry builds the Audit_Log row of an event made at at by the source of ctx
+func NewEntry(ctx context.Context, e Event, at time.Time) (models.AuditEntry, error) {
+	src := SourceFrom(ctx)
+	entry := models.AuditEntry{
+		LenderID:     sql.NullInt64{Int64: int64(e.LenderID), Valid: e.LenderID != 0},
+		Actor:        src.Actor,
+		AccountID:    sql.NullInt64{Int64: int64(src.AccountID), Valid: src.AccountID != 0},
+		Action:       e.Action,
+		ResourceType: e.ResourceType,
+		ResourceID:   sql.NullInt64{Int64: int64(e.ResourceID), Valid: e.ResourceID != 0},
+		IPAddress:    sql.NullString{String: src.IP, Valid: src.IP != ""},
+		CreatedAt:    models.NewJSONTime(at.UTC()),
+	}
+	if e.Actor != "" {
+		entry.Actor = e.Actor
+	}
+	if e.Details != nil {
+		data, err := json.Marshal(e.Details)
+		if err != nil {
+			return models.AuditEntry{}, err
+		}
+		entry.Details = sql.NullString{String: string(data), Valid: true}
+	}
+	return entry, nil
+}
+
+// Store writes Audit_Log rows
+type Store interface {
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+}
+
+// Auditor records changes after they have been made
+type Auditor struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewAuditor creates a new Auditor writing to store.
+func NewAuditor(store Store) *Auditor {
+	return &Auditor{store: store, now: time.Now}
+}
+
+// Record writes the event on behalf of the source of ctx. The change it describes has already
+// been made, so a failure is logged and dropped rather than failing the request; the write
+// outlives ctx being cancelled, such as by the client disconnecting.
+func (a *Auditor) Record(ctx context.Context, e Event) {
+	entry, err := NewEntry(ctx, e, a.now())
+	if err == nil {
+		err = a.store.RecordAudit(context.WithoutCancel(ctx), entry)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry", "action", e.Action, "resource_type", e.ResourceType, "resource_id", e.ResourceID, "error", err)
+	}
+}
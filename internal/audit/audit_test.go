@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// fakeStore keeps recorded entries in memory, failing every write when err is set
+type fakeStore struct {
+	entries []models.AuditEntry
+	ctxErrs []error
+	err     error
+}
+
+func (f *fakeStore) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	f.ctxErrs = append(f.ctxErrs, ctx.Err())
+	if f.err != nil {
+		return f.err
+	}
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func TestNewEntry(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("SAST", 2*60*60))
+	event := Event{LenderID: 4, Action: models.AuditLoanPaid, ResourceType: "loan", ResourceID: 9, Details: map[string]int{"n": 1}}
+
+	// Test case 1: The request's account and address are recorded
+	ctx := WithSource(context.Background(), AccountSource(12, "10.0.0.1"))
+	entry, err := NewEntry(ctx, event, at)
+	if err != nil {
+		t.Fatalf("NewEntry failed: %v", err)
+	}
+	if entry.Actor != "account:12" || entry.AccountID.Int64 != 12 || entry.IPAddress.String != "10.0.0.1" {
+		t.Errorf("Unexpected source: %+v", entry)
+	}
+	if entry.LenderID.Int64 != 4 || entry.ResourceID.Int64 != 9 || entry.Details.String != `{"n":1}` || !entry.CreatedAt.Equal(at) || entry.CreatedAt.Location() != time.UTC {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	// Test case 2: Without a source the change is the system's, with no account or address
+	entry, _ = NewEntry(context.Background(), Event{Action: models.AuditPlanCreated, ResourceType: "plan"}, at)
+	if entry.Actor != ActorSystem || entry.AccountID.Valid || entry.IPAddress.Valid || entry.LenderID.Valid || entry.ResourceID.Valid || entry.Details.Valid {
+		t.Errorf("Unexpected system entry: %+v", entry)
+	}
+
+	// Test case 3: An event's actor overrides the source's, keeping its account
+	entry, _ = NewEntry(ctx, Event{Actor: "support@example.com", Action: models.AuditLenderSuspended}, at)
+	if entry.Actor != "support@example.com" || entry.AccountID.Int64 != 12 {
+		t.Errorf("Unexpected actor: %+v", entry)
+	}
+}
+
+func TestAuditorRecord(t *testing.T) {
+	store := &fakeStore{}
+	auditor := NewAuditor(store)
+	ctx := WithSource(context.Background(), AccountSource(3, "10.0.0.2"))
+
+	// Test case 1: Events are written with the request's source
+	auditor.Record(ctx, Event{LenderID: 1, Action: models.AuditBorrowerCreated, ResourceType: "borrower", ResourceID: 5})
+	if len(store.entries) != 1 || store.entries[0].AccountID.Int64 != 3 {
+		t.Fatalf("Unexpected entries: %+v", store.entries)
+	}
+
+	// Test case 2: A cancelled request still gets its entry
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	auditor.Record(cancelled, Event{LenderID: 1, Action: models.AuditBorrowerUpdated, ResourceType: "borrower", ResourceID: 5})
+	if len(store.entries) != 2 || store.ctxErrs[1] != nil {
+		t.Errorf("Expected the write to outlive the request context, got %v", store.ctxErrs)
+	}
+
+	// Test case 3: Store and encoding failures are dropped
+	store.err = errors.New("database is locked")
+	auditor.Record(ctx, Event{Action: models.AuditLoanPaid})
+	store.err = nil
+	auditor.Record(ctx, Event{Action: models.AuditLoanPaid, Details: func() {}})
+	if len(store.entries) != 2 {
+		t.Errorf("Expected no further entries, got %+v", store.entries)
+	}
+}
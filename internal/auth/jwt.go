@@ -1,17 +1,24 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 const (
-	AccessTokenDuration  = 15 * time.Minute
-	RefreshTokenDuration = 7 * 24 * time.Hour
+	AccessTokenDuration      = 15 * time.Minute
+	RefreshTokenDuration     = 7 * 24 * time.Hour
+	EmailVerifyTokenDuration = time.Hour
 )
 
+// PurposeEmailVerify marks tokens that can only verify a borrower's email address
+const PurposeEmailVerify = "email_verify"
+
 type TokenPair struct {
 	AccessToken  string
 	RefreshToken string
@@ -20,9 +27,30 @@ type TokenPair struct {
 type Claims struct {
 	AccountID int64
 	LenderID  int64
+	Purpose   string `json:",omitempty"` // Empty for access and refresh tokens
 	jwt.RegisteredClaims
 }
 
+// EmailVerifyClaims are the claims of a borrower email verification token. EmailHash identifies
+// the address the token was sent to without revealing it.
+type EmailVerifyClaims struct {
+	BorrowerID int64
+	EmailHash  string
+	Purpose    string
+	jwt.RegisteredClaims
+}
+
+// Verifies reports whether the token was issued for email, ignoring case and surrounding spaces.
+func (c *EmailVerifyClaims) Verifies(email string) bool {
+	return c.EmailHash == hashEmail(email)
+}
+
+// hashEmail returns the hex SHA-256 of the normalized email
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
 // GenerateAccessToken creates a new access token for the given account and lender IDs.
 func GenerateAccessToken(accountID, lenderID int64, secretKey string) (string, error) {
 	claims := Claims{
@@ -79,25 +107,64 @@ func GenerateTokenPair(accountID, lenderID int64, secretKey string) (*TokenPair,
 	}, nil
 }
 
-// ValidateToken parses and validates a JWT token string, returning its claims if valid.
+// GenerateEmailVerifyToken creates a short-lived token that verifies the borrower's email address
+// email, and only that address. It carries PurposeEmailVerify, so ValidateToken rejects it.
+func GenerateEmailVerifyToken(borrowerID int64, email, secretKey string) (string, error) {
+	claims := EmailVerifyClaims{
+		BorrowerID: borrowerID,
+		EmailHash:  hashEmail(email),
+		Purpose:    PurposeEmailVerify,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(EmailVerifyTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secretKey))
+}
+
+// ValidateToken parses and validates an access or refresh token string, returning its claims if
+// valid. Tokens issued for a single purpose, such as email verification, are rejected.
 func ValidateToken(tokenString, secretKey string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+	claims := &Claims{}
+	if err := parseSigned(tokenString, secretKey, claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("a %s token cannot be used for authentication", claims.Purpose)
+	}
+	return claims, nil
+}
+
+// ValidateEmailVerifyToken parses and validates an email verification token, returning its claims.
+// Any other token is rejected. Callers must check the borrower's current email with Verifies.
+func ValidateEmailVerifyToken(tokenString, secretKey string) (*EmailVerifyClaims, error) {
+	claims := &EmailVerifyClaims{}
+	if err := parseSigned(tokenString, secretKey, claims); err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeEmailVerify || claims.BorrowerID <= 0 || claims.EmailHash == "" {
+		return nil, fmt.Errorf("not an email verification token")
+	}
+	return claims, nil
+}
+
+// parseSigned checks an HMAC-signed token string and decodes its claims into claims
+func parseSigned(tokenString, secretKey string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(secretKey), nil
 	})
-
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
 	}
-
-	return claims, nil
+	return nil
 }
 
 // ExtractAccountID extracts the AccountID from a validated token.
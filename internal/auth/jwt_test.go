@@ -238,3 +238,41 @@ func TestExtractLenderID(t *testing.T) {
 		t.Fatal("ExtractLenderID unexpectedly succeeded with invalid token string")
 	}
 }
+
+func TestEmailVerifyToken(t *testing.T) {
+	tokenString, err := GenerateEmailVerifyToken(42, "Borrower@Example.com", testSecretKey)
+	if err != nil {
+		t.Fatalf("GenerateEmailVerifyToken failed: %v", err)
+	}
+
+	// Test case 1: The token names its borrower and verifies only the address it was sent to
+	claims, err := ValidateEmailVerifyToken(tokenString, testSecretKey)
+	if err != nil || claims.BorrowerID != 42 {
+		t.Fatalf("Expected borrower 42, got %+v: %v", claims, err)
+	}
+	if !claims.Verifies(" borrower@example.com") || claims.Verifies("new-address@example.com") {
+		t.Error("Expected the token to verify only the address it was sent to")
+	}
+
+	// Test case 2: It cannot act as an access token
+	if _, err := ValidateToken(tokenString, testSecretKey); err == nil {
+		t.Error("Expected ValidateToken to reject an email verification token")
+	}
+
+	// Test case 3: Access tokens, other keys and expired tokens cannot verify an email
+	access, _ := GenerateAccessToken(testAccountID, testLenderID, testSecretKey)
+	if _, err := ValidateEmailVerifyToken(access, testSecretKey); err == nil {
+		t.Error("Expected an access token to be rejected")
+	}
+	if _, err := ValidateEmailVerifyToken(tokenString, "another-key"); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, EmailVerifyClaims{
+		BorrowerID:       42,
+		Purpose:          PurposeEmailVerify,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))},
+	}).SignedString([]byte(testSecretKey))
+	if _, err := ValidateEmailVerifyToken(expired, testSecretKey); err == nil {
+		t.Error("Expected an expired token to be rejected")
+	}
+}
@@ -1,11 +1,17 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"wisetech-lms-api/internal/currency"
 )
 
 // Config holds all configuration for the application
@@ -14,33 +20,458 @@ type Config struct {
 	Environment string
 	JWTSecret   string
 	DBPath      string
+	AdminAPIKey string // Admin endpoints are disabled when empty
+	LogFormat   string // json or text; json by default in production and text elsewhere
+
+	AllowedHosts []string // Host headers the API answers; any host is served when empty
+
+	SeedDefaultPlans bool // Insert the default plans on start when the Plans table is empty
+
+	ShutdownTimeout time.Duration // How long a shutdown waits for in-flight requests and jobs to finish
+
+	SlowQueryThreshold time.Duration // Queries running longer than this are logged; 0 disables the log
+
+	SubscriptionGraceDays int // Days after a paid subscription ends during which writes are still allowed
+
+	SubscriptionNoticeDays []int // Days before a subscription ends at which the lender is reminded
+
+	LoginMaxAttempts int           // Consecutive failed logins that trigger a temporary lockout; 0 disables it
+	LoginLockout     time.Duration // How long a temporary lockout lasts
+
+	RegistrationDailyLimit int // Lenders one client address may register per 24 hours; 0 disables the limit
+
+	PasswordBreachCheck bool // Reject new passwords found in the Have I Been Pwned corpus
+
+	DefaultCurrency string // ISO 4217 code given to lenders that register without one
+
+	TimeSeriesMaxPoints int // Most periods GET /api/dashboard/timeseries returns in one request
+
+	LoanBackdateDays  int // Days before today a new loan may start; admins may backdate further
+	LoanMaxFutureDays int // Days after today a new loan may start; 0 uses the server's default of 365
+
+	DefaultPageSize int // Items a list endpoint returns when no limit is given; 0 uses 50
+	MaxPageSize     int // Largest limit a list endpoint honours; larger ones are clamped. 0 uses 200
+
+	ReportCacheEnabled bool          // Serve repeated report requests from memory until the lender's loans or receipts change
+	ReportCacheTTL     time.Duration // How long a cached report is served at most
+
+	// Mail; messages are only logged when SMTPHost is empty
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	AppBaseURL   string // Frontend origin used to build links in emails
+
+	UploadDir          string   // Root directory of the local file store
+	UploadMaxBytes     int64    // Largest file accepted by POST /api/files
+	UploadAllowedTypes []string // Detected MIME types accepted by POST /api/files
+	LogoMaxDimension   int      // Longest side, in pixels, of a stored logo; larger uploads are downscaled
+	ClamAVAddr         string   // host:port of the clamd that scans uploads; uploads are not scanned when empty
+
+	// File storage; new files go to StorageBackend ("local" or "s3"). Files already stored locally
+	// stay readable after switching to S3.
+	StorageBackend    string
+	S3Endpoint        string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
 }
 
-// Load loads the configuration from environment variables
+// Load loads the configuration from environment variables and, when CONFIG_FILE names one, a YAML
+// or JSON file. Environment variables, including those from .env, override the file, and the file
+// overrides the defaults. The merged configuration is validated.
 func Load() (*Config, error) {
 	// Load .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("No .env file found, using environment variables")
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	values := &sources{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if values.file, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	serverPort, err := strconv.Atoi(values.get("SERVER_PORT", "8080"))
+	if err != nil {
+		return nil, err
+	}
+
+	seedDefaultPlans, err := strconv.ParseBool(values.get("SEED_DEFAULT_PLANS", "true"))
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownSeconds, err := strconv.Atoi(values.get("SHUTDOWN_TIMEOUT_SECONDS", "30"))
+	if err != nil {
+		return nil, err
+	}
+
+	slowQueryMillis, err := strconv.Atoi(values.get("SLOW_QUERY_THRESHOLD_MS", "500"))
+	if err != nil {
+		return nil, err
+	}
+
+	graceDays, err := strconv.Atoi(values.get("SUBSCRIPTION_GRACE_DAYS", "7"))
+	if err != nil {
+		return nil, err
+	}
+
+	noticeDays, err := parseDays(values.get("SUBSCRIPTION_NOTICE_DAYS", "7,1"))
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxAttempts, err := strconv.Atoi(values.get("LOGIN_MAX_ATTEMPTS", "5"))
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutMinutes, err := strconv.Atoi(values.get("LOGIN_LOCKOUT_MINUTES", "15"))
+	if err != nil {
+		return nil, err
+	}
+
+	registrationDailyLimit, err := strconv.Atoi(values.get("REGISTRATION_DAILY_LIMIT", "5"))
+	if err != nil {
+		return nil, err
+	}
+
+	passwordBreachCheck, err := strconv.ParseBool(values.get("PASSWORD_BREACH_CHECK", "false"))
+	if err != nil {
+		return nil, err
+	}
+
+	defaultCurrency, _ := currency.Normalize(values.get("DEFAULT_CURRENCY", currency.Default))
+
+	timeSeriesMaxPoints, err := strconv.Atoi(values.get("TIMESERIES_MAX_POINTS", "366"))
+	if err != nil {
+		return nil, err
+	}
+
+	loanBackdateDays, err := strconv.Atoi(values.get("LOAN_BACKDATE_DAYS", "0"))
+	if err != nil {
+		return nil, err
+	}
+
+	loanMaxFutureDays, err := strconv.Atoi(values.get("LOAN_MAX_FUTURE_DAYS", "365"))
+	if err != nil {
+		return nil, err
+	}
+
+	defaultPageSize, err := strconv.Atoi(values.get("DEFAULT_PAGE_SIZE", strconv.Itoa(defaultPageSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	maxPageSize, err := strconv.Atoi(values.get("MAX_PAGE_SIZE", strconv.Itoa(maxPageSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	reportCacheEnabled, err := strconv.ParseBool(values.get("REPORT_CACHE_ENABLED", "true"))
+	if err != nil {
+		return nil, err
+	}
+
+	reportCacheSeconds, err := strconv.Atoi(values.get("REPORT_CACHE_TTL_SECONDS", "30"))
+	if err != nil {
+		return nil, err
+	}
+
+	smtpPort, err := strconv.Atoi(values.get("SMTP_PORT", "587"))
+	if err != nil {
+		return nil, err
+	}
+
+	uploadMaxBytes, err := strconv.ParseInt(values.get("UPLOAD_MAX_BYTES", "10485760"), 10, 64)
+	if err != nil {
+		return nil, err
 	}
 
-	serverPort, err := strconv.Atoi(getEnv("SERVER_PORT", "8080"))
+	logoMaxDimension, err := strconv.Atoi(values.get("LOGO_MAX_DIMENSION", "512"))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Config{
+	environment := values.get("ENVIRONMENT", "development")
+	logFormat := "text"
+	if environment == "production" {
+		logFormat = "json"
+	}
+
+	cfg := &Config{
 		ServerPort:  serverPort,
-		Environment: getEnv("ENVIRONMENT", "development"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key"),
-		DBPath:      getEnv("DB_PATH", "wisetech_lms.db"),
-	}, nil
+		Environment: environment,
+		JWTSecret:   values.get("JWT_SECRET", "your-secret-key"),
+		DBPath:      values.get("DB_PATH", "wisetech_lms.db"),
+		AdminAPIKey: values.get("ADMIN_API_KEY", ""),
+		LogFormat:   values.get("LOG_FORMAT", logFormat),
+
+		AllowedHosts: parseList(values.get("ALLOWED_HOSTS", "")),
+
+		SeedDefaultPlans: seedDefaultPlans,
+
+		ShutdownTimeout: time.Duration(shutdownSeconds) * time.Second,
+
+		SlowQueryThreshold: time.Duration(slowQueryMillis) * time.Millisecond,
+
+		SubscriptionGraceDays:  graceDays,
+		SubscriptionNoticeDays: noticeDays,
+
+		LoginMaxAttempts: loginMaxAttempts,
+		LoginLockout:     time.Duration(lockoutMinutes) * time.Minute,
+
+		RegistrationDailyLimit: registrationDailyLimit,
+
+		PasswordBreachCheck: passwordBreachCheck,
+
+		DefaultCurrency: defaultCurrency,
+
+		TimeSeriesMaxPoints: timeSeriesMaxPoints,
+
+		LoanBackdateDays:  loanBackdateDays,
+		LoanMaxFutureDays: loanMaxFutureDays,
+
+		DefaultPageSize: defaultPageSize,
+		MaxPageSize:     maxPageSize,
+
+		ReportCacheEnabled: reportCacheEnabled,
+		ReportCacheTTL:     time.Duration(reportCacheSeconds) * time.Second,
+
+		SMTPHost:     values.get("SMTP_HOST", ""),
+		SMTPPort:     smtpPort,
+		SMTPUsername: values.get("SMTP_USERNAME", ""),
+		SMTPPassword: values.get("SMTP_PASSWORD", ""),
+		MailFrom:     values.get("MAIL_FROM", "no-reply@wisetech.local"),
+		AppBaseURL:   values.get("APP_BASE_URL", "http://localhost:3000"),
+
+		UploadDir:          values.get("UPLOAD_DIR", "uploads"),
+		UploadMaxBytes:     uploadMaxBytes,
+		UploadAllowedTypes: parseList(values.get("UPLOAD_ALLOWED_TYPES", "application/pdf,image/png,image/jpeg")),
+		LogoMaxDimension:   logoMaxDimension,
+		ClamAVAddr:         values.get("CLAMAV_ADDR", ""),
+
+		StorageBackend:    values.get("STORAGE_BACKEND", "local"),
+		S3Endpoint:        values.get("S3_ENDPOINT", ""),
+		S3Region:          values.get("S3_REGION", "us-east-1"),
+		S3Bucket:          values.get("S3_BUCKET", ""),
+		S3AccessKeyID:     values.get("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: values.get("S3_SECRET_ACCESS_KEY", ""),
+	}
+	if err := values.checkFileKeys(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
+// Validate reports the first setting that is out of range or inconsistent with the others
+func (c *Config) Validate() error {
+	switch {
+	case c.ServerPort < 1 || c.ServerPort > 65535:
+		return fmt.Errorf("SERVER_PORT must be between 1 and 65535, got %d", c.ServerPort)
+	case c.SMTPPort < 1 || c.SMTPPort > 65535:
+		return fmt.Errorf("SMTP_PORT must be between 1 and 65535, got %d", c.SMTPPort)
+	case c.LogFormat != "json" && c.LogFormat != "text":
+		return fmt.Errorf("LOG_FORMAT must be json or text, got %q", c.LogFormat)
+	case c.ShutdownTimeout <= 0:
+		return fmt.Errorf("SHUTDOWN_TIMEOUT_SECONDS must be positive")
+	case c.SlowQueryThreshold < 0:
+		return fmt.Errorf("SLOW_QUERY_THRESHOLD_MS must not be negative")
+	case c.SubscriptionGraceDays < 0:
+		return fmt.Errorf("SUBSCRIPTION_GRACE_DAYS must not be negative, got %d", c.SubscriptionGraceDays)
+	case c.LoginMaxAttempts < 0:
+		return fmt.Errorf("LOGIN_MAX_ATTEMPTS must not be negative, got %d", c.LoginMaxAttempts)
+	case c.LoginLockout < 0:
+		return fmt.Errorf("LOGIN_LOCKOUT_MINUTES must not be negative")
+	case c.RegistrationDailyLimit < 0:
+		return fmt.Errorf("REGISTRATION_DAILY_LIMIT must not be negative, got %d", c.RegistrationDailyLimit)
+	case c.TimeSeriesMaxPoints < 0:
+		return fmt.Errorf("TIMESERIES_MAX_POINTS must not be negative, got %d", c.TimeSeriesMaxPoints)
+	case c.LoanBackdateDays < 0:
+		return fmt.Errorf("LOAN_BACKDATE_DAYS must not be negative, got %d", c.LoanBackdateDays)
+	case c.LoanMaxFutureDays < 0:
+		return fmt.Errorf("LOAN_MAX_FUTURE_DAYS must not be negative, got %d", c.LoanMaxFutureDays)
+	case c.DefaultPageSize < 0:
+		return fmt.Errorf("DEFAULT_PAGE_SIZE must not be negative, got %d", c.DefaultPageSize)
+	case c.MaxPageSize < 0:
+		return fmt.Errorf("MAX_PAGE_SIZE must not be negative, got %d", c.MaxPageSize)
+	case c.DefaultPageSize > 0 && c.MaxPageSize > 0 && c.DefaultPageSize > c.MaxPageSize:
+		return fmt.Errorf("DEFAULT_PAGE_SIZE must not exceed MAX_PAGE_SIZE, got %d and %d", c.DefaultPageSize, c.MaxPageSize)
+	case c.ReportCacheEnabled && c.ReportCacheTTL <= 0:
+		return fmt.Errorf("REPORT_CACHE_TTL_SECONDS must be positive while the report cache is enabled")
+	case c.UploadMaxBytes < 0:
+		return fmt.Errorf("UPLOAD_MAX_BYTES must not be negative, got %d", c.UploadMaxBytes)
+	case c.LogoMaxDimension < 0:
+		return fmt.Errorf("LOGO_MAX_DIMENSION must not be negative, got %d", c.LogoMaxDimension)
+	}
+	if code, ok := currency.Normalize(c.DefaultCurrency); !ok || code != c.DefaultCurrency {
+		return fmt.Errorf("DEFAULT_CURRENCY must be an ISO 4217 currency code, got %q", c.DefaultCurrency)
+	}
+	switch c.StorageBackend {
+	case "local":
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			return fmt.Errorf("STORAGE_BACKEND=s3 requires S3_ENDPOINT and S3_BUCKET")
+		}
+	default:
+		return fmt.Errorf("STORAGE_BACKEND must be local or s3, got %q", c.StorageBackend)
+	}
+	return nil
+}
+
+// Page is a normalized limit and offset for a paginated list
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// defaultPageSize and maxPageSize apply when DefaultPageSize or MaxPageSize is 0
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// NormalizePage clamps a requested limit and offset to the configured page sizes: a limit of 0 or
+// less becomes DefaultPageSize, one above MaxPageSize becomes MaxPageSize, and a negative offset
+// becomes 0.
+func (c *Config) NormalizePage(limit, offset int) Page {
+	size, largest := c.DefaultPageSize, c.MaxPageSize
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	if largest <= 0 {
+		largest = maxPageSize
+	}
+	if limit <= 0 {
+		limit = size
+	}
+	return Page{Limit: min(limit, largest), Offset: max(offset, 0)}
+}
+
+// parseDays parses a comma-separated list of positive day counts such as "7,1"
+func parseDays(value string) ([]int, error) {
+	var days []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		if d < 1 {
+			return nil, fmt.Errorf("day count must be positive, got %d", d)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+// parseList splits a comma-separated list, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// sources looks settings up by environment variable name: in the environment first, then in the
+// values read from the config file
+type sources struct {
+	file map[string]string
+	used map[string]bool
+}
+
+// get returns the setting named key, or defaultValue when neither the environment nor the file sets it
+func (s *sources) get(key, defaultValue string) string {
+	if s.used == nil {
+		s.used = make(map[string]bool)
+	}
+	s.used[key] = true
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
+	if value, exists := s.file[key]; exists {
+		return value
+	}
 	return defaultValue
 }
+
+// checkFileKeys rejects file settings Load never looked up, so a misspelt key is not silently ignored
+func (s *sources) checkFileKeys() error {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown settings in config file: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// readFile reads a flat YAML or JSON mapping of settings, keyed by their environment variable names
+// in either case (server_port or SERVER_PORT). Lists, such as upload_allowed_types, may be written
+// as sequences or as comma-separated strings.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	// JSON is valid YAML, so one decoder reads both
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		text, err := settingText(value)
+		if err != nil {
+			return nil, fmt.Errorf("config file setting %s: %w", key, err)
+		}
+		values[strings.ToUpper(key)] = text
+	}
+	return values, nil
+}
+
+// settingText renders a scalar or a list of scalars from the config file as the environment
+// variable would hold it
+func settingText(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			text, err := settingText(item)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := item.([]any); nested {
+				return "", fmt.Errorf("lists cannot be nested")
+			}
+			parts[i] = text
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("must be a value or a list of values, got %T", value)
+}
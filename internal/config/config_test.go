@@ -2,15 +2,39 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_DefaultValues(t *testing.T) {
 	// Unset env vars to ensure we are testing default values
 	os.Unsetenv("SERVER_PORT")
 	os.Unsetenv("ENVIRONMENT")
+	os.Unsetenv("LOG_FORMAT")
 	os.Unsetenv("JWT_SECRET")
 	os.Unsetenv("DB_PATH")
+	os.Unsetenv("SUBSCRIPTION_GRACE_DAYS")
+	os.Unsetenv("LOGIN_MAX_ATTEMPTS")
+	os.Unsetenv("SUBSCRIPTION_NOTICE_DAYS")
+	os.Unsetenv("LOGIN_LOCKOUT_MINUTES")
+	os.Unsetenv("REGISTRATION_DAILY_LIMIT")
+	os.Unsetenv("PASSWORD_BREACH_CHECK")
+	os.Unsetenv("SEED_DEFAULT_PLANS")
+	os.Unsetenv("UPLOAD_MAX_BYTES")
+	os.Unsetenv("UPLOAD_ALLOWED_TYPES")
+	os.Unsetenv("ALLOWED_HOSTS")
+	os.Unsetenv("STORAGE_BACKEND")
+	os.Unsetenv("DEFAULT_CURRENCY")
+	os.Unsetenv("SLOW_QUERY_THRESHOLD_MS")
+	os.Unsetenv("TIMESERIES_MAX_POINTS")
+	os.Unsetenv("LOAN_BACKDATE_DAYS")
+	os.Unsetenv("LOAN_MAX_FUTURE_DAYS")
+	os.Unsetenv("DEFAULT_PAGE_SIZE")
+	os.Unsetenv("MAX_PAGE_SIZE")
+	os.Unsetenv("REPORT_CACHE_ENABLED")
+	os.Unsetenv("REPORT_CACHE_TTL_SECONDS")
+	os.Unsetenv("SHUTDOWN_TIMEOUT_SECONDS")
 
 	// Load config
 	cfg, err := Load()
@@ -25,12 +49,69 @@ func TestLoadConfig_DefaultValues(t *testing.T) {
 	if cfg.Environment != "development" {
 		t.Errorf("Expected Environment to be 'development', got %s", cfg.Environment)
 	}
+	if cfg.LogFormat != "text" {
+		t.Errorf("Expected LogFormat to be 'text', got %s", cfg.LogFormat)
+	}
 	if cfg.JWTSecret != "your-secret-key" {
 		t.Errorf("Expected JWTSecret to be 'your-secret-key', got %s", cfg.JWTSecret)
 	}
 	if cfg.DBPath != "wisetech_lms.db" {
 		t.Errorf("Expected DBPath to be 'wisetech_lms.db', got %s", cfg.DBPath)
 	}
+	if !cfg.SeedDefaultPlans {
+		t.Error("Expected SeedDefaultPlans to default to true")
+	}
+	if cfg.SubscriptionGraceDays != 7 {
+		t.Errorf("Expected SubscriptionGraceDays to be 7, got %d", cfg.SubscriptionGraceDays)
+	}
+	if len(cfg.SubscriptionNoticeDays) != 2 || cfg.SubscriptionNoticeDays[0] != 7 || cfg.SubscriptionNoticeDays[1] != 1 {
+		t.Errorf("Expected SubscriptionNoticeDays to be [7 1], got %v", cfg.SubscriptionNoticeDays)
+	}
+	if cfg.LoginMaxAttempts != 5 || cfg.LoginLockout != 15*time.Minute {
+		t.Errorf("Expected a 15 minute lockout after 5 attempts, got %v after %d", cfg.LoginLockout, cfg.LoginMaxAttempts)
+	}
+	if cfg.RegistrationDailyLimit != 5 {
+		t.Errorf("Expected RegistrationDailyLimit to be 5, got %d", cfg.RegistrationDailyLimit)
+	}
+	if cfg.PasswordBreachCheck {
+		t.Error("Expected PasswordBreachCheck to default to false")
+	}
+	if cfg.StorageBackend != "local" || cfg.S3Region != "us-east-1" {
+		t.Errorf("Expected local storage and region us-east-1, got %s and %s", cfg.StorageBackend, cfg.S3Region)
+	}
+	if cfg.UploadMaxBytes != 10<<20 || len(cfg.UploadAllowedTypes) != 3 || cfg.UploadAllowedTypes[0] != "application/pdf" {
+		t.Errorf("Expected 10 MiB uploads of 3 types, got %d bytes of %v", cfg.UploadMaxBytes, cfg.UploadAllowedTypes)
+	}
+	if cfg.LogoMaxDimension != 512 {
+		t.Errorf("Expected LogoMaxDimension to be 512, got %d", cfg.LogoMaxDimension)
+	}
+	if cfg.ClamAVAddr != "" {
+		t.Errorf("Expected upload scanning to be off by default, got %q", cfg.ClamAVAddr)
+	}
+	if len(cfg.AllowedHosts) != 0 {
+		t.Errorf("Expected every host to be allowed by default, got %v", cfg.AllowedHosts)
+	}
+	if cfg.DefaultCurrency != "LSL" {
+		t.Errorf("Expected DefaultCurrency to be LSL, got %s", cfg.DefaultCurrency)
+	}
+	if cfg.SlowQueryThreshold != 500*time.Millisecond {
+		t.Errorf("Expected SlowQueryThreshold to be 500ms, got %v", cfg.SlowQueryThreshold)
+	}
+	if cfg.TimeSeriesMaxPoints != 366 {
+		t.Errorf("Expected TimeSeriesMaxPoints to be 366, got %d", cfg.TimeSeriesMaxPoints)
+	}
+	if cfg.LoanBackdateDays != 0 || cfg.LoanMaxFutureDays != 365 {
+		t.Errorf("Expected loans to start from today up to 365 days ahead, got %d back and %d ahead", cfg.LoanBackdateDays, cfg.LoanMaxFutureDays)
+	}
+	if cfg.DefaultPageSize != 50 || cfg.MaxPageSize != 200 {
+		t.Errorf("Expected pages of 50 up to 200, got %d up to %d", cfg.DefaultPageSize, cfg.MaxPageSize)
+	}
+	if !cfg.ReportCacheEnabled || cfg.ReportCacheTTL != 30*time.Second {
+		t.Errorf("Expected reports cached for 30s, got %v for %v", cfg.ReportCacheEnabled, cfg.ReportCacheTTL)
+	}
+	if cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("Expected a 30s shutdown timeout, got %v", cfg.ShutdownTimeout)
+	}
 }
 
 func TestLoadConfig_FromEnv(t *testing.T) {
@@ -53,6 +134,9 @@ func TestLoadConfig_FromEnv(t *testing.T) {
 	if cfg.Environment != "production" {
 		t.Errorf("Expected Environment to be 'production', got %s", cfg.Environment)
 	}
+	if cfg.LogFormat != "json" {
+		t.Errorf("Expected LogFormat to default to 'json' in production, got %s", cfg.LogFormat)
+	}
 	if cfg.JWTSecret != "a-different-secret" {
 		t.Errorf("Expected JWTSecret to be 'a-different-secret', got %s", cfg.JWTSecret)
 	}
@@ -90,3 +174,181 @@ func TestLoadConfig_FromDotEnv(t *testing.T) {
 		t.Errorf("Expected Environment to be 'staging', got %s", cfg.Environment)
 	}
 }
+
+func TestLoadConfig_StorageBackend(t *testing.T) {
+	defer os.Unsetenv("STORAGE_BACKEND")
+	defer os.Unsetenv("S3_ENDPOINT")
+	defer os.Unsetenv("S3_BUCKET")
+
+	// Test case 1: Unknown backends are rejected
+	os.Setenv("STORAGE_BACKEND", "ftp")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown storage backend")
+	}
+
+	// Test case 2: S3 needs an endpoint and bucket
+	os.Setenv("STORAGE_BACKEND", "s3")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for S3 without an endpoint and bucket")
+	}
+
+	os.Setenv("S3_ENDPOINT", "http://minio:9000")
+	os.Setenv("S3_BUCKET", "uploads")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.StorageBackend != "s3" || cfg.S3Endpoint != "http://minio:9000" || cfg.S3Bucket != "uploads" {
+		t.Errorf("Unexpected storage config: %+v", cfg)
+	}
+}
+
+func TestLoadConfig_LogFormat(t *testing.T) {
+	defer os.Unsetenv("LOG_FORMAT")
+	defer os.Unsetenv("ENVIRONMENT")
+
+	// Test case 1: LOG_FORMAT overrides the production default
+	os.Setenv("ENVIRONMENT", "production")
+	os.Setenv("LOG_FORMAT", "text")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LogFormat != "text" {
+		t.Errorf("Expected text, got %s", cfg.LogFormat)
+	}
+
+	// Test case 2: Unknown formats are rejected
+	os.Setenv("LOG_FORMAT", "logfmt")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown log format")
+	}
+}
+
+func TestLoadConfig_DefaultCurrency(t *testing.T) {
+	defer os.Unsetenv("DEFAULT_CURRENCY")
+
+	// Test case 1: Codes are normalized to upper case
+	os.Setenv("DEFAULT_CURRENCY", "zar")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.DefaultCurrency != "ZAR" {
+		t.Errorf("Expected ZAR, got %s", cfg.DefaultCurrency)
+	}
+
+	// Test case 2: Codes outside ISO 4217 are rejected
+	os.Setenv("DEFAULT_CURRENCY", "RAND")
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for an unknown currency code")
+	}
+}
+
+func TestLoadConfig_FromFile(t *testing.T) {
+	dir := t.TempDir()
+	defer os.Unsetenv("CONFIG_FILE")
+	defer os.Unsetenv("SERVER_PORT")
+	// Earlier tests may have left these set, for example from .env
+	for _, key := range []string{"SERVER_PORT", "ENVIRONMENT", "DB_PATH", "LOGIN_MAX_ATTEMPTS", "PASSWORD_BREACH_CHECK",
+		"UPLOAD_ALLOWED_TYPES", "SUBSCRIPTION_GRACE_DAYS", "SUBSCRIPTION_NOTICE_DAYS", "STORAGE_BACKEND"} {
+		os.Unsetenv(key)
+	}
+
+	yamlFile := filepath.Join(dir, "config.yaml")
+	os.WriteFile(yamlFile, []byte(`server_port: 9191
+environment: staging
+LOGIN_MAX_ATTEMPTS: 3
+password_breach_check: true
+upload_allowed_types:
+  - image/png
+  - application/pdf
+`), 0644)
+
+	// Test case 1: File values override the defaults, and unset ones keep their default
+	os.Setenv("CONFIG_FILE", yamlFile)
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ServerPort != 9191 || cfg.Environment != "staging" || cfg.LoginMaxAttempts != 3 || !cfg.PasswordBreachCheck {
+		t.Errorf("Expected the file's values, got %+v", cfg)
+	}
+	if len(cfg.UploadAllowedTypes) != 2 || cfg.UploadAllowedTypes[1] != "application/pdf" {
+		t.Errorf("Expected the file's list, got %v", cfg.UploadAllowedTypes)
+	}
+	if cfg.DBPath != "wisetech_lms.db" || cfg.SubscriptionGraceDays != 7 {
+		t.Errorf("Expected defaults for settings the file leaves out, got %+v", cfg)
+	}
+
+	// Test case 2: Environment variables override the file
+	os.Setenv("SERVER_PORT", "9292")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ServerPort != 9292 || cfg.Environment != "staging" {
+		t.Errorf("Expected SERVER_PORT from the environment and the rest from the file, got %d %s", cfg.ServerPort, cfg.Environment)
+	}
+	os.Unsetenv("SERVER_PORT")
+
+	// Test case 3: JSON files are read too
+	jsonFile := filepath.Join(dir, "config.json")
+	os.WriteFile(jsonFile, []byte(`{"server_port": 9393, "subscription_notice_days": [14, 3]}`), 0644)
+	os.Setenv("CONFIG_FILE", jsonFile)
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ServerPort != 9393 || len(cfg.SubscriptionNoticeDays) != 2 || cfg.SubscriptionNoticeDays[0] != 14 {
+		t.Errorf("Expected the JSON file's values, got %d %v", cfg.ServerPort, cfg.SubscriptionNoticeDays)
+	}
+
+	// Test case 4: Missing files, unknown keys and invalid merged values are rejected
+	for name, content := range map[string]string{
+		"typo.yaml":    "sever_port: 9191\n",
+		"nested.yaml":  "s3:\n  bucket: uploads\n",
+		"invalid.yaml": "server_port: 70000\n",
+		"storage.json": `{"storage_backend": "s3"}`,
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		os.Setenv("CONFIG_FILE", path)
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+	os.Setenv("CONFIG_FILE", filepath.Join(dir, "missing.yaml"))
+	if _, err := Load(); err == nil {
+		t.Error("Expected an error for a missing config file")
+	}
+}
+
+func TestNormalizePage(t *testing.T) {
+	cfg := &Config{DefaultPageSize: 20, MaxPageSize: 100}
+
+	// Test case 1: An oversized limit is clamped to the maximum
+	if page := cfg.NormalizePage(100000, 40); page != (Page{Limit: 100, Offset: 40}) {
+		t.Errorf("Expected the limit clamped to 100, got %+v", page)
+	}
+
+	// Test case 2: A zero or negative limit uses the default
+	for _, limit := range []int{0, -5} {
+		if page := cfg.NormalizePage(limit, 0); page.Limit != 20 {
+			t.Errorf("Limit %d: expected the default of 20, got %d", limit, page.Limit)
+		}
+	}
+
+	// Test case 3: A negative offset becomes zero
+	if page := cfg.NormalizePage(10, -3); page != (Page{Limit: 10, Offset: 0}) {
+		t.Errorf("Expected offset 0, got %+v", page)
+	}
+
+	// Test case 4: Unset sizes fall back to 50 and 200
+	if page := (&Config{}).NormalizePage(0, 0); page.Limit != 50 {
+		t.Errorf("Expected the built-in default of 50, got %d", page.Limit)
+	}
+	if page := (&Config{}).NormalizePage(1000, 0); page.Limit != 200 {
+		t.Errorf("Expected the built-in maximum of 200, got %d", page.Limit)
+	}
+}
@@ -0,0 +1,34 @@
+// Package currency validates ISO 4217 currency codes.
+package currency
+
+import "strings"
+
+// Default is the currency of lenders registered without one when no other default is configured
+const Default = "LSL"
+
+// codes are the active ISO 4217 currency codes, excluding funds, precious metals and testing codes
+var codes = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN BWP BYN
+		BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS
+		GIP GMD GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW
+		KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD
+		NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD
+		SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VED
+		VES VND VUV WST XAF XCD XCG XOF XPF YER ZAR ZMW ZWG`) {
+		set[code] = true
+	}
+	return set
+}()
+
+// Valid reports whether code is an active ISO 4217 currency code. Codes are upper case.
+func Valid(code string) bool {
+	return codes[code]
+}
+
+// Normalize trims and upper-cases a client-supplied currency code, and reports whether the result is valid.
+func Normalize(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, Valid(code)
+}
@@ -0,0 +1,25 @@
+package currency
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	for _, code := range []string{"LSL", "ZAR", "USD", "EUR", Default} {
+		if !Valid(code) {
+			t.Errorf("Expected %s to be valid", code)
+		}
+	}
+	for _, code := range []string{"", "lsl", "XXX", "XAU", "ABC", "USDT", "US"} {
+		if Valid(code) {
+			t.Errorf("Expected %q to be invalid", code)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if code, ok := Normalize(" zar "); !ok || code != "ZAR" {
+		t.Errorf("Expected ZAR, got %q (%v)", code, ok)
+	}
+	if _, ok := Normalize("rand"); ok {
+		t.Error("Expected an unknown code to be invalid")
+	}
+}
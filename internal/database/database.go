@@ -4,10 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"wisetech-lms-api/internal/config"
 )
 
@@ -70,6 +70,17 @@ CREATE TABLE IF NOT EXISTS Lender_Ledger (
     Updated_At DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Subscription_Events Table
+CREATE TABLE IF NOT EXISTS Subscription_Events (
+    Event_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Ledger_ID INTEGER NOT NULL REFERENCES Lender_Ledger(Ledger_ID) ON DELETE CASCADE,
+    From_Status TEXT NOT NULL,
+    To_Status TEXT NOT NULL,
+    Actor TEXT NOT NULL,
+    Reason TEXT,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Loans Table
 CREATE TABLE IF NOT EXISTS Loans (
     Loan_ID INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -131,6 +142,8 @@ CREATE TABLE IF NOT EXISTS Number (
 CREATE INDEX IF NOT EXISTS idx_accounts_lender_id ON Accounts(Lender_ID);
 CREATE INDEX IF NOT EXISTS idx_lender_ledger_lender_id ON Lender_Ledger(Lender_ID);
 CREATE INDEX IF NOT EXISTS idx_loans_borrower_id ON Loans(Borrower_ID);
+CREATE INDEX IF NOT EXISTS idx_subscription_events_ledger_id ON Subscription_Events(Ledger_ID);
+CREATE INDEX IF NOT EXISTS idx_recipets_loan_id ON Recipets(Loan_ID);
 
 -- Triggers to update the Updated_At timestamp
 CREATE TRIGGER IF NOT EXISTS update_lenders_updated_at AFTER UPDATE ON Lenders
@@ -182,32 +195,65 @@ BEGIN
 END;
 `
 
-// NewConnection creates a new database connection
-func NewConnection(cfg *config.Config) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", cfg.DBPath)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open database: %w", err)
+// connectAttempts and connectRetryDelay bound how long NewConnection waits for the database.
+// The delay doubles after each failed attempt.
+var (
+	connectAttempts   = 5
+	connectRetryDelay = time.Second
+)
+
+// pingWithRetry pings db up to attempts times, sleeping between failures, and returns the last error
+func pingWithRetry(db *sql.DB, attempts int, delay time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			slog.Warn("Database not reachable", "attempt", attempt, "attempts", attempts, "error", err)
+			time.Sleep(delay)
+			delay *= 2
+		}
 	}
+	return err
+}
 
-	// Ping the database to verify the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// NewConnection creates a new database connection. When cfg.SlowQueryThreshold is set, queries
+// running longer than it are logged.
+func NewConnection(cfg *config.Config) (*sql.DB, error) {
+	var db *sql.DB
+	if cfg.SlowQueryThreshold > 0 {
+		db = sql.OpenDB(newSlowQueryConnector(&sqlite3.SQLiteDriver{}, cfg.DBPath, cfg.SlowQueryThreshold,
+			slog.Default()))
+	} else {
+		var err error
+		if db, err = sql.Open("sqlite3", cfg.DBPath); err != nil {
+			return nil, fmt.Errorf("unable to open database: %w", err)
+		}
+	}
 
-	if err := db.PingContext(ctx); err != nil {
+	// Ping the database to verify the connection, retrying while it comes up
+	if err := pingWithRetry(db, connectAttempts, connectRetryDelay); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
 
-	log.Println("Successfully connected to the database")
+	slog.Info("Successfully connected to the database")
 	return db, nil
 }
 
-// InitializeSchema creates the database schema if it doesn't exist
+// InitializeSchema creates the database schema if it doesn't exist and applies pending migrations
 func InitializeSchema(db *sql.DB) error {
 	_, err := db.Exec(SqliteSchema)
 	if err != nil {
 		return fmt.Errorf("failed to initialize schema: %w", err)
 	}
-	log.Println("Database schema initialized successfully")
+	if err := Migrate(db); err != nil {
+		return err
+	}
+	slog.Info("Database schema initialized successfully")
 	return nil
 }
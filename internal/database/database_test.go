@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"wisetech-lms-api/internal/config"
 
@@ -54,6 +55,11 @@ func TestInitializeSchema(t *testing.T) {
 }
 
 func TestNewConnection_Failure(t *testing.T) {
+	// Retry quickly; the path never becomes reachable
+	attempts, delay := connectAttempts, connectRetryDelay
+	connectAttempts, connectRetryDelay = 2, time.Millisecond
+	defer func() { connectAttempts, connectRetryDelay = attempts, delay }()
+
 	// Create a new config with an invalid database path
 	cfg := &config.Config{
 		DBPath: "/non_existent_dir/test.db",
@@ -0,0 +1,647 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Migration is a versioned schema change applied once on top of SqliteSchema
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations lists every schema change in the order it must be applied.
+// Never edit or reorder an applied migration; append a new one instead.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "plan_trials",
+		SQL: `
+-- Trial plans start new lenders for Trial_Days days; existing plans are paid plans
+ALTER TABLE Plans ADD COLUMN Is_Trial INTEGER DEFAULT 0;
+ALTER TABLE Plans ADD COLUMN Trial_Days INTEGER DEFAULT 0 CHECK (Trial_Days >= 0);
+`,
+	},
+	{
+		Version: 2,
+		Name:    "receipt_lender",
+		SQL: `
+-- Transaction references are unique per lender, not globally. SQLite cannot drop the column's
+-- UNIQUE constraint, so the table is rebuilt with each receipt's lender taken from its loan.
+-- Foreign keys are not enforced, so dropping the old table leaves Receipt_Allocations alone.
+-- A receipt whose loan no longer exists has no lender to take: rather than drop it, the migration
+-- fails until an operator deletes or reassigns it.
+CREATE TABLE Recipets_New (
+    Recipet_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Loan_ID INTEGER NOT NULL REFERENCES Loans(Loan_ID) ON DELETE CASCADE,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    Status TEXT NOT NULL CHECK (Status IN ('paid', 'pending', 'failed', 'refunded')),
+    Amount REAL NOT NULL CHECK (Amount > 0),
+    Payment_Method TEXT,
+    Transaction_Reference TEXT,
+    Notes TEXT
+);
+CREATE TEMP TRIGGER recipets_without_loan BEFORE INSERT ON Recipets_New WHEN NEW.Lender_ID IS NULL
+BEGIN
+    SELECT RAISE(ABORT, 'Recipets has receipts whose loan no longer exists; delete or reassign them and migrate again');
+END;
+INSERT INTO Recipets_New (Recipet_ID, Loan_ID, Lender_ID, Timestamp, Status, Amount, Payment_Method, Transaction_Reference, Notes)
+SELECT r.Recipet_ID, r.Loan_ID, lo.Lender_ID, r.Timestamp, r.Status, r.Amount, r.Payment_Method, r.Transaction_Reference, r.Notes
+FROM Recipets r LEFT JOIN Loans lo ON lo.Loan_ID = r.Loan_ID;
+DROP TRIGGER recipets_without_loan;
+DROP TABLE Recipets;
+ALTER TABLE Recipets_New RENAME TO Recipets;
+
+CREATE INDEX IF NOT EXISTS idx_recipets_loan_id ON Recipets(Loan_ID);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recipets_lender_reference ON Recipets(Lender_ID, Transaction_Reference);
+`,
+	},
+	{
+		Version: 3,
+		Name:    "plan_prices",
+		SQL: `
+CREATE TABLE IF NOT EXISTS Plan_Prices (
+    Plan_Price_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Plan_ID INTEGER NOT NULL REFERENCES Plans(Plan_ID) ON DELETE CASCADE,
+    Currency TEXT NOT NULL,
+    Amount REAL NOT NULL CHECK (Amount >= 0),
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    Updated_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (Plan_ID, Currency)
+);
+
+CREATE TRIGGER IF NOT EXISTS update_plan_prices_updated_at AFTER UPDATE ON Plan_Prices
+FOR EACH ROW
+BEGIN
+    UPDATE Plan_Prices SET Updated_At = CURRENT_TIMESTAMP WHERE Plan_Price_ID = OLD.Plan_Price_ID;
+END;
+
+-- Existing single prices were charged in maloti
+INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) SELECT Plan_ID, 'LSL', Price FROM Plans;
+
+-- Snapshot of what was charged when the subscription was taken out
+ALTER TABLE Lender_Ledger ADD COLUMN Charged_Currency TEXT;
+ALTER TABLE Lender_Ledger ADD COLUMN Charged_Amount REAL;
+`,
+	},
+	{
+		Version: 4,
+		Name:    "subscription_payments",
+		SQL: `
+CREATE TABLE IF NOT EXISTS Subscription_Payments (
+    Payment_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Ledger_ID INTEGER NOT NULL REFERENCES Lender_Ledger(Ledger_ID) ON DELETE RESTRICT,
+    Amount REAL NOT NULL CHECK (Amount > 0),
+    Currency TEXT NOT NULL,
+    Method TEXT NOT NULL,
+    Reference TEXT NOT NULL UNIQUE,
+    Paid_At DATETIME NOT NULL,
+    Recorded_By TEXT NOT NULL,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_payments_ledger_id ON Subscription_Payments(Ledger_ID);
+CREATE INDEX IF NOT EXISTS idx_subscription_payments_paid_at ON Subscription_Payments(Paid_At);
+`,
+	},
+	{
+		Version: 5,
+		Name:    "borrower_address",
+		SQL: `
+-- Structured residence; the free-text Residence column is kept as a display fallback
+ALTER TABLE Borrowers ADD COLUMN Address_Line1 TEXT;
+ALTER TABLE Borrowers ADD COLUMN City TEXT;
+ALTER TABLE Borrowers ADD COLUMN Region TEXT;
+ALTER TABLE Borrowers ADD COLUMN Postal_Code TEXT;
+ALTER TABLE Borrowers ADD COLUMN Country TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_borrowers_city ON Borrowers(City);
+CREATE INDEX IF NOT EXISTS idx_borrowers_country ON Borrowers(Country);
+`,
+	},
+	{
+		Version: 6,
+		Name:    "password_resets",
+		SQL: `
+-- Only a SHA-256 hash of each reset token is stored
+CREATE TABLE IF NOT EXISTS Password_Resets (
+    Reset_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Account_ID INTEGER NOT NULL REFERENCES Accounts(Account_ID) ON DELETE CASCADE,
+    Token_Hash TEXT NOT NULL UNIQUE,
+    Expires_At DATETIME NOT NULL,
+    Used_At DATETIME,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_account_id ON Password_Resets(Account_ID);
+`,
+	},
+	{
+		Version: 7,
+		Name:    "plan_features",
+		SQL: `
+-- JSON object decoded into models.PlanFeatures
+ALTER TABLE Plans ADD COLUMN Features TEXT NOT NULL DEFAULT '{}';
+`,
+	},
+	{
+		Version: 8,
+		Name:    "lender_logo",
+		SQL: `
+-- What an uploaded file is used for, e.g. 'logo'
+ALTER TABLE File ADD COLUMN Purpose TEXT;
+ALTER TABLE Lenders ADD COLUMN Logo_File_ID INTEGER REFERENCES File(File_ID) ON DELETE SET NULL;
+
+-- A lender has at most one logo; uploading a new one replaces the row
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_lender_logo ON File(Lender_ID) WHERE Purpose = 'logo';
+`,
+	},
+	{
+		Version: 9,
+		Name:    "lender_suspension",
+		SQL: `
+ALTER TABLE Lenders ADD COLUMN Suspended_At DATETIME;
+ALTER TABLE Lenders ADD COLUMN Suspended_By TEXT;
+ALTER TABLE Lenders ADD COLUMN Suspension_Reason TEXT;
+
+-- Tokens issued before this time are rejected
+ALTER TABLE Accounts ADD COLUMN Tokens_Revoked_At DATETIME;
+
+-- Accounts locked by a lender suspension, so lifting it leaves admin hard locks alone
+ALTER TABLE Accounts ADD COLUMN Suspension_Locked INTEGER DEFAULT 0;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "outbox",
+		SQL: `
+ALTER TABLE Lenders ADD COLUMN Webhook_URL TEXT;
+
+-- Webhook events written in the same transaction as the change they describe.
+-- Rows with no Next_Attempt_At and no Delivered_At have exhausted their retries.
+CREATE TABLE IF NOT EXISTS Outbox (
+    Outbox_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Event_Type TEXT NOT NULL,
+    Payload TEXT NOT NULL,
+    Target TEXT NOT NULL,
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    Next_Attempt_At DATETIME,
+    Delivered_At DATETIME,
+    Last_Error TEXT,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON Outbox(Next_Attempt_At) WHERE Delivered_At IS NULL;
+`,
+	},
+	{
+		Version: 11,
+		Name:    "login_lockout",
+		SQL: `
+-- Temporary lockout after repeated failed logins; separate from the admin hard lock (Is_Locked)
+ALTER TABLE Accounts ADD COLUMN Failed_Login_Attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Accounts ADD COLUMN Locked_Until DATETIME;
+`,
+	},
+	{
+		Version: 12,
+		Name:    "expiry_notifications",
+		SQL: `
+-- One row per expiry reminder sent, so each threshold is only sent once per ledger row
+CREATE TABLE IF NOT EXISTS Expiry_Notifications (
+    Notification_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Ledger_ID INTEGER NOT NULL REFERENCES Lender_Ledger(Ledger_ID) ON DELETE CASCADE,
+    Threshold_Days INTEGER NOT NULL,
+    Sent_At DATETIME NOT NULL,
+    UNIQUE (Ledger_ID, Threshold_Days)
+);
+`,
+	},
+	{
+		Version: 13,
+		Name:    "file_storage_backend",
+		SQL: `
+-- Which storage backend holds the file; Value is the object key within it
+ALTER TABLE File ADD COLUMN Storage_Backend TEXT NOT NULL DEFAULT 'local';
+CREATE INDEX IF NOT EXISTS idx_file_storage_backend ON File(Storage_Backend, File_ID);
+`,
+	},
+	{
+		Version: 14,
+		Name:    "file_lender_size",
+		SQL: `
+-- Covers SUM(File_Size) per lender for storage quotas
+CREATE INDEX IF NOT EXISTS idx_file_lender_size ON File(Lender_ID, File_Size);
+`,
+	},
+	{
+		Version: 15,
+		Name:    "audit_log",
+		SQL: `
+-- Who did what to which resource, written in the same transaction as the change.
+-- Details holds a JSON snapshot of the resource where it is useful after the fact.
+CREATE TABLE IF NOT EXISTS Audit_Log (
+    Audit_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Lender_ID INTEGER REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Actor TEXT NOT NULL,
+    Action TEXT NOT NULL,
+    Resource_Type TEXT NOT NULL,
+    Resource_ID INTEGER,
+    Details TEXT,
+    Created_At DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_lender ON Audit_Log(Lender_ID, Created_At);
+`,
+	},
+	{
+		Version: 16,
+		Name:    "custom_field_names",
+		SQL: `
+-- Text and Number rows become named custom values; existing anonymous rows get a name from their ID
+ALTER TABLE Text ADD COLUMN Field_Name TEXT;
+ALTER TABLE Text ADD COLUMN Field_Group TEXT;
+UPDATE Text SET Field_Name = 'text_' || Text_ID WHERE Field_Name IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_text_lender_field ON Text(Lender_ID, Field_Name);
+
+ALTER TABLE Number ADD COLUMN Field_Name TEXT;
+ALTER TABLE Number ADD COLUMN Field_Group TEXT;
+UPDATE Number SET Field_Name = 'number_' || Number_ID WHERE Field_Name IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_number_lender_field ON Number(Lender_ID, Field_Name);
+`,
+	},
+	{
+		Version: 17,
+		Name:    "custom_field_definitions",
+		SQL: `
+CREATE TABLE IF NOT EXISTS Custom_Field_Definitions (
+    Definition_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Entity TEXT NOT NULL CHECK (Entity IN ('borrower', 'loan')),
+    Name TEXT NOT NULL,
+    Field_Type TEXT NOT NULL CHECK (Field_Type IN ('text', 'number', 'date', 'bool')),
+    Required INTEGER NOT NULL DEFAULT 0,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    Updated_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (Lender_ID, Entity, Name)
+);
+
+-- Value holds the JSON encoding of the typed value; dates are "YYYY-MM-DD" strings
+CREATE TABLE IF NOT EXISTS Custom_Field_Values (
+    Definition_ID INTEGER NOT NULL REFERENCES Custom_Field_Definitions(Definition_ID) ON DELETE CASCADE,
+    Entity_ID INTEGER NOT NULL,
+    Value TEXT NOT NULL,
+    PRIMARY KEY (Definition_ID, Entity_ID)
+);
+`,
+	},
+	{
+		Version: 18,
+		Name:    "file_variants",
+		SQL: `
+-- A resized variant, such as a downscaled logo, points at the File row holding its source image
+ALTER TABLE File ADD COLUMN Original_File_ID INTEGER REFERENCES File(File_ID);
+`,
+	},
+	{
+		Version: 19,
+		Name:    "file_scan_status",
+		SQL: `
+-- Files are only served once the malware scanner has found them clean; files uploaded before
+-- scanning existed are queued for it too
+ALTER TABLE File ADD COLUMN Status TEXT NOT NULL DEFAULT 'pending_scan' CHECK (Status IN ('pending_scan', 'clean', 'infected'));
+CREATE INDEX IF NOT EXISTS idx_file_status ON File(Status);
+`,
+	},
+	{
+		Version: 20,
+		Name:    "file_attachments",
+		SQL: `
+-- Files attached to a lender's records; Entity_ID is a Borrower_ID, Loan_ID or Recipet_ID by Entity_Type
+CREATE TABLE IF NOT EXISTS File_Attachments (
+    File_ID INTEGER NOT NULL REFERENCES File(File_ID) ON DELETE CASCADE,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Entity_Type TEXT NOT NULL CHECK (Entity_Type IN ('borrower', 'loan', 'receipt')),
+    Entity_ID INTEGER NOT NULL,
+    Attached_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (File_ID, Entity_Type, Entity_ID)
+);
+CREATE INDEX IF NOT EXISTS idx_file_attachments_entity ON File_Attachments(Lender_ID, Entity_Type, Entity_ID);
+`,
+	},
+	{
+		Version: 21,
+		Name:    "lender_currency",
+		SQL: `
+-- ISO 4217 code labelling the lender's loan and receipt amounts; existing lenders lent in maloti
+ALTER TABLE Lenders ADD COLUMN Currency TEXT NOT NULL DEFAULT 'LSL';
+`,
+	},
+	{
+		Version: 22,
+		Name:    "lender_branding",
+		SQL: `
+-- How generated documents such as statements and receipts present the lender. Without a branding
+-- logo, documents use the profile logo; empty colour and footer leave the defaults.
+ALTER TABLE Lenders ADD COLUMN Branding_Logo_File_ID INTEGER REFERENCES File(File_ID);
+ALTER TABLE Lenders ADD COLUMN Brand_Color TEXT NOT NULL DEFAULT '';
+ALTER TABLE Lenders ADD COLUMN Document_Footer TEXT NOT NULL DEFAULT '';
+ALTER TABLE Lenders ADD COLUMN Show_Contact_Details BOOLEAN NOT NULL DEFAULT 1;
+`,
+	},
+	{
+		Version: 23,
+		Name:    "receipt_allocations",
+		SQL: `
+-- How each paid receipt was split when it was recorded. Payments go to principal first, then to the
+-- interest scheduled above it; anything paid beyond both is counted as principal. Penalties are not
+-- charged yet, so they are always 0.
+CREATE TABLE IF NOT EXISTS Receipt_Allocations (
+    Recipet_ID INTEGER PRIMARY KEY REFERENCES Recipets(Recipet_ID) ON DELETE CASCADE,
+    Loan_ID INTEGER NOT NULL REFERENCES Loans(Loan_ID) ON DELETE CASCADE,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Principal REAL NOT NULL DEFAULT 0,
+    Interest REAL NOT NULL DEFAULT 0,
+    Penalties REAL NOT NULL DEFAULT 0,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_receipt_allocations_loan ON Receipt_Allocations(Loan_ID);
+
+-- Allocate the receipts already paid, in the order they were recorded
+INSERT INTO Receipt_Allocations (Recipet_ID, Loan_ID, Lender_ID, Principal, Interest)
+SELECT Recipet_ID, Loan_ID, Lender_ID, Amount - Interest, Interest
+FROM (
+    SELECT Recipet_ID, Loan_ID, Lender_ID, Amount,
+        MIN(MAX(Paid - Principal_Due, 0), Interest_Due) - MIN(MAX(Paid - Amount - Principal_Due, 0), Interest_Due) AS Interest
+    FROM (
+        SELECT r.Recipet_ID, r.Loan_ID, r.Lender_ID, r.Amount, lo.Amount AS Principal_Due,
+            MAX(COALESCE(lo.Monthly_Payment * lo.Months_To_Pay, 0) - lo.Amount, 0) AS Interest_Due,
+            SUM(r.Amount) OVER (PARTITION BY r.Loan_ID ORDER BY r.Timestamp, r.Recipet_ID) AS Paid
+        FROM Recipets r JOIN Loans lo ON lo.Loan_ID = r.Loan_ID
+        WHERE r.Status = 'paid'
+    )
+);
+`,
+	},
+	{
+		Version: 24,
+		Name:    "registrations",
+		SQL: `
+-- The client address each lender was registered from, for the per-address registration limit
+CREATE TABLE IF NOT EXISTS Registrations (
+    Registration_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    IP_Address TEXT NOT NULL,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_registrations_ip ON Registrations(IP_Address, Created_At);
+`,
+	},
+	{
+		Version: 25,
+		Name:    "lender_timezone",
+		SQL: `
+-- IANA time zone the lender's report days and months run in; existing lenders keep UTC
+ALTER TABLE Lenders ADD COLUMN Timezone TEXT NOT NULL DEFAULT 'UTC';
+`,
+	},
+	{
+		Version: 26,
+		Name:    "audit_log_source",
+		SQL: `
+-- The account and client address behind each audited change; NULL for background jobs and
+-- entries written before they were recorded
+ALTER TABLE Audit_Log ADD COLUMN Account_ID INTEGER;
+ALTER TABLE Audit_Log ADD COLUMN IP_Address TEXT;
+
+-- Covers filtering a lender's audit log by action
+CREATE INDEX IF NOT EXISTS idx_audit_log_lender_action ON Audit_Log(Lender_ID, Action, Created_At);
+`,
+	},
+	{
+		Version: 27,
+		Name:    "loan_origination_fee",
+		SQL: `
+-- Upfront fee charged when a loan is made, and whether it was added to the amortized principal
+-- instead of being paid upfront; existing loans carry no fee
+ALTER TABLE Loans ADD COLUMN Origination_Fee REAL NOT NULL DEFAULT 0 CHECK (Origination_Fee >= 0);
+ALTER TABLE Loans ADD COLUMN Fee_Financed INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 28,
+		Name:    "borrower_email_verified",
+		SQL: `
+-- Whether the borrower confirmed their email through a verification link; cleared when it changes
+ALTER TABLE Borrowers ADD COLUMN Email_Verified INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 29,
+		Name:    "report_subscriptions",
+		SQL: `
+-- Which reports each lender has emailed on the first of every month, in which format and to whom.
+-- Reports and Recipients are comma-separated lists.
+CREATE TABLE IF NOT EXISTS Report_Subscriptions (
+    Lender_ID INTEGER PRIMARY KEY REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Reports TEXT NOT NULL,
+    Format TEXT NOT NULL CHECK (Format IN ('csv', 'xlsx')),
+    Recipients TEXT NOT NULL,
+    Enabled INTEGER NOT NULL DEFAULT 1,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    Updated_At DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per email a background job owes a recipient, queued and retried like the Outbox.
+-- Period names what it covers, e.g. the YYYY-MM month of a report, so each is only queued once.
+CREATE TABLE IF NOT EXISTS Notifications (
+    Notification_ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Kind TEXT NOT NULL,
+    Period TEXT NOT NULL,
+    Recipient TEXT NOT NULL,
+    Payload TEXT NOT NULL,
+    Status TEXT NOT NULL DEFAULT 'pending' CHECK (Status IN ('pending', 'sent', 'failed')),
+    Attempts INTEGER NOT NULL DEFAULT 0,
+    Next_Attempt_At DATETIME,
+    Sent_At DATETIME,
+    Last_Error TEXT,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (Lender_ID, Kind, Period, Recipient)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_due ON Notifications(Next_Attempt_At) WHERE Status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_notifications_status ON Notifications(Status, Created_At);
+`,
+	},
+	{
+		Version: 30,
+		Name:    "loan_book_snapshots",
+		SQL: `
+-- Each lender's loan book as of the last day of every month that has ended in its time zone, so
+-- month-end reports do not drift when back-dated receipts are entered. Rows are never updated.
+-- Loan_ID carries no foreign key: a snapshot outlives changes to the loans it recorded.
+CREATE TABLE IF NOT EXISTS Loan_Book_Snapshots (
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Month TEXT NOT NULL, -- YYYY-MM
+    Loan_ID INTEGER NOT NULL,
+    Payment_Status TEXT NOT NULL,
+    Outstanding_Principal REAL NOT NULL,
+    Outstanding_Interest REAL NOT NULL,
+    Outstanding_Penalties REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (Lender_ID, Month, Loan_ID)
+);
+
+-- The lender's totals for each snapshot month: the outstanding balance of its active loans and the
+-- portfolio report as of the month's last day, as JSON.
+CREATE TABLE IF NOT EXISTS Loan_Book_Snapshot_Totals (
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Month TEXT NOT NULL,
+    As_Of TEXT NOT NULL, -- YYYY-MM-DD
+    Loans INTEGER NOT NULL,
+    Outstanding_Principal REAL NOT NULL,
+    Outstanding_Interest REAL NOT NULL,
+    Outstanding_Penalties REAL NOT NULL DEFAULT 0,
+    Portfolio TEXT NOT NULL,
+    Created_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (Lender_ID, Month)
+);
+
+CREATE TRIGGER IF NOT EXISTS loan_book_snapshots_immutable BEFORE UPDATE ON Loan_Book_Snapshots
+BEGIN
+    SELECT RAISE(ABORT, 'loan book snapshots are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS loan_book_snapshot_totals_immutable BEFORE UPDATE ON Loan_Book_Snapshot_Totals
+BEGIN
+    SELECT RAISE(ABORT, 'loan book snapshots are immutable');
+END;
+`,
+	},
+	{
+		Version: 31,
+		Name:    "notification_preferences",
+		SQL: `
+-- The events each lender has turned off, or back on, per channel. Without a row an event is sent.
+CREATE TABLE IF NOT EXISTS Notification_Preferences (
+    Lender_ID INTEGER NOT NULL REFERENCES Lenders(Lender_ID) ON DELETE CASCADE,
+    Event TEXT NOT NULL,
+    Channel TEXT NOT NULL,
+    Enabled BOOLEAN NOT NULL,
+    Updated_At DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (Lender_ID, Event, Channel)
+);
+
+-- The lender an outbox event is for, so the dispatcher can consult its preferences. Every event
+-- written so far carries it in its payload.
+ALTER TABLE Outbox ADD COLUMN Lender_ID INTEGER REFERENCES Lenders(Lender_ID);
+UPDATE Outbox SET Lender_ID = json_extract(Payload, '$.lender_id') WHERE json_valid(Payload);
+`,
+	},
+}
+
+// MigrateOptions controls RunMigrations
+type MigrateOptions struct {
+	DryRun bool // Log the pending migrations and their SQL without executing or recording them
+}
+
+// Migrate applies every migration that has not yet been recorded in schema_migrations.
+func Migrate(db *sql.DB) error {
+	_, err := RunMigrations(db, MigrateOptions{})
+	return err
+}
+
+// RunMigrations applies every migration that has not yet been recorded in schema_migrations and
+// returns their versions. Each migration runs in its own transaction together with its
+// schema_migrations row. With DryRun the pending versions are returned and logged, with their SQL,
+// but nothing is written, not even the schema_migrations table.
+func RunMigrations(db *sql.DB, opts MigrateOptions) ([]int, error) {
+	var applied map[int]bool
+	if opts.DryRun {
+		var exists int
+		err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+		}
+		applied = make(map[int]bool)
+		if exists > 0 {
+			if applied, err = appliedVersions(db); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    Version INTEGER PRIMARY KEY,
+    Name TEXT NOT NULL,
+    Applied_At DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		if applied, err = appliedVersions(db); err != nil {
+			return nil, err
+		}
+	}
+
+	var versions []int
+	for _, m := range Migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if opts.DryRun {
+			slog.Info("Pending migration", "version", m.Version, "name", m.Name, "sql", strings.TrimSpace(m.SQL))
+			versions = append(versions, m.Version)
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return versions, fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		versions = append(versions, m.Version)
+	}
+	if opts.DryRun && len(versions) == 0 {
+		slog.Info("No pending migrations")
+	}
+	return versions, nil
+}
+
+// appliedVersions returns the set of migration versions already recorded
+func appliedVersions(db *sql.DB) (map[int]bool, error) {
+	rows, err := db.Query("SELECT Version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs a single migration and records it atomically
+func applyMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (Version, Name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openMemoryDB opens a single-connection in-memory database with the base schema only.
+func openMemoryDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(SqliteSchema)
+	require.NoError(t, err)
+	return db
+}
+
+func TestMigrate_AppliesAllOnce(t *testing.T) {
+	db := openMemoryDB(t)
+
+	require.NoError(t, Migrate(db))
+	// Running again must be a no-op
+	require.NoError(t, Migrate(db))
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count))
+	assert.Equal(t, len(Migrations), count)
+}
+
+func TestMigrate_SeedsPlanPricesFromPrice(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// A plan created before Plan_Prices existed
+	_, err := db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Basic', 150)")
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+
+	var currency string
+	var amount float64
+	err = db.QueryRow("SELECT Currency, Amount FROM Plan_Prices WHERE Plan_ID = 1").Scan(&currency, &amount)
+	require.NoError(t, err)
+	assert.Equal(t, "LSL", currency)
+	assert.Equal(t, 150.0, amount)
+}
+
+func TestMigrate_AddsPlanTrials(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// A plan created before trials existed
+	_, err := db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Basic', 150)")
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+
+	var isTrial bool
+	var trialDays int
+	require.NoError(t, db.QueryRow("SELECT Is_Trial, Trial_Days FROM Plans WHERE Plan_ID = 1").Scan(&isTrial, &trialDays))
+	assert.False(t, isTrial)
+	assert.Equal(t, 0, trialDays)
+}
+
+func TestMigrate_NamesAnonymousCustomValues(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// Values stored before Text and Number had names
+	_, err := db.Exec(`INSERT INTO Lenders (Business_Name, Email, Phone_Number, Interest_Rate_Percent) VALUES ('Lender', 'lender@example.com', '123', 5);
+		INSERT INTO Text (Lender_ID, Value) VALUES (1, 'MAS01'), (1, 'MAS02');
+		INSERT INTO Number (Lender_ID, Value) VALUES (1, 50)`)
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+
+	var names []string
+	rows, err := db.Query("SELECT Field_Name FROM Text UNION ALL SELECT Field_Name FROM Number")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"text_1", "text_2", "number_1"}, names)
+
+	// Names are unique per lender
+	_, err = db.Exec("INSERT INTO Text (Lender_ID, Field_Name, Value) VALUES (1, 'text_1', 'again')")
+	assert.Error(t, err)
+}
+
+func TestMigrate_ScopesReceiptReferencesToLenders(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// Two lenders' receipts recorded while references were unique across lenders
+	_, err := db.Exec(`INSERT INTO Lenders (Business_Name, Email, Phone_Number, Interest_Rate_Percent) VALUES
+			('First', 'first@example.com', '123', 5), ('Second', 'second@example.com', '123', 5);
+		INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Borrower', 'borrower@example.com', '555');
+		INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date) VALUES
+			(1, 1, 12, 'active', 1000, 20, 100, '2026-01-01'), (1, 2, 12, 'active', 1000, 20, 100, '2026-01-01');
+		INSERT INTO Recipets (Loan_ID, Status, Amount, Transaction_Reference) VALUES (1, 'paid', 100, 'TX-1'), (2, 'paid', 100, 'TX-2')`)
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+
+	// Test case 1: Existing receipts take their loan's lender, and keep their allocations
+	var lenders []int
+	rows, err := db.Query("SELECT Lender_ID FROM Recipets ORDER BY Recipet_ID")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var lenderID int
+		require.NoError(t, rows.Scan(&lenderID))
+		lenders = append(lenders, lenderID)
+	}
+	assert.Equal(t, []int{1, 2}, lenders)
+	var allocated int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Receipt_Allocations").Scan(&allocated))
+	assert.Equal(t, 2, allocated)
+
+	// Test case 2: Another lender may reuse a reference; the same lender may not
+	_, err = db.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount, Transaction_Reference) VALUES (2, 2, 'paid', 100, 'TX-1')")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount, Transaction_Reference) VALUES (1, 1, 'paid', 100, 'TX-1')")
+	assert.Error(t, err)
+
+	// Test case 3: The base schema still applies on top of the migrated table
+	_, err = db.Exec(SqliteSchema)
+	assert.NoError(t, err)
+}
+
+func TestMigrate_KeepsReceiptsWithoutLoan(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// A receipt whose loan was deleted has no lender to take
+	_, err := db.Exec("INSERT INTO Recipets (Loan_ID, Status, Amount, Transaction_Reference) VALUES (42, 'paid', 100, 'TX-1')")
+	require.NoError(t, err)
+
+	// Test case 1: The migration fails instead of dropping the receipt
+	err = Migrate(db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "receipts whose loan no longer exists")
+
+	// Test case 2: The receipt is left as it was
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Recipets WHERE Transaction_Reference = 'TX-1'").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestMigrate_AllocatesPaidReceipts(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// A loan repaying 1200 on 1000, paid 600 then 500 before allocations existed
+	_, err := db.Exec(`INSERT INTO Lenders (Business_Name, Email, Phone_Number, Interest_Rate_Percent) VALUES ('Lender', 'lender@example.com', '123', 5);
+		INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Borrower', 'borrower@example.com', '555');
+		INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date)
+			VALUES (1, 1, 12, 'active', 1000, 20, 100, '2026-01-01');
+		INSERT INTO Recipets (Loan_ID, Timestamp, Status, Amount) VALUES
+			(1, '2026-02-01 10:00:00', 'paid', 600),
+			(1, '2026-02-15 10:00:00', 'failed', 300),
+			(1, '2026-03-01 10:00:00', 'paid', 500)`)
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+
+	rows, err := db.Query("SELECT Recipet_ID, Principal, Interest FROM Receipt_Allocations ORDER BY Recipet_ID")
+	require.NoError(t, err)
+	defer rows.Close()
+	var got [][3]float64
+	for rows.Next() {
+		var id, principal, interest float64
+		require.NoError(t, rows.Scan(&id, &principal, &interest))
+		got = append(got, [3]float64{id, principal, interest})
+	}
+	// Principal is paid off first; the failed receipt is not allocated
+	assert.Equal(t, [][3]float64{{1, 600, 0}, {3, 400, 100}}, got)
+}
+
+func TestMigrate_RollsBackFailedMigration(t *testing.T) {
+	db := openMemoryDB(t)
+	require.NoError(t, Migrate(db))
+
+	original := Migrations
+	defer func() { Migrations = original }()
+	Migrations = append(append([]Migration{}, original...), Migration{
+		Version: 9999,
+		Name:    "broken",
+		SQL:     "CREATE TABLE Broken (ID INTEGER); INSERT INTO Missing_Table VALUES (1);",
+	})
+
+	assert.Error(t, Migrate(db))
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE Version = 9999").Scan(&count))
+	assert.Equal(t, 0, count)
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='Broken'").Scan(new(string))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRunMigrations_DryRun(t *testing.T) {
+	db := openMemoryDB(t)
+
+	// Test case 1: On a fresh database every migration is pending and nothing is written
+	pending, err := RunMigrations(db, MigrateOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, pending, len(Migrations))
+	for i, m := range Migrations {
+		assert.Equal(t, m.Version, pending[i])
+	}
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='schema_migrations'").Scan(new(string))
+	assert.ErrorIs(t, err, sql.ErrNoRows, "Dry run must not create schema_migrations")
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='Plan_Prices'").Scan(new(string))
+	assert.ErrorIs(t, err, sql.ErrNoRows, "Dry run must not execute migrations")
+
+	// Test case 2: Only migrations missing from schema_migrations are reported
+	require.NoError(t, Migrate(db))
+	original := Migrations
+	defer func() { Migrations = original }()
+	Migrations = append(append([]Migration{}, original...), Migration{
+		Version: 9999,
+		Name:    "pending",
+		SQL:     "CREATE TABLE Pending (ID INTEGER);",
+	})
+
+	pending, err = RunMigrations(db, MigrateOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int{9999}, pending)
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count))
+	assert.Equal(t, len(original), count, "Dry run must leave schema_migrations untouched")
+	err = db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='Pending'").Scan(new(string))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Test case 3: A real run applies and reports the same set
+	applied, err := RunMigrations(db, MigrateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []int{9999}, applied)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// SeedCurrency is the currency of the Plan_Prices rows written for seeded plans
+const SeedCurrency = "LSL"
+
+// SeedPlan is a plan inserted into an empty Plans table by SeedPlans
+type SeedPlan struct {
+	Name      string
+	Price     float64 // In SeedCurrency
+	IsTrial   bool
+	TrialDays int
+	Features  models.PlanFeatures
+}
+
+// DefaultPlans are the plans a fresh database starts with
+var DefaultPlans = []SeedPlan{
+	{
+		Name:      "Trial",
+		Price:     0,
+		IsTrial:   true,
+		TrialDays: 14,
+		Features:  models.PlanFeatures{MaxUsers: 1, MaxActiveLoans: 10, MaxStorageBytes: 100 << 20},
+	},
+	{
+		Name:     "Basic",
+		Price:    150,
+		Features: models.PlanFeatures{PDFStatements: true, MaxUsers: 3, MaxActiveLoans: 100, MaxStorageBytes: 1 << 30},
+	},
+	{
+		Name:     "Premium",
+		Price:    450,
+		Features: models.PlanFeatures{PDFStatements: true, Webhooks: true, BulkImport: true}, // Unlimited users, loans and storage
+	},
+}
+
+// SeedPlans inserts the given plans, each with a price in SeedCurrency, but only when the Plans
+// table is empty, so it is safe to run on every start. It returns the number of plans inserted.
+func SeedPlans(db *sql.DB, plans []SeedPlan) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var existing int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM Plans").Scan(&existing); err != nil {
+		return 0, fmt.Errorf("failed to count plans: %w", err)
+	}
+	if existing > 0 {
+		return 0, nil
+	}
+
+	for _, p := range plans {
+		res, err := tx.Exec("INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days, Features) VALUES (?, ?, ?, ?, ?)",
+			p.Name, p.Price, p.IsTrial, p.TrialDays, p.Features)
+		if err != nil {
+			return 0, fmt.Errorf("failed to seed plan %s: %w", p.Name, err)
+		}
+		planID, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) VALUES (?, ?, ?)", planID, SeedCurrency, p.Price); err != nil {
+			return 0, fmt.Errorf("failed to seed price for plan %s: %w", p.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range plans {
+		slog.Info("Seeded plan", "plan", p.Name, "price", p.Price, "currency", SeedCurrency)
+	}
+	return len(plans), nil
+}
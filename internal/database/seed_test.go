@@ -0,0 +1,80 @@
+package database
+
+import (
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedPlans_EmptyTable(t *testing.T) {
+	db := openMemoryDB(t)
+	require.NoError(t, Migrate(db))
+
+	seeded, err := SeedPlans(db, DefaultPlans)
+	require.NoError(t, err)
+	assert.Equal(t, len(DefaultPlans), seeded)
+
+	rows, err := db.Query("SELECT p.Plan, p.Price, p.Is_Trial, p.Trial_Days, p.Features, pp.Amount FROM Plans p JOIN Plan_Prices pp ON pp.Plan_ID = p.Plan_ID AND pp.Currency = ? ORDER BY p.Plan_ID", SeedCurrency)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var got []SeedPlan
+	for rows.Next() {
+		var p SeedPlan
+		var amount float64
+		require.NoError(t, rows.Scan(&p.Name, &p.Price, &p.IsTrial, &p.TrialDays, &p.Features, &amount))
+		assert.Equal(t, p.Price, amount, "Plan %s should have a %s price", p.Name, SeedCurrency)
+		got = append(got, p)
+	}
+	assert.Equal(t, DefaultPlans, got)
+}
+
+func TestSeedPlans_Idempotent(t *testing.T) {
+	db := openMemoryDB(t)
+	require.NoError(t, Migrate(db))
+
+	_, err := SeedPlans(db, DefaultPlans)
+	require.NoError(t, err)
+
+	// Running again must not duplicate rows
+	seeded, err := SeedPlans(db, DefaultPlans)
+	require.NoError(t, err)
+	assert.Equal(t, 0, seeded)
+
+	var plans, prices int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Plans").Scan(&plans))
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Plan_Prices").Scan(&prices))
+	assert.Equal(t, len(DefaultPlans), plans)
+	assert.Equal(t, len(DefaultPlans), prices)
+}
+
+func TestSeedPlans_ExistingPlansLeftAlone(t *testing.T) {
+	db := openMemoryDB(t)
+	require.NoError(t, Migrate(db))
+
+	_, err := db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Custom', 99)")
+	require.NoError(t, err)
+
+	seeded, err := SeedPlans(db, []SeedPlan{{Name: "Basic", Price: 150, Features: models.PlanFeatures{MaxUsers: 3}}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, seeded)
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM Plans").Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestDefaultPlans(t *testing.T) {
+	var trials int
+	for _, p := range DefaultPlans {
+		if p.IsTrial {
+			trials++
+			assert.Positive(t, p.TrialDays, "Trial plan %s needs trial days", p.Name)
+			assert.Zero(t, p.Price, "Trial plan %s should be free", p.Name)
+		}
+	}
+	assert.Equal(t, 1, trials, "Exactly one default plan should be the trial")
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// slowQueryConnector opens connections whose statements are timed, logging those that take longer
+// than threshold. Only the query text and duration are logged: bound arguments may hold passwords,
+// tokens or personal details.
+type slowQueryConnector struct {
+	driver    driver.Driver
+	dsn       string
+	threshold time.Duration
+	logger    *slog.Logger
+}
+
+// newSlowQueryConnector wraps connections opened by drv, for use with sql.OpenDB
+func newSlowQueryConnector(drv driver.Driver, dsn string, threshold time.Duration, logger *slog.Logger) driver.Connector {
+	return &slowQueryConnector{driver: drv, dsn: dsn, threshold: threshold, logger: logger}
+}
+
+func (c *slowQueryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryConn{Conn: conn, connector: c}, nil
+}
+
+func (c *slowQueryConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// observe logs query when it has been running since start for longer than the threshold, with the
+// request ID of ctx when it was run for a request
+func (c *slowQueryConnector) observe(ctx context.Context, query string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > c.threshold {
+		c.logger.WarnContext(ctx, "slow query", "query", strings.Join(strings.Fields(query), " "), "duration", elapsed)
+	}
+}
+
+// slowQueryConn times the statements run on a driver connection. The wrapped connection must
+// support contexts, as the SQLite driver does.
+type slowQueryConn struct {
+	driver.Conn
+	connector *slowQueryConnector
+}
+
+func (c *slowQueryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer c.connector.observe(ctx, query, time.Now())
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *slowQueryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != nil {
+		c.connector.observe(ctx, query, start)
+		return nil, err
+	}
+	return &slowQueryRows{Rows: rows, ctx: ctx, query: query, start: start, connector: c.connector}, nil
+}
+
+func (c *slowQueryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryStmt{Stmt: stmt, query: query, connector: c.connector}, nil
+}
+
+func (c *slowQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *slowQueryConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// slowQueryStmt times each run of a prepared statement
+type slowQueryStmt struct {
+	driver.Stmt
+	query     string
+	connector *slowQueryConnector
+}
+
+func (s *slowQueryStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer s.connector.observe(ctx, s.query, time.Now())
+	return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *slowQueryStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		s.connector.observe(ctx, s.query, start)
+		return nil, err
+	}
+	return &slowQueryRows{Rows: rows, ctx: ctx, query: s.query, start: start, connector: s.connector}, nil
+}
+
+// slowQueryRows stops a query's clock when its rows are closed: SQLite does most of the work of
+// a query while its rows are read, not when it is started
+type slowQueryRows struct {
+	driver.Rows
+	ctx       context.Context
+	query     string
+	start     time.Time
+	connector *slowQueryConnector
+}
+
+func (r *slowQueryRows) Close() error {
+	err := r.Rows.Close()
+	r.connector.observe(r.ctx, r.query, r.start)
+	return err
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wisetech-lms-api/internal/requestid"
+)
+
+func TestSlowQueryConnector(t *testing.T) {
+	// sleep_ms makes a query as slow as the test needs
+	drv := &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		return conn.RegisterFunc("sleep_ms", func(ms int) int {
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return ms
+		}, false)
+	}}
+	var logs bytes.Buffer
+	db := sql.OpenDB(newSlowQueryConnector(drv, ":memory:", 20*time.Millisecond, slog.New(requestid.NewLogHandler(slog.NewTextHandler(&logs, nil)))))
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	// Test case 1: A fast query is not logged
+	var n int
+	require.NoError(t, db.QueryRow("SELECT ?", 1).Scan(&n))
+	assert.Empty(t, logs.String())
+
+	// Test case 2: A slow query is logged with its SQL and duration, but not its arguments
+	require.NoError(t, db.QueryRow("SELECT sleep_ms(50)\n\tWHERE ? != ''", "s3cret-token").Scan(&n))
+	assert.Contains(t, logs.String(), `msg="slow query"`)
+	assert.Contains(t, logs.String(), `query="SELECT sleep_ms(50) WHERE ? != ''"`)
+	assert.Contains(t, logs.String(), "duration=")
+	assert.NotContains(t, logs.String(), "s3cret-token")
+
+	// Test case 3: Slow statements run through Exec and prepared statements are logged too
+	logs.Reset()
+	_, err := db.Exec("CREATE TABLE t (v INTEGER)")
+	require.NoError(t, err)
+	assert.Empty(t, logs.String())
+	stmt, err := db.Prepare("INSERT INTO t (v) VALUES (sleep_ms(?))")
+	require.NoError(t, err)
+	defer stmt.Close()
+	_, err = stmt.Exec(50)
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "INSERT INTO t (v) VALUES (sleep_ms(?))")
+
+	// Test case 4: A slow query run for a request is logged with its request ID
+	logs.Reset()
+	ctx := requestid.WithID(context.Background(), "req-123")
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT sleep_ms(50)").Scan(&n))
+	assert.Contains(t, logs.String(), "request_id=req-123")
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVWriter writes the first table as CSV. A CSV file has no sheets, so further tables, such as
+// a workbook's summary sheet, are left out.
+type CSVWriter struct{}
+
+// ContentType implements Writer
+func (CSVWriter) ContentType() string { return "text/csv; charset=utf-8" }
+
+// Extension implements Writer
+func (CSVWriter) Extension() string { return "csv" }
+
+// Write implements Writer
+func (CSVWriter) Write(w io.Writer, tables ...Table) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(tables[0].Header); err != nil {
+		return err
+	}
+	record := make([]string, 0, len(tables[0].Header))
+	for row := range tables[0].Rows {
+		record = record[:0]
+		for _, c := range row {
+			record = append(record, c.String())
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
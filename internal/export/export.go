@@ -0,0 +1,94 @@
+// Package export writes tabular reports as downloadable files. A report is described once as
+// Tables of typed Cells, and each Writer renders the same rows in its own format, so CSV and XLSX
+// exports never drift apart.
+package export
+
+import (
+	"io"
+	"iter"
+	"strconv"
+	"time"
+)
+
+// cellKind is how a Cell's value is typed and formatted
+type cellKind int
+
+const (
+	kindEmpty cellKind = iota
+	kindText
+	kindInt
+	kindDecimal
+	kindNumber
+	kindDate
+	kindTime
+)
+
+// Cell is one typed value of a row. The zero Cell is empty.
+type Cell struct {
+	kind cellKind
+	text string
+	num  float64
+	at   time.Time
+}
+
+// Text returns a string cell
+func Text(s string) Cell { return Cell{kind: kindText, text: s} }
+
+// Int returns a whole number cell
+func Int(n int) Cell { return Cell{kind: kindInt, num: float64(n)} }
+
+// Decimal returns a number cell shown with two decimal places, for amounts and percentages
+func Decimal(f float64) Cell { return Cell{kind: kindDecimal, num: f} }
+
+// Number returns a number cell shown as precisely as needed, such as an interest rate
+func Number(f float64) Cell { return Cell{kind: kindNumber, num: f} }
+
+// Date returns a calendar date cell
+func Date(t time.Time) Cell { return Cell{kind: kindDate, at: t} }
+
+// Time returns a date and time cell, in UTC
+func Time(t time.Time) Cell { return Cell{kind: kindTime, at: t.UTC()} }
+
+// String formats the cell as it appears in a CSV file
+func (c Cell) String() string {
+	switch c.kind {
+	case kindText:
+		return c.text
+	case kindInt:
+		return strconv.FormatFloat(c.num, 'f', 0, 64)
+	case kindDecimal:
+		return strconv.FormatFloat(c.num, 'f', 2, 64)
+	case kindNumber:
+		return strconv.FormatFloat(c.num, 'f', -1, 64)
+	case kindDate:
+		return c.at.Format(time.DateOnly)
+	case kindTime:
+		return c.at.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// Table is one sheet of a report: a header row, then the rows its iterator yields
+type Table struct {
+	Name   string // Sheet name in a workbook; at most 31 characters, without []:*?/\
+	Header []string
+	Rows   iter.Seq[[]Cell]
+}
+
+// Rows yields each row of a slice, for tables already held in memory
+func Rows(rows [][]Cell) iter.Seq[[]Cell] {
+	return func(yield func([]Cell) bool) {
+		for _, row := range rows {
+			if !yield(row) {
+				return
+			}
+		}
+	}
+}
+
+// Writer renders tables as one file
+type Writer interface {
+	ContentType() string // Media type of the file, with any parameters
+	Extension() string   // File name extension, without the dot
+	Write(w io.Writer, tables ...Table) error
+}
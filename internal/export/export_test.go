@@ -0,0 +1,129 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// xlsxCell is a cell as stored in a worksheet
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Style  int    `xml:"s,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+// readSheet returns the cells of one worksheet of a workbook by reference, such as "B2"
+func readSheet(t *testing.T, data []byte, sheet int) map[string]xlsxCell {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Not a zip file: %v", err)
+	}
+	f, err := zr.Open(fmt.Sprintf("xl/worksheets/sheet%d.xml", sheet))
+	if err != nil {
+		t.Fatalf("Missing sheet %d: %v", sheet, err)
+	}
+	defer f.Close()
+	var ws struct {
+		Rows []struct {
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	raw, _ := io.ReadAll(f)
+	if err := xml.Unmarshal(raw, &ws); err != nil {
+		t.Fatalf("Invalid sheet XML: %v", err)
+	}
+	cells := make(map[string]xlsxCell)
+	for _, row := range ws.Rows {
+		for _, c := range row.Cells {
+			cells[c.Ref] = c
+		}
+	}
+	return cells
+}
+
+// sample is a two-row table with one cell of each kind
+func sample() Table {
+	at := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	return Table{
+		Name:   "Loans",
+		Header: []string{"id", "status", "amount", "rate", "start", "created", "end"},
+		Rows: Rows([][]Cell{
+			{Int(7), Text(`Tom & "Jerry" <Ltd>`), Decimal(1234.5), Number(12.25), Date(at), Time(at), {}},
+			{Int(8), Text("paid"), Decimal(0), Number(0), Date(at.AddDate(0, 0, 1)), Time(at), Date(at)},
+		}),
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	summary := Table{Name: "Summary", Header: []string{"total"}, Rows: Rows([][]Cell{{Decimal(1)}})}
+
+	// Test case 1: Cells are formatted by kind, and only the first table is written
+	if err := (CSVWriter{}).Write(&buf, sample(), summary); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := "id,status,amount,rate,start,created,end\n" +
+		`7,"Tom & ""Jerry"" <Ltd>",1234.50,12.25,2026-03-01,2026-03-01T12:30:00Z,` + "\n" +
+		"8,paid,0.00,0,2026-03-02,2026-03-01T12:30:00Z,2026-03-01\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	summary := Table{Name: "Summary", Header: []string{"metric", "value"}, Rows: Rows([][]Cell{{Text("loans"), Int(2)}})}
+	if err := (XLSXWriter{}).Write(&buf, sample(), summary); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Test case 1: The header row is bold text
+	cells := readSheet(t, buf.Bytes(), 1)
+	if c := cells["C1"]; c.Type != "inlineStr" || c.Inline != "amount" || c.Style != styleHeader {
+		t.Errorf("Unexpected header cell: %+v", c)
+	}
+
+	// Test case 2: Values keep their types: numbers, escaped text and date serials
+	checks := []struct {
+		ref, value, text string
+		style            int
+	}{
+		{"A2", "7", "", styleGeneral},
+		{"B2", "", `Tom & "Jerry" <Ltd>`, styleGeneral},
+		{"C2", "1234.5", "", styleDecimal},
+		{"D2", "12.25", "", styleGeneral},
+		{"E2", "46082", "", styleDate},
+		{"F2", "46082.520833333336", "", styleTime},
+		{"G3", "46082", "", styleDate},
+	}
+	for _, check := range checks {
+		c := cells[check.ref]
+		if c.Value != check.value || c.Inline != check.text || c.Style != check.style {
+			t.Errorf("%s: expected %q %q in style %d, got %+v", check.ref, check.value, check.text, check.style, c)
+		}
+	}
+	if _, ok := cells["G2"]; ok {
+		t.Errorf("Expected the empty cell to be left out")
+	}
+
+	// Test case 3: Every table becomes a sheet
+	if c := readSheet(t, buf.Bytes(), 2)["B2"]; c.Value != "2" {
+		t.Errorf("Unexpected summary cell: %+v", c)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("Column %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package features
+
+import (
+	"sync"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// DefaultTTL bounds how stale a cached feature set can get when a lender's plan changes
+// somewhere that does not invalidate the cache explicitly.
+const DefaultTTL = 5 * time.Minute
+
+// Resolver loads the features a lender's current plan grants.
+type Resolver interface {
+	GetLenderFeatures(lenderID int) (models.PlanFeatures, error)
+}
+
+// entry is a resolved feature set and when it stops being fresh
+type entry struct {
+	features models.PlanFeatures
+	expires  time.Time
+}
+
+// Cache keeps each lender's resolved feature set for TTL. Invalidate a lender when its
+// subscription changes plan, and everyone when a plan's features are edited.
+type Cache struct {
+	resolver Resolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[int]entry
+}
+
+// NewCache creates a new Cache with the default TTL.
+func NewCache(resolver Resolver) *Cache {
+	return &Cache{
+		resolver: resolver,
+		ttl:      DefaultTTL,
+		now:      time.Now,
+		entries:  make(map[int]entry),
+	}
+}
+
+// Get returns the lender's features, resolving them on a miss or once the entry is stale.
+func (c *Cache) Get(lenderID int) (models.PlanFeatures, error) {
+	c.mu.Lock()
+	e, ok := c.entries[lenderID]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expires) {
+		return e.features, nil
+	}
+
+	features, err := c.resolver.GetLenderFeatures(lenderID)
+	if err != nil {
+		return models.PlanFeatures{}, err
+	}
+
+	c.mu.Lock()
+	c.entries[lenderID] = entry{features: features, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return features, nil
+}
+
+// Invalidate drops the cached features of one lender.
+func (c *Cache) Invalidate(lenderID int) {
+	c.mu.Lock()
+	delete(c.entries, lenderID)
+	c.mu.Unlock()
+}
+
+// InvalidateAll drops every cached feature set.
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	c.entries = make(map[int]entry)
+	c.mu.Unlock()
+}
@@ -0,0 +1,57 @@
+package features
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// fakeResolver serves features from a map and counts lookups.
+type fakeResolver struct {
+	features map[int]models.PlanFeatures
+	calls    int
+}
+
+func (f *fakeResolver) GetLenderFeatures(lenderID int) (models.PlanFeatures, error) {
+	f.calls++
+	return f.features[lenderID], nil
+}
+
+func TestCache(t *testing.T) {
+	resolver := &fakeResolver{features: map[int]models.PlanFeatures{1: {Webhooks: true}}}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(resolver)
+	cache.now = func() time.Time { return now }
+
+	// Test case 1: Second lookup is served from the cache
+	cache.Get(1)
+	features, _ := cache.Get(1)
+	if !features.Webhooks || resolver.calls != 1 {
+		t.Errorf("Expected one lookup with webhooks enabled, got %d lookups and %+v", resolver.calls, features)
+	}
+
+	// Test case 2: Invalidation picks up a plan change
+	resolver.features[1] = models.PlanFeatures{}
+	cache.Invalidate(1)
+	features, _ = cache.Get(1)
+	if features.Webhooks || resolver.calls != 2 {
+		t.Errorf("Expected a fresh lookup without webhooks, got %d lookups and %+v", resolver.calls, features)
+	}
+
+	// Test case 3: Entries expire after the TTL
+	now = now.Add(DefaultTTL)
+	cache.Get(1)
+	if resolver.calls != 3 {
+		t.Errorf("Expected a stale entry to be resolved again, got %d lookups", resolver.calls)
+	}
+
+	// Test case 4: InvalidateAll clears every lender
+	cache.Get(2)
+	cache.InvalidateAll()
+	cache.Get(1)
+	cache.Get(2)
+	if resolver.calls != 6 {
+		t.Errorf("Expected both lenders to be resolved again, got %d lookups", resolver.calls)
+	}
+}
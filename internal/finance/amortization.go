@@ -0,0 +1,74 @@
+package finance
+
+import (
+	"database/sql"
+	"math"
+)
+
+// MonthlyPayment returns the fixed monthly instalment that repays principal over the given
+// number of months at an annual interest rate expressed as a percentage, rounded to cents.
+func MonthlyPayment(principal, annualRatePercent float64, months int) float64 {
+	if months <= 0 {
+		return 0
+	}
+
+	monthlyRate := annualRatePercent / 100 / 12
+	if monthlyRate == 0 {
+		return RoundCents(principal / float64(months))
+	}
+
+	factor := math.Pow(1+monthlyRate, float64(months))
+	return RoundCents(principal * monthlyRate * factor / (factor - 1))
+}
+
+// Instalment returns a loan's monthly instalment: the stored payment when there is one, and otherwise
+// the amortized payment derived from its principal, rate and term. Loans created before the payment
+// was stored have none, and a payment of zero or less could never repay the loan.
+func Instalment(stored sql.NullFloat64, principal, annualRatePercent float64, months int) float64 {
+	if stored.Valid && stored.Float64 > 0 {
+		return stored.Float64
+	}
+	return MonthlyPayment(principal, annualRatePercent, months)
+}
+
+// RoundCents rounds an amount to two decimal places.
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// EffectiveAnnualRate returns the annual percentage rate of a loan that advances amount and is
+// repaid by the given monthly payments, the first a month later: the monthly rate at which the
+// payments are worth amount today, compounded over a year. It is zero when the payments do not
+// exceed amount, and rounded to two decimal places.
+func EffectiveAnnualRate(amount float64, payments []float64) float64 {
+	total := 0.0
+	for _, p := range payments {
+		total += p
+	}
+	if amount <= 0 || total <= amount {
+		return 0
+	}
+
+	// The present value falls as the rate rises, so bisect for the rate that matches amount
+	presentValue := func(rate float64) float64 {
+		pv, discount := 0.0, 1.0
+		for _, p := range payments {
+			discount /= 1 + rate
+			pv += p * discount
+		}
+		return pv
+	}
+	low, high := 0.0, 1.0
+	for presentValue(high) > amount {
+		high *= 2
+	}
+	for i := 0; i < 200 && high-low > 1e-12; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > amount {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return math.Round((math.Pow(1+(low+high)/2, 12)-1)*100*100) / 100
+}
@@ -0,0 +1,79 @@
+package finance
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMonthlyPayment(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		rate      float64
+		months    int
+		want      float64
+	}{
+		{"standard loan", 10000, 12, 12, 888.49},
+		{"zero interest", 1200, 0, 12, 100},
+		{"single month", 1000, 12, 1, 1010},
+		{"zero term", 1000, 12, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MonthlyPayment(tt.principal, tt.rate, tt.months); got != tt.want {
+				t.Errorf("MonthlyPayment(%.2f, %.2f, %d) = %.2f, want %.2f", tt.principal, tt.rate, tt.months, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstalment(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored sql.NullFloat64
+		want   float64
+	}{
+		{"stored payment", sql.NullFloat64{Float64: 900, Valid: true}, 900},
+		{"no stored payment", sql.NullFloat64{}, 888.49},
+		{"zero stored payment", sql.NullFloat64{Float64: 0, Valid: true}, 888.49},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Instalment(tt.stored, 10000, 12, 12); got != tt.want {
+				t.Errorf("Instalment(%+v) = %.2f, want %.2f", tt.stored, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveAnnualRate(t *testing.T) {
+	instalments := func(payment float64, months int) []float64 {
+		payments := make([]float64, months)
+		for i := range payments {
+			payments[i] = payment
+		}
+		return payments
+	}
+
+	tests := []struct {
+		name     string
+		amount   float64
+		payments []float64
+		want     float64
+	}{
+		{"monthly compounding of 12%", 10000, instalments(MonthlyPayment(10000, 12, 12), 12), 12.68},
+		{"upfront fee raises the rate", 9800, instalments(MonthlyPayment(10000, 12, 12), 12), 17.06},
+		{"interest free", 1200, instalments(100, 12), 0},
+		{"nothing advanced", 0, instalments(100, 12), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveAnnualRate(tt.amount, tt.payments); got != tt.want {
+				t.Errorf("EffectiveAnnualRate(%.2f) = %.2f, want %.2f", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
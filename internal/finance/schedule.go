@@ -0,0 +1,52 @@
+package finance
+
+import "time"
+
+// NextDueDate returns the first monthly instalment date on or after the calendar day of from,
+// for a loan starting on start and repaid over the given number of months. Instalments fall on
+// the start date plus one month, two months and so on. ok is false once every instalment has passed.
+func NextDueDate(start time.Time, months int, from time.Time) (due time.Time, ok bool) {
+	from = from.UTC()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	start = start.UTC()
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	for k := 1; k <= months; k++ {
+		due = start.AddDate(0, k, 0)
+		if !due.Before(day) {
+			return due, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ScheduledPayment is one instalment of an amortization schedule, split into the interest and
+// principal it pays, with the balance left after it.
+type ScheduledPayment struct {
+	Number    int     `json:"number"`
+	Amount    float64 `json:"amount"`
+	Interest  float64 `json:"interest"`
+	Principal float64 `json:"principal"`
+	Balance   float64 `json:"balance"`
+}
+
+// Schedule returns the instalments that repay principal over the given number of months with a
+// monthly payment, at an annual interest rate expressed as a percentage. Each month's interest
+// is charged on the balance and rounded to cents, and the last instalment clears what is left,
+// so the principal parts add up to principal.
+func Schedule(principal, annualRatePercent, payment float64, months int) []ScheduledPayment {
+	monthlyRate := annualRatePercent / 100 / 12
+	balance := RoundCents(principal)
+	schedule := make([]ScheduledPayment, 0, max(months, 0))
+	for k := 1; k <= months; k++ {
+		interest := RoundCents(balance * monthlyRate)
+		amount := payment
+		if k == months || amount-interest > balance {
+			amount = RoundCents(balance + interest)
+		}
+		paid := RoundCents(amount - interest)
+		balance = RoundCents(balance - paid)
+		schedule = append(schedule, ScheduledPayment{Number: k, Amount: amount, Interest: interest, Principal: paid, Balance: balance})
+	}
+	return schedule
+}
@@ -0,0 +1,72 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDueDate(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	start := date("2026-01-10")
+
+	tests := []struct {
+		name   string
+		months int
+		from   time.Time
+		want   string
+		wantOK bool
+	}{
+		{"before first instalment", 12, date("2026-01-20"), "2026-02-10", true},
+		{"on an instalment day", 12, date("2026-03-10"), "2026-03-10", true},
+		{"later in the day", 12, date("2026-03-10").Add(15 * time.Hour), "2026-03-10", true},
+		{"day after an instalment", 12, date("2026-03-11"), "2026-04-10", true},
+		{"last instalment", 3, date("2026-03-11"), "2026-04-10", true},
+		{"schedule complete", 3, date("2026-04-11"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NextDueDate(start, tt.months, tt.from)
+			if ok != tt.wantOK {
+				t.Fatalf("NextDueDate ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.Format("2006-01-02") != tt.want {
+				t.Errorf("NextDueDate = %s, want %s", got.Format("2006-01-02"), tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	payment := MonthlyPayment(10000, 12, 12)
+	schedule := Schedule(10000, 12, payment, 12)
+
+	// Test case 1: One instalment per month, interest charged on the running balance
+	if len(schedule) != 12 || schedule[0].Interest != 100 || schedule[0].Principal != RoundCents(payment-100) {
+		t.Fatalf("Unexpected first instalment: %+v", schedule)
+	}
+
+	// Test case 2: The principal parts repay the principal exactly and the balance ends at zero
+	var principal, interest, paid float64
+	for _, p := range schedule {
+		principal += p.Principal
+		interest += p.Interest
+		paid += p.Amount
+	}
+	if RoundCents(principal) != 10000 || schedule[11].Balance != 0 {
+		t.Errorf("Expected 10000 repaid and no balance left, got %.2f and %.2f", principal, schedule[11].Balance)
+	}
+	if RoundCents(paid) != RoundCents(principal+interest) {
+		t.Errorf("Expected the instalments to add up to principal plus interest, got %.2f and %.2f", paid, principal+interest)
+	}
+
+	// Test case 3: Without interest every instalment is principal
+	for _, p := range Schedule(1200, 0, 100, 12) {
+		if p.Interest != 0 || p.Amount != 100 {
+			t.Errorf("Unexpected interest-free instalment: %+v", p)
+		}
+	}
+}
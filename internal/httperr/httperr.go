@@ -0,0 +1,167 @@
+package httperr
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/subscription"
+)
+
+// Error is a client error that carries its own HTTP status and code. Fields, when set, names the
+// offending input fields with a message for each.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Validation returns an error for semantically invalid input, mapped to 422.
+func Validation(message string) error {
+	return &Error{Status: http.StatusUnprocessableEntity, Code: "validation_error", Message: message}
+}
+
+// Field returns a validation error for one input field, mapped to 422 and reported in Fields.
+// message completes a sentence about the field, such as "is required".
+func Field(field, message string) error {
+	return Fields(map[string]string{field: message})
+}
+
+// Fields returns a validation error for several input fields, mapped to 422, whose message lists
+// them in name order.
+func Fields(fields map[string]string) error {
+	names := slices.Sorted(maps.Keys(fields))
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + fields[name]
+	}
+	return &Error{Status: http.StatusUnprocessableEntity, Code: "validation_error", Message: strings.Join(parts, "; "), Fields: fields}
+}
+
+// PublicMessager is implemented by errors whose message is written for the client, such as a known
+// sentinel together with the detail of why it applies. Resolve reports that message in place of the
+// sentinel's own text.
+type PublicMessager interface {
+	PublicMessage() string
+}
+
+// WithMessage wraps a known error with the message to report for it, e.g. one naming the limit
+// that was reached.
+func WithMessage(err error, message string) error {
+	return &messageError{err: err, message: message}
+}
+
+// messageError is a known error with its message for the client
+type messageError struct {
+	err     error
+	message string
+}
+
+func (e *messageError) Error() string         { return e.message }
+func (e *messageError) Unwrap() error         { return e.err }
+func (e *messageError) PublicMessage() string { return e.message }
+
+// BadRequest returns an error for malformed input, mapped to 400.
+func BadRequest(message string) error {
+	return &Error{Status: http.StatusBadRequest, Code: "invalid_request", Message: message}
+}
+
+// mapping pairs a sentinel error with its response status and code
+type mapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// mappings lists the known sentinels in the order they are checked.
+var mappings = []mapping{
+	{repository.ErrAccountNotFound, http.StatusNotFound, "account_not_found"},
+	{repository.ErrBorrowerNotFound, http.StatusNotFound, "borrower_not_found"},
+	{repository.ErrLenderNotFound, http.StatusNotFound, "lender_not_found"},
+	{repository.ErrLoanNotFound, http.StatusNotFound, "loan_not_found"},
+	{repository.ErrReceiptNotFound, http.StatusNotFound, "receipt_not_found"},
+	{repository.ErrFileNotFound, http.StatusNotFound, "file_not_found"},
+	{repository.ErrLinkTargetNotFound, http.StatusNotFound, "link_target_not_found"},
+	{repository.ErrAttachmentNotFound, http.StatusNotFound, "attachment_not_found"},
+	{repository.ErrPlanNotFound, http.StatusNotFound, "plan_not_found"},
+	{repository.ErrPlanPriceNotFound, http.StatusNotFound, "plan_price_not_found"},
+	{repository.ErrSubscriptionNotFound, http.StatusNotFound, "subscription_not_found"},
+	{repository.ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token"},
+	{repository.ErrBorrowerEmailChanged, http.StatusBadRequest, "invalid_verification_token"},
+	{repository.ErrDuplicateEmail, http.StatusConflict, "duplicate_email"},
+	{repository.ErrDuplicateUsername, http.StatusConflict, "duplicate_username"},
+	{repository.ErrDuplicateBorrowerEmail, http.StatusConflict, "duplicate_borrower_email"},
+	{repository.ErrDuplicateTransactionReference, http.StatusConflict, "duplicate_transaction_reference"},
+	{repository.ErrFileReferenced, http.StatusConflict, "file_referenced"},
+	{repository.ErrLogoNotImage, http.StatusUnprocessableEntity, "invalid_logo"},
+	{repository.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{repository.ErrInvalidInterestRate, http.StatusUnprocessableEntity, "invalid_interest_rate"},
+	{repository.ErrInvalidTerm, http.StatusUnprocessableEntity, "invalid_term"},
+	{repository.ErrCustomValueNotFound, http.StatusNotFound, "custom_value_not_found"},
+	{repository.ErrCustomFieldNotFound, http.StatusNotFound, "custom_field_not_found"},
+	{repository.ErrReportSubscriptionNotFound, http.StatusNotFound, "report_subscription_not_found"},
+	{repository.ErrSnapshotNotFound, http.StatusNotFound, "snapshot_not_found"},
+	{repository.ErrDuplicateCustomField, http.StatusConflict, "duplicate_custom_field"},
+	{repository.ErrSnapshotExists, http.StatusConflict, "snapshot_exists"},
+	{repository.ErrTrialAlreadyConsumed, http.StatusConflict, "trial_already_consumed"},
+	{repository.ErrLedgerStatusChanged, http.StatusConflict, "status_changed"},
+	{repository.ErrAlreadyOnFreePlan, http.StatusConflict, "already_on_free_plan"},
+	{repository.ErrLenderAlreadySuspended, http.StatusConflict, "already_suspended"},
+	{repository.ErrLenderNotSuspended, http.StatusConflict, "not_suspended"},
+	{repository.ErrLoanNotPayable, http.StatusConflict, "loan_not_payable"},
+	{repository.ErrLoanPaid, http.StatusConflict, "loan_paid"},
+	{repository.ErrLoanNotPending, http.StatusConflict, "loan_not_pending"},
+	{repository.ErrBorrowerLoanLimit, http.StatusConflict, "borrower_loan_limit"},
+	{subscription.ErrIllegalTransition, http.StatusConflict, "illegal_transition"},
+	{reports.ErrInvalidQuery, http.StatusUnprocessableEntity, "invalid_report_query"},
+}
+
+// Response is what a client is told about an error. Unexpected marks an error Resolve did not
+// recognise, which the caller should log as the client is not told what went wrong.
+type Response struct {
+	Status     int
+	Code       string
+	Message    string
+	Fields     map[string]string
+	Unexpected bool
+}
+
+// Resolve maps an error returned by a repository or service to the status, code and message sent
+// to the client. A known sentinel is described by its own text however it was wrapped, as wrapping
+// can add repository detail or driver text, unless the error carries a PublicMessager. Unknown
+// errors are reported as 500 without their text and marked Unexpected.
+func Resolve(err error) Response {
+	var httpErr *Error
+	if errors.As(err, &httpErr) {
+		return Response{Status: httpErr.Status, Code: httpErr.Code, Message: httpErr.Message, Fields: httpErr.Fields}
+	}
+
+	for _, m := range mappings {
+		if errors.Is(err, m.err) {
+			message := m.err.Error()
+			var public PublicMessager
+			if errors.As(err, &public) {
+				message = public.PublicMessage()
+			}
+			return Response{Status: m.status, Code: m.code, Message: message}
+		}
+	}
+
+	return Response{Status: http.StatusInternalServerError, Code: "internal_error", Message: "internal server error", Unexpected: true}
+}
+
+// StatusForError maps an error returned by a repository or service to an HTTP status and
+// machine-readable code, as Resolve does.
+func StatusForError(err error) (int, string) {
+	resp := Resolve(err)
+	return resp.Status, resp.Code
+}
@@ -0,0 +1,129 @@
+package httperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/subscription"
+)
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"account not found", repository.ErrAccountNotFound, http.StatusNotFound, "account_not_found"},
+		{"borrower not found", repository.ErrBorrowerNotFound, http.StatusNotFound, "borrower_not_found"},
+		{"lender not found", repository.ErrLenderNotFound, http.StatusNotFound, "lender_not_found"},
+		{"loan not found", repository.ErrLoanNotFound, http.StatusNotFound, "loan_not_found"},
+		{"receipt not found", repository.ErrReceiptNotFound, http.StatusNotFound, "receipt_not_found"},
+		{"file not found", repository.ErrFileNotFound, http.StatusNotFound, "file_not_found"},
+		{"link target not found", repository.ErrLinkTargetNotFound, http.StatusNotFound, "link_target_not_found"},
+		{"attachment not found", repository.ErrAttachmentNotFound, http.StatusNotFound, "attachment_not_found"},
+		{"plan not found", repository.ErrPlanNotFound, http.StatusNotFound, "plan_not_found"},
+		{"plan price not found", repository.ErrPlanPriceNotFound, http.StatusNotFound, "plan_price_not_found"},
+		{"subscription not found", repository.ErrSubscriptionNotFound, http.StatusNotFound, "subscription_not_found"},
+		{"invalid reset token", repository.ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token"},
+		{"borrower email changed", repository.ErrBorrowerEmailChanged, http.StatusBadRequest, "invalid_verification_token"},
+		{"duplicate email", repository.ErrDuplicateEmail, http.StatusConflict, "duplicate_email"},
+		{"duplicate username", repository.ErrDuplicateUsername, http.StatusConflict, "duplicate_username"},
+		{"duplicate borrower email", repository.ErrDuplicateBorrowerEmail, http.StatusConflict, "duplicate_borrower_email"},
+		{"duplicate reference", repository.ErrDuplicateTransactionReference, http.StatusConflict, "duplicate_transaction_reference"},
+		{"file referenced", repository.ErrFileReferenced, http.StatusConflict, "file_referenced"},
+		{"logo not an image", repository.ErrLogoNotImage, http.StatusUnprocessableEntity, "invalid_logo"},
+		{"custom value not found", repository.ErrCustomValueNotFound, http.StatusNotFound, "custom_value_not_found"},
+		{"custom field not found", repository.ErrCustomFieldNotFound, http.StatusNotFound, "custom_field_not_found"},
+		{"duplicate custom field", repository.ErrDuplicateCustomField, http.StatusConflict, "duplicate_custom_field"},
+		{"trial consumed", repository.ErrTrialAlreadyConsumed, http.StatusConflict, "trial_already_consumed"},
+		{"status changed", repository.ErrLedgerStatusChanged, http.StatusConflict, "status_changed"},
+		{"already on free plan", repository.ErrAlreadyOnFreePlan, http.StatusConflict, "already_on_free_plan"},
+		{"already suspended", repository.ErrLenderAlreadySuspended, http.StatusConflict, "already_suspended"},
+		{"not suspended", repository.ErrLenderNotSuspended, http.StatusConflict, "not_suspended"},
+		{"loan not payable", repository.ErrLoanNotPayable, http.StatusConflict, "loan_not_payable"},
+		{"loan paid", repository.ErrLoanPaid, http.StatusConflict, "loan_paid"},
+		{"loan not pending", repository.ErrLoanNotPending, http.StatusConflict, "loan_not_pending"},
+		{"borrower loan limit", repository.ErrBorrowerLoanLimit, http.StatusConflict, "borrower_loan_limit"},
+		{"invalid amount", repository.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+		{"invalid interest rate", repository.ErrInvalidInterestRate, http.StatusUnprocessableEntity, "invalid_interest_rate"},
+		{"invalid term", repository.ErrInvalidTerm, http.StatusUnprocessableEntity, "invalid_term"},
+		{"report subscription not found", repository.ErrReportSubscriptionNotFound, http.StatusNotFound, "report_subscription_not_found"},
+		{"snapshot not found", repository.ErrSnapshotNotFound, http.StatusNotFound, "snapshot_not_found"},
+		{"snapshot exists", repository.ErrSnapshotExists, http.StatusConflict, "snapshot_exists"},
+		{"invalid report query", reports.ErrInvalidQuery, http.StatusUnprocessableEntity, "invalid_report_query"},
+		{"illegal transition", &subscription.TransitionError{From: "expired", To: "active"}, http.StatusConflict, "illegal_transition"},
+		{"wrapped sentinel", fmt.Errorf("loading: %w", repository.ErrAccountNotFound), http.StatusNotFound, "account_not_found"},
+		{"validation", Validation("amount must be positive"), http.StatusUnprocessableEntity, "validation_error"},
+		{"bad request", BadRequest("invalid body"), http.StatusBadRequest, "invalid_request"},
+		{"field", Field("custom.branch", "is required"), http.StatusUnprocessableEntity, "validation_error"},
+		{"unknown", errors.New("disk on fire"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := StatusForError(tt.err)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("StatusForError(%v) = (%d, %s), want (%d, %s)", tt.err, status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	// Every mapped sentinel is covered above with its documented status and code
+	for _, m := range mappings {
+		covered := false
+		for _, tt := range tests {
+			covered = covered || (errors.Is(tt.err, m.err) && tt.wantStatus == m.status && tt.wantCode == m.code)
+		}
+		if !covered {
+			t.Errorf("No test case for %v (%d, %s)", m.err, m.status, m.code)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	driverErr := sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}
+
+	// Test case 1: Client errors keep their message and fields
+	resp := Resolve(Field("custom.branch", "is required"))
+	if resp.Message != "custom.branch is required" || resp.Fields["custom.branch"] != "is required" {
+		t.Errorf("Unexpected field error response: %+v", resp)
+	}
+
+	resp = Resolve(Fields(map[string]string{"phone_number": "is required", "email": "must be a valid email address"}))
+	if resp.Message != "email must be a valid email address; phone_number is required" || len(resp.Fields) != 2 {
+		t.Errorf("Expected every field in name order, got %+v", resp)
+	}
+
+	// Test case 2: Sentinels report only the message chosen for the client
+	resp = Resolve(WithMessage(repository.ErrBorrowerLoanLimit, "borrower already holds 3 active loans"))
+	if resp.Status != http.StatusConflict || resp.Message != "borrower already holds 3 active loans" {
+		t.Errorf("Expected the public message, got %+v", resp)
+	}
+	resp = Resolve(fmt.Errorf("%w (limit 3)", subscription.ErrIllegalTransition))
+	if resp.Message != subscription.ErrIllegalTransition.Error() {
+		t.Errorf("Expected only the sentinel's text, got %q", resp.Message)
+	}
+
+	// Test case 3: Wrapped context, driver errors among it, is never reported
+	for _, err := range []error{
+		fmt.Errorf("%w: %w", repository.ErrDuplicateEmail, driverErr),
+		fmt.Errorf("lender 7 in Lenders: %w", repository.ErrDuplicateEmail),
+	} {
+		if resp := Resolve(err); resp.Status != http.StatusConflict || resp.Message != repository.ErrDuplicateEmail.Error() {
+			t.Errorf("Expected only the sentinel's text for %v, got %+v", err, resp)
+		}
+	}
+
+	// Test case 4: Unknown errors, driver errors among them, never reveal their text
+	for _, err := range []error{errors.New("disk on fire"), driverErr} {
+		if resp := Resolve(err); resp.Status != http.StatusInternalServerError || resp.Message != "internal server error" || resp.Fields != nil || !resp.Unexpected {
+			t.Errorf("Expected a bare 500 for %v, got %+v", err, resp)
+		}
+	}
+}
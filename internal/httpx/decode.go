@@ -0,0 +1,127 @@
+// Package httpx decodes and validates JSON request bodies. Decode rejects what the handlers would
+// otherwise have to check one by one (empty, oversized and malformed bodies, unknown fields and
+// values of the wrong type), each with its own error code, and then runs the body's own rules.
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"wisetech-lms-api/internal/httperr"
+)
+
+// MaxBodyBytes caps the JSON bodies Decode reads
+const MaxBodyBytes = 1 << 20
+
+// Validator is implemented by request bodies with rules of their own. Validate runs once the body
+// is decoded, and may normalize it, for instance by trimming text, before checking it.
+type Validator interface {
+	Validate() error
+}
+
+// Decode reads the request's JSON body into dst and, when dst is a Validator, validates it. Its
+// errors are *httperr.Error values:
+//   - 400 empty_body when there is no body
+//   - 400 malformed_json when the body is not a single JSON value
+//   - 413 body_too_large past MaxBodyBytes
+//   - 422 unknown_field and invalid_type, naming the field in Fields
+//   - whatever Validate returns, usually a 422 validation_error built from Violations
+func Decode(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	// Anything after the value, even a second value, makes the body malformed
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return &httperr.Error{Status: http.StatusBadRequest, Code: "malformed_json", Message: "request body must hold a single JSON value"}
+	}
+	if v, ok := dst.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// decodeError describes why the body could not be decoded
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &httperr.Error{Status: http.StatusBadRequest, Code: "empty_body", Message: "request body is required"}
+	case errors.As(err, &tooLarge):
+		return &httperr.Error{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large",
+			Message: fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit)}
+	case errors.As(err, &syntaxErr):
+		return &httperr.Error{Status: http.StatusBadRequest, Code: "malformed_json",
+			Message: fmt.Sprintf("request body is not valid JSON at byte %d", syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &httperr.Error{Status: http.StatusBadRequest, Code: "malformed_json", Message: "request body is not valid JSON"}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &httperr.Error{Status: http.StatusUnprocessableEntity, Code: "invalid_type", Message: "request body must be " + describe(typeErr.Type)}
+		}
+		return fieldError("invalid_type", typeErr.Field, "must be "+describe(typeErr.Type))
+	}
+	// The decoder reports unknown fields with a plain error naming the field
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fieldError("unknown_field", strings.Trim(field, `"`), "is not allowed")
+	}
+	return &httperr.Error{Status: http.StatusBadRequest, Code: "malformed_json", Message: "request body is not valid JSON"}
+}
+
+// fieldError is a 422 with the given code naming one field
+func fieldError(code, field, message string) error {
+	return &httperr.Error{Status: http.StatusUnprocessableEntity, Code: code, Message: field + " " + message, Fields: map[string]string{field: message}}
+}
+
+// describe names the JSON type that decodes into t
+func describe(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Violations collects the fields of a request body that break its rules, each with a message
+// completing a sentence about the field, such as "is required".
+type Violations map[string]string
+
+// Add records a violation of field, keeping the first one recorded for it
+func (v Violations) Add(field, message string) {
+	if _, ok := v[field]; !ok {
+		v[field] = message
+	}
+}
+
+// Err returns nil when nothing was recorded, and otherwise a 422 validation_error naming every field
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return httperr.Fields(v)
+}
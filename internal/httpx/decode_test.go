@@ -0,0 +1,91 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/httperr"
+)
+
+// testRequest is a body with a rule of its own: name is required
+type testRequest struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Rate  *float64 `json:"rate"`
+	Tags  []string `json:"tags"`
+}
+
+func (req *testRequest) Validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	v := Violations{}
+	if req.Name == "" {
+		v.Add("name", "is required")
+	}
+	if req.Count < 0 {
+		v.Add("count", "must be zero or greater")
+	}
+	return v.Err()
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"valid", `{"name": " ok ", "count": 2, "tags": ["a"]}`, 0, "", ""},
+		{"empty", ``, http.StatusBadRequest, "empty_body", ""},
+		{"whitespace", "  \n", http.StatusBadRequest, "empty_body", ""},
+		{"syntax", `{"name": }`, http.StatusBadRequest, "malformed_json", ""},
+		{"truncated", `{"name": "ok"`, http.StatusBadRequest, "malformed_json", ""},
+		{"trailing", `{"name": "ok"} {"name": "again"}`, http.StatusBadRequest, "malformed_json", ""},
+		{"too large", `{"name": "` + strings.Repeat("a", MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", ""},
+		{"unknown field", `{"name": "ok", "colour": "red"}`, http.StatusUnprocessableEntity, "unknown_field", "colour"},
+		{"string for integer", `{"name": "ok", "count": "2"}`, http.StatusUnprocessableEntity, "invalid_type", "count"},
+		{"string for number", `{"name": "ok", "rate": "high"}`, http.StatusUnprocessableEntity, "invalid_type", "rate"},
+		{"object for array", `{"name": "ok", "tags": {}}`, http.StatusUnprocessableEntity, "invalid_type", "tags"},
+		{"array body", `[]`, http.StatusUnprocessableEntity, "invalid_type", ""},
+		{"rule broken", `{"name": "  ", "count": -1}`, http.StatusUnprocessableEntity, "validation_error", "name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req testRequest
+			err := Decode(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(tt.body)), &req)
+			if tt.status == 0 {
+				if err != nil || req.Name != "ok" {
+					t.Errorf("Expected the body decoded and trimmed, got %+v (%v)", req, err)
+				}
+				return
+			}
+			var httpErr *httperr.Error
+			if !errors.As(err, &httpErr) || httpErr.Status != tt.status || httpErr.Code != tt.code {
+				t.Fatalf("Expected %d %s, got %v", tt.status, tt.code, err)
+			}
+			if tt.field != "" && httpErr.Fields[tt.field] == "" {
+				t.Errorf("Expected %s named in the fields, got %v", tt.field, httpErr.Fields)
+			}
+		})
+	}
+}
+
+func TestViolations(t *testing.T) {
+	// Test case 1: Nothing recorded is no error
+	if err := (Violations{}).Err(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	// Test case 2: Every field is reported, with the first message recorded for each
+	v := Violations{}
+	v.Add("phone_number", "is required")
+	v.Add("email", "is required")
+	v.Add("email", "must be a valid email address")
+	var httpErr *httperr.Error
+	if !errors.As(v.Err(), &httpErr) || httpErr.Message != "email is required; phone_number is required" || len(httpErr.Fields) != 2 {
+		t.Errorf("Unexpected error: %+v", httpErr)
+	}
+}
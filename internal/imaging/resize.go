@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// Fit returns img scaled down so that neither side exceeds maxDim, preserving the aspect ratio.
+// Images already within maxDim are returned unchanged. Each destination pixel averages the source
+// pixels it covers (a box filter), which is adequate for downscaling but not for enlarging.
+func Fit(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if maxDim <= 0 || (sw <= maxDim && sh <= maxDim) {
+		return img
+	}
+
+	dw, dh := maxDim, maxDim
+	if sw >= sh {
+		dh = max(1, sh*maxDim/sw)
+	} else {
+		dw = max(1, sw*maxDim/sh)
+	}
+	return resize(img, dw, dh)
+}
+
+// resize box-filters img into a dw x dh image. Sums are kept per destination row, so every source
+// pixel is read exactly once.
+func resize(img image.Image, dw, dh int) *image.NRGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	// Premultiplied channel sums and pixel counts for the destination row being filled
+	sums := make([][4]uint64, dw)
+	counts := make([]uint64, dw)
+	// column maps each source column to its destination column
+	column := make([]int, sw)
+	for x := range column {
+		column[x] = x * dw / sw
+	}
+
+	for dy := 0; dy < dh; dy++ {
+		clear(sums)
+		clear(counts)
+		for sy := dy * sh / dh; sy < (dy+1)*sh/dh; sy++ {
+			for sx := 0; sx < sw; sx++ {
+				r, g, bl, a := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+				dx := column[sx]
+				sums[dx][0] += uint64(r)
+				sums[dx][1] += uint64(g)
+				sums[dx][2] += uint64(bl)
+				sums[dx][3] += uint64(a)
+				counts[dx]++
+			}
+		}
+		for dx := 0; dx < dw; dx++ {
+			if counts[dx] == 0 {
+				continue
+			}
+			n := counts[dx]
+			c := color.RGBA64{
+				R: uint16(sums[dx][0] / n),
+				G: uint16(sums[dx][1] / n),
+				B: uint16(sums[dx][2] / n),
+				A: uint16(sums[dx][3] / n),
+			}
+			dst.Set(dx, dy, c)
+		}
+	}
+	return dst
+}
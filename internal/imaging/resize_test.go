@@ -0,0 +1,55 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		maxDim        int
+		wantW, wantH  int
+	}{
+		{"landscape", 400, 200, 100, 100, 50},
+		{"portrait", 300, 900, 90, 30, 90},
+		{"already small", 80, 60, 100, 80, 60},
+		{"thin strip", 1000, 3, 100, 100, 1},
+		{"no limit", 400, 200, 0, 400, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Fit(image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height)), tt.maxDim).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("Fit(%dx%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, tt.maxDim, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestFit_AveragesPixels(t *testing.T) {
+	// Alternating black and white columns average to mid grey
+	src := image.NewNRGBA(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x++ {
+		for y := 10; y < 12; y++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	got := Fit(src, 2).(*image.NRGBA)
+	if got.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("Unexpected bounds %v", got.Bounds())
+	}
+	for x := 0; x < 2; x++ {
+		if c := got.NRGBAAt(x, 0); c.R < 126 || c.R > 128 || c.A != 255 {
+			t.Errorf("Expected mid grey at %d, got %v", x, c)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+)
+
+// Email dispatcher defaults. Retries start soon, as these emails carry links the recipient is
+// waiting for.
+const (
+	DefaultEmailInterval    = 30 * time.Second
+	DefaultEmailBatchSize   = 50
+	DefaultEmailBaseDelay   = time.Minute
+	DefaultEmailMaxDelay    = time.Hour
+	DefaultEmailMaxAttempts = 8
+)
+
+// emailKinds are the notification kinds whose payload is a ready-made EmailMessage
+var emailKinds = []string{models.NotificationPasswordReset, models.NotificationEmailVerification}
+
+// EmailQueue creates notifications and records the outcome of sending them.
+type EmailQueue interface {
+	Create(n models.Notification, now time.Time) (int, error)
+	ListDue(kind string, now time.Time, limit int) ([]models.Notification, error)
+	MarkSent(notificationID int, at time.Time) error
+	ScheduleRetry(notificationID int, next sql.NullTime, lastErr string) error
+}
+
+// EmailDispatcher sends the emails of user-facing flows such as password resets. Enqueue only
+// queues each email as a notification and wakes the dispatcher, so a request takes the same time
+// whether or not an email is sent and a mailer outage does not lose it: RunOnce delivers due
+// emails and retries failed ones with exponential backoff until MaxAttempts is reached, after which
+// the notification is marked failed for admins to see.
+type EmailDispatcher struct {
+	Notifications EmailQueue
+	Mailer        mailer.Mailer
+	Interval      time.Duration
+	BatchSize     int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	MaxAttempts   int
+	Logger        *slog.Logger
+
+	now  func() time.Time
+	wake chan struct{}
+}
+
+// NewEmailDispatcher creates a new EmailDispatcher with the default settings.
+func NewEmailDispatcher(notifications EmailQueue, m mailer.Mailer) *EmailDispatcher {
+	return &EmailDispatcher{
+		Notifications: notifications,
+		Mailer:        m,
+		Interval:      DefaultEmailInterval,
+		BatchSize:     DefaultEmailBatchSize,
+		BaseDelay:     DefaultEmailBaseDelay,
+		MaxDelay:      DefaultEmailMaxDelay,
+		MaxAttempts:   DefaultEmailMaxAttempts,
+		Logger:        slog.Default(),
+		now:           time.Now,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues an email of the given kind for a lender's flow and wakes a started dispatcher to
+// deliver it. It never contacts the mailer, so it returns only the error of queueing the email.
+func (d *EmailDispatcher) Enqueue(ctx context.Context, lenderID int, kind, to, subject, body string) error {
+	payload, err := json.Marshal(models.EmailMessage{Subject: subject, Body: body})
+	if err != nil {
+		return err
+	}
+	now := d.now()
+	if _, err := d.Notifications.Create(models.Notification{
+		LenderID:  lenderID,
+		Kind:      kind,
+		Period:    now.UTC().Format(time.RFC3339Nano),
+		Recipient: to,
+		Payload:   string(payload),
+	}, now); err != nil {
+		return fmt.Errorf("failed to queue %s email: %w", kind, err)
+	}
+	d.Wake()
+	return nil
+}
+
+// Wake asks a started dispatcher to run now instead of at its next interval. It never blocks.
+func (d *EmailDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce attempts every due email once and returns how many were sent.
+func (d *EmailDispatcher) RunOnce(ctx context.Context) (int, error) {
+	sent := 0
+	for _, kind := range emailKinds {
+		due, err := d.Notifications.ListDue(kind, d.now(), d.BatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, n := range due {
+			var msg models.EmailMessage
+			if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+				if err := d.Notifications.ScheduleRetry(n.NotificationID, sql.NullTime{}, fmt.Sprintf("invalid payload: %v", err)); err != nil {
+					return sent, err
+				}
+				continue
+			}
+			if err := d.attempt(ctx, n, msg.Subject, msg.Body); err != nil {
+				d.Logger.WarnContext(ctx, "Failed to send email", "kind", kind, "recipient", n.Recipient, "error", err)
+				continue
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// attempt sends one queued email and records the outcome, returning the send error
+func (d *EmailDispatcher) attempt(ctx context.Context, n models.Notification, subject, body string) error {
+	if sendErr := d.Mailer.Send(ctx, n.Recipient, subject, body); sendErr != nil {
+		if err := d.Notifications.ScheduleRetry(n.NotificationID, d.nextAttempt(n.Attempts+1), sendErr.Error()); err != nil {
+			d.Logger.ErrorContext(ctx, "Failed to schedule a retry of notification", "notification_id", n.NotificationID, "error", err)
+		}
+		return sendErr
+	}
+	if err := d.Notifications.MarkSent(n.NotificationID, d.now()); err != nil {
+		d.Logger.ErrorContext(ctx, "Failed to mark notification sent", "notification_id", n.NotificationID, "error", err)
+	}
+	return nil
+}
+
+// nextAttempt returns when to retry after the given number of failed attempts, or null to give up.
+func (d *EmailDispatcher) nextAttempt(attempts int) sql.NullTime {
+	if attempts >= d.MaxAttempts {
+		return sql.NullTime{}
+	}
+	delay := d.BaseDelay << (attempts - 1)
+	if delay <= 0 || delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return sql.NullTime{Time: d.now().Add(delay), Valid: true}
+}
+
+// Start runs the dispatcher immediately and then on every interval, or when woken, until ctx is
+// cancelled.
+func (d *EmailDispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := d.RunOnce(ctx); err != nil {
+			d.Logger.ErrorContext(ctx, "Email dispatcher failed", "error", err)
+		} else if sent > 0 {
+			d.Logger.InfoContext(ctx, "Email dispatcher sent emails", "count", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
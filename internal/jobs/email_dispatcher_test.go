@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestEmailDispatcher(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	accountID, err := repository.NewAuthRepository(db).CreateLenderAndAccount("mailed", "mailed@example.com", "123", "mailed", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+
+	notifications := repository.NewNotificationRepository(db)
+	mail := &attachmentMailer{sent: map[string][]mailer.Attachment{}}
+	d := NewEmailDispatcher(notifications, mail)
+	now := time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	list := func(status string) []models.Notification {
+		found, _, err := notifications.List(repository.NotificationFilter{Status: status, Limit: 10})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		return found
+	}
+
+	// Test case 1: Enqueue only queues the email and wakes the dispatcher
+	if err := d.Enqueue(context.Background(), lenderID, models.NotificationPasswordReset, "owner@example.com", "Reset", "link"); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if len(mail.sent) != 0 || len(list(models.NotificationPending)) != 1 {
+		t.Fatalf("Expected the email queued but not sent, got %v", mail.sent)
+	}
+	select {
+	case <-d.wake:
+	default:
+		t.Error("Expected Enqueue to wake the dispatcher")
+	}
+
+	// Test case 2: RunOnce sends the queued email and marks it sent
+	if sent, err := d.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the email sent, got %d, %v", sent, err)
+	}
+	if _, ok := mail.sent["owner@example.com Reset"]; !ok || len(list(models.NotificationSent)) != 1 {
+		t.Fatalf("Expected the email sent and recorded, got %v", mail.sent)
+	}
+
+	// Test case 3: A failed send is left pending for a retry
+	mail.fail = errors.New("smtp down")
+	now = now.Add(time.Second)
+	if err := d.Enqueue(context.Background(), lenderID, models.NotificationEmailVerification, "borrower@example.com", "Verify", "link"); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if sent, err := d.RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("Expected nothing sent, got %d, %v", sent, err)
+	}
+	pending := list(models.NotificationPending)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError.String != "smtp down" {
+		t.Fatalf("Expected one pending retry, got %+v", pending)
+	}
+
+	// Test case 4: Nothing is retried before it is due, and the retry sends the queued message
+	if sent, err := d.RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("Expected nothing due yet, got %d, %v", sent, err)
+	}
+	mail.fail = nil
+	now = now.Add(DefaultEmailBaseDelay)
+	if sent, err := d.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the retry sent, got %d, %v", sent, err)
+	}
+	if _, ok := mail.sent["borrower@example.com Verify"]; !ok || len(list(models.NotificationPending)) != 0 {
+		t.Errorf("Expected the queued email delivered, got %v", mail.sent)
+	}
+}
@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+)
+
+// DefaultNotifyInterval is how often the expiry notifier runs.
+const DefaultNotifyInterval = time.Hour
+
+// DefaultNoticeDays are the days before End_Date at which lenders are reminded.
+var DefaultNoticeDays = []int{7, 1}
+
+// ExpiryNoticeStore finds subscriptions nearing their End_Date and records the reminders sent.
+type ExpiryNoticeStore interface {
+	ListExpiring(ctx context.Context, after, until time.Time) ([]models.ExpiringSubscription, error)
+	ExpiryNoticeSent(ctx context.Context, ledgerID, thresholdDays int) (bool, error)
+	RecordExpiryNotice(ctx context.Context, sub models.ExpiringSubscription, thresholdDays int, sentAt time.Time) error
+}
+
+// ExpiryNotifier reminds lenders by email, and by webhook when configured, that their subscription
+// is about to expire. Each subscription gets at most one reminder per threshold. Lenders that have
+// turned the reminder email off only get the webhook.
+type ExpiryNotifier struct {
+	Store       ExpiryNoticeStore
+	Preferences NotificationPreferences
+	Mailer      mailer.Mailer
+	NoticeDays  []int
+	Interval    time.Duration
+	Logger      *slog.Logger
+
+	now func() time.Time
+}
+
+// NewExpiryNotifier creates a new ExpiryNotifier. Empty noticeDays fall back to DefaultNoticeDays.
+func NewExpiryNotifier(store ExpiryNoticeStore, prefs NotificationPreferences, m mailer.Mailer, noticeDays []int) *ExpiryNotifier {
+	if len(noticeDays) == 0 {
+		noticeDays = DefaultNoticeDays
+	}
+	return &ExpiryNotifier{
+		Store:       store,
+		Preferences: prefs,
+		Mailer:      m,
+		NoticeDays:  noticeDays,
+		Interval:    DefaultNotifyInterval,
+		Logger:      slog.Default(),
+		now:         time.Now,
+	}
+}
+
+// RunOnce sends every reminder that is due and returns how many were sent. A subscription due
+// several reminders at once only gets the most urgent one. Failed emails are retried on the next run.
+func (n *ExpiryNotifier) RunOnce(ctx context.Context) (int, error) {
+	thresholds := append([]int(nil), n.NoticeDays...)
+	sort.Ints(thresholds)
+	if len(thresholds) == 0 {
+		return 0, nil
+	}
+
+	now := n.now()
+	subs, err := n.Store.ListExpiring(ctx, now, now.AddDate(0, 0, thresholds[len(thresholds)-1]))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, sub := range subs {
+		daysLeft := int(math.Ceil(sub.EndDate.Sub(now).Hours() / 24))
+		threshold, ok := noticeThreshold(thresholds, daysLeft)
+		if !ok {
+			continue
+		}
+
+		already, err := n.Store.ExpiryNoticeSent(ctx, sub.LedgerID, threshold)
+		if err != nil {
+			return sent, err
+		}
+		if already {
+			continue
+		}
+
+		email, err := n.Preferences.Enabled(sub.LenderID, models.EventSubscriptionExpiring, models.ChannelEmail)
+		if err != nil {
+			return sent, err
+		}
+		if email {
+			subject, body := expiryNotice(sub, daysLeft)
+			if err := n.Mailer.Send(ctx, sub.Email, subject, body); err != nil {
+				n.Logger.WarnContext(ctx, "Failed to send expiry notice", "ledger_id", sub.LedgerID, "error", err)
+				continue
+			}
+		}
+		if err := n.Store.RecordExpiryNotice(ctx, sub, threshold, now); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// noticeThreshold returns the smallest threshold that daysLeft falls within.
+func noticeThreshold(sorted []int, daysLeft int) (int, bool) {
+	for _, t := range sorted {
+		if daysLeft <= t {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// expiryNotice builds the reminder email
+func expiryNotice(sub models.ExpiringSubscription, daysLeft int) (subject, body string) {
+	kind := "subscription"
+	if sub.IsTrial {
+		kind = "free trial"
+	}
+	subject = fmt.Sprintf("Your %s expires in %d day(s)", kind, daysLeft)
+	body = fmt.Sprintf("Hello,\n\nYour %s %s ends on %s. Renew before then to keep creating loans and recording payments.\n",
+		sub.PlanName, kind, sub.EndDate.Format("2 January 2006"))
+	return subject, body
+}
+
+// Start runs the notifier immediately and then on every interval until ctx is cancelled.
+func (n *ExpiryNotifier) Start(ctx context.Context) {
+	ticker := time.NewTicker(n.Interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := n.RunOnce(ctx); err != nil {
+			n.Logger.ErrorContext(ctx, "Expiry notifier failed", "error", err)
+		} else if sent > 0 {
+			n.Logger.InfoContext(ctx, "Expiry notifier sent reminders", "count", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// recordingMailer remembers every email sent and fails while err is set.
+type recordingMailer struct {
+	sent []string // "to: subject"
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, to+": "+subject)
+	return nil
+}
+
+// setupNotifier creates a notifier over an in-memory database with one lender whose paid
+// subscription ends 10 days from start, and a webhook URL.
+func setupNotifier(t *testing.T, start time.Time) (*ExpiryNotifier, *recordingMailer, *sql.DB) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	accountID, err := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+	repository.NewLenderRepository(db).SetWebhookURL(lenderID, "https://hooks.example.com/lms")
+	res, _ := db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Basic', 100)")
+	planID, _ := res.LastInsertId()
+
+	ledgers := repository.NewLedgerRepository(db)
+	if _, err := ledgers.CreateSubscription(context.Background(), lenderID, int(planID), "LSL", start, start.AddDate(0, 0, 10)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	m := &recordingMailer{}
+	return NewExpiryNotifier(ledgers, repository.NewNotificationPreferenceRepository(db), m, nil), m, db
+}
+
+func TestExpiryNotifier_Thresholds(t *testing.T) {
+	start := time.Now()
+	notifier, m, db := setupNotifier(t, start)
+	ctx := context.Background()
+	at := func(days float64) {
+		notifier.now = func() time.Time { return start.Add(time.Duration(days * float64(24*time.Hour))) }
+	}
+
+	// Test case 1: Ten days out nothing is due
+	at(0)
+	if n, err := notifier.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("Expected no reminders, got %d (%v)", n, err)
+	}
+
+	// Test case 2: Seven days out the 7-day reminder is sent, with a webhook
+	at(3)
+	if n, err := notifier.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 reminder, got %d (%v)", n, err)
+	}
+	if len(m.sent) != 1 || !strings.Contains(m.sent[0], "lender@example.com: Your subscription expires in 7 day(s)") {
+		t.Errorf("Unexpected emails: %v", m.sent)
+	}
+	var queued int
+	db.QueryRow("SELECT COUNT(*) FROM Outbox WHERE Event_Type = ?", models.EventSubscriptionExpiring).Scan(&queued)
+	if queued != 1 {
+		t.Errorf("Expected 1 queued webhook, got %d", queued)
+	}
+
+	// Test case 3: Already notified for 7 days, so later runs inside the window send nothing
+	at(5)
+	if n, err := notifier.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("Expected no repeat reminder, got %d (%v)", n, err)
+	}
+
+	// Test case 4: One day out the 1-day reminder is sent once
+	at(9.5)
+	if n, err := notifier.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected the 1-day reminder, got %d (%v)", n, err)
+	}
+	if n, _ := notifier.RunOnce(ctx); n != 0 {
+		t.Errorf("Expected the 1-day reminder only once, got %d", n)
+	}
+	if len(m.sent) != 2 || !strings.Contains(m.sent[1], "expires in 1 day(s)") {
+		t.Errorf("Unexpected emails: %v", m.sent)
+	}
+
+	// Test case 5: Expired subscriptions get no reminders
+	at(11)
+	if n, _ := notifier.RunOnce(ctx); n != 0 {
+		t.Errorf("Expected no reminders after expiry, got %d", n)
+	}
+}
+
+func TestExpiryNotifier_FirstSeenInsideOneDay(t *testing.T) {
+	start := time.Now()
+	notifier, m, _ := setupNotifier(t, start)
+	notifier.now = func() time.Time { return start.AddDate(0, 0, 9).Add(time.Hour) }
+
+	// Only the most urgent reminder is sent, not the missed 7-day one as well
+	if n, err := notifier.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 reminder, got %d (%v)", n, err)
+	}
+	if len(m.sent) != 1 || !strings.Contains(m.sent[0], "expires in 1 day(s)") {
+		t.Errorf("Unexpected emails: %v", m.sent)
+	}
+}
+
+func TestExpiryNotifier_RetriesFailedEmail(t *testing.T) {
+	start := time.Now()
+	notifier, m, _ := setupNotifier(t, start)
+	notifier.now = func() time.Time { return start.AddDate(0, 0, 4) }
+
+	// Test case 1: A failed email is not recorded as sent
+	m.err = errors.New("smtp down")
+	if n, err := notifier.RunOnce(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Expected no reminders while mail fails, got %d (%v)", n, err)
+	}
+
+	// Test case 2: The next run sends it
+	m.err = nil
+	if n, err := notifier.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected the reminder on retry, got %d (%v)", n, err)
+	}
+}
+
+func TestExpiryNotifier_EmailTurnedOff(t *testing.T) {
+	start := time.Now()
+	notifier, m, db := setupNotifier(t, start)
+	notifier.now = func() time.Time { return start.AddDate(0, 0, 4) }
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Lenders").Scan(&lenderID)
+	repository.NewNotificationPreferenceRepository(db).Set(lenderID, []models.NotificationPreference{
+		{Event: models.EventSubscriptionExpiring, Channel: models.ChannelEmail, Enabled: false},
+	})
+
+	// The reminder is recorded and its webhook queued, but no email is sent
+	if n, err := notifier.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 reminder, got %d (%v)", n, err)
+	}
+	var queued int
+	db.QueryRow("SELECT COUNT(*) FROM Outbox WHERE Event_Type = ?", models.EventSubscriptionExpiring).Scan(&queued)
+	if len(m.sent) != 0 || queued != 1 {
+		t.Errorf("Expected only the webhook, got emails %v and %d webhook(s)", m.sent, queued)
+	}
+}
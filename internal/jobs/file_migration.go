@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/storage"
+)
+
+// DefaultFileMigrationBatch is how many File rows the file migration reads at a time.
+const DefaultFileMigrationBatch = 100
+
+// FileBackendStore lists files by storage backend and records when one moves.
+type FileBackendStore interface {
+	ListFilesByBackend(backend string, afterID, limit int) ([]models.File, error)
+	SetStorageBackend(fileID int, backend string) error
+}
+
+// FileMigration copies every file stored on one backend to another under the same key and
+// repoints its File row. The source copies are left in place; remove them once satisfied.
+// Running it again picks up where it stopped, since moved rows no longer match the source.
+type FileMigration struct {
+	Files     FileBackendStore
+	From      string
+	To        string
+	Backends  *storage.Backends
+	BatchSize int
+	Logger    *slog.Logger
+}
+
+// NewFileMigration creates a new FileMigration moving files from one named backend to another.
+func NewFileMigration(files FileBackendStore, backends *storage.Backends, from, to string) *FileMigration {
+	return &FileMigration{
+		Files:     files,
+		From:      from,
+		To:        to,
+		Backends:  backends,
+		BatchSize: DefaultFileMigrationBatch,
+		Logger:    slog.Default(),
+	}
+}
+
+// Run migrates every file and returns how many were moved. Files missing from the source are
+// logged and skipped; any other failure stops the migration.
+func (m *FileMigration) Run(ctx context.Context) (int, error) {
+	if m.From == m.To {
+		return 0, fmt.Errorf("source and destination backend are both %q", m.From)
+	}
+	from, err := m.Backends.For(m.From)
+	if err != nil {
+		return 0, err
+	}
+	to, err := m.Backends.For(m.To)
+	if err != nil {
+		return 0, err
+	}
+
+	moved, afterID := 0, 0
+	for {
+		files, err := m.Files.ListFilesByBackend(m.From, afterID, m.BatchSize)
+		if err != nil {
+			return moved, err
+		}
+		if len(files) == 0 {
+			return moved, nil
+		}
+
+		for _, file := range files {
+			afterID = file.FileID
+			if err := ctx.Err(); err != nil {
+				return moved, err
+			}
+
+			if err := copyFile(ctx, from, to, file.Value); err != nil {
+				if errors.Is(err, storage.ErrNotFound) {
+					m.Logger.WarnContext(ctx, "Skipping file missing from the source backend", "file_id", file.FileID, "key", file.Value, "backend", m.From)
+					continue
+				}
+				return moved, fmt.Errorf("failed to copy file %d: %w", file.FileID, err)
+			}
+			if err := m.Files.SetStorageBackend(file.FileID, m.To); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+}
+
+// copyFile streams key from one store to another
+func copyFile(ctx context.Context, from, to storage.FileStore, key string) error {
+	rc, err := from.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return to.Save(ctx, key, rc)
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFileMigration(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	accountID, _ := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+
+	ctx := context.Background()
+	local, remote := storage.NewDisk(t.TempDir()), storage.NewDisk(t.TempDir())
+	backends, _ := storage.NewBackends(storage.BackendS3, map[string]storage.FileStore{storage.BackendLocal: local, storage.BackendS3: remote})
+	files := repository.NewFileRepository(db)
+
+	// Three local files, one of them missing from disk, and one already remote
+	for _, key := range []string{"a.pdf", "b.pdf", "missing.pdf"} {
+		if key != "missing.pdf" {
+			local.Save(ctx, key, strings.NewReader("contents of "+key))
+		}
+		files.CreateFile(&models.File{LenderID: lenderID, Value: key, StorageBackend: storage.BackendLocal})
+	}
+	files.CreateFile(&models.File{LenderID: lenderID, Value: "c.pdf", StorageBackend: storage.BackendS3})
+
+	migration := NewFileMigration(files, backends, storage.BackendLocal, storage.BackendS3)
+	migration.BatchSize = 2
+
+	// Test case 1: Present local files are copied and repointed; the missing one is skipped
+	moved, err := migration.Run(ctx)
+	if err != nil || moved != 2 {
+		t.Fatalf("Expected 2 files moved, got %d (%v)", moved, err)
+	}
+	rc, err := remote.Open(ctx, "b.pdf")
+	if err != nil {
+		t.Fatalf("Expected b.pdf on the remote backend, got %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "contents of b.pdf" {
+		t.Errorf("Unexpected remote contents %q", data)
+	}
+	left, _ := files.ListFilesByBackend(storage.BackendLocal, 0, 10)
+	if len(left) != 1 || left[0].Value != "missing.pdf" {
+		t.Errorf("Expected only the missing file left on local, got %+v", left)
+	}
+
+	// Test case 2: Running again has nothing left to move
+	if moved, err := migration.Run(ctx); err != nil || moved != 0 {
+		t.Errorf("Expected nothing to move, got %d (%v)", moved, err)
+	}
+
+	// Test case 3: Migrating a backend onto itself is refused
+	if _, err := NewFileMigration(files, backends, storage.BackendS3, storage.BackendS3).Run(ctx); err == nil {
+		t.Error("Expected an error migrating a backend onto itself")
+	}
+}
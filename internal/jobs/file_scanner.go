@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/scanner"
+	"wisetech-lms-api/internal/storage"
+)
+
+// DefaultScanInterval is how often the file scanner looks for files waiting to be scanned when
+// it is not woken by an upload.
+const DefaultScanInterval = time.Minute
+
+// ScanStore finds files waiting for the malware scanner and records its verdicts.
+type ScanStore interface {
+	ListFilesByStatus(status string, afterID, limit int) ([]models.File, error)
+	RecordScanResult(ctx context.Context, fileID int, status, signature string) error
+}
+
+// FileScanner scans uploaded files for malware after they are stored, so uploads do not wait for
+// the scan. Clean files become available; infected files are quarantined: their row and contents
+// are kept for review but never served. Files that cannot be scanned stay pending and are retried.
+type FileScanner struct {
+	Store     ScanStore
+	Backends  *storage.Backends
+	Scanner   scanner.Scanner
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+
+	wake chan struct{}
+}
+
+// NewFileScanner creates a new FileScanner.
+func NewFileScanner(store ScanStore, backends *storage.Backends, s scanner.Scanner) *FileScanner {
+	return &FileScanner{
+		Store:     store,
+		Backends:  backends,
+		Scanner:   s,
+		Interval:  DefaultScanInterval,
+		BatchSize: DefaultFileMigrationBatch,
+		wake:      make(chan struct{}, 1),
+		Logger:    slog.Default(),
+	}
+}
+
+// Wake asks a started scanner to run now instead of at its next interval. It never blocks.
+func (s *FileScanner) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce scans every file waiting for a scan and returns how many got a verdict.
+func (s *FileScanner) RunOnce(ctx context.Context) (int, error) {
+	scanned := 0
+	afterID := 0
+	for {
+		files, err := s.Store.ListFilesByStatus(models.FileStatusPendingScan, afterID, s.BatchSize)
+		if err != nil {
+			return scanned, err
+		}
+		if len(files) == 0 {
+			return scanned, nil
+		}
+		for _, file := range files {
+			afterID = file.FileID
+			verdict, err := s.scan(ctx, file)
+			if err != nil {
+				if ctx.Err() != nil {
+					return scanned, ctx.Err()
+				}
+				s.Logger.WarnContext(ctx, "Failed to scan file", "file_id", file.FileID, "error", err)
+				continue
+			}
+
+			status := models.FileStatusClean
+			if verdict.Infected {
+				status = models.FileStatusInfected
+				s.Logger.WarnContext(ctx, "Quarantined file", "file_id", file.FileID, "lender_id", file.LenderID, "signature", verdict.Signature)
+			}
+			err = s.Store.RecordScanResult(ctx, file.FileID, status, verdict.Signature)
+			if errors.Is(err, repository.ErrFileNotFound) {
+				continue // Deleted while being scanned
+			}
+			if err != nil {
+				return scanned, err
+			}
+			scanned++
+		}
+	}
+}
+
+// scan streams one file's contents to the scanner
+func (s *FileScanner) scan(ctx context.Context, file models.File) (scanner.Verdict, error) {
+	store, err := s.Backends.For(file.StorageBackend)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	contents, err := store.Open(ctx, file.Value)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	defer contents.Close()
+	return s.Scanner.Scan(ctx, contents)
+}
+
+// Start runs the scanner immediately, then on every interval and whenever it is woken, until ctx
+// is cancelled.
+func (s *FileScanner) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if scanned, err := s.RunOnce(ctx); err != nil {
+			s.Logger.ErrorContext(ctx, "File scanner failed", "error", err)
+		} else if scanned > 0 {
+			s.Logger.InfoContext(ctx, "File scanner scanned files", "count", scanned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
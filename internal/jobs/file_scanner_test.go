@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/scanner"
+	"wisetech-lms-api/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// markerScanner flags contents containing "virus" and fails while err is set.
+type markerScanner struct {
+	err error
+}
+
+func (m *markerScanner) Scan(ctx context.Context, r io.Reader) (scanner.Verdict, error) {
+	if m.err != nil {
+		return scanner.Verdict{}, m.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	if strings.Contains(string(data), "virus") {
+		return scanner.Verdict{Infected: true, Signature: "Test.Virus"}, nil
+	}
+	return scanner.Verdict{}, nil
+}
+
+func TestFileScanner(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	accountID, _ := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+
+	ctx := context.Background()
+	local := storage.NewDisk(t.TempDir())
+	backends, _ := storage.NewBackends(storage.BackendLocal, map[string]storage.FileStore{storage.BackendLocal: local})
+	files := repository.NewFileRepository(db)
+	store := func(key, contents string) *models.File {
+		local.Save(ctx, key, strings.NewReader(contents))
+		file := &models.File{LenderID: lenderID, Value: key, StorageBackend: storage.BackendLocal}
+		files.CreateFile(file)
+		return file
+	}
+	status := func(file *models.File) string {
+		got, _ := files.GetFileByID(lenderID, file.FileID)
+		return got.Status
+	}
+
+	clean := store("clean.pdf", "contract")
+	infected := store("infected.pdf", "contract with a virus")
+	missing := &models.File{LenderID: lenderID, Value: "missing.pdf", StorageBackend: storage.BackendLocal}
+	files.CreateFile(missing)
+
+	m := &markerScanner{}
+	fileScanner := NewFileScanner(files, backends, m)
+	fileScanner.BatchSize = 1
+
+	// Test case 1: While the scanner is down nothing changes
+	m.err = errors.New("clamd unreachable")
+	if n, err := fileScanner.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("Expected no verdicts, got %d (%v)", n, err)
+	}
+	if status(clean) != models.FileStatusPendingScan {
+		t.Errorf("Expected the file to stay pending, got %q", status(clean))
+	}
+
+	// Test case 2: Verdicts are recorded; a file whose contents are missing stays pending
+	m.err = nil
+	if n, err := fileScanner.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("Expected 2 verdicts, got %d (%v)", n, err)
+	}
+	if status(clean) != models.FileStatusClean || status(infected) != models.FileStatusInfected || status(missing) != models.FileStatusPendingScan {
+		t.Errorf("Unexpected statuses: %s, %s, %s", status(clean), status(infected), status(missing))
+	}
+	var details string
+	db.QueryRow("SELECT Details FROM Audit_Log WHERE Action = ? AND Resource_ID = ?", models.AuditFileQuarantined, infected.FileID).Scan(&details)
+	if !strings.Contains(details, "Test.Virus") {
+		t.Errorf("Expected the quarantine audited with its signature, got %q", details)
+	}
+
+	// Test case 3: Scanned files are not scanned again
+	if n, _ := fileScanner.RunOnce(ctx); n != 0 {
+		t.Errorf("Expected no further verdicts, got %d", n)
+	}
+}
+
+func TestFileScanner_Wake(t *testing.T) {
+	fileScanner := NewFileScanner(nil, nil, scanner.Noop{})
+
+	// Waking an idle scanner twice queues a single run and never blocks
+	fileScanner.Wake()
+	fileScanner.Wake()
+	if len(fileScanner.wake) != 1 {
+		t.Errorf("Expected one queued wake-up, got %d", len(fileScanner.wake))
+	}
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+)
+
+// DefaultSnapshotInterval is how often the snapshot job looks for months that have ended. Hourly
+// catches the end of a month in every time zone.
+const DefaultSnapshotInterval = time.Hour
+
+// LenderTimezones lists every lender's time zone.
+type LenderTimezones interface {
+	ListTimezones() (map[int]string, error)
+}
+
+// LoanBookSource computes a lender's loan book as of the end of a day.
+type LoanBookSource interface {
+	Portfolio(lenderID int, day time.Time) (*reports.Portfolio, error)
+	LoanBook(lenderID int, day time.Time) ([]reports.LoanBalance, error)
+}
+
+// SnapshotStore stores loan book snapshots, once per lender and month.
+type SnapshotStore interface {
+	Create(snapshot *models.LoanBookSnapshot) error
+	Exists(lenderID int, month string) (bool, error)
+}
+
+// LoanBookSnapshotter stores each lender's month-end loan book once the month has ended in the
+// lender's time zone, so reports on it stay the same when back-dated receipts are entered later.
+type LoanBookSnapshotter struct {
+	Lenders   LenderTimezones
+	Source    LoanBookSource
+	Snapshots SnapshotStore
+	Interval  time.Duration
+	Logger    *slog.Logger
+
+	now func() time.Time
+}
+
+// NewLoanBookSnapshotter creates a new LoanBookSnapshotter with the default settings.
+func NewLoanBookSnapshotter(lenders LenderTimezones, source LoanBookSource, snapshots SnapshotStore) *LoanBookSnapshotter {
+	return &LoanBookSnapshotter{
+		Lenders:   lenders,
+		Source:    source,
+		Snapshots: snapshots,
+		Interval:  DefaultSnapshotInterval,
+		Logger:    slog.Default(),
+		now:       time.Now,
+	}
+}
+
+// RunOnce snapshots the month just ended for every lender that has no snapshot of it yet, and
+// returns how many it stored. A lender missed while the job was down is caught up on the next run.
+func (s *LoanBookSnapshotter) RunOnce(ctx context.Context) (int, error) {
+	zones, err := s.Lenders.ListTimezones()
+	if err != nil {
+		return 0, err
+	}
+	stored := 0
+	for lenderID, zone := range zones {
+		if ctx.Err() != nil {
+			return stored, ctx.Err()
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			loc = time.UTC
+		}
+		month := LastMonth(s.now().In(loc))
+		exists, err := s.Snapshots.Exists(lenderID, month.Format("2006-01"))
+		if err != nil {
+			return stored, err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.Snapshot(lenderID, month); err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+// Snapshot stores the lender's loan book as of the last day of month, given as the midnight
+// starting it in the lender's location. Snapshots are never rewritten: when one exists for the
+// month it logs a warning and returns repository.ErrSnapshotExists.
+func (s *LoanBookSnapshotter) Snapshot(lenderID int, month time.Time) (*models.LoanBookSnapshot, error) {
+	day := month.AddDate(0, 1, -1)
+	portfolio, err := s.Source.Portfolio(lenderID, day)
+	if err != nil {
+		return nil, err
+	}
+	book, err := s.Source.LoanBook(lenderID, day)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.LoanBookSnapshot{
+		LenderID:             lenderID,
+		Month:                month.Format("2006-01"),
+		AsOf:                 day.Format(time.DateOnly),
+		Loans:                make([]models.LoanSnapshot, len(book)),
+		OutstandingPrincipal: portfolio.Outstanding.Principal,
+		OutstandingInterest:  portfolio.Outstanding.Interest,
+		OutstandingPenalties: portfolio.Outstanding.Penalties,
+		Portfolio:            string(data),
+		CreatedAt:            models.NewJSONTime(s.now().UTC()),
+	}
+	for i, loan := range book {
+		snapshot.Loans[i] = models.LoanSnapshot{
+			LoanID:               loan.LoanID,
+			Status:               loan.Status,
+			OutstandingPrincipal: loan.Outstanding.Principal,
+			OutstandingInterest:  loan.Outstanding.Interest,
+			OutstandingPenalties: loan.Outstanding.Penalties,
+		}
+	}
+	if err := s.Snapshots.Create(snapshot); err != nil {
+		if errors.Is(err, repository.ErrSnapshotExists) {
+			s.Logger.Warn("Loan book snapshot already exists; it was not rewritten", "lender_id", lenderID, "month", snapshot.Month)
+		}
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// LastMonth returns the midnight starting the month before t's, in t's location.
+func LastMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()-1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// Start runs the job immediately and then on every interval until ctx is cancelled.
+func (s *LoanBookSnapshotter) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if stored, err := s.RunOnce(ctx); err != nil {
+			s.Logger.ErrorContext(ctx, "Loan book snapshot job failed", "error", err)
+		} else if stored > 0 {
+			s.Logger.InfoContext(ctx, "Loan book snapshot job stored snapshots", "count", stored)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
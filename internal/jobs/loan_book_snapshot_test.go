@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoanBookSnapshotter(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	auth := repository.NewAuthRepository(db)
+	lenderIDs := map[string]int{}
+	for _, name := range []string{"maseru", "utc"} {
+		accountID, err := auth.CreateLenderAndAccount(name, name+"@example.com", "123", name, "hash", 5.0, "LSL")
+		if err != nil {
+			t.Fatalf("Failed to seed lender: %v", err)
+		}
+		var lenderID int
+		db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+		lenderIDs[name] = lenderID
+	}
+	db.Exec("UPDATE Lenders SET Timezone = 'Africa/Maseru' WHERE Lender_ID = ?", lenderIDs["maseru"])
+	res, _ := db.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Snapshot Borrower', 'snap@example.com', '555')")
+	borrowerID, _ := res.LastInsertId()
+	res, err = db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date)
+		VALUES (?, ?, 12, 'active', 1000, 20, 100, '2026-08-15')`, borrowerID, lenderIDs["maseru"])
+	if err != nil {
+		t.Fatalf("Failed to seed loan: %v", err)
+	}
+	loanID, _ := res.LastInsertId()
+	receipts := repository.NewReceiptRepository(db)
+	receipt := func(amount float64, at time.Time) {
+		if _, err := receipts.CreateReceipt(lenderIDs["maseru"], &models.Receipt{LoanID: int(loanID), Status: "paid", Amount: amount, Timestamp: models.NewJSONTime(at)}); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+	receipt(300, time.Date(2026, 9, 10, 9, 0, 0, 0, time.UTC))
+
+	snapshots := repository.NewLoanBookSnapshotRepository(db)
+	s := NewLoanBookSnapshotter(repository.NewLenderRepository(db), reports.NewReporter(db), snapshots)
+	// 23:30 UTC on 30 September is already 1 October in Maseru (UTC+2)
+	now := time.Date(2026, 9, 30, 23, 30, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// Test case 1: Only lenders whose month has ended get it snapshotted, as of its last day
+	stored, err := s.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if stored != 2 {
+		t.Fatalf("Expected a snapshot per lender, got %d", stored)
+	}
+	september, err := snapshots.Get(lenderIDs["maseru"], "2026-09")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if september.AsOf != "2026-09-30" || len(september.Loans) != 1 || september.Loans[0].OutstandingPrincipal != 700 ||
+		september.OutstandingPrincipal != 700 || september.OutstandingInterest != 200 {
+		t.Errorf("Unexpected September snapshot: %+v", september)
+	}
+	if _, err := snapshots.Get(lenderIDs["utc"], "2026-08"); err != nil {
+		t.Errorf("Expected the UTC lender's August snapshot, got %v", err)
+	}
+
+	// Test case 2: Running again stores nothing, and a back-dated receipt leaves the snapshot as it was
+	receipt(100, time.Date(2026, 9, 20, 9, 0, 0, 0, time.UTC))
+	if stored, err := s.RunOnce(context.Background()); err != nil || stored != 0 {
+		t.Fatalf("Expected nothing stored, got %d, %v", stored, err)
+	}
+	if _, err := s.Snapshot(lenderIDs["maseru"], time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, repository.ErrSnapshotExists) {
+		t.Errorf("Expected ErrSnapshotExists, got %v", err)
+	}
+	if again, _ := snapshots.Get(lenderIDs["maseru"], "2026-09"); again.OutstandingPrincipal != 700 || again.Portfolio != september.Portfolio {
+		t.Errorf("Expected the snapshot unchanged, got %+v", again)
+	}
+
+	// Test case 3: Stored rows cannot be updated
+	if _, err := db.Exec("UPDATE Loan_Book_Snapshots SET Outstanding_Principal = 0"); err == nil {
+		t.Error("Expected updating a snapshot to fail")
+	}
+}
@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/storage"
+)
+
+// DefaultSweepInterval is how often the orphan sweeper runs.
+const DefaultSweepInterval = 24 * time.Hour
+
+// FileLister lists File rows by storage backend in batches.
+type FileLister interface {
+	ListFilesByBackend(backend string, afterID, limit int) ([]models.File, error)
+}
+
+// OrphanObject is a stored object with no File row pointing at it
+type OrphanObject struct {
+	Backend string `json:"backend"`
+	Key     string `json:"key"`
+}
+
+// OrphanReport is the result of one sweep
+type OrphanReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// Objects are stored objects no File row points at, e.g. left behind when deleting a file's
+	// contents failed. An upload between saving its contents and recording its row also shows up here.
+	Objects []OrphanObject `json:"objects_without_row"`
+	// Rows are File rows whose contents are missing from their backend
+	Rows []models.File `json:"rows_without_object"`
+}
+
+// OrphanSweeper compares every backend's stored objects with the File rows recorded for it and
+// reports the differences. It never deletes anything; an operator acts on the report.
+type OrphanSweeper struct {
+	Files     FileLister
+	Backends  *storage.Backends
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+
+	now  func() time.Time
+	mu   sync.Mutex
+	last *OrphanReport
+}
+
+// NewOrphanSweeper creates a new OrphanSweeper over every configured backend.
+func NewOrphanSweeper(files FileLister, backends *storage.Backends) *OrphanSweeper {
+	return &OrphanSweeper{
+		Files:     files,
+		Backends:  backends,
+		Interval:  DefaultSweepInterval,
+		BatchSize: DefaultFileMigrationBatch,
+		Logger:    slog.Default(),
+		now:       time.Now,
+	}
+}
+
+// RunOnce sweeps every backend, keeps the report for Last and returns it.
+func (s *OrphanSweeper) RunOnce(ctx context.Context) (*OrphanReport, error) {
+	report := &OrphanReport{CheckedAt: s.now().UTC(), Objects: []OrphanObject{}, Rows: []models.File{}}
+	for _, name := range s.Backends.Names() {
+		if err := s.sweep(ctx, name, report); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+	return report, nil
+}
+
+// sweep adds the differences between one backend's objects and its File rows to report
+func (s *OrphanSweeper) sweep(ctx context.Context, backend string, report *OrphanReport) error {
+	store, err := s.Backends.For(backend)
+	if err != nil {
+		return err
+	}
+	keys, err := store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		stored[key] = true
+	}
+
+	recorded := make(map[string]bool)
+	afterID := 0
+	for {
+		files, err := s.Files.ListFilesByBackend(backend, afterID, s.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			break
+		}
+		for _, file := range files {
+			afterID = file.FileID
+			recorded[file.Value] = true
+			if !stored[file.Value] {
+				report.Rows = append(report.Rows, file)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if !recorded[key] {
+			report.Objects = append(report.Objects, OrphanObject{Backend: backend, Key: key})
+		}
+	}
+	return nil
+}
+
+// Last returns the report of the most recent sweep, or nil before the first one finishes.
+func (s *OrphanSweeper) Last() *OrphanReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Start runs the sweeper immediately and then on every interval until ctx is cancelled.
+func (s *OrphanSweeper) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if report, err := s.RunOnce(ctx); err != nil {
+			s.Logger.ErrorContext(ctx, "Orphan sweeper failed", "error", err)
+		} else if len(report.Objects) > 0 || len(report.Rows) > 0 {
+			s.Logger.WarnContext(ctx, "Orphan sweeper found differences", "objects_without_row", len(report.Objects), "rows_without_object", len(report.Rows))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOrphanSweeper(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	accountID, _ := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+
+	ctx := context.Background()
+	local, remote := storage.NewDisk(t.TempDir()), storage.NewDisk(t.TempDir())
+	backends, _ := storage.NewBackends(storage.BackendLocal, map[string]storage.FileStore{storage.BackendLocal: local, storage.BackendS3: remote})
+	files := repository.NewFileRepository(db)
+
+	// Matched on each backend, an object left behind locally, and a remote row whose object is gone
+	local.Save(ctx, "a.pdf", strings.NewReader("a"))
+	files.CreateFile(&models.File{LenderID: lenderID, Value: "a.pdf", StorageBackend: storage.BackendLocal})
+	local.Save(ctx, "leftover.pdf", strings.NewReader("leftover"))
+	remote.Save(ctx, "b.pdf", strings.NewReader("b"))
+	files.CreateFile(&models.File{LenderID: lenderID, Value: "b.pdf", StorageBackend: storage.BackendS3})
+	files.CreateFile(&models.File{LenderID: lenderID, Value: "gone.pdf", StorageBackend: storage.BackendS3})
+	// The same key on another backend does not count as stored
+	local.Save(ctx, "gone.pdf", strings.NewReader("wrong backend"))
+
+	sweeper := NewOrphanSweeper(files, backends)
+	sweeper.BatchSize = 1
+	if sweeper.Last() != nil {
+		t.Error("Expected no report before the first sweep")
+	}
+
+	// Test case 1: Both kinds of orphan are reported per backend
+	report, err := sweeper.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if len(report.Objects) != 2 || report.Objects[0] != (OrphanObject{Backend: storage.BackendLocal, Key: "gone.pdf"}) ||
+		report.Objects[1] != (OrphanObject{Backend: storage.BackendLocal, Key: "leftover.pdf"}) {
+		t.Errorf("Unexpected orphaned objects: %+v", report.Objects)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Value != "gone.pdf" || report.Rows[0].StorageBackend != storage.BackendS3 {
+		t.Errorf("Unexpected orphaned rows: %+v", report.Rows)
+	}
+
+	// Test case 2: Nothing was deleted, and the report is kept
+	if _, err := local.Open(ctx, "leftover.pdf"); err != nil {
+		t.Errorf("Expected the orphaned object to be kept, got %v", err)
+	}
+	if sweeper.Last() != report {
+		t.Error("Expected Last to return the latest report")
+	}
+}
@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// Outbox dispatcher defaults.
+const (
+	DefaultOutboxInterval    = 30 * time.Second
+	DefaultOutboxBatchSize   = 50
+	DefaultOutboxBaseDelay   = time.Minute
+	DefaultOutboxMaxDelay    = 6 * time.Hour
+	DefaultOutboxMaxAttempts = 10
+)
+
+// OutboxStore reads due outbox events and records the outcome of delivering them.
+type OutboxStore interface {
+	ListDue(now time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkDelivered(outboxID int, at time.Time) error
+	ScheduleRetry(outboxID int, next sql.NullTime, lastErr string) error
+}
+
+// NotificationPreferences reports whether a lender is sent an event on a channel.
+type NotificationPreferences interface {
+	Enabled(lenderID int, event, channel string) (bool, error)
+}
+
+// suppressedError is recorded on outbox events the lender has turned off
+const suppressedError = "suppressed by the lender's notification preferences"
+
+// OutboxDispatcher periodically posts due outbox events to their targets. Failed deliveries are
+// retried with exponential backoff until MaxAttempts is reached, after which the event is left undelivered.
+// Events whose lender has turned them off are left undelivered without being posted.
+type OutboxDispatcher struct {
+	Store       OutboxStore
+	Preferences NotificationPreferences
+	Client      *http.Client
+	Interval    time.Duration
+	BatchSize   int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int
+	Logger      *slog.Logger
+
+	now func() time.Time
+}
+
+// NewOutboxDispatcher creates a new OutboxDispatcher with the default settings.
+func NewOutboxDispatcher(store OutboxStore, prefs NotificationPreferences) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		Store:       store,
+		Preferences: prefs,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Interval:    DefaultOutboxInterval,
+		BatchSize:   DefaultOutboxBatchSize,
+		BaseDelay:   DefaultOutboxBaseDelay,
+		MaxDelay:    DefaultOutboxMaxDelay,
+		MaxAttempts: DefaultOutboxMaxAttempts,
+		Logger:      slog.Default(),
+		now:         time.Now,
+	}
+}
+
+// RunOnce attempts every due event once and returns how many were delivered.
+func (d *OutboxDispatcher) RunOnce(ctx context.Context) (int, error) {
+	events, err := d.Store.ListDue(d.now(), d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, event := range events {
+		enabled, err := d.Preferences.Enabled(event.LenderID, event.EventType, models.ChannelWebhook)
+		if err != nil {
+			return delivered, err
+		}
+		if !enabled {
+			if err := d.Store.ScheduleRetry(event.OutboxID, sql.NullTime{}, suppressedError); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := d.deliver(ctx, event); err != nil {
+			if err := d.Store.ScheduleRetry(event.OutboxID, d.nextAttempt(event.Attempts+1), err.Error()); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := d.Store.MarkDelivered(event.OutboxID, d.now()); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// nextAttempt returns when to retry after the given number of failed attempts, or null to give up.
+func (d *OutboxDispatcher) nextAttempt(attempts int) sql.NullTime {
+	if attempts >= d.MaxAttempts {
+		return sql.NullTime{}
+	}
+	delay := d.BaseDelay << (attempts - 1)
+	if delay <= 0 || delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return sql.NullTime{Time: d.now().Add(delay), Valid: true}
+}
+
+// deliver posts the event payload to its target. Any non-2xx response is a failure.
+// The outbox ID is sent as X-Webhook-ID so receivers can discard redeliveries.
+func (d *OutboxDispatcher) deliver(ctx context.Context, event models.OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, event.Target, bytes.NewReader([]byte(event.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event.EventType)
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(event.OutboxID))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook target returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Start runs the dispatcher immediately and then on every interval until ctx is cancelled.
+func (d *OutboxDispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := d.RunOnce(ctx); err != nil {
+			d.Logger.ErrorContext(ctx, "Outbox dispatcher failed", "error", err)
+		} else if n > 0 {
+			d.Logger.InfoContext(ctx, "Outbox dispatcher delivered events", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
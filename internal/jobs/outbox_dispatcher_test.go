@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestOutboxDispatcher_DeliversLoanPaidWithRetry(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	// Fake webhook receiver that fails the first delivery
+	var calls atomic.Int32
+	var lastEvent, lastID atomic.Value
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEvent.Store(r.Header.Get("X-Webhook-Event"))
+		lastID.Store(r.Header.Get("X-Webhook-ID"))
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	accountID, err := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+	if err := repository.NewLenderRepository(db).SetWebhookURL(lenderID, target.URL); err != nil {
+		t.Fatalf("SetWebhookURL failed: %v", err)
+	}
+	db.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Borrower', 'b@example.com', '555')")
+	res, err := db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Start_Date)
+		VALUES (1, ?, 12, 'active', 1000, 10, DATE('now'))`, lenderID)
+	if err != nil {
+		t.Fatalf("Failed to seed loan: %v", err)
+	}
+	loanID, _ := res.LastInsertId()
+
+	// Test case 1: Marking the loan paid persists the event
+	if err := repository.NewLoanRepository(db).MarkPaid(lenderID, int(loanID)); err != nil {
+		t.Fatalf("MarkPaid failed: %v", err)
+	}
+	var queued int
+	db.QueryRow("SELECT COUNT(*) FROM Outbox WHERE Event_Type = ? AND Delivered_At IS NULL", models.EventLoanPaid).Scan(&queued)
+	if queued != 1 {
+		t.Fatalf("Expected 1 queued event, got %d", queued)
+	}
+
+	// Test case 2: A failed delivery is scheduled for retry after the base delay
+	dispatcher := NewOutboxDispatcher(repository.NewOutboxRepository(db), repository.NewNotificationPreferenceRepository(db))
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	n, err := dispatcher.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected no deliveries, got %d", n)
+	}
+	if n, _ := dispatcher.RunOnce(context.Background()); n != 0 || calls.Load() != 1 {
+		t.Errorf("Expected the retry not to be due yet, got %d deliveries and %d calls", n, calls.Load())
+	}
+
+	// Test case 3: Once the retry is due the event is delivered and marked
+	dispatcher.now = func() time.Time { return now.Add(DefaultOutboxBaseDelay) }
+	n, err = dispatcher.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 delivery, got %d", n)
+	}
+	if lastEvent.Load() != models.EventLoanPaid || lastID.Load() == "" {
+		t.Errorf("Expected event headers, got %v and %v", lastEvent.Load(), lastID.Load())
+	}
+	var attempts int
+	var deliveredAt sql.NullTime
+	db.QueryRow("SELECT Attempts, Delivered_At FROM Outbox").Scan(&attempts, &deliveredAt)
+	if attempts != 2 || !deliveredAt.Valid {
+		t.Errorf("Expected a delivered event after 2 attempts, got %d attempts, delivered %v", attempts, deliveredAt)
+	}
+}
+
+func TestOutboxDispatcher_NotificationPreferences(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Webhook-Event"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	accountID, err := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	var lenderID int
+	db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+	repository.NewLenderRepository(db).SetWebhookURL(lenderID, target.URL)
+	db.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Borrower', 'b@example.com', '555')")
+	seed := func(start string) int {
+		res, err := db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Start_Date)
+			VALUES (1, ?, 1, 'active', 1000, 10, ?)`, lenderID, start)
+		if err != nil {
+			t.Fatalf("Failed to seed loan: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		return int(id)
+	}
+	paidID := seed(time.Now().Format(time.DateOnly))
+	overdueID := seed("2020-01-01")
+
+	prefs := repository.NewNotificationPreferenceRepository(db)
+	if err := prefs.Set(lenderID, []models.NotificationPreference{{Event: models.EventLoanPaid, Channel: models.ChannelWebhook, Enabled: false}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	loans := repository.NewLoanRepository(db)
+	if err := loans.MarkPaid(lenderID, paidID); err != nil {
+		t.Fatalf("MarkPaid failed: %v", err)
+	}
+	if _, err := loans.MarkDefaulted(lenderID, []int{overdueID}, time.Now()); err != nil {
+		t.Fatalf("MarkDefaulted failed: %v", err)
+	}
+
+	// Test case 1: The turned-off loan.paid webhook is not posted while loan.defaulted still is
+	d := NewOutboxDispatcher(repository.NewOutboxRepository(db), prefs)
+	if n, err := d.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 delivery, got %d (%v)", n, err)
+	}
+	if len(received) != 1 || received[0] != models.EventLoanDefaulted {
+		t.Errorf("Expected only loan.defaulted posted, got %v", received)
+	}
+
+	// Test case 2: The suppressed event is left undelivered, with the reason, and never retried
+	var lastError string
+	var next sql.NullTime
+	db.QueryRow("SELECT Last_Error, Next_Attempt_At FROM Outbox WHERE Event_Type = ?", models.EventLoanPaid).Scan(&lastError, &next)
+	if lastError != suppressedError || next.Valid {
+		t.Errorf("Expected the event given up as suppressed, got %q, %v", lastError, next)
+	}
+}
+
+func TestOutboxDispatcher_NextAttempt(t *testing.T) {
+	now := time.Now()
+	d := NewOutboxDispatcher(nil, nil)
+	d.now = func() time.Time { return now }
+	d.MaxAttempts = 4
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+		giveUp   bool
+	}{
+		{1, time.Minute, false},
+		{2, 2 * time.Minute, false},
+		{3, 4 * time.Minute, false},
+		{4, 0, true},
+	}
+
+	for _, tt := range tests {
+		next := d.nextAttempt(tt.attempts)
+		if tt.giveUp {
+			if next.Valid {
+				t.Errorf("nextAttempt(%d) = %v, want give up", tt.attempts, next.Time)
+			}
+			continue
+		}
+		if !next.Valid || next.Time.Sub(now) != tt.want {
+			t.Errorf("nextAttempt(%d) = %v, want %v", tt.attempts, next, tt.want)
+		}
+	}
+
+	// Delays are capped at MaxDelay
+	d.MaxAttempts = 100
+	if next := d.nextAttempt(50); next.Time.Sub(now) != DefaultOutboxMaxDelay {
+		t.Errorf("Expected the delay to be capped at %v, got %v", DefaultOutboxMaxDelay, next.Time.Sub(now))
+	}
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+)
+
+// Report mailer defaults. The interval is short enough to catch the first of the month in every
+// time zone.
+const (
+	DefaultReportMailInterval    = time.Hour
+	DefaultReportMailBatchSize   = 20
+	DefaultReportMailBaseDelay   = 15 * time.Minute
+	DefaultReportMailMaxDelay    = 12 * time.Hour
+	DefaultReportMailMaxAttempts = 8
+)
+
+// ReportSubscriptionLister lists the report subscriptions to deliver.
+type ReportSubscriptionLister interface {
+	ListEnabled() ([]models.ReportSubscription, error)
+}
+
+// NotificationStore queues notifications and records the outcome of sending them.
+type NotificationStore interface {
+	Enqueue(n models.Notification, now time.Time) (bool, error)
+	ListDue(kind string, now time.Time, limit int) ([]models.Notification, error)
+	MarkSent(notificationID int, at time.Time) error
+	ScheduleRetry(notificationID int, next sql.NullTime, lastErr string) error
+}
+
+// ReportRenderer renders one of a lender's reports for a YYYY-MM month as a file in format.
+type ReportRenderer interface {
+	RenderReport(lenderID int, report, format, month string) (mailer.Attachment, error)
+}
+
+// ReportMailer emails lenders' month-end reports. On the first day of every month in the lender's
+// time zone it queues one notification per recipient for the month just ended, and then sends
+// due notifications with the reports attached. Failed sends are retried with exponential backoff
+// until MaxAttempts is reached, after which the notification is marked failed for admins to see.
+type ReportMailer struct {
+	Subscriptions ReportSubscriptionLister
+	Notifications NotificationStore
+	Renderer      ReportRenderer
+	Mailer        mailer.Mailer
+	Interval      time.Duration
+	BatchSize     int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	MaxAttempts   int
+	Logger        *slog.Logger
+
+	now func() time.Time
+}
+
+// NewReportMailer creates a new ReportMailer with the default settings.
+func NewReportMailer(subs ReportSubscriptionLister, notifications NotificationStore, renderer ReportRenderer, m mailer.Mailer) *ReportMailer {
+	return &ReportMailer{
+		Subscriptions: subs,
+		Notifications: notifications,
+		Renderer:      renderer,
+		Mailer:        m,
+		Interval:      DefaultReportMailInterval,
+		BatchSize:     DefaultReportMailBatchSize,
+		BaseDelay:     DefaultReportMailBaseDelay,
+		MaxDelay:      DefaultReportMailMaxDelay,
+		MaxAttempts:   DefaultReportMailMaxAttempts,
+		Logger:        slog.Default(),
+		now:           time.Now,
+	}
+}
+
+// RunOnce queues the reports of every lender whose day is the first of a month, then attempts
+// every due notification once and returns how many were sent.
+func (m *ReportMailer) RunOnce(ctx context.Context) (int, error) {
+	if err := m.queue(); err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	due, err := m.Notifications.ListDue(models.NotificationMonthlyReports, now, m.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, n := range due {
+		if err := m.send(ctx, n); err != nil {
+			m.Logger.WarnContext(ctx, "Failed to send reports", "lender_id", n.LenderID, "recipient", n.Recipient, "error", err)
+			if err := m.Notifications.ScheduleRetry(n.NotificationID, m.nextAttempt(n.Attempts+1), err.Error()); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := m.Notifications.MarkSent(n.NotificationID, m.now()); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// queue enqueues one notification per recipient for subscriptions whose lender's day is the first
+// of a month. The payload snapshots the subscription, so retries send what was asked for then.
+func (m *ReportMailer) queue() error {
+	subs, err := m.Subscriptions.ListEnabled()
+	if err != nil {
+		return err
+	}
+	now := m.now()
+	for _, sub := range subs {
+		loc, err := time.LoadLocation(sub.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		local := now.In(loc)
+		if local.Day() != 1 {
+			continue
+		}
+		payload, err := json.Marshal(sub)
+		if err != nil {
+			return err
+		}
+		period := local.AddDate(0, 0, -1).Format("2006-01")
+		for _, recipient := range sub.Recipients {
+			_, err := m.Notifications.Enqueue(models.Notification{
+				LenderID:  sub.LenderID,
+				Kind:      models.NotificationMonthlyReports,
+				Period:    period,
+				Recipient: recipient,
+				Payload:   string(payload),
+			}, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// send renders the notification's reports and emails them to its recipient
+func (m *ReportMailer) send(ctx context.Context, n models.Notification) error {
+	var sub models.ReportSubscription
+	if err := json.Unmarshal([]byte(n.Payload), &sub); err != nil {
+		return err
+	}
+	attachments := make([]mailer.Attachment, 0, len(sub.Reports))
+	for _, report := range sub.Reports {
+		attachment, err := m.Renderer.RenderReport(n.LenderID, report, sub.Format, n.Period)
+		if err != nil {
+			return fmt.Errorf("rendering the %s report: %w", report, err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	subject, body := monthlyReportsEmail(n.Period, sub.Reports)
+	return mailer.SendWithAttachments(ctx, m.Mailer, n.Recipient, subject, body, attachments)
+}
+
+// nextAttempt returns when to retry after the given number of failed attempts, or null to give up.
+func (m *ReportMailer) nextAttempt(attempts int) sql.NullTime {
+	if attempts >= m.MaxAttempts {
+		return sql.NullTime{}
+	}
+	delay := m.BaseDelay << (attempts - 1)
+	if delay <= 0 || delay > m.MaxDelay {
+		delay = m.MaxDelay
+	}
+	return sql.NullTime{Time: m.now().Add(delay), Valid: true}
+}
+
+// monthlyReportsEmail builds the email carrying a month's reports
+func monthlyReportsEmail(period string, reports []string) (subject, body string) {
+	month := period
+	if t, err := time.Parse("2006-01", period); err == nil {
+		month = t.Format("January 2006")
+	}
+	subject = "Your reports for " + month
+	body = fmt.Sprintf("Hello,\n\nAttached are your %s reports for %s.\n", strings.Join(reports, " and "), month)
+	return subject, body
+}
+
+// Start runs the mailer immediately and then on every interval until ctx is cancelled.
+func (m *ReportMailer) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := m.RunOnce(ctx); err != nil {
+			m.Logger.ErrorContext(ctx, "Report mailer failed", "error", err)
+		} else if sent > 0 {
+			m.Logger.InfoContext(ctx, "Report mailer sent emails", "count", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
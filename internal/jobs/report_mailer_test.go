@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fakeRenderer renders every report as a small CSV named after it
+type fakeRenderer struct{}
+
+func (fakeRenderer) RenderReport(lenderID int, report, format, month string) (mailer.Attachment, error) {
+	return mailer.Attachment{Filename: report + "-" + month + "." + format, ContentType: "text/csv", Data: []byte("month\n" + month + "\n")}, nil
+}
+
+// attachmentMailer records what it sends, failing while fail is set
+type attachmentMailer struct {
+	fail error
+	sent map[string][]mailer.Attachment
+}
+
+func (m *attachmentMailer) Send(ctx context.Context, to, subject, body string) error {
+	return m.SendWithAttachments(ctx, to, subject, body, nil)
+}
+
+func (m *attachmentMailer) SendWithAttachments(ctx context.Context, to, subject, body string, attachments []mailer.Attachment) error {
+	if m.fail != nil {
+		return m.fail
+	}
+	m.sent[to+" "+subject] = attachments
+	return nil
+}
+
+func TestReportMailer(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	auth := repository.NewAuthRepository(db)
+	subs := repository.NewReportSubscriptionRepository(db)
+	notifications := repository.NewNotificationRepository(db)
+	lenderIDs := map[string]int{}
+	for _, name := range []string{"maseru", "utc"} {
+		accountID, err := auth.CreateLenderAndAccount(name, name+"@example.com", "123", name, "hash", 5.0, "LSL")
+		if err != nil {
+			t.Fatalf("Failed to seed lender: %v", err)
+		}
+		var lenderID int
+		db.QueryRow("SELECT Lender_ID FROM Accounts WHERE Account_ID = ?", accountID).Scan(&lenderID)
+		lenderIDs[name] = lenderID
+	}
+	db.Exec("UPDATE Lenders SET Timezone = 'Africa/Maseru' WHERE Lender_ID = ?", lenderIDs["maseru"])
+	subs.Upsert(models.ReportSubscription{LenderID: lenderIDs["maseru"], Reports: []string{models.ReportPortfolio, models.ReportIncome},
+		Format: "xlsx", Recipients: []string{"owner@example.com", "accounts@example.com"}, Enabled: true})
+	subs.Upsert(models.ReportSubscription{LenderID: lenderIDs["utc"], Reports: []string{models.ReportIncome},
+		Format: "csv", Recipients: []string{"utc@example.com"}, Enabled: true})
+
+	mail := &attachmentMailer{sent: map[string][]mailer.Attachment{}}
+	m := NewReportMailer(subs, notifications, fakeRenderer{}, mail)
+	// 23:30 UTC on 30 September is already 1 October in Maseru (UTC+2)
+	now := time.Date(2026, 9, 30, 23, 30, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	// Test case 1: Only lenders whose day is the first get the month just ended, one email per recipient
+	sent, err := m.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if sent != 2 || len(mail.sent) != 2 {
+		t.Fatalf("Expected 2 emails, got %d: %v", sent, mail.sent)
+	}
+	attachments := mail.sent["owner@example.com Your reports for September 2026"]
+	if len(attachments) != 2 || attachments[0].Filename != "portfolio-2026-09.xlsx" || attachments[1].Filename != "income-2026-09.xlsx" {
+		t.Errorf("Expected both reports attached, got %+v", attachments)
+	}
+
+	// Test case 2: Later runs the same day send nothing more
+	if sent, _ := m.RunOnce(context.Background()); sent != 0 {
+		t.Errorf("Expected no further emails, got %d", sent)
+	}
+
+	// Test case 3: When the UTC lender's first comes, a failed send is retried with backoff
+	now = now.Add(time.Hour)
+	mail.fail = &mailer.TransientError{Err: errors.New("mailbox busy")}
+	if sent, _ := m.RunOnce(context.Background()); sent != 0 {
+		t.Errorf("Expected the send to fail, got %d sent", sent)
+	}
+	mail.fail = nil
+	now = now.Add(m.BaseDelay - time.Minute)
+	if sent, _ := m.RunOnce(context.Background()); sent != 0 {
+		t.Errorf("Expected no retry before the backoff elapsed, got %d sent", sent)
+	}
+	now = now.Add(time.Minute)
+	if sent, _ := m.RunOnce(context.Background()); sent != 1 || mail.sent["utc@example.com Your reports for September 2026"] == nil {
+		t.Errorf("Expected the retry to send the report, got %d sent", sent)
+	}
+
+	// Test case 4: After MaxAttempts failures the notification is marked failed
+	now = time.Date(2026, 11, 1, 12, 0, 0, 0, time.UTC)
+	mail.fail = errors.New("relay denied")
+	m.MaxAttempts = 2
+	m.RunOnce(context.Background())
+	now = now.Add(m.MaxDelay)
+	m.RunOnce(context.Background())
+	failed, total, err := notifications.List(repository.NotificationFilter{Status: models.NotificationFailed, Limit: 10})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 3 || failed[0].Period != "2026-10" || failed[0].Attempts != 2 || failed[0].LastError.String != "relay denied" {
+		t.Errorf("Expected October's 3 notifications failed after 2 attempts, got %d %+v", total, failed)
+	}
+}
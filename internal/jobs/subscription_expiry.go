@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DefaultExpiryInterval is how often the subscription expiry job runs.
+const DefaultExpiryInterval = time.Hour
+
+// Expirer expires subscriptions whose End_Date has passed.
+type Expirer interface {
+	ExpireDue(ctx context.Context) (int, error)
+}
+
+// SubscriptionExpiry periodically moves ledger rows past their End_Date to expired.
+type SubscriptionExpiry struct {
+	Expirer  Expirer
+	Interval time.Duration
+	Logger   *slog.Logger
+}
+
+// NewSubscriptionExpiry creates a new SubscriptionExpiry job with the default interval.
+func NewSubscriptionExpiry(expirer Expirer) *SubscriptionExpiry {
+	return &SubscriptionExpiry{
+		Expirer:  expirer,
+		Interval: DefaultExpiryInterval,
+		Logger:   slog.Default(),
+	}
+}
+
+// RunOnce expires all due subscriptions, including trials, and returns how many were expired.
+func (j *SubscriptionExpiry) RunOnce(ctx context.Context) (int, error) {
+	return j.Expirer.ExpireDue(ctx)
+}
+
+// Start runs the job immediately and then on every interval until ctx is cancelled.
+func (j *SubscriptionExpiry) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := j.RunOnce(ctx); err != nil {
+			j.Logger.ErrorContext(ctx, "Subscription expiry job failed", "error", err)
+		} else if n > 0 {
+			j.Logger.InfoContext(ctx, "Subscription expiry job expired subscriptions", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeExpirer counts how many times ExpireDue is called.
+type fakeExpirer struct {
+	calls chan struct{}
+}
+
+func (f *fakeExpirer) ExpireDue(ctx context.Context) (int, error) {
+	f.calls <- struct{}{}
+	return 1, nil
+}
+
+func TestSubscriptionExpiry_RunOnce(t *testing.T) {
+	expirer := &fakeExpirer{calls: make(chan struct{}, 1)}
+
+	n, err := NewSubscriptionExpiry(expirer).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 expired subscription, got %d", n)
+	}
+}
+
+func TestSubscriptionExpiry_StartRunsImmediately(t *testing.T) {
+	expirer := &fakeExpirer{calls: make(chan struct{}, 1)}
+	job := NewSubscriptionExpiry(expirer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go job.Start(ctx)
+
+	select {
+	case <-expirer.calls:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the job to run as soon as it started")
+	}
+}
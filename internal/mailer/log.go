@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log writes messages to the application log instead of sending them. Used in development
+// when no SMTP server is configured.
+type Log struct{}
+
+// Send logs the message.
+func (Log) Send(ctx context.Context, to, subject, body string) error {
+	slog.InfoContext(ctx, "Mail", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// SendWithAttachments logs the message and the names and sizes of its attachments.
+func (Log) SendWithAttachments(ctx context.Context, to, subject, body string, attachments []Attachment) error {
+	slog.InfoContext(ctx, "Mail", "to", to, "subject", subject, "body", body)
+	for _, a := range attachments {
+		slog.InfoContext(ctx, "Mail attachment", "filename", a.Filename, "content_type", a.ContentType, "bytes", len(a.Data))
+	}
+	return nil
+}
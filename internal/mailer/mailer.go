@@ -0,0 +1,124 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// Default retry policy used by NewRetrying.
+const (
+	DefaultAttempts  = 3
+	DefaultBaseDelay = time.Second
+)
+
+// Mailer sends a plain-text email.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// Attachment is a file sent along with an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// AttachmentMailer is a Mailer that can also send files.
+type AttachmentMailer interface {
+	Mailer
+	SendWithAttachments(ctx context.Context, to, subject, body string, attachments []Attachment) error
+}
+
+// ErrAttachmentsUnsupported is returned by SendWithAttachments for a Mailer that cannot send files.
+var ErrAttachmentsUnsupported = errors.New("mailer cannot send attachments")
+
+// SendWithAttachments sends the message and its attachments through m when it is an AttachmentMailer.
+func SendWithAttachments(ctx context.Context, m Mailer, to, subject, body string, attachments []Attachment) error {
+	am, ok := m.(AttachmentMailer)
+	if !ok {
+		return ErrAttachmentsUnsupported
+	}
+	return am.SendWithAttachments(ctx, to, subject, body, attachments)
+}
+
+// TransientError marks a send failure that is worth retrying.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "transient mail error: " + e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether a send failure may succeed if retried: network errors,
+// SMTP 4xx replies and errors wrapped in TransientError.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Retrying wraps a Mailer and retries transient failures with exponential backoff.
+type Retrying struct {
+	Mailer    Mailer
+	Attempts  int
+	BaseDelay time.Duration
+}
+
+// NewRetrying creates a new Retrying mailer with the default retry policy.
+func NewRetrying(m Mailer) *Retrying {
+	return &Retrying{
+		Mailer:    m,
+		Attempts:  DefaultAttempts,
+		BaseDelay: DefaultBaseDelay,
+	}
+}
+
+// Send delivers the message, waiting BaseDelay, 2*BaseDelay, ... between attempts.
+// Permanent failures and context cancellation stop retrying immediately.
+func (r *Retrying) Send(ctx context.Context, to, subject, body string) error {
+	return r.retry(ctx, func() error {
+		return r.Mailer.Send(ctx, to, subject, body)
+	})
+}
+
+// SendWithAttachments delivers the message and its attachments with the same retry policy as Send.
+// The wrapped Mailer must be an AttachmentMailer.
+func (r *Retrying) SendWithAttachments(ctx context.Context, to, subject, body string, attachments []Attachment) error {
+	return r.retry(ctx, func() error {
+		return SendWithAttachments(ctx, r.Mailer, to, subject, body, attachments)
+	})
+}
+
+// retry calls send until it succeeds, fails permanently or runs out of attempts
+func (r *Retrying) retry(ctx context.Context, send func() error) error {
+	var err error
+	delay := r.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil || !IsTransient(err) || attempt >= r.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,128 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMailer fails with the queued errors in order, then succeeds.
+type fakeMailer struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeMailer) Send(ctx context.Context, to, subject, body string) error {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"wrapped transient", &TransientError{Err: errors.New("busy")}, true},
+		{"smtp 421", &textproto.Error{Code: 421, Msg: "service not available"}, true},
+		{"smtp 550", &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, false},
+		{"plain error", errors.New("bad address"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetrying_Send(t *testing.T) {
+	transient := &textproto.Error{Code: 451, Msg: "try again later"}
+
+	// Test case 1: Transient failures are retried until success
+	fake := &fakeMailer{errs: []error{transient, transient}}
+	m := &Retrying{Mailer: fake, Attempts: 3, BaseDelay: time.Millisecond}
+	if err := m.Send(context.Background(), "a@example.com", "s", "b"); err != nil {
+		t.Errorf("Expected success after retries, got %v", err)
+	}
+	if fake.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", fake.calls)
+	}
+
+	// Test case 2: Attempts are capped
+	fake = &fakeMailer{errs: []error{transient, transient, transient}}
+	m.Mailer = fake
+	if err := m.Send(context.Background(), "a@example.com", "s", "b"); !errors.Is(err, transient) {
+		t.Errorf("Expected the last transient error, got %v", err)
+	}
+	if fake.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", fake.calls)
+	}
+
+	// Test case 3: Permanent failures are not retried
+	permanent := &textproto.Error{Code: 550, Msg: "no such user"}
+	fake = &fakeMailer{errs: []error{permanent}}
+	m.Mailer = fake
+	if err := m.Send(context.Background(), "a@example.com", "s", "b"); !errors.Is(err, permanent) {
+		t.Errorf("Expected the permanent error, got %v", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", fake.calls)
+	}
+
+	// Test case 4: Cancellation stops the backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake = &fakeMailer{errs: []error{transient}}
+	m = &Retrying{Mailer: fake, Attempts: 3, BaseDelay: time.Hour}
+	if err := m.Send(ctx, "a@example.com", "s", "b"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSendWithAttachments(t *testing.T) {
+	attachments := []Attachment{{Filename: "income-2026-09.csv", ContentType: "text/csv; charset=utf-8", Data: []byte("month,total\n2026-09,100\n")}}
+
+	// Test case 1: Mailers that cannot send files are reported, also through Retrying
+	if err := SendWithAttachments(context.Background(), &fakeMailer{}, "a@example.com", "s", "b", attachments); !errors.Is(err, ErrAttachmentsUnsupported) {
+		t.Errorf("Expected ErrAttachmentsUnsupported, got %v", err)
+	}
+	retrying := NewRetrying(&fakeMailer{})
+	if err := SendWithAttachments(context.Background(), retrying, "a@example.com", "s", "b", attachments); !errors.Is(err, ErrAttachmentsUnsupported) {
+		t.Errorf("Expected ErrAttachmentsUnsupported through Retrying, got %v", err)
+	}
+
+	// Test case 2: SMTP messages carry attachments as base64 parts of a multipart/mixed body
+	m := &SMTP{From: "reports@example.com"}
+	msg, err := m.message("a@example.com", "Reports", "See attached", attachments)
+	if err != nil {
+		t.Fatalf("message failed: %v", err)
+	}
+	for _, want := range []string{
+		"Content-Type: multipart/mixed; boundary=",
+		`Content-Disposition: attachment; filename=income-2026-09.csv`,
+		"Content-Transfer-Encoding: base64",
+		base64.StdEncoding.EncodeToString(attachments[0].Data),
+		"See attached",
+	} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("Expected the message to contain %q:\n%s", want, msg)
+		}
+	}
+
+	// Test case 3: Without attachments the message stays plain text
+	msg, _ = m.message("a@example.com", "Hello", "Body", nil)
+	if !strings.Contains(string(msg), "Content-Type: text/plain; charset=UTF-8\r\n\r\nBody") {
+		t.Errorf("Expected a plain-text message, got:\n%s", msg)
+	}
+}
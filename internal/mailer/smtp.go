@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// SMTP sends mail through an SMTP server using PLAIN auth when a username is set.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers a plain-text message. The context is only checked before connecting
+// because net/smtp does not support cancellation.
+func (m *SMTP) Send(ctx context.Context, to, subject, body string) error {
+	return m.SendWithAttachments(ctx, to, subject, body, nil)
+}
+
+// SendWithAttachments delivers a plain-text message with files attached, as multipart/mixed.
+// Without attachments the message is sent as plain text alone.
+func (m *SMTP) SendWithAttachments(ctx context.Context, to, subject, body string, attachments []Attachment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("mail headers must not contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg, err := m.message(to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	return smtp.SendMail(addr, auth, m.From, []string{to}, msg)
+}
+
+// message builds the RFC 5322 message
+func (m *SMTP) message(to, subject, body string, attachments []Attachment) ([]byte, error) {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n")
+	if len(attachments) == 0 {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n" + body)
+		return msg.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	text, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+	text.Write([]byte(body))
+	for _, a := range attachments {
+		if strings.ContainsAny(a.Filename, "\r\n") {
+			return nil, fmt.Errorf("attachment names must not contain line breaks")
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	msg.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+	msg.Write(parts.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSONTimeLayout is the format of every timestamp in a JSON response: RFC3339 in UTC at second precision.
+const JSONTimeLayout = "2006-01-02T15:04:05Z"
+
+// JSONTime is a time.Time that marshals as JSONTimeLayout instead of RFC3339 with nanoseconds.
+// It embeds time.Time, so its methods are available directly and the Time field where a time.Time
+// is required. It scans from and binds to the database like a time.Time.
+type JSONTime struct {
+	time.Time
+}
+
+// NewJSONTime wraps t.
+func NewJSONTime(t time.Time) JSONTime {
+	return JSONTime{Time: t}
+}
+
+// ParseTime parses a date-only value (YYYY-MM-DD, as midnight UTC) or an RFC3339 timestamp.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a YYYY-MM-DD date nor an RFC3339 timestamp", value)
+	}
+	return t, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UTC().Format(JSONTimeLayout))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting what ParseTime accepts.
+func (t *JSONTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := ParseTime(value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner.
+func (t *JSONTime) Scan(value any) error {
+	var nt sql.NullTime
+	if err := nt.Scan(value); err != nil {
+		return err
+	}
+	t.Time = nt.Time
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (t JSONTime) Value() (driver.Value, error) {
+	return t.Time, nil
+}
+
+// NullTime is a sql.NullTime that marshals as JSONTimeLayout, or null when it is not valid.
+type NullTime struct {
+	sql.NullTime
+}
+
+// NewNullTime wraps t, which is valid unless it is the zero time.
+func NewNullTime(t time.Time) NullTime {
+	return NullTime{sql.NullTime{Time: t, Valid: !t.IsZero()}}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t NullTime) MarshalJSON() ([]byte, error) {
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return NewJSONTime(t.Time).MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting null and what ParseTime accepts.
+func (t *NullTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	}
+	var parsed JSONTime
+	if err := parsed.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	t.Time, t.Valid = parsed.Time, true
+	return nil
+}
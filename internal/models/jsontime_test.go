@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONTime_Marshal(t *testing.T) {
+	maseru := time.FixedZone("SAST", 2*60*60)
+	loan := Loan{
+		StartDate: NewJSONTime(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)),
+		CreatedAt: NewJSONTime(time.Date(2026, 3, 1, 10, 4, 5, 987654321, maseru)),
+	}
+
+	// Test case 1: A loan's timestamps are RFC3339 in UTC at second precision
+	data, err := json.Marshal(loan)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	body := string(data)
+	if !strings.Contains(body, `"start_date":"2026-03-01T00:00:00Z"`) || !strings.Contains(body, `"created_at":"2026-03-01T08:04:05Z"`) {
+		t.Errorf("Unexpected timestamps in %s", body)
+	}
+
+	// Test case 2: Missing nullable times are null, present ones use the same format
+	if !strings.Contains(body, `"end_date":null`) {
+		t.Errorf("Expected a null end_date in %s", body)
+	}
+	loan.EndDate = NewNullTime(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC))
+	data, _ = json.Marshal(loan)
+	if !strings.Contains(string(data), `"end_date":"2026-09-01T00:00:00Z"`) {
+		t.Errorf("Unexpected end_date in %s", data)
+	}
+}
+
+func TestJSONTime_Unmarshal(t *testing.T) {
+	cases := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		// Test case 1: Date-only values are midnight UTC
+		{`"2026-03-01"`, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		// Test case 2: Full timestamps keep their instant, fractions included
+		{`"2026-03-01T10:04:05+02:00"`, time.Date(2026, 3, 1, 8, 4, 5, 0, time.UTC), false},
+		{`"2026-03-01T10:04:05.5Z"`, time.Date(2026, 3, 1, 10, 4, 5, 500000000, time.UTC), false},
+		// Test case 3: Other formats are rejected
+		{`"01/03/2026"`, time.Time{}, true},
+		{`20260301`, time.Time{}, true},
+	}
+	for _, tc := range cases {
+		var got JSONTime
+		err := json.Unmarshal([]byte(tc.input), &got)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tc.input, tc.wantErr, err)
+			continue
+		}
+		if !tc.wantErr && !got.Equal(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.input, tc.want, got.Time)
+		}
+	}
+
+	// Test case 4: null leaves a NullTime invalid
+	var end NullTime
+	if err := json.Unmarshal([]byte("null"), &end); err != nil || end.Valid {
+		t.Errorf("Expected an invalid NullTime, got %+v (%v)", end, err)
+	}
+}
@@ -2,19 +2,33 @@ package models
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
 	"time"
 )
 
 // Lender represents the Lenders table
 type Lender struct {
-	LenderID            int       `json:"lender_id"`
-	BusinessName        string    `json:"business_name"`
-	PhoneNumber         string    `json:"phone_number"`
-	Email               string    `json:"email"`
-	InterestRatePercent float64   `json:"interest_rate_percent"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
-	IsActive            bool      `json:"is_active"` // SQLite stores BOOL as INTEGER, 0 for false, 1 for true
+	LenderID            int      `json:"lender_id"`
+	BusinessName        string   `json:"business_name"`
+	PhoneNumber         string   `json:"phone_number"`
+	Email               string   `json:"email"`
+	InterestRatePercent float64  `json:"interest_rate_percent"`
+	Currency            string   `json:"currency"` // ISO 4217 code of the lender's loan and receipt amounts
+	Timezone            string   `json:"timezone"` // IANA time zone report dates are interpreted in
+	CreatedAt           JSONTime `json:"created_at"`
+	UpdatedAt           JSONTime `json:"updated_at"`
+	IsActive            bool     `json:"is_active"` // SQLite stores BOOL as INTEGER, 0 for false, 1 for true
+
+	LogoFileID sql.NullInt64 `json:"logo_file_id"` // File row holding the lender's current logo
+
+	SuspendedAt      NullTime       `json:"suspended_at"`
+	SuspendedBy      sql.NullString `json:"suspended_by"`
+	SuspensionReason sql.NullString `json:"suspension_reason"`
+
+	WebhookURL sql.NullString `json:"webhook_url"` // Receives outbox events such as EventLoanPaid
 }
 
 // Borrower represents the Borrowers table
@@ -23,44 +37,231 @@ type Borrower struct {
 	Fullnames   string         `json:"fullnames"`
 	Email       string         `json:"email"`
 	PhoneNumber string         `json:"phone_number"`
-	Residence   sql.NullString `json:"residence"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	Residence   sql.NullString `json:"residence"` // Legacy free text; derived from the structured address when one is given
+	CreatedAt   JSONTime       `json:"created_at"`
+	UpdatedAt   JSONTime       `json:"updated_at"`
 	IsActive    bool           `json:"is_active"`
+
+	EmailVerified bool `json:"email_verified"` // Cleared whenever Email changes
+
+	AddressLine1 sql.NullString `json:"address_line1"`
+	City         sql.NullString `json:"city"`
+	Region       sql.NullString `json:"region"`
+	PostalCode   sql.NullString `json:"postal_code"`
+	Country      sql.NullString `json:"country"`
 }
 
 // Account represents the Accounts table
 type Account struct {
-	AccountID    int          `json:"account_id"`
-	LenderID     int          `json:"lender_id"` // Foreign key to Lenders table
-	Username     string       `json:"username"`
-	PasswordHash string       `json:"-"` // Do not expose password hash
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
-	LastLogin    sql.NullTime `json:"last_login"`
-	IsLocked     bool         `json:"is_locked"` // SQLite stores BOOL as INTEGER, 0 for false, 1 for true
+	AccountID    int      `json:"account_id"`
+	LenderID     int      `json:"lender_id"` // Foreign key to Lenders table
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"-"` // Do not expose password hash
+	CreatedAt    JSONTime `json:"created_at"`
+	UpdatedAt    JSONTime `json:"updated_at"`
+	LastLogin    NullTime `json:"last_login"`
+	IsLocked     bool     `json:"is_locked"` // SQLite stores BOOL as INTEGER, 0 for false, 1 for true
+
+	FailedLoginAttempts int      `json:"-"`
+	LockedUntil         NullTime `json:"locked_until"` // Temporary lockout after failed logins; IsLocked is the admin hard lock
+}
+
+// TemporarilyLocked reports whether a failed-login lockout is still in effect at now.
+func (a *Account) TemporarilyLocked(now time.Time) bool {
+	return a.LockedUntil.Valid && a.LockedUntil.Time.After(now)
+}
+
+// AccountStatus is what the auth middleware checks on every request besides the token itself
+type AccountStatus struct {
+	AccountID       int
+	IsLocked        bool
+	TokensRevokedAt sql.NullTime
+	LenderSuspended bool
 }
 
 // Plan represents the Plans table
 type Plan struct {
-	PlanID    int       `json:"plan_id"`
-	Plan      string    `json:"plan"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	IsActive  bool      `json:"is_active"`
+	PlanID    int          `json:"plan_id"`
+	Plan      string       `json:"plan"`
+	Price     float64      `json:"price"` // Deprecated: fallback when no Plan_Prices row exists for a currency
+	IsTrial   bool         `json:"is_trial"`
+	TrialDays int          `json:"trial_days"`
+	Features  PlanFeatures `json:"features"`
+	CreatedAt JSONTime     `json:"created_at"`
+	UpdatedAt JSONTime     `json:"updated_at"`
+	IsActive  bool         `json:"is_active"`
+}
+
+// PlanUpdate is a partial update of a plan; nil fields are left unchanged
+type PlanUpdate struct {
+	Plan      *string  `json:"plan"`
+	Price     *float64 `json:"price"`
+	TrialDays *int     `json:"trial_days"`
+	IsActive  *bool    `json:"is_active"`
+}
+
+// Feature names that can be gated with PlanFeatures.Has
+const (
+	FeaturePDFStatements = "pdf_statements"
+	FeatureWebhooks      = "webhooks"
+	FeatureBulkImport    = "bulk_import"
+)
+
+// PlanFeatures are the feature flags and limits a plan grants, stored as JSON in Plans.Features.
+// A zero limit means unlimited.
+type PlanFeatures struct {
+	PDFStatements   bool    `json:"pdf_statements"`
+	Webhooks        bool    `json:"webhooks"`
+	BulkImport      bool    `json:"bulk_import"`
+	MaxUsers        int     `json:"max_users"`
+	MaxActiveLoans  int     `json:"max_active_loans"`
+	MaxBorrowers    int     `json:"max_borrowers"`
+	MaxLoanAmount   float64 `json:"max_loan_amount"`
+	MaxLoanMonths   int     `json:"max_loan_months"`
+	MaxStorageBytes int64   `json:"max_storage_bytes"` // Total size of the lender's uploaded files
+}
+
+// Has reports whether the named boolean feature is enabled. Unknown names are never enabled.
+func (f PlanFeatures) Has(name string) bool {
+	switch name {
+	case FeaturePDFStatements:
+		return f.PDFStatements
+	case FeatureWebhooks:
+		return f.Webhooks
+	case FeatureBulkImport:
+		return f.BulkImport
+	}
+	return false
+}
+
+// Scan implements sql.Scanner for the JSON Features column.
+func (f *PlanFeatures) Scan(src any) error {
+	*f = PlanFeatures{}
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	}
+	return fmt.Errorf("cannot scan %T into PlanFeatures", src)
+}
+
+// Value implements driver.Valuer, storing the features as JSON.
+func (f PlanFeatures) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// PlanPrice represents the Plan_Prices table
+type PlanPrice struct {
+	PlanPriceID int      `json:"plan_price_id"`
+	PlanID      int      `json:"plan_id"`
+	Currency    string   `json:"currency"`
+	Amount      float64  `json:"amount"`
+	CreatedAt   JSONTime `json:"created_at"`
+	UpdatedAt   JSONTime `json:"updated_at"`
 }
 
 // LenderLedger represents the Lender_Ledger table
 type LenderLedger struct {
-	LedgerID  int          `json:"ledger_id"`
-	LenderID  int          `json:"lender_id"`
-	PlanID    int          `json:"plan_id"`
-	Status    string       `json:"status"`
-	StartDate time.Time    `json:"start_date"`
-	EndDate   sql.NullTime `json:"end_date"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
+	LedgerID        int             `json:"ledger_id"`
+	LenderID        int             `json:"lender_id"`
+	PlanID          int             `json:"plan_id"`
+	Status          string          `json:"status"`
+	StartDate       JSONTime        `json:"start_date"`
+	EndDate         NullTime        `json:"end_date"`
+	ChargedCurrency sql.NullString  `json:"charged_currency"`
+	ChargedAmount   sql.NullFloat64 `json:"charged_amount"`
+	CreatedAt       JSONTime        `json:"created_at"`
+	UpdatedAt       JSONTime        `json:"updated_at"`
+}
+
+// SubscriptionPayment represents the Subscription_Payments table
+type SubscriptionPayment struct {
+	PaymentID  int      `json:"payment_id"`
+	LedgerID   int      `json:"ledger_id"`
+	Amount     float64  `json:"amount"`
+	Currency   string   `json:"currency"`
+	Method     string   `json:"method"`
+	Reference  string   `json:"reference"`
+	PaidAt     JSONTime `json:"paid_at"`
+	RecordedBy string   `json:"recorded_by"`
+	CreatedAt  JSONTime `json:"created_at"`
+}
+
+// SubscriptionEvent represents the Subscription_Events table
+type SubscriptionEvent struct {
+	EventID    int            `json:"event_id"`
+	LedgerID   int            `json:"ledger_id"`
+	FromStatus string         `json:"from_status"`
+	ToStatus   string         `json:"to_status"`
+	Actor      string         `json:"actor"`
+	Reason     sql.NullString `json:"reason"`
+	CreatedAt  JSONTime       `json:"created_at"`
+}
+
+// Subscription represents a lender's most recent Lender_Ledger row joined with its plan
+type Subscription struct {
+	LedgerID        int             `json:"ledger_id"`
+	LenderID        int             `json:"lender_id"`
+	PlanID          int             `json:"plan_id"`
+	PlanName        string          `json:"plan"`
+	Status          string          `json:"status"`
+	IsTrial         bool            `json:"is_trial"`
+	StartDate       JSONTime        `json:"start_date"`
+	EndDate         NullTime        `json:"end_date"`
+	ChargedCurrency sql.NullString  `json:"charged_currency"`
+	ChargedAmount   sql.NullFloat64 `json:"charged_amount"`
+}
+
+// ExpiringSubscription is an active ledger row nearing its End_Date with the lender's contact details
+type ExpiringSubscription struct {
+	LedgerID   int            `json:"ledger_id"`
+	LenderID   int            `json:"lender_id"`
+	PlanName   string         `json:"plan"`
+	IsTrial    bool           `json:"is_trial"`
+	EndDate    JSONTime       `json:"end_date"`
+	Email      string         `json:"email"`
+	WebhookURL sql.NullString `json:"webhook_url"`
+}
+
+// LenderOverview summarises a lender and its current subscription for the admin console
+type LenderOverview struct {
+	LenderID           int            `json:"lender_id"`
+	BusinessName       string         `json:"business_name"`
+	Email              string         `json:"email"`
+	IsActive           bool           `json:"is_active"`
+	SuspendedAt        NullTime       `json:"suspended_at"`
+	CreatedAt          JSONTime       `json:"created_at"`
+	AccountCount       int            `json:"account_count"`
+	ActiveLoanCount    int            `json:"active_loan_count"`
+	PlanID             sql.NullInt64  `json:"plan_id"`
+	PlanName           sql.NullString `json:"plan"`
+	SubscriptionStatus sql.NullString `json:"subscription_status"`
+	SubscriptionEnd    NullTime       `json:"subscription_end"`
+	DaysUntilExpiry    sql.NullInt64  `json:"days_until_expiry"` // Negative once End_Date has passed
+}
+
+// LenderUsage counts what a lender currently uses against its plan's limits
+type LenderUsage struct {
+	Users       int `json:"users"`
+	ActiveLoans int `json:"active_loans"`
+	Borrowers   int `json:"borrowers"` // Active borrowers with a loan from the lender
+}
+
+// LenderDetail extends LenderOverview with contact details and recent activity counts
+type LenderDetail struct {
+	LenderOverview
+	PhoneNumber         string         `json:"phone_number"`
+	InterestRatePercent float64        `json:"interest_rate_percent"`
+	LastLogin           NullTime       `json:"last_login"`
+	LoansByStatus       map[string]int `json:"loans_by_status"`
+	BorrowerCount       int            `json:"borrower_count"`
+	LoansLast30Days     int            `json:"loans_last_30_days"`
+	ReceiptsLast30Days  int            `json:"receipts_last_30_days"`
+	ReceivedLast30Days  float64        `json:"received_last_30_days"` // Sum of paid receipts
 }
 
 // Loan represents the Loans table
@@ -73,17 +274,99 @@ type Loan struct {
 	Amount         float64         `json:"amount"`
 	InterestRate   float64         `json:"interest_rate"` // Note: This is an interest rate for the loan, distinct from Lender's base interest rate
 	MonthlyPayment sql.NullFloat64 `json:"monthly_payment"`
-	StartDate      time.Time       `json:"start_date"`
-	EndDate        sql.NullTime    `json:"end_date"`
-	CreatedAt      time.Time       `json:"created_at"`
-	UpdatedAt      time.Time       `json:"updated_at"`
+	OriginationFee float64         `json:"origination_fee"` // Charged when the loan is made, on top of Amount
+	FeeFinanced    bool            `json:"fee_financed"`    // The fee is amortized with Amount instead of paid upfront
+	TotalCost      float64         `json:"total_cost"`      // Set from Cost when the loan is read
+	StartDate      JSONTime        `json:"start_date"`
+	EndDate        NullTime        `json:"end_date"`
+	CreatedAt      JSONTime        `json:"created_at"`
+	UpdatedAt      JSONTime        `json:"updated_at"`
+}
+
+// Principal is what the instalments amortize: Amount, plus the origination fee when it is financed
+func (l Loan) Principal() float64 {
+	if l.FeeFinanced {
+		return l.Amount + l.OriginationFee
+	}
+	return l.Amount
+}
+
+// Cost is everything the borrower pays over the loan: every instalment, plus the origination fee
+// when it is paid upfront. It is zero until the monthly payment is known.
+func (l Loan) Cost() float64 {
+	cost := l.MonthlyPayment.Float64 * float64(l.MonthsToPay)
+	if !l.FeeFinanced {
+		cost += l.OriginationFee
+	}
+	return math.Round(cost*100) / 100
+}
+
+// Interest is what the instalments pay over the principal. It is zero until the monthly payment is known.
+func (l Loan) Interest() float64 {
+	if !l.MonthlyPayment.Valid {
+		return 0
+	}
+	return math.Round((l.MonthlyPayment.Float64*float64(l.MonthsToPay)-l.Principal())*100) / 100
+}
+
+// LoanStatement is a loan with its borrower and every receipt recorded against it
+type LoanStatement struct {
+	Loan         Loan      `json:"loan"`
+	BorrowerName string    `json:"borrower_name"`
+	Receipts     []Receipt `json:"receipts"`   // Oldest first
+	TotalPaid    float64   `json:"total_paid"` // Sum of the paid receipts
+}
+
+// LoanDefaultResult reports a bulk move of overdue loans to defaulted
+type LoanDefaultResult struct {
+	Defaulted int   `json:"defaulted"`
+	LoanIDs   []int `json:"loan_ids"` // The loans moved to defaulted
+	Skipped   []int `json:"skipped"`  // Requested loans left alone: unknown, not active or not overdue
+}
+
+// Vintage is the cohort of a lender's loans that started in one calendar month, with where those
+// loans stand now. Only issued loans, those active, paid or defaulted, belong to a cohort.
+type Vintage struct {
+	Cohort          string  `json:"cohort"` // YYYY-MM of the loans' start date
+	LoansIssued     int     `json:"loans_issued"`
+	PrincipalIssued float64 `json:"principal_issued"`
+	PaidPct         float64 `json:"paid_pct"`
+	ActivePct       float64 `json:"active_pct"`
+	DefaultedPct    float64 `json:"defaulted_pct"`
+	CollectionRatio float64 `json:"collection_ratio"` // Paid receipts to date over PrincipalIssued
+}
+
+// LoanRecomputation is a loan's monthly payment and end date recomputed from its principal, rate
+// and term, with the figures they replaced
+type LoanRecomputation struct {
+	LoanID                 int             `json:"loan_id"`
+	MonthlyPayment         float64         `json:"monthly_payment"`
+	EndDate                JSONTime        `json:"end_date"`
+	PreviousMonthlyPayment sql.NullFloat64 `json:"previous_monthly_payment"`
+	PreviousEndDate        NullTime        `json:"previous_end_date"`
+	Changed                bool            `json:"changed"`
+}
+
+// DueLoan is an active loan with its next scheduled instalment and the borrower's contact details
+type DueLoan struct {
+	LoanID         int             `json:"loan_id"`
+	Amount         float64         `json:"amount"`
+	MonthlyPayment sql.NullFloat64 `json:"monthly_payment"`
+	StartDate      JSONTime        `json:"start_date"`
+	MonthsToPay    int             `json:"months_to_pay"`
+	NextDueDate    JSONTime        `json:"next_due_date"`
+	BorrowerID     int             `json:"borrower_id"`
+	BorrowerName   string          `json:"borrower_name"`
+	BorrowerEmail  string          `json:"borrower_email"`
+	BorrowerPhone  string          `json:"borrower_phone"`
 }
 
 // Receipt represents the Recipets table
 type Receipt struct {
 	ReceiptID            int            `json:"receipt_id"`
 	LoanID               int            `json:"loan_id"`
-	Timestamp            time.Time      `json:"timestamp"`
+	LenderID             int            `json:"lender_id"` // Denormalized from the loan to scope Transaction_Reference uniqueness
+	Timestamp            JSONTime       `json:"timestamp"`
 	Status               string         `json:"status"`
 	Amount               float64        `json:"amount"`
 	PaymentMethod        sql.NullString `json:"payment_method"`
@@ -99,23 +382,366 @@ type File struct {
 	FileType         sql.NullString `json:"file_type"`
 	FileSize         sql.NullInt64  `json:"file_size"`
 	OriginalFilename sql.NullString `json:"original_filename"`
-	UploadedAt       time.Time      `json:"uploaded_at"`
+	UploadedAt       JSONTime       `json:"uploaded_at"`
+	Purpose          sql.NullString `json:"purpose"`          // e.g. FilePurposeLogo
+	StorageBackend   string         `json:"storage_backend"`  // Backend holding the contents under Value, e.g. "local" or "s3"
+	OriginalFileID   sql.NullInt64  `json:"original_file_id"` // Source image of a resized variant
+	Status           string         `json:"status"`           // FileStatusPendingScan, FileStatusClean or FileStatusInfected
+}
+
+// FileListing is a File row with the number of records that reference it, such as a lender
+// profile using it as its logo. Referenced files should not be deleted without warning.
+type FileListing struct {
+	File
+	References int `json:"references"`
+}
+
+// ExportFile is a file to include in an export, with every record it is attached to
+type ExportFile struct {
+	File  File         `json:"file"`
+	Links []ExportLink `json:"links"`
+}
+
+// ExportLink is a record an exported file is attached to
+type ExportLink struct {
+	Type string `json:"type"` // e.g. FileLinkBorrower
+	ID   int    `json:"id"`
+	Name string `json:"name,omitempty"` // The borrower's full name, for borrowers
+}
+
+// File purposes
+const (
+	FilePurposeLogo         = "logo"          // The lender's logo as served, possibly downscaled
+	FilePurposeLogoOriginal = "logo_original" // The logo as uploaded, kept when it was downscaled
+)
+
+// File statuses. Only clean files are served; infected files are kept, quarantined, for review.
+const (
+	FileStatusPendingScan = "pending_scan"
+	FileStatusClean       = "clean"
+	FileStatusInfected    = "infected"
+)
+
+// Webhook event types written to the Outbox table
+const (
+	EventLoanPaid             = "loan.paid"
+	EventLoanDefaulted        = "loan.defaulted"
+	EventSubscriptionExpiring = "subscription.expiring" // Also emailed, by the expiry notifier
+)
+
+// Channels lenders are notified of events on
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// NotificationChannels lists the channels each event is sent on, in the order preferences are listed
+var NotificationChannels = map[string][]string{
+	EventLoanPaid:             {ChannelWebhook},
+	EventLoanDefaulted:        {ChannelWebhook},
+	EventSubscriptionExpiring: {ChannelEmail, ChannelWebhook},
+}
+
+// NotificationPreference represents the Notification_Preferences table: whether a lender is sent an
+// event on a channel. Events without a stored preference are enabled.
+type NotificationPreference struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+// OutboxEvent represents the Outbox table
+type OutboxEvent struct {
+	OutboxID      int            `json:"outbox_id"`
+	LenderID      int            `json:"lender_id"`
+	EventType     string         `json:"event_type"`
+	Payload       string         `json:"payload"` // JSON body posted to Target
+	Target        string         `json:"target"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt NullTime       `json:"next_attempt_at"`
+	DeliveredAt   NullTime       `json:"delivered_at"`
+	LastError     sql.NullString `json:"last_error"`
+	CreatedAt     JSONTime       `json:"created_at"`
+}
+
+// Reports a ReportSubscription can deliver
+const (
+	ReportPortfolio = "portfolio" // As of the last day of the month
+	ReportIncome    = "income"    // Collections over the month
+)
+
+// ReportSubscription represents the Report_Subscriptions table: the month-end reports a lender has
+// emailed to Recipients on the first of every month, rendered as Format ("csv" or "xlsx")
+type ReportSubscription struct {
+	LenderID   int      `json:"-"`
+	Reports    []string `json:"reports"`
+	Format     string   `json:"format"`
+	Recipients []string `json:"recipients"`
+	Enabled    bool     `json:"enabled"`
+	Timezone   string   `json:"-"` // The lender's, whose months the reports cover
+	UpdatedAt  JSONTime `json:"updated_at"`
+}
+
+// Notification kinds, as recorded in Notifications.Kind
+const (
+	NotificationMonthlyReports    = "monthly_reports"    // Payload holds the ReportSubscription; Period the YYYY-MM month reported
+	NotificationPasswordReset     = "password_reset"     // Payload holds the EmailMessage; Period when it was requested
+	NotificationEmailVerification = "email_verification" // Payload holds the EmailMessage; Period when it was requested
+)
+
+// EmailMessage is the payload of a notification that carries a ready-made email
+type EmailMessage struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notification statuses; failed notifications have used up their retries
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification represents the Notifications table: one email owed to one recipient
+type Notification struct {
+	NotificationID int            `json:"notification_id"`
+	LenderID       int            `json:"lender_id"`
+	Kind           string         `json:"kind"`
+	Period         string         `json:"period"`
+	Recipient      string         `json:"recipient"`
+	Payload        string         `json:"-"` // JSON the job renders the email from
+	Status         string         `json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  NullTime       `json:"next_attempt_at"`
+	SentAt         NullTime       `json:"sent_at"`
+	LastError      sql.NullString `json:"last_error"`
+	CreatedAt      JSONTime       `json:"created_at"`
+}
+
+// LoanBookSnapshot represents a lender's Loan_Book_Snapshot_Totals row for a month, with the
+// Loan_Book_Snapshots rows of its loans. The outstanding amounts total the active loans.
+type LoanBookSnapshot struct {
+	LenderID             int            `json:"lender_id"`
+	Month                string         `json:"month"` // YYYY-MM
+	AsOf                 string         `json:"as_of"` // YYYY-MM-DD, the month's last day
+	Loans                []LoanSnapshot `json:"loans"`
+	OutstandingPrincipal float64        `json:"outstanding_principal"`
+	OutstandingInterest  float64        `json:"outstanding_interest"`
+	OutstandingPenalties float64        `json:"outstanding_penalties"`
+	Portfolio            string         `json:"-"` // JSON of the portfolio report as of AsOf
+	CreatedAt            JSONTime       `json:"created_at"`
+}
+
+// LoanSnapshot is one loan's status and outstanding balance in a LoanBookSnapshot
+type LoanSnapshot struct {
+	LoanID               int     `json:"loan_id"`
+	Status               string  `json:"status"`
+	OutstandingPrincipal float64 `json:"outstanding_principal"`
+	OutstandingInterest  float64 `json:"outstanding_interest"`
+	OutstandingPenalties float64 `json:"outstanding_penalties"`
+}
+
+// AuditEntry represents the Audit_Log table
+type AuditEntry struct {
+	AuditID      int            `json:"audit_id"`
+	LenderID     sql.NullInt64  `json:"lender_id"`
+	Actor        string         `json:"actor"`      // e.g. "account:12", "admin" or "system"
+	AccountID    sql.NullInt64  `json:"account_id"` // Account that made the request, if any
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resource_type"`
+	ResourceID   sql.NullInt64  `json:"resource_id"`
+	Details      sql.NullString `json:"details"` // JSON
+	IPAddress    sql.NullString `json:"ip_address"`
+	CreatedAt    JSONTime       `json:"created_at"`
+}
+
+// Audited actions, as recorded in Audit_Log.Action
+const (
+	AuditFileDeleted     = "file.deleted"
+	AuditFileQuarantined = "file.quarantined" // Details holds the detected signature
+	AuditLenderUpdated   = "lender.updated"   // Details holds the FieldChange of every changed field
+
+	AuditLenderBrandingUpdated = "lender.branding_updated" // Details holds the FieldChange of every changed branding field
+	AuditLoanReassigned        = "loan.reassigned"         // Details holds the FieldChange of borrower_id
+
+	AuditAccountLogin       = "account.login"
+	AuditAccountLoginFailed = "account.login_failed"
+	AuditLenderRegistered   = "lender.registered"
+	AuditLenderSuspended    = "lender.suspended"   // Details holds the reason
+	AuditLenderUnsuspended  = "lender.unsuspended" // Details holds the reason
+	AuditLenderLogoUpdated  = "lender.logo_updated"
+	AuditLenderWebhookSet   = "lender.webhook_set" // Details holds the URL, empty when cleared
+
+	AuditReportSubscriptionSet     = "report_subscription.set" // Details holds the ReportSubscription
+	AuditReportSubscriptionDeleted = "report_subscription.deleted"
+
+	AuditNotificationPreferencesSet = "notification_preferences.set" // Details holds the preferences changed
+
+	AuditBorrowerCreated    = "borrower.created"
+	AuditBorrowerUpdated    = "borrower.updated"
+	AuditBorrowerAnonymized = "borrower.anonymized"
+	AuditBorrowerVerifySent = "borrower.verification_sent"
+	AuditLoanCreated        = "loan.created"
+	AuditLoanPaid           = "loan.paid"
+	AuditLoansRepriced      = "loan.bulk_repriced" // Details holds the new rate, statuses and count
+	AuditLoansDefaulted     = "loan.defaulted"     // One entry per loan; Details holds the as-of date
+	AuditLoanRecomputed     = "loan.recomputed"    // Details holds the LoanRecomputation
+	AuditReceiptCreated     = "receipt.created"
+	AuditFileUploaded       = "file.uploaded"
+	AuditFileAttached       = "file.attached" // Details holds the type and ID of the record
+	AuditFileDetached       = "file.detached" // Details holds the type and ID of the record
+
+	AuditCustomFieldCreated = "custom_field.created"
+	AuditCustomFieldUpdated = "custom_field.updated"
+	AuditCustomFieldDeleted = "custom_field.deleted"
+	AuditCustomValueSet     = "custom_value.set"     // Details holds the name and value
+	AuditCustomValueDeleted = "custom_value.deleted" // Details holds the name
+
+	AuditPlanCreated      = "plan.created"
+	AuditPlanUpdated      = "plan.updated"       // Details holds the PlanUpdate
+	AuditPlanPriceSet     = "plan.price_set"     // Details holds the currency and amount
+	AuditPlanPriceDeleted = "plan.price_deleted" // Details holds the currency
+	AuditPlanFeaturesSet  = "plan.features_set"  // Details holds the PlanFeatures
+
+	AuditSubscriptionPaymentRecorded = "subscription_payment.recorded" // Details holds the months paid for
+	AuditSubscriptionCancelled       = "subscription.cancelled"        // Details holds the reason
+	AuditSubscriptionStatusChanged   = "subscription.status_changed"   // Resource is the ledger row; Details holds from, to and any reason
+)
+
+// LenderProfileUpdate is a partial update of a lender's profile; nil fields are left unchanged
+type LenderProfileUpdate struct {
+	BusinessName        *string  `json:"business_name"`
+	PhoneNumber         *string  `json:"phone_number"`
+	Email               *string  `json:"email"`
+	InterestRatePercent *float64 `json:"interest_rate_percent"`
+	Timezone            *string  `json:"timezone"`
+}
+
+// LenderBranding is how generated documents, such as loan statements and payment receipts,
+// present the lender
+type LenderBranding struct {
+	LogoFileID         sql.NullInt64 `json:"logo_file_id"`  // Image shown on documents; the profile logo when unset
+	PrimaryColor       string        `json:"primary_color"` // Accent colour as #RRGGBB; empty for the default
+	FooterText         string        `json:"footer_text"`   // Printed at the bottom of every page
+	ShowContactDetails bool          `json:"show_contact_details"`
+}
+
+// FieldChange is the before and after value of one changed field
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// LenderChange is one audited update of a lender's profile, keyed by the JSON name of each changed field
+type LenderChange struct {
+	AuditID   int                    `json:"audit_id"`
+	Actor     string                 `json:"actor"`
+	Changes   map[string]FieldChange `json:"changes"`
+	ChangedAt JSONTime               `json:"changed_at"`
+}
+
+// FileReference is a record that points at a File row, such as the lender profile using it as a logo
+type FileReference struct {
+	Type string `json:"type"` // e.g. FileReferenceLenderLogo
+	ID   int    `json:"id"`
 }
 
-// Text represents the Text table
+// FileReferenceLenderLogo is a lender profile whose logo is the file; its ID is the lender's
+const FileReferenceLenderLogo = "lender_logo"
+
+// FileReferenceLenderBrandingLogo is a lender's document branding whose logo is the file; its ID is the lender's
+const FileReferenceLenderBrandingLogo = "lender_branding_logo"
+
+// FileReferenceFileVariant is a resized variant, such as a downscaled logo, of the file; its ID is the variant's File_ID
+const FileReferenceFileVariant = "file_variant"
+
+// Records a file can be attached to. An attachment is also a reference of the same type to the
+// file, with the record's ID.
+const (
+	FileLinkBorrower = "borrower"
+	FileLinkLoan     = "loan"
+	FileLinkReceipt  = "receipt"
+)
+
+// FileAttachment links one of a lender's files to one of its borrowers, loans or receipts
+type FileAttachment struct {
+	FileID     int      `json:"file_id"`
+	Type       string   `json:"type"` // e.g. FileLinkBorrower
+	ID         int      `json:"id"`
+	AttachedAt JSONTime `json:"attached_at"`
+}
+
+// Text represents the Text table, a lender's named text custom values
 type Text struct {
-	TextID    int       `json:"text_id"`
-	LenderID  int       `json:"lender_id"`
-	Value     string    `json:"value"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	TextID     int            `json:"text_id"`
+	LenderID   int            `json:"lender_id"`
+	FieldName  string         `json:"field_name"` // Unique per lender across Text and Number
+	FieldGroup sql.NullString `json:"field_group"`
+	Value      string         `json:"value"`
+	CreatedAt  JSONTime       `json:"created_at"`
+	UpdatedAt  JSONTime       `json:"updated_at"`
 }
 
-// Number represents the Number table
+// Number represents the Number table, a lender's named numeric custom values
 type Number struct {
-	NumberID  int       `json:"number_id"`
-	LenderID  int       `json:"lender_id"`
-	Value     float64   `json:"value"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
\ No newline at end of file
+	NumberID   int            `json:"number_id"`
+	LenderID   int            `json:"lender_id"`
+	FieldName  string         `json:"field_name"` // Unique per lender across Text and Number
+	FieldGroup sql.NullString `json:"field_group"`
+	Value      float64        `json:"value"`
+	CreatedAt  JSONTime       `json:"created_at"`
+	UpdatedAt  JSONTime       `json:"updated_at"`
+}
+
+// Custom value types, naming the table a CustomValue is stored in
+const (
+	CustomValueText   = "text"
+	CustomValueNumber = "number"
+)
+
+// CustomFieldDefinition is a lender-defined extra field on borrowers or loans
+type CustomFieldDefinition struct {
+	DefinitionID int      `json:"definition_id"`
+	LenderID     int      `json:"lender_id"`
+	Entity       string   `json:"entity"` // CustomFieldEntityBorrower or CustomFieldEntityLoan
+	Name         string   `json:"name"`
+	FieldType    string   `json:"type"` // One of the CustomFieldType constants
+	Required     bool     `json:"required"`
+	CreatedAt    JSONTime `json:"created_at"`
+	UpdatedAt    JSONTime `json:"updated_at"`
+}
+
+// Entities a custom field can be defined on
+const (
+	CustomFieldEntityBorrower = "borrower"
+	CustomFieldEntityLoan     = "loan"
+)
+
+// Custom field types; date values are "YYYY-MM-DD" strings
+const (
+	CustomFieldTypeText   = "text"
+	CustomFieldTypeNumber = "number"
+	CustomFieldTypeDate   = "date"
+	CustomFieldTypeBool   = "bool"
+)
+
+// SettingMaxActiveLoansPerBorrower is the Number custom value capping how many active loans one
+// borrower can hold with the lender; zero or unset means unlimited
+const SettingMaxActiveLoansPerBorrower = "max_active_loans_per_borrower"
+
+// SettingFinanceOriginationFee is the Number custom value that, when 1, adds new loans' origination
+// fees to the principal their instalments amortize; zero or unset means the fee is paid upfront
+const SettingFinanceOriginationFee = "finance_origination_fee"
+
+// SettingMaxBorrowerExposure is the Number custom value above which one borrower's outstanding
+// principal is flagged by the concentration report; zero or unset means no limit
+const SettingMaxBorrowerExposure = "max_borrower_exposure"
+
+// CustomValue is a named Text or Number row; Value is a string or a float64 according to Type
+type CustomValue struct {
+	Name      string         `json:"name"`
+	Group     sql.NullString `json:"group"`
+	Type      string         `json:"type"`
+	Value     any            `json:"value"`
+	UpdatedAt JSONTime       `json:"updated_at"`
+}
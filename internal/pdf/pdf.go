@@ -0,0 +1,408 @@
+// Package pdf renders lender documents, such as loan statements and payment receipts, as PDF files.
+// Only the standard Helvetica fonts are used, so no font files have to be embedded, and page
+// content is left uncompressed.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+
+	"wisetech-lms-api/internal/imaging"
+)
+
+// A4 page size and margins, in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+)
+
+// Header layout: the logo box at the top left, the accent rule under it and the title below that
+const (
+	logoHeight   = 48.0
+	logoMaxWidth = 144.0
+	ruleY        = pageHeight - margin - logoHeight - 12
+	titleY       = ruleY - 28
+	bodyTop      = titleY - 30
+)
+
+// logoMaxPixels bounds the logo's longer side before embedding; documents print it at most 2in wide
+const logoMaxPixels = 300
+
+// bodySize and bodyLeading are the font size and line height of body text
+const (
+	bodySize    = 10.0
+	bodyLeading = 15.0
+)
+
+// footerSize is the font size of the footer text and page numbers
+const footerSize = 8.0
+
+// DefaultColor is the accent colour used when the branding does not set one
+var DefaultColor = color.RGBA{R: 0x1F, G: 0x29, B: 0x37, A: 0xFF}
+
+// Branding is how the issuing lender is presented on every page of a document
+type Branding struct {
+	BusinessName string
+	Contact      []string    // Lines shown under the business name; empty to leave them out
+	Color        color.RGBA  // Accent of the business name, headings and header rule; zero for DefaultColor
+	Logo         image.Image // Drawn at the top left when set
+	Footer       string      // Printed at the bottom of every page
+}
+
+// Document is a PDF being assembled. Content is laid out top to bottom and flows onto new pages
+// as needed; nothing is rendered until Bytes is called.
+type Document struct {
+	title  string
+	brand  Branding
+	blocks []func(p *pager)
+}
+
+// New starts a document with the given title, presented with brand.
+func New(title string, brand Branding) *Document {
+	if brand.Color == (color.RGBA{}) {
+		brand.Color = DefaultColor
+	}
+	return &Document{title: title, brand: brand}
+}
+
+// Heading adds a section heading in the accent colour.
+func (d *Document) Heading(text string) {
+	d.blocks = append(d.blocks, func(p *pager) {
+		p.need(bodyLeading * 2.5)
+		p.y -= bodyLeading / 2
+		p.text(fontBold, 12, margin, p.y, text, &d.brand.Color)
+		p.y -= bodyLeading * 1.5
+	})
+}
+
+// Field adds a label and its value on one line. Long values wrap under the value column, and an
+// empty value leaves the label on its own.
+func (d *Document) Field(label, value string) {
+	d.blocks = append(d.blocks, func(p *pager) {
+		lines := wrap(value, 60)
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		for i, line := range lines {
+			p.need(bodyLeading)
+			if i == 0 {
+				p.text(fontBold, bodySize, margin, p.y, label, nil)
+			}
+			p.text(fontRegular, bodySize, margin+160, p.y, line, nil)
+			p.y -= bodyLeading
+		}
+	})
+}
+
+// Table adds rows under a bold header row, in equally wide columns. The header is repeated when
+// the table continues on a new page.
+func (d *Document) Table(header []string, rows [][]string) {
+	d.blocks = append(d.blocks, func(p *pager) {
+		width := (pageWidth - 2*margin) / float64(max(len(header), 1))
+		row := func(font string, cells []string) {
+			for i, cell := range cells {
+				p.text(font, bodySize, margin+float64(i)*width, p.y, truncate(cell, int(width/5)), nil)
+			}
+			p.y -= bodyLeading
+		}
+
+		p.need(bodyLeading * 2)
+		row(fontBold, header)
+		for _, cells := range rows {
+			if p.y-bodyLeading < p.bottom {
+				p.newPage()
+				row(fontBold, header)
+			}
+			row(fontRegular, cells)
+		}
+	})
+}
+
+// PageBreak continues the document on a new page, unless nothing has been added to the current one.
+func (d *Document) PageBreak() {
+	d.blocks = append(d.blocks, func(p *pager) {
+		if p.y < bodyTop {
+			p.newPage()
+		}
+	})
+}
+
+// Bytes lays the document out and returns it as a PDF file.
+func (d *Document) Bytes() ([]byte, error) {
+	var logo *logoImage
+	if d.brand.Logo != nil {
+		var err error
+		if logo, err = encodeLogo(d.brand.Logo); err != nil {
+			return nil, err
+		}
+	}
+
+	footer := wrap(d.brand.Footer, 110)
+	p := &pager{doc: d, logo: logo, bottom: margin + float64(len(footer)+1)*(footerSize+3) + bodyLeading}
+	p.newPage()
+	for _, block := range d.blocks {
+		block(p)
+	}
+
+	// Page numbers need the page count, so footers are drawn once the layout is done
+	for i, page := range p.pages {
+		y := margin - 20
+		p.page = page
+		p.text(fontRegular, footerSize, margin, y, fmt.Sprintf("Page %d of %d", i+1, len(p.pages)), nil)
+		for j := len(footer) - 1; j >= 0; j-- {
+			y += footerSize + 3
+			p.text(fontRegular, footerSize, margin, y, footer[j], nil)
+		}
+	}
+	return d.write(p.pages, logo), nil
+}
+
+// Font resource names, as referenced from page content
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// pager tracks the page being filled and the vertical position on it
+type pager struct {
+	doc    *Document
+	logo   *logoImage
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+	y      float64
+	bottom float64 // Lowest baseline body text may use, above the footer
+}
+
+// newPage starts a page with the branded header and moves to the top of its body
+func (p *pager) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	brand := p.doc.brand
+
+	x := margin
+	if p.logo != nil {
+		w, h := p.logo.size()
+		fmt.Fprintf(p.page, "q %s 0 0 %s %s %s cm /Im1 Do Q\n", num(w), num(h), num(margin), num(ruleY+12+logoHeight-h))
+		x += w + 14
+	}
+	y := pageHeight - margin - 14
+	p.text(fontBold, 16, x, y, brand.BusinessName, &brand.Color)
+	for _, line := range brand.Contact {
+		y -= 11
+		p.text(fontRegular, 9, x, y, line, nil)
+	}
+	fmt.Fprintf(p.page, "%s rg %s %s %s 2 re f 0 g\n", rgb(brand.Color), num(margin), num(ruleY), num(pageWidth-2*margin))
+	p.text(fontBold, 14, margin, titleY, p.doc.title, nil)
+	p.y = bodyTop
+}
+
+// need starts a new page unless height fits above the footer
+func (p *pager) need(height float64) {
+	if p.y-height < p.bottom {
+		p.newPage()
+	}
+}
+
+// text draws s with its baseline at x, y, in c or black when c is nil
+func (p *pager) text(font string, size, x, y float64, s string, c *color.RGBA) {
+	if s == "" {
+		return
+	}
+	if c != nil {
+		fmt.Fprintf(p.page, "%s rg ", rgb(*c))
+	}
+	fmt.Fprintf(p.page, "BT /%s %s Tf %s %s Td (%s) Tj ET", font, num(size), num(x), num(y), escape(s))
+	if c != nil {
+		p.page.WriteString(" 0 g")
+	}
+	p.page.WriteByte('\n')
+}
+
+// logoImage is a logo flattened onto white and deflated as 8-bit RGB
+type logoImage struct {
+	width, height int
+	data          []byte
+}
+
+// size returns the printed size of the logo, fitting logoMaxWidth x logoHeight
+func (l *logoImage) size() (w, h float64) {
+	w, h = logoHeight*float64(l.width)/float64(l.height), logoHeight
+	if w > logoMaxWidth {
+		w, h = logoMaxWidth, logoMaxWidth*float64(l.height)/float64(l.width)
+	}
+	return w, h
+}
+
+// encodeLogo downscales img and converts it to a PDF image. Transparent areas are composited
+// onto white, as PDF images without a soft mask are opaque.
+func encodeLogo(img image.Image) (*logoImage, error) {
+	img = imaging.Fit(img, logoMaxPixels)
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("pdf: logo has no pixels")
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 0, b.Dx()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row = row[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			white := 0xFFFF - a
+			row = append(row, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &logoImage{width: b.Dx(), height: b.Dy(), data: buf.Bytes()}, nil
+}
+
+// write serializes the pages into a PDF file: catalog, page tree, fonts, the optional logo, then a
+// page object and content stream per page, followed by the cross-reference table
+func (d *Document) write(pages []*bytes.Buffer, logo *logoImage) []byte {
+	const catalog, pageTree, regular, bold = 1, 2, 3, 4
+	first := 5
+	if logo != nil {
+		first = 6
+	}
+	count := first + 2*len(pages) // Next free object number; the info dictionary takes it
+
+	var out bytes.Buffer
+	offsets := make([]int, 0, count)
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		out.Write(data)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	object(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pageTree))
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", first+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	resources := fmt.Sprintf("/Font << /%s %d 0 R /%s %d 0 R >>", fontRegular, regular, fontBold, bold)
+	if logo != nil {
+		stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+			logo.width, logo.height), logo.data)
+		resources += " /XObject << /Im1 5 0 R >>"
+	}
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << %s >> /Contents %d 0 R >>",
+			pageTree, num(pageWidth), num(pageHeight), resources, first+2*i+1))
+		stream("", page.Bytes())
+	}
+	object(fmt.Sprintf("<< /Title (%s) /Author (%s) /Producer (WiseTech LMS) >>", escape(d.title), escape(d.brand.BusinessName)))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, catalog, len(offsets), xref)
+	return out.Bytes()
+}
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding places in 0x80-0x9F
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// escape encodes s as the body of a PDF literal string in WinAnsiEncoding. Characters the standard
+// fonts cannot show are replaced with '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		var c byte
+		switch mapped, ok := winAnsi[r]; {
+		case ok:
+			c = mapped
+		case r == utf8.RuneError, r > 0xFF, r >= 0x80 && r < 0xA0:
+			c = '?'
+		default:
+			c = byte(r)
+		}
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7F:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// wrap breaks s into lines of at most width characters at spaces; longer words are split
+func wrap(s string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n || n < 1 {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// num formats a coordinate or size with at most two decimals
+func num(v float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", v), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// rgb formats c as the operands of the rg operator
+func rgb(c color.RGBA) string {
+	return fmt.Sprintf("%s %s %s", num(float64(c.R)/255), num(float64(c.G)/255), num(float64(c.B)/255))
+}
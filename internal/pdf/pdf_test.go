@@ -0,0 +1,184 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkStructure verifies the file header, trailer and that every cross-reference entry points
+// at its object
+func checkStructure(t *testing.T, data []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("Expected a PDF header and trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("Expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("Expected xref entries")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("xref entry %d does not point at %q", i+1, want)
+		}
+	}
+}
+
+func TestDocument_Branding(t *testing.T) {
+	doc := New("Loan statement", Branding{
+		BusinessName: "Maseru Micro (Pty) Ltd",
+		Contact:      []string{"+266 2231 0000", "accounts@maseru.example"},
+		Color:        color.RGBA{R: 0xFF, G: 0x66, B: 0x00, A: 0xFF},
+		Footer:       "Registered credit provider NCR-1234. Thank you for your business.",
+	})
+	doc.Heading("Loan")
+	doc.Field("Amount", "LSL 1,000.00")
+	doc.Table([]string{"Date", "Amount"}, [][]string{{"2026-01-01", "100.00"}})
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	checkStructure(t, data)
+
+	// Test case 1: The branding strings and colour are in the page content
+	for _, want := range []string{
+		`(Maseru Micro \(Pty\) Ltd) Tj`,
+		"(+266 2231 0000) Tj",
+		"(accounts@maseru.example) Tj",
+		"(Registered credit provider NCR-1234. Thank you for your business.) Tj",
+		"1 0.4 0 rg",
+		"(Loan statement) Tj",
+		"(LSL 1,000.00) Tj",
+		"(Page 1 of 1) Tj",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("Expected %q in the document", want)
+		}
+	}
+	if bytes.Contains(data, []byte("/Im1")) {
+		t.Error("Expected no logo image without a logo")
+	}
+
+	// Test case 2: Hidden contact details and an unset colour fall back to the default accent
+	data, _ = New("Receipt", Branding{BusinessName: "Plain"}).Bytes()
+	if !bytes.Contains(data, []byte("0.12 0.16 0.22 rg")) {
+		t.Error("Expected the default accent colour")
+	}
+	if bytes.Contains(data, []byte("accounts@maseru.example")) {
+		t.Error("Expected no contact details")
+	}
+}
+
+func TestDocument_LogoAndPages(t *testing.T) {
+	logo := image.NewNRGBA(image.Rect(0, 0, 600, 200))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0x80
+	}
+	doc := New("Loan statement", Branding{BusinessName: "Logo Lender", Logo: logo, Footer: "Footer line"})
+	rows := make([][]string, 120)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i + 1), "paid"}
+	}
+	doc.Table([]string{"No.", "Status"}, rows)
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	checkStructure(t, data)
+
+	// Test case 1: The logo is embedded once, downscaled, and drawn on every page
+	if n := bytes.Count(data, []byte("/Subtype /Image")); n != 1 {
+		t.Errorf("Expected one embedded image, got %d", n)
+	}
+	if !bytes.Contains(data, []byte("/Width 300 /Height 100")) {
+		t.Error("Expected the logo downscaled to 300x100")
+	}
+
+	// Test case 2: The table flows onto further pages, each with the header, footer and page count
+	pages := bytes.Count(data, []byte("/Type /Page /Parent"))
+	if pages < 2 {
+		t.Fatalf("Expected several pages, got %d", pages)
+	}
+	for _, want := range []string{"/Im1 Do", "(Logo Lender) Tj", "(Footer line) Tj", "(No.) Tj"} {
+		if n := bytes.Count(data, []byte(want)); n != pages {
+			t.Errorf("Expected %q on each of %d pages, got %d", want, pages, n)
+		}
+	}
+	if !bytes.Contains(data, []byte(fmt.Sprintf("(Page %d of %d) Tj", pages, pages))) {
+		t.Errorf("Expected the last page to be numbered %d of %d", pages, pages)
+	}
+	if !bytes.Contains(data, []byte("(120) Tj")) {
+		t.Error("Expected the last row")
+	}
+}
+
+func TestDocument_PageBreak(t *testing.T) {
+	doc := New("Payment receipts", Branding{BusinessName: "Breaks"})
+	doc.PageBreak()
+	doc.Field("Receipt number", "1")
+	doc.PageBreak()
+	doc.PageBreak()
+	doc.Field("Receipt number", "2")
+	doc.Field("No payments recorded", "")
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	checkStructure(t, data)
+
+	// Test case 1: Breaks start a page only after content, so no page is left blank
+	if pages := bytes.Count(data, []byte("/Type /Page /Parent")); pages != 2 {
+		t.Errorf("Expected 2 pages, got %d", pages)
+	}
+	if !bytes.Contains(data, []byte("(Page 2 of 2) Tj")) {
+		t.Error("Expected the second page to be numbered 2 of 2")
+	}
+
+	// Test case 2: A field without a value still shows its label
+	if !bytes.Contains(data, []byte("(No payments recorded) Tj")) {
+		t.Error("Expected the label of an empty field")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := map[string]string{
+		`a (b) \c`:  `a \(b\) \\c`,
+		"Café":      `Caf\351`,
+		"€5 – ok":   `\2005 \226 ok`,
+		"日本":        "??",
+		"tab\there": `tab\011here`,
+	}
+	for in, want := range tests {
+		if got := escape(in); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := wrap("the quick brown fox jumps over\nthe lazy dog abcdefghijkl", 10)
+	want := []string{"the quick", "brown fox", "jumps over", "the lazy", "dog", "abcdefghij", "kl"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("wrap = %q, want %q", got, want)
+	}
+	if lines := wrap("", 10); len(lines) != 0 {
+		t.Errorf("Expected no lines for empty text, got %q", lines)
+	}
+}
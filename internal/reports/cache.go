@@ -0,0 +1,107 @@
+package reports
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a cached report is served when no TTL is configured
+const DefaultCacheTTL = 30 * time.Second
+
+// cached is a report and when it stops being fresh
+type cached struct {
+	report  any
+	expires time.Time
+}
+
+// Cache keeps computed reports for a short TTL, per lender, under a key naming the report and
+// its parameters. Invalidate a lender whenever its loans or receipts change, so a report never
+// outlives the data behind it; the TTL bounds staleness from anything else, such as the day
+// rolling over. A nil Cache caches nothing.
+type Cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[int]map[string]cached
+}
+
+// NewCache creates a new Cache; a ttl of 0 uses DefaultCacheTTL
+func NewCache(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[int]map[string]cached),
+	}
+}
+
+// CacheKey builds a cache key from a report's endpoint and query parameters, which are sorted so
+// the same parameters in any order share an entry
+func CacheKey(endpoint string, params url.Values) string {
+	if len(params) == 0 {
+		return endpoint
+	}
+	return endpoint + "?" + params.Encode()
+}
+
+// Get returns the lender's fresh report under key. Cached reports are shared between callers,
+// which must not modify them.
+func (c *Cache) Get(lenderID int, key string) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[lenderID][key]
+	if !ok || !c.now().Before(e.expires) {
+		return nil, false
+	}
+	return e.report, true
+}
+
+// Set caches the lender's report under key for the TTL, dropping the lender's stale entries
+func (c *Cache) Set(lenderID int, key string, report any) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	entries := c.entries[lenderID]
+	if entries == nil {
+		entries = make(map[string]cached)
+		c.entries[lenderID] = entries
+	}
+	for k, e := range entries {
+		if !now.Before(e.expires) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = cached{report: report, expires: now.Add(c.ttl)}
+}
+
+// Invalidate drops every cached report of one lender, and the platform-wide reports cached under
+// AllLenders that include it
+func (c *Cache) Invalidate(lenderID int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, lenderID)
+	delete(c.entries, AllLenders)
+	c.mu.Unlock()
+}
+
+// InvalidateAll drops every cached report
+func (c *Cache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries = make(map[int]map[string]cached)
+	c.mu.Unlock()
+}
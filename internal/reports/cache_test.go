@@ -0,0 +1,59 @@
+package reports
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(0)
+	cache.now = func() time.Time { return now }
+	key := CacheKey("/api/reports/portfolio", url.Values{"b": {"2"}, "a": {"1"}})
+
+	// Test case 1: Keys sort their parameters, and a cached report is served until it expires
+	if key != "/api/reports/portfolio?a=1&b=2" {
+		t.Errorf("Unexpected key %q", key)
+	}
+	if _, ok := cache.Get(1, key); ok {
+		t.Error("Expected a miss on an empty cache")
+	}
+	cache.Set(1, key, "report")
+	if report, ok := cache.Get(1, key); !ok || report != "report" {
+		t.Errorf("Expected a hit, got %v, %v", report, ok)
+	}
+	if _, ok := cache.Get(2, key); ok {
+		t.Error("Expected lenders not to share entries")
+	}
+	now = now.Add(DefaultCacheTTL)
+	if _, ok := cache.Get(1, key); ok {
+		t.Error("Expected the entry to expire after the TTL")
+	}
+
+	// Test case 2: Invalidation drops one lender's reports with the platform's, or everyone's
+	cache.Set(1, key, "report")
+	cache.Set(2, key, "report")
+	cache.Set(AllLenders, key, "report")
+	cache.Invalidate(1)
+	if _, ok := cache.Get(1, key); ok {
+		t.Error("Expected lender 1 to be invalidated")
+	}
+	if _, ok := cache.Get(AllLenders, key); ok {
+		t.Error("Expected the platform-wide reports to be invalidated with lender 1")
+	}
+	if _, ok := cache.Get(2, key); !ok {
+		t.Error("Expected lender 2 to stay cached")
+	}
+	cache.InvalidateAll()
+	if _, ok := cache.Get(2, key); ok {
+		t.Error("Expected every lender to be invalidated")
+	}
+
+	// Test case 3: A nil cache caches nothing
+	var disabled *Cache
+	disabled.Set(1, key, "report")
+	if _, ok := disabled.Get(1, key); ok {
+		t.Error("Expected a nil cache to miss")
+	}
+}
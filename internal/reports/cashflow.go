@@ -0,0 +1,129 @@
+package reports
+
+import (
+	"database/sql"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// CollectionRateMonths is how far back the collection rate discounting a cash flow projection looks
+const CollectionRateMonths = 6
+
+// CashflowProjection is what a lender's active loans are scheduled to pay in the coming months: the
+// unpaid part of each instalment, gross and discounted by the lender's collection rate. Payments are
+// applied to a loan's instalments in order, so a partly paid instalment projects what is left of it.
+// Instalments due before the projection's first day are arrears, reported apart from the months.
+type CashflowProjection struct {
+	From             string           `json:"from"` // YYYY-MM
+	To               string           `json:"to"`   // YYYY-MM, inclusive
+	Adjusted         bool             `json:"adjusted"`
+	HistoryFrom      string           `json:"history_from,omitempty"` // YYYY-MM-DD, the first day the collection rate covers
+	HistoryTo        string           `json:"history_to,omitempty"`   // YYYY-MM-DD, inclusive
+	HistoryExpected  float64          `json:"history_expected"`       // Instalments due over the history days
+	HistoryCollected float64          `json:"history_collected"`      // Allocated receipts recorded over them
+	CollectionRate   float64          `json:"collection_rate"`        // Percentage applied to gross figures; 100 when not adjusted or without history
+	Arrears          float64          `json:"arrears"`                // Unpaid instalments already due
+	Months           []ProjectedMonth `json:"months"`
+	Gross            float64          `json:"gross"`
+	RiskAdjusted     float64          `json:"risk_adjusted"`
+}
+
+// ProjectedMonth is one calendar month of a CashflowProjection
+type ProjectedMonth struct {
+	Month        string  `json:"month"`       // YYYY-MM
+	Instalments  int     `json:"instalments"` // Instalments with something left to pay falling due in the month
+	Gross        float64 `json:"gross"`
+	RiskAdjusted float64 `json:"risk_adjusted"`
+}
+
+// CashflowProjection projects the unpaid instalments of the lender's active loans falling due from
+// today, a midnight in the lender's location, over the given number of calendar months starting with
+// today's. Pending, paid, defaulted and cancelled loans are left out. When adjust is set, each month
+// is discounted by the share of what was expected that was collected over the last
+// CollectionRateMonths months up to yesterday, as reported by CollectionsVsExpected, capped at 100%.
+func (r *Reporter) CashflowProjection(lenderID int, today time.Time, months int, adjust bool) (*CashflowProjection, error) {
+	today = startOfDay(today)
+	start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	end := start.AddDate(0, months, 0)
+	report := &CashflowProjection{
+		From:           start.Format("2006-01"),
+		To:             end.AddDate(0, -1, 0).Format("2006-01"),
+		Adjusted:       adjust,
+		CollectionRate: 100,
+		Months:         make([]ProjectedMonth, months),
+	}
+	index := make(map[string]int, months)
+	for i := range report.Months {
+		month := start.AddDate(0, i, 0).Format("2006-01")
+		report.Months[i].Month = month
+		index[month] = i
+	}
+
+	if adjust {
+		from, to := today.AddDate(0, -CollectionRateMonths, 0), today.AddDate(0, 0, -1)
+		history, err := r.CollectionsVsExpected(lenderID, from, to, GranularityWeek)
+		if err != nil {
+			return nil, err
+		}
+		report.HistoryFrom, report.HistoryTo = history.From, history.To
+		if n := len(history.Buckets); n > 0 {
+			last := history.Buckets[n-1]
+			report.HistoryExpected, report.HistoryCollected = last.CumulativeExpected, last.CumulativeCollected
+		}
+		if report.HistoryExpected > 0 {
+			report.CollectionRate = min(percentOf(report.HistoryCollected, report.HistoryExpected), 100)
+		}
+	}
+
+	rows, err := r.db.Query(`SELECT lo.Amount, lo.Interest_Rate, lo.Months_To_Pay, lo.Monthly_Payment, lo.Start_Date,
+			COALESCE((SELECT SUM(Amount) FROM Recipets WHERE Loan_ID = lo.Loan_ID AND Status = 'paid'), 0)
+		FROM Loans lo WHERE lo.Lender_ID = ? AND lo.Payment_Status = 'active'`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	first := today.Format(time.DateOnly)
+	var arrears float64
+	gross := make([]float64, months)
+	for rows.Next() {
+		var amount, rate, paid float64
+		var term int
+		var payment sql.NullFloat64
+		var loanStart time.Time
+		if err := rows.Scan(&amount, &rate, &term, &payment, &loanStart, &paid); err != nil {
+			return nil, err
+		}
+		instalment := finance.Instalment(payment, amount, rate, term)
+		loanStart = loanStart.UTC().Truncate(24 * time.Hour)
+		for k := 1; k <= term; k++ {
+			unpaid := min(max(instalment*float64(k)-paid, 0), instalment)
+			if unpaid <= 0 {
+				continue
+			}
+			due := loanStart.AddDate(0, k, 0)
+			if due.Format(time.DateOnly) < first {
+				arrears += unpaid
+				continue
+			}
+			if i, ok := index[due.Format("2006-01")]; ok {
+				gross[i] += unpaid
+				report.Months[i].Instalments++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Arrears = finance.RoundCents(arrears)
+	for i := range report.Months {
+		m := &report.Months[i]
+		m.Gross = finance.RoundCents(gross[i])
+		m.RiskAdjusted = finance.RoundCents(m.Gross * report.CollectionRate / 100)
+		report.Gross = finance.RoundCents(report.Gross + m.Gross)
+		report.RiskAdjusted = finance.RoundCents(report.RiskAdjusted + m.RiskAdjusted)
+	}
+	return report, nil
+}
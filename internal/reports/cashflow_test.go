@@ -0,0 +1,81 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCashflowProjection(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "projected")
+	otherID := seedLender(t, db, "otherprojected")
+	borrowerID := seedBorrower(t, db, "projected@example.com")
+	today := time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	// Test case 1: No loans yet: every month is listed with zeros, and nothing discounts them
+	p, err := reporter.CashflowProjection(lenderID, today, 3, true)
+	if err != nil {
+		t.Fatalf("CashflowProjection failed: %v", err)
+	}
+	if p.From != "2026-06" || p.To != "2026-08" || len(p.Months) != 3 || p.Gross != 0 || p.CollectionRate != 100 {
+		t.Errorf("Unexpected empty projection: %+v", p)
+	}
+
+	// 100 a month from 2026-04-15; 150 was paid, so the 05-15 instalment is half paid and in arrears
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1200, 0, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = '2026-03-15' WHERE Loan_ID = ?", loanID)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "paid", Amount: 100, Timestamp: models.NewJSONTime(time.Date(2026, 4, 20, 0, 0, 0, 0, time.UTC))})
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "paid", Amount: 50, Timestamp: models.NewJSONTime(time.Date(2026, 5, 20, 0, 0, 0, 0, time.UTC))})
+	// 200 a month on a second loan, of which the July instalment is prepaid in part
+	prepaidID := seedLoan(t, db, lenderID, borrowerID, "active", 600, 0, 3)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 200, Start_Date = '2026-06-01' WHERE Loan_ID = ?", prepaidID)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: prepaidID, Status: "paid", Amount: 120, Timestamp: models.NewJSONTime(today.Add(time.Hour))})
+	// Defaulted and pending loans, and other lenders' loans, are not projected
+	for _, status := range []string{"defaulted", "pending"} {
+		id := seedLoan(t, db, lenderID, borrowerID, status, 5000, 0, 5)
+		db.Exec("UPDATE Loans SET Monthly_Payment = 1000, Start_Date = '2026-06-01' WHERE Loan_ID = ?", id)
+	}
+	other := seedLoan(t, db, otherID, borrowerID, "active", 5000, 0, 5)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 1000, Start_Date = '2026-06-01' WHERE Loan_ID = ?", other)
+
+	// Test case 2: Gross inflows are the unpaid instalments of active loans
+	p, err = reporter.CashflowProjection(lenderID, today, 3, false)
+	if err != nil {
+		t.Fatalf("CashflowProjection failed: %v", err)
+	}
+	want := []ProjectedMonth{
+		{Month: "2026-06", Instalments: 1, Gross: 100, RiskAdjusted: 100},
+		{Month: "2026-07", Instalments: 2, Gross: 180, RiskAdjusted: 180},
+		{Month: "2026-08", Instalments: 2, Gross: 300, RiskAdjusted: 300},
+	}
+	for i, m := range want {
+		if p.Months[i] != m {
+			t.Errorf("Month %d: expected %+v, got %+v", i, m, p.Months[i])
+		}
+	}
+	if p.Arrears != 50 || p.Gross != 580 || p.RiskAdjusted != 580 || p.CollectionRate != 100 || p.HistoryFrom != "" {
+		t.Errorf("Unexpected unadjusted projection: %+v", p)
+	}
+
+	// Test case 3: The adjustment discounts by the last six months' collection rate: 150 of the
+	// 200 due by yesterday, as the receipt recorded today is not part of the history
+	p, err = reporter.CashflowProjection(lenderID, today, 3, true)
+	if err != nil {
+		t.Fatalf("CashflowProjection failed: %v", err)
+	}
+	if p.HistoryFrom != "2025-12-15" || p.HistoryTo != "2026-06-14" || p.HistoryExpected != 200 || p.HistoryCollected != 150 || p.CollectionRate != 75 {
+		t.Errorf("Unexpected history: %+v", p)
+	}
+	if p.Months[0].RiskAdjusted != 75 || p.Months[1].RiskAdjusted != 135 || p.Months[2].RiskAdjusted != 225 || p.RiskAdjusted != 435 || p.Gross != 580 {
+		t.Errorf("Unexpected adjusted projection: %+v", p)
+	}
+
+	// Test case 4: Collecting more than was due does not inflate the projection
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "paid", Amount: 500, Timestamp: models.NewJSONTime(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))})
+	p, _ = reporter.CashflowProjection(lenderID, today, 3, true)
+	if p.CollectionRate != 100 || p.RiskAdjusted != p.Gross {
+		t.Errorf("Expected the rate capped at 100, got %+v", p)
+	}
+}
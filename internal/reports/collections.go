@@ -0,0 +1,219 @@
+package reports
+
+import (
+	"database/sql"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Income is what a lender collected per calendar month, split by receipt allocation
+type Income struct {
+	From   string          `json:"from"` // YYYY-MM
+	To     string          `json:"to"`   // YYYY-MM, inclusive
+	Months []MonthlyIncome `json:"months"`
+	Totals Split           `json:"totals"`
+}
+
+// MonthlyIncome is what was collected in one month
+type MonthlyIncome struct {
+	Month string `json:"month"` // YYYY-MM
+	Split
+}
+
+// MonthlyCollection is what a lender collected in paid receipts in one calendar month
+type MonthlyCollection struct {
+	Month          string  `json:"month"`           // YYYY-MM
+	TotalCollected float64 `json:"total_collected"` // Collected.Total
+	PaymentCount   int     `json:"payment_count"`
+	Collected      Split   `json:"collected"`
+}
+
+// CollectionsVsExpected compares what a lender's loans were scheduled to pay with what was collected,
+// bucket by bucket. Every bucket in the range is listed, with zeros where nothing was due or paid.
+type CollectionsVsExpected struct {
+	From        string             `json:"from"` // YYYY-MM-DD
+	To          string             `json:"to"`   // YYYY-MM-DD, inclusive
+	Granularity string             `json:"granularity"`
+	Buckets     []CollectionBucket `json:"buckets"`
+}
+
+// CollectionBucket is one day or week of a CollectionsVsExpected report. Expected is the instalments
+// falling due in the bucket, each split as if the instalments before it had been paid, principal
+// first; Collected is the allocated receipts recorded in it. Gap is what is still to be collected,
+// negative when more came in than was due. Percentages are 0 when nothing was expected.
+type CollectionBucket struct {
+	Start                  string  `json:"start"` // YYYY-MM-DD, clipped to the report's range
+	End                    string  `json:"end"`   // YYYY-MM-DD, inclusive
+	Expected               Split   `json:"expected"`
+	Collected              Split   `json:"collected"`
+	Gap                    float64 `json:"gap"`
+	CollectedPct           float64 `json:"collected_pct"`
+	CumulativeExpected     float64 `json:"cumulative_expected"`
+	CumulativeCollected    float64 `json:"cumulative_collected"`
+	CumulativeGap          float64 `json:"cumulative_gap"`
+	CumulativeCollectedPct float64 `json:"cumulative_collected_pct"`
+}
+
+// Income totals the lender's receipt allocations per calendar month, from the month of from to
+// the month of to inclusive, by when the receipts were recorded in from's location. Months without
+// receipts are reported with zeros.
+func (r *Reporter) Income(lenderID int, from, to time.Time) (*Income, error) {
+	loc := from.Location()
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, loc)
+	to = to.In(loc)
+	end := time.Date(to.Year(), to.Month()+1, 1, 0, 0, 0, 0, loc)
+	report := &Income{From: start.Format("2006-01"), To: to.Format("2006-01"), Months: []MonthlyIncome{}}
+
+	allocs, err := r.allocations(lenderID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	type sums struct{ principal, interest, penalties float64 }
+	monthly := make(map[string]*sums)
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		monthly[month.Format("2006-01")] = &sums{}
+	}
+	for _, a := range allocs {
+		if m, ok := monthly[a.at.In(loc).Format("2006-01")]; ok {
+			m.principal += a.principal
+			m.interest += a.interest
+			m.penalties += a.penalties
+		}
+	}
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		m := monthly[month.Format("2006-01")]
+		income := MonthlyIncome{Month: month.Format("2006-01"), Split: NewSplit(m.principal, m.interest, m.penalties)}
+		report.Months = append(report.Months, income)
+		report.Totals = report.Totals.Add(income.Split)
+	}
+	return report, nil
+}
+
+// Collections totals the lender's paid receipts per calendar month for the given number of months
+// starting with the month of from, by when the receipts were recorded in from's location. Every
+// month is returned, with zeros for those without payments.
+func (r *Reporter) Collections(lenderID int, from time.Time, months int) ([]MonthlyCollection, error) {
+	loc := from.Location()
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, months, 0)
+
+	allocs, err := r.allocations(lenderID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	type sums struct {
+		principal, interest, penalties float64
+		count                          int
+	}
+	monthly := make(map[string]*sums)
+	for _, a := range allocs {
+		month := a.at.In(loc).Format("2006-01")
+		m, ok := monthly[month]
+		if !ok {
+			m = &sums{}
+			monthly[month] = m
+		}
+		m.principal += a.principal
+		m.interest += a.interest
+		m.penalties += a.penalties
+		m.count++
+	}
+
+	series := make([]MonthlyCollection, months)
+	for i := range series {
+		month := start.AddDate(0, i, 0).Format("2006-01")
+		series[i] = MonthlyCollection{Month: month}
+		if m, ok := monthly[month]; ok {
+			series[i].Collected = NewSplit(m.principal, m.interest, m.penalties)
+			series[i].TotalCollected = series[i].Collected.Total
+			series[i].PaymentCount = m.count
+		}
+	}
+	return series, nil
+}
+
+// CollectionsVsExpected compares the instalments of the lender's issued loans falling due from the
+// day of from to the day of to, inclusive, with the receipt allocations recorded over the same days,
+// in from's location. Each receipt counts in full in the bucket it was recorded in, however much of an instalment
+// it paid. Buckets are days, or Monday-to-Sunday weeks for GranularityWeek.
+func (r *Reporter) CollectionsVsExpected(lenderID int, from, to time.Time, granularity string) (*CollectionsVsExpected, error) {
+	loc := from.Location()
+	from, to = startOfDay(from), startOfDay(to.In(loc))
+	report := &CollectionsVsExpected{
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Granularity: granularity,
+		Buckets:     []CollectionBucket{},
+	}
+
+	// Lay out the buckets, then map each day of the range to its bucket
+	bucketOf := make(map[string]int)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		weekStart := granularity == GranularityWeek && day.Weekday() == time.Monday
+		if len(report.Buckets) == 0 || granularity != GranularityWeek || weekStart {
+			report.Buckets = append(report.Buckets, CollectionBucket{Start: day.Format(time.DateOnly)})
+		}
+		last := len(report.Buckets) - 1
+		report.Buckets[last].End = day.Format(time.DateOnly)
+		bucketOf[day.Format(time.DateOnly)] = last
+	}
+
+	loans, err := r.db.Query(`SELECT Amount, Interest_Rate, Months_To_Pay, Monthly_Payment, Start_Date
+		FROM Loans WHERE Lender_ID = ? AND Payment_Status IN ('active', 'paid', 'defaulted')`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer loans.Close()
+	for loans.Next() {
+		var amount, rate float64
+		var months int
+		var payment sql.NullFloat64
+		var start time.Time
+		if err := loans.Scan(&amount, &rate, &months, &payment, &start); err != nil {
+			return nil, err
+		}
+		instalment := finance.Instalment(payment, amount, rate, months)
+		start = start.UTC().Truncate(24 * time.Hour)
+		for k := 1; k <= months; k++ {
+			if i, ok := bucketOf[start.AddDate(0, k, 0).Format(time.DateOnly)]; ok {
+				principal := min(max(amount-instalment*float64(k-1), 0), instalment)
+				b := &report.Buckets[i]
+				b.Expected = b.Expected.Add(NewSplit(principal, instalment-principal, 0))
+			}
+		}
+	}
+	if err := loans.Err(); err != nil {
+		return nil, err
+	}
+
+	allocs, err := r.allocations(lenderID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	type sums struct{ principal, interest, penalties float64 }
+	collected := make([]sums, len(report.Buckets))
+	for _, a := range allocs {
+		if i, ok := bucketOf[a.at.In(loc).Format(time.DateOnly)]; ok {
+			collected[i].principal += a.principal
+			collected[i].interest += a.interest
+			collected[i].penalties += a.penalties
+		}
+	}
+	for i, c := range collected {
+		report.Buckets[i].Collected = NewSplit(c.principal, c.interest, c.penalties)
+	}
+
+	var expectedTotal, collectedTotal float64
+	for i := range report.Buckets {
+		b := &report.Buckets[i]
+		expectedTotal += b.Expected.Total
+		collectedTotal += b.Collected.Total
+		b.Gap = finance.RoundCents(b.Expected.Total - b.Collected.Total)
+		b.CumulativeExpected, b.CumulativeCollected = finance.RoundCents(expectedTotal), finance.RoundCents(collectedTotal)
+		b.CumulativeGap = finance.RoundCents(expectedTotal - collectedTotal)
+		b.CollectedPct = percentOf(b.Collected.Total, b.Expected.Total)
+		b.CumulativeCollectedPct = percentOf(b.CumulativeCollected, b.CumulativeExpected)
+	}
+	return report, nil
+}
@@ -0,0 +1,188 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestIncome(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "income")
+	otherID := seedLender(t, db, "otherincome")
+	borrowerID := seedBorrower(t, db, "income@example.com")
+	// Repays 1200 on 1000: the first 1000 paid is principal and the next 200 interest
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100 WHERE Loan_ID = ?", loanID)
+	otherLoanID := seedLoan(t, db, otherID, borrowerID, "active", 1000, 20, 12)
+	pay := func(lenderID, loanID int, status string, amount float64, at string) {
+		t.Helper()
+		ts, _ := time.Parse(time.DateTime, at)
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: status, Amount: amount, Timestamp: models.NewJSONTime(ts)})
+	}
+	pay(lenderID, loanID, "paid", 900, "2026-01-31 23:59:59")
+	pay(lenderID, loanID, "paid", 150, "2026-02-01 00:00:00") // 100 principal, 50 interest
+	pay(lenderID, loanID, "failed", 500, "2026-02-10 12:00:00")
+	pay(lenderID, loanID, "paid", 200, "2026-04-30 12:00:00") // 150 interest, 50 overpaid
+	pay(otherID, otherLoanID, "paid", 700, "2026-02-10 12:00:00")
+
+	month := func(s string) time.Time {
+		m, _ := time.Parse("2006-01", s)
+		return m
+	}
+
+	// Test case 1: Receipts are bucketed by the month they were recorded in, with empty months as zeros
+	report, err := reporter.Income(lenderID, month("2025-12"), month("2026-04"))
+	if err != nil {
+		t.Fatalf("Income failed: %v", err)
+	}
+	want := []MonthlyIncome{
+		{Month: "2025-12"},
+		{Month: "2026-01", Split: Split{Principal: 900, Total: 900}},
+		{Month: "2026-02", Split: Split{Principal: 100, Interest: 50, Total: 150}},
+		{Month: "2026-03"},
+		{Month: "2026-04", Split: Split{Principal: 50, Interest: 150, Total: 200}},
+	}
+	if len(report.Months) != len(want) {
+		t.Fatalf("Expected %d months, got %+v", len(want), report.Months)
+	}
+	for i := range want {
+		if report.Months[i] != want[i] {
+			t.Errorf("Month %d: expected %+v, got %+v", i, want[i], report.Months[i])
+		}
+		assertBalanced(t, report.Months[i].Month, report.Months[i].Split)
+	}
+	assertBalanced(t, "totals", report.Totals)
+	if report.Totals != (Split{Principal: 1050, Interest: 200, Total: 1250}) {
+		t.Errorf("Unexpected totals: %+v", report.Totals)
+	}
+
+	// Test case 2: A single month
+	report, _ = reporter.Income(lenderID, month("2026-02"), month("2026-02"))
+	if report.From != "2026-02" || report.To != "2026-02" || len(report.Months) != 1 || report.Totals.Interest != 50 {
+		t.Errorf("Unexpected single month report: %+v", report)
+	}
+
+	// Test case 3: A loan stored without a monthly payment is split by its derived one, 12 x 92.63
+	unpricedID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = NULL WHERE Loan_ID = ?", unpricedID)
+	pay(lenderID, unpricedID, "paid", 1100, "2026-03-15 12:00:00")
+	report, _ = reporter.Income(lenderID, month("2026-03"), month("2026-03"))
+	if report.Totals != (Split{Principal: 1000, Interest: 100, Total: 1100}) {
+		t.Errorf("Expected 1000 principal and 100 interest, got %+v", report.Totals)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "collections")
+	otherID := seedLender(t, db, "othercollections")
+	borrowerID := seedBorrower(t, db, "collections@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 5000, 10, 12)
+	otherLoanID := seedLoan(t, db, otherID, borrowerID, "active", 5000, 10, 12)
+	pay := func(lenderID, loanID int, status string, amount float64, at time.Time) {
+		t.Helper()
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: status, Amount: amount, Timestamp: models.NewJSONTime(at)})
+	}
+	pay(lenderID, loanID, "paid", 100, time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC))
+	pay(lenderID, loanID, "paid", 200, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	pay(lenderID, loanID, "paid", 300, time.Date(2026, 1, 20, 0, 0, 0, 0, time.UTC))
+	pay(lenderID, loanID, "failed", 400, time.Date(2026, 1, 21, 0, 0, 0, 0, time.UTC))
+	pay(lenderID, loanID, "paid", 50, time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC))
+	pay(otherID, otherLoanID, "paid", 900, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+
+	// A month with payments and an empty month both appear, and only paid receipts count
+	series, err := reporter.Collections(lenderID, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), 3)
+	if err != nil {
+		t.Fatalf("Collections failed: %v", err)
+	}
+	want := []MonthlyCollection{
+		{Month: "2026-01", TotalCollected: 500, PaymentCount: 2, Collected: Split{Principal: 500, Total: 500}},
+		{Month: "2026-02"},
+		{Month: "2026-03", TotalCollected: 50, PaymentCount: 1, Collected: Split{Principal: 50, Total: 50}},
+	}
+	if len(series) != len(want) {
+		t.Fatalf("Expected %d months, got %+v", len(want), series)
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Errorf("Month %d: expected %+v, got %+v", i, want[i], series[i])
+		}
+		assertBalanced(t, series[i].Month, series[i].Collected)
+	}
+}
+
+func TestCollectionsVsExpected(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "expected")
+	borrowerID := seedBorrower(t, db, "expected@example.com")
+	// Instalments of 100 fall due on the 1st of each month and of 50 on the 4th
+	monthly := seedLoan(t, db, lenderID, borrowerID, "active", 1200, 0, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = '2026-01-01' WHERE Loan_ID = ?", monthly)
+	fourth := seedLoan(t, db, lenderID, borrowerID, "active", 600, 0, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 50, Start_Date = '2026-01-04' WHERE Loan_ID = ?", fourth)
+	pending := seedLoan(t, db, lenderID, borrowerID, "pending", 5000, 0, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-01-01' WHERE Loan_ID = ?", pending)
+	pay := func(loanID int, status string, amount float64, at string) {
+		t.Helper()
+		ts, _ := time.Parse(time.RFC3339, at)
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: status, Amount: amount, Timestamp: models.NewJSONTime(ts)})
+	}
+	pay(monthly, "paid", 60, "2026-01-30T10:00:00Z")      // Part of the instalment due on the 1st, early
+	pay(monthly, "paid", 40, "2026-02-03T01:00:00+02:00") // The rest, late: still the 2nd in UTC
+	pay(fourth, "paid", 50, "2026-02-04T12:00:00Z")
+	pay(fourth, "failed", 100, "2026-02-04T12:00:00Z")
+	pay(fourth, "paid", 30, "2026-02-09T00:00:00Z") // After the range
+
+	from, _ := time.Parse(time.DateOnly, "2026-01-28")
+	to, _ := time.Parse(time.DateOnly, "2026-02-08")
+
+	// Test case 1: Weeks run Monday to Sunday, the first clipped to the range
+	report, err := reporter.CollectionsVsExpected(lenderID, from, to, GranularityWeek)
+	if err != nil {
+		t.Fatalf("CollectionsVsExpected failed: %v", err)
+	}
+	want := []CollectionBucket{
+		{Start: "2026-01-28", End: "2026-02-01", Expected: NewSplit(100, 0, 0), Collected: NewSplit(60, 0, 0), Gap: 40, CollectedPct: 60,
+			CumulativeExpected: 100, CumulativeCollected: 60, CumulativeGap: 40, CumulativeCollectedPct: 60},
+		{Start: "2026-02-02", End: "2026-02-08", Expected: NewSplit(50, 0, 0), Collected: NewSplit(90, 0, 0), Gap: -40, CollectedPct: 180,
+			CumulativeExpected: 150, CumulativeCollected: 150, CumulativeGap: 0, CumulativeCollectedPct: 100},
+	}
+	if len(report.Buckets) != len(want) {
+		t.Fatalf("Expected %d weeks, got %+v", len(want), report.Buckets)
+	}
+	for i := range want {
+		if report.Buckets[i] != want[i] {
+			t.Errorf("Week %d: expected %+v, got %+v", i, want[i], report.Buckets[i])
+		}
+	}
+
+	// Test case 2: Days, with those where nothing was due or paid as zeros
+	report, _ = reporter.CollectionsVsExpected(lenderID, from, to, GranularityDay)
+	if report.From != "2026-01-28" || report.To != "2026-02-08" || len(report.Buckets) != 12 {
+		t.Fatalf("Expected 12 days, got %+v", report)
+	}
+	for _, check := range []struct {
+		day                 int
+		expected, collected float64
+	}{{0, 0, 0}, {2, 0, 60}, {4, 100, 0}, {5, 0, 40}, {7, 50, 50}, {11, 0, 0}} {
+		b := report.Buckets[check.day]
+		if b.Start != b.End || b.Expected.Total != check.expected || b.Collected.Total != check.collected {
+			t.Errorf("Day %d: expected %v due and %v collected, got %+v", check.day, check.expected, check.collected, b)
+		}
+		assertBalanced(t, b.Start+" expected", b.Expected)
+		assertBalanced(t, b.Start+" collected", b.Collected)
+	}
+	if last := report.Buckets[11]; last.CumulativeGap != 0 || last.CollectedPct != 0 {
+		t.Errorf("Expected the books level and no percentage on a day with nothing due, got %+v", last)
+	}
+	// Test case 3: Expected instalments are principal until the loan's principal is scheduled, then
+	// interest: the second instalment of 100 on 150 is 50 of each
+	interest := seedLoan(t, db, lenderID, borrowerID, "active", 150, 20, 2)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = '2025-11-30' WHERE Loan_ID = ?", interest)
+	report, _ = reporter.CollectionsVsExpected(lenderID, from, to, GranularityDay)
+	if due := report.Buckets[2].Expected; due != NewSplit(50, 50, 0) {
+		t.Errorf("Expected 50 principal and 50 interest due on %s, got %+v", report.Buckets[2].Start, due)
+	}
+}
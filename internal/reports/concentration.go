@@ -0,0 +1,94 @@
+package reports
+
+import (
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Concentration reports how much of a lender's book its biggest borrowers hold, as of the end of a
+// day. Like Exposure it is measured on the outstanding principal of active loans; each borrower's
+// interest still to be collected is reported alongside.
+type Concentration struct {
+	AsOf                 string                  `json:"as_of"` // YYYY-MM-DD
+	OutstandingPrincipal float64                 `json:"outstanding_principal"`
+	Borrowers            int                     `json:"borrowers"`      // Borrowers owing anything on an active loan
+	TopShare             float64                 `json:"top_share"`      // Percentage of OutstandingPrincipal held by Top
+	HHI                  float64                 `json:"hhi"`            // Sum of every borrower's squared share, 0 to 1; 1 is a single borrower
+	ExposureLimit        float64                 `json:"exposure_limit"` // 0 when the lender sets none
+	BorrowersOverLimit   int                     `json:"borrowers_over_limit"`
+	Top                  []BorrowerConcentration `json:"top"` // Largest first
+}
+
+// BorrowerConcentration is one borrower's part of a Concentration report
+type BorrowerConcentration struct {
+	BorrowerID  int     `json:"borrower_id"`
+	Fullnames   string  `json:"fullnames"`
+	ActiveLoans int     `json:"active_loans"`
+	Outstanding Split   `json:"outstanding"`
+	Share       float64 `json:"share"` // Percentage of the book's outstanding principal
+	OverLimit   bool    `json:"over_limit"`
+}
+
+// Concentration reports the lender's top borrowers by outstanding principal as of the moment's day
+// in its location, from the receipts recorded by the end of that day. Borrowers owing more principal
+// than exposureLimit are flagged; an exposureLimit of 0 flags none.
+func (r *Reporter) Concentration(lenderID int, asOf time.Time, top int, exposureLimit float64) (*Concentration, error) {
+	day := startOfDay(asOf)
+	report := &Concentration{AsOf: day.Format(time.DateOnly), ExposureLimit: exposureLimit, Top: []BorrowerConcentration{}}
+	until := day.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+	derived, err := r.derivedPayments(lenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`WITH `+balances+`
+		SELECT b.Borrower_ID, bo.Fullnames, COUNT(*), SUM(b.Principal), SUM(b.Interest)
+		FROM balances b JOIN Borrowers bo ON bo.Borrower_ID = b.Borrower_ID
+		WHERE b.Payment_Status = 'active'
+		GROUP BY b.Borrower_ID
+		HAVING SUM(b.Principal) + SUM(b.Interest) > 0
+		ORDER BY SUM(b.Principal) DESC, b.Borrower_ID`,
+		lenderID, until, derived, report.AsOf, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Every borrower is read, since the index and the limit breaches cover the whole book
+	var borrowers []BorrowerConcentration
+	for rows.Next() {
+		var b BorrowerConcentration
+		var principal, interest float64
+		if err := rows.Scan(&b.BorrowerID, &b.Fullnames, &b.ActiveLoans, &principal, &interest); err != nil {
+			return nil, err
+		}
+		b.Outstanding = NewSplit(principal, interest, 0)
+		b.OverLimit = exposureLimit > 0 && b.Outstanding.Principal > exposureLimit
+		borrowers = append(borrowers, b)
+		report.OutstandingPrincipal += b.Outstanding.Principal
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	report.OutstandingPrincipal = finance.RoundCents(report.OutstandingPrincipal)
+	report.Borrowers = len(borrowers)
+
+	var topPrincipal float64
+	for i, b := range borrowers {
+		if report.OutstandingPrincipal > 0 {
+			share := b.Outstanding.Principal / report.OutstandingPrincipal
+			report.HHI += share * share
+		}
+		if b.OverLimit {
+			report.BorrowersOverLimit++
+		}
+		if i < top {
+			b.Share = percentOf(b.Outstanding.Principal, report.OutstandingPrincipal)
+			report.Top = append(report.Top, b)
+			topPrincipal += b.Outstanding.Principal
+		}
+	}
+	report.TopShare = percentOf(topPrincipal, report.OutstandingPrincipal)
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestConcentration(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "concentrated")
+	otherID := seedLender(t, db, "otherconcentrated")
+	borrowerA := seedBorrower(t, db, "a@example.com")
+	borrowerB := seedBorrower(t, db, "b@example.com")
+	borrowerC := seedBorrower(t, db, "c@example.com")
+
+	// Test case 1: No loans yet
+	c, err := reporter.Concentration(lenderID, time.Now(), 10, 0)
+	if err != nil {
+		t.Fatalf("Concentration failed: %v", err)
+	}
+	if c.Borrowers != 0 || c.HHI != 0 || len(c.Top) != 0 {
+		t.Errorf("Expected an empty report, got %+v", c)
+	}
+
+	// A owes 6000 over two loans after a paid receipt, B 3000 and C 1000; only active loans count
+	first := seedLoan(t, db, lenderID, borrowerA, "active", 5000, 10, 12)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: first, Status: "paid", Amount: 1000})
+	seedLoan(t, db, lenderID, borrowerA, "active", 2000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerB, "active", 3000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerB, "paid", 9000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerC, "active", 1000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerC, "pending", 9000, 10, 12)
+	seedLoan(t, db, otherID, borrowerC, "active", 50000, 10, 12)
+
+	// Test case 2: The top borrowers, largest first, with their shares and the index over everyone
+	c, err = reporter.Concentration(lenderID, time.Now(), 2, 2500)
+	if err != nil {
+		t.Fatalf("Concentration failed: %v", err)
+	}
+	if c.OutstandingPrincipal != 10000 || c.Borrowers != 3 || len(c.Top) != 2 {
+		t.Fatalf("Unexpected report: %+v", c)
+	}
+	if c.Top[0].BorrowerID != borrowerA || c.Top[0].ActiveLoans != 2 || c.Top[0].Outstanding.Principal != 6000 || c.Top[0].Share != 60 {
+		t.Errorf("Unexpected largest borrower: %+v", c.Top[0])
+	}
+	if c.Top[1].BorrowerID != borrowerB || c.Top[1].Share != 30 || c.TopShare != 90 {
+		t.Errorf("Unexpected top shares: %+v, %v", c.Top[1], c.TopShare)
+	}
+	if want := 0.36 + 0.09 + 0.01; math.Abs(c.HHI-want) > 1e-9 {
+		t.Errorf("Expected an index of %v, got %v", want, c.HHI)
+	}
+	if c.Top[0].Outstanding.Interest <= 0 {
+		t.Errorf("Expected interest on the derived payments, got %+v", c.Top[0].Outstanding)
+	}
+	assertBalanced(t, "outstanding", c.Top[0].Outstanding)
+
+	// Test case 3: Borrowers over the limit are flagged and counted
+	if !c.Top[0].OverLimit || !c.Top[1].OverLimit || c.BorrowersOverLimit != 2 || c.ExposureLimit != 2500 {
+		t.Errorf("Expected A and B over the limit, got %+v", c)
+	}
+	c, _ = reporter.Concentration(lenderID, time.Now(), 10, 0)
+	if len(c.Top) != 3 || c.BorrowersOverLimit != 0 || c.Top[0].OverLimit {
+		t.Errorf("Expected no flags without a limit, got %+v", c)
+	}
+}
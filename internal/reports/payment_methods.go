@@ -0,0 +1,176 @@
+package reports
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Payment methods a receipt is reported under. Receipts record the method as free text, so
+// NormalizePaymentMethod maps it onto one of these.
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodMobileMoney  = "mobile_money"
+	PaymentMethodBankTransfer = "bank_transfer"
+	PaymentMethodCard         = "card"
+	PaymentMethodCheque       = "cheque"
+	PaymentMethodOther        = "other" // Missing, unknown and legacy free-text methods
+)
+
+// PaymentMethods lists the methods in the order reports present them, other last
+var PaymentMethods = []string{PaymentMethodCash, PaymentMethodMobileMoney, PaymentMethodBankTransfer, PaymentMethodCard, PaymentMethodCheque, PaymentMethodOther}
+
+// paymentMethodAliases maps common spellings and provider names, once normalized, to a method
+var paymentMethodAliases = map[string]string{
+	"mobile":        PaymentMethodMobileMoney,
+	"mpesa":         PaymentMethodMobileMoney,
+	"m_pesa":        PaymentMethodMobileMoney,
+	"ecocash":       PaymentMethodMobileMoney,
+	"bank":          PaymentMethodBankTransfer,
+	"eft":           PaymentMethodBankTransfer,
+	"transfer":      PaymentMethodBankTransfer,
+	"bank_deposit":  PaymentMethodBankTransfer,
+	"debit_card":    PaymentMethodCard,
+	"credit_card":   PaymentMethodCard,
+	"check":         PaymentMethodCheque,
+	"cash_deposit":  PaymentMethodCash,
+	"cash_payment":  PaymentMethodCash,
+	"mobile_wallet": PaymentMethodMobileMoney,
+}
+
+// NormalizePaymentMethod maps a receipt's free-text payment method onto one of PaymentMethods,
+// ignoring case and treating spaces and hyphens as underscores. Anything it does not recognise is
+// PaymentMethodOther.
+func NormalizePaymentMethod(method string) string {
+	key := strings.Join(strings.FieldsFunc(strings.ToLower(method), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}), "_")
+	if alias, ok := paymentMethodAliases[key]; ok {
+		return alias
+	}
+	for _, m := range PaymentMethods {
+		if key == m {
+			return m
+		}
+	}
+	return PaymentMethodOther
+}
+
+// PaymentMethodReport breaks a lender's paid receipts down by payment method per period, with every
+// method listed in every period, zeros included, and a total over the whole range.
+type PaymentMethodReport struct {
+	From        string                `json:"from"` // YYYY-MM-DD
+	To          string                `json:"to"`   // YYYY-MM-DD, inclusive
+	Granularity string                `json:"granularity"`
+	Periods     []PaymentMethodPeriod `json:"periods"`
+	Totals      PaymentMethodPeriod   `json:"totals"`
+}
+
+// PaymentMethodPeriod is what was collected in one period, overall and per method. Period is the
+// period's first day in the range as YYYY-MM-DD, or YYYY-MM for months; it is "total" for the totals.
+type PaymentMethodPeriod struct {
+	Period  string               `json:"period"`
+	Amount  float64              `json:"amount"`
+	Count   int                  `json:"count"`
+	Methods []PaymentMethodShare `json:"methods"`
+}
+
+// PaymentMethodShare is what one method collected in a period. SharePct is its percentage of the
+// period's amount, 0 when nothing was collected.
+type PaymentMethodShare struct {
+	Method   string  `json:"method"`
+	Amount   float64 `json:"amount"`
+	Count    int     `json:"count"`
+	SharePct float64 `json:"share_pct"`
+}
+
+// PaymentMethods totals the lender's paid receipts by payment method per day, week or month over the
+// days from the day of from to the day of to, inclusive, in from's location, by when they were recorded.
+func (r *Reporter) PaymentMethods(lenderID int, granularity string, from, to time.Time) (*PaymentMethodReport, error) {
+	loc := from.Location()
+	from, to = startOfDay(from), startOfDay(to.In(loc))
+	ps := periods(from, to, granularity)
+	report := &PaymentMethodReport{
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Granularity: granularity,
+		Periods:     make([]PaymentMethodPeriod, len(ps)),
+	}
+
+	type sums struct {
+		amount float64
+		count  int
+	}
+	perPeriod := make([]map[string]*sums, len(ps))
+	totals := make(map[string]*sums)
+	for i := range ps {
+		perPeriod[i] = make(map[string]*sums)
+	}
+
+	if len(ps) > 0 {
+		rows, err := r.db.Query(`SELECT Timestamp, Payment_Method, Amount FROM Recipets
+			WHERE Lender_ID = ? AND Status = 'paid' AND DATETIME(Timestamp) >= DATETIME(?) AND DATETIME(Timestamp) < DATETIME(?)`,
+			lenderID, from.UTC().Format(time.RFC3339), ps[len(ps)-1].end.UTC().Format(time.RFC3339))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var at time.Time
+			var method sql.NullString
+			var amount float64
+			if err := rows.Scan(&at, &method, &amount); err != nil {
+				return nil, err
+			}
+			i := sort.Search(len(ps), func(i int) bool { return ps[i].end.After(at) })
+			if i == len(ps) {
+				continue
+			}
+			m := NormalizePaymentMethod(method.String)
+			for _, bucket := range []map[string]*sums{perPeriod[i], totals} {
+				s, ok := bucket[m]
+				if !ok {
+					s = &sums{}
+					bucket[m] = s
+				}
+				s.amount += amount
+				s.count++
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// period lists every method of one bucket with its share of the bucket's amount
+	period := func(name string, bucket map[string]*sums) PaymentMethodPeriod {
+		p := PaymentMethodPeriod{Period: name, Methods: make([]PaymentMethodShare, len(PaymentMethods))}
+		for _, s := range bucket {
+			p.Amount += s.amount
+			p.Count += s.count
+		}
+		p.Amount = finance.RoundCents(p.Amount)
+		for i, m := range PaymentMethods {
+			share := PaymentMethodShare{Method: m}
+			if s, ok := bucket[m]; ok {
+				share.Amount = finance.RoundCents(s.amount)
+				share.Count = s.count
+				share.SharePct = percentOf(s.amount, p.Amount)
+			}
+			p.Methods[i] = share
+		}
+		return p
+	}
+	for i, p := range ps {
+		name := p.start.Format(time.DateOnly)
+		if granularity == GranularityMonth {
+			name = p.start.Format("2006-01")
+		}
+		report.Periods[i] = period(name, perPeriod[i])
+	}
+	report.Totals = period("total", totals)
+	return report, nil
+}
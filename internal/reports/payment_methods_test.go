@@ -0,0 +1,104 @@
+package reports
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestNormalizePaymentMethod(t *testing.T) {
+	tests := map[string]string{
+		"cash":          PaymentMethodCash,
+		" Cash ":        PaymentMethodCash,
+		"mobile_money":  PaymentMethodMobileMoney,
+		"Mobile Money":  PaymentMethodMobileMoney,
+		"M-Pesa":        PaymentMethodMobileMoney,
+		"EcoCash":       PaymentMethodMobileMoney,
+		"bank-transfer": PaymentMethodBankTransfer,
+		"EFT":           PaymentMethodBankTransfer,
+		"Credit Card":   PaymentMethodCard,
+		"check":         PaymentMethodCheque,
+		"":              PaymentMethodOther,
+		"paid by uncle": PaymentMethodOther,
+		"bitcoin":       PaymentMethodOther,
+	}
+	for in, want := range tests {
+		if got := NormalizePaymentMethod(in); got != want {
+			t.Errorf("NormalizePaymentMethod(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPaymentMethods(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "methods")
+	otherID := seedLender(t, db, "othermethods")
+	borrowerID := seedBorrower(t, db, "methods@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 5000, 10, 12)
+	otherLoan := seedLoan(t, db, otherID, borrowerID, "active", 5000, 10, 12)
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 10, 0, 0, 0, time.UTC) }
+	method := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+
+	// January is all cash; February moves to mobile money, with legacy free text and a missing method
+	for _, r := range []struct {
+		at     time.Time
+		method string
+		status string
+		amount float64
+	}{
+		{day(1, 5), "cash", "paid", 300},
+		{day(1, 20), "Cash", "paid", 100},
+		{day(1, 21), "cash", "failed", 999},
+		{day(2, 3), "mobile_money", "paid", 200},
+		{day(2, 4), "M-Pesa", "paid", 100},
+		{day(2, 10), "cash", "paid", 50},
+		{day(2, 11), "paid at the office", "paid", 25},
+		{day(2, 12), "", "paid", 25},
+	} {
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: r.status, Amount: r.amount, PaymentMethod: method(r.method), Timestamp: models.NewJSONTime(r.at)})
+	}
+	seedReceipt(t, db, otherID, models.Receipt{LoanID: otherLoan, Status: "paid", Amount: 700, PaymentMethod: method("card"), Timestamp: models.NewJSONTime(day(2, 1))})
+
+	report, err := reporter.PaymentMethods(lenderID, GranularityMonth, day(1, 1), day(3, 31))
+	if err != nil {
+		t.Fatalf("PaymentMethods failed: %v", err)
+	}
+	share := func(p PaymentMethodPeriod, m string) PaymentMethodShare {
+		for _, s := range p.Methods {
+			if s.Method == m {
+				return s
+			}
+		}
+		t.Fatalf("Method %s missing from %+v", m, p)
+		return PaymentMethodShare{}
+	}
+
+	// Test case 1: Every period lists every method, with empty months zeroed
+	if len(report.Periods) != 3 || report.Periods[0].Period != "2026-01" || len(report.Periods[2].Methods) != len(PaymentMethods) || report.Periods[2].Amount != 0 {
+		t.Fatalf("Unexpected periods: %+v", report.Periods)
+	}
+
+	// Test case 2: January's paid receipts are all cash, however spelt
+	if jan := share(report.Periods[0], PaymentMethodCash); jan.Amount != 400 || jan.Count != 2 || jan.SharePct != 100 {
+		t.Errorf("Expected 400 in cash in January, got %+v", jan)
+	}
+
+	// Test case 3: February's mobile money includes the provider name; unknown and missing methods are other
+	feb := report.Periods[1]
+	if mobile := share(feb, PaymentMethodMobileMoney); feb.Amount != 400 || mobile.Amount != 300 || mobile.Count != 2 || mobile.SharePct != 75 {
+		t.Errorf("Expected 300 of 400 by mobile money in February, got %+v", feb)
+	}
+	if other := share(feb, PaymentMethodOther); other.Amount != 50 || other.Count != 2 || other.SharePct != 12.5 {
+		t.Errorf("Expected 50 under other, got %+v", other)
+	}
+	if card := share(feb, PaymentMethodCard); card.Amount != 0 {
+		t.Errorf("Expected no other lender's card receipts, got %+v", card)
+	}
+
+	// Test case 4: The totals cover the whole range
+	if report.Totals.Period != "total" || report.Totals.Amount != 800 || report.Totals.Count != 7 || share(report.Totals, PaymentMethodCash).SharePct != 56.25 {
+		t.Errorf("Unexpected totals: %+v", report.Totals)
+	}
+}
@@ -0,0 +1,266 @@
+package reports
+
+import (
+	"sort"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Platform summarises every lender on the platform for the operator. It only carries counts and
+// totals, never a lender's or borrower's details. Lenders lend in their own currencies, so money is
+// totalled per currency.
+type Platform struct {
+	AsOf          string               `json:"as_of"` // YYYY-MM-DD
+	Month         string               `json:"month"` // YYYY-MM, the month of AsOf
+	Lenders       PlatformLenders      `json:"lenders"`
+	Subscriptions []PlanSubscriptions  `json:"subscriptions"`
+	Originated    []CurrencyOriginated `json:"originated"` // Loans issued in Month
+	Collected     []CurrencyCollected  `json:"collected"`
+}
+
+// PlatformLenders counts the lenders registered on the platform
+type PlatformLenders struct {
+	Total     int `json:"total"`
+	Active    int `json:"active"` // Neither deactivated nor suspended
+	Suspended int `json:"suspended"`
+	New       int `json:"new"` // Registered in the month
+}
+
+// PlanSubscriptions counts the lenders whose current subscription is an active one to a plan
+type PlanSubscriptions struct {
+	PlanID  int    `json:"plan_id"`
+	Plan    string `json:"plan"`
+	IsTrial bool   `json:"is_trial"`
+	Active  int    `json:"active"`
+}
+
+// CurrencyOriginated is the loans issued in one currency
+type CurrencyOriginated struct {
+	Currency  string  `json:"currency"`
+	Loans     int     `json:"loans"`
+	Principal float64 `json:"principal"`
+}
+
+// CurrencyCollected is the paid receipts collected in one currency, ever and in the month
+type CurrencyCollected struct {
+	Currency string `json:"currency"`
+	Total    Split  `json:"total"`
+	Month    Split  `json:"month"`
+}
+
+// PlatformPoint is one period of the platform's growth. Period is the period's first day in the
+// range as YYYY-MM-DD, or YYYY-MM for months. Money is keyed by currency.
+type PlatformPoint struct {
+	Period          string             `json:"period"`
+	NewLenders      int                `json:"new_lenders"`
+	Lenders         int                `json:"lenders"` // Registered by the end of the period
+	LoansOriginated int                `json:"loans_originated"`
+	Originated      map[string]float64 `json:"originated"`
+	Collected       map[string]float64 `json:"collected"`
+}
+
+// issuedStatuses are the loan statuses counted as originated: the loan was disbursed, whatever
+// became of it since
+const issuedStatuses = `('active', 'paid', 'defaulted')`
+
+// Platform summarises every lender as of asOf, with the month figures covering the calendar month
+// of asOf in its location. Collections are read in a single pass over the receipt allocations.
+func (r *Reporter) Platform(asOf time.Time) (*Platform, error) {
+	loc := asOf.Location()
+	start := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 1, 0)
+	report := &Platform{
+		AsOf:          asOf.Format(time.DateOnly),
+		Month:         start.Format("2006-01"),
+		Subscriptions: []PlanSubscriptions{},
+		Originated:    []CurrencyOriginated{},
+		Collected:     []CurrencyCollected{},
+	}
+	monthStart, monthEnd := start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)
+
+	err := r.db.QueryRow(`SELECT COUNT(*),
+			COALESCE(SUM(Is_Active = 1 AND Suspended_At IS NULL), 0),
+			COALESCE(SUM(Suspended_At IS NOT NULL), 0),
+			COALESCE(SUM(DATETIME(Created_At) >= DATETIME(?) AND DATETIME(Created_At) < DATETIME(?)), 0)
+		FROM Lenders`, monthStart, monthEnd).
+		Scan(&report.Lenders.Total, &report.Lenders.Active, &report.Lenders.Suspended, &report.Lenders.New)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each lender's current subscription is its most recent ledger row, as in the admin lender list
+	rows, err := r.db.Query(`SELECT p.Plan_ID, p.Plan, COALESCE(p.Is_Trial, 0), COUNT(l.Ledger_ID)
+		FROM Plans p
+		LEFT JOIN Lender_Ledger l ON l.Plan_ID = p.Plan_ID AND l.Status = 'active' AND l.Ledger_ID = (
+			SELECT l2.Ledger_ID FROM Lender_Ledger l2 WHERE l2.Lender_ID = l.Lender_ID
+			ORDER BY l2.Start_Date DESC, l2.Ledger_ID DESC LIMIT 1)
+		GROUP BY p.Plan_ID ORDER BY p.Plan_ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var plan PlanSubscriptions
+		if err := rows.Scan(&plan.PlanID, &plan.Plan, &plan.IsTrial, &plan.Active); err != nil {
+			return nil, err
+		}
+		report.Subscriptions = append(report.Subscriptions, plan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Start dates are calendar days, so they are compared as dates rather than moments
+	rows, err = r.db.Query(`SELECT le.Currency, COUNT(*), SUM(lo.Amount)
+		FROM Loans lo JOIN Lenders le ON le.Lender_ID = lo.Lender_ID
+		WHERE lo.Payment_Status IN `+issuedStatuses+` AND DATE(lo.Start_Date) >= ? AND DATE(lo.Start_Date) < ?
+		GROUP BY le.Currency ORDER BY le.Currency`,
+		start.Format(time.DateOnly), end.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var originated CurrencyOriginated
+		if err := rows.Scan(&originated.Currency, &originated.Loans, &originated.Principal); err != nil {
+			return nil, err
+		}
+		originated.Principal = finance.RoundCents(originated.Principal)
+		report.Originated = append(report.Originated, originated)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.Query(`SELECT le.Currency, SUM(a.Principal), SUM(a.Interest), SUM(a.Penalties),
+			SUM(CASE WHEN DATETIME(r.Timestamp) >= DATETIME(?) THEN a.Principal ELSE 0 END),
+			SUM(CASE WHEN DATETIME(r.Timestamp) >= DATETIME(?) THEN a.Interest ELSE 0 END),
+			SUM(CASE WHEN DATETIME(r.Timestamp) >= DATETIME(?) THEN a.Penalties ELSE 0 END)
+		FROM Receipt_Allocations a
+		JOIN Recipets r ON r.Recipet_ID = a.Recipet_ID
+		JOIN Lenders le ON le.Lender_ID = a.Lender_ID
+		WHERE r.Status = 'paid' AND DATETIME(r.Timestamp) < DATETIME(?)
+		GROUP BY le.Currency ORDER BY le.Currency`,
+		monthStart, monthStart, monthStart, monthEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var collected CurrencyCollected
+		var principal, interest, penalties, monthPrincipal, monthInterest, monthPenalties float64
+		if err := rows.Scan(&collected.Currency, &principal, &interest, &penalties, &monthPrincipal, &monthInterest, &monthPenalties); err != nil {
+			return nil, err
+		}
+		collected.Total = NewSplit(principal, interest, penalties)
+		collected.Month = NewSplit(monthPrincipal, monthInterest, monthPenalties)
+		report.Collected = append(report.Collected, collected)
+	}
+	return report, rows.Err()
+}
+
+// PlatformTimeSeries charts the platform's growth per day, week or month over the days from the day
+// of from to the day of to, inclusive, in from's location: lenders registered, loans issued and
+// receipts collected across every lender. Every period is listed, with zeros where nothing happened.
+func (r *Reporter) PlatformTimeSeries(granularity string, from, to time.Time) ([]PlatformPoint, error) {
+	loc := from.Location()
+	from, to = startOfDay(from), startOfDay(to.In(loc))
+	ps := periods(from, to, granularity)
+	points := make([]PlatformPoint, len(ps))
+	for i, p := range ps {
+		points[i] = PlatformPoint{Period: p.start.Format(time.DateOnly), Originated: map[string]float64{}, Collected: map[string]float64{}}
+		if granularity == GranularityMonth {
+			points[i].Period = p.start.Format("2006-01")
+		}
+	}
+	if len(ps) == 0 {
+		return points, nil
+	}
+	end := ps[len(ps)-1].end
+
+	// index returns the period the moment at falls in, or -1 when it is outside the range
+	index := func(at time.Time) int {
+		if at.Before(from) {
+			return -1
+		}
+		if i := sort.Search(len(ps), func(i int) bool { return ps[i].end.After(at) }); i < len(ps) {
+			return i
+		}
+		return -1
+	}
+
+	var before int
+	rows, err := r.db.Query(`SELECT Created_At FROM Lenders WHERE DATETIME(Created_At) < DATETIME(?)`, end.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var created time.Time
+		if err := rows.Scan(&created); err != nil {
+			return nil, err
+		}
+		if i := index(created); i >= 0 {
+			points[i].NewLenders++
+		} else {
+			before++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range points {
+		before += points[i].NewLenders
+		points[i].Lenders = before
+	}
+
+	rows, err = r.db.Query(`SELECT DATE(lo.Start_Date), le.Currency, COUNT(*), SUM(lo.Amount)
+		FROM Loans lo JOIN Lenders le ON le.Lender_ID = lo.Lender_ID
+		WHERE lo.Payment_Status IN `+issuedStatuses+` AND DATE(lo.Start_Date) BETWEEN ? AND ?
+		GROUP BY DATE(lo.Start_Date), le.Currency`,
+		from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day, currency string
+		var count int
+		var amount float64
+		if err := rows.Scan(&day, &currency, &count, &amount); err != nil {
+			return nil, err
+		}
+		at, err := time.ParseInLocation(time.DateOnly, day, loc)
+		if err != nil {
+			return nil, err
+		}
+		if i := index(at); i >= 0 {
+			points[i].LoansOriginated += count
+			points[i].Originated[currency] += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	allocs, err := r.allocations(AllLenders, from, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range allocs {
+		if i := index(a.at); i >= 0 {
+			points[i].Collected[a.currency] += a.principal + a.interest + a.penalties
+		}
+	}
+
+	for i := range points {
+		for currency, amount := range points[i].Originated {
+			points[i].Originated[currency] = finance.RoundCents(amount)
+		}
+		for currency, amount := range points[i].Collected {
+			points[i].Collected[currency] = finance.RoundCents(amount)
+		}
+	}
+	return points, nil
+}
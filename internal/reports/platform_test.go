@@ -0,0 +1,82 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestPlatform(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lesotho := seedLender(t, db, "platformlsl")
+	southAfrica := seedLender(t, db, "platformzar")
+	suspended := seedLender(t, db, "platformsuspended")
+	borrowerID := seedBorrower(t, db, "platform@example.com")
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+
+	db.Exec("UPDATE Lenders SET Currency = 'ZAR' WHERE Lender_ID = ?", southAfrica)
+	db.Exec("UPDATE Lenders SET Suspended_At = CURRENT_TIMESTAMP WHERE Lender_ID = ?", suspended)
+	db.Exec("UPDATE Lenders SET Created_At = '2025-12-20 09:00:00' WHERE Lender_ID = ?", lesotho)
+	db.Exec("UPDATE Lenders SET Created_At = '2026-02-03 09:00:00' WHERE Lender_ID IN (?, ?)", southAfrica, suspended)
+	db.Exec("INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days) VALUES ('Trial', 0, 1, 14), ('Pro', 100, 0, 0)")
+	// The suspended lender's trial was superseded by an expired Pro row, so only two are active
+	db.Exec(`INSERT INTO Lender_Ledger (Lender_ID, Plan_ID, Status, Start_Date) VALUES
+		(?, 2, 'active', '2026-01-01'), (?, 1, 'active', '2026-02-03'),
+		(?, 1, 'active', '2026-02-03'), (?, 2, 'expired', '2026-02-10')`, lesotho, southAfrica, suspended, suspended)
+
+	january := seedLoan(t, db, lesotho, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-01-05' WHERE Loan_ID = ?", january)
+	february := seedLoan(t, db, lesotho, borrowerID, "paid", 500, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-02-05' WHERE Loan_ID = ?", february)
+	zarLoan := seedLoan(t, db, southAfrica, borrowerID, "defaulted", 3000, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-02-10' WHERE Loan_ID = ?", zarLoan)
+	cancelled := seedLoan(t, db, southAfrica, borrowerID, "cancelled", 9000, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-02-10' WHERE Loan_ID = ?", cancelled)
+	seedReceipt(t, db, lesotho, models.Receipt{LoanID: january, Status: "paid", Amount: 100, Timestamp: models.NewJSONTime(day(1, 20))})
+	seedReceipt(t, db, lesotho, models.Receipt{LoanID: january, Status: "paid", Amount: 100, Timestamp: models.NewJSONTime(day(2, 20))})
+	seedReceipt(t, db, southAfrica, models.Receipt{LoanID: zarLoan, Status: "paid", Amount: 300, Timestamp: models.NewJSONTime(day(2, 21))})
+	seedReceipt(t, db, southAfrica, models.Receipt{LoanID: zarLoan, Status: "failed", Amount: 300, Timestamp: models.NewJSONTime(day(2, 22))})
+
+	// Test case 1: The summary counts lenders and active subscriptions, and totals money per currency
+	report, err := reporter.Platform(day(2, 25))
+	if err != nil {
+		t.Fatalf("Platform failed: %v", err)
+	}
+	if report.Month != "2026-02" || report.Lenders != (PlatformLenders{Total: 3, Active: 2, Suspended: 1, New: 2}) {
+		t.Errorf("Unexpected lenders: %s %+v", report.Month, report.Lenders)
+	}
+	if len(report.Subscriptions) != 2 || report.Subscriptions[0].Active != 1 || !report.Subscriptions[0].IsTrial || report.Subscriptions[1].Active != 1 {
+		t.Errorf("Expected one active trial and one active Pro subscription, got %+v", report.Subscriptions)
+	}
+	wantOriginated := []CurrencyOriginated{{"LSL", 1, 500}, {"ZAR", 1, 3000}}
+	if len(report.Originated) != 2 || report.Originated[0] != wantOriginated[0] || report.Originated[1] != wantOriginated[1] {
+		t.Errorf("Expected February's issued loans per currency, got %+v", report.Originated)
+	}
+	if len(report.Collected) != 2 || report.Collected[0].Currency != "LSL" || report.Collected[0].Total.Total != 200 || report.Collected[0].Month.Total != 100 ||
+		report.Collected[1].Currency != "ZAR" || report.Collected[1].Total.Total != 300 {
+		t.Errorf("Unexpected collections: %+v", report.Collected)
+	}
+	for _, c := range report.Collected {
+		assertBalanced(t, c.Currency, c.Total)
+		assertBalanced(t, c.Currency+" month", c.Month)
+	}
+
+	// Test case 2: Monthly growth, with lenders registered before the range counted in the running total
+	points, err := reporter.PlatformTimeSeries(GranularityMonth, day(1, 1), day(3, 31))
+	if err != nil {
+		t.Fatalf("PlatformTimeSeries failed: %v", err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 months, got %+v", points)
+	}
+	if p := points[0]; p.Period != "2026-01" || p.NewLenders != 0 || p.Lenders != 1 || p.LoansOriginated != 1 || p.Originated["LSL"] != 1000 || p.Collected["LSL"] != 100 {
+		t.Errorf("Unexpected January: %+v", p)
+	}
+	if p := points[1]; p.NewLenders != 2 || p.Lenders != 3 || p.LoansOriginated != 2 || p.Originated["ZAR"] != 3000 || p.Collected["ZAR"] != 300 {
+		t.Errorf("Unexpected February: %+v", p)
+	}
+	if p := points[2]; p.Lenders != 3 || p.LoansOriginated != 0 || len(p.Collected) != 0 {
+		t.Errorf("Expected a quiet March, got %+v", p)
+	}
+}
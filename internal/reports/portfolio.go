@@ -0,0 +1,212 @@
+package reports
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Portfolio reports a lender's loan book as of the end of a day. Loans count once their start date
+// is on or before that day, with their current status; receipts count once recorded before the day
+// ends. Outstanding amounts are those of active loans.
+type Portfolio struct {
+	AsOf            string            `json:"as_of"` // YYYY-MM-DD
+	Loans           []LoanStatusTotal `json:"loans"` // Every status, including those with no loans
+	Outstanding     Split             `json:"outstanding"`
+	TotalCollected  float64           `json:"total_collected"` // Collected.Total
+	Collected       Split             `json:"collected"`
+	AverageLoanSize float64           `json:"average_loan_size"`           // Mean principal of active, paid and defaulted loans
+	PortfolioAtRisk float64           `json:"portfolio_at_risk"`           // Percentage of Outstanding.Total owed on loans past their final due date
+	SnapshotTakenAt *time.Time        `json:"snapshot_taken_at,omitempty"` // Set when served from a stored month-end snapshot
+}
+
+// LoanBalance is what is still owed on one loan as of the end of a day, with the loan's current status
+type LoanBalance struct {
+	LoanID      int    `json:"loan_id"`
+	Status      string `json:"status"`
+	Outstanding Split  `json:"outstanding"`
+}
+
+// LoanStatusTotal is the number and principal of a lender's loans in one status
+type LoanStatusTotal struct {
+	Status    string  `json:"status"`
+	Count     int     `json:"count"`
+	Principal float64 `json:"principal"`
+}
+
+// Exposure is a risk snapshot of a lender's active loans; a loan is overdue once its final due date
+// has passed. The principal fields repeat Outstanding.Principal and Overdue.Principal, which the
+// default rate and concentration are measured against.
+type Exposure struct {
+	Outstanding                Split         `json:"outstanding"`
+	Overdue                    Split         `json:"overdue"`
+	OutstandingPrincipal       float64       `json:"outstanding_principal"`
+	OverduePrincipal           float64       `json:"overdue_principal"`
+	ActiveLoans                int           `json:"active_loans"`
+	OverdueLoans               int           `json:"overdue_loans"`
+	OriginatedLoans            int           `json:"originated_loans"` // Active, paid and defaulted loans
+	DefaultedLoans             int           `json:"defaulted_loans"`
+	DefaultRate                float64       `json:"default_rate"` // DefaultedLoans / OriginatedLoans
+	LargestBorrowerID          sql.NullInt64 `json:"largest_borrower_id"`
+	LargestBorrowerOutstanding float64       `json:"largest_borrower_outstanding"` // Principal
+	Concentration              float64       `json:"concentration"`                // Largest borrower's share of OutstandingPrincipal
+}
+
+// loanStatuses is every Loans.Payment_Status, in the order the portfolio summary lists them
+const loanStatuses = `statuses (Status, Position) AS (
+	VALUES ('pending', 1), ('active', 2), ('paid', 3), ('defaulted', 4), ('cancelled', 5)
+)`
+
+// Portfolio reports the lender's loan book as of the end of a day. day is the midnight that starts
+// it in the lender's location, and receipts recorded before the following midnight count.
+func (r *Reporter) Portfolio(lenderID int, day time.Time) (*Portfolio, error) {
+	summary := &Portfolio{AsOf: day.Format(time.DateOnly), Loans: []LoanStatusTotal{}}
+	until := day.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+
+	rows, err := r.db.Query(`WITH `+loanStatuses+`
+		SELECT s.Status, COUNT(lo.Loan_ID), COALESCE(SUM(lo.Amount), 0)
+		FROM statuses s
+		LEFT JOIN Loans lo ON lo.Payment_Status = s.Status AND lo.Lender_ID = ? AND lo.Start_Date <= ?
+		GROUP BY s.Status, s.Position
+		ORDER BY s.Position`, lenderID, summary.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total LoanStatusTotal
+		if err := rows.Scan(&total.Status, &total.Count, &total.Principal); err != nil {
+			return nil, err
+		}
+		summary.Loans = append(summary.Loans, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	derived, err := r.derivedPayments(lenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var principal, interest, overdue float64
+	var collected Split
+	err = r.db.QueryRow(`WITH `+balances+`, `+allocated+`, book AS (
+			SELECT * FROM balances WHERE Start_Date <= ?
+		), outstanding AS (
+			SELECT
+				COALESCE(SUM(Principal), 0) AS Principal,
+				COALESCE(SUM(Interest), 0) AS Interest,
+				COALESCE(SUM(CASE WHEN Overdue THEN Principal + Interest END), 0) AS Overdue
+			FROM book WHERE Payment_Status = 'active'
+		), collected AS (
+			SELECT COALESCE(SUM(Principal), 0) AS Principal, COALESCE(SUM(Interest), 0) AS Interest, COALESCE(SUM(Penalties), 0) AS Penalties
+			FROM allocated WHERE DATETIME(Timestamp) < DATETIME(?)
+		)
+		SELECT o.Principal, o.Interest, o.Overdue, c.Principal, c.Interest, c.Penalties,
+			(SELECT COALESCE(AVG(Amount), 0) FROM book WHERE Payment_Status IN ('active', 'paid', 'defaulted'))
+		FROM outstanding o, collected c`,
+		lenderID, until, derived, summary.AsOf, lenderID, lenderID, summary.AsOf, until).Scan(
+		&principal, &interest, &overdue,
+		&collected.Principal, &collected.Interest, &collected.Penalties,
+		&summary.AverageLoanSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	summary.Outstanding = NewSplit(principal, interest, 0)
+	summary.Collected = NewSplit(collected.Principal, collected.Interest, collected.Penalties)
+	summary.TotalCollected = summary.Collected.Total
+	summary.PortfolioAtRisk = percentOf(overdue, principal+interest)
+	return summary, nil
+}
+
+// LoanBook returns the balance of every loan of the lender started on or before a day, by Loan_ID,
+// counting the receipts recorded before the day ends like Portfolio. day is the midnight that
+// starts it in the lender's location.
+func (r *Reporter) LoanBook(lenderID int, day time.Time) ([]LoanBalance, error) {
+	asOf := day.Format(time.DateOnly)
+	until := day.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+	derived, err := r.derivedPayments(lenderID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(`WITH `+balances+`
+		SELECT Loan_ID, Payment_Status, Principal, Interest FROM balances WHERE Start_Date <= ? ORDER BY Loan_ID`,
+		lenderID, until, derived, asOf, lenderID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	book := []LoanBalance{}
+	for rows.Next() {
+		var b LoanBalance
+		var principal, interest float64
+		if err := rows.Scan(&b.LoanID, &b.Status, &principal, &interest); err != nil {
+			return nil, err
+		}
+		b.Outstanding = NewSplit(principal, interest, 0)
+		book = append(book, b)
+	}
+	return book, rows.Err()
+}
+
+// Exposure computes the lender's risk snapshot as of the given moment, from the receipts recorded
+// by the end of its day in its location.
+func (r *Reporter) Exposure(lenderID int, asOf time.Time) (*Exposure, error) {
+	var e Exposure
+	day := startOfDay(asOf)
+	until := day.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+	derived, err := r.derivedPayments(lenderID)
+	if err != nil {
+		return nil, err
+	}
+	args := []any{lenderID, until, derived, day.Format(time.DateOnly), lenderID}
+
+	var principal, interest, overduePrincipal, overdueInterest float64
+	err = r.db.QueryRow(`WITH `+balances+`, active AS (
+			SELECT * FROM balances WHERE Payment_Status = 'active'
+		)
+		SELECT
+			COALESCE(SUM(Principal), 0),
+			COALESCE(SUM(Interest), 0),
+			COALESCE(SUM(CASE WHEN Overdue THEN Principal END), 0),
+			COALESCE(SUM(CASE WHEN Overdue THEN Interest END), 0),
+			COUNT(*),
+			COUNT(CASE WHEN Overdue THEN 1 END),
+			(SELECT COUNT(*) FROM balances WHERE Payment_Status IN ('active', 'paid', 'defaulted')),
+			(SELECT COUNT(*) FROM balances WHERE Payment_Status = 'defaulted')
+		FROM active`, args...).Scan(
+		&principal, &interest, &overduePrincipal, &overdueInterest,
+		&e.ActiveLoans,
+		&e.OverdueLoans,
+		&e.OriginatedLoans,
+		&e.DefaultedLoans,
+	)
+	if err != nil {
+		return nil, err
+	}
+	e.Outstanding = NewSplit(principal, interest, 0)
+	e.Overdue = NewSplit(overduePrincipal, overdueInterest, 0)
+	e.OutstandingPrincipal, e.OverduePrincipal = e.Outstanding.Principal, e.Overdue.Principal
+
+	var borrowerID int64
+	err = r.db.QueryRow(`WITH `+balances+`
+		SELECT Borrower_ID, SUM(Principal) AS Total FROM balances WHERE Payment_Status = 'active'
+		GROUP BY Borrower_ID ORDER BY Total DESC, Borrower_ID LIMIT 1`, args...).Scan(&borrowerID, &e.LargestBorrowerOutstanding)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		e.LargestBorrowerID = sql.NullInt64{Int64: borrowerID, Valid: true}
+	}
+
+	if e.OriginatedLoans > 0 {
+		e.DefaultRate = float64(e.DefaultedLoans) / float64(e.OriginatedLoans)
+	}
+	if e.OutstandingPrincipal > 0 {
+		e.Concentration = e.LargestBorrowerOutstanding / e.OutstandingPrincipal
+	}
+	return &e, nil
+}
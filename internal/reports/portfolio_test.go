@@ -0,0 +1,196 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestExposure(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "exposed")
+	otherID := seedLender(t, db, "otherexposed")
+	borrowerA := seedBorrower(t, db, "a@example.com")
+	borrowerB := seedBorrower(t, db, "b@example.com")
+	borrowerC := seedBorrower(t, db, "c@example.com")
+	receipt := func(loanID int, status string, amount float64) {
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: status, Amount: amount})
+	}
+
+	// Test case 1: No loans yet
+	e, err := reporter.Exposure(lenderID, time.Now())
+	if err != nil {
+		t.Fatalf("Exposure failed: %v", err)
+	}
+	if e.OutstandingPrincipal != 0 || e.DefaultRate != 0 || e.Concentration != 0 || e.LargestBorrowerID.Valid {
+		t.Errorf("Expected an empty snapshot, got %+v", e)
+	}
+
+	// Borrower A: 8000 outstanding after a paid receipt, plus 5000 on a loan past its final due date
+	current := seedLoan(t, db, lenderID, borrowerA, "active", 10000, 10, 12)
+	receipt(current, "paid", 2000)
+	overdue := seedLoan(t, db, lenderID, borrowerA, "active", 5000, 10, 6)
+	db.Exec("UPDATE Loans SET Start_Date = DATE('now', '-1 year') WHERE Loan_ID = ?", overdue)
+	// Borrower B: failed receipts do not reduce the 3000 outstanding, and overpaid loans owe nothing
+	owing := seedLoan(t, db, lenderID, borrowerB, "active", 3000, 10, 12)
+	receipt(owing, "failed", 1000)
+	overpaid := seedLoan(t, db, lenderID, borrowerB, "active", 1000, 10, 12)
+	receipt(overpaid, "paid", 1500)
+	seedLoan(t, db, lenderID, borrowerB, "paid", 4000, 10, 12)
+	// Borrower C: one default; pending and cancelled loans were never originated
+	seedLoan(t, db, lenderID, borrowerC, "defaulted", 2000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerC, "pending", 1000, 10, 12)
+	seedLoan(t, db, lenderID, borrowerC, "cancelled", 1000, 10, 12)
+	// Other lenders' loans are ignored
+	seedLoan(t, db, otherID, borrowerC, "active", 50000, 10, 12)
+
+	// Test case 2: Each metric over the seeded book
+	e, err = reporter.Exposure(lenderID, time.Now())
+	if err != nil {
+		t.Fatalf("Exposure failed: %v", err)
+	}
+	if e.OutstandingPrincipal != 16000 || e.OverduePrincipal != 5000 || e.ActiveLoans != 4 || e.OverdueLoans != 1 {
+		t.Errorf("Unexpected outstanding: %+v", e)
+	}
+	if e.OriginatedLoans != 6 || e.DefaultedLoans != 1 || e.DefaultRate != 1.0/6 {
+		t.Errorf("Unexpected defaults: %+v", e)
+	}
+	if e.LargestBorrowerID.Int64 != int64(borrowerA) || e.LargestBorrowerOutstanding != 13000 || e.Concentration != 13000.0/16000 {
+		t.Errorf("Unexpected concentration: %+v", e)
+	}
+	// Seeded loans have no stored payment, so interest is owed on their derived one
+	if e.Outstanding.Principal != e.OutstandingPrincipal || e.Outstanding.Interest <= 0 || e.Overdue.Interest <= 0 {
+		t.Errorf("Expected split balances with interest, got %+v and %+v", e.Outstanding, e.Overdue)
+	}
+	assertBalanced(t, "outstanding", e.Outstanding)
+	assertBalanced(t, "overdue", e.Overdue)
+
+	// Test case 3: Overdue is relative to the as-of day
+	e, _ = reporter.Exposure(lenderID, time.Now().AddDate(-1, 0, 0))
+	if e.OverduePrincipal != 0 {
+		t.Errorf("Expected nothing overdue a year ago, got %v", e.OverduePrincipal)
+	}
+}
+
+func TestPortfolio(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "portfolio")
+	otherID := seedLender(t, db, "otherportfolio")
+	borrowerID := seedBorrower(t, db, "portfolio@example.com")
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	receipt := func(loanID int, status string, amount float64, at time.Time) {
+		seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: status, Amount: amount, Timestamp: models.NewJSONTime(at)})
+	}
+
+	// Test case 1: A lender with no loans gets every status and explicit zeros
+	summary, err := reporter.Portfolio(lenderID, today)
+	if err != nil {
+		t.Fatalf("Portfolio failed: %v", err)
+	}
+	if len(summary.Loans) != 5 || summary.Loans[0].Status != "pending" || summary.Loans[4].Status != "cancelled" {
+		t.Fatalf("Expected all five statuses, got %+v", summary.Loans)
+	}
+	for _, total := range summary.Loans {
+		if total.Count != 0 || total.Principal != 0 {
+			t.Errorf("Expected no %s loans, got %+v", total.Status, total)
+		}
+	}
+	if summary.Outstanding != (Split{}) || summary.TotalCollected != 0 || summary.AverageLoanSize != 0 || summary.PortfolioAtRisk != 0 {
+		t.Errorf("Expected zeros, got %+v", summary)
+	}
+
+	// A current loan repaying 1200 on 1000, 300 paid: 700 principal and 200 interest outstanding
+	current := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100 WHERE Loan_ID = ?", current)
+	receipt(current, "paid", 300, today.Add(time.Hour))
+	receipt(current, "failed", 100, today.Add(time.Hour))
+	// An overdue loan repaying 600 on 500, overpaid into its interest: 50 interest outstanding
+	overdue := seedLoan(t, db, lenderID, borrowerID, "active", 500, 20, 6)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = DATE('now', '-1 year') WHERE Loan_ID = ?", overdue)
+	receipt(overdue, "paid", 550, today.AddDate(0, 0, -30))
+	paid := seedLoan(t, db, lenderID, borrowerID, "paid", 3000, 10, 12)
+	receipt(paid, "paid", 3000, today.AddDate(0, 0, -60))
+	seedLoan(t, db, lenderID, borrowerID, "pending", 2000, 10, 12)
+	seedLoan(t, db, otherID, borrowerID, "active", 50000, 10, 12)
+
+	// Test case 2: Each figure over the seeded book
+	summary, err = reporter.Portfolio(lenderID, today)
+	if err != nil {
+		t.Fatalf("Portfolio failed: %v", err)
+	}
+	counts := map[string]LoanStatusTotal{}
+	for _, total := range summary.Loans {
+		counts[total.Status] = total
+	}
+	if counts["active"].Count != 2 || counts["active"].Principal != 1500 || counts["paid"].Count != 1 || counts["pending"].Principal != 2000 {
+		t.Errorf("Unexpected status totals: %+v", summary.Loans)
+	}
+	want := Split{Principal: 700, Interest: 250, Total: 950}
+	if summary.Outstanding != want {
+		t.Errorf("Expected outstanding %+v, got %+v", want, summary.Outstanding)
+	}
+	if summary.TotalCollected != 3850 || summary.AverageLoanSize != 1500 {
+		t.Errorf("Unexpected collections: %+v", summary)
+	}
+	// Only the overdue loan's receipt reached its interest
+	if summary.Collected != (Split{Principal: 3800, Interest: 50, Total: 3850}) {
+		t.Errorf("Unexpected collected split: %+v", summary.Collected)
+	}
+	if summary.PortfolioAtRisk != 100.0*50/950 {
+		t.Errorf("Expected %v%% at risk, got %v", 100.0*50/950, summary.PortfolioAtRisk)
+	}
+
+	// Test case 3: An earlier day leaves out later receipts and loans started since
+	summary, _ = reporter.Portfolio(lenderID, today.AddDate(0, 0, -1))
+	if summary.AsOf != today.AddDate(0, 0, -1).Format(time.DateOnly) || summary.TotalCollected != 3550 {
+		t.Errorf("Expected only earlier receipts, got %+v", summary)
+	}
+	if summary.Outstanding.Total != 50 || summary.PortfolioAtRisk != 100 {
+		t.Errorf("Expected only the overdue loan outstanding, got %+v", summary)
+	}
+
+	// Test case 4: A loan stored without a monthly payment owes the interest of its derived one,
+	// 12 payments of 92.63 on 1000, as well as the overdue loan's 50
+	db.Exec("UPDATE Loans SET Monthly_Payment = NULL WHERE Loan_ID = ?", current)
+	summary, _ = reporter.Portfolio(lenderID, today)
+	if got := summary.Outstanding.Interest; got != 161.56 {
+		t.Errorf("Expected 161.56 interest outstanding, got %+v", summary.Outstanding)
+	}
+	assertBalanced(t, "outstanding", summary.Outstanding)
+}
+
+func TestLoanBook(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "loanbook")
+	otherID := seedLender(t, db, "otherloanbook")
+	borrowerID := seedBorrower(t, db, "loanbook@example.com")
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	current := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = DATE('now', '-1 month') WHERE Loan_ID = ?", current)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: current, Status: "paid", Amount: 300, Timestamp: models.NewJSONTime(today.Add(time.Hour))})
+	paid := seedLoan(t, db, lenderID, borrowerID, "paid", 500, 10, 6)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: paid, Status: "paid", Amount: 600, Timestamp: models.NewJSONTime(today.AddDate(0, 0, -10))})
+	future := seedLoan(t, db, lenderID, borrowerID, "pending", 800, 10, 6)
+	db.Exec("UPDATE Loans SET Start_Date = DATE('now', '+1 month') WHERE Loan_ID = ?", future)
+	seedLoan(t, db, otherID, borrowerID, "active", 5000, 10, 12)
+
+	// Test case 1: Every loan started by the day, with its own balance and status
+	book, err := reporter.LoanBook(lenderID, today)
+	if err != nil {
+		t.Fatalf("LoanBook failed: %v", err)
+	}
+	if len(book) != 2 || book[0].LoanID != current || book[1].LoanID != paid || book[1].Status != "paid" {
+		t.Fatalf("Expected the two loans started, got %+v", book)
+	}
+	if book[0].Outstanding != (Split{Principal: 700, Interest: 200, Total: 900}) || book[1].Outstanding.Total != 0 {
+		t.Errorf("Unexpected balances: %+v", book)
+	}
+
+	// Test case 2: An earlier day leaves out later receipts and loans started since
+	book, _ = reporter.LoanBook(lenderID, today.AddDate(0, 0, -1))
+	if len(book) != 1 || book[0].Outstanding.Total != 1200 {
+		t.Errorf("Expected only the current loan, unpaid, the day before, got %+v", book)
+	}
+}
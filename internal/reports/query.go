@@ -0,0 +1,367 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery is returned, wrapped with the reason, for report query specifications that name
+// an unknown entity, field, operator or function or give a value of the wrong type.
+var ErrInvalidQuery = errors.New("invalid report query")
+
+// Report query limits
+const (
+	MaxQueryFilters    = 20
+	MaxQueryGroupBy    = 3
+	MaxQueryAggregates = 10
+	MaxQueryInValues   = 100
+	MaxQueryRows       = 1000
+	maxQueryTextLength = 200
+)
+
+// QuerySpec is a constrained report specification: the lender's records of one entity, narrowed by
+// filters, grouped by up to three fields and summarised by aggregates. Every name is looked up in
+// the entity's allowlist and every value is bound as a parameter, so a specification never adds
+// SQL of its own.
+type QuerySpec struct {
+	Entity     string           `json:"entity"`
+	Filters    []QueryFilter    `json:"filters"`
+	GroupBy    []string         `json:"group_by"`
+	Aggregates []QueryAggregate `json:"aggregates"`
+}
+
+// QueryFilter compares a field with a value. Op is one of eq, ne, lt, lte, gt, gte and in, which
+// takes a list; text and boolean fields only take eq, ne and in.
+type QueryFilter struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+// QueryAggregate is count, which takes no field, or sum, avg, min or max of a numeric field
+type QueryAggregate struct {
+	Func  string `json:"func"`
+	Field string `json:"field,omitempty"`
+}
+
+// QueryResult is the rows a report query returned, one per group, with the specification they
+// answer. Columns name the group fields in order, then the aggregates as count or func_field.
+// Truncated is set when there were more than MaxQueryRows groups.
+type QueryResult struct {
+	Spec      QuerySpec `json:"spec"`
+	Columns   []string  `json:"columns"`
+	Rows      [][]any   `json:"rows"`
+	Truncated bool      `json:"truncated"`
+}
+
+// Query field kinds, which decide the values and operators a filter takes
+const (
+	kindInt       = "int"
+	kindNumber    = "number"
+	kindText      = "text"
+	kindBool      = "bool"
+	kindDate      = "date"      // YYYY-MM-DD calendar day
+	kindMonth     = "month"     // YYYY-MM
+	kindTimestamp = "timestamp" // Filter only: RFC3339, or a YYYY-MM-DD date starting in the lender's time zone
+)
+
+// queryField is one field an entity exposes: the SQL expression it stands for, its kind and
+// whether it may be grouped by and aggregated
+type queryField struct {
+	expr      string
+	kind      string
+	groupable bool
+	numeric   bool
+}
+
+// queryEntity is an entity a report query can read: its FROM clause, scoped to the lender by a
+// single parameter, and its fields
+type queryEntity struct {
+	from   string
+	fields map[string]queryField
+}
+
+// queryEntities is the allowlist of entities and their fields
+var queryEntities = map[string]queryEntity{
+	"loans": {
+		from: "FROM Loans lo WHERE lo.Lender_ID = ?",
+		fields: map[string]queryField{
+			"loan_id":         {expr: "lo.Loan_ID", kind: kindInt},
+			"borrower_id":     {expr: "lo.Borrower_ID", kind: kindInt, groupable: true},
+			"status":          {expr: "lo.Payment_Status", kind: kindText, groupable: true},
+			"amount":          {expr: "lo.Amount", kind: kindNumber, numeric: true},
+			"interest_rate":   {expr: "lo.Interest_Rate", kind: kindNumber, groupable: true, numeric: true},
+			"months_to_pay":   {expr: "lo.Months_To_Pay", kind: kindInt, groupable: true, numeric: true},
+			"monthly_payment": {expr: "lo.Monthly_Payment", kind: kindNumber, numeric: true},
+			"origination_fee": {expr: "lo.Origination_Fee", kind: kindNumber, numeric: true},
+			"start_date":      {expr: "DATE(lo.Start_Date)", kind: kindDate, groupable: true},
+			"start_month":     {expr: "strftime('%Y-%m', lo.Start_Date)", kind: kindMonth, groupable: true},
+			"end_date":        {expr: "DATE(lo.End_Date)", kind: kindDate, groupable: true},
+		},
+	},
+	"receipts": {
+		from: "FROM Recipets r WHERE r.Lender_ID = ?",
+		fields: map[string]queryField{
+			"receipt_id":     {expr: "r.Recipet_ID", kind: kindInt},
+			"loan_id":        {expr: "r.Loan_ID", kind: kindInt, groupable: true},
+			"status":         {expr: "r.Status", kind: kindText, groupable: true},
+			"amount":         {expr: "r.Amount", kind: kindNumber, numeric: true},
+			"payment_method": {expr: "COALESCE(r.Payment_Method, '')", kind: kindText, groupable: true},
+			"recorded_at":    {expr: "DATETIME(r.Timestamp)", kind: kindTimestamp},
+		},
+	},
+	// Borrowers are shared between lenders, so a lender sees those holding one of its loans
+	"borrowers": {
+		from: "FROM Borrowers b WHERE EXISTS (SELECT 1 FROM Loans WHERE Borrower_ID = b.Borrower_ID AND Lender_ID = ?)",
+		fields: map[string]queryField{
+			"borrower_id":    {expr: "b.Borrower_ID", kind: kindInt},
+			"is_active":      {expr: "COALESCE(b.Is_Active, 0) = 1", kind: kindBool, groupable: true},
+			"email_verified": {expr: "b.Email_Verified = 1", kind: kindBool, groupable: true},
+			"city":           {expr: "COALESCE(b.City, '')", kind: kindText, groupable: true},
+			"region":         {expr: "COALESCE(b.Region, '')", kind: kindText, groupable: true},
+			"country":        {expr: "COALESCE(b.Country, '')", kind: kindText, groupable: true},
+		},
+	},
+}
+
+// queryOperators maps filter operators to SQL, and aggregateFuncs the aggregate functions
+var (
+	queryOperators = map[string]string{"eq": "=", "ne": "<>", "lt": "<", "lte": "<=", "gt": ">", "gte": ">=", "in": "IN"}
+	aggregateFuncs = map[string]string{"count": "COUNT", "sum": "SUM", "avg": "AVG", "min": "MIN", "max": "MAX"}
+)
+
+// QueryError is an ErrInvalidQuery with the reason, which is written for the client
+type QueryError struct {
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return ErrInvalidQuery.Error() + ": " + e.Reason
+}
+
+// Is lets errors.Is(err, ErrInvalidQuery) match any QueryError.
+func (e *QueryError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+// PublicMessage reports the reason to clients, who see only ErrInvalidQuery's text otherwise.
+func (e *QueryError) PublicMessage() string {
+	return e.Error()
+}
+
+// invalidQuery returns a QueryError with the formatted reason
+func invalidQuery(format string, args ...any) error {
+	return &QueryError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// compiledQuery is a report query compiled to SQL, with the kind of each column
+type compiledQuery struct {
+	sql     string
+	args    []any
+	columns []string
+	kinds   []string
+}
+
+// compileQuery checks spec against the allowlists and compiles it to a parameterized query over the
+// lender's records. Timestamps given as dates start at midnight in loc. Duplicate group fields and
+// aggregates are dropped from the returned spec.
+func compileQuery(spec QuerySpec, lenderID int, loc *time.Location) (*compiledQuery, QuerySpec, error) {
+	entity, ok := queryEntities[spec.Entity]
+	if !ok {
+		return nil, spec, invalidQuery("entity must be one of loans, receipts, borrowers")
+	}
+	switch {
+	case len(spec.Filters) > MaxQueryFilters:
+		return nil, spec, invalidQuery("at most %d filters are allowed", MaxQueryFilters)
+	case len(spec.GroupBy) > MaxQueryGroupBy:
+		return nil, spec, invalidQuery("at most %d group_by fields are allowed", MaxQueryGroupBy)
+	case len(spec.Aggregates) == 0:
+		return nil, spec, invalidQuery("aggregates must name at least one aggregate")
+	case len(spec.Aggregates) > MaxQueryAggregates:
+		return nil, spec, invalidQuery("at most %d aggregates are allowed", MaxQueryAggregates)
+	}
+	normalized := QuerySpec{Entity: spec.Entity, Filters: spec.Filters, GroupBy: []string{}, Aggregates: []QueryAggregate{}}
+	if normalized.Filters == nil {
+		normalized.Filters = []QueryFilter{}
+	}
+	q := &compiledQuery{args: []any{lenderID}}
+
+	var selects, groups []string
+	for _, name := range spec.GroupBy {
+		field, ok := entity.fields[name]
+		if !ok || !field.groupable {
+			return nil, spec, invalidQuery("%q cannot be grouped by for %s", name, spec.Entity)
+		}
+		if slices.Contains(normalized.GroupBy, name) {
+			continue
+		}
+		normalized.GroupBy = append(normalized.GroupBy, name)
+		selects = append(selects, field.expr)
+		groups = append(groups, field.expr)
+		q.columns = append(q.columns, name)
+		q.kinds = append(q.kinds, field.kind)
+	}
+	for _, agg := range spec.Aggregates {
+		fn, ok := aggregateFuncs[agg.Func]
+		if !ok {
+			return nil, spec, invalidQuery("aggregate func must be one of count, sum, avg, min, max")
+		}
+		column, expr := "count", "COUNT(*)"
+		if agg.Func == "count" {
+			if agg.Field != "" {
+				return nil, spec, invalidQuery("count takes no field")
+			}
+		} else {
+			field, ok := entity.fields[agg.Field]
+			if !ok || !field.numeric {
+				return nil, spec, invalidQuery("%s needs a numeric field of %s, got %q", agg.Func, spec.Entity, agg.Field)
+			}
+			column = agg.Func + "_" + agg.Field
+			expr = "ROUND(" + fn + "(" + field.expr + "), 2)"
+		}
+		if slices.Contains(q.columns, column) {
+			continue
+		}
+		normalized.Aggregates = append(normalized.Aggregates, agg)
+		selects = append(selects, expr)
+		q.columns = append(q.columns, column)
+		q.kinds = append(q.kinds, kindNumber)
+	}
+
+	where := ""
+	for _, filter := range spec.Filters {
+		field, ok := entity.fields[filter.Field]
+		if !ok {
+			return nil, spec, invalidQuery("unknown filter field %q for %s", filter.Field, spec.Entity)
+		}
+		op, ok := queryOperators[filter.Op]
+		if !ok {
+			return nil, spec, invalidQuery("op must be one of eq, ne, lt, lte, gt, gte, in")
+		}
+		if (field.kind == kindText || field.kind == kindBool) && op != "=" && op != "<>" && op != "IN" {
+			return nil, spec, invalidQuery("%s only takes eq, ne and in", filter.Field)
+		}
+		if op == "IN" {
+			values, ok := filter.Value.([]any)
+			if !ok || len(values) == 0 || len(values) > MaxQueryInValues {
+				return nil, spec, invalidQuery("in takes a list of 1 to %d values for %s", MaxQueryInValues, filter.Field)
+			}
+			for _, v := range values {
+				arg, err := queryValue(filter.Field, field.kind, v, loc)
+				if err != nil {
+					return nil, spec, err
+				}
+				q.args = append(q.args, arg)
+			}
+			where += " AND (" + field.expr + ") IN (?" + strings.Repeat(", ?", len(values)-1) + ")"
+			continue
+		}
+		arg, err := queryValue(filter.Field, field.kind, filter.Value, loc)
+		if err != nil {
+			return nil, spec, err
+		}
+		q.args = append(q.args, arg)
+		where += " AND (" + field.expr + ") " + op + " ?"
+	}
+
+	q.sql = "SELECT " + strings.Join(selects, ", ") + " " + entity.from + where
+	if len(groups) > 0 {
+		q.sql += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+	q.sql += fmt.Sprintf(" LIMIT %d", MaxQueryRows+1)
+	return q, normalized, nil
+}
+
+// queryValue checks a filter value decoded from JSON against its field's kind and returns it as a
+// query argument
+func queryValue(name, kind string, value any, loc *time.Location) (any, error) {
+	switch kind {
+	case kindInt:
+		if n, ok := value.(float64); ok && n == math.Trunc(n) && math.Abs(n) <= 1<<53 {
+			return int64(n), nil
+		}
+		return nil, invalidQuery("%s takes whole numbers", name)
+	case kindNumber:
+		if n, ok := value.(float64); ok {
+			return n, nil
+		}
+		return nil, invalidQuery("%s takes numbers", name)
+	case kindBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, invalidQuery("%s takes true or false", name)
+	}
+
+	text, ok := value.(string)
+	if !ok || len(text) > maxQueryTextLength {
+		return nil, invalidQuery("%s takes text of at most %d characters", name, maxQueryTextLength)
+	}
+	switch kind {
+	case kindDate:
+		if _, err := time.Parse(time.DateOnly, text); err != nil {
+			return nil, invalidQuery("%s takes YYYY-MM-DD dates", name)
+		}
+	case kindMonth:
+		if _, err := time.Parse("2006-01", text); err != nil {
+			return nil, invalidQuery("%s takes YYYY-MM months", name)
+		}
+	case kindTimestamp:
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			if t, err = time.ParseInLocation(time.DateOnly, text, loc); err != nil {
+				return nil, invalidQuery("%s takes YYYY-MM-DD dates or RFC3339 timestamps", name)
+			}
+		}
+		return t.UTC().Format(time.DateTime), nil
+	}
+	return text, nil
+}
+
+// Query runs a report query over the lender's records, returning at most MaxQueryRows groups.
+// Filters on timestamps given as dates start at midnight in loc.
+func (r *Reporter) Query(lenderID int, spec QuerySpec, loc *time.Location) (*QueryResult, error) {
+	q, normalized, err := compileQuery(spec, lenderID, loc)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(q.sql, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &QueryResult{Spec: normalized, Columns: q.columns, Rows: [][]any{}}
+	for rows.Next() {
+		if len(result.Rows) == MaxQueryRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(q.columns))
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case []byte:
+				values[i] = string(v)
+			case int64:
+				if q.kinds[i] == kindBool {
+					values[i] = v == 1
+				}
+			case time.Time:
+				values[i] = v.Format(time.DateOnly)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,175 @@
+package reports
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// decodeSpec decodes a specification the way the endpoint does, so values arrive as JSON types
+func decodeSpec(t *testing.T, body string) QuerySpec {
+	t.Helper()
+	var spec QuerySpec
+	if err := json.Unmarshal([]byte(body), &spec); err != nil {
+		t.Fatalf("Failed to decode %s: %v", body, err)
+	}
+	return spec
+}
+
+func TestCompileQuery_Rejects(t *testing.T) {
+	count := `"aggregates": [{"func": "count"}]`
+	for _, body := range []string{
+		// Entities outside the allowlist, including table names and injected SQL
+		`{"entity": "Loans", ` + count + `}`,
+		`{"entity": "accounts", ` + count + `}`,
+		`{"entity": "loans; DROP TABLE Loans", ` + count + `}`,
+		`{"entity": "", ` + count + `}`,
+		// Filter fields that are columns, expressions or injections rather than allowlisted names
+		`{"entity": "loans", "filters": [{"field": "Lender_ID", "op": "eq", "value": 2}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "lo.Lender_ID", "op": "eq", "value": 2}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "AMOUNT", "op": "gt", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount) OR (1=1", "op": "gt", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount > 0 OR 1", "op": "eq", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount--", "op": "eq", "value": 1}], ` + count + `}`,
+		`{"entity": "borrowers", "filters": [{"field": "email", "op": "eq", "value": "a@example.com"}], ` + count + `}`,
+		`{"entity": "receipts", "filters": [{"field": "start_date", "op": "eq", "value": "2026-01-01"}], ` + count + `}`,
+		// Operators outside the allowlist
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "=", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "= 1 OR 1 =", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "like", "value": "%"}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "EQ", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "gt", "value": "active"}], ` + count + `}`,
+		`{"entity": "borrowers", "filters": [{"field": "is_active", "op": "lt", "value": true}], ` + count + `}`,
+		// Values of the wrong type or shape
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "gt", "value": "1 OR 1=1"}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "months_to_pay", "op": "eq", "value": 1.5}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "eq", "value": 1}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "eq", "value": ["active"]}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "in", "value": "active"}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "in", "value": []}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "in", "value": ["active", 2]}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "start_date", "op": "gte", "value": "2026-01-01' OR '1'='1"}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "start_month", "op": "eq", "value": "2026-13"}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "eq", "value": null}], ` + count + `}`,
+		`{"entity": "loans", "filters": [{"field": "status", "op": "eq", "value": "` + strings.Repeat("a", 201) + `"}], ` + count + `}`,
+		`{"entity": "receipts", "filters": [{"field": "recorded_at", "op": "gte", "value": "yesterday"}], ` + count + `}`,
+		`{"entity": "borrowers", "filters": [{"field": "is_active", "op": "eq", "value": 1}], ` + count + `}`,
+		// Group fields outside the allowlist, or not groupable
+		`{"entity": "loans", "group_by": ["Payment_Status"], ` + count + `}`,
+		`{"entity": "loans", "group_by": ["1"], ` + count + `}`,
+		`{"entity": "loans", "group_by": ["status, (SELECT Password_Hash FROM Accounts)"], ` + count + `}`,
+		`{"entity": "loans", "group_by": ["loan_id"], ` + count + `}`,
+		`{"entity": "loans", "group_by": ["amount"], ` + count + `}`,
+		`{"entity": "loans", "group_by": ["status", "borrower_id", "start_month", "months_to_pay"], ` + count + `}`,
+		// Aggregate functions and fields outside the allowlist
+		`{"entity": "loans"}`,
+		`{"entity": "loans", "aggregates": []}`,
+		`{"entity": "loans", "aggregates": [{"func": "COUNT"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "group_concat", "field": "status"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "sum(amount)); --", "field": "amount"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "count", "field": "amount"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "sum"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "sum", "field": "status"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "sum", "field": "lo.Amount"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "max", "field": "amount) FROM Accounts --"}]}`,
+		`{"entity": "borrowers", "aggregates": [{"func": "sum", "field": "borrower_id"}]}`,
+	} {
+		_, _, err := compileQuery(decodeSpec(t, body), 1, time.UTC)
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected %s to be rejected, got %v", body, err)
+		}
+	}
+}
+
+func TestCompileQuery_Limits(t *testing.T) {
+	tooMany := func(n int, item string) string {
+		return strings.TrimSuffix(strings.Repeat(item+", ", n), ", ")
+	}
+
+	// Test case 1: Filters, aggregates and in lists are capped
+	for _, body := range []string{
+		`{"entity": "loans", "filters": [` + tooMany(MaxQueryFilters+1, `{"field": "amount", "op": "gt", "value": 1}`) + `], "aggregates": [{"func": "count"}]}`,
+		`{"entity": "loans", "aggregates": [` + tooMany(MaxQueryAggregates+1, `{"func": "count"}`) + `]}`,
+		`{"entity": "loans", "filters": [{"field": "loan_id", "op": "in", "value": [` + tooMany(MaxQueryInValues+1, "1") + `]}], "aggregates": [{"func": "count"}]}`,
+	} {
+		if _, _, err := compileQuery(decodeSpec(t, body), 1, time.UTC); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected the limit to be enforced, got %v", err)
+		}
+	}
+
+	// Test case 2: Values are bound as parameters and the SQL only holds allowlisted expressions
+	q, spec, err := compileQuery(decodeSpec(t, `{"entity": "loans",
+		"filters": [{"field": "status", "op": "in", "value": ["active", "x') OR 1=1 --"]}],
+		"group_by": ["status", "status"], "aggregates": [{"func": "count"}, {"func": "sum", "field": "amount"}, {"func": "count"}]}`), 7, time.UTC)
+	if err != nil {
+		t.Fatalf("compileQuery failed: %v", err)
+	}
+	if strings.Contains(q.sql, "OR 1=1") || strings.Count(q.sql, "?") != 3 || len(q.args) != 3 || q.args[0] != 7 {
+		t.Errorf("Expected the values as parameters after the lender, got %s %v", q.sql, q.args)
+	}
+	if len(spec.GroupBy) != 1 || len(spec.Aggregates) != 2 || strings.Join(q.columns, ",") != "status,count,sum_amount" {
+		t.Errorf("Expected duplicates dropped, got %+v %v", spec, q.columns)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "querylender")
+	otherID := seedLender(t, db, "queryother")
+	first := seedBorrower(t, db, "query1@example.com")
+	second := seedBorrower(t, db, "query2@example.com")
+	db.Exec("UPDATE Borrowers SET City = 'Maseru', Email_Verified = 1 WHERE Borrower_ID = ?", first)
+	seedLoan(t, db, lenderID, first, "active", 1000, 10, 12)
+	seedLoan(t, db, lenderID, first, "active", 500, 10, 6)
+	paidID := seedLoan(t, db, lenderID, second, "paid", 300, 10, 6)
+	seedLoan(t, db, otherID, second, "active", 9000, 10, 12)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: paidID, Status: "paid", Amount: 120, PaymentMethod: sql.NullString{String: "mpesa", Valid: true}, Timestamp: models.NewJSONTime(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC))})
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: paidID, Status: "paid", Amount: 80, Timestamp: models.NewJSONTime(time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC))})
+
+	run := func(body string) *QueryResult {
+		t.Helper()
+		result, err := reporter.Query(lenderID, decodeSpec(t, body), time.UTC)
+		if err != nil {
+			t.Fatalf("Query %s failed: %v", body, err)
+		}
+		return result
+	}
+
+	// Test case 1: Loans grouped by status, only the lender's
+	result := run(`{"entity": "loans", "group_by": ["status"], "aggregates": [{"func": "count"}, {"func": "sum", "field": "amount"}]}`)
+	if len(result.Rows) != 2 || result.Rows[0][0] != "active" || result.Rows[0][1] != int64(2) || result.Rows[0][2] != 1500.0 ||
+		result.Rows[1][0] != "paid" || result.Rows[1][2] != 300.0 {
+		t.Errorf("Unexpected loans by status: %v", result.Rows)
+	}
+
+	// Test case 2: Filters narrow the rows, and an injected value matches nothing
+	result = run(`{"entity": "loans", "filters": [{"field": "amount", "op": "gte", "value": 500}, {"field": "months_to_pay", "op": "eq", "value": 12}], "aggregates": [{"func": "count"}]}`)
+	if result.Rows[0][0] != int64(1) {
+		t.Errorf("Expected one loan of 500 or more over 12 months, got %v", result.Rows)
+	}
+	result = run(`{"entity": "loans", "filters": [{"field": "status", "op": "eq", "value": "x' OR '1'='1"}], "aggregates": [{"func": "count"}]}`)
+	if result.Rows[0][0] != int64(0) {
+		t.Errorf("Expected the value to be matched literally, got %v", result.Rows)
+	}
+
+	// Test case 3: Receipts filtered by when they were recorded
+	result = run(`{"entity": "receipts", "filters": [{"field": "recorded_at", "op": "gte", "value": "2026-03-03"}], "group_by": ["payment_method"], "aggregates": [{"func": "sum", "field": "amount"}]}`)
+	if len(result.Rows) != 1 || result.Rows[0][0] != "" || result.Rows[0][1] != 80.0 {
+		t.Errorf("Expected the receipt of the 5th, got %v", result.Rows)
+	}
+
+	// Test case 4: Borrowers are the lender's through its loans, with booleans reported as such
+	result = run(`{"entity": "borrowers", "group_by": ["email_verified"], "aggregates": [{"func": "count"}]}`)
+	if len(result.Rows) != 2 || result.Rows[0][0] != false || result.Rows[1][0] != true || result.Rows[1][1] != int64(1) {
+		t.Errorf("Unexpected borrowers: %v", result.Rows)
+	}
+	if strings.Join(result.Columns, ",") != "email_verified,count" || result.Spec.Entity != "borrowers" {
+		t.Errorf("Expected the columns and spec echoed, got %v %+v", result.Columns, result.Spec)
+	}
+}
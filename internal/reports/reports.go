@@ -0,0 +1,167 @@
+// Package reports aggregates a lender's money movements for the dashboard and report endpoints.
+// Every amount it reports is a Split of principal, interest and penalties whose parts add up to its
+// total: collections come from the receipt allocations made as receipts are recorded, and what is
+// outstanding is split the same way, with payments applied to principal first.
+//
+// Report days and months run midnight to midnight in the location of the times passed in, which
+// callers set to the lender's time zone.
+package reports
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Report granularities: the buckets a daily report is grouped into
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week" // Monday to Sunday
+	GranularityMonth = "month"
+)
+
+// Split is an amount of money broken into the principal, interest and penalties it paid or owes.
+// No penalties are charged yet, so Penalties is always 0.
+type Split struct {
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	Penalties float64 `json:"penalties"`
+	Total     float64 `json:"total"`
+}
+
+// NewSplit rounds each part to cents and totals them
+func NewSplit(principal, interest, penalties float64) Split {
+	s := Split{
+		Principal: finance.RoundCents(principal),
+		Interest:  finance.RoundCents(interest),
+		Penalties: finance.RoundCents(penalties),
+	}
+	s.Total = finance.RoundCents(s.Principal + s.Interest + s.Penalties)
+	return s
+}
+
+// Add returns the part-by-part sum of two splits
+func (s Split) Add(o Split) Split {
+	return NewSplit(s.Principal+o.Principal, s.Interest+o.Interest, s.Penalties+o.Penalties)
+}
+
+// Reporter runs the report queries against the database.
+type Reporter struct {
+	db *sql.DB
+}
+
+// NewReporter creates a Reporter reading from db
+func NewReporter(db *sql.DB) *Reporter {
+	return &Reporter{db: db}
+}
+
+// allocated is the lender's paid receipts with their allocation. Args: lender.
+const allocated = `allocated AS (
+	SELECT r.Loan_ID, r.Timestamp, a.Principal, a.Interest, a.Penalties
+	FROM Receipt_Allocations a JOIN Recipets r ON r.Recipet_ID = a.Recipet_ID
+	WHERE a.Lender_ID = ? AND r.Status = 'paid'
+)`
+
+// AllLenders is the lender ID that widens a report to every lender on the platform. Only the admin
+// API passes it; lender endpoints always pass the caller's own lender.
+const AllLenders = 0
+
+// allocation is what one paid receipt was allocated to, when the receipt was recorded and the
+// currency of its lender
+type allocation struct {
+	at                             time.Time
+	currency                       string
+	principal, interest, penalties float64
+}
+
+// allocations returns the lender's paid receipt allocations recorded from from until until, oldest
+// first, or every lender's for AllLenders. SQLite's date functions only know UTC, so callers bucket
+// them by day or month in Go.
+func (r *Reporter) allocations(lenderID int, from, until time.Time) ([]allocation, error) {
+	query := `SELECT r.Timestamp, le.Currency, a.Principal, a.Interest, a.Penalties
+		FROM Receipt_Allocations a
+		JOIN Recipets r ON r.Recipet_ID = a.Recipet_ID
+		JOIN Lenders le ON le.Lender_ID = a.Lender_ID
+		WHERE r.Status = 'paid' AND DATETIME(r.Timestamp) >= DATETIME(?) AND DATETIME(r.Timestamp) < DATETIME(?)`
+	args := []any{from.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339)}
+	if lenderID != AllLenders {
+		query += " AND a.Lender_ID = ?"
+		args = append(args, lenderID)
+	}
+	rows, err := r.db.Query(query+" ORDER BY DATETIME(r.Timestamp)", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var allocs []allocation
+	for rows.Next() {
+		var a allocation
+		if err := rows.Scan(&a.at, &a.currency, &a.principal, &a.interest, &a.penalties); err != nil {
+			return nil, err
+		}
+		allocs = append(allocs, a)
+	}
+	return allocs, rows.Err()
+}
+
+// startOfDay returns the midnight starting t's day in t's location
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// balances is each of the lender's loans with what is still owed on it once the paid receipts
+// recorded before a moment are applied, principal first, and whether its final due date is before
+// a day. Interest is the scheduled repayments above the principal, taking the derived payment of
+// loans stored without one from a JSON object keyed by Loan_ID (see derivedPayments).
+// Args: lender, moment, derived payments, day, lender.
+const balances = `paid AS (
+	SELECT Loan_ID, SUM(Amount) AS Total FROM Recipets
+	WHERE Lender_ID = ? AND Status = 'paid' AND DATETIME(Timestamp) < DATETIME(?)
+	GROUP BY Loan_ID
+), balances AS (
+	SELECT lo.Loan_ID, lo.Borrower_ID, lo.Payment_Status, lo.Amount, lo.Start_Date,
+		MAX(lo.Amount - COALESCE(paid.Total, 0), 0) AS Principal,
+		MAX(MAX(COALESCE(NULLIF(MAX(lo.Monthly_Payment, 0), 0), json_extract(?, '$."' || lo.Loan_ID || '"'), 0) * lo.Months_To_Pay, lo.Amount)
+			- MAX(lo.Amount, COALESCE(paid.Total, 0)), 0) AS Interest,
+		COALESCE(lo.End_Date, DATE(lo.Start_Date, '+' || lo.Months_To_Pay || ' months')) < ? AS Overdue
+	FROM Loans lo
+	LEFT JOIN paid ON paid.Loan_ID = lo.Loan_ID
+	WHERE lo.Lender_ID = ?
+)`
+
+// derivedPayments returns, as a JSON object keyed by Loan_ID, the derived monthly payments of the
+// lender's loans stored without a usable one, for the balances query
+func (r *Reporter) derivedPayments(lenderID int) (string, error) {
+	rows, err := r.db.Query(`SELECT Loan_ID, Amount, Interest_Rate, Months_To_Pay FROM Loans
+		WHERE Lender_ID = ? AND (Monthly_Payment IS NULL OR Monthly_Payment <= 0)`, lenderID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	payments := make(map[string]float64)
+	for rows.Next() {
+		var id, months int
+		var amount, rate float64
+		if err := rows.Scan(&id, &amount, &rate, &months); err != nil {
+			return "", err
+		}
+		payments[strconv.Itoa(id)] = finance.MonthlyPayment(amount, rate, months)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(payments)
+	return string(data), err
+}
+
+// percentOf returns part as a percentage of whole, or 0 when whole is not positive
+func percentOf(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return 100 * part / whole
+}
@@ -0,0 +1,94 @@
+package reports
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// setupTestDB opens an in-memory database with the full schema and returns a Reporter over it.
+func setupTestDB(t *testing.T) (*sql.DB, *Reporter) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	// Each connection to ":memory:" is a separate database, so pin the pool to one
+	db.SetMaxOpenConns(1)
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, NewReporter(db)
+}
+
+// seedLender creates a lender with an account and returns the lender ID.
+func seedLender(t *testing.T, db *sql.DB, username string) int {
+	repo := repository.NewAuthRepository(db)
+	accountID, err := repo.CreateLenderAndAccount(username+" Business", username+"@example.com", "123", username, "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	account, err := repo.GetAccountByID(accountID)
+	if err != nil {
+		t.Fatalf("Failed to load seeded account: %v", err)
+	}
+	return account.LenderID
+}
+
+// seedBorrower inserts a borrower and returns its ID.
+func seedBorrower(t *testing.T, db *sql.DB, email string) int {
+	res, err := db.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Test Borrower', ?, '555')", email)
+	if err != nil {
+		t.Fatalf("Failed to seed borrower: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// seedLoan inserts a loan starting today, with a stored monthly payment of 0, and returns its ID.
+func seedLoan(t *testing.T, db *sql.DB, lenderID, borrowerID int, status string, amount, rate float64, months int) int {
+	res, err := db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date)
+		VALUES (?, ?, ?, ?, ?, ?, 0, DATE('now'))`, borrowerID, lenderID, months, status, amount, rate)
+	if err != nil {
+		t.Fatalf("Failed to seed loan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// seedReceipt records a receipt through the receipt repository, so paid receipts are allocated.
+func seedReceipt(t *testing.T, db *sql.DB, lenderID int, receipt models.Receipt) {
+	t.Helper()
+	if _, err := repository.NewReceiptRepository(db).CreateReceipt(lenderID, &receipt); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+}
+
+// assertBalanced fails the test when a split's parts do not add up to its total
+func assertBalanced(t *testing.T, label string, s Split) {
+	t.Helper()
+	if math.Abs(s.Principal+s.Interest+s.Penalties-s.Total) > 0.001 {
+		t.Errorf("%s: parts of %+v do not add up to the total", label, s)
+	}
+}
+
+func TestNewSplit(t *testing.T) {
+	// Test case 1: Parts are rounded to cents and totalled
+	s := NewSplit(0.1, 0.2, 0.004)
+	if s.Principal != 0.1 || s.Interest != 0.2 || s.Penalties != 0 || s.Total != 0.3 {
+		t.Errorf("Unexpected split: %+v", s)
+	}
+	assertBalanced(t, "rounded", s)
+
+	// Test case 2: Adding splits adds each part
+	sum := NewSplit(100, 20, 0).Add(NewSplit(50.555, 0.445, 1))
+	if sum != (Split{Principal: 150.56, Interest: 20.45, Penalties: 1, Total: 172.01}) {
+		t.Errorf("Unexpected sum: %+v", sum)
+	}
+	assertBalanced(t, "sum", sum)
+}
@@ -0,0 +1,198 @@
+package reports
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention follows a lender's borrowers from the month of their first loan: for each later month,
+// how many of them took another loan. Loans count by the calendar month they start in.
+type Retention struct {
+	From            string            `json:"from"` // YYYY-MM, the oldest cohort
+	To              string            `json:"to"`   // YYYY-MM, inclusive
+	Cohorts         []RetentionCohort `json:"cohorts"`
+	Borrowers       int               `json:"borrowers"`        // Every borrower with an issued loan, whatever the range
+	RepeatBorrowers int               `json:"repeat_borrowers"` // Those of Borrowers with more than one issued loan
+	RepeatRate      float64           `json:"repeat_rate"`      // RepeatBorrowers as a percentage of Borrowers
+}
+
+// RetentionCohort is one row of the retention matrix. Returned[k] is how many of the cohort's
+// borrowers started another loan k months after the cohort's month, k = 0 being the month itself;
+// it runs up to the report's last month, so later cohorts have shorter rows.
+type RetentionCohort struct {
+	Cohort      string    `json:"cohort"` // YYYY-MM of the borrowers' first loan
+	Borrowers   int       `json:"borrowers"`
+	Returned    []int     `json:"returned"`
+	ReturnedPct []float64 `json:"returned_pct"` // Returned as percentages of Borrowers
+}
+
+// retentionCounts is what the retention matrix is built from: borrowers per cohort, borrowers per
+// cohort taking another loan per month, and the repeat totals
+type retentionCounts struct {
+	cohorts         map[string]int
+	returned        map[string]map[string]int // Cohort, then month of the later loan
+	borrowers       int
+	repeatBorrowers int
+}
+
+// issuedLoans is the lender's issued loans, numbered per borrower from their first. Args: lender.
+const issuedLoans = `issued AS (
+	SELECT Borrower_ID, STRFTIME('%Y-%m', Start_Date) AS Month,
+		ROW_NUMBER() OVER (PARTITION BY Borrower_ID ORDER BY Start_Date, Loan_ID) AS N
+	FROM Loans
+	WHERE Lender_ID = ? AND Payment_Status IN ('active', 'paid', 'defaulted')
+), firsts AS (
+	SELECT Borrower_ID, Month AS Cohort FROM issued WHERE N = 1
+)`
+
+// Retention reports the cohorts of borrowers whose first loan with the lender started from the month
+// of from to the month of to, inclusive. The counts come from a window query when the SQLite
+// library supports window functions (3.25.0 and later), and otherwise from retentionCountsInGo,
+// which reads every issued loan and numbers them itself.
+func (r *Reporter) Retention(lenderID int, from, to time.Time) (*Retention, error) {
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	report := &Retention{From: start.Format("2006-01"), To: end.Format("2006-01"), Cohorts: []RetentionCohort{}}
+
+	windows, err := r.hasWindowFunctions()
+	if err != nil {
+		return nil, err
+	}
+	var counts *retentionCounts
+	if windows {
+		counts, err = r.retentionCountsInSQL(lenderID)
+	} else {
+		counts, err = r.retentionCountsInGo(lenderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for cohort := start; !cohort.After(end); cohort = cohort.AddDate(0, 1, 0) {
+		key := cohort.Format("2006-01")
+		row := RetentionCohort{Cohort: key, Borrowers: counts.cohorts[key], Returned: []int{}, ReturnedPct: []float64{}}
+		for month := cohort; !month.After(end); month = month.AddDate(0, 1, 0) {
+			n := counts.returned[key][month.Format("2006-01")]
+			row.Returned = append(row.Returned, n)
+			row.ReturnedPct = append(row.ReturnedPct, percentOf(float64(n), float64(row.Borrowers)))
+		}
+		report.Cohorts = append(report.Cohorts, row)
+	}
+	report.Borrowers, report.RepeatBorrowers = counts.borrowers, counts.repeatBorrowers
+	report.RepeatRate = percentOf(float64(counts.repeatBorrowers), float64(counts.borrowers))
+	return report, nil
+}
+
+// hasWindowFunctions reports whether the linked SQLite library supports window functions, added in 3.25.0
+func (r *Reporter) hasWindowFunctions() (bool, error) {
+	var version string
+	if err := r.db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return false, err
+	}
+	var parts [3]int
+	for i, part := range strings.SplitN(version, ".", 3) {
+		parts[i], _ = strconv.Atoi(part)
+	}
+	return parts[0] > 3 || parts[0] == 3 && parts[1] >= 25, nil
+}
+
+// retentionCountsInSQL counts the retention matrix with window functions
+func (r *Reporter) retentionCountsInSQL(lenderID int) (*retentionCounts, error) {
+	counts := &retentionCounts{cohorts: make(map[string]int), returned: make(map[string]map[string]int)}
+
+	rows, err := r.db.Query(`WITH `+issuedLoans+`
+		SELECT Cohort, COUNT(*) FROM firsts GROUP BY Cohort`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cohort string
+		var n int
+		if err := rows.Scan(&cohort, &n); err != nil {
+			return nil, err
+		}
+		counts.cohorts[cohort] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.Query(`WITH `+issuedLoans+`
+		SELECT f.Cohort, i.Month, COUNT(DISTINCT i.Borrower_ID)
+		FROM firsts f JOIN issued i ON i.Borrower_ID = f.Borrower_ID AND i.N > 1
+		GROUP BY f.Cohort, i.Month`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cohort, month string
+		var n int
+		if err := rows.Scan(&cohort, &month, &n); err != nil {
+			return nil, err
+		}
+		if counts.returned[cohort] == nil {
+			counts.returned[cohort] = make(map[string]int)
+		}
+		counts.returned[cohort][month] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRow(`WITH `+issuedLoans+`
+		SELECT COUNT(*), COUNT(CASE WHEN Loans > 1 THEN 1 END)
+		FROM (SELECT Borrower_ID, MAX(N) AS Loans FROM issued GROUP BY Borrower_ID)`, lenderID).
+		Scan(&counts.borrowers, &counts.repeatBorrowers)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// retentionCountsInGo counts the retention matrix from the lender's issued loans in start order, for
+// SQLite libraries without window functions
+func (r *Reporter) retentionCountsInGo(lenderID int) (*retentionCounts, error) {
+	counts := &retentionCounts{cohorts: make(map[string]int), returned: make(map[string]map[string]int)}
+
+	rows, err := r.db.Query(`SELECT Borrower_ID, STRFTIME('%Y-%m', Start_Date) FROM Loans
+		WHERE Lender_ID = ? AND Payment_Status IN ('active', 'paid', 'defaulted')
+		ORDER BY Borrower_ID, Start_Date, Loan_ID`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Rows arrive grouped by borrower, so the first row of each group is the borrower's first loan
+	previous, cohort, loans := -1, "", 0
+	seen := make(map[string]bool) // Borrower and month pairs already counted as returning
+	for rows.Next() {
+		var borrowerID int
+		var month string
+		if err := rows.Scan(&borrowerID, &month); err != nil {
+			return nil, err
+		}
+		if borrowerID != previous {
+			previous, cohort, loans = borrowerID, month, 0
+			counts.cohorts[cohort]++
+			counts.borrowers++
+		}
+		loans++
+		if loans == 1 {
+			continue
+		}
+		if loans == 2 {
+			counts.repeatBorrowers++
+		}
+		if key := strconv.Itoa(borrowerID) + " " + month; !seen[key] {
+			seen[key] = true
+			if counts.returned[cohort] == nil {
+				counts.returned[cohort] = make(map[string]int)
+			}
+			counts.returned[cohort][month]++
+		}
+	}
+	return counts, rows.Err()
+}
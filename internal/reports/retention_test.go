@@ -0,0 +1,76 @@
+package reports
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetention(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "retention")
+	otherID := seedLender(t, db, "otherretention")
+	borrower := func(email string, loans ...string) int {
+		t.Helper()
+		borrowerID := seedBorrower(t, db, email)
+		for _, start := range loans {
+			loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 6)
+			db.Exec("UPDATE Loans SET Start_Date = ? WHERE Loan_ID = ?", start, loanID)
+		}
+		return borrowerID
+	}
+	// Two loans in February count once, and the same-month return is offset 0
+	borrower("b1@example.com", "2026-01-10", "2026-02-05", "2026-02-20", "2026-04-01")
+	b2 := borrower("b2@example.com", "2026-01-15")
+	borrower("b3@example.com", "2026-01-20", "2026-01-25")
+	borrower("b4@example.com", "2026-02-03", "2026-03-03")
+	b5 := borrower("b5@example.com", "2026-03-11")
+	borrower("b6@example.com", "2025-11-01", "2026-02-01") // Cohort before the range
+	// Loans never issued, and other lenders' loans, do not count
+	pendingID := seedLoan(t, db, lenderID, b5, "pending", 1000, 10, 6)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-04-10' WHERE Loan_ID = ?", pendingID)
+	otherLoanID := seedLoan(t, db, otherID, b2, "active", 1000, 10, 6)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-02-01' WHERE Loan_ID = ?", otherLoanID)
+
+	// Test case 1: One row per cohort month, each running up to the last month
+	report, err := reporter.Retention(lenderID, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Retention failed: %v", err)
+	}
+	want := []RetentionCohort{
+		{Cohort: "2026-01", Borrowers: 3, Returned: []int{1, 1, 0, 1}, ReturnedPct: []float64{100.0 / 3, 100.0 / 3, 0, 100.0 / 3}},
+		{Cohort: "2026-02", Borrowers: 1, Returned: []int{0, 1, 0}, ReturnedPct: []float64{0, 100, 0}},
+		{Cohort: "2026-03", Borrowers: 1, Returned: []int{0, 0}, ReturnedPct: []float64{0, 0}},
+		{Cohort: "2026-04", Borrowers: 0, Returned: []int{0}, ReturnedPct: []float64{0}},
+	}
+	if report.From != "2026-01" || report.To != "2026-04" || !reflect.DeepEqual(report.Cohorts, want) {
+		t.Errorf("Unexpected matrix: %+v", report)
+	}
+
+	// Test case 2: The repeat rate covers every borrower, whatever their cohort
+	if report.Borrowers != 6 || report.RepeatBorrowers != 4 || report.RepeatRate != 400.0/6 {
+		t.Errorf("Unexpected repeat rate: %d of %d, %v", report.RepeatBorrowers, report.Borrowers, report.RepeatRate)
+	}
+
+	// Test case 3: The Go fallback counts the same as the window query
+	if ok, err := reporter.hasWindowFunctions(); err != nil || !ok {
+		t.Fatalf("Expected the bundled SQLite to support window functions, got %v %v", ok, err)
+	}
+	inSQL, err := reporter.retentionCountsInSQL(lenderID)
+	if err != nil {
+		t.Fatalf("retentionCountsInSQL failed: %v", err)
+	}
+	inGo, err := reporter.retentionCountsInGo(lenderID)
+	if err != nil {
+		t.Fatalf("retentionCountsInGo failed: %v", err)
+	}
+	if !reflect.DeepEqual(inSQL, inGo) {
+		t.Errorf("Expected the same counts, got %+v in SQL and %+v in Go", inSQL, inGo)
+	}
+
+	// Test case 4: A lender without loans gets an empty matrix rather than nulls
+	report, err = reporter.Retention(otherID+1000, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(report.Cohorts) != 1 || report.Cohorts[0].Returned == nil || report.RepeatRate != 0 {
+		t.Errorf("Unexpected empty report: %+v %v", report, err)
+	}
+}
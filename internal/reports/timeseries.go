@@ -0,0 +1,204 @@
+package reports
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+)
+
+// Time series metrics
+const (
+	MetricCollections   = "collections"   // Paid receipts recorded in the period
+	MetricDisbursements = "disbursements" // Principal of the issued loans starting in the period
+	MetricOutstanding   = "outstanding"   // What the issued loans still owed at the end of the period
+)
+
+// Point is one period of a time series. Period is the period's first day in the range as
+// YYYY-MM-DD, or YYYY-MM for months.
+type Point struct {
+	Period string  `json:"period"`
+	Value  float64 `json:"value"`
+}
+
+// period is one bucket of a time series, from the midnight of start to the midnight of end
+type period struct {
+	start, end time.Time
+}
+
+// periods splits the days from from to to, inclusive, into days, Monday-to-Sunday weeks or calendar
+// months in from's location, clipping the first and last to the range
+func periods(from, to time.Time, granularity string) []period {
+	var ps []period
+	last := to.AddDate(0, 0, 1)
+	for start := from; start.Before(last); {
+		var next time.Time
+		switch granularity {
+		case GranularityWeek:
+			next = start.AddDate(0, 0, 7-(int(start.Weekday())+6)%7)
+		case GranularityMonth:
+			next = time.Date(start.Year(), start.Month()+1, 1, 0, 0, 0, 0, start.Location())
+		default:
+			next = start.AddDate(0, 0, 1)
+		}
+		if next.After(last) {
+			next = last
+		}
+		ps = append(ps, period{start: start, end: next})
+		start = next
+	}
+	return ps
+}
+
+// PeriodCount returns the number of points a time series from the day of from to the day of to has
+func PeriodCount(from, to time.Time, granularity string) int {
+	return len(periods(startOfDay(from), startOfDay(to.In(from.Location())), granularity))
+}
+
+// TimeSeries charts one metric of the lender's book over the days from the day of from to the day of
+// to, inclusive, in from's location, with a zero for each period without activity. Collections and disbursements
+// are totals over each period. Outstanding is a balance at the end of each period, reconstructed
+// from the scheduled repayments of the active, paid and defaulted loans started by then, less their
+// paid receipts recorded by then; loan statuses are not kept over time, so defaulted loans stay on
+// the balance.
+func (r *Reporter) TimeSeries(lenderID int, metric, granularity string, from, to time.Time) ([]Point, error) {
+	loc := from.Location()
+	from, to = startOfDay(from), startOfDay(to.In(loc))
+	ps := periods(from, to, granularity)
+	points := make([]Point, len(ps))
+	for i, p := range ps {
+		points[i].Period = p.start.Format(time.DateOnly)
+		if granularity == GranularityMonth {
+			points[i].Period = p.start.Format("2006-01")
+		}
+	}
+	if len(ps) == 0 {
+		return points, nil
+	}
+
+	if metric == MetricOutstanding {
+		return points, r.fillOutstanding(lenderID, ps, points)
+	}
+
+	// add counts value in the period the moment at falls in
+	add := func(at time.Time, value float64) {
+		if i := sort.Search(len(ps), func(i int) bool { return ps[i].end.After(at) }); i < len(ps) {
+			points[i].Value += value
+		}
+	}
+	if metric == MetricDisbursements {
+		// Start dates are calendar days, so they are compared as dates rather than moments
+		rows, err := r.db.Query(`SELECT DATE(Start_Date), SUM(Amount) FROM Loans
+			WHERE Lender_ID = ? AND Payment_Status IN ('active', 'paid', 'defaulted') AND DATE(Start_Date) BETWEEN ? AND ?
+			GROUP BY DATE(Start_Date)`,
+			lenderID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var day string
+			var value float64
+			if err := rows.Scan(&day, &value); err != nil {
+				return nil, err
+			}
+			at, err := time.ParseInLocation(time.DateOnly, day, loc)
+			if err != nil {
+				return nil, err
+			}
+			add(at, value)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		allocs, err := r.allocations(lenderID, from, to.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range allocs {
+			add(a.at, a.principal+a.interest+a.penalties)
+		}
+	}
+	for i := range points {
+		points[i].Value = finance.RoundCents(points[i].Value)
+	}
+	return points, nil
+}
+
+// fillOutstanding sets each point to what the lender's issued loans still owed at the end of its period
+func (r *Reporter) fillOutstanding(lenderID int, ps []period, points []Point) error {
+	end := ps[len(ps)-1].end
+
+	type loan struct {
+		id        int
+		start     time.Time
+		scheduled float64
+	}
+	var loans []loan
+	rows, err := r.db.Query(`SELECT Loan_ID, Amount, Interest_Rate, Months_To_Pay, Monthly_Payment, Start_Date FROM Loans
+		WHERE Lender_ID = ? AND Payment_Status IN ('active', 'paid', 'defaulted') AND DATE(Start_Date) < ?`,
+		lenderID, end.Format(time.DateOnly))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l loan
+		var amount, rate float64
+		var months int
+		var payment sql.NullFloat64
+		if err := rows.Scan(&l.id, &amount, &rate, &months, &payment, &l.start); err != nil {
+			return err
+		}
+		l.scheduled = max(finance.Instalment(payment, amount, rate, months)*float64(months), amount)
+		// Start dates are calendar days, which begin at midnight in the periods' location
+		l.start = time.Date(l.start.Year(), l.start.Month(), l.start.Day(), 0, 0, 0, 0, end.Location())
+		loans = append(loans, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	type receipt struct {
+		loanID int
+		at     time.Time
+		amount float64
+	}
+	var receipts []receipt
+	rows, err = r.db.Query(`SELECT Loan_ID, Timestamp, Amount FROM Recipets
+		WHERE Lender_ID = ? AND Status = 'paid' AND DATETIME(Timestamp) < DATETIME(?)
+		ORDER BY DATETIME(Timestamp)`, lenderID, end.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rc receipt
+		if err := rows.Scan(&rc.loanID, &rc.at, &rc.amount); err != nil {
+			return err
+		}
+		receipts = append(receipts, rc)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Walk the periods in order, applying the receipts recorded before each one ends
+	paid := make(map[int]float64)
+	next := 0
+	for i, p := range ps {
+		for ; next < len(receipts) && receipts[next].at.Before(p.end); next++ {
+			paid[receipts[next].loanID] += receipts[next].amount
+		}
+		var owed float64
+		for _, l := range loans {
+			if l.start.Before(p.end) {
+				owed += max(l.scheduled-paid[l.id], 0)
+			}
+		}
+		points[i].Value = finance.RoundCents(owed)
+	}
+	return nil
+}
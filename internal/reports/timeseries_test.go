@@ -0,0 +1,68 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestPeriodCount(t *testing.T) {
+	from := time.Date(2026, 1, 28, 0, 0, 0, 0, time.UTC) // A Wednesday
+	to := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	for granularity, want := range map[string]int{GranularityDay: 34, GranularityWeek: 6, GranularityMonth: 3} {
+		if got := PeriodCount(from, to, granularity); got != want {
+			t.Errorf("Expected %d %s periods, got %d", want, granularity, got)
+		}
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	db, reporter := setupTestDB(t)
+	lenderID := seedLender(t, db, "series")
+	otherID := seedLender(t, db, "otherseries")
+	borrowerID := seedBorrower(t, db, "series@example.com")
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	// Repays 1200 on 1000 from January 5th; a cancelled loan and another lender's are never counted
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 20, 12)
+	db.Exec("UPDATE Loans SET Monthly_Payment = 100, Start_Date = '2026-01-05' WHERE Loan_ID = ?", loanID)
+	cancelled := seedLoan(t, db, lenderID, borrowerID, "cancelled", 5000, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-01-05' WHERE Loan_ID = ?", cancelled)
+	other := seedLoan(t, db, otherID, borrowerID, "active", 7000, 20, 12)
+	db.Exec("UPDATE Loans SET Start_Date = '2026-01-05' WHERE Loan_ID = ?", other)
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "paid", Amount: 100, Timestamp: models.NewJSONTime(day(6).Add(10 * time.Hour))})
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "failed", Amount: 100, Timestamp: models.NewJSONTime(day(7))})
+	seedReceipt(t, db, lenderID, models.Receipt{LoanID: loanID, Status: "paid", Amount: 50, Timestamp: models.NewJSONTime(day(13))})
+
+	check := func(label string, got []Point, want []Point) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d points, got %+v", label, len(want), got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s point %d: expected %+v, got %+v", label, i, want[i], got[i])
+			}
+		}
+	}
+
+	// Test case 1: Daily collections, with zeros on days without receipts
+	got, err := reporter.TimeSeries(lenderID, MetricCollections, GranularityDay, day(5), day(7))
+	if err != nil {
+		t.Fatalf("TimeSeries failed: %v", err)
+	}
+	check("collections", got, []Point{{"2026-01-05", 0}, {"2026-01-06", 100}, {"2026-01-07", 0}})
+
+	// Test case 2: Weekly disbursements, the first week clipped to the range
+	got, _ = reporter.TimeSeries(lenderID, MetricDisbursements, GranularityWeek, day(1), day(14))
+	check("disbursements", got, []Point{{"2026-01-01", 0}, {"2026-01-05", 1000}, {"2026-01-12", 0}})
+
+	// Test case 3: The outstanding balance at the end of each week
+	got, _ = reporter.TimeSeries(lenderID, MetricOutstanding, GranularityWeek, day(1), day(14))
+	check("outstanding", got, []Point{{"2026-01-01", 0}, {"2026-01-05", 1100}, {"2026-01-12", 1050}})
+
+	// Test case 4: Monthly points are labelled by month
+	got, _ = reporter.TimeSeries(lenderID, MetricCollections, GranularityMonth, day(15), day(15).AddDate(0, 1, 0))
+	check("monthly", got, []Point{{"2026-01", 0}, {"2026-02", 0}})
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/models"
+)
+
+// AuditFilter narrows a lender's audit log; zero fields match everything
+type AuditFilter struct {
+	Action       string
+	ResourceType string
+	ResourceID   int
+	From         time.Time // Inclusive
+	To           time.Time // Exclusive
+}
+
+// AuditRepository defines the interface for Audit_Log database operations.
+type AuditRepository interface {
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, lenderID int, filter AuditFilter, limit, offset int) ([]models.AuditEntry, int, error)
+}
+
+// auditRepository implements AuditRepository using a SQLite database connection, or the
+// transaction carried by the context.
+type auditRepository struct {
+	db *sql.DB
+}
+
+// NewAuditRepository creates a new AuditRepository instance.
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// RecordAudit implements audit.Store
+func (r *auditRepository) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	return insertAuditEntry(ctx, Conn(ctx, r.db), entry)
+}
+
+// ListAuditEntries returns one page of the lender's audit log, newest first, and the number of
+// entries matching the filter.
+func (r *auditRepository) ListAuditEntries(ctx context.Context, lenderID int, filter AuditFilter, limit, offset int) ([]models.AuditEntry, int, error) {
+	conds := []string{"Lender_ID = ?"}
+	args := []any{lenderID}
+	if filter.Action != "" {
+		conds = append(conds, "Action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.ResourceType != "" {
+		conds = append(conds, "Resource_Type = ?")
+		args = append(args, filter.ResourceType)
+	}
+	if filter.ResourceID != 0 {
+		conds = append(conds, "Resource_ID = ?")
+		args = append(args, filter.ResourceID)
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "Created_At >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "Created_At < ?")
+		args = append(args, filter.To.UTC())
+	}
+	where := strings.Join(conds, " AND ")
+
+	conn := Conn(ctx, r.db)
+	var total int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM Audit_Log WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT Audit_ID, Lender_ID, Actor, Account_ID, Action, Resource_Type, Resource_ID,
+			Details, IP_Address, Created_At
+		FROM Audit_Log WHERE `+where+` ORDER BY Created_At DESC, Audit_ID DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.AuditID, &e.LenderID, &e.Actor, &e.AccountID, &e.Action, &e.ResourceType, &e.ResourceID,
+			&e.Details, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// recordAudit writes an Audit_Log row, built by audit.NewEntry like those of the audit.Auditor.
+// Pass the transaction making the change being audited, so the entry exists exactly when the
+// change does. details, when non-nil, is stored as JSON.
+func recordAudit(ctx context.Context, q DBTX, lenderID int, actor, action, resourceType string, resourceID int, details any, at time.Time) error {
+	entry, err := audit.NewEntry(ctx, audit.Event{
+		LenderID:     lenderID,
+		Actor:        actor,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      details,
+	}, at)
+	if err != nil {
+		return err
+	}
+	return insertAuditEntry(ctx, q, entry)
+}
+
+// insertAuditEntry writes entry with q
+func insertAuditEntry(ctx context.Context, q DBTX, entry models.AuditEntry) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO Audit_Log (Lender_ID, Actor, Account_ID, Action, Resource_Type, Resource_ID,
+			Details, IP_Address, Created_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.LenderID, entry.Actor, entry.AccountID, entry.Action, entry.ResourceType, entry.ResourceID,
+		entry.Details, entry.IPAddress, entry.CreatedAt)
+	return err
+}
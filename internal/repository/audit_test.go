@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/models"
+)
+
+func TestListAuditEntries(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuditRepository(db)
+	lenderID := seedLender(t, db, "audited")
+	otherID := seedLender(t, db, "other")
+	ctx := audit.WithSource(context.Background(), audit.AccountSource(7, "10.0.0.1"))
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, e := range []audit.Event{
+		{LenderID: lenderID, Action: models.AuditBorrowerCreated, ResourceType: "borrower", ResourceID: 1},
+		{LenderID: lenderID, Action: models.AuditLoanCreated, ResourceType: "loan", ResourceID: 2},
+		{LenderID: lenderID, Action: models.AuditLoanPaid, ResourceType: "loan", ResourceID: 2},
+		{LenderID: otherID, Action: models.AuditLoanPaid, ResourceType: "loan", ResourceID: 3},
+	} {
+		entry, err := audit.NewEntry(ctx, e, day.AddDate(0, 0, i))
+		if err != nil {
+			t.Fatalf("NewEntry failed: %v", err)
+		}
+		if err := repo.RecordAudit(context.Background(), entry); err != nil {
+			t.Fatalf("RecordAudit failed: %v", err)
+		}
+	}
+
+	// Test case 1: Only the lender's entries, newest first, with their source
+	entries, total, err := repo.ListAuditEntries(context.Background(), lenderID, AuditFilter{}, 2, 0)
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if total != 3 || len(entries) != 2 || entries[0].Action != models.AuditLoanPaid || entries[1].Action != models.AuditLoanCreated {
+		t.Fatalf("Unexpected page of %d: %+v", total, entries)
+	}
+	if entries[0].AccountID.Int64 != 7 || entries[0].IPAddress.String != "10.0.0.1" || entries[0].Actor != "account:7" {
+		t.Errorf("Unexpected source: %+v", entries[0])
+	}
+
+	// Test case 2: Filters combine
+	checks := []struct {
+		filter AuditFilter
+		want   int
+	}{
+		{AuditFilter{Action: models.AuditLoanPaid}, 1},
+		{AuditFilter{ResourceType: "loan"}, 2},
+		{AuditFilter{ResourceType: "loan", ResourceID: 2, Action: models.AuditLoanCreated}, 1},
+		{AuditFilter{From: day.AddDate(0, 0, 1)}, 2},
+		{AuditFilter{From: day.AddDate(0, 0, 1), To: day.AddDate(0, 0, 2)}, 1},
+	}
+	for _, check := range checks {
+		if _, total, err := repo.ListAuditEntries(context.Background(), lenderID, check.filter, 50, 0); err != nil || total != check.want {
+			t.Errorf("%+v: expected %d entries, got %d (%v)", check.filter, check.want, total, err)
+		}
+	}
+
+	// Test case 3: Entries written in a repository's transaction carry the source too
+	tx, _ := db.Begin()
+	if err := recordAudit(ctx, tx, lenderID, "account:7", models.AuditLoanReassigned, "loan", 2, nil, day); err != nil {
+		t.Fatalf("recordAudit failed: %v", err)
+	}
+	tx.Commit()
+	reassigned, _, _ := repo.ListAuditEntries(context.Background(), lenderID, AuditFilter{Action: models.AuditLoanReassigned}, 50, 0)
+	if len(reassigned) != 1 || reassigned[0].IPAddress.String != "10.0.0.1" || reassigned[0].Details.Valid {
+		t.Errorf("Unexpected entries: %+v", reassigned)
+	}
+}
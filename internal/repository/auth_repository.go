@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -9,17 +10,39 @@ import (
 )
 
 var (
-	ErrAccountNotFound = errors.New("account not found")
-	ErrLenderNotFound  = errors.New("lender not found")
+	ErrAccountNotFound   = errors.New("account not found")
+	ErrLenderNotFound    = errors.New("lender not found")
+	ErrDuplicateEmail    = errors.New("email already registered")
+	ErrDuplicateUsername = errors.New("username already taken")
+
+	ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+	ErrRegistrationLimit = errors.New("too many registrations from this address")
 )
 
+// RegistrationLimit caps how many lenders one client address may register: at most Max since
+// Since, or any number when Max is 0.
+type RegistrationLimit struct {
+	IP    string
+	Max   int
+	Since time.Time
+}
+
 // AuthRepository defines the interface for authentication-related database operations.
 type AuthRepository interface {
-	CreateLenderAndAccount(businessName, email, phone, username, passwordHash string, interestRate float64) (int, error)
+	CreateLenderAndAccount(businessName, email, phone, username, passwordHash string, interestRate float64, currency string) (int, error)
+	RegisterLender(limit RegistrationLimit, businessName, email, phone, username, passwordHash string, interestRate float64, currency string) (int, error)
 	GetAccountByUsername(username string) (*models.Account, error)
 	GetAccountByID(accountID int) (*models.Account, error)
 	GetLenderByAccountID(accountID int) (*models.Lender, error)
+	GetLenderByID(lenderID int) (*models.Lender, error)
 	UpdateLastLogin(accountID int) error
+	RecordFailedLogin(accountID, maxAttempts int, lockout time.Duration, now time.Time) (sql.NullTime, error)
+	GetAccountByEmail(email string) (*models.Account, error)
+	CreatePasswordReset(accountID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash, passwordHash string) error
+	GetAccountStatus(accountID int) (*models.AccountStatus, error)
+	RecordRegistration(lenderID int, ip string, at time.Time) error
+	CountRegistrations(ip string, since time.Time) (int, error)
 }
 
 // authRepository implements AuthRepository using a SQLite database connection.
@@ -33,7 +56,24 @@ func NewAuthRepository(db *sql.DB) AuthRepository {
 }
 
 // CreateLenderAndAccount creates a new lender and an associated account within a transaction.
-func (r *authRepository) CreateLenderAndAccount(businessName, email, phone, username, passwordHash string, interestRate float64) (int, error) {
+// If an active trial plan exists, the lender is also started on it. A taken email returns
+// ErrDuplicateEmail and a taken username ErrDuplicateUsername; when both are taken the email is reported.
+// currency is the lender's ISO 4217 code, validated by the caller.
+func (r *authRepository) CreateLenderAndAccount(businessName, email, phone, username, passwordHash string, interestRate float64, currency string) (int, error) {
+	return r.createLenderAndAccount(nil, businessName, email, phone, username, passwordHash, interestRate, currency)
+}
+
+// RegisterLender creates a lender and its account like CreateLenderAndAccount and records the
+// registration from limit.IP in the same transaction. The registration is written before the
+// address's registrations are counted, so concurrent registrations from one address cannot all
+// pass the check: past limit.Max nothing is created and ErrRegistrationLimit is returned.
+func (r *authRepository) RegisterLender(limit RegistrationLimit, businessName, email, phone, username, passwordHash string, interestRate float64, currency string) (int, error) {
+	return r.createLenderAndAccount(&limit, businessName, email, phone, username, passwordHash, interestRate, currency)
+}
+
+// createLenderAndAccount creates the lender and its account, recording and enforcing limit when
+// it is not nil
+func (r *authRepository) createLenderAndAccount(limit *RegistrationLimit, businessName, email, phone, username, passwordHash string, interestRate float64, currency string) (int, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return 0, err
@@ -43,14 +83,17 @@ func (r *authRepository) CreateLenderAndAccount(businessName, email, phone, user
 	now := time.Now()
 
 	// Insert into Lenders table first
-	stmtLender, err := tx.Prepare("INSERT INTO Lenders (Business_Name, Phone_Number, Email, Interest_Rate_Percent, Created_At, Updated_At) VALUES (?, ?, ?, ?, ?, ?)")
+	stmtLender, err := tx.Prepare("INSERT INTO Lenders (Business_Name, Phone_Number, Email, Interest_Rate_Percent, Currency, Created_At, Updated_At) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
 	defer stmtLender.Close()
 
-	resLender, err := stmtLender.Exec(businessName, phone, email, interestRate, now, now)
+	resLender, err := stmtLender.Exec(businessName, phone, email, interestRate, currency, now, now)
 	if err != nil {
+		if columns, ok := uniqueViolation(err); ok && columns == "Lenders.Email" {
+			return 0, ErrDuplicateEmail
+		}
 		return 0, err
 	}
 
@@ -68,6 +111,9 @@ func (r *authRepository) CreateLenderAndAccount(businessName, email, phone, user
 
 	resAccount, err := stmtAccount.Exec(lenderID, username, passwordHash, now, now)
 	if err != nil {
+		if columns, ok := uniqueViolation(err); ok && columns == "Accounts.Username" {
+			return 0, ErrDuplicateUsername
+		}
 		return 0, err
 	}
 
@@ -76,13 +122,34 @@ func (r *authRepository) CreateLenderAndAccount(businessName, email, phone, user
 		return 0, err
 	}
 
+	if limit != nil {
+		if err := recordRegistration(tx, int(lenderID), limit.IP, now); err != nil {
+			return 0, err
+		}
+		if limit.Max > 0 {
+			count, err := countRegistrations(tx, limit.IP, limit.Since)
+			if err != nil {
+				return 0, err
+			}
+			if count > limit.Max {
+				return 0, ErrRegistrationLimit
+			}
+		}
+	}
+
+	// New lenders start on the free trial plan when one is configured
+	if err := startTrial(context.Background(), tx, int(lenderID), now.UTC()); err != nil && !errors.Is(err, ErrNoTrialPlan) {
+		return 0, err
+	}
+
 	return int(accountID), tx.Commit()
 }
 
 // GetAccountByUsername retrieves an account by its username.
 func (r *authRepository) GetAccountByUsername(username string) (*models.Account, error) {
 	var account models.Account
-	query := `SELECT Account_ID, Lender_ID, Username, Password_Hash, Created_At, Updated_At, Last_Login, Is_Locked FROM Accounts WHERE Username = ?`
+	query := `SELECT Account_ID, Lender_ID, Username, Password_Hash, Created_At, Updated_At, Last_Login, Is_Locked,
+		Failed_Login_Attempts, Locked_Until FROM Accounts WHERE Username = ?`
 	err := r.db.QueryRow(query, username).Scan(
 		&account.AccountID,
 		&account.LenderID,
@@ -92,6 +159,8 @@ func (r *authRepository) GetAccountByUsername(username string) (*models.Account,
 		&account.UpdatedAt,
 		&account.LastLogin,
 		&account.IsLocked,
+		&account.FailedLoginAttempts,
+		&account.LockedUntil,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -105,7 +174,8 @@ func (r *authRepository) GetAccountByUsername(username string) (*models.Account,
 // GetAccountByID retrieves an account by its ID.
 func (r *authRepository) GetAccountByID(accountID int) (*models.Account, error) {
 	var account models.Account
-	query := `SELECT Account_ID, Lender_ID, Username, Password_Hash, Created_At, Updated_At, Last_Login, Is_Locked FROM Accounts WHERE Account_ID = ?`
+	query := `SELECT Account_ID, Lender_ID, Username, Password_Hash, Created_At, Updated_At, Last_Login, Is_Locked,
+		Failed_Login_Attempts, Locked_Until FROM Accounts WHERE Account_ID = ?`
 	err := r.db.QueryRow(query, accountID).Scan(
 		&account.AccountID,
 		&account.LenderID,
@@ -115,6 +185,8 @@ func (r *authRepository) GetAccountByID(accountID int) (*models.Account, error)
 		&account.UpdatedAt,
 		&account.LastLogin,
 		&account.IsLocked,
+		&account.FailedLoginAttempts,
+		&account.LockedUntil,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -127,7 +199,6 @@ func (r *authRepository) GetAccountByID(accountID int) (*models.Account, error)
 
 // GetLenderByAccountID retrieves a lender by its account ID.
 func (r *authRepository) GetLenderByAccountID(accountID int) (*models.Lender, error) {
-	var lender models.Lender
 	var lenderID int
 
 	// First, get the Lender_ID from the Accounts table using the Account_ID
@@ -139,22 +210,35 @@ func (r *authRepository) GetLenderByAccountID(accountID int) (*models.Lender, er
 		return nil, err
 	}
 
-	// Then, retrieve the lender details using the Lender_ID
-	query := `SELECT Lender_ID, Business_Name, Phone_Number, Email, Interest_Rate_Percent, Created_At, Updated_At, Is_Active FROM Lenders WHERE Lender_ID = ?`
-	err = r.db.QueryRow(query, lenderID).Scan(
+	// Then, retrieve the lender details using the Lender_ID. ErrLenderNotFound should not happen
+	// here if the foreign key constraint is enforced, as every account has a lender.
+	return r.GetLenderByID(lenderID)
+}
+
+// GetLenderByID retrieves a lender by its ID, or returns ErrLenderNotFound.
+func (r *authRepository) GetLenderByID(lenderID int) (*models.Lender, error) {
+	var lender models.Lender
+	query := `SELECT Lender_ID, Business_Name, Phone_Number, Email, Interest_Rate_Percent, Currency, Timezone, Created_At, Updated_At, Is_Active, Logo_File_ID,
+		Suspended_At, Suspended_By, Suspension_Reason, Webhook_URL FROM Lenders WHERE Lender_ID = ?`
+	err := r.db.QueryRow(query, lenderID).Scan(
 		&lender.LenderID,
 		&lender.BusinessName,
 		&lender.PhoneNumber,
 		&lender.Email,
 		&lender.InterestRatePercent,
+		&lender.Currency,
+		&lender.Timezone,
 		&lender.CreatedAt,
 		&lender.UpdatedAt,
 		&lender.IsActive,
+		&lender.LogoFileID,
+		&lender.SuspendedAt,
+		&lender.SuspendedBy,
+		&lender.SuspensionReason,
+		&lender.WebhookURL,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			// This case should ideally not happen if the foreign key constraint is properly enforced
-			// and an account always has a corresponding lender.
 			return nil, ErrLenderNotFound
 		}
 		return nil, err
@@ -162,9 +246,10 @@ func (r *authRepository) GetLenderByAccountID(accountID int) (*models.Lender, er
 	return &lender, nil
 }
 
-// UpdateLastLogin updates the Last_Login timestamp for a given account.
+// UpdateLastLogin updates the Last_Login timestamp for a given account after a successful login,
+// clearing its failed attempts and any lapsed temporary lockout.
 func (r *authRepository) UpdateLastLogin(accountID int) error {
-	stmt, err := r.db.Prepare("UPDATE Accounts SET Last_Login = ? WHERE Account_ID = ?")
+	stmt, err := r.db.Prepare("UPDATE Accounts SET Last_Login = ?, Failed_Login_Attempts = 0, Locked_Until = NULL WHERE Account_ID = ?")
 	if err != nil {
 		return err
 	}
@@ -172,4 +257,148 @@ func (r *authRepository) UpdateLastLogin(accountID int) error {
 
 	_, err = stmt.Exec(time.Now(), accountID)
 	return err
-}
\ No newline at end of file
+}
+
+// RecordFailedLogin counts a failed login. Once maxAttempts consecutive failures are reached the
+// account is locked until now+lockout and the count starts again; the returned time is the lockout
+// end when this failure triggered one. The admin hard lock (Is_Locked) is never changed here.
+func (r *authRepository) RecordFailedLogin(accountID, maxAttempts int, lockout time.Duration, now time.Time) (sql.NullTime, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var attempts int
+	err = tx.QueryRow("UPDATE Accounts SET Failed_Login_Attempts = Failed_Login_Attempts + 1 WHERE Account_ID = ? RETURNING Failed_Login_Attempts",
+		accountID).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sql.NullTime{}, ErrAccountNotFound
+		}
+		return sql.NullTime{}, err
+	}
+
+	var lockedUntil sql.NullTime
+	if maxAttempts > 0 && attempts >= maxAttempts {
+		lockedUntil = sql.NullTime{Time: now.Add(lockout).UTC(), Valid: true}
+		_, err = tx.Exec("UPDATE Accounts SET Failed_Login_Attempts = 0, Locked_Until = ? WHERE Account_ID = ?", lockedUntil, accountID)
+		if err != nil {
+			return sql.NullTime{}, err
+		}
+	}
+	return lockedUntil, tx.Commit()
+}
+
+// RecordRegistration records that the lender was registered from the given client address
+func (r *authRepository) RecordRegistration(lenderID int, ip string, at time.Time) error {
+	return recordRegistration(r.db, lenderID, ip, at)
+}
+
+// CountRegistrations returns how many lenders were registered from the given client address since
+// the given time
+func (r *authRepository) CountRegistrations(ip string, since time.Time) (int, error) {
+	return countRegistrations(r.db, ip, since)
+}
+
+func recordRegistration(q DBTX, lenderID int, ip string, at time.Time) error {
+	_, err := q.ExecContext(context.Background(), "INSERT INTO Registrations (Lender_ID, IP_Address, Created_At) VALUES (?, ?, ?)",
+		lenderID, ip, at.UTC().Format(time.RFC3339))
+	return err
+}
+
+func countRegistrations(q DBTX, ip string, since time.Time) (int, error) {
+	var count int
+	err := q.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM Registrations WHERE IP_Address = ? AND DATETIME(Created_At) >= DATETIME(?)",
+		ip, since.UTC().Format(time.RFC3339)).Scan(&count)
+	return count, err
+}
+
+// GetAccountByEmail retrieves the first account of the lender registered with the given email.
+func (r *authRepository) GetAccountByEmail(email string) (*models.Account, error) {
+	var account models.Account
+	query := `SELECT a.Account_ID, a.Lender_ID, a.Username, a.Password_Hash, a.Created_At, a.Updated_At, a.Last_Login, a.Is_Locked,
+		a.Failed_Login_Attempts, a.Locked_Until
+		FROM Accounts a JOIN Lenders l ON l.Lender_ID = a.Lender_ID
+		WHERE l.Email = ? ORDER BY a.Account_ID LIMIT 1`
+	err := r.db.QueryRow(query, email).Scan(
+		&account.AccountID,
+		&account.LenderID,
+		&account.Username,
+		&account.PasswordHash,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+		&account.LastLogin,
+		&account.IsLocked,
+		&account.FailedLoginAttempts,
+		&account.LockedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreatePasswordReset stores the hash of a password reset token for an account.
+func (r *authRepository) CreatePasswordReset(accountID int, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec("INSERT INTO Password_Resets (Account_ID, Token_Hash, Expires_At, Created_At) VALUES (?, ?, ?, ?)",
+		accountID, tokenHash, expiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// ResetPassword consumes an unused, unexpired reset token and sets the account's password hash
+// in one transaction. It returns ErrInvalidResetToken if no such token exists.
+func (r *authRepository) ResetPassword(tokenHash, passwordHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	now := time.Now().UTC()
+	var resetID, accountID int
+	err = tx.QueryRow("SELECT Reset_ID, Account_ID FROM Password_Resets WHERE Token_Hash = ? AND Used_At IS NULL AND Expires_At > ?",
+		tokenHash, now).Scan(&resetID, &accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	res, err := tx.Exec("UPDATE Password_Resets SET Used_At = ? WHERE Reset_ID = ? AND Used_At IS NULL", now, resetID)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrInvalidResetToken
+	}
+
+	if _, err := tx.Exec("UPDATE Accounts SET Password_Hash = ? WHERE Account_ID = ?", passwordHash, accountID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAccountStatus returns the lock, token revocation and lender suspension state of an account.
+func (r *authRepository) GetAccountStatus(accountID int) (*models.AccountStatus, error) {
+	status := models.AccountStatus{AccountID: accountID}
+	err := r.db.QueryRow(`SELECT a.Is_Locked, a.Tokens_Revoked_At, l.Suspended_At IS NOT NULL
+		FROM Accounts a JOIN Lenders l ON l.Lender_ID = a.Lender_ID WHERE a.Account_ID = ?`, accountID).Scan(
+		&status.IsLocked,
+		&status.TokensRevokedAt,
+		&status.LenderSuspended,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+	return &status, nil
+}
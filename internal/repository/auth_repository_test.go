@@ -18,10 +18,10 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to open in-memory database: %v", err)
 	}
 
-	// Use the schema from internal/database/database.go
-	_, err = db.Exec(database.SqliteSchema)
+	// Use the schema and migrations from internal/database
+	err = database.InitializeSchema(db)
 	if err != nil {
-		t.Fatalf("Failed to create tables using SqliteSchema: %v", err)
+		t.Fatalf("Failed to initialize schema: %v", err)
 	}
 
 	return db
@@ -46,7 +46,7 @@ func TestCreateLenderAndAccount(t *testing.T) {
 	passwordHash := "hashedpassword"
 	interestRate := 5.0 // 5%
 
-	accountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate)
+	accountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate, "ZAR")
 	if err != nil {
 		t.Fatalf("CreateLenderAndAccount failed: %v", err)
 	}
@@ -70,7 +70,8 @@ func TestCreateLenderAndAccount(t *testing.T) {
 
 	var retrievedBusinessName string
 	var retrievedEmail string
-	err = db.QueryRow("SELECT Business_Name, Email FROM Lenders WHERE Lender_ID = ?", retrievedLenderID).Scan(&retrievedBusinessName, &retrievedEmail)
+	var retrievedCurrency string
+	err = db.QueryRow("SELECT Business_Name, Email, Currency FROM Lenders WHERE Lender_ID = ?", retrievedLenderID).Scan(&retrievedBusinessName, &retrievedEmail, &retrievedCurrency)
 	if err != nil {
 		t.Fatalf("Failed to retrieve lender: %v", err)
 	}
@@ -80,10 +81,13 @@ func TestCreateLenderAndAccount(t *testing.T) {
 	if retrievedEmail != email {
 		t.Errorf("Expected email '%s', got '%s'", email, retrievedEmail)
 	}
+	if retrievedCurrency != "ZAR" {
+		t.Errorf("Expected currency 'ZAR', got '%s'", retrievedCurrency)
+	}
 
 	// Test case 2: Transaction rollback on duplicate username
 	// Attempt to create with existing username, which should fail on Account insertion
-	_, err = repo.CreateLenderAndAccount("Another Business", "another@example.com", "987-654-3210", username, "anotherhash", 6.0)
+	_, err = repo.CreateLenderAndAccount("Another Business", "another@example.com", "987-654-3210", username, "anotherhash", 6.0, "LSL")
 	if err == nil {
 		t.Fatal("Expected error for duplicate username, got nil")
 	}
@@ -121,7 +125,7 @@ func TestGetAccountByUsername(t *testing.T) {
 	passwordHash := "hashedpass"
 	interestRate := 7.5
 
-	_, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate)
+	_, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate, "LSL")
 	if err != nil {
 		t.Fatalf("Failed to seed lender and account: %v", err)
 	}
@@ -165,7 +169,7 @@ func TestGetAccountByID(t *testing.T) {
 	passwordHash := "hashedpass2"
 	interestRate := 8.0
 
-	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate)
+	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate, "LSL")
 	if err != nil {
 		t.Fatalf("Failed to seed lender and account: %v", err)
 	}
@@ -209,7 +213,7 @@ func TestGetLenderByAccountID(t *testing.T) {
 	passwordHash := "hashedpassinc"
 	interestRate := 6.5
 
-	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate)
+	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate, "LSL")
 	if err != nil {
 		t.Fatalf("Failed to seed lender and account: %v", err)
 	}
@@ -250,6 +254,39 @@ func TestGetLenderByAccountID(t *testing.T) {
 	// We'll rely on the ErrAccountNotFound for non-existent Lender_ID from the join implicitly.
 }
 
+func TestGetLenderByID(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+	accountID, err := repo.CreateLenderAndAccount("Lender By ID", "byid@example.com", "555-010-2020", "byiduser", "hashedpass", 7.5, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender and account: %v", err)
+	}
+	account, err := repo.GetAccountByID(accountID)
+	if err != nil {
+		t.Fatalf("GetAccountByID failed: %v", err)
+	}
+
+	// Test case 1: Lender found by its ID
+	lender, err := repo.GetLenderByID(account.LenderID)
+	if err != nil {
+		t.Fatalf("GetLenderByID failed: %v", err)
+	}
+	if lender.LenderID != account.LenderID || lender.BusinessName != "Lender By ID" || lender.Currency != "LSL" || lender.InterestRatePercent != 7.5 {
+		t.Errorf("Unexpected lender: %+v", lender)
+	}
+
+	// Test case 2: Lender not found for a non-existent ID
+	lender, err = repo.GetLenderByID(99999)
+	if !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+	if lender != nil {
+		t.Error("Expected nil lender for nonexistent lender ID, got non-nil")
+	}
+}
+
 func TestUpdateLastLogin(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(db)
@@ -264,7 +301,7 @@ func TestUpdateLastLogin(t *testing.T) {
 	passwordHash := "hashedpassupdate"
 	interestRate := 4.0
 
-	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate)
+	seededAccountID, err := repo.CreateLenderAndAccount(businessName, email, phone, username, passwordHash, interestRate, "LSL")
 	if err != nil {
 		t.Fatalf("Failed to seed lender and account: %v", err)
 	}
@@ -306,3 +343,179 @@ func TestUpdateLastLogin(t *testing.T) {
 	// Verify no error for non-existent account means no record was touched.
 	// This is implicit as the function simply returns nil if no rows are affected by the update.
 }
+
+func TestCreateLenderAndAccount_DuplicateEmail(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+
+	_, err := repo.CreateLenderAndAccount("First", "dup@example.com", "123", "firstuser", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed: %v", err)
+	}
+
+	_, err = repo.CreateLenderAndAccount("Second", "dup@example.com", "456", "seconduser", "hash", 5.0, "LSL")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+}
+
+func TestCreateLenderAndAccount_DuplicateUsername(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+
+	_, err := repo.CreateLenderAndAccount("First", "first@example.com", "123", "sameuser", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed: %v", err)
+	}
+
+	// Test case 1: A taken username is reported as such, not as a taken email
+	_, err = repo.CreateLenderAndAccount("Second", "second@example.com", "456", "sameuser", "hash", 5.0, "LSL")
+	if !errors.Is(err, ErrDuplicateUsername) {
+		t.Errorf("Expected ErrDuplicateUsername, got %v", err)
+	}
+
+	// Test case 2: The lender inserted before the account failed is rolled back
+	var lenders int
+	db.QueryRow("SELECT COUNT(*) FROM Lenders WHERE Email = 'second@example.com'").Scan(&lenders)
+	if lenders != 0 {
+		t.Errorf("Expected the second lender to be rolled back, found %d", lenders)
+	}
+
+	// Test case 3: When both are taken the email is reported
+	_, err = repo.CreateLenderAndAccount("Third", "first@example.com", "789", "sameuser", "hash", 5.0, "LSL")
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+}
+
+func TestResetPassword_ExpiredToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+	lenderID := seedLender(t, db, "expiredreset")
+	account, err := repo.GetAccountByEmail("expiredreset@example.com")
+	if err != nil {
+		t.Fatalf("GetAccountByEmail failed: %v", err)
+	}
+	if account.LenderID != lenderID {
+		t.Errorf("Expected account of lender %d, got %d", lenderID, account.LenderID)
+	}
+
+	if err := repo.CreatePasswordReset(account.AccountID, "expired-hash", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("CreatePasswordReset failed: %v", err)
+	}
+	if err := repo.ResetPassword("expired-hash", "new-hash"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Expected ErrInvalidResetToken for an expired token, got %v", err)
+	}
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+	seedLender(t, db, "fumbler")
+	account, _ := repo.GetAccountByUsername("fumbler")
+	now := time.Now()
+
+	// Test case 1: Failures below the threshold only count
+	for i := 0; i < 2; i++ {
+		lockedUntil, err := repo.RecordFailedLogin(account.AccountID, 3, 15*time.Minute, now)
+		if err != nil {
+			t.Fatalf("RecordFailedLogin failed: %v", err)
+		}
+		if lockedUntil.Valid {
+			t.Fatalf("Expected no lockout after %d failures", i+1)
+		}
+	}
+
+	// Test case 2: Reaching the threshold locks temporarily and resets the count
+	lockedUntil, err := repo.RecordFailedLogin(account.AccountID, 3, 15*time.Minute, now)
+	if err != nil {
+		t.Fatalf("RecordFailedLogin failed: %v", err)
+	}
+	if !lockedUntil.Valid || !lockedUntil.Time.Equal(now.Add(15*time.Minute).UTC()) {
+		t.Fatalf("Expected a lockout until %v, got %+v", now.Add(15*time.Minute), lockedUntil)
+	}
+	account, _ = repo.GetAccountByUsername("fumbler")
+	if !account.TemporarilyLocked(now) || account.TemporarilyLocked(now.Add(16*time.Minute)) {
+		t.Errorf("Expected the lockout to last 15 minutes, got %+v", account.LockedUntil)
+	}
+	if account.IsLocked || account.FailedLoginAttempts != 0 {
+		t.Errorf("Expected no hard lock and a reset count, got %+v", account)
+	}
+
+	// Test case 3: A successful login clears the lockout
+	if err := repo.UpdateLastLogin(account.AccountID); err != nil {
+		t.Fatalf("UpdateLastLogin failed: %v", err)
+	}
+	account, _ = repo.GetAccountByUsername("fumbler")
+	if account.LockedUntil.Valid || !account.LastLogin.Valid {
+		t.Errorf("Expected the lockout to be cleared, got %+v", account)
+	}
+}
+
+func TestCountRegistrations(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+	lenderID := seedLender(t, db, "registered")
+	now := time.Now()
+	for _, at := range []time.Time{now.Add(-30 * time.Hour), now.Add(-2 * time.Hour), now} {
+		if err := repo.RecordRegistration(lenderID, "198.51.100.7", at); err != nil {
+			t.Fatalf("RecordRegistration failed: %v", err)
+		}
+	}
+	repo.RecordRegistration(lenderID, "203.0.113.9", now)
+
+	// Test case 1: Only the address's registrations since the given time count
+	count, err := repo.CountRegistrations("198.51.100.7", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("CountRegistrations failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 registrations in the last day, got %d", count)
+	}
+
+	// Test case 2: Unknown addresses have none
+	if count, _ := repo.CountRegistrations("192.0.2.1", now.Add(-24*time.Hour)); count != 0 {
+		t.Errorf("Expected no registrations, got %d", count)
+	}
+}
+
+func TestRegisterLender_EnforcesLimitInTransaction(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewAuthRepository(db)
+	since := time.Now().Add(-24 * time.Hour)
+	limit := RegistrationLimit{IP: "198.51.100.7", Max: 2, Since: since}
+
+	// Test case 1: Registrations within the limit create the lender and are counted
+	if _, err := repo.RegisterLender(limit, "First", "first@example.com", "1", "first", "hash", 5.0, "LSL"); err != nil {
+		t.Fatalf("RegisterLender failed: %v", err)
+	}
+	if count, _ := repo.CountRegistrations(limit.IP, since); count != 1 {
+		t.Errorf("Expected the registration recorded, got %d", count)
+	}
+
+	// Test case 2: A registration that another one got in ahead of is rolled back entirely
+	lenderID := seedLender(t, db, "concurrent")
+	repo.RecordRegistration(lenderID, limit.IP, time.Now())
+	_, err := repo.RegisterLender(limit, "Third", "third@example.com", "3", "third", "hash", 5.0, "LSL")
+	if !errors.Is(err, ErrRegistrationLimit) {
+		t.Fatalf("Expected ErrRegistrationLimit, got %v", err)
+	}
+	if _, err := repo.GetAccountByUsername("third"); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("Expected no account created, got %v", err)
+	}
+	if count, _ := repo.CountRegistrations(limit.IP, since); count != 2 {
+		t.Errorf("Expected the rejected registration not recorded, got %d", count)
+	}
+}
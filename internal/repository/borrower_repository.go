@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrBorrowerNotFound       = errors.New("borrower not found")
+	ErrDuplicateBorrowerEmail = errors.New("borrower email already exists")
+	ErrBorrowerEmailChanged   = errors.New("the borrower's email changed since the verification link was sent")
+)
+
+// BorrowerRepository defines the interface for borrower-related database operations.
+type BorrowerRepository interface {
+	CreateBorrower(borrower *models.Borrower) (int, error)
+	GetBorrowerByID(borrowerID int) (*models.Borrower, error)
+	UpdateBorrower(lenderID int, borrower *models.Borrower) error
+	AnonymizeBorrower(borrowerID int) error
+	VerifyBorrowerEmail(borrowerID int, email string) error
+	CountActiveByLender(lenderID int) (int, error)
+	HasLoanWithLender(lenderID, borrowerID int) (bool, error)
+}
+
+// borrowerRepository implements BorrowerRepository using a SQLite database connection.
+type borrowerRepository struct {
+	db *sql.DB
+}
+
+// NewBorrowerRepository creates a new BorrowerRepository instance.
+func NewBorrowerRepository(db *sql.DB) BorrowerRepository {
+	return &borrowerRepository{db: db}
+}
+
+// CreateBorrower inserts a new borrower. When a structured address is given, Residence is
+// derived from it so clients reading only the legacy column still see the address.
+func (r *borrowerRepository) CreateBorrower(borrower *models.Borrower) (int, error) {
+	fillResidence(borrower)
+
+	now := time.Now().UTC()
+	res, err := r.db.Exec(`INSERT INTO Borrowers (Fullnames, Email, Phone_Number, Residence, Address_Line1, City, Region, Postal_Code, Country, Created_At, Updated_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		borrower.Fullnames, borrower.Email, borrower.PhoneNumber, borrower.Residence,
+		borrower.AddressLine1, borrower.City, borrower.Region, borrower.PostalCode, borrower.Country, now, now)
+	if err != nil {
+		if columns, ok := uniqueViolation(err); ok && columns == "Borrowers.Email" {
+			return 0, ErrDuplicateBorrowerEmail
+		}
+		return 0, err
+	}
+
+	borrowerID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(borrowerID), nil
+}
+
+// GetBorrowerByID retrieves a borrower by their ID.
+func (r *borrowerRepository) GetBorrowerByID(borrowerID int) (*models.Borrower, error) {
+	var borrower models.Borrower
+	query := `SELECT Borrower_ID, Fullnames, Email, Phone_Number, Residence, Address_Line1, City, Region, Postal_Code, Country, Created_At, Updated_At, Is_Active,
+			Email_Verified
+		FROM Borrowers WHERE Borrower_ID = ?`
+	err := r.db.QueryRow(query, borrowerID).Scan(
+		&borrower.BorrowerID,
+		&borrower.Fullnames,
+		&borrower.Email,
+		&borrower.PhoneNumber,
+		&borrower.Residence,
+		&borrower.AddressLine1,
+		&borrower.City,
+		&borrower.Region,
+		&borrower.PostalCode,
+		&borrower.Country,
+		&borrower.CreatedAt,
+		&borrower.UpdatedAt,
+		&borrower.IsActive,
+		&borrower.EmailVerified,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBorrowerNotFound
+		}
+		return nil, err
+	}
+	return &borrower, nil
+}
+
+// UpdateBorrower replaces a borrower's contact details and address, clearing the email's verification
+// when the email changes. Borrowers are shared between lenders, so a lender may only update
+// borrowers it has at least one loan with.
+func (r *borrowerRepository) UpdateBorrower(lenderID int, borrower *models.Borrower) error {
+	fillResidence(borrower)
+
+	res, err := r.db.Exec(`UPDATE Borrowers SET Fullnames = ?, Email = ?, Phone_Number = ?, Residence = ?,
+			Address_Line1 = ?, City = ?, Region = ?, Postal_Code = ?, Country = ?, Updated_At = ?,
+			Email_Verified = Email_Verified AND Email = ?
+		WHERE Borrower_ID = ? AND EXISTS (SELECT 1 FROM Loans WHERE Loans.Borrower_ID = Borrowers.Borrower_ID AND Loans.Lender_ID = ?)`,
+		borrower.Fullnames, borrower.Email, borrower.PhoneNumber, borrower.Residence,
+		borrower.AddressLine1, borrower.City, borrower.Region, borrower.PostalCode, borrower.Country,
+		time.Now().UTC(), borrower.Email, borrower.BorrowerID, lenderID)
+	if err != nil {
+		if columns, ok := uniqueViolation(err); ok && columns == "Borrowers.Email" {
+			return ErrDuplicateBorrowerEmail
+		}
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBorrowerNotFound
+	}
+	return nil
+}
+
+// AnonymizeBorrower scrubs a borrower's personal data on request, keeping the row, its ID and its
+// loans for the lenders' accounts. The name, email and phone are replaced with placeholders rather
+// than hashes, which a phone number's few digits would not protect, the address is cleared, the
+// borrower's custom field values are deleted and the borrower is deactivated. Anonymizing a
+// borrower twice is harmless.
+func (r *borrowerRepository) AnonymizeBorrower(borrowerID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	res, err := tx.Exec(`UPDATE Borrowers SET Fullnames = 'Anonymized borrower', Email = 'anonymized-' || Borrower_ID || '@invalid',
+			Phone_Number = '', Residence = NULL, Address_Line1 = NULL, City = NULL, Region = NULL, Postal_Code = NULL, Country = NULL,
+			Is_Active = 0, Email_Verified = 0, Updated_At = ?
+		WHERE Borrower_ID = ?`, time.Now().UTC(), borrowerID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBorrowerNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM Custom_Field_Values WHERE Entity_ID = ?
+		AND Definition_ID IN (SELECT Definition_ID FROM Custom_Field_Definitions WHERE Entity = 'borrower')`, borrowerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyBorrowerEmail marks the borrower's email as verified if it is still email, and returns
+// ErrBorrowerEmailChanged otherwise. Verifying twice is harmless.
+func (r *borrowerRepository) VerifyBorrowerEmail(borrowerID int, email string) error {
+	res, err := r.db.Exec("UPDATE Borrowers SET Email_Verified = 1, Updated_At = ? WHERE Borrower_ID = ? AND Email = ?",
+		time.Now().UTC(), borrowerID, email)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := r.GetBorrowerByID(borrowerID); err != nil {
+			return err
+		}
+		return ErrBorrowerEmailChanged
+	}
+	return nil
+}
+
+// CountActiveByLender returns how many active borrowers have a loan, in any status, with the lender.
+// Borrowers are shared between lenders, so a borrower only counts towards a lender once lent to;
+// anonymized borrowers are inactive and no longer count.
+func (r *borrowerRepository) CountActiveByLender(lenderID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM Borrowers b
+		WHERE b.Is_Active = 1 AND EXISTS (SELECT 1 FROM Loans WHERE Borrower_ID = b.Borrower_ID AND Lender_ID = ?)`, lenderID).Scan(&count)
+	return count, err
+}
+
+// HasLoanWithLender reports whether the borrower has a loan, in any status, with the lender.
+func (r *borrowerRepository) HasLoanWithLender(lenderID, borrowerID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM Loans WHERE Lender_ID = ? AND Borrower_ID = ?)", lenderID, borrowerID).Scan(&exists)
+	return exists, err
+}
+
+// fillResidence sets the legacy Residence from the structured address when any part of it is present.
+// A borrower with no structured address keeps whatever free-text Residence was supplied.
+func fillResidence(borrower *models.Borrower) {
+	var parts []string
+	for _, part := range []sql.NullString{borrower.AddressLine1, borrower.City, borrower.Region, borrower.PostalCode, borrower.Country} {
+		if part.Valid && part.String != "" {
+			parts = append(parts, part.String)
+		}
+	}
+	if len(parts) > 0 {
+		borrower.Residence = sql.NullString{String: strings.Join(parts, ", "), Valid: true}
+	}
+}
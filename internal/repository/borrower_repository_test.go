@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func validString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func TestBorrowerAddress_RoundTrip(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewBorrowerRepository(db)
+
+	// Test case 1: Full structured address
+	full := &models.Borrower{
+		Fullnames:    "Full Address",
+		Email:        "full@example.com",
+		PhoneNumber:  "555",
+		AddressLine1: validString("12 Kingsway"),
+		City:         validString("Maseru"),
+		Region:       validString("Maseru District"),
+		PostalCode:   validString("100"),
+		Country:      validString("LS"),
+	}
+	id, err := repo.CreateBorrower(full)
+	if err != nil {
+		t.Fatalf("CreateBorrower failed: %v", err)
+	}
+	got, err := repo.GetBorrowerByID(id)
+	if err != nil {
+		t.Fatalf("GetBorrowerByID failed: %v", err)
+	}
+	if got.AddressLine1 != full.AddressLine1 || got.City != full.City || got.Region != full.Region ||
+		got.PostalCode != full.PostalCode || got.Country != full.Country {
+		t.Errorf("Address did not round-trip: %+v", got)
+	}
+	if want := "12 Kingsway, Maseru, Maseru District, 100, LS"; got.Residence.String != want {
+		t.Errorf("Expected residence %q, got %q", want, got.Residence.String)
+	}
+
+	// Test case 2: Partial address leaves the other parts null
+	partial := &models.Borrower{
+		Fullnames:   "Partial Address",
+		Email:       "partial@example.com",
+		PhoneNumber: "555",
+		City:        validString("Leribe"),
+		Country:     validString("LS"),
+	}
+	id, err = repo.CreateBorrower(partial)
+	if err != nil {
+		t.Fatalf("CreateBorrower failed: %v", err)
+	}
+	got, err = repo.GetBorrowerByID(id)
+	if err != nil {
+		t.Fatalf("GetBorrowerByID failed: %v", err)
+	}
+	if got.AddressLine1.Valid || got.Region.Valid || got.PostalCode.Valid {
+		t.Errorf("Expected missing parts to be null, got %+v", got)
+	}
+	if got.City.String != "Leribe" || got.Residence.String != "Leribe, LS" {
+		t.Errorf("Unexpected partial address: %+v", got)
+	}
+
+	// Test case 3: Legacy free-text residence is kept as-is
+	legacy := &models.Borrower{Fullnames: "Legacy", Email: "legacy@example.com", PhoneNumber: "555", Residence: validString("Near the clinic")}
+	id, _ = repo.CreateBorrower(legacy)
+	got, _ = repo.GetBorrowerByID(id)
+	if got.Residence.String != "Near the clinic" || got.City.Valid {
+		t.Errorf("Expected legacy residence only, got %+v", got)
+	}
+}
+
+func TestUpdateBorrower(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewBorrowerRepository(db)
+	lenderA := seedLender(t, db, "updatera")
+	lenderB := seedLender(t, db, "updaterb")
+	borrowerID := seedBorrower(t, db, "update@example.com")
+	seedLoan(t, db, lenderA, borrowerID, "active", 1000, 10, 6)
+
+	borrower, err := repo.GetBorrowerByID(borrowerID)
+	if err != nil {
+		t.Fatalf("GetBorrowerByID failed: %v", err)
+	}
+	borrower.City = validString("Mafeteng")
+
+	// Test case 1: A lender without a loan to the borrower cannot update them
+	if err := repo.UpdateBorrower(lenderB, borrower); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Errorf("Expected ErrBorrowerNotFound, got %v", err)
+	}
+
+	// Test case 2: The borrower's lender can
+	if err := repo.UpdateBorrower(lenderA, borrower); err != nil {
+		t.Fatalf("UpdateBorrower failed: %v", err)
+	}
+	updated, _ := repo.GetBorrowerByID(borrowerID)
+	if updated.City.String != "Mafeteng" || updated.Residence.String != "Mafeteng" {
+		t.Errorf("Expected updated city and residence, got %+v", updated)
+	}
+
+	// Test case 3: Taking another borrower's email
+	seedBorrower(t, db, "taken@example.com")
+	borrower.Email = "taken@example.com"
+	if err := repo.UpdateBorrower(lenderA, borrower); !errors.Is(err, ErrDuplicateBorrowerEmail) {
+		t.Errorf("Expected ErrDuplicateBorrowerEmail, got %v", err)
+	}
+}
+
+func TestAnonymizeBorrower(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewBorrowerRepository(db)
+	lenderID := seedLender(t, db, "anonymizer")
+	borrowerID := seedBorrower(t, db, "private@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 6)
+	borrower, _ := repo.GetBorrowerByID(borrowerID)
+	borrower.City = validString("Maseru")
+	repo.UpdateBorrower(lenderID, borrower)
+	res, _ := db.Exec("INSERT INTO Custom_Field_Definitions (Lender_ID, Entity, Name, Field_Type) VALUES (?, 'borrower', 'National ID', 'text')", lenderID)
+	definitionID, _ := res.LastInsertId()
+	db.Exec("INSERT INTO Custom_Field_Values (Definition_ID, Entity_ID, Value) VALUES (?, ?, '0101')", definitionID, borrowerID)
+
+	// Test case 1: Personal data is scrubbed and the borrower deactivated
+	if err := repo.AnonymizeBorrower(borrowerID); err != nil {
+		t.Fatalf("AnonymizeBorrower failed: %v", err)
+	}
+	scrubbed, err := repo.GetBorrowerByID(borrowerID)
+	if err != nil {
+		t.Fatalf("GetBorrowerByID failed: %v", err)
+	}
+	if scrubbed.Fullnames == borrower.Fullnames || scrubbed.Email == "private@example.com" || scrubbed.PhoneNumber != "" ||
+		scrubbed.Residence.Valid || scrubbed.City.Valid || scrubbed.IsActive {
+		t.Errorf("Expected personal data scrubbed, got %+v", scrubbed)
+	}
+	var values int
+	db.QueryRow("SELECT COUNT(*) FROM Custom_Field_Values WHERE Entity_ID = ?", borrowerID).Scan(&values)
+	if values != 0 {
+		t.Errorf("Expected the borrower's custom field values deleted, got %d", values)
+	}
+
+	// Test case 2: The borrower's loans stay linked to them
+	var linked int
+	db.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&linked)
+	if linked != borrowerID {
+		t.Errorf("Expected the loan to stay with borrower %d, got %d", borrowerID, linked)
+	}
+
+	// Test case 3: Anonymizing again succeeds, and an unknown borrower is not found
+	if err := repo.AnonymizeBorrower(borrowerID); err != nil {
+		t.Errorf("Expected anonymizing twice to succeed, got %v", err)
+	}
+	if err := repo.AnonymizeBorrower(borrowerID + 100); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Errorf("Expected ErrBorrowerNotFound, got %v", err)
+	}
+}
+
+func TestCountActiveByLender(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewBorrowerRepository(db)
+	lenderID := seedLender(t, db, "counter")
+	otherID := seedLender(t, db, "othercounter")
+	shared := seedBorrower(t, db, "shared@example.com")
+	own := seedBorrower(t, db, "own@example.com")
+	seedBorrower(t, db, "unlent@example.com")
+
+	// Test case 1: Borrowers count once however many loans they hold, and only with lenders that lent to them
+	seedLoan(t, db, lenderID, shared, "active", 1000, 10, 6)
+	seedLoan(t, db, lenderID, shared, "paid", 1000, 10, 6)
+	seedLoan(t, db, lenderID, own, "pending", 1000, 10, 6)
+	seedLoan(t, db, otherID, shared, "active", 1000, 10, 6)
+	if count, err := repo.CountActiveByLender(lenderID); err != nil || count != 2 {
+		t.Errorf("Expected 2 borrowers, got %d, %v", count, err)
+	}
+	if count, _ := repo.CountActiveByLender(otherID); count != 1 {
+		t.Errorf("Expected 1 borrower for the other lender, got %d", count)
+	}
+
+	// Test case 2: Anonymized borrowers are inactive and no longer count
+	if err := repo.AnonymizeBorrower(own); err != nil {
+		t.Fatalf("AnonymizeBorrower failed: %v", err)
+	}
+	if count, _ := repo.CountActiveByLender(lenderID); count != 1 {
+		t.Errorf("Expected 1 borrower after anonymizing, got %d", count)
+	}
+}
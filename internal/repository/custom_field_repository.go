@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrCustomFieldNotFound  = errors.New("custom field not found")
+	ErrDuplicateCustomField = errors.New("a custom field with this name already exists")
+)
+
+// CustomFieldRepository defines the interface for lender-defined custom fields on borrowers and
+// loans and the values stored for them. Values are keyed by field name and hold a string, float64
+// or bool as decoded from JSON.
+type CustomFieldRepository interface {
+	CreateDefinition(def *models.CustomFieldDefinition) error
+	UpdateDefinition(def *models.CustomFieldDefinition) error
+	DeleteDefinition(lenderID, definitionID int) error
+	GetDefinition(lenderID, definitionID int) (*models.CustomFieldDefinition, error)
+	ListDefinitions(lenderID int, entity string) ([]models.CustomFieldDefinition, error)
+	GetValues(lenderID int, entity string, entityID int) (map[string]any, error)
+	SetValues(lenderID int, entity string, entityID int, values map[string]any) error
+}
+
+// customFieldRepository implements CustomFieldRepository using a SQLite database connection.
+type customFieldRepository struct {
+	db *sql.DB
+}
+
+// NewCustomFieldRepository creates a new CustomFieldRepository instance.
+func NewCustomFieldRepository(db *sql.DB) CustomFieldRepository {
+	return &customFieldRepository{db: db}
+}
+
+// customFieldColumns are the Custom_Field_Definitions columns read by scanCustomField, in order
+const customFieldColumns = "Definition_ID, Lender_ID, Entity, Name, Field_Type, Required, Created_At, Updated_At"
+
+// scanCustomField scans a row selected with customFieldColumns
+func scanCustomField(row interface{ Scan(dest ...any) error }) (models.CustomFieldDefinition, error) {
+	var def models.CustomFieldDefinition
+	err := row.Scan(&def.DefinitionID, &def.LenderID, &def.Entity, &def.Name, &def.FieldType, &def.Required, &def.CreatedAt, &def.UpdatedAt)
+	return def, err
+}
+
+// CreateDefinition inserts the definition and sets its ID and timestamps.
+func (r *customFieldRepository) CreateDefinition(def *models.CustomFieldDefinition) error {
+	now := time.Now().UTC()
+	res, err := r.db.Exec(`INSERT INTO Custom_Field_Definitions (Lender_ID, Entity, Name, Field_Type, Required, Created_At, Updated_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, def.LenderID, def.Entity, def.Name, def.FieldType, def.Required, now, now)
+	if err != nil {
+		if isUniqueViolation(err, dbDriver) {
+			return ErrDuplicateCustomField
+		}
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	def.DefinitionID = int(id)
+	def.CreatedAt, def.UpdatedAt = models.NewJSONTime(now), models.NewJSONTime(now)
+	return nil
+}
+
+// UpdateDefinition renames the lender's definition and sets whether it is required. The entity
+// and type cannot change, since stored values would no longer match them.
+func (r *customFieldRepository) UpdateDefinition(def *models.CustomFieldDefinition) error {
+	now := time.Now().UTC()
+	res, err := r.db.Exec("UPDATE Custom_Field_Definitions SET Name = ?, Required = ?, Updated_At = ? WHERE Definition_ID = ? AND Lender_ID = ?",
+		def.Name, def.Required, now, def.DefinitionID, def.LenderID)
+	if err != nil {
+		if isUniqueViolation(err, dbDriver) {
+			return ErrDuplicateCustomField
+		}
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCustomFieldNotFound
+	}
+	return nil
+}
+
+// DeleteDefinition removes the lender's definition together with its stored values.
+func (r *customFieldRepository) DeleteDefinition(lenderID, definitionID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	res, err := tx.Exec("DELETE FROM Custom_Field_Definitions WHERE Definition_ID = ? AND Lender_ID = ?", definitionID, lenderID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCustomFieldNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM Custom_Field_Values WHERE Definition_ID = ?", definitionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDefinition returns one of the lender's definitions.
+func (r *customFieldRepository) GetDefinition(lenderID, definitionID int) (*models.CustomFieldDefinition, error) {
+	row := r.db.QueryRow("SELECT "+customFieldColumns+" FROM Custom_Field_Definitions WHERE Definition_ID = ? AND Lender_ID = ?",
+		definitionID, lenderID)
+	def, err := scanCustomField(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCustomFieldNotFound
+		}
+		return nil, err
+	}
+	return &def, nil
+}
+
+// ListDefinitions returns the lender's definitions ordered by entity and name. An empty entity lists all of them.
+func (r *customFieldRepository) ListDefinitions(lenderID int, entity string) ([]models.CustomFieldDefinition, error) {
+	rows, err := r.db.Query("SELECT "+customFieldColumns+` FROM Custom_Field_Definitions
+		WHERE Lender_ID = ? AND (? = '' OR Entity = ?) ORDER BY Entity, Name`, lenderID, entity, entity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []models.CustomFieldDefinition{}
+	for rows.Next() {
+		def, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// GetValues returns the values stored for one borrower or loan under the lender's definitions, by field name.
+func (r *customFieldRepository) GetValues(lenderID int, entity string, entityID int) (map[string]any, error) {
+	rows, err := r.db.Query(`SELECT d.Name, v.Value FROM Custom_Field_Values v
+		JOIN Custom_Field_Definitions d ON d.Definition_ID = v.Definition_ID
+		WHERE d.Lender_ID = ? AND d.Entity = ? AND v.Entity_ID = ?`, lenderID, entity, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]any)
+	for rows.Next() {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
+			return nil, err
+		}
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, rows.Err()
+}
+
+// SetValues stores values for one borrower or loan under the lender's definitions of the same
+// name, in one transaction. A nil value removes the stored one. Values are expected to have been
+// validated against the definitions; a name without a definition returns ErrCustomFieldNotFound.
+func (r *customFieldRepository) SetValues(lenderID int, entity string, entityID int, values map[string]any) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	for name, value := range values {
+		var definitionID int
+		err := tx.QueryRow("SELECT Definition_ID FROM Custom_Field_Definitions WHERE Lender_ID = ? AND Entity = ? AND Name = ?",
+			lenderID, entity, name).Scan(&definitionID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrCustomFieldNotFound
+			}
+			return err
+		}
+
+		if value == nil {
+			_, err = tx.Exec("DELETE FROM Custom_Field_Values WHERE Definition_ID = ? AND Entity_ID = ?", definitionID, entityID)
+		} else {
+			var raw []byte
+			if raw, err = json.Marshal(value); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO Custom_Field_Values (Definition_ID, Entity_ID, Value) VALUES (?, ?, ?)
+				ON CONFLICT (Definition_ID, Entity_ID) DO UPDATE SET Value = excluded.Value`, definitionID, entityID, string(raw))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
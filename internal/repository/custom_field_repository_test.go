@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCustomFields(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewCustomFieldRepository(db)
+	lenderID := seedLender(t, db, "fielder")
+	otherID := seedLender(t, db, "otherfielder")
+
+	village := &models.CustomFieldDefinition{LenderID: lenderID, Entity: models.CustomFieldEntityBorrower, Name: "village", FieldType: models.CustomFieldTypeText}
+	if err := repo.CreateDefinition(village); err != nil {
+		t.Fatalf("CreateDefinition failed: %v", err)
+	}
+	repo.CreateDefinition(&models.CustomFieldDefinition{LenderID: lenderID, Entity: models.CustomFieldEntityLoan, Name: "village", FieldType: models.CustomFieldTypeBool})
+
+	// Test case 1: Names are unique per lender and entity
+	dup := &models.CustomFieldDefinition{LenderID: lenderID, Entity: models.CustomFieldEntityBorrower, Name: "village", FieldType: models.CustomFieldTypeNumber}
+	if err := repo.CreateDefinition(dup); !errors.Is(err, ErrDuplicateCustomField) {
+		t.Errorf("Expected ErrDuplicateCustomField, got %v", err)
+	}
+	dup.LenderID = otherID
+	if err := repo.CreateDefinition(dup); err != nil {
+		t.Errorf("Expected another lender to reuse the name, got %v", err)
+	}
+	if defs, _ := repo.ListDefinitions(lenderID, models.CustomFieldEntityBorrower); len(defs) != 1 {
+		t.Errorf("Expected 1 borrower definition, got %d", len(defs))
+	}
+
+	// Test case 2: Values round-trip typed and nil clears them
+	if err := repo.SetValues(lenderID, models.CustomFieldEntityBorrower, 7, map[string]any{"village": "Ha Foso"}); err != nil {
+		t.Fatalf("SetValues failed: %v", err)
+	}
+	repo.SetValues(lenderID, models.CustomFieldEntityLoan, 7, map[string]any{"village": true})
+	values, err := repo.GetValues(lenderID, models.CustomFieldEntityBorrower, 7)
+	if err != nil || len(values) != 1 || values["village"] != "Ha Foso" {
+		t.Errorf("Unexpected borrower values: %v (%v)", values, err)
+	}
+	if values, _ := repo.GetValues(lenderID, models.CustomFieldEntityLoan, 7); values["village"] != true {
+		t.Errorf("Unexpected loan values: %v", values)
+	}
+	if values, _ := repo.GetValues(otherID, models.CustomFieldEntityBorrower, 7); len(values) != 0 {
+		t.Errorf("Expected no values for another lender, got %v", values)
+	}
+	repo.SetValues(lenderID, models.CustomFieldEntityBorrower, 7, map[string]any{"village": nil})
+	if values, _ := repo.GetValues(lenderID, models.CustomFieldEntityBorrower, 7); len(values) != 0 {
+		t.Errorf("Expected the value to be cleared, got %v", values)
+	}
+	if err := repo.SetValues(lenderID, models.CustomFieldEntityBorrower, 7, map[string]any{"missing": 1}); !errors.Is(err, ErrCustomFieldNotFound) {
+		t.Errorf("Expected ErrCustomFieldNotFound, got %v", err)
+	}
+
+	// Test case 3: Deleting a definition removes its values
+	repo.SetValues(lenderID, models.CustomFieldEntityBorrower, 8, map[string]any{"village": "Roma"})
+	if err := repo.DeleteDefinition(otherID, village.DefinitionID); !errors.Is(err, ErrCustomFieldNotFound) {
+		t.Errorf("Expected ErrCustomFieldNotFound for another lender, got %v", err)
+	}
+	if err := repo.DeleteDefinition(lenderID, village.DefinitionID); err != nil {
+		t.Fatalf("DeleteDefinition failed: %v", err)
+	}
+	var remaining int
+	db.QueryRow("SELECT COUNT(*) FROM Custom_Field_Values WHERE Definition_ID = ?", village.DefinitionID).Scan(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected the values to be removed, got %d", remaining)
+	}
+}
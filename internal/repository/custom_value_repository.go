@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrCustomValueNotFound = errors.New("custom value not found")
+)
+
+// CustomValueRepository defines the interface for a lender's named custom values, stored as
+// Text or Number rows. A name is unique per lender across both tables: setting a value of the
+// other type replaces it.
+type CustomValueRepository interface {
+	UpsertText(lenderID int, name, group, value string) error
+	UpsertNumber(lenderID int, name, group string, value float64) error
+	GetByName(lenderID int, name string) (*models.CustomValue, error)
+	GetAllByLender(lenderID int) ([]models.CustomValue, error)
+	Delete(lenderID int, name string) error
+}
+
+// customValueRepository implements CustomValueRepository using a SQLite database connection.
+type customValueRepository struct {
+	db *sql.DB
+}
+
+// NewCustomValueRepository creates a new CustomValueRepository instance.
+func NewCustomValueRepository(db *sql.DB) CustomValueRepository {
+	return &customValueRepository{db: db}
+}
+
+// UpsertText sets a text custom value, replacing any value of the same name. An empty group clears it.
+func (r *customValueRepository) UpsertText(lenderID int, name, group, value string) error {
+	return r.upsert("Text", "Number", lenderID, name, group, value)
+}
+
+// UpsertNumber sets a numeric custom value, replacing any value of the same name. An empty group clears it.
+func (r *customValueRepository) UpsertNumber(lenderID int, name, group string, value float64) error {
+	return r.upsert("Number", "Text", lenderID, name, group, value)
+}
+
+// upsert writes the value to table and removes a value of the same name from other, so the
+// name keeps a single type
+func (r *customValueRepository) upsert(table, other string, lenderID int, name, group string, value any) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	if _, err := tx.Exec("DELETE FROM "+other+" WHERE Lender_ID = ? AND Field_Name = ?", lenderID, name); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO `+table+` (Lender_ID, Field_Name, Field_Group, Value) VALUES (?, ?, ?, ?)
+		ON CONFLICT (Lender_ID, Field_Name) DO UPDATE SET Field_Group = excluded.Field_Group, Value = excluded.Value`,
+		lenderID, name, sql.NullString{String: group, Valid: group != ""}, value)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByName returns a single custom value of a lender.
+func (r *customValueRepository) GetByName(lenderID int, name string) (*models.CustomValue, error) {
+	values, err := r.list("Lender_ID = ? AND Field_Name = ?", lenderID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrCustomValueNotFound
+	}
+	return &values[0], nil
+}
+
+// GetAllByLender returns every custom value of a lender ordered by name.
+func (r *customValueRepository) GetAllByLender(lenderID int) ([]models.CustomValue, error) {
+	values, err := r.list("Lender_ID = ?", lenderID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values, nil
+}
+
+// list returns the Text and then the Number rows matching where
+func (r *customValueRepository) list(where string, args ...any) ([]models.CustomValue, error) {
+	values := []models.CustomValue{}
+	for _, source := range []struct{ table, kind string }{
+		{"Text", models.CustomValueText},
+		{"Number", models.CustomValueNumber},
+	} {
+		rows, err := r.db.Query("SELECT Field_Name, Field_Group, Value, Updated_At FROM "+source.table+" WHERE "+where, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			value := models.CustomValue{Type: source.kind}
+			if source.kind == models.CustomValueText {
+				var text string
+				err = rows.Scan(&value.Name, &value.Group, &text, &value.UpdatedAt)
+				value.Value = text
+			} else {
+				var number float64
+				err = rows.Scan(&value.Name, &value.Group, &number, &value.UpdatedAt)
+				value.Value = number
+			}
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Delete removes a custom value of a lender, whichever table holds it.
+func (r *customValueRepository) Delete(lenderID int, name string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var deleted int64
+	for _, table := range []string{"Text", "Number"} {
+		res, err := tx.Exec("DELETE FROM "+table+" WHERE Lender_ID = ? AND Field_Name = ?", lenderID, name)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		deleted += n
+	}
+	if deleted == 0 {
+		return ErrCustomValueNotFound
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCustomValues(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewCustomValueRepository(db)
+	lenderID := seedLender(t, db, "customiser")
+	otherID := seedLender(t, db, "othercustomiser")
+
+	// Test case 1: Text and number values are read back typed, ordered by name
+	if err := repo.UpsertText(lenderID, "branch_code", "branch", "MAS01"); err != nil {
+		t.Fatalf("UpsertText failed: %v", err)
+	}
+	if err := repo.UpsertNumber(lenderID, "default_penalty", "", 50); err != nil {
+		t.Fatalf("UpsertNumber failed: %v", err)
+	}
+	repo.UpsertText(otherID, "branch_code", "", "OTHER")
+
+	values, err := repo.GetAllByLender(lenderID)
+	if err != nil {
+		t.Fatalf("GetAllByLender failed: %v", err)
+	}
+	if len(values) != 2 ||
+		values[0].Name != "branch_code" || values[0].Type != models.CustomValueText || values[0].Value != "MAS01" || values[0].Group.String != "branch" ||
+		values[1].Name != "default_penalty" || values[1].Type != models.CustomValueNumber || values[1].Value != 50.0 || values[1].Group.Valid {
+		t.Errorf("Unexpected values: %+v", values)
+	}
+
+	// Test case 2: Upserting the same name updates it in place
+	repo.UpsertText(lenderID, "branch_code", "", "MAS02")
+	value, err := repo.GetByName(lenderID, "branch_code")
+	if err != nil || value.Value != "MAS02" || value.Group.Valid {
+		t.Errorf("Expected MAS02 with no group, got %+v (%v)", value, err)
+	}
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM Text WHERE Lender_ID = ?", lenderID).Scan(&rows)
+	if rows != 1 {
+		t.Errorf("Expected a single Text row, got %d", rows)
+	}
+
+	// Test case 3: Setting a name with the other type replaces it
+	repo.UpsertNumber(lenderID, "branch_code", "", 7)
+	value, _ = repo.GetByName(lenderID, "branch_code")
+	if value.Type != models.CustomValueNumber || value.Value != 7.0 {
+		t.Errorf("Expected branch_code to become the number 7, got %+v", value)
+	}
+	if values, _ := repo.GetAllByLender(lenderID); len(values) != 2 {
+		t.Errorf("Expected 2 values after the type change, got %d", len(values))
+	}
+
+	// Test case 4: Delete removes the value; other lenders are untouched
+	if err := repo.Delete(lenderID, "branch_code"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := repo.GetByName(lenderID, "branch_code"); !errors.Is(err, ErrCustomValueNotFound) {
+		t.Errorf("Expected ErrCustomValueNotFound, got %v", err)
+	}
+	if err := repo.Delete(lenderID, "branch_code"); !errors.Is(err, ErrCustomValueNotFound) {
+		t.Errorf("Expected ErrCustomValueNotFound deleting twice, got %v", err)
+	}
+	if value, err := repo.GetByName(otherID, "branch_code"); err != nil || value.Value != "OTHER" {
+		t.Errorf("Expected the other lender's value to remain, got %+v (%v)", value, err)
+	}
+}
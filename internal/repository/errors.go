@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Database drivers whose unique constraint errors isUniqueViolation recognizes
+const (
+	driverSQLite   = "sqlite3"
+	driverPostgres = "postgres"
+)
+
+// dbDriver is the driver every repository's connection is opened with
+const dbDriver = driverSQLite
+
+// pgUniqueViolation is the SQLSTATE Postgres reports for a unique constraint failure
+const pgUniqueViolation = "23505"
+
+// isUniqueViolation reports whether err, returned through the named driver, is a unique constraint
+// failure. Postgres errors are matched by their SQLSTATE, which both lib/pq and pgx expose.
+func isUniqueViolation(err error, driver string) bool {
+	switch driver {
+	case driverSQLite:
+		var sqliteErr sqlite3.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	case driverPostgres, "pgx":
+		var pgErr interface{ SQLState() string }
+		return errors.As(err, &pgErr) && pgErr.SQLState() == pgUniqueViolation
+	}
+	return false
+}
+
+// uniqueViolation reports whether err is a UNIQUE constraint failure and, if so, which columns it
+// was on, as SQLite names them: "Table.Column", or a comma-separated list for a composite index.
+func uniqueViolation(err error) (string, bool) {
+	if !isUniqueViolation(err, dbDriver) {
+		return "", false
+	}
+	var sqliteErr sqlite3.Error
+	errors.As(err, &sqliteErr)
+	columns, _ := strings.CutPrefix(sqliteErr.Error(), "UNIQUE constraint failed: ")
+	return columns, true
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// pgError mimics the errors of the Postgres drivers, lib/pq and pgx, which expose SQLState
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pq: error with SQLSTATE " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestIsUniqueViolation(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	if _, err := db.Exec("CREATE TABLE Uniques (Name TEXT NOT NULL UNIQUE)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO Uniques (Name) VALUES ('taken')"); err != nil {
+		t.Fatalf("Failed to seed row: %v", err)
+	}
+	_, sqliteUnique := db.Exec("INSERT INTO Uniques (Name) VALUES ('taken')")
+	_, sqliteNotNull := db.Exec("INSERT INTO Uniques (Name) VALUES (NULL)")
+
+	tests := []struct {
+		name   string
+		err    error
+		driver string
+		want   bool
+	}{
+		// Test case 1: SQLite unique failures, also when wrapped
+		{"sqlite unique", sqliteUnique, driverSQLite, true},
+		{"sqlite wrapped", fmt.Errorf("creating: %w", sqliteUnique), driverSQLite, true},
+		// Test case 2: Other SQLite constraint failures are not unique violations
+		{"sqlite not null", sqliteNotNull, driverSQLite, false},
+		// Test case 3: Postgres 23505, from either driver name, also when wrapped
+		{"postgres unique", &pgError{"23505"}, driverPostgres, true},
+		{"pgx wrapped", fmt.Errorf("creating: %w", &pgError{"23505"}), "pgx", true},
+		// Test case 4: Other Postgres states, such as a not-null violation, are not
+		{"postgres not null", &pgError{"23502"}, driverPostgres, false},
+		// Test case 5: An error is only matched for the driver that returned it
+		{"sqlite error as postgres", sqliteUnique, driverPostgres, false},
+		{"postgres error as sqlite", &pgError{"23505"}, driverSQLite, false},
+		{"unknown driver", sqliteUnique, "mysql", false},
+		// Test case 6: Plain errors, and no error, are not unique violations
+		{"message only", errors.New("UNIQUE constraint failed: Uniques.Name"), driverSQLite, false},
+		{"nil", nil, driverSQLite, false},
+	}
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err, tt.driver); got != tt.want {
+			t.Errorf("%s: isUniqueViolation(%v, %q) = %v, want %v", tt.name, tt.err, tt.driver, got, tt.want)
+		}
+	}
+
+	// Test case 7: uniqueViolation still names the columns of a SQLite failure
+	if columns, ok := uniqueViolation(sqliteUnique); !ok || columns != "Uniques.Name" {
+		t.Errorf("Expected Uniques.Name, got %q, %v", columns, ok)
+	}
+}
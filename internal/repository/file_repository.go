@@ -0,0 +1,558 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrFileNotFound         = errors.New("file not found")
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+	ErrFileReferenced       = errors.New("file is still referenced")
+	ErrLinkTargetNotFound   = errors.New("linked record not found")
+	ErrAttachmentNotFound   = errors.New("attachment not found")
+)
+
+// FileLink names one of a lender's borrowers, loans or receipts, by a models.FileLink* type and its ID
+type FileLink struct {
+	Type string
+	ID   int
+}
+
+// FileFilter narrows and pages a lender's file listing; zero values leave a filter unset.
+type FileFilter struct {
+	FileType       string
+	UploadedAfter  time.Time // Inclusive
+	UploadedBefore time.Time // Exclusive
+	Filename       string    // Case-insensitive substring of Original_Filename
+	LinkedTo       FileLink  // Files attached to the record, or to its receipts
+	Limit          int
+	Offset         int
+}
+
+// FileRepository defines the interface for File table operations. File contents live in a
+// storage backend under the row's Value key; the repository only holds the metadata.
+type FileRepository interface {
+	CreateFile(file *models.File) error
+	CreateFileWithinQuota(file *models.File, quota int64) error
+	GetStorageUsage(lenderID int) (int64, error)
+	GetFileByID(lenderID, fileID int) (*models.File, error)
+	ListFiles(lenderID int, filter FileFilter) ([]models.FileListing, int, error)
+	ListFilesForExport(lenderID int, filter FileFilter, afterID, limit int) ([]models.ExportFile, error)
+	ListFileReferences(lenderID, fileID int) ([]models.FileReference, error)
+	AttachFile(lenderID, fileID int, link FileLink) (*models.FileAttachment, error)
+	DetachFile(lenderID, fileID int, link FileLink) error
+	DeleteFile(ctx context.Context, lenderID, fileID int, actor string) (*models.File, error)
+	ListFilesByBackend(backend string, afterID, limit int) ([]models.File, error)
+	SetStorageBackend(fileID int, backend string) error
+	ListFilesByStatus(status string, afterID, limit int) ([]models.File, error)
+	RecordScanResult(ctx context.Context, fileID int, status, signature string) error
+}
+
+// fileRepository implements FileRepository using a SQLite database connection.
+type fileRepository struct {
+	db *sql.DB
+}
+
+// NewFileRepository creates a new FileRepository instance.
+func NewFileRepository(db *sql.DB) FileRepository {
+	return &fileRepository{db: db}
+}
+
+// fileColumns are the File columns read by scanFile, in order
+const fileColumns = "File_ID, Lender_ID, Value, File_Type, File_Size, Original_Filename, Uploaded_At, Purpose, Storage_Backend, Original_File_ID, Status"
+
+// scanFile scans a row selected with fileColumns, followed by any extra columns into extra
+func scanFile(row interface{ Scan(dest ...any) error }, extra ...any) (models.File, error) {
+	var file models.File
+	dest := []any{
+		&file.FileID,
+		&file.LenderID,
+		&file.Value,
+		&file.FileType,
+		&file.FileSize,
+		&file.OriginalFilename,
+		&file.UploadedAt,
+		&file.Purpose,
+		&file.StorageBackend,
+		&file.OriginalFileID,
+		&file.Status,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return file, err
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term, for use with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// CreateFile inserts the file row and sets its ID and upload time. A file without a status is
+// queued for the malware scanner.
+func (r *fileRepository) CreateFile(file *models.File) error {
+	if file.UploadedAt.IsZero() {
+		file.UploadedAt = models.NewJSONTime(time.Now().UTC())
+	}
+	if file.Status == "" {
+		file.Status = models.FileStatusPendingScan
+	}
+	res, err := r.db.Exec(`INSERT INTO File (Lender_ID, Value, File_Type, File_Size, Original_Filename, Uploaded_At, Purpose, Storage_Backend, Status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		file.LenderID, file.Value, file.FileType, file.FileSize, file.OriginalFilename, file.UploadedAt, file.Purpose, file.StorageBackend, file.Status)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	file.FileID = int(id)
+	return nil
+}
+
+// CreateFileWithinQuota inserts the file row like CreateFile, but only if the lender's files
+// would then total at most quota bytes; otherwise it returns ErrStorageQuotaExceeded. A zero quota
+// is unlimited. The usage check and the insert are one statement, so concurrent uploads cannot
+// both squeeze under the quota.
+func (r *fileRepository) CreateFileWithinQuota(file *models.File, quota int64) error {
+	if quota <= 0 {
+		return r.CreateFile(file)
+	}
+	if file.UploadedAt.IsZero() {
+		file.UploadedAt = models.NewJSONTime(time.Now().UTC())
+	}
+	if file.Status == "" {
+		file.Status = models.FileStatusPendingScan
+	}
+	res, err := r.db.Exec(`INSERT INTO File (Lender_ID, Value, File_Type, File_Size, Original_Filename, Uploaded_At, Purpose, Storage_Backend, Status)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE (SELECT COALESCE(SUM(File_Size), 0) FROM File WHERE Lender_ID = ?) + ? <= ?`,
+		file.LenderID, file.Value, file.FileType, file.FileSize, file.OriginalFilename, file.UploadedAt, file.Purpose, file.StorageBackend, file.Status,
+		file.LenderID, file.FileSize.Int64, quota)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrStorageQuotaExceeded
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	file.FileID = int(id)
+	return nil
+}
+
+// GetStorageUsage returns the total size in bytes of the lender's files.
+func (r *fileRepository) GetStorageUsage(lenderID int) (int64, error) {
+	var used int64
+	err := r.db.QueryRow("SELECT COALESCE(SUM(File_Size), 0) FROM File WHERE Lender_ID = ?", lenderID).Scan(&used)
+	return used, err
+}
+
+// GetFileByID retrieves one of the lender's files.
+func (r *fileRepository) GetFileByID(lenderID, fileID int) (*models.File, error) {
+	file, err := scanFile(r.db.QueryRow("SELECT "+fileColumns+" FROM File WHERE File_ID = ? AND Lender_ID = ?", fileID, lenderID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// fileReferences selects every row that points at a File row, as the referencing resource's type
+// and ID and the referenced File_ID. Add each new table that references File here so listings
+// keep warning about, and DeleteFile keeps refusing, referenced files.
+const fileReferences = `
+	SELECT 'lender_logo' AS Type, Lender_ID AS ID, Logo_File_ID AS Referenced_ID FROM Lenders WHERE Logo_File_ID IS NOT NULL
+	UNION ALL
+	SELECT 'lender_branding_logo', Lender_ID, Branding_Logo_File_ID FROM Lenders WHERE Branding_Logo_File_ID IS NOT NULL
+	UNION ALL
+	SELECT 'file_variant', File_ID, Original_File_ID FROM File WHERE Original_File_ID IS NOT NULL
+	UNION ALL
+	SELECT Entity_Type, Entity_ID, File_ID FROM File_Attachments`
+
+// fileReferencesJoin counts, per file, the rows that point at it
+const fileReferencesJoin = `
+	LEFT JOIN (
+		SELECT Referenced_ID, COUNT(*) AS N FROM (` + fileReferences + `) GROUP BY Referenced_ID
+	) refs ON refs.Referenced_ID = File.File_ID`
+
+// linkTargetQueries check that a FileLink names one of the lender's records, by type. Args: the
+// record's ID, lender. Borrowers are shared, so a lender sees those it has lent to.
+var linkTargetQueries = map[string]string{
+	models.FileLinkBorrower: "SELECT EXISTS (SELECT 1 FROM Loans WHERE Borrower_ID = ? AND Lender_ID = ?)",
+	models.FileLinkLoan:     "SELECT EXISTS (SELECT 1 FROM Loans WHERE Loan_ID = ? AND Lender_ID = ?)",
+	models.FileLinkReceipt:  "SELECT EXISTS (SELECT 1 FROM Recipets WHERE Recipet_ID = ? AND Lender_ID = ?)",
+}
+
+// checkLinkTarget returns ErrLinkTargetNotFound unless link names one of the lender's records
+func checkLinkTarget(ctx context.Context, q DBTX, lenderID int, link FileLink) error {
+	query, ok := linkTargetQueries[link.Type]
+	if !ok {
+		return ErrLinkTargetNotFound
+	}
+	var exists bool
+	if err := q.QueryRowContext(ctx, query, link.ID, lenderID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrLinkTargetNotFound
+	}
+	return nil
+}
+
+// linkedFiles returns a query selecting the File_IDs attached to the lender's record, with its
+// args. Borrowers and loans include the files attached to their receipts.
+func linkedFiles(lenderID int, link FileLink) (string, []any) {
+	direct := "SELECT File_ID FROM File_Attachments WHERE Lender_ID = ? AND Entity_Type = ? AND Entity_ID = ?"
+	args := []any{lenderID, link.Type, link.ID}
+	switch link.Type {
+	case models.FileLinkBorrower:
+		return direct + `
+			UNION
+			SELECT a.File_ID FROM File_Attachments a
+				JOIN Recipets re ON re.Recipet_ID = a.Entity_ID
+				JOIN Loans lo ON lo.Loan_ID = re.Loan_ID
+			WHERE a.Lender_ID = ? AND a.Entity_Type = 'receipt' AND lo.Borrower_ID = ? AND lo.Lender_ID = ?`,
+			append(args, lenderID, link.ID, lenderID)
+	case models.FileLinkLoan:
+		return direct + `
+			UNION
+			SELECT a.File_ID FROM File_Attachments a
+				JOIN Recipets re ON re.Recipet_ID = a.Entity_ID
+			WHERE a.Lender_ID = ? AND a.Entity_Type = 'receipt' AND re.Loan_ID = ? AND re.Lender_ID = ?`,
+			append(args, lenderID, link.ID, lenderID)
+	}
+	return direct, args
+}
+
+// ListFiles returns one page of the lender's files, newest first, with their reference counts,
+// and the total matching the filter. Linking to a record that is not the lender's returns
+// ErrLinkTargetNotFound.
+func (r *fileRepository) ListFiles(lenderID int, filter FileFilter) ([]models.FileListing, int, error) {
+	where, args, err := r.fileFilterWhere(lenderID, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM File"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + fileColumns + ", COALESCE(refs.N, 0) FROM File" + fileReferencesJoin + where +
+		" ORDER BY Uploaded_At DESC, File.File_ID DESC LIMIT ? OFFSET ?"
+	rows, err := r.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var files []models.FileListing
+	for rows.Next() {
+		var listing models.FileListing
+		file, err := scanFile(rows, &listing.References)
+		if err != nil {
+			return nil, 0, err
+		}
+		listing.File = file
+		files = append(files, listing)
+	}
+	return files, total, rows.Err()
+}
+
+// fileFilterWhere builds the WHERE clause selecting the lender's files that match filter, ignoring
+// its pagination. Linking to a record that is not the lender's returns ErrLinkTargetNotFound.
+func (r *fileRepository) fileFilterWhere(lenderID int, filter FileFilter) (string, []any, error) {
+	where := " WHERE File.Lender_ID = ?"
+	args := []any{lenderID}
+	if filter.LinkedTo.Type != "" {
+		if err := checkLinkTarget(context.Background(), r.db, lenderID, filter.LinkedTo); err != nil {
+			return "", nil, err
+		}
+		linked, linkedArgs := linkedFiles(lenderID, filter.LinkedTo)
+		where += " AND File.File_ID IN (" + linked + ")"
+		args = append(args, linkedArgs...)
+	}
+	if filter.FileType != "" {
+		where += " AND File_Type = ?"
+		args = append(args, filter.FileType)
+	}
+	if !filter.UploadedAfter.IsZero() {
+		where += " AND Uploaded_At >= ?"
+		args = append(args, filter.UploadedAfter.UTC())
+	}
+	if !filter.UploadedBefore.IsZero() {
+		where += " AND Uploaded_At < ?"
+		args = append(args, filter.UploadedBefore.UTC())
+	}
+	if filter.Filename != "" {
+		where += ` AND Original_Filename LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(filter.Filename)+"%")
+	}
+	return where, args, nil
+}
+
+// ListFilesForExport returns up to limit of the lender's files matching filter with an ID above
+// afterID, in ID order, each with the records it is attached to. The filter's pagination is ignored.
+func (r *fileRepository) ListFilesForExport(lenderID int, filter FileFilter, afterID, limit int) ([]models.ExportFile, error) {
+	where, args, err := r.fileFilterWhere(lenderID, filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query("SELECT "+fileColumns+" FROM File"+where+" AND File.File_ID > ? ORDER BY File.File_ID LIMIT ?",
+		append(args, afterID, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.ExportFile
+	index := make(map[int]int) // File_ID to its position in files
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[file.FileID] = len(files)
+		files = append(files, models.ExportFile{File: file, Links: []models.ExportLink{}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return files, nil
+	}
+
+	ids := make([]any, 0, len(files)+1)
+	ids = append(ids, lenderID)
+	for _, f := range files {
+		ids = append(ids, f.File.FileID)
+	}
+	linkRows, err := r.db.Query(`SELECT a.File_ID, a.Entity_Type, a.Entity_ID, COALESCE(b.Fullnames, '') FROM File_Attachments a
+		LEFT JOIN Borrowers b ON a.Entity_Type = 'borrower' AND b.Borrower_ID = a.Entity_ID
+		WHERE a.Lender_ID = ? AND a.File_ID IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(files)), ", ")+`)
+		ORDER BY a.File_ID, a.Entity_Type, a.Entity_ID`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer linkRows.Close()
+	for linkRows.Next() {
+		var fileID int
+		var link models.ExportLink
+		if err := linkRows.Scan(&fileID, &link.Type, &link.ID, &link.Name); err != nil {
+			return nil, err
+		}
+		f := &files[index[fileID]]
+		f.Links = append(f.Links, link)
+	}
+	return files, linkRows.Err()
+}
+
+// ListFileReferences returns the resources referencing one of the lender's files.
+func (r *fileRepository) ListFileReferences(lenderID, fileID int) ([]models.FileReference, error) {
+	if _, err := r.GetFileByID(lenderID, fileID); err != nil {
+		return nil, err
+	}
+	return listFileReferences(context.Background(), r.db, fileID)
+}
+
+// listFileReferences returns the resources referencing the file, in type and ID order
+func listFileReferences(ctx context.Context, q DBTX, fileID int) ([]models.FileReference, error) {
+	rows, err := q.QueryContext(ctx, "SELECT Type, ID FROM ("+fileReferences+") WHERE Referenced_ID = ? ORDER BY Type, ID", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []models.FileReference{}
+	for rows.Next() {
+		var ref models.FileReference
+		if err := rows.Scan(&ref.Type, &ref.ID); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// AttachFile links one of the lender's files to one of its records. Attaching it again is a no-op
+// that returns the existing attachment.
+func (r *fileRepository) AttachFile(lenderID, fileID int, link FileLink) (*models.FileAttachment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM File WHERE File_ID = ? AND Lender_ID = ?)", fileID, lenderID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrFileNotFound
+	}
+	if err := checkLinkTarget(context.Background(), tx, lenderID, link); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO File_Attachments (File_ID, Lender_ID, Entity_Type, Entity_ID, Attached_At) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (File_ID, Entity_Type, Entity_ID) DO NOTHING`, fileID, lenderID, link.Type, link.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	attachment := models.FileAttachment{FileID: fileID, Type: link.Type, ID: link.ID}
+	err = tx.QueryRow("SELECT Attached_At FROM File_Attachments WHERE File_ID = ? AND Entity_Type = ? AND Entity_ID = ?",
+		fileID, link.Type, link.ID).Scan(&attachment.AttachedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, tx.Commit()
+}
+
+// DetachFile removes the link between one of the lender's files and a record.
+func (r *fileRepository) DetachFile(lenderID, fileID int, link FileLink) error {
+	res, err := r.db.Exec("DELETE FROM File_Attachments WHERE File_ID = ? AND Lender_ID = ? AND Entity_Type = ? AND Entity_ID = ?",
+		fileID, lenderID, link.Type, link.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// DeleteFile removes one of the lender's File rows and records the deletion in the audit log as
+// done by actor, returning the deleted row so the caller can remove its contents from storage.
+// Files that are still referenced are kept and ErrFileReferenced is returned.
+func (r *fileRepository) DeleteFile(ctx context.Context, lenderID, fileID int, actor string) (*models.File, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	file, err := scanFile(tx.QueryRowContext(ctx, "SELECT "+fileColumns+" FROM File WHERE File_ID = ? AND Lender_ID = ?", fileID, lenderID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	refs, err := listFileReferences(ctx, tx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) > 0 {
+		return nil, ErrFileReferenced
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM File WHERE File_ID = ?", fileID); err != nil {
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, lenderID, actor, models.AuditFileDeleted, "file", fileID, file, time.Now()); err != nil {
+		return nil, err
+	}
+	return &file, tx.Commit()
+}
+
+// ListFilesByBackend returns up to limit files stored on the backend with an ID above afterID,
+// in ID order, for walking every file of a backend in batches.
+func (r *fileRepository) ListFilesByBackend(backend string, afterID, limit int) ([]models.File, error) {
+	rows, err := r.db.Query("SELECT "+fileColumns+" FROM File WHERE Storage_Backend = ? AND File_ID > ? ORDER BY File_ID LIMIT ?",
+		backend, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// SetStorageBackend records that the file's contents now live on another backend under the same key.
+func (r *fileRepository) SetStorageBackend(fileID int, backend string) error {
+	res, err := r.db.Exec("UPDATE File SET Storage_Backend = ? WHERE File_ID = ?", backend, fileID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// ListFilesByStatus returns up to limit files with the status and an ID above afterID, in ID order,
+// e.g. to walk the files waiting for the malware scanner.
+func (r *fileRepository) ListFilesByStatus(status string, afterID, limit int) ([]models.File, error) {
+	rows, err := r.db.Query("SELECT "+fileColumns+" FROM File WHERE Status = ? AND File_ID > ? ORDER BY File_ID LIMIT ?",
+		status, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// RecordScanResult moves a file waiting for the malware scanner to status, clean or infected.
+// Quarantining an infected file is recorded in the audit log with the detected signature. It
+// returns ErrFileNotFound when the file is gone or no longer waiting for a scan.
+func (r *fileRepository) RecordScanResult(ctx context.Context, fileID int, status, signature string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var lenderID int
+	err = tx.QueryRowContext(ctx, "UPDATE File SET Status = ? WHERE File_ID = ? AND Status = ? RETURNING Lender_ID",
+		status, fileID, models.FileStatusPendingScan).Scan(&lenderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrFileNotFound
+		}
+		return err
+	}
+	if status == models.FileStatusInfected {
+		details := map[string]string{"signature": signature}
+		if err := recordAudit(ctx, tx, lenderID, "system", models.AuditFileQuarantined, "file", fileID, details, time.Now()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
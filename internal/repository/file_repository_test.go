@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCreateAndGetFile(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "filer")
+	otherID := seedLender(t, db, "otherfiler")
+
+	file := &models.File{
+		LenderID:         lenderID,
+		Value:            "lenders/1/files/abc.pdf",
+		FileType:         sql.NullString{String: "application/pdf", Valid: true},
+		FileSize:         sql.NullInt64{Int64: 1234, Valid: true},
+		OriginalFilename: sql.NullString{String: "contract.pdf", Valid: true},
+	}
+	if err := repo.CreateFile(file); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if file.FileID == 0 || file.UploadedAt.IsZero() {
+		t.Errorf("Expected the ID and upload time to be set, got %+v", file)
+	}
+
+	// Test case 1: The owner can read it back
+	got, err := repo.GetFileByID(lenderID, file.FileID)
+	if err != nil {
+		t.Fatalf("GetFileByID failed: %v", err)
+	}
+	if got.Value != file.Value || got.FileSize.Int64 != 1234 || got.OriginalFilename.String != "contract.pdf" || got.Purpose.Valid ||
+		got.Status != models.FileStatusPendingScan {
+		t.Errorf("Unexpected file: %+v", got)
+	}
+
+	// Test case 2: Other lenders cannot
+	if _, err := repo.GetFileByID(otherID, file.FileID); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestRecordScanResult(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ctx := context.Background()
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "scanfiler")
+	first := &models.File{LenderID: lenderID, Value: "a.pdf"}
+	second := &models.File{LenderID: lenderID, Value: "b.pdf"}
+	repo.CreateFile(first)
+	repo.CreateFile(second)
+
+	// Test case 1: Both files wait for the scanner, in ID order
+	pending, err := repo.ListFilesByStatus(models.FileStatusPendingScan, 0, 10)
+	if err != nil || len(pending) != 2 || pending[0].FileID != first.FileID {
+		t.Fatalf("Expected both files pending, got %+v (%v)", pending, err)
+	}
+
+	// Test case 2: A verdict takes the file off the queue
+	if err := repo.RecordScanResult(ctx, first.FileID, models.FileStatusClean, ""); err != nil {
+		t.Fatalf("RecordScanResult failed: %v", err)
+	}
+	if pending, _ := repo.ListFilesByStatus(models.FileStatusPendingScan, 0, 10); len(pending) != 1 || pending[0].FileID != second.FileID {
+		t.Errorf("Expected only the second file pending, got %+v", pending)
+	}
+
+	// Test case 3: A file is only given one verdict
+	if err := repo.RecordScanResult(ctx, first.FileID, models.FileStatusInfected, "Test.Virus"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a scanned file, got %v", err)
+	}
+	if got, _ := repo.GetFileByID(lenderID, first.FileID); got.Status != models.FileStatusClean {
+		t.Errorf("Expected the file to stay clean, got %q", got.Status)
+	}
+}
+
+func TestCreateFileWithinQuota(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "quota")
+	otherID := seedLender(t, db, "otherquota")
+	newFile := func(lenderID int, size int64) *models.File {
+		return &models.File{LenderID: lenderID, Value: fmt.Sprintf("lenders/%d/files/%d", lenderID, size), FileSize: sql.NullInt64{Int64: size, Valid: true}}
+	}
+
+	// Test case 1: Uploads fit until the quota is reached exactly
+	if err := repo.CreateFileWithinQuota(newFile(lenderID, 600), 1000); err != nil {
+		t.Fatalf("CreateFileWithinQuota failed: %v", err)
+	}
+	if err := repo.CreateFileWithinQuota(newFile(lenderID, 400), 1000); err != nil {
+		t.Fatalf("Expected a file filling the quota exactly to fit, got %v", err)
+	}
+
+	// Test case 2: One more byte is refused and nothing is inserted
+	file := newFile(lenderID, 1)
+	if err := repo.CreateFileWithinQuota(file, 1000); !errors.Is(err, ErrStorageQuotaExceeded) {
+		t.Errorf("Expected ErrStorageQuotaExceeded, got %v", err)
+	}
+	if file.FileID != 0 {
+		t.Errorf("Expected no ID for a refused file, got %d", file.FileID)
+	}
+	if used, _ := repo.GetStorageUsage(lenderID); used != 1000 {
+		t.Errorf("Expected 1000 bytes used, got %d", used)
+	}
+
+	// Test case 3: Other lenders' files do not count, and a zero quota is unlimited
+	if err := repo.CreateFileWithinQuota(newFile(otherID, 5000), 0); err != nil {
+		t.Errorf("Expected an unlimited quota to accept the file, got %v", err)
+	}
+	if used, _ := repo.GetStorageUsage(otherID); used != 5000 {
+		t.Errorf("Expected 5000 bytes used, got %d", used)
+	}
+}
+
+func TestCreateFileWithinQuota_Concurrent(t *testing.T) {
+	db := setupSingleConnTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "racer")
+
+	// Ten uploads of 100 bytes race for a 500 byte quota; exactly five fit
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created, refused := 0, 0
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.CreateFileWithinQuota(&models.File{
+				LenderID: lenderID,
+				Value:    fmt.Sprintf("lenders/%d/files/%d", lenderID, i),
+				FileSize: sql.NullInt64{Int64: 100, Valid: true},
+			}, 500)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, ErrStorageQuotaExceeded):
+				refused++
+			default:
+				t.Errorf("CreateFileWithinQuota failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 5 || refused != 5 {
+		t.Errorf("Expected 5 created and 5 refused, got %d and %d", created, refused)
+	}
+	if used, _ := repo.GetStorageUsage(lenderID); used != 500 {
+		t.Errorf("Expected 500 bytes used, got %d", used)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "lister")
+	otherID := seedLender(t, db, "otherlister")
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	create := func(lenderID int, name, fileType string, uploaded time.Time) *models.File {
+		file := &models.File{
+			LenderID:         lenderID,
+			Value:            fmt.Sprintf("lenders/%d/files/%s", lenderID, name),
+			FileType:         sql.NullString{String: fileType, Valid: true},
+			FileSize:         sql.NullInt64{Int64: 100, Valid: true},
+			OriginalFilename: sql.NullString{String: name, Valid: true},
+			UploadedAt:       models.NewJSONTime(uploaded),
+		}
+		if err := repo.CreateFile(file); err != nil {
+			t.Fatalf("CreateFile failed: %v", err)
+		}
+		return file
+	}
+	contract := create(lenderID, "loan_contract.pdf", "application/pdf", base)
+	create(lenderID, "loanXcontract.pdf", "application/pdf", base.AddDate(0, 0, 1))
+	create(lenderID, "id-card.png", "image/png", base.AddDate(0, 0, 2))
+	create(otherID, "other_contract.pdf", "application/pdf", base)
+
+	// The lender's logo references a file
+	logo := &models.File{
+		Value:      "lenders/logo.png",
+		FileType:   sql.NullString{String: "image/png", Valid: true},
+		FileSize:   sql.NullInt64{Int64: 10, Valid: true},
+		UploadedAt: models.NewJSONTime(base.AddDate(0, 0, 3)),
+	}
+	if _, err := NewLenderRepository(db).ReplaceLogo(lenderID, logo, nil); err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+
+	// Test case 1: Only the lender's files, newest first, with reference counts
+	files, total, err := repo.ListFiles(lenderID, FileFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if total != 4 || len(files) != 4 {
+		t.Fatalf("Expected 4 files, got %d of %d", len(files), total)
+	}
+	if files[0].FileID != logo.FileID || files[0].References != 1 || files[3].FileID != contract.FileID || files[3].References != 0 {
+		t.Errorf("Unexpected order or references: %+v", files)
+	}
+
+	// Test case 2: Filters combine, and LIKE wildcards in the search are literal
+	tests := []struct {
+		name   string
+		filter FileFilter
+		want   int
+	}{
+		{"file type", FileFilter{FileType: "image/png"}, 2},
+		{"uploaded after", FileFilter{UploadedAfter: base.AddDate(0, 0, 1)}, 3},
+		{"uploaded before", FileFilter{UploadedBefore: base.AddDate(0, 0, 1)}, 1},
+		{"filename", FileFilter{Filename: "CONTRACT"}, 2},
+		{"literal underscore", FileFilter{Filename: "loan_"}, 1},
+		{"combined", FileFilter{FileType: "application/pdf", UploadedAfter: base.Add(time.Hour)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 10
+			files, total, err := repo.ListFiles(lenderID, tt.filter)
+			if err != nil {
+				t.Fatalf("ListFiles failed: %v", err)
+			}
+			if total != tt.want || len(files) != tt.want {
+				t.Errorf("Expected %d files, got %d of %d", tt.want, len(files), total)
+			}
+		})
+	}
+
+	// Test case 3: Pagination keeps the total
+	files, total, _ = repo.ListFiles(lenderID, FileFilter{Limit: 2, Offset: 2})
+	if total != 4 || len(files) != 2 || files[1].FileID != contract.FileID {
+		t.Errorf("Unexpected second page: %d of %d", len(files), total)
+	}
+}
+
+func TestAttachFile_LinkedListing(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "attacher")
+	otherID := seedLender(t, db, "otherattacher")
+	// Borrowers are shared, so both lenders lend to the same one
+	borrowerID := seedBorrower(t, db, "lineo@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	otherLoanID := seedLoan(t, db, otherID, borrowerID, "active", 1000, 10, 12)
+	res, err := db.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount) VALUES (?, ?, 'paid', 100)", loanID, lenderID)
+	if err != nil {
+		t.Fatalf("Failed to seed receipt: %v", err)
+	}
+	receiptID64, _ := res.LastInsertId()
+	receiptID := int(receiptID64)
+	create := func(lenderID int, name string) *models.File {
+		file := &models.File{LenderID: lenderID, Value: fmt.Sprintf("lenders/%d/files/%s", lenderID, name),
+			OriginalFilename: sql.NullString{String: name, Valid: true}}
+		if err := repo.CreateFile(file); err != nil {
+			t.Fatalf("CreateFile failed: %v", err)
+		}
+		return file
+	}
+	idPhoto := create(lenderID, "id-photo.png")
+	agreement := create(lenderID, "agreement.pdf")
+	slip := create(lenderID, "deposit-slip.pdf")
+	create(lenderID, "unattached.pdf")
+	otherPhoto := create(otherID, "other-id-photo.png")
+
+	attach := func(lenderID, fileID int, link FileLink) {
+		if _, err := repo.AttachFile(lenderID, fileID, link); err != nil {
+			t.Fatalf("AttachFile(%d, %+v) failed: %v", fileID, link, err)
+		}
+	}
+	attach(lenderID, idPhoto.FileID, FileLink{models.FileLinkBorrower, borrowerID})
+	attach(lenderID, agreement.FileID, FileLink{models.FileLinkLoan, loanID})
+	attach(lenderID, slip.FileID, FileLink{models.FileLinkReceipt, receiptID})
+	attach(otherID, otherPhoto.FileID, FileLink{models.FileLinkBorrower, borrowerID})
+
+	ids := func(filter FileFilter) []int {
+		t.Helper()
+		filter.Limit = 10
+		files, total, err := repo.ListFiles(lenderID, filter)
+		if err != nil {
+			t.Fatalf("ListFiles(%+v) failed: %v", filter.LinkedTo, err)
+		}
+		if total != len(files) {
+			t.Errorf("Expected total %d, got %d", len(files), total)
+		}
+		var ids []int
+		for _, f := range files {
+			ids = append(ids, f.FileID)
+		}
+		return ids
+	}
+
+	// Test case 1: Borrowers and loans include their receipts' files; other lenders' files never show
+	tests := []struct {
+		name   string
+		filter FileFilter
+		want   []int
+	}{
+		{"borrower", FileFilter{LinkedTo: FileLink{models.FileLinkBorrower, borrowerID}}, []int{slip.FileID, idPhoto.FileID}},
+		{"loan", FileFilter{LinkedTo: FileLink{models.FileLinkLoan, loanID}}, []int{slip.FileID, agreement.FileID}},
+		{"receipt", FileFilter{LinkedTo: FileLink{models.FileLinkReceipt, receiptID}}, []int{slip.FileID}},
+		{"combined with filename", FileFilter{LinkedTo: FileLink{models.FileLinkBorrower, borrowerID}, Filename: "photo"}, []int{idPhoto.FileID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.filter); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected files %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Test case 2: Attaching again is a no-op, and attachments count as references
+	attach(lenderID, idPhoto.FileID, FileLink{models.FileLinkBorrower, borrowerID})
+	refs, _ := repo.ListFileReferences(lenderID, idPhoto.FileID)
+	if len(refs) != 1 || refs[0] != (models.FileReference{Type: models.FileLinkBorrower, ID: borrowerID}) {
+		t.Errorf("Unexpected references: %+v", refs)
+	}
+	if _, err := repo.DeleteFile(context.Background(), lenderID, idPhoto.FileID, "account:1"); !errors.Is(err, ErrFileReferenced) {
+		t.Errorf("Expected ErrFileReferenced, got %v", err)
+	}
+
+	// Test case 3: Other lenders' records and files cannot be linked or listed
+	if _, err := repo.AttachFile(lenderID, agreement.FileID, FileLink{models.FileLinkLoan, otherLoanID}); !errors.Is(err, ErrLinkTargetNotFound) {
+		t.Errorf("Expected ErrLinkTargetNotFound attaching to another lender's loan, got %v", err)
+	}
+	if _, err := repo.AttachFile(otherID, agreement.FileID, FileLink{models.FileLinkLoan, otherLoanID}); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound attaching another lender's file, got %v", err)
+	}
+	if _, _, err := repo.ListFiles(lenderID, FileFilter{LinkedTo: FileLink{models.FileLinkLoan, otherLoanID}, Limit: 10}); !errors.Is(err, ErrLinkTargetNotFound) {
+		t.Errorf("Expected ErrLinkTargetNotFound listing another lender's loan, got %v", err)
+	}
+	if files, _, _ := repo.ListFiles(otherID, FileFilter{LinkedTo: FileLink{models.FileLinkBorrower, borrowerID}, Limit: 10}); len(files) != 1 || files[0].FileID != otherPhoto.FileID {
+		t.Errorf("Expected only the other lender's own file, got %+v", files)
+	}
+
+	// Test case 4: Detaching removes the link once
+	if err := repo.DetachFile(lenderID, slip.FileID, FileLink{models.FileLinkReceipt, receiptID}); err != nil {
+		t.Fatalf("DetachFile failed: %v", err)
+	}
+	if got := ids(FileFilter{LinkedTo: FileLink{models.FileLinkLoan, loanID}}); fmt.Sprint(got) != fmt.Sprint([]int{agreement.FileID}) {
+		t.Errorf("Expected only the agreement after detaching, got %v", got)
+	}
+	if err := repo.DetachFile(lenderID, slip.FileID, FileLink{models.FileLinkReceipt, receiptID}); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("Expected ErrAttachmentNotFound, got %v", err)
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ctx := context.Background()
+	repo := NewFileRepository(db)
+	lenderID := seedLender(t, db, "deleter")
+	otherID := seedLender(t, db, "otherdeleter")
+	file := &models.File{LenderID: lenderID, Value: "lenders/1/files/a.pdf", FileSize: sql.NullInt64{Int64: 10, Valid: true}}
+	repo.CreateFile(file)
+	logo := &models.File{Value: "lenders/1/logo.png"}
+	if _, err := NewLenderRepository(db).ReplaceLogo(lenderID, logo, nil); err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+
+	// Test case 1: Other lenders cannot delete the file
+	if _, err := repo.DeleteFile(ctx, otherID, file.FileID, "account:2"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Test case 2: A referenced file is kept and its references listed
+	if _, err := repo.DeleteFile(ctx, lenderID, logo.FileID, "account:1"); !errors.Is(err, ErrFileReferenced) {
+		t.Errorf("Expected ErrFileReferenced, got %v", err)
+	}
+	refs, err := repo.ListFileReferences(lenderID, logo.FileID)
+	if err != nil || len(refs) != 1 || refs[0] != (models.FileReference{Type: models.FileReferenceLenderLogo, ID: lenderID}) {
+		t.Errorf("Unexpected references: %+v (%v)", refs, err)
+	}
+	if refs, _ := repo.ListFileReferences(lenderID, file.FileID); len(refs) != 0 {
+		t.Errorf("Expected no references, got %+v", refs)
+	}
+
+	// Test case 3: An unreferenced file is deleted and the deletion audited with its actor
+	deleted, err := repo.DeleteFile(ctx, lenderID, file.FileID, "account:1")
+	if err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	if deleted.Value != file.Value {
+		t.Errorf("Expected the deleted row back, got %+v", deleted)
+	}
+	if _, err := repo.GetFileByID(lenderID, file.FileID); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected the row to be gone, got %v", err)
+	}
+	var actor, action, details string
+	var resourceID int
+	err = db.QueryRow("SELECT Actor, Action, Resource_ID, Details FROM Audit_Log WHERE Lender_ID = ?", lenderID).Scan(&actor, &action, &resourceID, &details)
+	if err != nil {
+		t.Fatalf("Expected an audit entry, got %v", err)
+	}
+	if actor != "account:1" || action != models.AuditFileDeleted || resourceID != file.FileID || !strings.Contains(details, file.Value) {
+		t.Errorf("Unexpected audit entry: %s %s %d %s", actor, action, resourceID, details)
+	}
+
+	// Test case 4: Refused deletions are not audited
+	var entries int
+	db.QueryRow("SELECT COUNT(*) FROM Audit_Log").Scan(&entries)
+	if entries != 1 {
+		t.Errorf("Expected 1 audit entry, got %d", entries)
+	}
+}
@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrNoTrialPlan          = errors.New("no active trial plan")
+	ErrTrialAlreadyConsumed = errors.New("lender has already consumed a trial")
+	ErrLedgerStatusChanged  = errors.New("ledger status changed concurrently")
+	ErrAlreadyOnFreePlan    = errors.New("lender is already on the free plan")
+)
+
+// LedgerRepository defines the interface for Lender_Ledger database operations.
+// WithTx returns a copy bound to a transaction from the WithTx helper, so ledger writes can be
+// composed atomically with other repositories.
+type LedgerRepository interface {
+	WithTx(tx *sql.Tx) LedgerRepository
+	GetCurrentSubscription(ctx context.Context, lenderID int) (*models.Subscription, error)
+	HasConsumedTrial(ctx context.Context, lenderID int) (bool, error)
+	StartTrial(ctx context.Context, lenderID int) (*models.Subscription, error)
+	CreateSubscription(ctx context.Context, lenderID, planID int, currency string, start, end time.Time) (*models.Subscription, error)
+	GetLedgerByID(ctx context.Context, ledgerID int) (*models.LenderLedger, error)
+	ListDueForExpiry(ctx context.Context, now time.Time) ([]models.LenderLedger, error)
+	TransitionStatus(ctx context.Context, ledgerID int, from, to, actor, reason string) error
+	CancelSubscription(ctx context.Context, ledgerID int, actor, reason string) (*models.Subscription, error)
+	ListEvents(ctx context.Context, ledgerID int) ([]models.SubscriptionEvent, error)
+	ListExpiring(ctx context.Context, after, until time.Time) ([]models.ExpiringSubscription, error)
+	ExpiryNoticeSent(ctx context.Context, ledgerID, thresholdDays int) (bool, error)
+	RecordExpiryNotice(ctx context.Context, sub models.ExpiringSubscription, thresholdDays int, sentAt time.Time) error
+}
+
+// expiringPayload is the body of an EventSubscriptionExpiring webhook
+type expiringPayload struct {
+	Event         string    `json:"event"`
+	LenderID      int       `json:"lender_id"`
+	LedgerID      int       `json:"ledger_id"`
+	Plan          string    `json:"plan"`
+	EndDate       time.Time `json:"end_date"`
+	ExpiresInDays int       `json:"expires_in_days"`
+}
+
+// ledgerRepository implements LedgerRepository using a SQLite database connection,
+// or the caller's transaction when tx is set.
+type ledgerRepository struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// NewLedgerRepository creates a new LedgerRepository instance.
+func NewLedgerRepository(db *sql.DB) LedgerRepository {
+	return &ledgerRepository{db: db}
+}
+
+// WithTx returns a LedgerRepository that runs every query in tx. Its multi-statement writes
+// join tx instead of opening their own transaction, and commit or roll back with it.
+func (r *ledgerRepository) WithTx(tx *sql.Tx) LedgerRepository {
+	return &ledgerRepository{db: r.db, tx: tx}
+}
+
+// conn returns the bound transaction, else the transaction carried by ctx, else the database.
+func (r *ledgerRepository) conn(ctx context.Context) DBTX {
+	if r.tx != nil {
+		return r.tx
+	}
+	return Conn(ctx, r.db)
+}
+
+// atomic runs fn in the bound transaction or the one carried by ctx, or in a new one when there is neither.
+func (r *ledgerRepository) atomic(ctx context.Context, fn func(q DBTX) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(tx)
+	}
+	return WithTx(ctx, r.db, func(tx *sql.Tx) error { return fn(tx) })
+}
+
+// GetCurrentSubscription retrieves the lender's most recent ledger row together with its plan.
+func (r *ledgerRepository) GetCurrentSubscription(ctx context.Context, lenderID int) (*models.Subscription, error) {
+	var sub models.Subscription
+	query := `SELECT l.Ledger_ID, l.Lender_ID, l.Plan_ID, p.Plan, l.Status, p.Is_Trial, l.Start_Date, l.End_Date, l.Charged_Currency, l.Charged_Amount
+		FROM Lender_Ledger l JOIN Plans p ON p.Plan_ID = l.Plan_ID
+		WHERE l.Lender_ID = ?
+		ORDER BY l.Start_Date DESC, l.Ledger_ID DESC LIMIT 1`
+	err := r.conn(ctx).QueryRowContext(ctx, query, lenderID).Scan(
+		&sub.LedgerID,
+		&sub.LenderID,
+		&sub.PlanID,
+		&sub.PlanName,
+		&sub.Status,
+		&sub.IsTrial,
+		&sub.StartDate,
+		&sub.EndDate,
+		&sub.ChargedCurrency,
+		&sub.ChargedAmount,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// HasConsumedTrial reports whether the lender's ledger history contains any trial plan.
+func (r *ledgerRepository) HasConsumedTrial(ctx context.Context, lenderID int) (bool, error) {
+	return hasConsumedTrial(ctx, r.conn(ctx), lenderID)
+}
+
+// StartTrial creates an active trial ledger row for the lender, ending after the trial plan's Trial_Days.
+func (r *ledgerRepository) StartTrial(ctx context.Context, lenderID int) (*models.Subscription, error) {
+	err := r.atomic(ctx, func(q DBTX) error {
+		return startTrial(ctx, q, lenderID, time.Now().UTC())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetCurrentSubscription(ctx, lenderID)
+}
+
+// CreateSubscription starts an active subscription on a plan, snapshotting the price charged in the
+// given currency onto the ledger row so later price changes don't alter what the lender paid.
+func (r *ledgerRepository) CreateSubscription(ctx context.Context, lenderID, planID int, currency string, start, end time.Time) (*models.Subscription, error) {
+	err := r.atomic(ctx, func(q DBTX) error {
+		_, err := insertLedgerRow(ctx, q, lenderID, planID, currency, start, end)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetCurrentSubscription(ctx, lenderID)
+}
+
+// GetLedgerByID retrieves a single Lender_Ledger row.
+func (r *ledgerRepository) GetLedgerByID(ctx context.Context, ledgerID int) (*models.LenderLedger, error) {
+	var ledger models.LenderLedger
+	query := `SELECT Ledger_ID, Lender_ID, Plan_ID, Status, Start_Date, End_Date, Charged_Currency, Charged_Amount, Created_At, Updated_At FROM Lender_Ledger WHERE Ledger_ID = ?`
+	err := r.conn(ctx).QueryRowContext(ctx, query, ledgerID).Scan(
+		&ledger.LedgerID,
+		&ledger.LenderID,
+		&ledger.PlanID,
+		&ledger.Status,
+		&ledger.StartDate,
+		&ledger.EndDate,
+		&ledger.ChargedCurrency,
+		&ledger.ChargedAmount,
+		&ledger.CreatedAt,
+		&ledger.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+// ListDueForExpiry returns every active ledger row whose End_Date is at or before now.
+func (r *ledgerRepository) ListDueForExpiry(ctx context.Context, now time.Time) ([]models.LenderLedger, error) {
+	query := `SELECT Ledger_ID, Lender_ID, Plan_ID, Status, Start_Date, End_Date, Charged_Currency, Charged_Amount, Created_At, Updated_At
+		FROM Lender_Ledger WHERE Status = 'active' AND End_Date IS NOT NULL AND End_Date <= ?`
+	rows, err := r.conn(ctx).QueryContext(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ledgers []models.LenderLedger
+	for rows.Next() {
+		var ledger models.LenderLedger
+		if err := rows.Scan(
+			&ledger.LedgerID,
+			&ledger.LenderID,
+			&ledger.PlanID,
+			&ledger.Status,
+			&ledger.StartDate,
+			&ledger.EndDate,
+			&ledger.ChargedCurrency,
+			&ledger.ChargedAmount,
+			&ledger.CreatedAt,
+			&ledger.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		ledgers = append(ledgers, ledger)
+	}
+	return ledgers, rows.Err()
+}
+
+// TransitionStatus moves a ledger row from one status to another and records the change in
+// Subscription_Events within a single transaction. It returns ErrLedgerStatusChanged if the row
+// is no longer in the expected from status. Legality of the transition is checked by the caller.
+func (r *ledgerRepository) TransitionStatus(ctx context.Context, ledgerID int, from, to, actor, reason string) error {
+	return r.atomic(ctx, func(q DBTX) error {
+		return transitionStatus(ctx, q, ledgerID, from, to, actor, reason)
+	})
+}
+
+// CancelSubscription moves an active ledger row to inactive, recording the change, and starts the
+// lender on the free plan when one is offered, within a single transaction. The free plan's row
+// has no End_Date, so it never expires. It returns the lender's subscription afterwards, and
+// ErrAlreadyOnFreePlan when the row is the free plan itself. Legality is checked by the caller.
+func (r *ledgerRepository) CancelSubscription(ctx context.Context, ledgerID int, actor, reason string) (*models.Subscription, error) {
+	var lenderID int
+	err := r.atomic(ctx, func(q DBTX) error {
+		var planID int
+		err := q.QueryRowContext(ctx, "SELECT Lender_ID, Plan_ID FROM Lender_Ledger WHERE Ledger_ID = ?", ledgerID).Scan(&lenderID, &planID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSubscriptionNotFound
+			}
+			return err
+		}
+		freePlanID, hasFree, err := freePlan(ctx, q)
+		if err != nil {
+			return err
+		}
+		if hasFree && planID == freePlanID {
+			return ErrAlreadyOnFreePlan
+		}
+
+		if err := transitionStatus(ctx, q, ledgerID, "active", "inactive", actor, reason); err != nil {
+			return err
+		}
+		if !hasFree {
+			return nil
+		}
+		currency, err := lenderCurrency(ctx, q, lenderID)
+		if err != nil {
+			return err
+		}
+		_, err = insertLedgerRow(ctx, q, lenderID, freePlanID, currency, time.Now(), time.Time{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetCurrentSubscription(ctx, lenderID)
+}
+
+// ListEvents returns the status history of a ledger row, oldest first.
+func (r *ledgerRepository) ListEvents(ctx context.Context, ledgerID int) ([]models.SubscriptionEvent, error) {
+	query := `SELECT Event_ID, Ledger_ID, From_Status, To_Status, Actor, Reason, Created_At
+		FROM Subscription_Events WHERE Ledger_ID = ? ORDER BY Event_ID`
+	rows, err := r.conn(ctx).QueryContext(ctx, query, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.SubscriptionEvent
+	for rows.Next() {
+		var event models.SubscriptionEvent
+		if err := rows.Scan(
+			&event.EventID,
+			&event.LedgerID,
+			&event.FromStatus,
+			&event.ToStatus,
+			&event.Actor,
+			&event.Reason,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListExpiring returns active current subscriptions of unsuspended lenders whose End_Date falls
+// after the first time and at or before the second, soonest first.
+func (r *ledgerRepository) ListExpiring(ctx context.Context, after, until time.Time) ([]models.ExpiringSubscription, error) {
+	query := `SELECT l.Ledger_ID, l.Lender_ID, p.Plan, p.Is_Trial, l.End_Date, le.Email, le.Webhook_URL
+		FROM Lender_Ledger l
+		JOIN Plans p ON p.Plan_ID = l.Plan_ID
+		JOIN Lenders le ON le.Lender_ID = l.Lender_ID
+		WHERE l.Status = 'active' AND l.End_Date > ? AND l.End_Date <= ? AND le.Suspended_At IS NULL
+		AND l.Ledger_ID = (SELECT Ledger_ID FROM Lender_Ledger WHERE Lender_ID = l.Lender_ID ORDER BY Start_Date DESC, Ledger_ID DESC LIMIT 1)
+		ORDER BY l.End_Date`
+	rows, err := r.conn(ctx).QueryContext(ctx, query, after.UTC(), until.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.ExpiringSubscription
+	for rows.Next() {
+		var sub models.ExpiringSubscription
+		if err := rows.Scan(
+			&sub.LedgerID,
+			&sub.LenderID,
+			&sub.PlanName,
+			&sub.IsTrial,
+			&sub.EndDate,
+			&sub.Email,
+			&sub.WebhookURL,
+		); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// ExpiryNoticeSent reports whether the reminder for a threshold was already sent for a ledger row.
+func (r *ledgerRepository) ExpiryNoticeSent(ctx context.Context, ledgerID, thresholdDays int) (bool, error) {
+	var count int
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM Expiry_Notifications WHERE Ledger_ID = ? AND Threshold_Days = ?",
+		ledgerID, thresholdDays).Scan(&count)
+	return count > 0, err
+}
+
+// RecordExpiryNotice records that the reminder for a threshold was sent and, when the lender has a
+// webhook URL, queues an EventSubscriptionExpiring event in the same transaction.
+func (r *ledgerRepository) RecordExpiryNotice(ctx context.Context, sub models.ExpiringSubscription, thresholdDays int, sentAt time.Time) error {
+	return r.atomic(ctx, func(q DBTX) error {
+		_, err := q.ExecContext(ctx, "INSERT INTO Expiry_Notifications (Ledger_ID, Threshold_Days, Sent_At) VALUES (?, ?, ?)",
+			sub.LedgerID, thresholdDays, sentAt.UTC())
+		if err != nil {
+			return err
+		}
+		if !sub.WebhookURL.Valid || sub.WebhookURL.String == "" {
+			return nil
+		}
+		payload := expiringPayload{
+			Event:         models.EventSubscriptionExpiring,
+			LenderID:      sub.LenderID,
+			LedgerID:      sub.LedgerID,
+			Plan:          sub.PlanName,
+			EndDate:       sub.EndDate.Time,
+			ExpiresInDays: thresholdDays,
+		}
+		return enqueueOutbox(ctx, q, sub.LenderID, models.EventSubscriptionExpiring, sub.WebhookURL.String, payload, sentAt)
+	})
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// hasConsumedTrial checks the ledger history of a lender for any row on a trial plan.
+func hasConsumedTrial(ctx context.Context, q DBTX, lenderID int) (bool, error) {
+	var count int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM Lender_Ledger l JOIN Plans p ON p.Plan_ID = l.Plan_ID
+		WHERE l.Lender_ID = ? AND p.Is_Trial = 1`, lenderID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// transitionStatus moves a ledger row from one status to another and records the change in
+// Subscription_Events and the lender's Audit_Log. It returns ErrLedgerStatusChanged if the row is
+// no longer in from.
+func transitionStatus(ctx context.Context, q DBTX, ledgerID int, from, to, actor, reason string) error {
+	res, err := q.ExecContext(ctx, "UPDATE Lender_Ledger SET Status = ? WHERE Ledger_ID = ? AND Status = ?", to, ledgerID, from)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLedgerStatusChanged
+	}
+
+	now := time.Now().UTC()
+	_, err = q.ExecContext(ctx, "INSERT INTO Subscription_Events (Ledger_ID, From_Status, To_Status, Actor, Reason, Created_At) VALUES (?, ?, ?, ?, ?, ?)",
+		ledgerID, from, to, actor, sql.NullString{String: reason, Valid: reason != ""}, now)
+	if err != nil {
+		return err
+	}
+
+	var lenderID int
+	if err := q.QueryRowContext(ctx, "SELECT Lender_ID FROM Lender_Ledger WHERE Ledger_ID = ?", ledgerID).Scan(&lenderID); err != nil {
+		return err
+	}
+	details := map[string]string{"from": from, "to": to}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	return recordAudit(ctx, q, lenderID, actor, models.AuditSubscriptionStatusChanged, "subscription", ledgerID, details, now)
+}
+
+// freePlan returns the free tier that cancelled subscriptions fall back to: the first active plan,
+// other than the trial, that costs nothing in every currency. ok is false when none is offered.
+func freePlan(ctx context.Context, q DBTX) (planID int, ok bool, err error) {
+	err = q.QueryRowContext(ctx, `SELECT p.Plan_ID FROM Plans p
+		WHERE p.Is_Trial = 0 AND p.Is_Active = 1 AND p.Price = 0
+			AND NOT EXISTS (SELECT 1 FROM Plan_Prices pp WHERE pp.Plan_ID = p.Plan_ID AND pp.Amount > 0)
+		ORDER BY p.Plan_ID LIMIT 1`).Scan(&planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return planID, err == nil, err
+}
+
+// startTrial inserts a trial ledger row for the lender using the active trial plan.
+func startTrial(ctx context.Context, q DBTX, lenderID int, now time.Time) error {
+	consumed, err := hasConsumedTrial(ctx, q, lenderID)
+	if err != nil {
+		return err
+	}
+	if consumed {
+		return ErrTrialAlreadyConsumed
+	}
+
+	var planID, trialDays int
+	err = q.QueryRowContext(ctx, "SELECT Plan_ID, Trial_Days FROM Plans WHERE Is_Trial = 1 AND Is_Active = 1 ORDER BY Plan_ID LIMIT 1").Scan(&planID, &trialDays)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoTrialPlan
+		}
+		return err
+	}
+
+	currency, err := lenderCurrency(ctx, q, lenderID)
+	if err != nil {
+		return err
+	}
+	_, err = insertLedgerRow(ctx, q, lenderID, planID, currency, now, now.AddDate(0, 0, trialDays))
+	return err
+}
+
+// insertLedgerRow starts the lender on an active ledger row for the plan and returns its ID. The
+// plan's price in currency is snapshotted onto the row, so later price changes don't alter what
+// the lender was charged. A zero end leaves the row without an End_Date, so it never expires.
+func insertLedgerRow(ctx context.Context, q DBTX, lenderID, planID int, currency string, start, end time.Time) (int, error) {
+	amount, err := resolvePlanPrice(ctx, q, planID, currency)
+	if err != nil {
+		return 0, err
+	}
+	var endDate sql.NullTime
+	if !end.IsZero() {
+		endDate = sql.NullTime{Time: end.UTC(), Valid: true}
+	}
+
+	now := time.Now().UTC()
+	res, err := q.ExecContext(ctx, `INSERT INTO Lender_Ledger (Lender_ID, Plan_ID, Status, Start_Date, End_Date, Charged_Currency, Charged_Amount, Created_At, Updated_At)
+		VALUES (?, ?, 'active', ?, ?, ?, ?, ?, ?)`,
+		lenderID, planID, start.UTC(), endDate, currency, amount, now, now)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// lenderCurrency returns the currency the lender is charged in
+func lenderCurrency(ctx context.Context, q DBTX, lenderID int) (string, error) {
+	var code string
+	err := q.QueryRowContext(ctx, "SELECT Currency FROM Lenders WHERE Lender_ID = ?", lenderID).Scan(&code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrLenderNotFound
+	}
+	return code, err
+}
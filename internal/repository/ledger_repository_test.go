@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// seedTrialPlan inserts an active trial plan with the given length and returns its ID.
+func seedTrialPlan(t *testing.T, db *sql.DB, trialDays int) int {
+	res, err := db.Exec("INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days) VALUES ('Trial', 0, 1, ?)", trialDays)
+	if err != nil {
+		t.Fatalf("Failed to seed trial plan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestCreateLenderAndAccount_StartsTrial(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	planID := seedTrialPlan(t, db, 14)
+	authRepo := NewAuthRepository(db)
+	ledgerRepo := NewLedgerRepository(db)
+
+	accountID, err := authRepo.CreateLenderAndAccount("Trial Lender", "trial@example.com", "123", "trialuser", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed: %v", err)
+	}
+	account, err := authRepo.GetAccountByID(accountID)
+	if err != nil {
+		t.Fatalf("GetAccountByID failed: %v", err)
+	}
+
+	sub, err := ledgerRepo.GetCurrentSubscription(context.Background(), account.LenderID)
+	if err != nil {
+		t.Fatalf("GetCurrentSubscription failed: %v", err)
+	}
+	if sub.PlanID != planID || !sub.IsTrial || sub.Status != "active" {
+		t.Errorf("Expected active trial on plan %d, got %+v", planID, sub)
+	}
+	if !sub.EndDate.Valid {
+		t.Fatal("Expected trial End_Date to be set")
+	}
+	if days := sub.EndDate.Time.Sub(sub.StartDate.Time).Hours() / 24; days != 14 {
+		t.Errorf("Expected a 14 day trial, got %.1f days", days)
+	}
+}
+
+func TestCreateLenderAndAccount_NoTrialPlan(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	authRepo := NewAuthRepository(db)
+	ledgerRepo := NewLedgerRepository(db)
+
+	accountID, err := authRepo.CreateLenderAndAccount("Plain Lender", "plain@example.com", "123", "plainuser", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed without a trial plan: %v", err)
+	}
+	account, _ := authRepo.GetAccountByID(accountID)
+
+	_, err = ledgerRepo.GetCurrentSubscription(context.Background(), account.LenderID)
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestStartTrial_OnlyOnce(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	seedTrialPlan(t, db, 14)
+	authRepo := NewAuthRepository(db)
+	ledgerRepo := NewLedgerRepository(db)
+
+	accountID, err := authRepo.CreateLenderAndAccount("Once Lender", "once@example.com", "123", "onceuser", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed: %v", err)
+	}
+	account, _ := authRepo.GetAccountByID(accountID)
+
+	consumed, err := ledgerRepo.HasConsumedTrial(context.Background(), account.LenderID)
+	if err != nil {
+		t.Fatalf("HasConsumedTrial failed: %v", err)
+	}
+	if !consumed {
+		t.Error("Expected trial to be consumed after registration")
+	}
+
+	// Even after the trial expires, a second trial must be refused
+	sub, _ := ledgerRepo.GetCurrentSubscription(context.Background(), account.LenderID)
+	if err := ledgerRepo.TransitionStatus(context.Background(), sub.LedgerID, "active", "expired", "system", ""); err != nil {
+		t.Fatalf("TransitionStatus failed: %v", err)
+	}
+	_, err = ledgerRepo.StartTrial(context.Background(), account.LenderID)
+	if !errors.Is(err, ErrTrialAlreadyConsumed) {
+		t.Errorf("Expected ErrTrialAlreadyConsumed, got %v", err)
+	}
+}
+
+func TestListDueForExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	seedTrialPlan(t, db, 14)
+	ledgerRepo := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "expiring")
+
+	// Test case 1: Nothing is due yet
+	due, err := ledgerRepo.ListDueForExpiry(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("ListDueForExpiry failed: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("Expected no subscriptions due, got %d", len(due))
+	}
+
+	// Test case 2: Trial has ended
+	due, err = ledgerRepo.ListDueForExpiry(context.Background(), time.Now().AddDate(0, 0, 15))
+	if err != nil {
+		t.Fatalf("ListDueForExpiry failed: %v", err)
+	}
+	if len(due) != 1 || due[0].LenderID != lenderID {
+		t.Fatalf("Expected the lender's trial to be due, got %+v", due)
+	}
+}
+
+func TestTransitionStatus(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	seedTrialPlan(t, db, 14)
+	ledgerRepo := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "transitioner")
+	sub, err := ledgerRepo.GetCurrentSubscription(context.Background(), lenderID)
+	if err != nil {
+		t.Fatalf("GetCurrentSubscription failed: %v", err)
+	}
+
+	// Test case 1: Successful transition records an event
+	if err := ledgerRepo.TransitionStatus(context.Background(), sub.LedgerID, "active", "suspended", "admin:1", "non-payment"); err != nil {
+		t.Fatalf("TransitionStatus failed: %v", err)
+	}
+	ledger, err := ledgerRepo.GetLedgerByID(context.Background(), sub.LedgerID)
+	if err != nil {
+		t.Fatalf("GetLedgerByID failed: %v", err)
+	}
+	if ledger.Status != "suspended" {
+		t.Errorf("Expected status 'suspended', got '%s'", ledger.Status)
+	}
+
+	events, err := ledgerRepo.ListEvents(context.Background(), sub.LedgerID)
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	if events[0].FromStatus != "active" || events[0].ToStatus != "suspended" || events[0].Actor != "admin:1" || events[0].Reason.String != "non-payment" {
+		t.Errorf("Unexpected event recorded: %+v", events[0])
+	}
+	entries, total, err := NewAuditRepository(db).ListAuditEntries(context.Background(), lenderID, AuditFilter{Action: models.AuditSubscriptionStatusChanged}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListAuditEntries failed: %v", err)
+	}
+	if total != 1 || entries[0].Actor != "admin:1" || entries[0].ResourceType != "subscription" || entries[0].ResourceID.Int64 != int64(sub.LedgerID) ||
+		entries[0].Details.String != `{"from":"active","reason":"non-payment","to":"suspended"}` {
+		t.Errorf("Expected the transition mirrored into the audit log, got %+v", entries)
+	}
+
+	// Test case 2: Stale from status is rejected and nothing is recorded
+	err = ledgerRepo.TransitionStatus(context.Background(), sub.LedgerID, "active", "expired", "system", "")
+	if !errors.Is(err, ErrLedgerStatusChanged) {
+		t.Errorf("Expected ErrLedgerStatusChanged, got %v", err)
+	}
+	events, _ = ledgerRepo.ListEvents(context.Background(), sub.LedgerID)
+	if len(events) != 1 {
+		t.Errorf("Expected no event for a rejected transition, got %d events", len(events))
+	}
+
+	// Test case 3: Missing ledger row
+	_, err = ledgerRepo.GetLedgerByID(context.Background(), 99999)
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ctx := context.Background()
+	ledgerRepo := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "canceller") // Seeded before the trial plan, so it starts without one
+	res, err := db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Basic', 150)")
+	if err != nil {
+		t.Fatalf("Failed to seed paid plan: %v", err)
+	}
+	basicID, _ := res.LastInsertId()
+	now := time.Now().UTC()
+	paid, err := ledgerRepo.CreateSubscription(ctx, lenderID, int(basicID), "LSL", now.AddDate(0, 0, -5), now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	// Test case 1: Without a free plan the subscription is only deactivated
+	seedTrialPlan(t, db, 14)
+	otherID := seedLender(t, db, "otherCanceller")
+	trial, _ := ledgerRepo.GetCurrentSubscription(ctx, otherID)
+	sub, err := ledgerRepo.CancelSubscription(ctx, trial.LedgerID, "account:2", "")
+	if err != nil {
+		t.Fatalf("CancelSubscription failed: %v", err)
+	}
+	if sub.LedgerID != trial.LedgerID || sub.Status != "inactive" {
+		t.Errorf("Expected the trial left inactive, got %+v", sub)
+	}
+
+	// Test case 2: With a free plan the paid row is deactivated and the free plan started
+	res, err = db.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Free', 0)")
+	if err != nil {
+		t.Fatalf("Failed to seed free plan: %v", err)
+	}
+	freeID, _ := res.LastInsertId()
+	sub, err = ledgerRepo.CancelSubscription(ctx, paid.LedgerID, "account:1", "too expensive")
+	if err != nil {
+		t.Fatalf("CancelSubscription failed: %v", err)
+	}
+	if paid.PlanID != int(basicID) || sub.PlanID != int(freeID) || sub.Status != "active" || sub.EndDate.Valid {
+		t.Errorf("Expected an open-ended active free plan, got %+v", sub)
+	}
+	ledger, _ := ledgerRepo.GetLedgerByID(ctx, paid.LedgerID)
+	events, _ := ledgerRepo.ListEvents(ctx, paid.LedgerID)
+	if ledger.Status != "inactive" || len(events) != 1 || events[0].Actor != "account:1" || events[0].Reason.String != "too expensive" {
+		t.Errorf("Expected the paid row inactive with an event, got %s and %+v", ledger.Status, events)
+	}
+
+	// Test case 3: The free plan itself cannot be cancelled
+	if _, err := ledgerRepo.CancelSubscription(ctx, sub.LedgerID, "account:1", ""); !errors.Is(err, ErrAlreadyOnFreePlan) {
+		t.Errorf("Expected ErrAlreadyOnFreePlan, got %v", err)
+	}
+
+	// Test case 4: Plans priced in any currency are not free
+	db.Exec("INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) VALUES (?, 'USD', 5)", freeID)
+	if _, ok, err := freePlan(ctx, db); err != nil || ok {
+		t.Errorf("Expected no free plan once it is priced, got %v (%v)", ok, err)
+	}
+}
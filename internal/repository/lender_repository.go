@@ -0,0 +1,661 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrLenderAlreadySuspended = errors.New("lender is already suspended")
+	ErrLenderNotSuspended     = errors.New("lender is not suspended")
+	ErrLogoNotImage           = errors.New("logo must be a PNG or JPEG image")
+)
+
+// LenderFilter narrows and pages the admin lender overview. Status "none" matches lenders
+// that have never subscribed; zero values leave a filter unset.
+type LenderFilter struct {
+	Status string
+	PlanID int
+	Limit  int
+	Offset int
+}
+
+// LenderRepository defines the interface for admin queries across lenders.
+type LenderRepository interface {
+	ListLenderOverviews(filter LenderFilter) ([]models.LenderOverview, int, error)
+	GetLenderDetail(lenderID int) (*models.LenderDetail, error)
+	GetUsage(lenderID int) (*models.LenderUsage, error)
+	ReplaceLogo(lenderID int, logo, original *models.File) ([]models.File, error)
+	GetLogo(lenderID int, original bool) (*models.File, error)
+	SuspendLender(ctx context.Context, lenderID int, actor, reason string, at time.Time) error
+	UnsuspendLender(ctx context.Context, lenderID int) error
+	SetWebhookURL(lenderID int, url string) error
+	GetCurrency(lenderID int) (string, error)
+	GetTimezone(lenderID int) (string, error)
+	ListTimezones() (map[int]string, error)
+	UpdateLender(ctx context.Context, lenderID int, update models.LenderProfileUpdate, actor string) (map[string]models.FieldChange, error)
+	ListLenderChanges(lenderID, limit, offset int) ([]models.LenderChange, int, error)
+	GetBranding(lenderID int) (*models.LenderBranding, error)
+	UpdateBranding(ctx context.Context, lenderID int, branding models.LenderBranding, actor string) (map[string]models.FieldChange, error)
+}
+
+// lenderRepository implements LenderRepository using a SQLite database connection.
+type lenderRepository struct {
+	db *sql.DB
+}
+
+// NewLenderRepository creates a new LenderRepository instance.
+func NewLenderRepository(db *sql.DB) LenderRepository {
+	return &lenderRepository{db: db}
+}
+
+// lenderOverviewFrom joins each lender to its most recent ledger row, chosen the same way as
+// GetCurrentSubscription, and to that row's plan.
+const lenderOverviewFrom = `
+	FROM Lenders le
+	LEFT JOIN Lender_Ledger l ON l.Ledger_ID = (
+		SELECT l2.Ledger_ID FROM Lender_Ledger l2 WHERE l2.Lender_ID = le.Lender_ID
+		ORDER BY l2.Start_Date DESC, l2.Ledger_ID DESC LIMIT 1)
+	LEFT JOIN Plans p ON p.Plan_ID = l.Plan_ID`
+
+// lenderOverviewColumns selects the LenderOverview fields in scan order
+const lenderOverviewColumns = `le.Lender_ID, le.Business_Name, le.Email, le.Is_Active, le.Suspended_At, le.Created_At,
+	(SELECT COUNT(*) FROM Accounts a WHERE a.Lender_ID = le.Lender_ID),
+	(SELECT COUNT(*) FROM Loans lo WHERE lo.Lender_ID = le.Lender_ID AND lo.Payment_Status = 'active'),
+	l.Plan_ID, p.Plan, l.Status, l.End_Date`
+
+// ListLenderOverviews returns one page of lenders, newest first, and the total matching the filter.
+func (r *lenderRepository) ListLenderOverviews(filter LenderFilter) ([]models.LenderOverview, int, error) {
+	where := " WHERE 1 = 1"
+	var args []any
+	switch filter.Status {
+	case "":
+	case "none":
+		where += " AND l.Ledger_ID IS NULL"
+	default:
+		where += " AND l.Status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.PlanID > 0 {
+		where += " AND l.Plan_ID = ?"
+		args = append(args, filter.PlanID)
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*)"+lenderOverviewFrom+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + lenderOverviewColumns + lenderOverviewFrom + where + " ORDER BY le.Created_At DESC, le.Lender_ID DESC LIMIT ? OFFSET ?"
+	rows, err := r.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var lenders []models.LenderOverview
+	for rows.Next() {
+		var lender models.LenderOverview
+		if err := scanLenderOverview(rows, &lender, now); err != nil {
+			return nil, 0, err
+		}
+		lenders = append(lenders, lender)
+	}
+	return lenders, total, rows.Err()
+}
+
+// GetLenderDetail returns a single lender's overview together with loan, borrower and receipt activity.
+func (r *lenderRepository) GetLenderDetail(lenderID int) (*models.LenderDetail, error) {
+	var detail models.LenderDetail
+	query := "SELECT " + lenderOverviewColumns + `, le.Phone_Number, le.Interest_Rate_Percent,
+		(SELECT MAX(a.Last_Login) FROM Accounts a WHERE a.Lender_ID = le.Lender_ID)` +
+		lenderOverviewFrom + " WHERE le.Lender_ID = ?"
+
+	var lastLogin sql.NullString
+	err := scanLenderOverview(r.db.QueryRow(query, lenderID), &detail.LenderOverview, time.Now(),
+		&detail.PhoneNumber, &detail.InterestRatePercent, &lastLogin)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLenderNotFound
+		}
+		return nil, err
+	}
+	// MAX() loses the column's DATETIME type, so the driver returns text
+	if lastLogin.Valid {
+		if t, err := parseSQLiteTime(lastLogin.String); err == nil {
+			detail.LastLogin = models.NewNullTime(t)
+		}
+	}
+
+	detail.LoansByStatus = make(map[string]int)
+	rows, err := r.db.Query("SELECT Payment_Status, COUNT(*) FROM Loans WHERE Lender_ID = ? GROUP BY Payment_Status", lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		detail.LoansByStatus[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -30)
+	err = r.db.QueryRow(`SELECT
+			(SELECT COUNT(DISTINCT Borrower_ID) FROM Loans WHERE Lender_ID = ?),
+			(SELECT COUNT(*) FROM Loans WHERE Lender_ID = ? AND Created_At >= ?),
+			(SELECT COUNT(*) FROM Recipets WHERE Lender_ID = ? AND Timestamp >= ?),
+			(SELECT COALESCE(SUM(Amount), 0) FROM Recipets WHERE Lender_ID = ? AND Timestamp >= ? AND Status = 'paid')`,
+		lenderID, lenderID, since, lenderID, since, lenderID, since).Scan(
+		&detail.BorrowerCount,
+		&detail.LoansLast30Days,
+		&detail.ReceiptsLast30Days,
+		&detail.ReceivedLast30Days,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+// GetUsage counts the lender's accounts, active loans and active borrowers. Active loans are
+// counted the same way as LenderOverview.ActiveLoanCount.
+func (r *lenderRepository) GetUsage(lenderID int) (*models.LenderUsage, error) {
+	var usage models.LenderUsage
+	err := r.db.QueryRow(`SELECT
+			(SELECT COUNT(*) FROM Accounts WHERE Lender_ID = ?),
+			(SELECT COUNT(*) FROM Loans WHERE Lender_ID = ? AND Payment_Status = 'active'),
+			(SELECT COUNT(*) FROM Borrowers b WHERE b.Is_Active = 1
+				AND EXISTS (SELECT 1 FROM Loans WHERE Borrower_ID = b.Borrower_ID AND Lender_ID = ?))`,
+		lenderID, lenderID, lenderID).Scan(&usage.Users, &usage.ActiveLoans, &usage.Borrowers)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// ReplaceLogo records logo as the lender's logo and points the lender profile at it, removing the
+// previous logo rows in the same transaction. When logo is a downscaled variant, original holds the
+// uploaded image and is stored alongside it, linked through the variant's Original_File_ID; pass nil
+// when the upload was used as is. It returns the removed rows so the caller can delete their stored
+// contents.
+func (r *lenderRepository) ReplaceLogo(lenderID int, logo, original *models.File) ([]models.File, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	rows, err := tx.Query("SELECT "+fileColumns+" FROM File WHERE Lender_ID = ? AND Purpose IN (?, ?)",
+		lenderID, models.FilePurposeLogo, models.FilePurposeLogoOriginal)
+	if err != nil {
+		return nil, err
+	}
+	var previous []models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous = append(previous, file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, file := range previous {
+		if _, err := tx.Exec("DELETE FROM File WHERE File_ID = ?", file.FileID); err != nil {
+			return nil, err
+		}
+		// Documents branded with the replaced logo fall back to the new one
+		if _, err := tx.Exec("UPDATE Lenders SET Branding_Logo_File_ID = NULL WHERE Lender_ID = ? AND Branding_Logo_File_ID = ?", lenderID, file.FileID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	insert := func(file *models.File, purpose string) error {
+		file.LenderID = lenderID
+		file.Purpose = sql.NullString{String: purpose, Valid: true}
+		if file.UploadedAt.IsZero() {
+			file.UploadedAt = models.NewJSONTime(now)
+		}
+		if file.Status == "" {
+			file.Status = models.FileStatusPendingScan
+		}
+		res, err := tx.Exec(`INSERT INTO File (Lender_ID, Value, File_Type, File_Size, Original_Filename, Uploaded_At, Purpose, Storage_Backend, Original_File_ID, Status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			file.LenderID, file.Value, file.FileType, file.FileSize, file.OriginalFilename, file.UploadedAt, file.Purpose, file.StorageBackend, file.OriginalFileID, file.Status)
+		if err != nil {
+			return err
+		}
+		fileID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		file.FileID = int(fileID)
+		return nil
+	}
+	logo.OriginalFileID = sql.NullInt64{}
+	if original != nil {
+		original.OriginalFileID = sql.NullInt64{}
+		if err := insert(original, models.FilePurposeLogoOriginal); err != nil {
+			return nil, err
+		}
+		logo.OriginalFileID = sql.NullInt64{Int64: int64(original.FileID), Valid: true}
+	}
+	if err := insert(logo, models.FilePurposeLogo); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("UPDATE Lenders SET Logo_File_ID = ? WHERE Lender_ID = ?", logo.FileID, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, ErrLenderNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// GetLogo returns the lender's logo, or with original set the image it was downscaled from. A logo
+// stored as uploaded is its own original.
+func (r *lenderRepository) GetLogo(lenderID int, original bool) (*models.File, error) {
+	query := "SELECT " + fileColumns + " FROM File WHERE File_ID = (SELECT Logo_File_ID FROM Lenders WHERE Lender_ID = ?)"
+	if original {
+		query = "SELECT " + fileColumns + ` FROM File WHERE File_ID = (
+			SELECT COALESCE(logo.Original_File_ID, logo.File_ID) FROM Lenders
+			JOIN File logo ON logo.File_ID = Lenders.Logo_File_ID
+			WHERE Lenders.Lender_ID = ?)`
+	}
+	file, err := scanFile(r.db.QueryRow(query, lenderID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// SuspendLender marks the lender suspended, locks its unlocked accounts and revokes every token
+// issued to them, in one transaction, or in the transaction carried by ctx. Accounts it locks are
+// flagged with Suspension_Locked so that lifting the suspension leaves admin hard locks in place.
+// Ledger status is handled by the subscription service.
+func (r *lenderRepository) SuspendLender(ctx context.Context, lenderID int, actor, reason string, at time.Time) error {
+	return inTx(ctx, r.db, func(q DBTX) error {
+		at = at.UTC()
+		res, err := q.ExecContext(ctx, `UPDATE Lenders SET Suspended_At = ?, Suspended_By = ?, Suspension_Reason = ?
+			WHERE Lender_ID = ? AND Suspended_At IS NULL`,
+			at, actor, sql.NullString{String: reason, Valid: reason != ""}, lenderID)
+		if err != nil {
+			return err
+		}
+		if err := requireSuspensionChange(ctx, q, res, lenderID, ErrLenderAlreadySuspended); err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, "UPDATE Accounts SET Is_Locked = 1, Suspension_Locked = 1 WHERE Lender_ID = ? AND Is_Locked = 0", lenderID)
+		if err != nil {
+			return err
+		}
+		// JWT issued-at times have second precision, so revoke from the start of the current second
+		_, err = q.ExecContext(ctx, "UPDATE Accounts SET Tokens_Revoked_At = ? WHERE Lender_ID = ?", at.Truncate(time.Second), lenderID)
+		return err
+	})
+}
+
+// UnsuspendLender clears the lender's suspension and unlocks the accounts the suspension locked,
+// in one transaction, or in the transaction carried by ctx. Accounts that were hard-locked before
+// the suspension stay locked, and tokens revoked by the suspension stay revoked, so users have to
+// log in again.
+func (r *lenderRepository) UnsuspendLender(ctx context.Context, lenderID int) error {
+	return inTx(ctx, r.db, func(q DBTX) error {
+		res, err := q.ExecContext(ctx, `UPDATE Lenders SET Suspended_At = NULL, Suspended_By = NULL, Suspension_Reason = NULL
+			WHERE Lender_ID = ? AND Suspended_At IS NOT NULL`, lenderID)
+		if err != nil {
+			return err
+		}
+		if err := requireSuspensionChange(ctx, q, res, lenderID, ErrLenderNotSuspended); err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, "UPDATE Accounts SET Is_Locked = 0, Suspension_Locked = 0 WHERE Lender_ID = ? AND Suspension_Locked = 1", lenderID)
+		return err
+	})
+}
+
+// SetWebhookURL sets the URL that receives the lender's outbox events. An empty url clears it.
+func (r *lenderRepository) SetWebhookURL(lenderID int, url string) error {
+	res, err := r.db.Exec("UPDATE Lenders SET Webhook_URL = ?, Updated_At = ? WHERE Lender_ID = ?",
+		sql.NullString{String: url, Valid: url != ""}, time.Now().UTC(), lenderID)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrLenderNotFound
+	}
+	return nil
+}
+
+// GetCurrency returns the ISO 4217 code of the lender's loan and receipt amounts.
+func (r *lenderRepository) GetCurrency(lenderID int) (string, error) {
+	var code string
+	if err := r.db.QueryRow("SELECT Currency FROM Lenders WHERE Lender_ID = ?", lenderID).Scan(&code); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLenderNotFound
+		}
+		return "", err
+	}
+	return code, nil
+}
+
+// GetTimezone returns the name of the IANA time zone the lender's report dates are interpreted in.
+func (r *lenderRepository) GetTimezone(lenderID int) (string, error) {
+	var name string
+	if err := r.db.QueryRow("SELECT Timezone FROM Lenders WHERE Lender_ID = ?", lenderID).Scan(&name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLenderNotFound
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// ListTimezones returns the IANA time zone of every lender, keyed by Lender_ID.
+func (r *lenderRepository) ListTimezones() (map[int]string, error) {
+	rows, err := r.db.Query("SELECT Lender_ID, Timezone FROM Lenders")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := make(map[int]string)
+	for rows.Next() {
+		var lenderID int
+		var name string
+		if err := rows.Scan(&lenderID, &name); err != nil {
+			return nil, err
+		}
+		zones[lenderID] = name
+	}
+	return zones, rows.Err()
+}
+
+// UpdateLender applies a partial profile update and returns the fields it changed. The changes
+// are recorded in the audit log in the same transaction; fields set to their current value are
+// neither written nor recorded, and an update changing nothing writes no audit entry.
+func (r *lenderRepository) UpdateLender(ctx context.Context, lenderID int, update models.LenderProfileUpdate, actor string) (map[string]models.FieldChange, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var current models.Lender
+	err = tx.QueryRowContext(ctx, "SELECT Business_Name, Phone_Number, Email, Interest_Rate_Percent, Timezone FROM Lenders WHERE Lender_ID = ?", lenderID).
+		Scan(&current.BusinessName, &current.PhoneNumber, &current.Email, &current.InterestRatePercent, &current.Timezone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLenderNotFound
+		}
+		return nil, err
+	}
+
+	changes := make(map[string]models.FieldChange)
+	next := current
+	if v := update.BusinessName; v != nil && *v != current.BusinessName {
+		changes["business_name"] = models.FieldChange{From: current.BusinessName, To: *v}
+		next.BusinessName = *v
+	}
+	if v := update.PhoneNumber; v != nil && *v != current.PhoneNumber {
+		changes["phone_number"] = models.FieldChange{From: current.PhoneNumber, To: *v}
+		next.PhoneNumber = *v
+	}
+	if v := update.Email; v != nil && *v != current.Email {
+		changes["email"] = models.FieldChange{From: current.Email, To: *v}
+		next.Email = *v
+	}
+	if v := update.InterestRatePercent; v != nil && *v != current.InterestRatePercent {
+		changes["interest_rate_percent"] = models.FieldChange{From: current.InterestRatePercent, To: *v}
+		next.InterestRatePercent = *v
+	}
+	if v := update.Timezone; v != nil && *v != current.Timezone {
+		changes["timezone"] = models.FieldChange{From: current.Timezone, To: *v}
+		next.Timezone = *v
+	}
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "UPDATE Lenders SET Business_Name = ?, Phone_Number = ?, Email = ?, Interest_Rate_Percent = ?, Timezone = ?, Updated_At = ? WHERE Lender_ID = ?",
+		next.BusinessName, next.PhoneNumber, next.Email, next.InterestRatePercent, next.Timezone, now, lenderID)
+	if err != nil {
+		if columns, ok := uniqueViolation(err); ok && columns == "Lenders.Email" {
+			return nil, ErrDuplicateEmail
+		}
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, lenderID, actor, models.AuditLenderUpdated, "lender", lenderID, changes, now); err != nil {
+		return nil, err
+	}
+	return changes, tx.Commit()
+}
+
+// ListLenderChanges returns one page of the lender's audited profile updates, newest first, and their total.
+func (r *lenderRepository) ListLenderChanges(lenderID, limit, offset int) ([]models.LenderChange, int, error) {
+	var exists bool
+	var total int
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM Lenders WHERE Lender_ID = ?1),
+		(SELECT COUNT(*) FROM Audit_Log WHERE Lender_ID = ?1 AND Action = ?2)`, lenderID, models.AuditLenderUpdated).Scan(&exists, &total)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !exists {
+		return nil, 0, ErrLenderNotFound
+	}
+
+	rows, err := r.db.Query(`SELECT Audit_ID, Actor, Details, Created_At FROM Audit_Log
+		WHERE Lender_ID = ? AND Action = ? ORDER BY Created_At DESC, Audit_ID DESC LIMIT ? OFFSET ?`,
+		lenderID, models.AuditLenderUpdated, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	changes := []models.LenderChange{}
+	for rows.Next() {
+		var c models.LenderChange
+		var details sql.NullString
+		if err := rows.Scan(&c.AuditID, &c.Actor, &details, &c.ChangedAt); err != nil {
+			return nil, 0, err
+		}
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &c.Changes); err != nil {
+				return nil, 0, err
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, total, rows.Err()
+}
+
+// requireSuspensionChange returns stateErr if a suspension update matched no row of an existing
+// lender, or ErrLenderNotFound if the lender does not exist.
+func requireSuspensionChange(ctx context.Context, q DBTX, res sql.Result, lenderID int, stateErr error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	var exists int
+	err = q.QueryRowContext(ctx, "SELECT 1 FROM Lenders WHERE Lender_ID = ?", lenderID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrLenderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return stateErr
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanLenderOverview scans the lenderOverviewColumns, followed by any extra destinations, and
+// computes DaysUntilExpiry relative to now.
+func scanLenderOverview(row rowScanner, lender *models.LenderOverview, now time.Time, extra ...any) error {
+	dest := []any{
+		&lender.LenderID,
+		&lender.BusinessName,
+		&lender.Email,
+		&lender.IsActive,
+		&lender.SuspendedAt,
+		&lender.CreatedAt,
+		&lender.AccountCount,
+		&lender.ActiveLoanCount,
+		&lender.PlanID,
+		&lender.PlanName,
+		&lender.SubscriptionStatus,
+		&lender.SubscriptionEnd,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if lender.SubscriptionEnd.Valid {
+		days := int64(math.Ceil(lender.SubscriptionEnd.Time.Sub(now).Hours() / 24))
+		lender.DaysUntilExpiry = sql.NullInt64{Int64: days, Valid: true}
+	}
+	return nil
+}
+
+// parseSQLiteTime parses the text forms the sqlite3 driver writes for time.Time values.
+func parseSQLiteTime(value string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// GetBranding returns how the lender's generated documents present it.
+func (r *lenderRepository) GetBranding(lenderID int) (*models.LenderBranding, error) {
+	var b models.LenderBranding
+	err := r.db.QueryRow("SELECT Branding_Logo_File_ID, Brand_Color, Document_Footer, Show_Contact_Details FROM Lenders WHERE Lender_ID = ?", lenderID).
+		Scan(&b.LogoFileID, &b.PrimaryColor, &b.FooterText, &b.ShowContactDetails)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLenderNotFound
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// UpdateBranding replaces the lender's document branding and returns the fields it changed, audited
+// like UpdateLender. A logo must be one of the lender's PNG or JPEG files, else ErrFileNotFound
+// or ErrLogoNotImage.
+func (r *lenderRepository) UpdateBranding(ctx context.Context, lenderID int, branding models.LenderBranding, actor string) (map[string]models.FieldChange, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var current models.LenderBranding
+	err = tx.QueryRowContext(ctx, "SELECT Branding_Logo_File_ID, Brand_Color, Document_Footer, Show_Contact_Details FROM Lenders WHERE Lender_ID = ?", lenderID).
+		Scan(&current.LogoFileID, &current.PrimaryColor, &current.FooterText, &current.ShowContactDetails)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLenderNotFound
+		}
+		return nil, err
+	}
+
+	if branding.LogoFileID.Valid {
+		var fileType sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT File_Type FROM File WHERE File_ID = ? AND Lender_ID = ?", branding.LogoFileID.Int64, lenderID).Scan(&fileType)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrFileNotFound
+			}
+			return nil, err
+		}
+		if fileType.String != "image/png" && fileType.String != "image/jpeg" {
+			return nil, ErrLogoNotImage
+		}
+	}
+
+	// A cleared logo is recorded as null rather than the zero ID
+	logoID := func(id sql.NullInt64) any {
+		if !id.Valid {
+			return nil
+		}
+		return id.Int64
+	}
+	changes := make(map[string]models.FieldChange)
+	if current.LogoFileID != branding.LogoFileID {
+		changes["logo_file_id"] = models.FieldChange{From: logoID(current.LogoFileID), To: logoID(branding.LogoFileID)}
+	}
+	if current.PrimaryColor != branding.PrimaryColor {
+		changes["primary_color"] = models.FieldChange{From: current.PrimaryColor, To: branding.PrimaryColor}
+	}
+	if current.FooterText != branding.FooterText {
+		changes["footer_text"] = models.FieldChange{From: current.FooterText, To: branding.FooterText}
+	}
+	if current.ShowContactDetails != branding.ShowContactDetails {
+		changes["show_contact_details"] = models.FieldChange{From: current.ShowContactDetails, To: branding.ShowContactDetails}
+	}
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `UPDATE Lenders SET Branding_Logo_File_ID = ?, Brand_Color = ?, Document_Footer = ?, Show_Contact_Details = ?, Updated_At = ?
+		WHERE Lender_ID = ?`,
+		branding.LogoFileID, branding.PrimaryColor, branding.FooterText, branding.ShowContactDetails, now, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordAudit(ctx, tx, lenderID, actor, models.AuditLenderBrandingUpdated, "lender", lenderID, changes, now); err != nil {
+		return nil, err
+	}
+	return changes, tx.Commit()
+}
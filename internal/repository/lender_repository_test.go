@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// seedLenderOverviews puts the "active", "expired" and "suspended" lenders into those subscription states.
+func seedLenderOverviews(t *testing.T, ledgers LedgerRepository, lenders map[string]int, basicID, premiumID int) {
+	now := time.Now().UTC()
+	if _, err := ledgers.CreateSubscription(context.Background(), lenders["active"], basicID, "LSL", now.AddDate(0, 0, -5), now.AddDate(0, 0, 10)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	expired, err := ledgers.CreateSubscription(context.Background(), lenders["expired"], premiumID, "LSL", now.AddDate(0, -1, 0), now.AddDate(0, 0, -3))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	ledgers.TransitionStatus(context.Background(), expired.LedgerID, "active", "expired", "system", "")
+	suspended, err := ledgers.CreateSubscription(context.Background(), lenders["suspended"], premiumID, "LSL", now, now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	ledgers.TransitionStatus(context.Background(), suspended.LedgerID, "active", "suspended", "admin", "")
+}
+
+func TestListLenderOverviews(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	ledgers := NewLedgerRepository(db)
+	basicID := seedPlan(t, db, "Basic", 100)
+	premiumID := seedPlan(t, db, "Premium", 300)
+	lenders := map[string]int{}
+	for _, name := range []string{"active", "expired", "suspended", "none"} {
+		lenders[name] = seedLender(t, db, name+"lender")
+	}
+	seedLenderOverviews(t, ledgers, lenders, basicID, premiumID)
+
+	borrowerID := seedBorrower(t, db, "overview@example.com")
+	seedLoan(t, db, lenders["active"], borrowerID, "active", 1000, 10, 6)
+	seedLoan(t, db, lenders["active"], borrowerID, "active", 2000, 10, 6)
+	seedLoan(t, db, lenders["active"], borrowerID, "paid", 500, 10, 6)
+
+	// Test case 1: All lenders with joined counts and subscription data
+	all, total, err := repo.ListLenderOverviews(LenderFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListLenderOverviews failed: %v", err)
+	}
+	if total != 4 || len(all) != 4 {
+		t.Fatalf("Expected 4 lenders, got %d (total %d)", len(all), total)
+	}
+	byID := map[int]int{}
+	for i, lender := range all {
+		byID[lender.LenderID] = i
+	}
+	active := all[byID[lenders["active"]]]
+	if active.AccountCount != 1 || active.ActiveLoanCount != 2 || active.PlanName.String != "Basic" || active.SubscriptionStatus.String != "active" {
+		t.Errorf("Unexpected active lender overview: %+v", active)
+	}
+	if active.DaysUntilExpiry.Int64 != 10 {
+		t.Errorf("Expected 10 days until expiry, got %d", active.DaysUntilExpiry.Int64)
+	}
+	none := all[byID[lenders["none"]]]
+	if none.SubscriptionStatus.Valid || none.PlanName.Valid || none.DaysUntilExpiry.Valid {
+		t.Errorf("Expected no subscription data, got %+v", none)
+	}
+
+	// Test case 2: Status filters
+	for status, want := range map[string]int{"expired": lenders["expired"], "suspended": lenders["suspended"], "none": lenders["none"]} {
+		got, total, err := repo.ListLenderOverviews(LenderFilter{Status: status, Limit: 10})
+		if err != nil {
+			t.Fatalf("ListLenderOverviews(%s) failed: %v", status, err)
+		}
+		if total != 1 || len(got) != 1 || got[0].LenderID != want {
+			t.Errorf("Expected only lender %d for status %s, got %+v", want, status, got)
+		}
+	}
+
+	// Test case 3: Plan filter
+	_, total, _ = repo.ListLenderOverviews(LenderFilter{PlanID: premiumID, Limit: 10})
+	if total != 2 {
+		t.Errorf("Expected 2 lenders on Premium, got %d", total)
+	}
+
+	// Test case 4: Pagination keeps the full total
+	page, total, _ := repo.ListLenderOverviews(LenderFilter{Limit: 3, Offset: 3})
+	if total != 4 || len(page) != 1 {
+		t.Errorf("Expected 1 lender on the second page of 4, got %d (total %d)", len(page), total)
+	}
+}
+
+func TestGetLenderDetail(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	lenderID := seedLender(t, db, "detailed")
+	borrowerA := seedBorrower(t, db, "a@example.com")
+	borrowerB := seedBorrower(t, db, "b@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerA, "active", 1000, 10, 6)
+	seedLoan(t, db, lenderID, borrowerA, "pending", 1000, 10, 6)
+	seedLoan(t, db, lenderID, borrowerB, "defaulted", 1000, 10, 6)
+
+	receipts := NewReceiptRepository(db)
+	receipts.CreateReceipt(lenderID, newTestReceipt(loanID, "R-1"))
+	receipts.CreateReceipt(lenderID, newTestReceipt(loanID, "R-2"))
+	db.Exec("UPDATE Accounts SET Last_Login = ? WHERE Lender_ID = ?", time.Now().UTC(), lenderID)
+
+	detail, err := repo.GetLenderDetail(lenderID)
+	if err != nil {
+		t.Fatalf("GetLenderDetail failed: %v", err)
+	}
+	if detail.BorrowerCount != 2 || detail.LoansLast30Days != 3 || detail.ReceiptsLast30Days != 2 || detail.ReceivedLast30Days != 500 {
+		t.Errorf("Unexpected activity counts: %+v", detail)
+	}
+	if detail.LoansByStatus["active"] != 1 || detail.LoansByStatus["pending"] != 1 || detail.LoansByStatus["defaulted"] != 1 {
+		t.Errorf("Unexpected loans by status: %v", detail.LoansByStatus)
+	}
+	if !detail.LastLogin.Valid {
+		t.Error("Expected last login to be set")
+	}
+
+	_, err = repo.GetLenderDetail(99999)
+	if !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	lenderID := seedLender(t, db, "usage")
+	otherID := seedLender(t, db, "otherusage")
+	borrowerA := seedBorrower(t, db, "a@example.com")
+	borrowerB := seedBorrower(t, db, "b@example.com")
+	seedLoan(t, db, lenderID, borrowerA, "active", 1000, 10, 6)
+	seedLoan(t, db, lenderID, borrowerA, "active", 1000, 10, 6)
+	seedLoan(t, db, lenderID, borrowerB, "paid", 1000, 10, 6)
+	seedLoan(t, db, otherID, borrowerB, "active", 1000, 10, 6)
+
+	usage, err := repo.GetUsage(lenderID)
+	if err != nil {
+		t.Fatalf("GetUsage failed: %v", err)
+	}
+	if usage.Users != 1 || usage.ActiveLoans != 2 || usage.Borrowers != 2 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+}
+
+func TestReplaceLogo(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	auth := NewAuthRepository(db)
+	lenderID := seedLender(t, db, "logolender")
+
+	// Test case 1: First logo has no predecessor
+	previous, err := repo.ReplaceLogo(lenderID, &models.File{Value: "lenders/1/a.png"}, nil)
+	if err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	if len(previous) != 0 {
+		t.Errorf("Expected no previous logo, got %+v", previous)
+	}
+
+	// Test case 2: Second logo returns the first and takes its place on the profile
+	second := &models.File{Value: "lenders/1/b.png"}
+	previous, err = repo.ReplaceLogo(lenderID, second, nil)
+	if err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	if len(previous) != 1 || previous[0].Value != "lenders/1/a.png" {
+		t.Errorf("Expected the first logo back, got %+v", previous)
+	}
+	account, _ := auth.GetAccountByEmail("logolender@example.com")
+	lender, err := auth.GetLenderByAccountID(account.AccountID)
+	if err != nil {
+		t.Fatalf("GetLenderByAccountID failed: %v", err)
+	}
+	if lender.LogoFileID.Int64 != int64(second.FileID) {
+		t.Errorf("Expected profile logo %d, got %+v", second.FileID, lender.LogoFileID)
+	}
+
+	// Test case 3: Unknown lender
+	if _, err := repo.ReplaceLogo(99999, &models.File{Value: "x.png"}, nil); err == nil {
+		t.Error("Expected an error for an unknown lender")
+	}
+}
+
+func TestReplaceLogo_KeepsOriginal(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	files := NewFileRepository(db)
+	lenderID := seedLender(t, db, "variantlender")
+
+	// Test case 1: No logo yet
+	if _, err := repo.GetLogo(lenderID, false); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Test case 2: A downscaled logo is linked to its original, which it references
+	original := &models.File{Value: "lenders/1/big.jpg"}
+	logo := &models.File{Value: "lenders/1/small.jpg"}
+	if _, err := repo.ReplaceLogo(lenderID, logo, original); err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	if logo.OriginalFileID.Int64 != int64(original.FileID) || original.Purpose.String != models.FilePurposeLogoOriginal {
+		t.Errorf("Expected the logo to link to its original, got %+v and %+v", logo, original)
+	}
+	refs, err := files.ListFileReferences(lenderID, original.FileID)
+	if err != nil {
+		t.Fatalf("ListFileReferences failed: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Type != models.FileReferenceFileVariant || refs[0].ID != logo.FileID {
+		t.Errorf("Expected the variant to reference the original, got %+v", refs)
+	}
+
+	// Test case 3: GetLogo serves the variant by default and the source on request
+	if got, err := repo.GetLogo(lenderID, false); err != nil || got.FileID != logo.FileID {
+		t.Errorf("Expected the resized logo, got %+v (%v)", got, err)
+	}
+	if got, err := repo.GetLogo(lenderID, true); err != nil || got.FileID != original.FileID {
+		t.Errorf("Expected the original logo, got %+v (%v)", got, err)
+	}
+
+	// Test case 4: A logo stored as uploaded replaces both rows and is its own original
+	plain := &models.File{Value: "lenders/1/plain.png"}
+	previous, err := repo.ReplaceLogo(lenderID, plain, nil)
+	if err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	if len(previous) != 2 {
+		t.Errorf("Expected the logo and its original back, got %+v", previous)
+	}
+	if got, err := repo.GetLogo(lenderID, true); err != nil || got.FileID != plain.FileID {
+		t.Errorf("Expected the plain logo, got %+v (%v)", got, err)
+	}
+}
+
+func TestSuspendAndUnsuspendLender(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	auth := NewAuthRepository(db)
+	lenderID := seedLender(t, db, "suspendlender")
+	account, _ := auth.GetAccountByEmail("suspendlender@example.com")
+	at := time.Now()
+
+	// Test case 1: Suspension records the actor and reason, locks accounts and revokes tokens
+	if err := repo.SuspendLender(context.Background(), lenderID, "admin", "fraud review", at); err != nil {
+		t.Fatalf("SuspendLender failed: %v", err)
+	}
+	lender, _ := auth.GetLenderByAccountID(account.AccountID)
+	if !lender.SuspendedAt.Valid || lender.SuspendedBy.String != "admin" || lender.SuspensionReason.String != "fraud review" {
+		t.Errorf("Unexpected suspension fields: %+v", lender)
+	}
+	status, err := auth.GetAccountStatus(account.AccountID)
+	if err != nil {
+		t.Fatalf("GetAccountStatus failed: %v", err)
+	}
+	if !status.IsLocked || !status.LenderSuspended || !status.TokensRevokedAt.Valid {
+		t.Errorf("Expected a locked account of a suspended lender with revoked tokens, got %+v", status)
+	}
+
+	// Test case 2: Already suspended
+	if err := repo.SuspendLender(context.Background(), lenderID, "admin", "again", at); !errors.Is(err, ErrLenderAlreadySuspended) {
+		t.Errorf("Expected ErrLenderAlreadySuspended, got %v", err)
+	}
+
+	// Test case 3: Unsuspension unlocks accounts but keeps tokens revoked
+	if err := repo.UnsuspendLender(context.Background(), lenderID); err != nil {
+		t.Fatalf("UnsuspendLender failed: %v", err)
+	}
+	status, _ = auth.GetAccountStatus(account.AccountID)
+	if status.IsLocked || status.LenderSuspended || !status.TokensRevokedAt.Valid {
+		t.Errorf("Expected an unlocked account with revoked tokens, got %+v", status)
+	}
+
+	// Test case 4: Not suspended and unknown lenders
+	if err := repo.UnsuspendLender(context.Background(), lenderID); !errors.Is(err, ErrLenderNotSuspended) {
+		t.Errorf("Expected ErrLenderNotSuspended, got %v", err)
+	}
+	if err := repo.SuspendLender(context.Background(), 99999, "admin", "x", at); !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+}
+
+func TestUnsuspendLender_KeepsHardLocks(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	auth := NewAuthRepository(db)
+	lenderID := seedLender(t, db, "hardlocked")
+	account, _ := auth.GetAccountByEmail("hardlocked@example.com")
+	if _, err := db.Exec("UPDATE Accounts SET Is_Locked = 1 WHERE Account_ID = ?", account.AccountID); err != nil {
+		t.Fatalf("Failed to hard-lock the account: %v", err)
+	}
+
+	// Test case 1: An account an admin locked before the suspension stays locked after it
+	if err := repo.SuspendLender(context.Background(), lenderID, "admin", "review", time.Now()); err != nil {
+		t.Fatalf("SuspendLender failed: %v", err)
+	}
+	if err := repo.UnsuspendLender(context.Background(), lenderID); err != nil {
+		t.Fatalf("UnsuspendLender failed: %v", err)
+	}
+	status, _ := auth.GetAccountStatus(account.AccountID)
+	if !status.IsLocked || status.LenderSuspended {
+		t.Errorf("Expected the hard lock to survive the suspension, got %+v", status)
+	}
+}
+
+func TestUpdateLender_RecordsOnlyChangedFields(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	ctx := context.Background()
+	lenderID := seedLender(t, db, "profiled")
+	seedLender(t, db, "taken")
+
+	// Test case 1: Only the field that differs is changed and recorded, even when others are resent
+	name, email := "Profiled Lending", "profiled@example.com"
+	changes, err := repo.UpdateLender(ctx, lenderID, models.LenderProfileUpdate{BusinessName: &name, Email: &email}, "account:1")
+	if err != nil {
+		t.Fatalf("UpdateLender failed: %v", err)
+	}
+	if len(changes) != 1 || changes["business_name"] != (models.FieldChange{From: "profiled Business", To: "Profiled Lending"}) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+
+	history, total, err := repo.ListLenderChanges(lenderID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListLenderChanges failed: %v", err)
+	}
+	if total != 1 || len(history) != 1 || history[0].Actor != "account:1" || len(history[0].Changes) != 1 ||
+		history[0].Changes["business_name"].To != "Profiled Lending" {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	// Test case 2: An update that changes nothing records nothing
+	if changes, err := repo.UpdateLender(ctx, lenderID, models.LenderProfileUpdate{BusinessName: &name}, "account:1"); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v (%v)", changes, err)
+	}
+	if _, total, _ := repo.ListLenderChanges(lenderID, 10, 0); total != 1 {
+		t.Errorf("Expected 1 history entry, got %d", total)
+	}
+
+	// Test case 3: Another lender's email is refused and nothing is recorded
+	taken := "taken@example.com"
+	if _, err := repo.UpdateLender(ctx, lenderID, models.LenderProfileUpdate{Email: &taken}, "account:1"); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+	if _, total, _ := repo.ListLenderChanges(lenderID, 10, 0); total != 1 {
+		t.Errorf("Expected the failed update not to be recorded, got %d entries", total)
+	}
+
+	// Test case 4: Unknown lenders
+	if _, err := repo.UpdateLender(ctx, 9999, models.LenderProfileUpdate{BusinessName: &name}, "account:1"); !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+	if _, _, err := repo.ListLenderChanges(9999, 10, 0); !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+}
+
+func TestUpdateBranding(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	files := NewFileRepository(db)
+	ctx := context.Background()
+	lenderID := seedLender(t, db, "brander")
+	otherID := seedLender(t, db, "otherbrander")
+
+	// Test case 1: New lenders show their contact details and nothing else
+	branding, err := repo.GetBranding(lenderID)
+	if err != nil {
+		t.Fatalf("GetBranding failed: %v", err)
+	}
+	if *branding != (models.LenderBranding{ShowContactDetails: true}) {
+		t.Errorf("Unexpected default branding: %+v", branding)
+	}
+
+	image := &models.File{LenderID: lenderID, Value: "lenders/1/brand.png", FileType: sql.NullString{String: "image/png", Valid: true}}
+	contract := &models.File{LenderID: lenderID, Value: "lenders/1/contract.pdf", FileType: sql.NullString{String: "application/pdf", Valid: true}}
+	foreign := &models.File{LenderID: otherID, Value: "lenders/2/brand.png", FileType: sql.NullString{String: "image/png", Valid: true}}
+	for _, f := range []*models.File{image, contract, foreign} {
+		if err := files.CreateFile(f); err != nil {
+			t.Fatalf("CreateFile failed: %v", err)
+		}
+	}
+
+	// Test case 2: Changed fields are stored and audited with their previous values
+	update := models.LenderBranding{
+		LogoFileID:   sql.NullInt64{Int64: int64(image.FileID), Valid: true},
+		PrimaryColor: "#FF6600",
+		FooterText:   "Registered credit provider",
+	}
+	changes, err := repo.UpdateBranding(ctx, lenderID, update, "account:1")
+	if err != nil {
+		t.Fatalf("UpdateBranding failed: %v", err)
+	}
+	if len(changes) != 4 || changes["primary_color"] != (models.FieldChange{From: "", To: "#FF6600"}) ||
+		changes["show_contact_details"] != (models.FieldChange{From: true, To: false}) ||
+		changes["logo_file_id"] != (models.FieldChange{From: nil, To: int64(image.FileID)}) {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+	if branding, _ := repo.GetBranding(lenderID); *branding != update {
+		t.Errorf("Expected the branding to be stored, got %+v", branding)
+	}
+	var audited int
+	db.QueryRow("SELECT COUNT(*) FROM Audit_Log WHERE Lender_ID = ? AND Action = ?", lenderID, models.AuditLenderBrandingUpdated).Scan(&audited)
+	if audited != 1 {
+		t.Errorf("Expected 1 audit entry, got %d", audited)
+	}
+
+	// Test case 3: Resending the same branding records nothing
+	if changes, err := repo.UpdateBranding(ctx, lenderID, update, "account:1"); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v (%v)", changes, err)
+	}
+
+	// Test case 4: The branding logo is a reference that blocks deleting the file
+	if refs, _ := files.ListFileReferences(lenderID, image.FileID); len(refs) != 1 || refs[0].Type != models.FileReferenceLenderBrandingLogo {
+		t.Errorf("Expected the branding logo reference, got %+v", refs)
+	}
+
+	// Test case 5: Logos must be the lender's own images
+	update.LogoFileID = sql.NullInt64{Int64: int64(contract.FileID), Valid: true}
+	if _, err := repo.UpdateBranding(ctx, lenderID, update, "account:1"); !errors.Is(err, ErrLogoNotImage) {
+		t.Errorf("Expected ErrLogoNotImage, got %v", err)
+	}
+	update.LogoFileID = sql.NullInt64{Int64: int64(foreign.FileID), Valid: true}
+	if _, err := repo.UpdateBranding(ctx, lenderID, update, "account:1"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Test case 6: Unknown lenders
+	if _, err := repo.GetBranding(9999); !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+	if _, err := repo.UpdateBranding(ctx, 9999, models.LenderBranding{}, "account:1"); !errors.Is(err, ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+}
+
+func TestReplaceLogo_ClearsBrandingLogo(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLenderRepository(db)
+	lenderID := seedLender(t, db, "rebrander")
+	logo := &models.File{Value: "lenders/1/a.png", FileType: sql.NullString{String: "image/png", Valid: true}}
+	if _, err := repo.ReplaceLogo(lenderID, logo, nil); err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	branding := models.LenderBranding{LogoFileID: sql.NullInt64{Int64: int64(logo.FileID), Valid: true}, ShowContactDetails: true}
+	if _, err := repo.UpdateBranding(context.Background(), lenderID, branding, "account:1"); err != nil {
+		t.Fatalf("UpdateBranding failed: %v", err)
+	}
+
+	// Replacing the profile logo deletes the file, so documents fall back to the new logo
+	if _, err := repo.ReplaceLogo(lenderID, &models.File{Value: "lenders/1/b.png"}, nil); err != nil {
+		t.Fatalf("ReplaceLogo failed: %v", err)
+	}
+	if got, _ := repo.GetBranding(lenderID); got.LogoFileID.Valid {
+		t.Errorf("Expected the branding logo to be cleared, got %+v", got.LogoFileID)
+	}
+}
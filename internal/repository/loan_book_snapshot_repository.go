@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrSnapshotExists   = errors.New("a loan book snapshot already exists for the month")
+	ErrSnapshotNotFound = errors.New("loan book snapshot not found")
+)
+
+// LoanBookSnapshotRepository defines the interface for lenders' month-end loan book snapshots.
+// Snapshots are written once and never updated.
+type LoanBookSnapshotRepository interface {
+	Create(snapshot *models.LoanBookSnapshot) error
+	Exists(lenderID int, month string) (bool, error)
+	Get(lenderID int, month string) (*models.LoanBookSnapshot, error)
+}
+
+// loanBookSnapshotRepository implements LoanBookSnapshotRepository using a SQLite database connection.
+type loanBookSnapshotRepository struct {
+	db *sql.DB
+}
+
+// NewLoanBookSnapshotRepository creates a new LoanBookSnapshotRepository instance.
+func NewLoanBookSnapshotRepository(db *sql.DB) LoanBookSnapshotRepository {
+	return &loanBookSnapshotRepository{db: db}
+}
+
+// Create stores a lender's snapshot for a month, totals and loans together. It returns
+// ErrSnapshotExists, and stores nothing, when the lender already has one for the month.
+func (r *loanBookSnapshotRepository) Create(snapshot *models.LoanBookSnapshot) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	result, err := tx.Exec(`INSERT INTO Loan_Book_Snapshot_Totals (Lender_ID, Month, As_Of, Loans, Outstanding_Principal,
+			Outstanding_Interest, Outstanding_Penalties, Portfolio) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (Lender_ID, Month) DO NOTHING`,
+		snapshot.LenderID, snapshot.Month, snapshot.AsOf, len(snapshot.Loans), snapshot.OutstandingPrincipal,
+		snapshot.OutstandingInterest, snapshot.OutstandingPenalties, snapshot.Portfolio)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSnapshotExists
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO Loan_Book_Snapshots (Lender_ID, Month, Loan_ID, Payment_Status, Outstanding_Principal,
+		Outstanding_Interest, Outstanding_Penalties) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, loan := range snapshot.Loans {
+		if _, err := stmt.Exec(snapshot.LenderID, snapshot.Month, loan.LoanID, loan.Status, loan.OutstandingPrincipal,
+			loan.OutstandingInterest, loan.OutstandingPenalties); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Exists reports whether the lender has a snapshot for the YYYY-MM month.
+func (r *loanBookSnapshotRepository) Exists(lenderID int, month string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM Loan_Book_Snapshot_Totals WHERE Lender_ID = ? AND Month = ?)",
+		lenderID, month).Scan(&exists)
+	return exists, err
+}
+
+// Get returns the lender's snapshot for the YYYY-MM month with its loans, by Loan_ID.
+func (r *loanBookSnapshotRepository) Get(lenderID int, month string) (*models.LoanBookSnapshot, error) {
+	snapshot := models.LoanBookSnapshot{LenderID: lenderID, Month: month, Loans: []models.LoanSnapshot{}}
+	err := r.db.QueryRow(`SELECT As_Of, Outstanding_Principal, Outstanding_Interest, Outstanding_Penalties, Portfolio, Created_At
+		FROM Loan_Book_Snapshot_Totals WHERE Lender_ID = ? AND Month = ?`, lenderID, month).Scan(
+		&snapshot.AsOf, &snapshot.OutstandingPrincipal, &snapshot.OutstandingInterest, &snapshot.OutstandingPenalties,
+		&snapshot.Portfolio, &snapshot.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`SELECT Loan_ID, Payment_Status, Outstanding_Principal, Outstanding_Interest, Outstanding_Penalties
+		FROM Loan_Book_Snapshots WHERE Lender_ID = ? AND Month = ? ORDER BY Loan_ID`, lenderID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var loan models.LoanSnapshot
+		if err := rows.Scan(&loan.LoanID, &loan.Status, &loan.OutstandingPrincipal, &loan.OutstandingInterest, &loan.OutstandingPenalties); err != nil {
+			return nil, err
+		}
+		snapshot.Loans = append(snapshot.Loans, loan)
+	}
+	return &snapshot, rows.Err()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestLoanBookSnapshots(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanBookSnapshotRepository(db)
+	lenderID := seedLender(t, db, "snapshots")
+	snapshot := &models.LoanBookSnapshot{
+		LenderID:             lenderID,
+		Month:                "2026-09",
+		AsOf:                 "2026-09-30",
+		Loans:                []models.LoanSnapshot{{LoanID: 2, Status: "paid"}, {LoanID: 1, Status: "active", OutstandingPrincipal: 700, OutstandingInterest: 200}},
+		OutstandingPrincipal: 700,
+		OutstandingInterest:  200,
+		Portfolio:            `{"as_of":"2026-09-30"}`,
+	}
+
+	// Test case 1: A month without a snapshot is not found
+	if exists, err := repo.Exists(lenderID, "2026-09"); err != nil || exists {
+		t.Fatalf("Expected no snapshot, got %v, %v", exists, err)
+	}
+	if _, err := repo.Get(lenderID, "2026-09"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+
+	// Test case 2: The snapshot is stored with its loans, by loan
+	if err := repo.Create(snapshot); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	stored, err := repo.Get(lenderID, "2026-09")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.AsOf != "2026-09-30" || stored.Portfolio != snapshot.Portfolio || len(stored.Loans) != 2 ||
+		stored.Loans[0].LoanID != 1 || stored.Loans[0].OutstandingPrincipal != 700 {
+		t.Errorf("Unexpected snapshot: %+v", stored)
+	}
+
+	// Test case 3: A second snapshot of the month is refused and leaves the first as it was
+	snapshot.OutstandingPrincipal = 0
+	snapshot.Loans = append(snapshot.Loans, models.LoanSnapshot{LoanID: 3, Status: "active"})
+	if err := repo.Create(snapshot); !errors.Is(err, ErrSnapshotExists) {
+		t.Errorf("Expected ErrSnapshotExists, got %v", err)
+	}
+	if stored, _ := repo.Get(lenderID, "2026-09"); stored.OutstandingPrincipal != 700 || len(stored.Loans) != 2 {
+		t.Errorf("Expected the first snapshot unchanged, got %+v", stored)
+	}
+	if exists, _ := repo.Exists(lenderID, "2026-09"); !exists {
+		t.Error("Expected the snapshot to exist")
+	}
+}
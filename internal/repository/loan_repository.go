@@ -0,0 +1,619 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrLoanNotFound   = errors.New("loan not found")
+	ErrLoanNotPayable = errors.New("only pending and active loans can be marked paid")
+	ErrLoanPaid       = errors.New("paid loans cannot be changed")
+	ErrLoanNotPending = errors.New("only pending loans can be reassigned")
+
+	ErrBorrowerLoanLimit = errors.New("borrower already holds the maximum number of active loans")
+
+	ErrInvalidAmount       = errors.New("loan amount must be positive")
+	ErrInvalidInterestRate = errors.New("loan interest rate must be zero or greater")
+	ErrInvalidTerm         = errors.New("loan term must be at least one month")
+)
+
+// LoanFilter narrows and pages a lender's loan listing; zero values leave a filter unset.
+type LoanFilter struct {
+	Status     string
+	BorrowerID int
+	MinAmount  float64  // Principal at least
+	MaxAmount  *float64 // Principal at most; nil leaves the range open-ended
+	Limit      int
+	Offset     int
+}
+
+// LoanRepository defines the interface for loan-related database operations.
+type LoanRepository interface {
+	CreateLoan(loan *models.Loan, maxActivePerBorrower int) error
+	ListLoans(lenderID int, filter LoanFilter) ([]models.Loan, int, error)
+	GetStatement(lenderID, loanID int) (*models.LoanStatement, error)
+	ListBorrowerStatements(lenderID, borrowerID int) ([]models.LoanStatement, error)
+	BulkReprice(lenderID int, newRate float64, statuses []string) (int, error)
+	MarkPaid(lenderID, loanID int) error
+	ReassignLoan(ctx context.Context, lenderID, loanID, newBorrowerID int, actor string) error
+	MarkDefaulted(lenderID int, loanIDs []int, asOf time.Time) (*models.LoanDefaultResult, error)
+	RecomputeLoan(lenderID, loanID int) (*models.LoanRecomputation, error)
+	ListDueSoon(lenderID int, from, until time.Time) ([]models.DueLoan, error)
+	GetVintages(lenderID int) ([]models.Vintage, error)
+}
+
+// loanPaidPayload is the body of an EventLoanPaid webhook
+type loanPaidPayload struct {
+	Event    string    `json:"event"`
+	LoanID   int       `json:"loan_id"`
+	LenderID int       `json:"lender_id"`
+	Amount   float64   `json:"amount"`
+	PaidAt   time.Time `json:"paid_at"`
+}
+
+// loanDefaultedPayload is the body of an EventLoanDefaulted webhook
+type loanDefaultedPayload struct {
+	Event       string    `json:"event"`
+	LoanID      int       `json:"loan_id"`
+	LenderID    int       `json:"lender_id"`
+	AsOf        string    `json:"as_of"`
+	DefaultedAt time.Time `json:"defaulted_at"`
+}
+
+// loanRepository implements LoanRepository using a SQLite database connection.
+type loanRepository struct {
+	db *sql.DB
+}
+
+// NewLoanRepository creates a new LoanRepository instance.
+func NewLoanRepository(db *sql.DB) LoanRepository {
+	return &loanRepository{db: db}
+}
+
+// CreateLoan inserts the loan and sets its ID and timestamps. When maxActivePerBorrower is
+// positive, the loan is refused with ErrBorrowerLoanLimit once the borrower already holds that many
+// active loans with the lender; the count and the insert are one statement, so concurrent
+// originations cannot both pass the limit. A loan breaking the Loans checks is refused before
+// the insert with ErrInvalidAmount, ErrInvalidInterestRate or ErrInvalidTerm.
+func (r *loanRepository) CreateLoan(loan *models.Loan, maxActivePerBorrower int) error {
+	switch {
+	case !(loan.Amount > 0) || math.IsInf(loan.Amount, 1):
+		return ErrInvalidAmount
+	case !(loan.InterestRate >= 0) || math.IsInf(loan.InterestRate, 1):
+		return ErrInvalidInterestRate
+	case loan.MonthsToPay <= 0:
+		return ErrInvalidTerm
+	}
+
+	now := time.Now().UTC()
+	var endDate any
+	if loan.EndDate.Valid {
+		endDate = loan.EndDate.Time.Format(time.DateOnly)
+	}
+
+	res, err := r.db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate,
+			Monthly_Payment, Origination_Fee, Fee_Financed, Start_Date, End_Date, Created_At, Updated_At)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE ? <= 0 OR (SELECT COUNT(*) FROM Loans WHERE Lender_ID = ? AND Borrower_ID = ? AND Payment_Status = 'active') < ?`,
+		loan.BorrowerID, loan.LenderID, loan.MonthsToPay, loan.PaymentStatus, loan.Amount, loan.InterestRate,
+		loan.MonthlyPayment, loan.OriginationFee, loan.FeeFinanced, loan.StartDate.Format(time.DateOnly), endDate, now, now,
+		maxActivePerBorrower, loan.LenderID, loan.BorrowerID, maxActivePerBorrower)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBorrowerLoanLimit
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	loan.LoanID = int(id)
+	loan.CreatedAt, loan.UpdatedAt = models.NewJSONTime(now), models.NewJSONTime(now)
+	loan.TotalCost = loan.Cost()
+	return nil
+}
+
+// ListLoans returns one page of the lender's loans, newest first, and the total matching the filter.
+func (r *loanRepository) ListLoans(lenderID int, filter LoanFilter) ([]models.Loan, int, error) {
+	where := " WHERE Lender_ID = ?"
+	args := []any{lenderID}
+	if filter.Status != "" {
+		where += " AND Payment_Status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.BorrowerID > 0 {
+		where += " AND Borrower_ID = ?"
+		args = append(args, filter.BorrowerID)
+	}
+	if filter.MinAmount > 0 || filter.MaxAmount != nil {
+		max := math.MaxFloat64
+		if filter.MaxAmount != nil {
+			max = *filter.MaxAmount
+		}
+		where += " AND Amount BETWEEN ? AND ?"
+		args = append(args, filter.MinAmount, max)
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM Loans"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`SELECT Loan_ID, Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate,
+			Monthly_Payment, Origination_Fee, Fee_Financed, Start_Date, End_Date, Created_At, Updated_At
+		FROM Loans`+where+" ORDER BY Loan_ID DESC LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	loans := []models.Loan{}
+	for rows.Next() {
+		var l models.Loan
+		if err := rows.Scan(&l.LoanID, &l.BorrowerID, &l.LenderID, &l.MonthsToPay, &l.PaymentStatus, &l.Amount, &l.InterestRate,
+			&l.MonthlyPayment, &l.OriginationFee, &l.FeeFinanced, &l.StartDate, &l.EndDate, &l.CreatedAt, &l.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		fillMonthlyPayment(&l)
+		loans = append(loans, l)
+	}
+	return loans, total, rows.Err()
+}
+
+// GetStatement returns one of the lender's loans with its borrower's name and its receipts, oldest first.
+func (r *loanRepository) GetStatement(lenderID, loanID int) (*models.LoanStatement, error) {
+	var st models.LoanStatement
+	l := &st.Loan
+	err := r.db.QueryRow(`SELECT l.Loan_ID, l.Borrower_ID, l.Lender_ID, l.Months_To_Pay, l.Payment_Status, l.Amount, l.Interest_Rate,
+			l.Monthly_Payment, l.Origination_Fee, l.Fee_Financed, l.Start_Date, l.End_Date, l.Created_At, l.Updated_At, COALESCE(b.Fullnames, '')
+		FROM Loans l LEFT JOIN Borrowers b ON b.Borrower_ID = l.Borrower_ID
+		WHERE l.Loan_ID = ? AND l.Lender_ID = ?`, loanID, lenderID).
+		Scan(&l.LoanID, &l.BorrowerID, &l.LenderID, &l.MonthsToPay, &l.PaymentStatus, &l.Amount, &l.InterestRate,
+			&l.MonthlyPayment, &l.OriginationFee, &l.FeeFinanced, &l.StartDate, &l.EndDate, &l.CreatedAt, &l.UpdatedAt, &st.BorrowerName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+	fillMonthlyPayment(l)
+
+	if err := r.loadReceipts(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// ListBorrowerStatements returns every loan the lender has made to the borrower with its receipts,
+// oldest loan first. It is empty when the lender has never lent to the borrower.
+func (r *loanRepository) ListBorrowerStatements(lenderID, borrowerID int) ([]models.LoanStatement, error) {
+	rows, err := r.db.Query(`SELECT l.Loan_ID, l.Borrower_ID, l.Lender_ID, l.Months_To_Pay, l.Payment_Status, l.Amount, l.Interest_Rate,
+			l.Monthly_Payment, l.Origination_Fee, l.Fee_Financed, l.Start_Date, l.End_Date, l.Created_At, l.Updated_At, COALESCE(b.Fullnames, '')
+		FROM Loans l LEFT JOIN Borrowers b ON b.Borrower_ID = l.Borrower_ID
+		WHERE l.Lender_ID = ? AND l.Borrower_ID = ?
+		ORDER BY l.Start_Date, l.Loan_ID`, lenderID, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+	statements := []models.LoanStatement{}
+	for rows.Next() {
+		var st models.LoanStatement
+		l := &st.Loan
+		if err := rows.Scan(&l.LoanID, &l.BorrowerID, &l.LenderID, &l.MonthsToPay, &l.PaymentStatus, &l.Amount, &l.InterestRate,
+			&l.MonthlyPayment, &l.OriginationFee, &l.FeeFinanced, &l.StartDate, &l.EndDate, &l.CreatedAt, &l.UpdatedAt, &st.BorrowerName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		fillMonthlyPayment(l)
+		statements = append(statements, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range statements {
+		if err := r.loadReceipts(&statements[i]); err != nil {
+			return nil, err
+		}
+	}
+	return statements, nil
+}
+
+// loanPrincipal selects what a loan's instalments amortize, as models.Loan.Principal computes it
+const loanPrincipal = "Amount + CASE WHEN Fee_Financed = 1 THEN Origination_Fee ELSE 0 END"
+
+// fillMonthlyPayment derives the monthly payment of a loan stored without one, so that callers
+// never mistake a missing payment for a payment of zero, and fills in its total cost
+func fillMonthlyPayment(l *models.Loan) {
+	l.MonthlyPayment = sql.NullFloat64{Float64: finance.Instalment(l.MonthlyPayment, l.Principal(), l.InterestRate, l.MonthsToPay), Valid: true}
+	l.TotalCost = l.Cost()
+}
+
+// loadReceipts fills in the statement's receipts, oldest first, and what they paid
+func (r *loanRepository) loadReceipts(st *models.LoanStatement) error {
+	rows, err := r.db.Query("SELECT "+receiptColumns+" FROM Recipets WHERE Loan_ID = ? ORDER BY Timestamp, Recipet_ID", st.Loan.LoanID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	st.Receipts = []models.Receipt{}
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return err
+		}
+		st.Receipts = append(st.Receipts, receipt)
+		if receipt.Status == "paid" {
+			st.TotalPaid += receipt.Amount
+		}
+	}
+	return rows.Err()
+}
+
+// BulkReprice sets a new interest rate on every loan of the lender in one of the given statuses,
+// recomputing each loan's monthly payment within a single transaction. It returns the number of loans updated.
+func (r *loanRepository) BulkReprice(lenderID int, newRate float64, statuses []string) (int, error) {
+	if len(statuses) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	args := []any{lenderID}
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+
+	rows, err := tx.Query("SELECT Loan_ID, "+loanPrincipal+", Months_To_Pay FROM Loans WHERE Lender_ID = ? AND Payment_Status IN ("+placeholders+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type loanTerms struct {
+		id     int
+		amount float64
+		months int
+	}
+	var loans []loanTerms
+	for rows.Next() {
+		var l loanTerms
+		if err := rows.Scan(&l.id, &l.amount, &l.months); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		loans = append(loans, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare("UPDATE Loans SET Interest_Rate = ?, Monthly_Payment = ? WHERE Loan_ID = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, l := range loans {
+		payment := finance.MonthlyPayment(l.amount, newRate, l.months)
+		if _, err := stmt.Exec(newRate, payment, l.id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(loans), tx.Commit()
+}
+
+// MarkPaid moves one of the lender's pending or active loans to paid. When the lender has a
+// webhook URL, an EventLoanPaid event is written to the outbox in the same transaction.
+func (r *loanRepository) MarkPaid(lenderID, loanID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var status string
+	var amount float64
+	var webhookURL sql.NullString
+	err = tx.QueryRow(`SELECT lo.Payment_Status, lo.Amount, le.Webhook_URL
+		FROM Loans lo JOIN Lenders le ON le.Lender_ID = lo.Lender_ID
+		WHERE lo.Loan_ID = ? AND lo.Lender_ID = ?`, loanID, lenderID).Scan(&status, &amount, &webhookURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLoanNotFound
+		}
+		return err
+	}
+	if status != "pending" && status != "active" {
+		return ErrLoanNotPayable
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE Loans SET Payment_Status = 'paid', Updated_At = ? WHERE Loan_ID = ?", now, loanID); err != nil {
+		return err
+	}
+
+	if webhookURL.Valid && webhookURL.String != "" {
+		payload := loanPaidPayload{Event: models.EventLoanPaid, LoanID: loanID, LenderID: lenderID, Amount: amount, PaidAt: now}
+		if err := enqueueOutbox(context.Background(), tx, lenderID, models.EventLoanPaid, webhookURL.String, payload, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReassignLoan moves one of the lender's pending loans to another borrower, e.g. to correct a data
+// entry error, and records the change in the audit log. The new borrower must already hold a loan
+// with the lender, as borrowers are shared between lenders. Reassigning a loan to its current
+// borrower changes nothing.
+func (r *loanRepository) ReassignLoan(ctx context.Context, lenderID, loanID, newBorrowerID int, actor string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var status string
+	var borrowerID int
+	err = tx.QueryRowContext(ctx, "SELECT Payment_Status, Borrower_ID FROM Loans WHERE Loan_ID = ? AND Lender_ID = ?",
+		loanID, lenderID).Scan(&status, &borrowerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrLoanNotFound
+		}
+		return err
+	}
+	if status != "pending" {
+		return ErrLoanNotPending
+	}
+	if borrowerID == newBorrowerID {
+		return nil
+	}
+
+	var known bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM Loans WHERE Lender_ID = ? AND Borrower_ID = ?)",
+		lenderID, newBorrowerID).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return ErrBorrowerNotFound
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE Loans SET Borrower_ID = ?, Updated_At = ? WHERE Loan_ID = ?", newBorrowerID, now, loanID); err != nil {
+		return err
+	}
+	change := map[string]models.FieldChange{"borrower_id": {From: borrowerID, To: newBorrowerID}}
+	if err := recordAudit(ctx, tx, lenderID, actor, models.AuditLoanReassigned, "loan", loanID, change, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkDefaulted moves the lender's active loans whose final due date is before the day of asOf to
+// defaulted, in one transaction. A nil loanIDs marks every such loan; otherwise only the listed
+// loans are considered, and those that are unknown, another lender's, not active or not yet
+// overdue are reported as skipped. When the lender has a webhook URL, an EventLoanDefaulted event
+// is written to the outbox for each loan in the same transaction.
+func (r *loanRepository) MarkDefaulted(lenderID int, loanIDs []int, asOf time.Time) (*models.LoanDefaultResult, error) {
+	result := &models.LoanDefaultResult{LoanIDs: []int{}, Skipped: []int{}}
+	if loanIDs != nil && len(loanIDs) == 0 {
+		return result, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	query := `SELECT Loan_ID FROM Loans
+		WHERE Lender_ID = ? AND Payment_Status = 'active'
+			AND COALESCE(End_Date, DATE(Start_Date, '+' || Months_To_Pay || ' months')) < DATE(?)`
+	args := []any{lenderID, asOf.UTC().Format(time.DateOnly)}
+	if loanIDs != nil {
+		query += " AND Loan_ID IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(loanIDs)), ", ") + ")"
+		for _, id := range loanIDs {
+			args = append(args, id)
+		}
+	}
+	rows, err := tx.Query(query+" ORDER BY Loan_ID", args...)
+	if err != nil {
+		return nil, err
+	}
+	overdue := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.LoanIDs = append(result.LoanIDs, id)
+		overdue[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range loanIDs {
+		if !overdue[id] && !slices.Contains(result.Skipped, id) {
+			result.Skipped = append(result.Skipped, id)
+		}
+	}
+
+	if len(result.LoanIDs) > 0 {
+		now := time.Now().UTC()
+		args := []any{now}
+		for _, id := range result.LoanIDs {
+			args = append(args, id)
+		}
+		_, err := tx.Exec("UPDATE Loans SET Payment_Status = 'defaulted', Updated_At = ? WHERE Loan_ID IN ("+
+			strings.TrimSuffix(strings.Repeat("?, ", len(result.LoanIDs)), ", ")+")", args...)
+		if err != nil {
+			return nil, err
+		}
+
+		var webhookURL sql.NullString
+		if err := tx.QueryRow("SELECT Webhook_URL FROM Lenders WHERE Lender_ID = ?", lenderID).Scan(&webhookURL); err != nil {
+			return nil, err
+		}
+		if webhookURL.Valid && webhookURL.String != "" {
+			for _, id := range result.LoanIDs {
+				payload := loanDefaultedPayload{Event: models.EventLoanDefaulted, LoanID: id, LenderID: lenderID,
+					AsOf: asOf.UTC().Format(time.DateOnly), DefaultedAt: now}
+				if err := enqueueOutbox(context.Background(), tx, lenderID, models.EventLoanDefaulted, webhookURL.String, payload, now); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	result.Defaulted = len(result.LoanIDs)
+	return result, tx.Commit()
+}
+
+// RecomputeLoan recalculates one of the lender's loans' monthly payment and end date from its
+// amount, interest rate and term, and stores them when they differ, e.g. for loans created before
+// the amortized payment was computed. Paid loans are left untouched with ErrLoanPaid.
+func (r *loanRepository) RecomputeLoan(lenderID, loanID int) (*models.LoanRecomputation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var status string
+	var amount, rate float64
+	var months int
+	var start time.Time
+	result := models.LoanRecomputation{LoanID: loanID}
+	err = tx.QueryRow(`SELECT Payment_Status, `+loanPrincipal+`, Interest_Rate, Months_To_Pay, Start_Date, Monthly_Payment, End_Date
+		FROM Loans WHERE Loan_ID = ? AND Lender_ID = ?`, loanID, lenderID).
+		Scan(&status, &amount, &rate, &months, &start, &result.PreviousMonthlyPayment, &result.PreviousEndDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+	if status == "paid" {
+		return nil, ErrLoanPaid
+	}
+
+	result.MonthlyPayment = finance.MonthlyPayment(amount, rate, months)
+	result.EndDate = models.NewJSONTime(start.AddDate(0, months, 0))
+	result.Changed = !result.PreviousMonthlyPayment.Valid || result.PreviousMonthlyPayment.Float64 != result.MonthlyPayment ||
+		!result.PreviousEndDate.Valid || !result.PreviousEndDate.Time.Equal(result.EndDate.Time)
+	if !result.Changed {
+		return &result, nil
+	}
+
+	_, err = tx.Exec("UPDATE Loans SET Monthly_Payment = ?, End_Date = ?, Updated_At = ? WHERE Loan_ID = ?",
+		result.MonthlyPayment, result.EndDate.Format(time.DateOnly), time.Now().UTC(), loanID)
+	if err != nil {
+		return nil, err
+	}
+	return &result, tx.Commit()
+}
+
+// ListDueSoon returns the lender's active loans whose next scheduled instalment falls between the
+// calendar days of from and until inclusive, soonest first.
+func (r *loanRepository) ListDueSoon(lenderID int, from, until time.Time) ([]models.DueLoan, error) {
+	rows, err := r.db.Query(`SELECT lo.Loan_ID, lo.Amount, lo.Interest_Rate, lo.Monthly_Payment, lo.Start_Date, lo.Months_To_Pay,
+			b.Borrower_ID, b.Fullnames, b.Email, b.Phone_Number
+		FROM Loans lo JOIN Borrowers b ON b.Borrower_ID = lo.Borrower_ID
+		WHERE lo.Lender_ID = ? AND lo.Payment_Status = 'active'`, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	until = until.UTC()
+	lastDay := time.Date(until.Year(), until.Month(), until.Day(), 0, 0, 0, 0, time.UTC)
+
+	loans := []models.DueLoan{}
+	for rows.Next() {
+		var l models.DueLoan
+		var rate float64
+		if err := rows.Scan(&l.LoanID, &l.Amount, &rate, &l.MonthlyPayment, &l.StartDate, &l.MonthsToPay,
+			&l.BorrowerID, &l.BorrowerName, &l.BorrowerEmail, &l.BorrowerPhone); err != nil {
+			return nil, err
+		}
+		l.MonthlyPayment = sql.NullFloat64{Float64: finance.Instalment(l.MonthlyPayment, l.Amount, rate, l.MonthsToPay), Valid: true}
+		due, ok := finance.NextDueDate(l.StartDate.Time, l.MonthsToPay, from)
+		if !ok || due.After(lastDay) {
+			continue
+		}
+		l.NextDueDate = models.NewJSONTime(due)
+		loans = append(loans, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(loans, func(i, j int) bool {
+		if !loans[i].NextDueDate.Equal(loans[j].NextDueDate.Time) {
+			return loans[i].NextDueDate.Before(loans[j].NextDueDate.Time)
+		}
+		return loans[i].LoanID < loans[j].LoanID
+	})
+	return loans, nil
+}
+
+// GetVintages groups the lender's issued loans into cohorts by the month they started, oldest first,
+// with the share of each cohort in every issued status and what has been collected on it so far
+func (r *loanRepository) GetVintages(lenderID int) ([]models.Vintage, error) {
+	rows, err := r.db.Query(`WITH paid AS (
+			SELECT Loan_ID, SUM(Amount) AS Total FROM Recipets
+			WHERE Lender_ID = ? AND Status = 'paid'
+			GROUP BY Loan_ID
+		)
+		SELECT STRFTIME('%Y-%m', lo.Start_Date) AS Cohort, COUNT(*), SUM(lo.Amount),
+			100.0 * SUM(CASE WHEN lo.Payment_Status = 'paid' THEN 1 ELSE 0 END) / COUNT(*),
+			100.0 * SUM(CASE WHEN lo.Payment_Status = 'active' THEN 1 ELSE 0 END) / COUNT(*),
+			100.0 * SUM(CASE WHEN lo.Payment_Status = 'defaulted' THEN 1 ELSE 0 END) / COUNT(*),
+			CASE WHEN SUM(lo.Amount) > 0 THEN COALESCE(SUM(paid.Total), 0) / SUM(lo.Amount) ELSE 0 END
+		FROM Loans lo
+		LEFT JOIN paid ON paid.Loan_ID = lo.Loan_ID
+		WHERE lo.Lender_ID = ? AND lo.Payment_Status IN ('active', 'paid', 'defaulted')
+		GROUP BY Cohort
+		ORDER BY Cohort`, lenderID, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vintages := []models.Vintage{}
+	for rows.Next() {
+		var v models.Vintage
+		if err := rows.Scan(&v.Cohort, &v.LoansIssued, &v.PrincipalIssued,
+			&v.PaidPct, &v.ActivePct, &v.DefaultedPct, &v.CollectionRatio); err != nil {
+			return nil, err
+		}
+		vintages = append(vintages, v)
+	}
+	return vintages, rows.Err()
+}
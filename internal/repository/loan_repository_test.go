@@ -0,0 +1,573 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// seedLender creates a lender with an account and returns the lender ID.
+func seedLender(t *testing.T, db *sql.DB, username string) int {
+	repo := NewAuthRepository(db)
+	accountID, err := repo.CreateLenderAndAccount(username+" Business", username+"@example.com", "123", username, "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+	account, err := repo.GetAccountByID(accountID)
+	if err != nil {
+		t.Fatalf("Failed to load seeded account: %v", err)
+	}
+	return account.LenderID
+}
+
+// seedBorrower inserts a borrower and returns its ID.
+func seedBorrower(t *testing.T, db *sql.DB, email string) int {
+	res, err := db.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Test Borrower', ?, '555')", email)
+	if err != nil {
+		t.Fatalf("Failed to seed borrower: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// seedLoan inserts a loan with the given status and returns its ID.
+func seedLoan(t *testing.T, db *sql.DB, lenderID, borrowerID int, status string, amount, rate float64, months int) int {
+	res, err := db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date)
+		VALUES (?, ?, ?, ?, ?, ?, 0, DATE('now'))`, borrowerID, lenderID, months, status, amount, rate)
+	if err != nil {
+		t.Fatalf("Failed to seed loan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestBulkReprice_OnlyPending(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "repricer")
+	otherLenderID := seedLender(t, db, "otherrepricer")
+	borrowerID := seedBorrower(t, db, "borrower@example.com")
+
+	pendingID := seedLoan(t, db, lenderID, borrowerID, "pending", 10000, 5, 12)
+	activeID := seedLoan(t, db, lenderID, borrowerID, "active", 10000, 5, 12)
+	paidID := seedLoan(t, db, lenderID, borrowerID, "paid", 10000, 5, 12)
+	otherID := seedLoan(t, db, otherLenderID, borrowerID, "pending", 10000, 5, 12)
+
+	updated, err := repo.BulkReprice(lenderID, 12, []string{"pending"})
+	if err != nil {
+		t.Fatalf("BulkReprice failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 loan repriced, got %d", updated)
+	}
+
+	// Pending loan has the new rate and a recomputed monthly payment
+	var rate, payment float64
+	err = db.QueryRow("SELECT Interest_Rate, Monthly_Payment FROM Loans WHERE Loan_ID = ?", pendingID).Scan(&rate, &payment)
+	if err != nil {
+		t.Fatalf("Failed to query repriced loan: %v", err)
+	}
+	if rate != 12 {
+		t.Errorf("Expected rate 12, got %.2f", rate)
+	}
+	if payment != 888.49 {
+		t.Errorf("Expected monthly payment 888.49, got %.2f", payment)
+	}
+
+	// Other loans keep their original rate
+	for _, id := range []int{activeID, paidID, otherID} {
+		if err := db.QueryRow("SELECT Interest_Rate FROM Loans WHERE Loan_ID = ?", id).Scan(&rate); err != nil {
+			t.Fatalf("Failed to query loan %d: %v", id, err)
+		}
+		if rate != 5 {
+			t.Errorf("Expected loan %d to keep rate 5, got %.2f", id, rate)
+		}
+	}
+}
+
+func TestBulkReprice_IncludeActive(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "activerepricer")
+	borrowerID := seedBorrower(t, db, "active@example.com")
+
+	seedLoan(t, db, lenderID, borrowerID, "pending", 1000, 5, 12)
+	seedLoan(t, db, lenderID, borrowerID, "active", 1000, 5, 12)
+	seedLoan(t, db, lenderID, borrowerID, "paid", 1000, 5, 12)
+
+	updated, err := repo.BulkReprice(lenderID, 8, []string{"pending", "active"})
+	if err != nil {
+		t.Fatalf("BulkReprice failed: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 loans repriced, got %d", updated)
+	}
+}
+
+func TestRecomputeLoan(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "recomputer")
+	otherID := seedLender(t, db, "otherrecomputer")
+	borrowerID := seedBorrower(t, db, "recomputed@example.com")
+	// Seeded loans have a zero monthly payment and no end date
+	wrongID := seedLoan(t, db, lenderID, borrowerID, "active", 1200, 12, 12)
+	paidID := seedLoan(t, db, lenderID, borrowerID, "paid", 1200, 12, 12)
+
+	// Test case 1: A wrong monthly payment and missing end date are corrected and stored
+	result, err := repo.RecomputeLoan(lenderID, wrongID)
+	if err != nil {
+		t.Fatalf("RecomputeLoan failed: %v", err)
+	}
+	if !result.Changed || result.MonthlyPayment != 106.62 || result.PreviousMonthlyPayment.Float64 != 0 || result.PreviousEndDate.Valid {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	var payment float64
+	var endDate, startDate time.Time
+	db.QueryRow("SELECT Monthly_Payment, End_Date, Start_Date FROM Loans WHERE Loan_ID = ?", wrongID).Scan(&payment, &endDate, &startDate)
+	if payment != 106.62 || !endDate.Equal(startDate.AddDate(1, 0, 0)) || !result.EndDate.Equal(endDate) {
+		t.Errorf("Expected 106.62 ending a year after %v, got %v ending %v", startDate, payment, endDate)
+	}
+
+	// Test case 2: Recomputing again changes nothing
+	if result, err := repo.RecomputeLoan(lenderID, wrongID); err != nil || result.Changed {
+		t.Errorf("Expected no change, got %+v (%v)", result, err)
+	}
+
+	// Test case 3: Paid loans are left untouched
+	if _, err := repo.RecomputeLoan(lenderID, paidID); !errors.Is(err, ErrLoanPaid) {
+		t.Errorf("Expected ErrLoanPaid, got %v", err)
+	}
+	db.QueryRow("SELECT Monthly_Payment FROM Loans WHERE Loan_ID = ?", paidID).Scan(&payment)
+	if payment != 0 {
+		t.Errorf("Expected the paid loan to keep its payment, got %v", payment)
+	}
+
+	// Test case 4: Other lenders' loans are not found
+	if _, err := repo.RecomputeLoan(otherID, wrongID); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestListLoans(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "lister")
+	otherID := seedLender(t, db, "otherlister")
+	borrowerID := seedBorrower(t, db, "listed@example.com")
+	otherBorrowerID := seedBorrower(t, db, "alsolisted@example.com")
+	activeID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	paidID := seedLoan(t, db, lenderID, borrowerID, "paid", 500, 10, 6)
+	otherBorrowerLoanID := seedLoan(t, db, lenderID, otherBorrowerID, "active", 2000, 10, 24)
+	seedLoan(t, db, otherID, borrowerID, "active", 3000, 10, 12)
+
+	// Test case 1: Every loan of the lender, newest first
+	loans, total, err := repo.ListLoans(lenderID, LoanFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListLoans failed: %v", err)
+	}
+	if total != 3 || len(loans) != 3 || loans[0].LoanID != otherBorrowerLoanID || loans[2].LoanID != activeID {
+		t.Errorf("Expected the lender's 3 loans newest first, got %d: %+v", total, loans)
+	}
+
+	// Test case 2: Filtered by status and borrower
+	loans, total, _ = repo.ListLoans(lenderID, LoanFilter{Status: "active", BorrowerID: borrowerID, Limit: 10})
+	if total != 1 || len(loans) != 1 || loans[0].LoanID != activeID || loans[0].Amount != 1000 {
+		t.Errorf("Expected only the borrower's active loan, got %d: %+v", total, loans)
+	}
+
+	// Test case 3: Paging keeps the total
+	loans, total, _ = repo.ListLoans(lenderID, LoanFilter{Limit: 1, Offset: 1})
+	if total != 3 || len(loans) != 1 || loans[0].LoanID != paidID {
+		t.Errorf("Expected the second loan of 3, got %d: %+v", total, loans)
+	}
+
+	// Test case 4: No matches is an empty list
+	loans, total, _ = repo.ListLoans(lenderID, LoanFilter{Status: "defaulted", Limit: 10})
+	if total != 0 || loans == nil || len(loans) != 0 {
+		t.Errorf("Expected an empty list, got %d: %+v", total, loans)
+	}
+
+	// Test case 5: Amount ranges are inclusive, combine with the status filter and may be open-ended
+	max := 1000.0
+	loans, total, _ = repo.ListLoans(lenderID, LoanFilter{MinAmount: 500, MaxAmount: &max, Limit: 10})
+	if total != 2 || len(loans) != 2 || loans[0].LoanID != paidID || loans[1].LoanID != activeID {
+		t.Errorf("Expected the loans of 500 and 1000, got %d: %+v", total, loans)
+	}
+	loans, total, _ = repo.ListLoans(lenderID, LoanFilter{Status: "active", MinAmount: 1500, Limit: 10})
+	if total != 1 || loans[0].LoanID != otherBorrowerLoanID {
+		t.Errorf("Expected only the active loan of 2000, got %d: %+v", total, loans)
+	}
+
+	// Test case 6: A loan stored without a monthly payment gets the derived one
+	db.Exec("UPDATE Loans SET Monthly_Payment = NULL WHERE Loan_ID = ?", activeID)
+	loans, _, _ = repo.ListLoans(lenderID, LoanFilter{Status: "active", BorrowerID: borrowerID, Limit: 10})
+	if len(loans) != 1 || !loans[0].MonthlyPayment.Valid || loans[0].MonthlyPayment.Float64 != 87.92 {
+		t.Errorf("Expected a derived payment of 87.92, got %+v", loans)
+	}
+}
+
+func TestMarkDefaulted(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "defaulter")
+	otherID := seedLender(t, db, "otherdefaulter")
+	borrowerID := seedBorrower(t, db, "defaulting@example.com")
+	// Seeded loans start today, so they are current until moved back
+	overdueID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	endedID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	currentID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	paidID := seedLoan(t, db, lenderID, borrowerID, "paid", 1000, 10, 12)
+	otherOverdueID := seedLoan(t, db, otherID, borrowerID, "active", 1000, 10, 12)
+	db.Exec("UPDATE Loans SET Start_Date = DATE('now', '-2 years') WHERE Loan_ID IN (?, ?, ?)", overdueID, paidID, otherOverdueID)
+	db.Exec("UPDATE Loans SET End_Date = DATE('now', '-1 day') WHERE Loan_ID = ?", endedID)
+	status := func(id int) string {
+		var s string
+		db.QueryRow("SELECT Payment_Status FROM Loans WHERE Loan_ID = ?", id).Scan(&s)
+		return s
+	}
+
+	// Test case 1: Listed loans are marked only when active and overdue
+	result, err := repo.MarkDefaulted(lenderID, []int{overdueID, currentID, paidID, otherOverdueID, 9999, currentID}, time.Now())
+	if err != nil {
+		t.Fatalf("MarkDefaulted failed: %v", err)
+	}
+	if result.Defaulted != 1 || fmt.Sprint(result.LoanIDs) != fmt.Sprint([]int{overdueID}) ||
+		fmt.Sprint(result.Skipped) != fmt.Sprint([]int{currentID, paidID, otherOverdueID, 9999}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if status(overdueID) != "defaulted" || status(currentID) != "active" || status(paidID) != "paid" || status(otherOverdueID) != "active" {
+		t.Error("Expected only the overdue loan to be defaulted")
+	}
+
+	// Test case 2: An earlier as-of date leaves loans that were not yet overdue then
+	if result, _ := repo.MarkDefaulted(lenderID, []int{endedID}, time.Now().AddDate(0, 0, -7)); result.Defaulted != 0 || len(result.Skipped) != 1 {
+		t.Errorf("Expected the loan to be skipped a week ago, got %+v", result)
+	}
+
+	// Test case 3: Without IDs every overdue loan of the lender is marked, and none are skipped
+	result, err = repo.MarkDefaulted(lenderID, nil, time.Now())
+	if err != nil {
+		t.Fatalf("MarkDefaulted failed: %v", err)
+	}
+	if result.Defaulted != 1 || result.LoanIDs[0] != endedID || len(result.Skipped) != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if status(currentID) != "active" || status(otherOverdueID) != "active" {
+		t.Error("Expected current and other lenders' loans to stay active")
+	}
+}
+
+func TestMarkPaid(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	outbox := NewOutboxRepository(db)
+	lenderID := seedLender(t, db, "payee")
+	otherID := seedLender(t, db, "otherpayee")
+	borrowerID := seedBorrower(t, db, "payer@example.com")
+	quietLoan := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	hookedLoan := seedLoan(t, db, lenderID, borrowerID, "pending", 500, 10, 6)
+
+	// Test case 1: Without a webhook URL no event is queued
+	if err := repo.MarkPaid(lenderID, quietLoan); err != nil {
+		t.Fatalf("MarkPaid failed: %v", err)
+	}
+	due, _ := outbox.ListDue(time.Now(), 10)
+	if len(due) != 0 {
+		t.Errorf("Expected no outbox events, got %d", len(due))
+	}
+
+	// Test case 2: With a webhook URL the event is queued alongside the status change
+	if err := NewLenderRepository(db).SetWebhookURL(lenderID, "https://hooks.example.com/lms"); err != nil {
+		t.Fatalf("SetWebhookURL failed: %v", err)
+	}
+	if err := repo.MarkPaid(lenderID, hookedLoan); err != nil {
+		t.Fatalf("MarkPaid failed: %v", err)
+	}
+	var status string
+	db.QueryRow("SELECT Payment_Status FROM Loans WHERE Loan_ID = ?", hookedLoan).Scan(&status)
+	if status != "paid" {
+		t.Errorf("Expected status 'paid', got '%s'", status)
+	}
+	due, _ = outbox.ListDue(time.Now(), 10)
+	if len(due) != 1 || due[0].EventType != models.EventLoanPaid || due[0].Target != "https://hooks.example.com/lms" {
+		t.Fatalf("Expected one loan.paid event, got %+v", due)
+	}
+	if !strings.Contains(due[0].Payload, fmt.Sprintf(`"loan_id":%d`, hookedLoan)) {
+		t.Errorf("Expected the payload to name the loan, got %s", due[0].Payload)
+	}
+
+	// Test case 3: Paid loans and other lenders' loans are rejected
+	if err := repo.MarkPaid(lenderID, hookedLoan); !errors.Is(err, ErrLoanNotPayable) {
+		t.Errorf("Expected ErrLoanNotPayable, got %v", err)
+	}
+	if err := repo.MarkPaid(otherID, quietLoan); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestReassignLoan(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	ctx := context.Background()
+	lenderID := seedLender(t, db, "reassigner")
+	otherID := seedLender(t, db, "otherreassigner")
+	wrongID := seedBorrower(t, db, "wrong@example.com")
+	rightID := seedBorrower(t, db, "right@example.com")
+	strangerID := seedBorrower(t, db, "stranger@example.com")
+	loanID := seedLoan(t, db, lenderID, wrongID, "pending", 1000, 10, 12)
+	seedLoan(t, db, lenderID, rightID, "paid", 500, 10, 6)
+	seedLoan(t, db, otherID, strangerID, "pending", 500, 10, 6)
+	activeID := seedLoan(t, db, lenderID, wrongID, "active", 1000, 10, 12)
+
+	// Test case 1: A pending loan moves to another of the lender's borrowers, with an audit entry
+	if err := repo.ReassignLoan(ctx, lenderID, loanID, rightID, "account:1"); err != nil {
+		t.Fatalf("ReassignLoan failed: %v", err)
+	}
+	var borrowerID int
+	db.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	if borrowerID != rightID {
+		t.Errorf("Expected borrower %d, got %d", rightID, borrowerID)
+	}
+	var actor, details string
+	err := db.QueryRow("SELECT Actor, Details FROM Audit_Log WHERE Action = ? AND Resource_ID = ?", models.AuditLoanReassigned, loanID).Scan(&actor, &details)
+	if err != nil {
+		t.Fatalf("Expected an audit entry: %v", err)
+	}
+	if want := fmt.Sprintf(`{"borrower_id":{"from":%d,"to":%d}}`, wrongID, rightID); actor != "account:1" || details != want {
+		t.Errorf("Unexpected audit entry %s %s, want %s", actor, details, want)
+	}
+
+	// Test case 2: Borrowers the lender has no loans with are refused
+	if err := repo.ReassignLoan(ctx, lenderID, loanID, strangerID, "account:1"); !errors.Is(err, ErrBorrowerNotFound) {
+		t.Errorf("Expected ErrBorrowerNotFound, got %v", err)
+	}
+
+	// Test case 3: Active loans and other lenders' loans are refused
+	if err := repo.ReassignLoan(ctx, lenderID, activeID, rightID, "account:1"); !errors.Is(err, ErrLoanNotPending) {
+		t.Errorf("Expected ErrLoanNotPending, got %v", err)
+	}
+	if err := repo.ReassignLoan(ctx, otherID, loanID, strangerID, "account:1"); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestListDueSoon(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "collector")
+	otherLenderID := seedLender(t, db, "othercollector")
+	borrowerID := seedBorrower(t, db, "due@example.com")
+	now := time.Date(2026, 5, 20, 9, 30, 0, 0, time.UTC)
+
+	seedStarted := func(lender int, status, start string, months int) int {
+		res, err := db.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Monthly_Payment, Start_Date)
+			VALUES (?, ?, ?, ?, 1200, 0, 100, ?)`, borrowerID, lender, months, status, start)
+		if err != nil {
+			t.Fatalf("Failed to seed loan: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		return int(id)
+	}
+
+	dueToday := seedStarted(lenderID, "active", "2026-04-20", 12)
+	dueInFive := seedStarted(lenderID, "active", "2026-03-25", 12)
+	dueInSeven := seedStarted(lenderID, "active", "2026-01-27", 12)
+	seedStarted(lenderID, "active", "2026-04-28", 12)      // Due on 28 May, outside the window
+	seedStarted(lenderID, "active", "2026-01-21", 3)       // Final instalment was on 21 April
+	seedStarted(lenderID, "pending", "2026-04-22", 12)     // Due in two days but not active
+	seedStarted(otherLenderID, "active", "2026-04-22", 12) // Another lender's loan
+
+	// Test case 1: Only active loans due within the window, soonest first
+	loans, err := repo.ListDueSoon(lenderID, now, now.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatalf("ListDueSoon failed: %v", err)
+	}
+	want := []int{dueToday, dueInFive, dueInSeven}
+	if len(loans) != len(want) {
+		t.Fatalf("Expected %d loans, got %+v", len(want), loans)
+	}
+	for i, id := range want {
+		if loans[i].LoanID != id {
+			t.Errorf("Expected loan %d at position %d, got %d", id, i, loans[i].LoanID)
+		}
+	}
+	if got := loans[1].NextDueDate.Format("2006-01-02"); got != "2026-05-25" {
+		t.Errorf("Expected next due date 2026-05-25, got %s", got)
+	}
+	if loans[0].BorrowerEmail != "due@example.com" || loans[0].BorrowerPhone != "555" {
+		t.Errorf("Expected borrower contact details, got %+v", loans[0])
+	}
+
+	// Test case 2: A narrower window drops the later loans
+	loans, _ = repo.ListDueSoon(lenderID, now, now)
+	if len(loans) != 1 || loans[0].LoanID != dueToday {
+		t.Errorf("Expected only the loan due today, got %+v", loans)
+	}
+}
+
+func TestCreateLoan_ActiveLimit(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "originator")
+	otherLenderID := seedLender(t, db, "otheroriginator")
+	borrowerID := seedBorrower(t, db, "limited@example.com")
+	newLoan := func(lenderID int) *models.Loan {
+		return &models.Loan{BorrowerID: borrowerID, LenderID: lenderID, MonthsToPay: 12, PaymentStatus: "active",
+			Amount: 1000, InterestRate: 5, StartDate: models.NewJSONTime(time.Now())}
+	}
+
+	// Test case 1: Under the limit the loan is created
+	seedLoan(t, db, lenderID, borrowerID, "active", 1000, 5, 12)
+	seedLoan(t, db, lenderID, borrowerID, "paid", 1000, 5, 12)
+	seedLoan(t, db, otherLenderID, borrowerID, "active", 1000, 5, 12)
+	loan := newLoan(lenderID)
+	if err := repo.CreateLoan(loan, 2); err != nil {
+		t.Fatalf("CreateLoan failed: %v", err)
+	}
+	if loan.LoanID == 0 {
+		t.Error("Expected the loan ID to be set")
+	}
+
+	// Test case 2: At the limit it is refused; paid loans and other lenders' loans do not count
+	if err := repo.CreateLoan(newLoan(lenderID), 2); !errors.Is(err, ErrBorrowerLoanLimit) {
+		t.Errorf("Expected ErrBorrowerLoanLimit, got %v", err)
+	}
+	if err := repo.CreateLoan(newLoan(otherLenderID), 2); err != nil {
+		t.Errorf("Expected the other lender to stay under the limit, got %v", err)
+	}
+
+	// Test case 3: Zero means unlimited
+	if err := repo.CreateLoan(newLoan(lenderID), 0); err != nil {
+		t.Errorf("Expected no limit, got %v", err)
+	}
+	var active int
+	db.QueryRow("SELECT COUNT(*) FROM Loans WHERE Lender_ID = ? AND Payment_Status = 'active'", lenderID).Scan(&active)
+	if active != 3 {
+		t.Errorf("Expected 3 active loans, got %d", active)
+	}
+}
+
+func TestCreateLoan_InvalidTerms(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "validator")
+	borrowerID := seedBorrower(t, db, "validated@example.com")
+	newLoan := func(amount, rate float64, months int) *models.Loan {
+		return &models.Loan{BorrowerID: borrowerID, LenderID: lenderID, MonthsToPay: months, PaymentStatus: "pending",
+			Amount: amount, InterestRate: rate, StartDate: models.NewJSONTime(time.Now())}
+	}
+
+	tests := []struct {
+		name string
+		loan *models.Loan
+		want error
+	}{
+		// Test case 1: Each broken term is reported by its own error
+		{"zero amount", newLoan(0, 5, 12), ErrInvalidAmount},
+		{"negative amount", newLoan(-100, 5, 12), ErrInvalidAmount},
+		{"NaN amount", newLoan(math.NaN(), 5, 12), ErrInvalidAmount},
+		{"negative rate", newLoan(1000, -1, 12), ErrInvalidInterestRate},
+		{"zero term", newLoan(1000, 5, 0), ErrInvalidTerm},
+		// Test case 2: A zero rate is allowed
+		{"interest free", newLoan(1000, 0, 12), nil},
+	}
+	for _, tt := range tests {
+		if err := repo.CreateLoan(tt.loan, 0); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Test case 3: Refused loans never reach the database
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM Loans WHERE Lender_ID = ?", lenderID).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected only the valid loan stored, got %d", count)
+	}
+}
+
+func TestGetVintages(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewLoanRepository(db)
+	lenderID := seedLender(t, db, "vintages")
+	otherID := seedLender(t, db, "othervintages")
+	borrowerID := seedBorrower(t, db, "vintages@example.com")
+	loan := func(lenderID int, status string, amount float64, start string) int {
+		t.Helper()
+		id := seedLoan(t, db, lenderID, borrowerID, status, amount, 10, 12)
+		db.Exec("UPDATE Loans SET Start_Date = ? WHERE Loan_ID = ?", start, id)
+		return id
+	}
+	receipt := func(loanID int, status string, amount float64) {
+		if _, err := db.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Timestamp, Status, Amount) VALUES (?, ?, DATETIME('now'), ?, ?)",
+			loanID, lenderID, status, amount); err != nil {
+			t.Fatalf("Failed to seed receipt: %v", err)
+		}
+	}
+
+	// Test case 1: A lender with no loans has no cohorts
+	vintages, err := repo.GetVintages(lenderID)
+	if err != nil {
+		t.Fatalf("GetVintages failed: %v", err)
+	}
+	if vintages == nil || len(vintages) != 0 {
+		t.Errorf("Expected an empty list, got %+v", vintages)
+	}
+
+	// January: one loan each paid, active and defaulted, 1200 of 4000 collected
+	receipt(loan(lenderID, "paid", 1000, "2026-01-05"), "paid", 1000)
+	receipt(loan(lenderID, "active", 1000, "2026-01-20"), "paid", 200)
+	receipt(loan(lenderID, "defaulted", 2000, "2026-01-31"), "failed", 300)
+	// March: one active loan, 100 of 500 collected; pending and cancelled loans were never issued
+	receipt(loan(lenderID, "active", 500, "2026-03-01"), "paid", 100)
+	loan(lenderID, "pending", 700, "2026-03-02")
+	loan(lenderID, "cancelled", 800, "2026-02-10")
+	loan(otherID, "defaulted", 900, "2026-01-10")
+
+	// Test case 2: One cohort per month with issued loans, oldest first
+	vintages, err = repo.GetVintages(lenderID)
+	if err != nil {
+		t.Fatalf("GetVintages failed: %v", err)
+	}
+	want := []models.Vintage{
+		{Cohort: "2026-01", LoansIssued: 3, PrincipalIssued: 4000, PaidPct: 100.0 / 3, ActivePct: 100.0 / 3, DefaultedPct: 100.0 / 3, CollectionRatio: 0.3},
+		{Cohort: "2026-03", LoansIssued: 1, PrincipalIssued: 500, ActivePct: 100, CollectionRatio: 0.2},
+	}
+	if len(vintages) != len(want) {
+		t.Fatalf("Expected %d cohorts, got %+v", len(want), vintages)
+	}
+	for i := range want {
+		if vintages[i] != want[i] {
+			t.Errorf("Cohort %d: expected %+v, got %+v", i, want[i], vintages[i])
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// NotificationPreferenceRepository defines the interface for the events lenders are sent on each
+// channel. Every event in models.NotificationChannels is enabled until the lender turns it off.
+type NotificationPreferenceRepository interface {
+	List(lenderID int) ([]models.NotificationPreference, error)
+	Set(lenderID int, prefs []models.NotificationPreference) error
+	Enabled(lenderID int, event, channel string) (bool, error)
+}
+
+// notificationPreferenceRepository implements NotificationPreferenceRepository using a SQLite database connection.
+type notificationPreferenceRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationPreferenceRepository creates a new NotificationPreferenceRepository instance.
+func NewNotificationPreferenceRepository(db *sql.DB) NotificationPreferenceRepository {
+	return &notificationPreferenceRepository{db: db}
+}
+
+// List returns the lender's preference for every event and channel, by event, with the defaults
+// filled in.
+func (r *notificationPreferenceRepository) List(lenderID int) ([]models.NotificationPreference, error) {
+	rows, err := r.db.Query("SELECT Event, Channel, Enabled FROM Notification_Preferences WHERE Lender_ID = ?", lenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[[2]string]bool)
+	for rows.Next() {
+		var event, channel string
+		var enabled bool
+		if err := rows.Scan(&event, &channel, &enabled); err != nil {
+			return nil, err
+		}
+		stored[[2]string{event, channel}] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	events := make([]string, 0, len(models.NotificationChannels))
+	for event := range models.NotificationChannels {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	var prefs []models.NotificationPreference
+	for _, event := range events {
+		for _, channel := range models.NotificationChannels[event] {
+			enabled, ok := stored[[2]string{event, channel}]
+			prefs = append(prefs, models.NotificationPreference{Event: event, Channel: channel, Enabled: enabled || !ok})
+		}
+	}
+	return prefs, nil
+}
+
+// Set stores the lender's preferences, together. Events and channels not listed keep theirs.
+func (r *notificationPreferenceRepository) Set(lenderID int, prefs []models.NotificationPreference) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	for _, pref := range prefs {
+		_, err := tx.Exec(`INSERT INTO Notification_Preferences (Lender_ID, Event, Channel, Enabled) VALUES (?, ?, ?, ?)
+			ON CONFLICT (Lender_ID, Event, Channel) DO UPDATE SET Enabled = excluded.Enabled, Updated_At = CURRENT_TIMESTAMP`,
+			lenderID, pref.Event, pref.Channel, pref.Enabled)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Enabled reports whether the lender is sent the event on the channel. Events the lender has no
+// preference for are enabled, as are those unknown to models.NotificationChannels, which cannot
+// be turned off.
+func (r *notificationPreferenceRepository) Enabled(lenderID int, event, channel string) (bool, error) {
+	if !slices.Contains(models.NotificationChannels[event], channel) {
+		return true, nil
+	}
+	var enabled bool
+	err := r.db.QueryRow("SELECT Enabled FROM Notification_Preferences WHERE Lender_ID = ? AND Event = ? AND Channel = ?",
+		lenderID, event, channel).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	return enabled, err
+}
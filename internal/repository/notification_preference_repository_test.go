@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewNotificationPreferenceRepository(db)
+	lenderID := seedLender(t, db, "preferrer")
+	otherID := seedLender(t, db, "otherpreferrer")
+	enabled := func(lenderID int, event, channel string) bool {
+		ok, err := repo.Enabled(lenderID, event, channel)
+		if err != nil {
+			t.Fatalf("Enabled failed: %v", err)
+		}
+		return ok
+	}
+
+	// Test case 1: Every event and channel is enabled by default
+	prefs, err := repo.List(lenderID)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(prefs) != 4 || prefs[0].Event != models.EventLoanDefaulted {
+		t.Fatalf("Expected every event and channel by event, got %+v", prefs)
+	}
+	for _, pref := range prefs {
+		if !pref.Enabled {
+			t.Errorf("Expected %s by %s enabled by default", pref.Event, pref.Channel)
+		}
+	}
+
+	// Test case 2: Turning one off leaves the others, and other lenders, enabled
+	if err := repo.Set(lenderID, []models.NotificationPreference{{Event: models.EventLoanPaid, Channel: models.ChannelWebhook}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if enabled(lenderID, models.EventLoanPaid, models.ChannelWebhook) || !enabled(lenderID, models.EventLoanDefaulted, models.ChannelWebhook) ||
+		!enabled(otherID, models.EventLoanPaid, models.ChannelWebhook) {
+		t.Error("Expected only the lender's loan.paid webhook turned off")
+	}
+
+	// Test case 3: Setting it again turns it back on
+	repo.Set(lenderID, []models.NotificationPreference{{Event: models.EventLoanPaid, Channel: models.ChannelWebhook, Enabled: true}})
+	if !enabled(lenderID, models.EventLoanPaid, models.ChannelWebhook) {
+		t.Error("Expected loan.paid turned back on")
+	}
+
+	// Test case 4: Events that cannot be configured are always enabled
+	if !enabled(lenderID, "test.event", models.ChannelWebhook) || !enabled(lenderID, models.EventLoanPaid, models.ChannelEmail) {
+		t.Error("Expected unconfigurable events to be enabled")
+	}
+}
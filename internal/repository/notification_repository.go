@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// NotificationFilter narrows and pages the admin notification list; zero values leave a filter unset
+type NotificationFilter struct {
+	Status   string
+	Kind     string
+	LenderID int
+	Limit    int
+	Offset   int
+}
+
+// NotificationRepository defines the interface for the emails background jobs owe recipients.
+// Like the Outbox, a notification is attempted until it is sent or its retries run out.
+type NotificationRepository interface {
+	Enqueue(n models.Notification, now time.Time) (bool, error)
+	Create(n models.Notification, now time.Time) (int, error)
+	ListDue(kind string, now time.Time, limit int) ([]models.Notification, error)
+	MarkSent(notificationID int, at time.Time) error
+	ScheduleRetry(notificationID int, next sql.NullTime, lastErr string) error
+	List(filter NotificationFilter) ([]models.Notification, int, error)
+}
+
+// notificationRepository implements NotificationRepository using a SQLite database connection.
+type notificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new NotificationRepository instance.
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+	return &notificationRepository{db: db}
+}
+
+// notificationColumns are read by scanNotification
+const notificationColumns = `Notification_ID, Lender_ID, Kind, Period, Recipient, Payload, Status, Attempts,
+	Next_Attempt_At, Sent_At, Last_Error, Created_At`
+
+// Enqueue queues a notification due immediately. It returns false, and queues nothing, when the
+// recipient already has one of the same kind for the lender and period.
+func (r *notificationRepository) Enqueue(n models.Notification, now time.Time) (bool, error) {
+	result, err := r.db.Exec(`INSERT INTO Notifications (Lender_ID, Kind, Period, Recipient, Payload, Next_Attempt_At, Created_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (Lender_ID, Kind, Period, Recipient) DO NOTHING`,
+		n.LenderID, n.Kind, n.Period, n.Recipient, n.Payload, now.UTC(), now.UTC())
+	if err != nil {
+		return false, err
+	}
+	queued, err := result.RowsAffected()
+	return queued > 0, err
+}
+
+// Create queues a notification due immediately and returns its ID. Unlike Enqueue it fails on a
+// duplicate, so Period should name the notification uniquely, e.g. by when it was requested.
+func (r *notificationRepository) Create(n models.Notification, now time.Time) (int, error) {
+	result, err := r.db.Exec(`INSERT INTO Notifications (Lender_ID, Kind, Period, Recipient, Payload, Next_Attempt_At, Created_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, n.LenderID, n.Kind, n.Period, n.Recipient, n.Payload, now.UTC(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// ListDue returns pending notifications of a kind whose next attempt is due, oldest first.
+func (r *notificationRepository) ListDue(kind string, now time.Time, limit int) ([]models.Notification, error) {
+	rows, err := r.db.Query(`SELECT `+notificationColumns+` FROM Notifications
+		WHERE Status = 'pending' AND Kind = ? AND Next_Attempt_At <= ?
+		ORDER BY Next_Attempt_At, Notification_ID LIMIT ?`, kind, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+// MarkSent records a successful attempt. The payload is no longer needed and is cleared, as it may
+// carry single-use links.
+func (r *notificationRepository) MarkSent(notificationID int, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE Notifications SET Status = 'sent', Attempts = Attempts + 1, Sent_At = ?, Next_Attempt_At = NULL,
+		Last_Error = NULL, Payload = '' WHERE Notification_ID = ?`, at.UTC(), notificationID)
+	return err
+}
+
+// ScheduleRetry records a failed attempt. A null next attempt gives up, marking the notification failed.
+func (r *notificationRepository) ScheduleRetry(notificationID int, next sql.NullTime, lastErr string) error {
+	status := models.NotificationPending
+	if next.Valid {
+		next.Time = next.Time.UTC()
+	} else {
+		status = models.NotificationFailed
+	}
+	_, err := r.db.Exec("UPDATE Notifications SET Status = ?, Attempts = Attempts + 1, Next_Attempt_At = ?, Last_Error = ? WHERE Notification_ID = ?",
+		status, next, lastErr, notificationID)
+	return err
+}
+
+// List returns one page of notifications matching the filter, newest first, and how many match in all.
+func (r *notificationRepository) List(filter NotificationFilter) ([]models.Notification, int, error) {
+	where, args := "1 = 1", []any{}
+	if filter.Status != "" {
+		where += " AND Status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.Kind != "" {
+		where += " AND Kind = ?"
+		args = append(args, filter.Kind)
+	}
+	if filter.LenderID != 0 {
+		where += " AND Lender_ID = ?"
+		args = append(args, filter.LenderID)
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM Notifications WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.Query("SELECT "+notificationColumns+" FROM Notifications WHERE "+where+
+		" ORDER BY Created_At DESC, Notification_ID DESC LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	notifications, err := scanNotifications(rows)
+	return notifications, total, err
+}
+
+// scanNotifications reads the notificationColumns of every row
+func scanNotifications(rows *sql.Rows) ([]models.Notification, error) {
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.NotificationID, &n.LenderID, &n.Kind, &n.Period, &n.Recipient, &n.Payload, &n.Status,
+			&n.Attempts, &n.NextAttemptAt, &n.SentAt, &n.LastError, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestNotifications(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewNotificationRepository(db)
+	lenderID := seedLender(t, db, "notified")
+	otherID := seedLender(t, db, "othernotified")
+	now := time.Now()
+	n := models.Notification{LenderID: lenderID, Kind: models.NotificationMonthlyReports, Period: "2026-09", Recipient: "owner@example.com", Payload: "{}"}
+
+	// Test case 1: A recipient is only queued once per kind and period
+	if queued, err := repo.Enqueue(n, now); err != nil || !queued {
+		t.Fatalf("Expected the notification queued, got %v, %v", queued, err)
+	}
+	if queued, _ := repo.Enqueue(n, now); queued {
+		t.Error("Expected a second notification for the period to be ignored")
+	}
+	n.Period = "2026-10"
+	repo.Enqueue(n, now)
+	due, err := repo.ListDue(models.NotificationMonthlyReports, now, 10)
+	if err != nil {
+		t.Fatalf("ListDue failed: %v", err)
+	}
+	if len(due) != 2 || due[0].Period != "2026-09" || due[0].Status != models.NotificationPending {
+		t.Fatalf("Expected both periods due, got %+v", due)
+	}
+	if due, _ := repo.ListDue("other_kind", now, 10); len(due) != 0 {
+		t.Errorf("Expected nothing due of another kind, got %d", len(due))
+	}
+
+	// Test case 2: Retries are due at their time; giving up marks the notification failed
+	repo.ScheduleRetry(due[0].NotificationID, sql.NullTime{Time: now.Add(time.Minute), Valid: true}, "busy")
+	repo.ScheduleRetry(due[1].NotificationID, sql.NullTime{}, "rejected")
+	if due, _ := repo.ListDue(models.NotificationMonthlyReports, now, 10); len(due) != 0 {
+		t.Errorf("Expected nothing due before the retry, got %d", len(due))
+	}
+	due, _ = repo.ListDue(models.NotificationMonthlyReports, now.Add(time.Hour), 10)
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError.String != "busy" {
+		t.Fatalf("Expected the retried notification, got %+v", due)
+	}
+
+	// Test case 3: Sent notifications are never due again
+	if err := repo.MarkSent(due[0].NotificationID, now); err != nil {
+		t.Fatalf("MarkSent failed: %v", err)
+	}
+	if due, _ := repo.ListDue(models.NotificationMonthlyReports, now.AddDate(1, 0, 0), 10); len(due) != 0 {
+		t.Errorf("Expected nothing due, got %d", len(due))
+	}
+	if sent, _, _ := repo.List(NotificationFilter{Status: models.NotificationSent, Limit: 10}); len(sent) != 1 || sent[0].Payload != "" {
+		t.Errorf("Expected the sent notification's payload cleared, got %+v", sent)
+	}
+
+	// Test case 4: The admin list filters by status and lender
+	repo.Enqueue(models.Notification{LenderID: otherID, Kind: models.NotificationMonthlyReports, Period: "2026-09", Recipient: "other@example.com", Payload: "{}"}, now)
+	failed, total, err := repo.List(NotificationFilter{Status: models.NotificationFailed, Limit: 10})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if total != 1 || len(failed) != 1 || failed[0].Period != "2026-10" || failed[0].LastError.String != "rejected" || failed[0].NextAttemptAt.Valid {
+		t.Errorf("Expected the failed notification, got %d %+v", total, failed)
+	}
+	if _, total, _ := repo.List(NotificationFilter{LenderID: lenderID, Limit: 1}); total != 2 {
+		t.Errorf("Expected 2 notifications for the lender, got %d", total)
+	}
+
+	// Test case 5: Create returns the ID and rejects a duplicate instead of skipping it
+	email := models.Notification{LenderID: lenderID, Kind: models.NotificationPasswordReset, Period: now.Format(time.RFC3339Nano), Recipient: "owner@example.com", Payload: "{}"}
+	id, err := repo.Create(email, now)
+	if err != nil || id == 0 {
+		t.Fatalf("Expected the notification created, got %d, %v", id, err)
+	}
+	if due, _ := repo.ListDue(models.NotificationPasswordReset, now, 10); len(due) != 1 || due[0].NotificationID != id {
+		t.Errorf("Expected the created notification due, got %+v", due)
+	}
+	if _, err := repo.Create(email, now); err == nil {
+		t.Error("Expected a duplicate to fail")
+	}
+}
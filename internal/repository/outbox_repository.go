@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// OutboxRepository defines the interface for reading and updating queued webhook events.
+// Events are written by the repositories that make the change they describe, in the same transaction.
+type OutboxRepository interface {
+	ListDue(now time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkDelivered(outboxID int, at time.Time) error
+	ScheduleRetry(outboxID int, next sql.NullTime, lastErr string) error
+}
+
+// outboxRepository implements OutboxRepository using a SQLite database connection.
+type outboxRepository struct {
+	db *sql.DB
+}
+
+// NewOutboxRepository creates a new OutboxRepository instance.
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// ListDue returns undelivered events whose next attempt is due, oldest first.
+func (r *outboxRepository) ListDue(now time.Time, limit int) ([]models.OutboxEvent, error) {
+	rows, err := r.db.Query(`SELECT Outbox_ID, COALESCE(Lender_ID, 0), Event_Type, Payload, Target, Attempts, Next_Attempt_At, Delivered_At, Last_Error, Created_At
+		FROM Outbox WHERE Delivered_At IS NULL AND Next_Attempt_At <= ?
+		ORDER BY Next_Attempt_At, Outbox_ID LIMIT ?`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var e models.OutboxEvent
+		if err := rows.Scan(&e.OutboxID, &e.LenderID, &e.EventType, &e.Payload, &e.Target, &e.Attempts,
+			&e.NextAttemptAt, &e.DeliveredAt, &e.LastError, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkDelivered records a successful delivery attempt.
+func (r *outboxRepository) MarkDelivered(outboxID int, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE Outbox SET Attempts = Attempts + 1, Delivered_At = ?, Next_Attempt_At = NULL, Last_Error = NULL
+		WHERE Outbox_ID = ?`, at.UTC(), outboxID)
+	return err
+}
+
+// ScheduleRetry records a failed delivery attempt. A null next attempt gives up on the event.
+func (r *outboxRepository) ScheduleRetry(outboxID int, next sql.NullTime, lastErr string) error {
+	if next.Valid {
+		next.Time = next.Time.UTC()
+	}
+	_, err := r.db.Exec("UPDATE Outbox SET Attempts = Attempts + 1, Next_Attempt_At = ?, Last_Error = ? WHERE Outbox_ID = ?",
+		next, lastErr, outboxID)
+	return err
+}
+
+// enqueueOutbox writes an event for a lender, due immediately. Pass the transaction making the change the event describes.
+func enqueueOutbox(ctx context.Context, q DBTX, lenderID int, eventType, target string, payload any, now time.Time) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO Outbox (Lender_ID, Event_Type, Payload, Target, Next_Attempt_At, Created_At) VALUES (?, ?, ?, ?, ?, ?)",
+		lenderID, eventType, string(body), target, now.UTC(), now.UTC())
+	return err
+}
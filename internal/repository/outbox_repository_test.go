@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestOutboxDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewOutboxRepository(db)
+	now := time.Now()
+	if err := enqueueOutbox(context.Background(), db, 1, "test.event", "https://hooks.example.com", map[string]int{"id": 1}, now); err != nil {
+		t.Fatalf("enqueueOutbox failed: %v", err)
+	}
+	due, err := repo.ListDue(now, 10)
+	if err != nil {
+		t.Fatalf("ListDue failed: %v", err)
+	}
+	if len(due) != 1 || due[0].Payload != `{"id":1}` || due[0].LenderID != 1 {
+		t.Fatalf("Expected the queued event, got %+v", due)
+	}
+	id := due[0].OutboxID
+
+	// Test case 1: A scheduled retry is not due until its time
+	if err := repo.ScheduleRetry(id, sql.NullTime{Time: now.Add(time.Minute), Valid: true}, "boom"); err != nil {
+		t.Fatalf("ScheduleRetry failed: %v", err)
+	}
+	if due, _ := repo.ListDue(now, 10); len(due) != 0 {
+		t.Errorf("Expected nothing due before the retry time, got %d", len(due))
+	}
+	due, _ = repo.ListDue(now.Add(2*time.Minute), 10)
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError.String != "boom" {
+		t.Fatalf("Expected the retried event after one attempt, got %+v", due)
+	}
+
+	// Test case 2: Delivered events are never due again
+	if err := repo.MarkDelivered(id, now); err != nil {
+		t.Fatalf("MarkDelivered failed: %v", err)
+	}
+	if due, _ := repo.ListDue(now.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("Expected delivered events not to be due, got %d", len(due))
+	}
+
+	// Test case 3: Giving up leaves the event undelivered and never due
+	enqueueOutbox(context.Background(), db, 1, "test.event", "https://hooks.example.com", nil, now)
+	due, _ = repo.ListDue(now, 10)
+	repo.ScheduleRetry(due[0].OutboxID, sql.NullTime{}, "gone")
+	if due, _ := repo.ListDue(now.AddDate(1, 0, 0), 10); len(due) != 0 {
+		t.Errorf("Expected abandoned events not to be due, got %d", len(due))
+	}
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// DefaultPlanCacheTTL bounds how stale cached plans can get when Plans is changed outside the repository.
+const DefaultPlanCacheTTL = 5 * time.Minute
+
+// cachedPlan is a plan lookup result and when it stops being fresh
+type cachedPlan struct {
+	plan    models.Plan
+	expires time.Time
+}
+
+// cachedPlanRepository serves ListActivePlans and GetPlanByID from memory for up to ttl.
+// Every write through the repository clears the cache. Other methods go straight to the wrapped repository.
+type cachedPlanRepository struct {
+	PlanRepository
+	ttl time.Duration
+	now func() time.Time
+
+	mu          sync.RWMutex
+	active      []models.Plan
+	activeUntil time.Time
+	byID        map[int]cachedPlan
+}
+
+// NewCachedPlanRepository wraps a PlanRepository with an in-memory cache of plan lookups.
+func NewCachedPlanRepository(repo PlanRepository, ttl time.Duration) PlanRepository {
+	return &cachedPlanRepository{
+		PlanRepository: repo,
+		ttl:            ttl,
+		now:            time.Now,
+		byID:           make(map[int]cachedPlan),
+	}
+}
+
+// ListActivePlans returns a copy of the cached active plans, loading them on a miss or once stale.
+func (r *cachedPlanRepository) ListActivePlans() ([]models.Plan, error) {
+	r.mu.RLock()
+	if r.active != nil && r.now().Before(r.activeUntil) {
+		plans := append([]models.Plan(nil), r.active...)
+		r.mu.RUnlock()
+		return plans, nil
+	}
+	r.mu.RUnlock()
+
+	plans, err := r.PlanRepository.ListActivePlans()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.active = append(make([]models.Plan, 0, len(plans)), plans...)
+	r.activeUntil = r.now().Add(r.ttl)
+	r.mu.Unlock()
+	return plans, nil
+}
+
+// GetPlanByID returns a copy of the cached plan, loading it on a miss or once stale. Errors are not cached.
+func (r *cachedPlanRepository) GetPlanByID(planID int) (*models.Plan, error) {
+	r.mu.RLock()
+	e, ok := r.byID[planID]
+	r.mu.RUnlock()
+	if ok && r.now().Before(e.expires) {
+		plan := e.plan
+		return &plan, nil
+	}
+
+	plan, err := r.PlanRepository.GetPlanByID(planID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.byID[planID] = cachedPlan{plan: *plan, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+	return plan, nil
+}
+
+// SetPrice updates the price and clears the cache.
+func (r *cachedPlanRepository) SetPrice(planID int, currency string, amount float64) error {
+	defer r.Invalidate()
+	return r.PlanRepository.SetPrice(planID, currency, amount)
+}
+
+// DeletePrice removes the price and clears the cache.
+func (r *cachedPlanRepository) DeletePrice(planID int, currency string) error {
+	defer r.Invalidate()
+	return r.PlanRepository.DeletePrice(planID, currency)
+}
+
+// SetFeatures updates the plan's features and clears the cache.
+func (r *cachedPlanRepository) SetFeatures(planID int, features models.PlanFeatures) error {
+	defer r.Invalidate()
+	return r.PlanRepository.SetFeatures(planID, features)
+}
+
+// CreatePlan inserts the plan and clears the cache.
+func (r *cachedPlanRepository) CreatePlan(plan *models.Plan) error {
+	defer r.Invalidate()
+	return r.PlanRepository.CreatePlan(plan)
+}
+
+// UpdatePlan updates the plan and clears the cache.
+func (r *cachedPlanRepository) UpdatePlan(planID int, update models.PlanUpdate) error {
+	defer r.Invalidate()
+	return r.PlanRepository.UpdatePlan(planID, update)
+}
+
+// Invalidate drops every cached plan.
+func (r *cachedPlanRepository) Invalidate() {
+	r.mu.Lock()
+	r.active = nil
+	r.byID = make(map[int]cachedPlan)
+	r.mu.Unlock()
+}
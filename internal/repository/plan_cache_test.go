@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// countingPlanRepository counts the plan lookups that reach the database.
+type countingPlanRepository struct {
+	PlanRepository
+	mu    sync.Mutex
+	lists int
+	gets  int
+}
+
+func (c *countingPlanRepository) ListActivePlans() ([]models.Plan, error) {
+	c.mu.Lock()
+	c.lists++
+	c.mu.Unlock()
+	return c.PlanRepository.ListActivePlans()
+}
+
+func (c *countingPlanRepository) GetPlanByID(planID int) (*models.Plan, error) {
+	c.mu.Lock()
+	c.gets++
+	c.mu.Unlock()
+	return c.PlanRepository.GetPlanByID(planID)
+}
+
+func TestCachedPlanRepository(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	counter := &countingPlanRepository{PlanRepository: NewPlanRepository(db)}
+	repo := NewCachedPlanRepository(counter, time.Minute).(*cachedPlanRepository)
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	planID := seedPlan(t, db, "Basic", 100)
+
+	// Test case 1: A second read within the TTL is served from memory
+	repo.ListActivePlans()
+	plans, err := repo.ListActivePlans()
+	if err != nil || len(plans) != 1 || counter.lists != 1 {
+		t.Fatalf("Expected one database read for 1 plan, got %d reads and %d plans (%v)", counter.lists, len(plans), err)
+	}
+	repo.GetPlanByID(planID)
+	plan, _ := repo.GetPlanByID(planID)
+	if plan.Plan != "Basic" || counter.gets != 1 {
+		t.Errorf("Expected one database read for plan 'Basic', got %d reads and '%s'", counter.gets, plan.Plan)
+	}
+
+	// Test case 2: Callers get copies they cannot use to change the cache
+	plans[0].Plan = "Mutated"
+	plan.Features.Webhooks = true
+	plans, _ = repo.ListActivePlans()
+	plan, _ = repo.GetPlanByID(planID)
+	if plans[0].Plan != "Basic" || plan.Features.Webhooks {
+		t.Errorf("Expected cached plans to be unchanged, got '%s' and %+v", plans[0].Plan, plan.Features)
+	}
+
+	// Test case 3: A write through the repository invalidates the cache
+	if err := repo.SetFeatures(planID, models.PlanFeatures{Webhooks: true}); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	plan, _ = repo.GetPlanByID(planID)
+	if !plan.Features.Webhooks || counter.gets != 2 {
+		t.Errorf("Expected a fresh read with webhooks enabled, got %d reads and %+v", counter.gets, plan.Features)
+	}
+	repo.ListActivePlans()
+	if counter.lists != 2 {
+		t.Errorf("Expected the active plans to be read again, got %d reads", counter.lists)
+	}
+
+	// Test case 4: Entries expire after the TTL
+	now = now.Add(time.Minute)
+	repo.ListActivePlans()
+	repo.GetPlanByID(planID)
+	if counter.lists != 3 || counter.gets != 3 {
+		t.Errorf("Expected stale entries to be read again, got %d list and %d get reads", counter.lists, counter.gets)
+	}
+
+	// Test case 5: Missing plans are not cached
+	repo.GetPlanByID(9999)
+	if _, err := repo.GetPlanByID(9999); !errors.Is(err, ErrPlanNotFound) || counter.gets != 5 {
+		t.Errorf("Expected ErrPlanNotFound from two reads, got %v after %d reads", err, counter.gets)
+	}
+}
+
+func TestCachedPlanRepository_ConcurrentReads(t *testing.T) {
+	db := setupSingleConnTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewCachedPlanRepository(NewPlanRepository(db), time.Minute)
+	planID := seedPlan(t, db, "Basic", 100)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%5 == 0 {
+				repo.SetFeatures(planID, models.PlanFeatures{MaxUsers: i})
+				return
+			}
+			if _, err := repo.GetPlanByID(planID); err != nil {
+				t.Errorf("GetPlanByID failed: %v", err)
+			}
+			if _, err := repo.ListActivePlans(); err != nil {
+				t.Errorf("ListActivePlans failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrPlanNotFound      = errors.New("plan not found")
+	ErrPlanPriceNotFound = errors.New("plan price not found")
+)
+
+// PlanRepository defines the interface for plan-related database operations.
+type PlanRepository interface {
+	ListActivePlans() ([]models.Plan, error)
+	ListAllPlans() ([]models.Plan, error)
+	CreatePlan(plan *models.Plan) error
+	UpdatePlan(planID int, update models.PlanUpdate) error
+	GetPlanByID(planID int) (*models.Plan, error)
+	ListPrices(planID int) ([]models.PlanPrice, error)
+	ListActivePlanPrices() ([]models.PlanPrice, error)
+	GetPrice(planID int, currency string) (float64, error)
+	SetPrice(planID int, currency string, amount float64) error
+	DeletePrice(planID int, currency string) error
+	SetFeatures(planID int, features models.PlanFeatures) error
+	GetLenderFeatures(lenderID int) (models.PlanFeatures, error)
+}
+
+// planRepository implements PlanRepository using a SQLite database connection.
+type planRepository struct {
+	db *sql.DB
+}
+
+// NewPlanRepository creates a new PlanRepository instance.
+func NewPlanRepository(db *sql.DB) PlanRepository {
+	return &planRepository{db: db}
+}
+
+// ListActivePlans returns every plan that can currently be subscribed to.
+func (r *planRepository) ListActivePlans() ([]models.Plan, error) {
+	return r.queryPlans(`SELECT Plan_ID, Plan, Price, Is_Trial, Trial_Days, Features, Created_At, Updated_At, Is_Active FROM Plans WHERE Is_Active = 1 ORDER BY Plan_ID`)
+}
+
+// ListAllPlans returns every plan, active or not, for managing the catalog.
+func (r *planRepository) ListAllPlans() ([]models.Plan, error) {
+	return r.queryPlans(`SELECT Plan_ID, Plan, Price, Is_Trial, Trial_Days, Features, Created_At, Updated_At, Is_Active FROM Plans ORDER BY Plan_ID`)
+}
+
+// CreatePlan inserts the plan and sets its ID and timestamps.
+func (r *planRepository) CreatePlan(plan *models.Plan) error {
+	now := time.Now().UTC()
+	res, err := r.db.Exec(`INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days, Features, Created_At, Updated_At, Is_Active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		plan.Plan, plan.Price, plan.IsTrial, plan.TrialDays, plan.Features, now, now, plan.IsActive)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	plan.PlanID = int(id)
+	plan.CreatedAt, plan.UpdatedAt = models.NewJSONTime(now), models.NewJSONTime(now)
+	return nil
+}
+
+// UpdatePlan applies a partial update to a plan, such as activating or deactivating it.
+// Deactivated plans are left out of ListActivePlans; existing subscriptions keep them.
+func (r *planRepository) UpdatePlan(planID int, update models.PlanUpdate) error {
+	res, err := r.db.Exec(`UPDATE Plans SET
+			Plan = COALESCE(?, Plan),
+			Price = COALESCE(?, Price),
+			Trial_Days = COALESCE(?, Trial_Days),
+			Is_Active = COALESCE(?, Is_Active),
+			Updated_At = ?
+		WHERE Plan_ID = ?`,
+		update.Plan, update.Price, update.TrialDays, update.IsActive, time.Now().UTC(), planID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+// queryPlans scans Plans rows returned by query.
+func (r *planRepository) queryPlans(query string, args ...any) ([]models.Plan, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []models.Plan
+	for rows.Next() {
+		var plan models.Plan
+		if err := rows.Scan(
+			&plan.PlanID,
+			&plan.Plan,
+			&plan.Price,
+			&plan.IsTrial,
+			&plan.TrialDays,
+			&plan.Features,
+			&plan.CreatedAt,
+			&plan.UpdatedAt,
+			&plan.IsActive,
+		); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// GetPlanByID retrieves a plan by its ID.
+func (r *planRepository) GetPlanByID(planID int) (*models.Plan, error) {
+	var plan models.Plan
+	query := `SELECT Plan_ID, Plan, Price, Is_Trial, Trial_Days, Features, Created_At, Updated_At, Is_Active FROM Plans WHERE Plan_ID = ?`
+	err := r.db.QueryRow(query, planID).Scan(
+		&plan.PlanID,
+		&plan.Plan,
+		&plan.Price,
+		&plan.IsTrial,
+		&plan.TrialDays,
+		&plan.Features,
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+		&plan.IsActive,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ListPrices returns every per-currency price of a plan.
+func (r *planRepository) ListPrices(planID int) ([]models.PlanPrice, error) {
+	return r.queryPrices(`SELECT Plan_Price_ID, Plan_ID, Currency, Amount, Created_At, Updated_At
+		FROM Plan_Prices WHERE Plan_ID = ? ORDER BY Currency`, planID)
+}
+
+// ListActivePlanPrices returns the per-currency prices of every active plan.
+func (r *planRepository) ListActivePlanPrices() ([]models.PlanPrice, error) {
+	return r.queryPrices(`SELECT pp.Plan_Price_ID, pp.Plan_ID, pp.Currency, pp.Amount, pp.Created_At, pp.Updated_At
+		FROM Plan_Prices pp JOIN Plans p ON p.Plan_ID = pp.Plan_ID
+		WHERE p.Is_Active = 1 ORDER BY pp.Plan_ID, pp.Currency`)
+}
+
+// GetPrice returns the plan's price in the given currency, falling back to the deprecated
+// Plans.Price column when no Plan_Prices row exists for that currency.
+func (r *planRepository) GetPrice(planID int, currency string) (float64, error) {
+	return resolvePlanPrice(context.Background(), r.db, planID, currency)
+}
+
+// SetPrice creates or updates the plan's price in the given currency.
+func (r *planRepository) SetPrice(planID int, currency string, amount float64) error {
+	if _, err := r.GetPlanByID(planID); err != nil {
+		return err
+	}
+	_, err := r.db.Exec(`INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) VALUES (?, ?, ?)
+		ON CONFLICT (Plan_ID, Currency) DO UPDATE SET Amount = excluded.Amount`, planID, currency, amount)
+	return err
+}
+
+// DeletePrice removes the plan's price in the given currency.
+func (r *planRepository) DeletePrice(planID int, currency string) error {
+	res, err := r.db.Exec("DELETE FROM Plan_Prices WHERE Plan_ID = ? AND Currency = ?", planID, currency)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPlanPriceNotFound
+	}
+	return nil
+}
+
+// queryPrices scans Plan_Prices rows returned by query.
+func (r *planRepository) queryPrices(query string, args ...any) ([]models.PlanPrice, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []models.PlanPrice
+	for rows.Next() {
+		var price models.PlanPrice
+		if err := rows.Scan(
+			&price.PlanPriceID,
+			&price.PlanID,
+			&price.Currency,
+			&price.Amount,
+			&price.CreatedAt,
+			&price.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+	return prices, rows.Err()
+}
+
+// resolvePlanPrice looks up a plan's price in a currency with the Plans.Price fallback.
+func resolvePlanPrice(ctx context.Context, q DBTX, planID int, currency string) (float64, error) {
+	var amount float64
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(
+			(SELECT Amount FROM Plan_Prices WHERE Plan_ID = p.Plan_ID AND Currency = ?),
+			p.Price)
+		FROM Plans p WHERE p.Plan_ID = ?`, currency, planID).Scan(&amount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrPlanNotFound
+		}
+		return 0, err
+	}
+	return amount, nil
+}
+
+// SetFeatures replaces the plan's feature flags and limits.
+func (r *planRepository) SetFeatures(planID int, features models.PlanFeatures) error {
+	res, err := r.db.Exec("UPDATE Plans SET Features = ? WHERE Plan_ID = ?", features, planID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+// GetLenderFeatures returns the features of the plan on the lender's most recent ledger row.
+// Lenders that have never subscribed get no features.
+func (r *planRepository) GetLenderFeatures(lenderID int) (models.PlanFeatures, error) {
+	var features models.PlanFeatures
+	err := r.db.QueryRow(`SELECT p.Features FROM Lender_Ledger l JOIN Plans p ON p.Plan_ID = l.Plan_ID
+		WHERE l.Lender_ID = ? ORDER BY l.Start_Date DESC, l.Ledger_ID DESC LIMIT 1`, lenderID).Scan(&features)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.PlanFeatures{}, err
+	}
+	return features, nil
+}
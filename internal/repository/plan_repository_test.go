@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// seedPlan inserts an active plan with a legacy single price and returns its ID.
+func seedPlan(t *testing.T, db *sql.DB, name string, price float64) int {
+	res, err := db.Exec("INSERT INTO Plans (Plan, Price) VALUES (?, ?)", name, price)
+	if err != nil {
+		t.Fatalf("Failed to seed plan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestPlanPrices(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewPlanRepository(db)
+	planID := seedPlan(t, db, "Premium", 300)
+
+	// Test case 1: Falls back to the deprecated Price without a Plan_Prices row
+	price, err := repo.GetPrice(planID, "ZAR")
+	if err != nil {
+		t.Fatalf("GetPrice failed: %v", err)
+	}
+	if price != 300 {
+		t.Errorf("Expected fallback price 300, got %.2f", price)
+	}
+
+	// Test case 2: Per-currency prices are used once set, and can be updated
+	if err := repo.SetPrice(planID, "ZAR", 280); err != nil {
+		t.Fatalf("SetPrice failed: %v", err)
+	}
+	if err := repo.SetPrice(planID, "ZAR", 290); err != nil {
+		t.Fatalf("SetPrice update failed: %v", err)
+	}
+	if err := repo.SetPrice(planID, "LSL", 300); err != nil {
+		t.Fatalf("SetPrice failed: %v", err)
+	}
+	price, _ = repo.GetPrice(planID, "ZAR")
+	if price != 290 {
+		t.Errorf("Expected ZAR price 290, got %.2f", price)
+	}
+
+	prices, err := repo.ListPrices(planID)
+	if err != nil {
+		t.Fatalf("ListPrices failed: %v", err)
+	}
+	if len(prices) != 2 || prices[0].Currency != "LSL" || prices[1].Currency != "ZAR" {
+		t.Errorf("Expected LSL and ZAR prices, got %+v", prices)
+	}
+
+	// Test case 3: Deleting a price
+	if err := repo.DeletePrice(planID, "ZAR"); err != nil {
+		t.Fatalf("DeletePrice failed: %v", err)
+	}
+	if err := repo.DeletePrice(planID, "ZAR"); !errors.Is(err, ErrPlanPriceNotFound) {
+		t.Errorf("Expected ErrPlanPriceNotFound, got %v", err)
+	}
+
+	// Test case 4: Unknown plan
+	if err := repo.SetPrice(99999, "LSL", 10); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("Expected ErrPlanNotFound, got %v", err)
+	}
+	if _, err := repo.GetPrice(99999, "LSL"); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("Expected ErrPlanNotFound, got %v", err)
+	}
+}
+
+func TestListActivePlans(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewPlanRepository(db)
+	seedPlan(t, db, "Basic", 100)
+	retiredID := seedPlan(t, db, "Retired", 50)
+	db.Exec("UPDATE Plans SET Is_Active = 0 WHERE Plan_ID = ?", retiredID)
+
+	plans, err := repo.ListActivePlans()
+	if err != nil {
+		t.Fatalf("ListActivePlans failed: %v", err)
+	}
+	if len(plans) != 1 || plans[0].Plan != "Basic" {
+		t.Errorf("Expected only the Basic plan, got %+v", plans)
+	}
+}
+
+func TestCreateAndUpdatePlan(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewPlanRepository(db)
+
+	// Test case 1: A created plan gets an ID and is listed as active
+	plan := models.Plan{Plan: "Growth", Price: 250, Features: models.PlanFeatures{MaxUsers: 5}, IsActive: true}
+	if err := repo.CreatePlan(&plan); err != nil {
+		t.Fatalf("CreatePlan failed: %v", err)
+	}
+	if plan.PlanID == 0 || plan.CreatedAt.IsZero() {
+		t.Fatalf("Expected the ID and timestamps to be set, got %+v", plan)
+	}
+	stored, err := repo.GetPlanByID(plan.PlanID)
+	if err != nil || stored.Price != 250 || stored.Features.MaxUsers != 5 || !stored.IsActive {
+		t.Fatalf("Unexpected stored plan: %+v, %v", stored, err)
+	}
+
+	// Test case 2: Deactivating leaves other fields alone and hides it from the active list only
+	inactive := false
+	if err := repo.UpdatePlan(plan.PlanID, models.PlanUpdate{IsActive: &inactive}); err != nil {
+		t.Fatalf("UpdatePlan failed: %v", err)
+	}
+	stored, _ = repo.GetPlanByID(plan.PlanID)
+	if stored.IsActive || stored.Plan != "Growth" || stored.Price != 250 {
+		t.Errorf("Unexpected plan after deactivating: %+v", stored)
+	}
+	active, _ := repo.ListActivePlans()
+	all, err := repo.ListAllPlans()
+	if err != nil {
+		t.Fatalf("ListAllPlans failed: %v", err)
+	}
+	if len(active) != 0 || len(all) != 1 {
+		t.Errorf("Expected 0 active and 1 plan in total, got %d and %d", len(active), len(all))
+	}
+
+	// Test case 3: Unknown plan
+	if err := repo.UpdatePlan(9999, models.PlanUpdate{IsActive: &inactive}); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("Expected ErrPlanNotFound, got %v", err)
+	}
+}
+
+func TestCreateSubscription_SnapshotsPrice(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	plans := NewPlanRepository(db)
+	ledgers := NewLedgerRepository(db)
+	planID := seedPlan(t, db, "Basic", 100)
+	lenderID := seedLender(t, db, "subscriber")
+	if err := plans.SetPrice(planID, "ZAR", 95); err != nil {
+		t.Fatalf("SetPrice failed: %v", err)
+	}
+
+	start := time.Now()
+	sub, err := ledgers.CreateSubscription(context.Background(), lenderID, planID, "ZAR", start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if sub.ChargedCurrency.String != "ZAR" || sub.ChargedAmount.Float64 != 95 {
+		t.Errorf("Expected ZAR 95 snapshot, got %v %v", sub.ChargedCurrency, sub.ChargedAmount)
+	}
+
+	// A later price change does not alter the snapshot
+	plans.SetPrice(planID, "ZAR", 120)
+	sub, _ = ledgers.GetCurrentSubscription(context.Background(), lenderID)
+	if sub.ChargedAmount.Float64 != 95 {
+		t.Errorf("Expected snapshot to stay at 95, got %.2f", sub.ChargedAmount.Float64)
+	}
+}
+
+func TestLedgerRows_SnapshotLenderCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	plans := NewPlanRepository(db)
+	ledgers := NewLedgerRepository(db)
+	trialID := seedTrialPlan(t, db, 14)
+	freeID := seedPlan(t, db, "Free", 0)
+	if err := plans.SetPrice(trialID, "ZAR", 0); err != nil {
+		t.Fatalf("SetPrice failed: %v", err)
+	}
+	accountID, err := NewAuthRepository(db).CreateLenderAndAccount("Rand Business", "rand@example.com", "123", "rand", "hash", 5.0, "ZAR")
+	if err != nil {
+		t.Fatalf("CreateLenderAndAccount failed: %v", err)
+	}
+	lender, _ := NewAuthRepository(db).GetLenderByAccountID(accountID)
+
+	// Test case 1: The trial started at registration is snapshotted in the lender's currency
+	sub, err := ledgers.GetCurrentSubscription(context.Background(), lender.LenderID)
+	if err != nil {
+		t.Fatalf("GetCurrentSubscription failed: %v", err)
+	}
+	if sub.PlanID != trialID || sub.ChargedCurrency.String != "ZAR" || !sub.ChargedAmount.Valid {
+		t.Errorf("Expected a ZAR trial snapshot, got %+v", sub)
+	}
+
+	// Test case 2: So is the free plan a cancellation falls back to
+	sub, err = ledgers.CancelSubscription(context.Background(), sub.LedgerID, "admin", "")
+	if err != nil {
+		t.Fatalf("CancelSubscription failed: %v", err)
+	}
+	if sub.PlanID != freeID || sub.ChargedCurrency.String != "ZAR" || !sub.ChargedAmount.Valid || sub.EndDate.Valid {
+		t.Errorf("Expected an open-ended ZAR free plan snapshot, got %+v", sub)
+	}
+}
+
+func TestPlanFeatures(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewPlanRepository(db)
+	ledgers := NewLedgerRepository(db)
+	planID := seedPlan(t, db, "Pro", 500)
+	lenderID := seedLender(t, db, "featurelender")
+
+	// Test case 1: Lenders without a subscription get no features
+	features, err := repo.GetLenderFeatures(lenderID)
+	if err != nil {
+		t.Fatalf("GetLenderFeatures failed: %v", err)
+	}
+	if features != (models.PlanFeatures{}) {
+		t.Errorf("Expected no features, got %+v", features)
+	}
+
+	// Test case 2: Features stored on the plan are resolved through the ledger
+	want := models.PlanFeatures{BulkImport: true, MaxActiveLoans: 100}
+	if err := repo.SetFeatures(planID, want); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	ledgers.CreateSubscription(context.Background(), lenderID, planID, "LSL", time.Now(), time.Now().AddDate(0, 1, 0))
+	features, err = repo.GetLenderFeatures(lenderID)
+	if err != nil {
+		t.Fatalf("GetLenderFeatures failed: %v", err)
+	}
+	if features != want || !features.Has(models.FeatureBulkImport) || features.Has("unknown") {
+		t.Errorf("Expected %+v, got %+v", want, features)
+	}
+
+	// Test case 3: Unknown plan
+	if err := repo.SetFeatures(9999, want); !errors.Is(err, ErrPlanNotFound) {
+		t.Errorf("Expected ErrPlanNotFound, got %v", err)
+	}
+}
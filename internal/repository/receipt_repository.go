@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrDuplicateTransactionReference = errors.New("transaction reference already used by this lender")
+	ErrReceiptNotFound               = errors.New("receipt not found")
+)
+
+// ReceiptFilter narrows and pages the receipts of a loan
+type ReceiptFilter struct {
+	Status string
+	Limit  int
+	Offset int
+}
+
+// ReceiptRepository defines the interface for receipt-related database operations.
+type ReceiptRepository interface {
+	CreateReceipt(lenderID int, receipt *models.Receipt) (int, error)
+	GetReceipt(lenderID, receiptID int) (*models.Receipt, error)
+	ListReceipts(lenderID, loanID int, filter ReceiptFilter) ([]models.Receipt, int, error)
+}
+
+// receiptRepository implements ReceiptRepository using a SQLite database connection.
+type receiptRepository struct {
+	db *sql.DB
+}
+
+// NewReceiptRepository creates a new ReceiptRepository instance.
+func NewReceiptRepository(db *sql.DB) ReceiptRepository {
+	return &receiptRepository{db: db}
+}
+
+// CreateReceipt records a payment against one of the lender's loans. The lender is stored on the
+// receipt so that Transaction_Reference only has to be unique within a lender; reusing a reference
+// within the same lender returns ErrDuplicateTransactionReference. Paid receipts are allocated to
+// the loan's principal and interest in the same transaction.
+func (r *receiptRepository) CreateReceipt(lenderID int, receipt *models.Receipt) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var loanLenderID int
+	err = tx.QueryRow("SELECT Lender_ID FROM Loans WHERE Loan_ID = ?", receipt.LoanID).Scan(&loanLenderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrLoanNotFound
+		}
+		return 0, err
+	}
+	if loanLenderID != lenderID {
+		return 0, ErrLoanNotFound
+	}
+
+	timestamp := receipt.Timestamp.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+
+	res, err := tx.Exec(`INSERT INTO Recipets (Loan_ID, Lender_ID, Timestamp, Status, Amount, Payment_Method, Transaction_Reference, Notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		receipt.LoanID, lenderID, timestamp, receipt.Status, receipt.Amount,
+		receipt.PaymentMethod, receipt.TransactionReference, receipt.Notes)
+	if err != nil {
+		if isUniqueViolation(err, dbDriver) {
+			return 0, ErrDuplicateTransactionReference
+		}
+		return 0, err
+	}
+
+	receiptID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if receipt.Status == "paid" {
+		if err := allocateReceipt(context.Background(), tx, int(receiptID), receipt.LoanID, lenderID, receipt.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return int(receiptID), tx.Commit()
+}
+
+// allocateReceipt splits a paid receipt as migration 21 split those recorded before it: principal
+// first, then the interest scheduled above it, with anything paid beyond both counted as principal
+func allocateReceipt(ctx context.Context, q DBTX, receiptID, loanID, lenderID int, amount float64) error {
+	var principalDue, rate, paidBefore float64
+	var months int
+	var payment sql.NullFloat64
+	err := q.QueryRowContext(ctx, `SELECT lo.Amount, lo.Interest_Rate, lo.Months_To_Pay, lo.Monthly_Payment,
+			(SELECT COALESCE(SUM(Principal + Interest + Penalties), 0) FROM Receipt_Allocations WHERE Loan_ID = lo.Loan_ID)
+		FROM Loans lo WHERE lo.Loan_ID = ?`, loanID).Scan(&principalDue, &rate, &months, &payment, &paidBefore)
+	if err != nil {
+		return err
+	}
+	interestDue := max(finance.Instalment(payment, principalDue, rate, months)*float64(months)-principalDue, 0)
+	interestPaid := func(paid float64) float64 { return min(max(paid-principalDue, 0), interestDue) }
+	interest := interestPaid(paidBefore+amount) - interestPaid(paidBefore)
+
+	_, err = q.ExecContext(ctx, `INSERT INTO Receipt_Allocations (Recipet_ID, Loan_ID, Lender_ID, Principal, Interest, Penalties)
+		VALUES (?, ?, ?, ?, ?, 0)`, receiptID, loanID, lenderID, amount-interest, interest)
+	return err
+}
+
+// receiptColumns selects the Receipt fields in scan order
+const receiptColumns = "Recipet_ID, Loan_ID, Lender_ID, Timestamp, Status, Amount, Payment_Method, Transaction_Reference, Notes"
+
+// scanReceipt scans a row selected with receiptColumns
+func scanReceipt(row interface{ Scan(dest ...any) error }) (models.Receipt, error) {
+	var r models.Receipt
+	err := row.Scan(&r.ReceiptID, &r.LoanID, &r.LenderID, &r.Timestamp, &r.Status, &r.Amount,
+		&r.PaymentMethod, &r.TransactionReference, &r.Notes)
+	return r, err
+}
+
+// GetReceipt returns one of the lender's receipts.
+func (r *receiptRepository) GetReceipt(lenderID, receiptID int) (*models.Receipt, error) {
+	receipt, err := scanReceipt(r.db.QueryRow("SELECT "+receiptColumns+" FROM Recipets WHERE Recipet_ID = ? AND Lender_ID = ?", receiptID, lenderID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReceiptNotFound
+		}
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// ListReceipts returns one page of the receipts on one of the lender's loans, newest first, and the
+// total matching the filter. A loan of another lender returns ErrLoanNotFound.
+func (r *receiptRepository) ListReceipts(lenderID, loanID int, filter ReceiptFilter) ([]models.Receipt, int, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM Loans WHERE Loan_ID = ? AND Lender_ID = ?)", loanID, lenderID).Scan(&exists)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !exists {
+		return nil, 0, ErrLoanNotFound
+	}
+
+	where := " WHERE Loan_ID = ? AND Lender_ID = ?"
+	args := []any{loanID, lenderID}
+	if filter.Status != "" {
+		where += " AND Status = ?"
+		args = append(args, filter.Status)
+	}
+
+	var total int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM Recipets"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query("SELECT "+receiptColumns+" FROM Recipets"+where+" ORDER BY Timestamp DESC, Recipet_ID DESC LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	receipts := []models.Receipt{}
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, total, rows.Err()
+}
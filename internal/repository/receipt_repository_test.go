@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func newTestReceipt(loanID int, reference string) *models.Receipt {
+	return &models.Receipt{
+		LoanID:               loanID,
+		Status:               "paid",
+		Amount:               250,
+		TransactionReference: sql.NullString{String: reference, Valid: reference != ""},
+	}
+}
+
+func TestCreateReceipt_ReferenceUniquePerLender(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewReceiptRepository(db)
+	lenderA := seedLender(t, db, "lendera")
+	lenderB := seedLender(t, db, "lenderb")
+	borrowerID := seedBorrower(t, db, "payer@example.com")
+	loanA := seedLoan(t, db, lenderA, borrowerID, "active", 1000, 10, 6)
+	loanB := seedLoan(t, db, lenderB, borrowerID, "active", 1000, 10, 6)
+
+	// Test case 1: Two lenders can use the same reference
+	if _, err := repo.CreateReceipt(lenderA, newTestReceipt(loanA, "MPESA-123")); err != nil {
+		t.Fatalf("CreateReceipt for lender A failed: %v", err)
+	}
+	if _, err := repo.CreateReceipt(lenderB, newTestReceipt(loanB, "MPESA-123")); err != nil {
+		t.Fatalf("CreateReceipt for lender B with the same reference failed: %v", err)
+	}
+
+	// Test case 2: One lender cannot reuse a reference, even on another loan
+	loanA2 := seedLoan(t, db, lenderA, borrowerID, "active", 500, 10, 6)
+	_, err := repo.CreateReceipt(lenderA, newTestReceipt(loanA2, "MPESA-123"))
+	if !errors.Is(err, ErrDuplicateTransactionReference) {
+		t.Errorf("Expected ErrDuplicateTransactionReference, got %v", err)
+	}
+
+	// Test case 3: Receipts without a reference never collide
+	for i := 0; i < 2; i++ {
+		if _, err := repo.CreateReceipt(lenderA, newTestReceipt(loanA, "")); err != nil {
+			t.Errorf("CreateReceipt without a reference failed: %v", err)
+		}
+	}
+}
+
+func TestCreateReceipt_LoanOfAnotherLender(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewReceiptRepository(db)
+	lenderA := seedLender(t, db, "ownera")
+	lenderB := seedLender(t, db, "ownerb")
+	borrowerID := seedBorrower(t, db, "other@example.com")
+	loanB := seedLoan(t, db, lenderB, borrowerID, "active", 1000, 10, 6)
+
+	_, err := repo.CreateReceipt(lenderA, newTestReceipt(loanB, "REF-1"))
+	if !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+
+	_, err = repo.CreateReceipt(lenderA, newTestReceipt(99999, "REF-1"))
+	if !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound for a missing loan, got %v", err)
+	}
+}
+
+func TestGetReceiptAndStatement(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	receipts := NewReceiptRepository(db)
+	loans := NewLoanRepository(db)
+	lenderA := seedLender(t, db, "statementa")
+	lenderB := seedLender(t, db, "statementb")
+	borrowerID := seedBorrower(t, db, "statement@example.com")
+	loanID := seedLoan(t, db, lenderA, borrowerID, "active", 1000, 10, 6)
+
+	paidID, err := receipts.CreateReceipt(lenderA, newTestReceipt(loanID, "REF-1"))
+	if err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+	failed := newTestReceipt(loanID, "REF-2")
+	failed.Status, failed.Amount = "failed", 100
+	if _, err := receipts.CreateReceipt(lenderA, failed); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+
+	// Test case 1: A receipt is found only by its own lender
+	receipt, err := receipts.GetReceipt(lenderA, paidID)
+	if err != nil {
+		t.Fatalf("GetReceipt failed: %v", err)
+	}
+	if receipt.LoanID != loanID || receipt.Amount != 250 || receipt.TransactionReference.String != "REF-1" {
+		t.Errorf("Unexpected receipt: %+v", receipt)
+	}
+	if _, err := receipts.GetReceipt(lenderB, paidID); !errors.Is(err, ErrReceiptNotFound) {
+		t.Errorf("Expected ErrReceiptNotFound, got %v", err)
+	}
+
+	// Test case 2: The statement lists every receipt but only counts paid ones
+	st, err := loans.GetStatement(lenderA, loanID)
+	if err != nil {
+		t.Fatalf("GetStatement failed: %v", err)
+	}
+	if st.Loan.LoanID != loanID || st.BorrowerName == "" || len(st.Receipts) != 2 || st.TotalPaid != 250 {
+		t.Errorf("Unexpected statement: %+v", st)
+	}
+	if _, err := loans.GetStatement(lenderB, loanID); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	receipts := NewReceiptRepository(db)
+	lenderID := seedLender(t, db, "receiptlister")
+	otherID := seedLender(t, db, "otherreceiptlister")
+	borrowerID := seedBorrower(t, db, "receiptlister@example.com")
+	loanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	otherLoanID := seedLoan(t, db, lenderID, borrowerID, "active", 1000, 10, 12)
+	for _, status := range []string{"paid", "refunded", "paid"} {
+		if _, err := receipts.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: status, Amount: 100}); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+	receipts.CreateReceipt(lenderID, &models.Receipt{LoanID: otherLoanID, Status: "paid", Amount: 100})
+
+	// Test case 1: Only the loan's receipts with the status, counted before paging
+	list, total, err := receipts.ListReceipts(lenderID, loanID, ReceiptFilter{Status: "paid", Limit: 1})
+	if err != nil {
+		t.Fatalf("ListReceipts failed: %v", err)
+	}
+	if total != 2 || len(list) != 1 || list[0].LoanID != loanID || list[0].Status != "paid" {
+		t.Errorf("Expected 1 of 2 paid receipts, got %d: %+v", total, list)
+	}
+
+	// Test case 2: A loan without matching receipts is an empty list
+	list, total, _ = receipts.ListReceipts(lenderID, loanID, ReceiptFilter{Status: "failed", Limit: 10})
+	if total != 0 || list == nil || len(list) != 0 {
+		t.Errorf("Expected an empty list, got %d: %+v", total, list)
+	}
+
+	// Test case 3: Another lender's loan is not found
+	if _, _, err := receipts.ListReceipts(otherID, loanID, ReceiptFilter{Limit: 10}); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("Expected ErrLoanNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrReportSubscriptionNotFound = errors.New("report subscription not found")
+)
+
+// ReportSubscriptionRepository defines the interface for the month-end reports lenders have emailed
+type ReportSubscriptionRepository interface {
+	Get(lenderID int) (*models.ReportSubscription, error)
+	Upsert(sub models.ReportSubscription) error
+	Delete(lenderID int) error
+	ListEnabled() ([]models.ReportSubscription, error)
+}
+
+// reportSubscriptionRepository implements ReportSubscriptionRepository using a SQLite database connection.
+type reportSubscriptionRepository struct {
+	db *sql.DB
+}
+
+// NewReportSubscriptionRepository creates a new ReportSubscriptionRepository instance.
+func NewReportSubscriptionRepository(db *sql.DB) ReportSubscriptionRepository {
+	return &reportSubscriptionRepository{db: db}
+}
+
+// reportSubscriptionColumns are read by scanReportSubscription, from Report_Subscriptions joined to Lenders
+const reportSubscriptionColumns = `rs.Lender_ID, rs.Reports, rs.Format, rs.Recipients, rs.Enabled, l.Timezone, rs.Updated_At
+	FROM Report_Subscriptions rs JOIN Lenders l ON l.Lender_ID = rs.Lender_ID`
+
+// Get returns a lender's report subscription.
+func (r *reportSubscriptionRepository) Get(lenderID int) (*models.ReportSubscription, error) {
+	sub, err := scanReportSubscription(r.db.QueryRow("SELECT "+reportSubscriptionColumns+" WHERE rs.Lender_ID = ?", lenderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReportSubscriptionNotFound
+	}
+	return sub, err
+}
+
+// Upsert creates or replaces a lender's report subscription.
+func (r *reportSubscriptionRepository) Upsert(sub models.ReportSubscription) error {
+	_, err := r.db.Exec(`INSERT INTO Report_Subscriptions (Lender_ID, Reports, Format, Recipients, Enabled) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (Lender_ID) DO UPDATE SET Reports = excluded.Reports, Format = excluded.Format,
+			Recipients = excluded.Recipients, Enabled = excluded.Enabled, Updated_At = CURRENT_TIMESTAMP`,
+		sub.LenderID, strings.Join(sub.Reports, ","), sub.Format, strings.Join(sub.Recipients, ","), sub.Enabled)
+	return err
+}
+
+// Delete removes a lender's report subscription. Emails already queued are still sent.
+func (r *reportSubscriptionRepository) Delete(lenderID int) error {
+	result, err := r.db.Exec("DELETE FROM Report_Subscriptions WHERE Lender_ID = ?", lenderID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrReportSubscriptionNotFound
+	}
+	return nil
+}
+
+// ListEnabled returns every enabled report subscription with its lender's time zone.
+func (r *reportSubscriptionRepository) ListEnabled() ([]models.ReportSubscription, error) {
+	rows, err := r.db.Query("SELECT " + reportSubscriptionColumns + " WHERE rs.Enabled = 1 ORDER BY rs.Lender_ID")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.ReportSubscription
+	for rows.Next() {
+		sub, err := scanReportSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// scanReportSubscription reads the reportSubscriptionColumns of one row
+func scanReportSubscription(row interface{ Scan(dest ...any) error }) (*models.ReportSubscription, error) {
+	var sub models.ReportSubscription
+	var reports, recipients string
+	if err := row.Scan(&sub.LenderID, &reports, &sub.Format, &recipients, &sub.Enabled, &sub.Timezone, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sub.Reports = strings.Split(reports, ",")
+	sub.Recipients = strings.Split(recipients, ",")
+	return &sub, nil
+}
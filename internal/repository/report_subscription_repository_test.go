@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestReportSubscriptions(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	repo := NewReportSubscriptionRepository(db)
+	lenderID := seedLender(t, db, "subscriber")
+	otherID := seedLender(t, db, "othersubscriber")
+	db.Exec("UPDATE Lenders SET Timezone = 'Africa/Maseru' WHERE Lender_ID = ?", lenderID)
+
+	// Test case 1: A lender without a subscription
+	if _, err := repo.Get(lenderID); !errors.Is(err, ErrReportSubscriptionNotFound) {
+		t.Errorf("Expected ErrReportSubscriptionNotFound, got %v", err)
+	}
+
+	// Test case 2: Lists are read back with the lender's time zone
+	sub := models.ReportSubscription{LenderID: lenderID, Reports: []string{models.ReportPortfolio, models.ReportIncome},
+		Format: "xlsx", Recipients: []string{"owner@example.com", "accounts@example.com"}, Enabled: true}
+	if err := repo.Upsert(sub); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	got, err := repo.Get(lenderID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !slices.Equal(got.Reports, sub.Reports) || !slices.Equal(got.Recipients, sub.Recipients) || got.Format != "xlsx" || !got.Enabled || got.Timezone != "Africa/Maseru" {
+		t.Errorf("Unexpected subscription: %+v", got)
+	}
+
+	// Test case 3: Only enabled subscriptions are listed, and an upsert replaces the subscription
+	repo.Upsert(models.ReportSubscription{LenderID: otherID, Reports: []string{models.ReportIncome}, Format: "csv", Recipients: []string{"other@example.com"}})
+	subs, err := repo.ListEnabled()
+	if err != nil {
+		t.Fatalf("ListEnabled failed: %v", err)
+	}
+	if len(subs) != 1 || subs[0].LenderID != lenderID {
+		t.Errorf("Expected only the enabled subscription, got %+v", subs)
+	}
+	sub.Format = "csv"
+	sub.Enabled = false
+	repo.Upsert(sub)
+	if got, _ := repo.Get(lenderID); got.Format != "csv" || got.Enabled {
+		t.Errorf("Expected the subscription replaced, got %+v", got)
+	}
+
+	// Test case 4: Deleting twice reports the subscription missing
+	if err := repo.Delete(lenderID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := repo.Delete(lenderID); !errors.Is(err, ErrReportSubscriptionNotFound) {
+		t.Errorf("Expected ErrReportSubscriptionNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+var (
+	ErrSubscriptionPaymentNotFound = errors.New("subscription payment not found")
+)
+
+// SubscriptionPaymentRepository defines the interface for recording what lenders pay for their subscriptions.
+type SubscriptionPaymentRepository interface {
+	RecordPayment(payment *models.SubscriptionPayment, months int) (*models.SubscriptionPayment, bool, error)
+	GetPaymentByReference(reference string) (*models.SubscriptionPayment, error)
+	ListPayments(from, to time.Time) ([]models.SubscriptionPayment, error)
+}
+
+// subscriptionPaymentRepository implements SubscriptionPaymentRepository using a SQLite database connection.
+type subscriptionPaymentRepository struct {
+	db *sql.DB
+}
+
+// NewSubscriptionPaymentRepository creates a new SubscriptionPaymentRepository instance.
+func NewSubscriptionPaymentRepository(db *sql.DB) SubscriptionPaymentRepository {
+	return &subscriptionPaymentRepository{db: db}
+}
+
+// RecordPayment stores a payment and renews the subscription it pays for in one transaction.
+// Active and suspended ledger rows have their End_Date extended by months; expired and inactive rows
+// are never revived, so a new active row on the same plan, with the plan's price in the payment currency
+// snapshotted, is created and the payment is linked to it.
+// Recording a reference that already exists is a no-op that returns the original payment and false.
+func (r *subscriptionPaymentRepository) RecordPayment(payment *models.SubscriptionPayment, months int) (*models.SubscriptionPayment, bool, error) {
+	if existing, err := r.GetPaymentByReference(payment.Reference); err == nil {
+		return existing, false, nil
+	} else if !errors.Is(err, ErrSubscriptionPaymentNotFound) {
+		return nil, false, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	var lenderID, planID int
+	var status string
+	var endDate sql.NullTime
+	err = tx.QueryRow("SELECT Lender_ID, Plan_ID, Status, End_Date FROM Lender_Ledger WHERE Ledger_ID = ?", payment.LedgerID).
+		Scan(&lenderID, &planID, &status, &endDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrSubscriptionNotFound
+		}
+		return nil, false, err
+	}
+
+	paidAt := payment.PaidAt.UTC()
+	ledgerID := payment.LedgerID
+	switch status {
+	case "active", "suspended":
+		from := paidAt
+		if endDate.Valid && endDate.Time.After(from) {
+			from = endDate.Time.UTC()
+		}
+		if _, err := tx.Exec("UPDATE Lender_Ledger SET End_Date = ? WHERE Ledger_ID = ?", from.AddDate(0, months, 0), ledgerID); err != nil {
+			return nil, false, err
+		}
+	default:
+		if ledgerID, err = insertLedgerRow(context.Background(), tx, lenderID, planID, payment.Currency, paidAt, paidAt.AddDate(0, months, 0)); err != nil {
+			return nil, false, err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO Subscription_Payments (Ledger_ID, Amount, Currency, Method, Reference, Paid_At, Recorded_By, Created_At)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		ledgerID, payment.Amount, payment.Currency, payment.Method, payment.Reference, paidAt, payment.RecordedBy, time.Now().UTC())
+	if err != nil {
+		if isUniqueViolation(err, dbDriver) {
+			// Lost a race with a concurrent delivery of the same reference
+			tx.Rollback()
+			existing, err := r.GetPaymentByReference(payment.Reference)
+			return existing, false, err
+		}
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	recorded, err := r.GetPaymentByReference(payment.Reference)
+	return recorded, true, err
+}
+
+// GetPaymentByReference retrieves a payment by its unique provider or bank reference.
+func (r *subscriptionPaymentRepository) GetPaymentByReference(reference string) (*models.SubscriptionPayment, error) {
+	var payment models.SubscriptionPayment
+	query := `SELECT Payment_ID, Ledger_ID, Amount, Currency, Method, Reference, Paid_At, Recorded_By, Created_At
+		FROM Subscription_Payments WHERE Reference = ?`
+	err := r.db.QueryRow(query, reference).Scan(
+		&payment.PaymentID,
+		&payment.LedgerID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.Method,
+		&payment.Reference,
+		&payment.PaidAt,
+		&payment.RecordedBy,
+		&payment.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSubscriptionPaymentNotFound
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// ListPayments returns payments with Paid_At in [from, to), newest first. Zero times leave that end open.
+func (r *subscriptionPaymentRepository) ListPayments(from, to time.Time) ([]models.SubscriptionPayment, error) {
+	query := `SELECT Payment_ID, Ledger_ID, Amount, Currency, Method, Reference, Paid_At, Recorded_By, Created_At
+		FROM Subscription_Payments WHERE 1 = 1`
+	var args []any
+	if !from.IsZero() {
+		query += " AND Paid_At >= ?"
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		query += " AND Paid_At < ?"
+		args = append(args, to.UTC())
+	}
+	query += " ORDER BY Paid_At DESC, Payment_ID DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.SubscriptionPayment
+	for rows.Next() {
+		var payment models.SubscriptionPayment
+		if err := rows.Scan(
+			&payment.PaymentID,
+			&payment.LedgerID,
+			&payment.Amount,
+			&payment.Currency,
+			&payment.Method,
+			&payment.Reference,
+			&payment.PaidAt,
+			&payment.RecordedBy,
+			&payment.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
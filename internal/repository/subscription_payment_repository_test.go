@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func newTestPayment(ledgerID int, reference string, paidAt time.Time) *models.SubscriptionPayment {
+	return &models.SubscriptionPayment{
+		LedgerID:   ledgerID,
+		Amount:     300,
+		Currency:   "LSL",
+		Method:     "bank_transfer",
+		Reference:  reference,
+		PaidAt:     models.NewJSONTime(paidAt),
+		RecordedBy: "admin",
+	}
+}
+
+func TestRecordPayment_ExtendsActiveSubscription(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ledgers := NewLedgerRepository(db)
+	payments := NewSubscriptionPaymentRepository(db)
+	lenderID := seedLender(t, db, "payer")
+	planID := seedPlan(t, db, "Basic", 300)
+
+	start := time.Now().UTC().Truncate(time.Second)
+	end := start.AddDate(0, 0, 10)
+	sub, err := ledgers.CreateSubscription(context.Background(), lenderID, planID, "LSL", start, end)
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	// Test case 1: Paying before End_Date extends from the current End_Date
+	payment, created, err := payments.RecordPayment(newTestPayment(sub.LedgerID, "EFT-1", start), 1)
+	if err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if !created {
+		t.Error("Expected the payment to be created")
+	}
+	if payment.LedgerID != sub.LedgerID {
+		t.Errorf("Expected payment on ledger %d, got %d", sub.LedgerID, payment.LedgerID)
+	}
+
+	ledger, err := ledgers.GetLedgerByID(context.Background(), sub.LedgerID)
+	if err != nil {
+		t.Fatalf("GetLedgerByID failed: %v", err)
+	}
+	if want := end.AddDate(0, 1, 0); !ledger.EndDate.Time.Equal(want) {
+		t.Errorf("Expected End_Date %v, got %v", want, ledger.EndDate.Time)
+	}
+
+	// Test case 2: Re-recording the same reference is a no-op
+	again, created, err := payments.RecordPayment(newTestPayment(sub.LedgerID, "EFT-1", start), 1)
+	if err != nil {
+		t.Fatalf("Duplicate RecordPayment failed: %v", err)
+	}
+	if created {
+		t.Error("Expected a duplicate reference not to create a payment")
+	}
+	if again.PaymentID != payment.PaymentID {
+		t.Errorf("Expected original payment %d, got %d", payment.PaymentID, again.PaymentID)
+	}
+	ledger, _ = ledgers.GetLedgerByID(context.Background(), sub.LedgerID)
+	if want := end.AddDate(0, 1, 0); !ledger.EndDate.Time.Equal(want) {
+		t.Errorf("Expected End_Date to stay %v, got %v", want, ledger.EndDate.Time)
+	}
+}
+
+func TestRecordPayment_ExpiredSubscriptionStartsNewRow(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ledgers := NewLedgerRepository(db)
+	payments := NewSubscriptionPaymentRepository(db)
+	lenderID := seedLender(t, db, "lapsed")
+	planID := seedPlan(t, db, "Basic", 300)
+
+	start := time.Now().UTC().AddDate(0, -2, 0)
+	sub, err := ledgers.CreateSubscription(context.Background(), lenderID, planID, "LSL", start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if err := ledgers.TransitionStatus(context.Background(), sub.LedgerID, "active", "expired", "system", ""); err != nil {
+		t.Fatalf("TransitionStatus failed: %v", err)
+	}
+
+	paidAt := time.Now().UTC().Truncate(time.Second)
+	payment, created, err := payments.RecordPayment(newTestPayment(sub.LedgerID, "EFT-2", paidAt), 3)
+	if err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if !created {
+		t.Error("Expected the payment to be created")
+	}
+	if payment.LedgerID == sub.LedgerID {
+		t.Error("Expected the payment to be linked to a new ledger row")
+	}
+
+	old, _ := ledgers.GetLedgerByID(context.Background(), sub.LedgerID)
+	if old.Status != "expired" {
+		t.Errorf("Expected the old row to stay expired, got %s", old.Status)
+	}
+
+	current, err := ledgers.GetCurrentSubscription(context.Background(), lenderID)
+	if err != nil {
+		t.Fatalf("GetCurrentSubscription failed: %v", err)
+	}
+	if current.LedgerID != payment.LedgerID || current.Status != "active" || current.PlanID != planID {
+		t.Errorf("Expected new active row %d on plan %d, got %+v", payment.LedgerID, planID, current)
+	}
+	if want := paidAt.AddDate(0, 3, 0); !current.EndDate.Time.Equal(want) {
+		t.Errorf("Expected End_Date %v, got %v", want, current.EndDate.Time)
+	}
+	if current.ChargedCurrency.String != "LSL" || current.ChargedAmount.Float64 != 300 {
+		t.Errorf("Expected the plan's LSL 300 snapshotted, got %v %v", current.ChargedCurrency, current.ChargedAmount)
+	}
+}
+
+func TestListPayments_DateRange(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ledgers := NewLedgerRepository(db)
+	payments := NewSubscriptionPaymentRepository(db)
+	lenderID := seedLender(t, db, "reporter")
+	planID := seedPlan(t, db, "Basic", 300)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sub, err := ledgers.CreateSubscription(context.Background(), lenderID, planID, "LSL", start, start.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	for _, day := range []int{5, 15, 25} {
+		ref := fmt.Sprintf("JAN-%d", day)
+		if _, _, err := payments.RecordPayment(newTestPayment(sub.LedgerID, ref, start.AddDate(0, 0, day-1)), 1); err != nil {
+			t.Fatalf("RecordPayment failed: %v", err)
+		}
+	}
+
+	all, err := payments.ListPayments(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ListPayments failed: %v", err)
+	}
+	if len(all) != 3 || all[0].Reference != "JAN-25" {
+		t.Errorf("Expected 3 payments newest first, got %+v", all)
+	}
+
+	ranged, err := payments.ListPayments(start.AddDate(0, 0, 10), start.AddDate(0, 0, 24))
+	if err != nil {
+		t.Fatalf("ListPayments failed: %v", err)
+	}
+	if len(ranged) != 1 || ranged[0].Reference != "JAN-15" {
+		t.Errorf("Expected only JAN-15 in range, got %+v", ranged)
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, letting context-aware repositories run either
+// on their own connection or inside a transaction supplied by WithTx.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise.
+// Repositories join the transaction through their WithTx method, e.g. ledgers.WithTx(tx), so that
+// writes across several tables commit or roll back together.
+//
+// Inside fn, only use repositories bound to tx: with a single-connection pool such as an in-memory
+// SQLite database, a call through an unbound repository waits for the connection fn is holding.
+func WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error or if Commit fails
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// txContextKey is the context key under which ContextWithTx stores a transaction
+type txContextKey struct{}
+
+// contextTx is what ContextWithTx stores: the transaction and the functions to run once it commits
+type contextTx struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+// ContextWithTx returns a copy of ctx carrying tx. Context-aware repositories that are not bound
+// with WithTx run their queries in it, so a request can span several repositories without
+// threading the transaction through every call. Whoever commits tx calls RunAfterCommit with the
+// returned context.
+func ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, &contextTx{tx: tx})
+}
+
+// TxFromContext returns the transaction stored by ContextWithTx, if any.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	ctxTx, ok := ctx.Value(txContextKey{}).(*contextTx)
+	if !ok || ctxTx.tx == nil {
+		return nil, false
+	}
+	return ctxTx.tx, true
+}
+
+// AfterCommit runs fn once the transaction carried by ctx has committed, or straight away when ctx
+// carries none. fn never runs if the transaction rolls back. Use it for side effects outside the
+// database, such as dropping a cache, that must not be seen before the writes they follow.
+func AfterCommit(ctx context.Context, fn func()) {
+	ctxTx, ok := ctx.Value(txContextKey{}).(*contextTx)
+	if !ok || ctxTx.tx == nil {
+		fn()
+		return
+	}
+	ctxTx.afterCommit = append(ctxTx.afterCommit, fn)
+}
+
+// RunAfterCommit runs, in order, the functions passed to AfterCommit for the transaction ctx
+// carries. Call it once that transaction has committed.
+func RunAfterCommit(ctx context.Context) {
+	ctxTx, ok := ctx.Value(txContextKey{}).(*contextTx)
+	if !ok {
+		return
+	}
+	for _, fn := range ctxTx.afterCommit {
+		fn()
+	}
+	ctxTx.afterCommit = nil
+}
+
+// Conn returns the transaction carried by ctx, or db when there is none.
+func Conn(ctx context.Context, db *sql.DB) DBTX {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// inTx runs fn in the transaction carried by ctx, or in a new one when there is none.
+func inTx(ctx context.Context, db *sql.DB, fn func(q DBTX) error) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(tx)
+	}
+	return WithTx(ctx, db, func(tx *sql.Tx) error { return fn(tx) })
+}
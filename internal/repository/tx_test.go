@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+)
+
+func TestWithTx_RollsBackFirstWriteWhenSecondFails(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ctx := context.Background()
+	ledgers := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "composer")
+	planID := seedPlan(t, db, "Basic", 100)
+	now := time.Now()
+
+	// The subscription is written first, then a plan price that violates its CHECK constraint
+	err := WithTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := ledgers.WithTx(tx).CreateSubscription(ctx, lenderID, planID, "LSL", now, now.AddDate(0, 1, 0)); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) VALUES (?, 'USD', -1)", planID)
+		return err
+	})
+	if err == nil {
+		t.Fatal("Expected the second write to fail")
+	}
+
+	if _, err := ledgers.GetCurrentSubscription(ctx, lenderID); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected the subscription to be rolled back, got %v", err)
+	}
+}
+
+func TestWithTx_TransitionJoinsCallerTransaction(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ctx := context.Background()
+	ledgers := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "transitioner")
+	planID := seedPlan(t, db, "Basic", 100)
+	now := time.Now()
+	sub, err := ledgers.CreateSubscription(ctx, lenderID, planID, "LSL", now, now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	// Test case 1: A failing second transition undoes the first, including its event
+	err = WithTx(ctx, db, func(tx *sql.Tx) error {
+		bound := ledgers.WithTx(tx)
+		if err := bound.TransitionStatus(ctx, sub.LedgerID, "active", "suspended", "admin", "review"); err != nil {
+			return err
+		}
+		return bound.TransitionStatus(ctx, sub.LedgerID, "active", "expired", "system", "")
+	})
+	if !errors.Is(err, ErrLedgerStatusChanged) {
+		t.Fatalf("Expected ErrLedgerStatusChanged, got %v", err)
+	}
+	ledger, _ := ledgers.GetLedgerByID(ctx, sub.LedgerID)
+	if ledger.Status != "active" {
+		t.Errorf("Expected status to be rolled back to 'active', got '%s'", ledger.Status)
+	}
+	if events, _ := ledgers.ListEvents(ctx, sub.LedgerID); len(events) != 0 {
+		t.Errorf("Expected no events after rollback, got %d", len(events))
+	}
+
+	// Test case 2: Both writes commit together
+	err = WithTx(ctx, db, func(tx *sql.Tx) error {
+		bound := ledgers.WithTx(tx)
+		if err := bound.TransitionStatus(ctx, sub.LedgerID, "active", "suspended", "admin", "review"); err != nil {
+			return err
+		}
+		return bound.TransitionStatus(ctx, sub.LedgerID, "suspended", "active", "admin", "cleared")
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+	if events, _ := ledgers.ListEvents(ctx, sub.LedgerID); len(events) != 2 {
+		t.Errorf("Expected 2 events after commit, got %d", len(events))
+	}
+}
+
+// setupSingleConnTestDB is setupTestDB with the pool pinned to one connection, so that a query
+// waiting for a connection held by a transaction blocks instead of opening another one
+func setupSingleConnTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	return db
+}
+
+func TestWithTx_BoundRepositoryDoesNotDeadlock(t *testing.T) {
+	db := setupSingleConnTestDB(t)
+	defer teardownTestDB(db)
+
+	ledgers := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "nodeadlock")
+	seedTrialPlan(t, db, 14)
+
+	// The test database has a single connection, held by the transaction; a bound repository
+	// must reuse it for both its own writes and its follow-up read
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := WithTx(ctx, db, func(tx *sql.Tx) error {
+		sub, err := ledgers.WithTx(tx).StartTrial(ctx, lenderID)
+		if err != nil {
+			return err
+		}
+		if sub.Status != "active" {
+			t.Errorf("Expected an active trial, got '%s'", sub.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+
+	// A cancelled context fails before touching the database
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := WithTx(cancelled, db, func(tx *sql.Tx) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestContextWithTx_LedgerJoinsContextTransaction(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(db)
+
+	ledgers := NewLedgerRepository(db)
+	lenderID := seedLender(t, db, "contexttx")
+	planID := seedPlan(t, db, "Basic", 100)
+	now := time.Now()
+
+	// An unbound repository picks the transaction up from the context, and its rollback undoes the write
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	ctx := ContextWithTx(context.Background(), tx)
+	if _, err := ledgers.CreateSubscription(ctx, lenderID, planID, "LSL", now, now.AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if _, ok := TxFromContext(ctx); !ok {
+		t.Error("Expected the transaction in the context")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if _, err := ledgers.GetCurrentSubscription(context.Background(), lenderID); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected the subscription to be rolled back, got %v", err)
+	}
+	if _, ok := TxFromContext(context.Background()); ok {
+		t.Error("Expected no transaction in a plain context")
+	}
+}
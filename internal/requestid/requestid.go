@@ -0,0 +1,77 @@
+// Package requestid carries the ID of the HTTP request being served, so that log lines and error
+// responses can name it and support can find a lender's failed request in the logs. The ID is
+// stored under chi's request ID key, so chi's middleware can read it too.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Header carries the request ID, both from the load balancer and back to the client
+const Header = "X-Request-ID"
+
+// maxLength caps the incoming IDs that are honoured
+const maxLength = 128
+
+// New returns a random version 4 UUID
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Valid reports whether an incoming ID can be honoured: at most 128 printable ASCII characters
+// without spaces, so it cannot forge log lines or headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithID returns a copy of ctx carrying the request ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, middleware.RequestIDKey, id)
+}
+
+// FromContext returns the request ID stored by WithID, or "" outside a request
+func FromContext(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+// logHandler adds the request ID of the context it is given to every record
+type logHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps h so that records logged with a request's context carry its request_id.
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return logHandler{Handler: h}
+}
+
+func (h logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,57 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := New(), New()
+	if !uuid.MatchString(first) || first == second {
+		t.Errorf("Expected distinct version 4 UUIDs, got %q and %q", first, second)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f2a9c1e-lb-01", true},
+		{"Root=1-67891233-abcdef012345678912345678", true},
+		{"", false},
+		{"two words", false},
+		{"line\nbreak", false},
+		{"café", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestLogging(t *testing.T) {
+	ctx := WithID(context.Background(), "req-42")
+	if got := FromContext(ctx); got != "req-42" {
+		t.Fatalf("Expected the stored ID, got %q", got)
+	}
+
+	// Test case 1: Records logged with a request's context carry its request_id
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil))).With("component", "test")
+	logger.InfoContext(ctx, "inside")
+	logger.InfoContext(context.Background(), "outside")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "request_id=req-42") || !strings.Contains(lines[0], "component=test") ||
+		strings.Contains(lines[1], "request_id") {
+		t.Errorf("Unexpected records: %q", lines)
+	}
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeClamd accepts one INSTREAM connection per call to reply and answers with the reply for the
+// bytes received.
+func fakeClamd(t *testing.T, reply func(data []byte) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var data []byte
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					chunk := make([]byte, size)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					data = append(data, chunk...)
+				}
+				conn.Write([]byte(reply(data) + "\x00"))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAV_Scan(t *testing.T) {
+	addr := fakeClamd(t, func(data []byte) string {
+		if strings.Contains(string(data), "EICAR") {
+			return "stream: Eicar-Test-Signature FOUND"
+		}
+		return "stream: OK"
+	})
+	c := &ClamAV{Addr: addr}
+	ctx := context.Background()
+
+	// Test case 1: Clean contents, larger than one chunk
+	verdict, err := c.Scan(ctx, strings.NewReader(strings.Repeat("a", 3*clamAVChunkSize+7)))
+	if err != nil || verdict.Infected {
+		t.Errorf("Expected a clean verdict, got %+v (%v)", verdict, err)
+	}
+
+	// Test case 2: Infected contents report the signature
+	verdict, err = c.Scan(ctx, strings.NewReader("X5O!P%@AP-EICAR-STANDARD-ANTIVIRUS-TEST-FILE"))
+	if err != nil || !verdict.Infected || verdict.Signature != "Eicar-Test-Signature" {
+		t.Errorf("Expected an infected verdict, got %+v (%v)", verdict, err)
+	}
+
+	// Test case 3: Empty contents
+	if verdict, err := c.Scan(ctx, strings.NewReader("")); err != nil || verdict.Infected {
+		t.Errorf("Expected a clean verdict for no contents, got %+v (%v)", verdict, err)
+	}
+}
+
+func TestClamAV_Errors(t *testing.T) {
+	// Test case 1: clamd reports an error instead of a verdict
+	addr := fakeClamd(t, func(data []byte) string { return "INSTREAM size limit exceeded. ERROR" })
+	if _, err := (&ClamAV{Addr: addr}).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Error("Expected an error for an ERROR reply")
+	}
+
+	// Test case 2: Nothing listening
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+	if _, err := (&ClamAV{Addr: closed}).Scan(context.Background(), strings.NewReader("data")); err == nil {
+		t.Error("Expected an error when clamd is unreachable")
+	}
+}
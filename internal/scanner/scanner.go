@@ -0,0 +1,25 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Verdict is the outcome of scanning one file.
+type Verdict struct {
+	Infected  bool
+	Signature string // Name of the detected malware when Infected
+}
+
+// Scanner checks file contents for malware.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Verdict, error)
+}
+
+// Noop reports every file clean without reading it. It is used when no scanner is configured.
+type Noop struct{}
+
+// Scan reports the file clean.
+func (Noop) Scan(ctx context.Context, r io.Reader) (Verdict, error) {
+	return Verdict{}, nil
+}
@@ -0,0 +1,144 @@
+// Package scoring rates how risky it is to lend to a borrower again, from their history with a lender.
+package scoring
+
+import (
+	"math"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+	"wisetech-lms-api/internal/models"
+)
+
+// Points each component contributes to a perfect score of 100
+const (
+	OnTimeWeight   = 40
+	DefaultsWeight = 30
+	OverdueWeight  = 20
+	TenureWeight   = 10
+)
+
+const (
+	// PointsPerDefault is taken off the defaults component for every defaulted loan
+	PointsPerDefault = 15
+	// OverdueDaysLimit is how many days overdue leave no overdue points; fewer days score proportionally
+	OverdueDaysLimit = 90
+	// TenureFullDays is how long a borrower must have borrowed from the lender for full tenure points
+	TenureFullDays = 730
+	// NoHistoryOnTimeRatio stands in for the on-time ratio of a borrower with no instalments due yet
+	NoHistoryOnTimeRatio = 0.5
+)
+
+// Component names, as reported in Score.Components
+const (
+	ComponentOnTime   = "on_time_payments"
+	ComponentDefaults = "defaulted_loans"
+	ComponentOverdue  = "overdue_days"
+	ComponentTenure   = "tenure_days"
+)
+
+// History is what a borrower's score is computed from
+type History struct {
+	InstalmentsDue    int `json:"instalments_due"`     // Instalments that have fallen due on the borrower's loans
+	OnTimeInstalments int `json:"on_time_instalments"` // Of those, the ones paid in full by the end of their due day
+	DefaultedLoans    int `json:"defaulted_loans"`
+	OverdueDays       int `json:"overdue_days"` // Days the oldest unpaid instalment of an active loan is past due
+	TenureDays        int `json:"tenure_days"`  // Days since the borrower's first loan with the lender started
+}
+
+// Component is one factor of a score: its input, and the points it earned out of MaxPoints
+type Component struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"max_points"`
+}
+
+// Score is a 0-100 rating, higher being safer, with the components that add up to it
+type Score struct {
+	Score      int         `json:"score"`
+	Components []Component `json:"components"`
+}
+
+// Compute scores a history. Every component scores linearly between none and all of its points.
+func Compute(h History) Score {
+	ratio := NoHistoryOnTimeRatio
+	if h.InstalmentsDue > 0 {
+		ratio = float64(h.OnTimeInstalments) / float64(h.InstalmentsDue)
+	}
+	components := []Component{
+		{Name: ComponentOnTime, Value: ratio, Points: OnTimeWeight * ratio, MaxPoints: OnTimeWeight},
+		{Name: ComponentDefaults, Value: float64(h.DefaultedLoans), Points: max(DefaultsWeight-PointsPerDefault*float64(h.DefaultedLoans), 0), MaxPoints: DefaultsWeight},
+		{Name: ComponentOverdue, Value: float64(h.OverdueDays), Points: OverdueWeight * (1 - min(float64(h.OverdueDays)/OverdueDaysLimit, 1)), MaxPoints: OverdueWeight},
+		{Name: ComponentTenure, Value: float64(h.TenureDays), Points: TenureWeight * min(float64(h.TenureDays)/TenureFullDays, 1), MaxPoints: TenureWeight},
+	}
+
+	var total float64
+	for i := range components {
+		components[i].Points = math.Round(components[i].Points*100) / 100
+		total += components[i].Points
+	}
+	return Score{Score: int(math.Round(total)), Components: components}
+}
+
+// BuildHistory derives a borrower's history from their loans with one lender and the receipts on
+// them, as of the given day. Pending and cancelled loans were never repaid, so only their start
+// counts towards tenure. An instalment is covered once the loan's paid receipts add up to it and
+// every instalment before it.
+func BuildHistory(loans []models.LoanStatement, asOf time.Time) History {
+	var h History
+	day := truncateDay(asOf)
+	var first time.Time
+	for _, st := range loans {
+		loan := st.Loan
+		if loan.PaymentStatus == "cancelled" {
+			continue
+		}
+		start := truncateDay(loan.StartDate.Time)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		switch loan.PaymentStatus {
+		case "pending":
+			continue
+		case "defaulted":
+			h.DefaultedLoans++
+		}
+
+		instalment := finance.Instalment(loan.MonthlyPayment, loan.Amount, loan.InterestRate, loan.MonthsToPay)
+		for k := 1; k <= loan.MonthsToPay; k++ {
+			due := start.AddDate(0, k, 0)
+			if due.After(day) {
+				break
+			}
+			owed := instalment*float64(k) - 0.005 // Tolerate rounding to cents
+			h.InstalmentsDue++
+			if paidBy(st.Receipts, due.AddDate(0, 0, 1)) >= owed {
+				h.OnTimeInstalments++
+			}
+			if loan.PaymentStatus == "active" && paidBy(st.Receipts, day.AddDate(0, 0, 1)) < owed {
+				h.OverdueDays = max(h.OverdueDays, int(day.Sub(due).Hours()/24))
+			}
+		}
+	}
+	if !first.IsZero() && first.Before(day) {
+		h.TenureDays = int(day.Sub(first).Hours() / 24)
+	}
+	return h
+}
+
+// paidBy totals the paid receipts recorded before until
+func paidBy(receipts []models.Receipt, until time.Time) float64 {
+	var total float64
+	for _, r := range receipts {
+		if r.Status == "paid" && r.Timestamp.Before(until) {
+			total += r.Amount
+		}
+	}
+	return total
+}
+
+// truncateDay returns the midnight that starts t's day in UTC
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
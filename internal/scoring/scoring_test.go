@@ -0,0 +1,95 @@
+package scoring
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+// loan builds a statement for a loan of 300 a month over months, with paid receipts of the given
+// amounts on the given days
+func loan(status, start string, months int, payments map[string]float64) models.LoanStatement {
+	st := models.LoanStatement{Loan: models.Loan{
+		PaymentStatus:  status,
+		Amount:         300 * float64(months),
+		MonthsToPay:    months,
+		MonthlyPayment: sql.NullFloat64{Float64: 300, Valid: true},
+		StartDate:      models.NewJSONTime(date(start)),
+	}}
+	for day, amount := range payments {
+		st.Receipts = append(st.Receipts, models.Receipt{Status: "paid", Amount: amount, Timestamp: models.NewJSONTime(date(day).Add(12 * time.Hour))})
+	}
+	return st
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name    string
+		history History
+		want    int
+	}{
+		{"perfect", History{InstalmentsDue: 12, OnTimeInstalments: 12, TenureDays: TenureFullDays}, 100},
+		{"new borrower", History{}, 70},
+		{"half on time, a year in", History{InstalmentsDue: 10, OnTimeInstalments: 5, TenureDays: 365}, 75},
+		{"one default", History{InstalmentsDue: 4, OnTimeInstalments: 4, DefaultedLoans: 1, TenureDays: TenureFullDays}, 85},
+		{"defaults floor at zero", History{InstalmentsDue: 4, OnTimeInstalments: 0, DefaultedLoans: 5, OverdueDays: 400}, 0},
+		{"45 days overdue", History{InstalmentsDue: 2, OnTimeInstalments: 2, OverdueDays: 45}, 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compute(tt.history)
+			if got.Score != tt.want {
+				t.Errorf("Score = %d, want %d (%+v)", got.Score, tt.want, got.Components)
+			}
+			var total, maxPoints float64
+			for _, c := range got.Components {
+				total += c.Points
+				maxPoints += c.MaxPoints
+			}
+			if maxPoints != 100 || int(total+0.5) != got.Score {
+				t.Errorf("Expected components out of 100 adding up to the score, got %+v", got.Components)
+			}
+		})
+	}
+}
+
+func TestBuildHistory(t *testing.T) {
+	asOf := date("2026-06-15")
+
+	// Test case 1: A loan paid on every due date; the receipt on the due day itself counts as on time
+	onTime := loan("active", "2026-01-10", 12, map[string]float64{
+		"2026-02-10": 300, "2026-03-09": 300, "2026-04-10": 300, "2026-05-10": 300, "2026-06-10": 300,
+	})
+	h := BuildHistory([]models.LoanStatement{onTime}, asOf)
+	if h != (History{InstalmentsDue: 5, OnTimeInstalments: 5, TenureDays: 156}) {
+		t.Errorf("Unexpected on-time history: %+v", h)
+	}
+
+	// Test case 2: A late payment is not on time, and an unpaid instalment counts overdue days
+	late := loan("active", "2026-01-10", 12, map[string]float64{"2026-02-20": 300, "2026-03-10": 300})
+	h = BuildHistory([]models.LoanStatement{late}, asOf)
+	if h.InstalmentsDue != 5 || h.OnTimeInstalments != 1 || h.OverdueDays != 66 {
+		t.Errorf("Expected 1 of 5 on time and 66 days overdue (since 10 April), got %+v", h)
+	}
+
+	// Test case 3: Defaulted loans count, but are not overdue; pending loans only add tenure; cancelled loans are ignored
+	defaulted := loan("defaulted", "2025-06-15", 3, nil)
+	pending := loan("pending", "2024-06-15", 6, nil)
+	cancelled := loan("cancelled", "2020-01-01", 6, nil)
+	h = BuildHistory([]models.LoanStatement{defaulted, pending, cancelled}, asOf)
+	if h != (History{InstalmentsDue: 3, DefaultedLoans: 1, TenureDays: 730}) {
+		t.Errorf("Unexpected history: %+v", h)
+	}
+
+	// Test case 4: No loans yet
+	if h := BuildHistory(nil, asOf); h != (History{}) {
+		t.Errorf("Expected an empty history, got %+v", h)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/reports"
+)
+
+// defaultPlatformSeriesDays is the range of the platform growth series when from is not given
+const defaultPlatformSeriesDays = 365
+
+// platformTimeSeriesResponse is the platform's growth over time, oldest period first
+type platformTimeSeriesResponse struct {
+	Granularity string                  `json:"granularity"`
+	From        string                  `json:"from"` // YYYY-MM-DD
+	To          string                  `json:"to"`   // YYYY-MM-DD, inclusive
+	Series      []reports.PlatformPoint `json:"series"`
+}
+
+// getPlatformAnalytics summarises every lender for the platform operator: lenders, active
+// subscriptions by plan, the loans issued this month and what has been collected, per currency.
+// Months run in UTC. Only counts and totals are returned.
+func (s *Server) getPlatformAnalytics(w http.ResponseWriter, r *http.Request) {
+	report, err := cachedReport(s, w, r, reports.AllLenders, func() (*reports.Platform, error) {
+		return s.reports.Platform(time.Now().UTC())
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// getPlatformTimeSeries charts the platform's growth per day, week or month from from to to,
+// inclusive, in UTC: lenders registered, loans issued and receipts collected across every lender.
+// Granularity defaults to month and the range to the last 365 days, capped at the configured
+// number of points.
+func (s *Server) getPlatformTimeSeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = reports.GranularityMonth
+	case reports.GranularityDay, reports.GranularityWeek, reports.GranularityMonth:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("granularity must be day, week or month"))
+		return
+	}
+	from, to, err := parseReportDays(query, time.UTC, defaultPlatformSeriesDays)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	maxPoints := s.Cfg.TimeSeriesMaxPoints
+	if maxPoints <= 0 {
+		maxPoints = defaultTimeSeriesMaxPoints
+	}
+	if reports.PeriodCount(from, to, granularity) > maxPoints {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("the series covers at most %d %ss", maxPoints, granularity)))
+		return
+	}
+
+	series, err := cachedReport(s, w, r, reports.AllLenders, func() ([]reports.PlatformPoint, error) {
+		return s.reports.PlatformTimeSeries(granularity, from, to)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, platformTimeSeriesResponse{
+		Granularity: granularity,
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Series:      series,
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+)
+
+func TestPlatformAnalytics(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, firstID, _ := registerTestLender(t, s, "analyticsone")
+	registerTestLender(t, s, "analyticstwo")
+	loanID := seedLoan(t, s, firstID, "active", 2000, 10, 12)
+	if _, err := s.receiptRepo.CreateReceipt(firstID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 250}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+
+	// Test case 1: The summary totals every lender without naming any lender or borrower
+	rr := doAdminRequest(t, s, "GET", "/api/admin/analytics", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report reports.Platform
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if report.Lenders.Total != 2 || report.Lenders.New != 2 || len(report.Subscriptions) != 1 || report.Subscriptions[0].Active != 2 {
+		t.Errorf("Unexpected lenders and subscriptions: %+v %+v", report.Lenders, report.Subscriptions)
+	}
+	if len(report.Originated) != 1 || report.Originated[0].Loans != 1 || report.Originated[0].Principal != 2000 ||
+		len(report.Collected) != 1 || report.Collected[0].Total.Total != 250 {
+		t.Errorf("Unexpected money figures: %+v %+v", report.Originated, report.Collected)
+	}
+	if body := rr.Body.String(); strings.Contains(body, "@example.com") || strings.Contains(body, "Borrower") {
+		t.Errorf("Expected no personal data, got %s", body)
+	}
+
+	// Test case 2: The time series defaults to monthly points over the last year
+	rr = doAdminRequest(t, s, "GET", "/api/admin/analytics/timeseries", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var series platformTimeSeriesResponse
+	json.Unmarshal(rr.Body.Bytes(), &series)
+	last := series.Series[len(series.Series)-1]
+	if series.Granularity != reports.GranularityMonth || last.Period != time.Now().UTC().Format("2006-01") ||
+		last.NewLenders != 2 || last.Lenders != 2 || last.Collected["LSL"] != 250 {
+		t.Errorf("Unexpected series: %+v", series)
+	}
+
+	// Test case 3: Bad parameters are rejected, and analytics need the admin key
+	for _, path := range []string{
+		"/api/admin/analytics/timeseries?granularity=year",
+		"/api/admin/analytics/timeseries?granularity=day&from=2000-01-01",
+	} {
+		if rr := doAdminRequest(t, s, "GET", path, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", path, rr.Code)
+		}
+	}
+	if rr := doRequest(t, s, "GET", "/api/admin/analytics", "", ""); rr.Code == http.StatusOK {
+		t.Error("Expected analytics to require the admin key")
+	}
+}
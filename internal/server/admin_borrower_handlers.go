@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// anonymizeBorrower scrubs a borrower's personal data for a privacy request. Their loans, receipts
+// and IDs are kept, so every lender's accounts still balance.
+func (s *Server) anonymizeBorrower(w http.ResponseWriter, r *http.Request) {
+	borrowerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid borrower id"))
+		return
+	}
+	if err := s.borrowerRepo.AnonymizeBorrower(borrowerID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.InvalidateAll() // Cached reports of any lender may name the borrower
+	s.auditor.Record(r.Context(), audit.Event{Action: models.AuditBorrowerAnonymized, ResourceType: "borrower", ResourceID: borrowerID})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAdminAnonymizeBorrower(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "anonymized")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	path := fmt.Sprintf("/api/admin/borrowers/%d/anonymize", borrowerID)
+
+	// Test case 1: Admin key is required
+	if rr := doRequest(t, s, "POST", path, token, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without admin key, got %d", rr.Code)
+	}
+
+	// Test case 2: The borrower is scrubbed and their loan still reads back
+	rr := doAdminRequest(t, s, "POST", path, "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var email string
+	var active bool
+	s.DB.QueryRow("SELECT Email, Is_Active FROM Borrowers WHERE Borrower_ID = ?", borrowerID).Scan(&email, &active)
+	if email != fmt.Sprintf("anonymized-%d@invalid", borrowerID) || active {
+		t.Errorf("Expected a placeholder email and an inactive borrower, got %q active=%v", email, active)
+	}
+	if rr := doRequest(t, s, "GET", fmt.Sprintf("/api/borrowers/%d/risk", borrowerID), token, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the borrower's loan history to still load, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Unknown and malformed borrower IDs
+	if rr := doAdminRequest(t, s, "POST", "/api/admin/borrowers/9999/anonymize", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(t, s, "POST", "/api/admin/borrowers/x/anonymize", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// validLenderStatusFilters are the ledger statuses plus "none" for lenders that never subscribed
+var validLenderStatusFilters = map[string]bool{
+	"active":    true,
+	"inactive":  true,
+	"suspended": true,
+	"expired":   true,
+	"none":      true,
+}
+
+// lenderListResponse is one page of the admin lender overview
+type lenderListResponse struct {
+	Lenders []models.LenderOverview `json:"lenders"`
+	Total   int                     `json:"total"`
+	Limit   int                     `json:"limit"`
+	Offset  int                     `json:"offset"`
+}
+
+// parsePagination reads the limit and offset query parameters, clamped to the configured page
+// sizes by config.NormalizePage. Only values that are not integers are rejected.
+func (s *Server) parsePagination(r *http.Request) (limit, offset int, err error) {
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return 0, 0, httperr.Validation("limit must be an integer")
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return 0, 0, httperr.Validation("offset must be an integer")
+		}
+	}
+	page := s.Cfg.NormalizePage(limit, offset)
+	return page.Limit, page.Offset, nil
+}
+
+// listLenders returns every lender with its current plan and subscription status.
+// Supports status, plan_id, limit and offset query parameters.
+func (s *Server) listLenders(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	filter := repository.LenderFilter{Limit: limit, Offset: offset}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if !validLenderStatusFilters[status] {
+			s.writeServiceError(w, r, httperr.Validation("status must be one of active, inactive, suspended, expired, none"))
+			return
+		}
+		filter.Status = status
+	}
+	if v := r.URL.Query().Get("plan_id"); v != "" {
+		filter.PlanID, err = strconv.Atoi(v)
+		if err != nil || filter.PlanID < 1 {
+			s.writeServiceError(w, r, httperr.Validation("plan_id must be a positive integer"))
+			return
+		}
+	}
+
+	lenders, total, err := s.lenderRepo.ListLenderOverviews(filter)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if lenders == nil {
+		lenders = []models.LenderOverview{}
+	}
+
+	writeJSON(w, http.StatusOK, lenderListResponse{
+		Lenders: lenders,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// getLender returns a single lender's overview with recent activity counts
+func (s *Server) getLender(w http.ResponseWriter, r *http.Request) {
+	lenderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid lender id"))
+		return
+	}
+
+	detail, err := s.lenderRepo.GetLenderDetail(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// lenderHistoryResponse is one page of a lender's profile changes
+type lenderHistoryResponse struct {
+	Changes []models.LenderChange `json:"changes"`
+	Total   int                   `json:"total"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+}
+
+// getLenderHistory returns a lender's profile changes, newest first, each with the before and
+// after value of only the fields it changed. Supports limit and offset query parameters.
+func (s *Server) getLenderHistory(w http.ResponseWriter, r *http.Request) {
+	lenderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid lender id"))
+		return
+	}
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	changes, total, err := s.lenderRepo.ListLenderChanges(lenderID, limit, offset)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lenderHistoryResponse{Changes: changes, Total: total, Limit: limit, Offset: offset})
+}
+
+// suspensionRequest is the body accepted by the suspend and unsuspend endpoints
+type suspensionRequest struct {
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+}
+
+// decodeSuspensionRequest reads the lender ID and suspension body, defaulting the actor to "admin"
+func decodeSuspensionRequest(r *http.Request) (int, suspensionRequest, error) {
+	var req suspensionRequest
+	lenderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return 0, req, httperr.BadRequest("invalid lender id")
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return 0, req, httperr.BadRequest("invalid request body")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return 0, req, httperr.Validation("reason is required")
+	}
+	if req.Actor == "" {
+		req.Actor = "admin"
+	}
+	return lenderID, req, nil
+}
+
+// suspendLender suspends a lender, locking its accounts, revoking their tokens and suspending
+// its active subscription. It returns the updated lender detail.
+func (s *Server) suspendLender(w http.ResponseWriter, r *http.Request) {
+	lenderID, req, err := decodeSuspensionRequest(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.subscriptions.SuspendLender(r.Context(), lenderID, req.Actor, req.Reason); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     lenderID,
+		Actor:        req.Actor,
+		Action:       models.AuditLenderSuspended,
+		ResourceType: "lender",
+		ResourceID:   lenderID,
+		Details:      map[string]string{"reason": req.Reason},
+	})
+	s.getLender(w, r)
+}
+
+// unsuspendLender lifts a lender's suspension and unlocks its accounts. Its subscription returns
+// to active, or to expired if its end date passed meanwhile. It returns the updated lender detail.
+func (s *Server) unsuspendLender(w http.ResponseWriter, r *http.Request) {
+	lenderID, req, err := decodeSuspensionRequest(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.subscriptions.UnsuspendLender(r.Context(), lenderID, req.Actor, req.Reason); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     lenderID,
+		Actor:        req.Actor,
+		Action:       models.AuditLenderUnsuspended,
+		ResourceType: "lender",
+		ResourceID:   lenderID,
+		Details:      map[string]string{"reason": req.Reason},
+	})
+	s.getLender(w, r)
+}
+
+// loanBookSnapshotResponse is a lender's stored loan book snapshot. Warning is set when the month
+// had already been snapshotted and nothing was written.
+type loanBookSnapshotResponse struct {
+	*models.LoanBookSnapshot
+	Warning string `json:"warning,omitempty"`
+}
+
+// snapshotLoanBook stores a lender's month-end loan book snapshot straight away instead of waiting
+// for the snapshot job, e.g. for testing. month is a YYYY-MM month that has ended in the lender's
+// time zone, the last one by default. Responds 201 with the snapshot, or, since snapshots are never
+// rewritten, 200 with the stored one and a warning when the month already has one.
+func (s *Server) snapshotLoanBook(w http.ResponseWriter, r *http.Request) {
+	lenderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid lender id"))
+		return
+	}
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	now := time.Now().In(loc)
+	month := jobs.LastMonth(now)
+	if value := r.URL.Query().Get("month"); value != "" {
+		if month, err = time.ParseInLocation("2006-01", value, loc); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("month must be a YYYY-MM month"))
+			return
+		}
+		if month.AddDate(0, 1, 0).After(now) {
+			s.writeServiceError(w, r, httperr.Validation("month has not ended yet"))
+			return
+		}
+	}
+
+	snapshot, err := s.snapshots.Snapshot(lenderID, month)
+	if errors.Is(err, repository.ErrSnapshotExists) {
+		stored, err := s.snapshotRepo.Get(lenderID, month.Format("2006-01"))
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, loanBookSnapshotResponse{
+			LoanBookSnapshot: stored,
+			Warning:          fmt.Sprintf("a snapshot for %s already exists and was not rewritten", stored.Month),
+		})
+		return
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, loanBookSnapshotResponse{LoanBookSnapshot: snapshot})
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+)
+
+func TestAdminListLenders(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Basic", 100)
+	_, subscribedID, _ := registerTestLender(t, s, "subscribed")
+	registerTestLender(t, s, "unsubscribed")
+	now := time.Now()
+	if _, err := s.ledgerRepo.CreateSubscription(context.Background(), subscribedID, planID, "LSL", now, now.AddDate(0, 0, 30)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	// Test case 1: Admin key is required
+	rr := doRequest(t, s, "GET", "/api/admin/lenders", "", "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without admin key, got %d", rr.Code)
+	}
+
+	// Test case 2: Filter by status and plan
+	rr = doAdminRequest(t, s, "GET", fmt.Sprintf("/api/admin/lenders?status=active&plan_id=%d", planID), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page lenderListResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 1 || len(page.Lenders) != 1 || page.Lenders[0].LenderID != subscribedID || page.Limit != 50 {
+		t.Errorf("Unexpected page: %+v", page)
+	}
+
+	// Test case 3: Empty pages are an empty list
+	rr = doAdminRequest(t, s, "GET", "/api/admin/lenders?offset=10", "")
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 2 || page.Lenders == nil || len(page.Lenders) != 0 {
+		t.Errorf("Expected an empty page of 2 lenders, got %+v", page)
+	}
+
+	// Test case 4: Out of range paging is clamped to the configured page sizes
+	for query, want := range map[string][2]int{"limit=1000": {200, 0}, "limit=0": {50, 0}, "limit=5&offset=-1": {5, 0}} {
+		rr = doAdminRequest(t, s, "GET", "/api/admin/lenders?"+query, "")
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		if rr.Code != http.StatusOK || page.Limit != want[0] || page.Offset != want[1] || len(page.Lenders) != 2 {
+			t.Errorf("%s: expected limit %d and offset %d, got %d %+v", query, want[0], want[1], rr.Code, page)
+		}
+	}
+	s.Cfg.DefaultPageSize, s.Cfg.MaxPageSize = 1, 1
+	rr = doAdminRequest(t, s, "GET", "/api/admin/lenders?limit=10", "")
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Limit != 1 || len(page.Lenders) != 1 || page.Total != 2 {
+		t.Errorf("Expected the configured maximum of 1, got %+v", page)
+	}
+
+	// Test case 5: Invalid filters
+	for _, query := range []string{"status=deleted", "plan_id=abc", "limit=abc", "offset=x"} {
+		rr = doAdminRequest(t, s, "GET", "/api/admin/lenders?"+query, "")
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestAdminGetLender(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "drilldown")
+	seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+
+	rr := doAdminRequest(t, s, "GET", fmt.Sprintf("/api/admin/lenders/%d", lenderID), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var detail models.LenderDetail
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if detail.LenderID != lenderID || detail.ActiveLoanCount != 1 || detail.LoansByStatus["active"] != 1 || detail.BorrowerCount != 1 {
+		t.Errorf("Unexpected detail: %+v", detail)
+	}
+
+	rr = doAdminRequest(t, s, "GET", "/api/admin/lenders/99999", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown lender, got %d", rr.Code)
+	}
+}
+
+// backdatedToken signs an access token for the account that was issued an hour ago.
+func backdatedToken(t *testing.T, accountID, lenderID int) string {
+	issued := time.Now().Add(-time.Hour)
+	claims := auth.Claims{
+		AccountID: int64(accountID),
+		LenderID:  int64(lenderID),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issued),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAdminSuspendLender(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	accountID, lenderID, token := registerTestLender(t, s, "suspendme")
+	oldToken := backdatedToken(t, accountID, lenderID)
+	_, otherID, otherToken := registerTestLender(t, s, "bystander")
+	path := fmt.Sprintf("/api/admin/lenders/%d", lenderID)
+
+	// Test case 1: Admin key is required
+	rr := doRequest(t, s, "POST", path+"/suspend", token, `{"reason":"fraud review"}`)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without admin key, got %d", rr.Code)
+	}
+
+	// Test case 2: Reason is required
+	rr = doAdminRequest(t, s, "POST", path+"/suspend", `{"reason":" "}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 without a reason, got %d", rr.Code)
+	}
+
+	// Test case 3: Suspension cascades to the subscription and accounts
+	rr = doAdminRequest(t, s, "POST", path+"/suspend", `{"reason":"fraud review","actor":"ops@wisetech"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var detail models.LenderDetail
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if !detail.SuspendedAt.Valid || detail.SubscriptionStatus.String != "suspended" {
+		t.Errorf("Expected a suspended lender and subscription, got %+v", detail.LenderOverview)
+	}
+	account, _ := s.authRepo.GetAccountByID(accountID)
+	if !account.IsLocked {
+		t.Error("Expected the lender's account to be locked")
+	}
+	lender, _ := s.authRepo.GetLenderByAccountID(accountID)
+	if lender.SuspendedBy.String != "ops@wisetech" || lender.SuspensionReason.String != "fraud review" {
+		t.Errorf("Expected actor and reason to be recorded, got %+v", lender)
+	}
+	sub, _ := s.ledgerRepo.GetCurrentSubscription(context.Background(), lenderID)
+	events, _ := s.ledgerRepo.ListEvents(context.Background(), sub.LedgerID)
+	if len(events) != 1 || events[0].Actor != "ops@wisetech" || events[0].ToStatus != "suspended" {
+		t.Errorf("Expected a suspension event, got %+v", events)
+	}
+
+	// Test case 4: Valid tokens are refused with the suspended code; other lenders are unaffected
+	rr = doRequest(t, s, "GET", "/api/auth/me", token, "")
+	var errResp errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if rr.Code != http.StatusForbidden || errResp.Error.Code != "suspended" {
+		t.Errorf("Expected 403 suspended, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doRequest(t, s, "GET", "/api/auth/me", otherToken, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected lender %d to be unaffected, got %d", otherID, rr.Code)
+	}
+	rr = doAdminRequest(t, s, "POST", "/api/auth/introspect", fmt.Sprintf(`{"token":%q}`, token))
+	var introspection introspectResponse
+	json.Unmarshal(rr.Body.Bytes(), &introspection)
+	if introspection.Active {
+		t.Error("Expected introspection to report a suspended lender's token inactive")
+	}
+
+	// Test case 5: Suspending twice conflicts
+	rr = doAdminRequest(t, s, "POST", path+"/suspend", `{"reason":"again"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rr.Code)
+	}
+
+	// Test case 6: Unsuspension restores the subscription and unlocks accounts
+	rr = doAdminRequest(t, s, "POST", path+"/unsuspend", `{"reason":"cleared"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	detail = models.LenderDetail{}
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if detail.SuspendedAt.Valid || detail.SubscriptionStatus.String != "active" {
+		t.Errorf("Expected an active lender and subscription, got %+v", detail.LenderOverview)
+	}
+	account, _ = s.authRepo.GetAccountByID(accountID)
+	if account.IsLocked {
+		t.Error("Expected the lender's account to be unlocked")
+	}
+
+	// Test case 7: Tokens issued before the suspension stay revoked; new ones work
+	rr = doRequest(t, s, "GET", "/api/auth/me", oldToken, "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a revoked token, got %d", rr.Code)
+	}
+	newToken, _ := auth.GenerateAccessToken(int64(accountID), int64(lenderID), testJWTSecret)
+	rr = doRequest(t, s, "GET", "/api/auth/me", newToken, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a new token, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 8: Unsuspending a lender that is not suspended, and unknown lenders
+	rr = doAdminRequest(t, s, "POST", path+"/unsuspend", `{"reason":"again"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rr.Code)
+	}
+	rr = doAdminRequest(t, s, "POST", "/api/admin/lenders/99999/suspend", `{"reason":"x"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestAdminUnsuspendLender_AfterEndDate(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Basic", 100)
+	_, lenderID, _ := registerTestLender(t, s, "lapsed")
+	now := time.Now()
+	if _, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, planID, "LSL", now.AddDate(0, -1, 0), now.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	path := fmt.Sprintf("/api/admin/lenders/%d", lenderID)
+
+	if rr := doAdminRequest(t, s, "POST", path+"/suspend", `{"reason":"fraud review"}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// The subscription ends while the lender is suspended
+	if _, err := s.DB.Exec("UPDATE Lender_Ledger SET End_Date = ? WHERE Lender_ID = ?", now.AddDate(0, 0, -1).UTC(), lenderID); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := doAdminRequest(t, s, "POST", path+"/unsuspend", `{"reason":"cleared"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var detail models.LenderDetail
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if detail.SubscriptionStatus.String != "expired" {
+		t.Errorf("Expected the subscription to land in expired, got %+v", detail.SubscriptionStatus)
+	}
+}
+
+func TestLenderProfileHistory(t *testing.T) {
+	s := newTestServer(t)
+	accountID, lenderID, token := registerTestLender(t, s, "historied")
+	historyPath := fmt.Sprintf("/api/admin/lenders/%d/history", lenderID)
+
+	// Test case 1: A lender updates one field of their profile
+	rr := doRequest(t, s, "PATCH", "/api/lenders/me", token, `{"phone_number": "266 5555 0000", "email": "historied@example.com"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var lender models.Lender
+	json.Unmarshal(rr.Body.Bytes(), &lender)
+	if lender.PhoneNumber != "266 5555 0000" {
+		t.Errorf("Expected the phone number to be updated, got %+v", lender)
+	}
+
+	// Test case 2: The history lists only that field, with its actor
+	rr = doAdminRequest(t, s, "GET", historyPath, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var history lenderHistoryResponse
+	json.Unmarshal(rr.Body.Bytes(), &history)
+	if history.Total != 1 || len(history.Changes) != 1 {
+		t.Fatalf("Expected a single change, got %+v", history)
+	}
+	change := history.Changes[0]
+	if len(change.Changes) != 1 || change.Changes["phone_number"] != (models.FieldChange{From: "123", To: "266 5555 0000"}) ||
+		change.Actor != fmt.Sprintf("account:%d", accountID) {
+		t.Errorf("Unexpected change: %+v", change)
+	}
+
+	// Test case 3: Invalid updates are rejected
+	if rr := doRequest(t, s, "PATCH", "/api/lenders/me", token, `{"interest_rate_percent": 150}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "PATCH", "/api/lenders/me", token, `{"business_name": "  "}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a blank name, got %d", rr.Code)
+	}
+
+	// Test case 4: Unknown lender and admin-only access
+	if rr := doAdminRequest(t, s, "GET", "/api/admin/lenders/9999/history", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", historyPath, token, ""); rr.Code == http.StatusOK {
+		t.Error("Expected lenders to be refused")
+	}
+}
+
+func TestLoanBookSnapshots(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "snapshotted")
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	lastMonth := jobs.LastMonth(time.Now().UTC())
+	monthEnd := lastMonth.AddDate(0, 1, -1)
+	s.DB.Exec("UPDATE Loans SET Start_Date = ? WHERE Loan_ID = ?", lastMonth.Format(time.DateOnly), loanID)
+	receipt := func(amount float64, at time.Time) {
+		if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: amount, Timestamp: models.NewJSONTime(at)}); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+	receipt(200, lastMonth.Add(time.Hour))
+	path := fmt.Sprintf("/api/admin/lenders/%d/loan-book-snapshots", lenderID)
+
+	// Test case 1: The admin trigger snapshots the last month by default
+	rr := doAdminRequest(t, s, "POST", path, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created loanBookSnapshotResponse
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Month != lastMonth.Format("2006-01") || created.AsOf != monthEnd.Format(time.DateOnly) ||
+		len(created.Loans) != 1 || created.OutstandingPrincipal != 1000 || created.Warning != "" {
+		t.Fatalf("Unexpected snapshot: %+v", created)
+	}
+
+	// Test case 2: Triggering it again writes nothing and warns
+	rr = doAdminRequest(t, s, "POST", path+"?month="+lastMonth.Format("2006-01"), "")
+	var again loanBookSnapshotResponse
+	json.Unmarshal(rr.Body.Bytes(), &again)
+	if rr.Code != http.StatusOK || again.Warning == "" || again.OutstandingPrincipal != 1000 {
+		t.Errorf("Expected the stored snapshot with a warning, got %d %+v", rr.Code, again)
+	}
+
+	// Test case 3: A back-dated receipt changes the live report but not the snapshot
+	receipt(300, lastMonth.Add(2*time.Hour))
+	live := doRequest(t, s, "GET", "/api/reports/portfolio?as_of="+monthEnd.Format(time.DateOnly), token, "")
+	var livePortfolio reports.Portfolio
+	json.Unmarshal(live.Body.Bytes(), &livePortfolio)
+	rr = doRequest(t, s, "GET", "/api/reports/portfolio?as_of_snapshot=true", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var stored reports.Portfolio
+	json.Unmarshal(rr.Body.Bytes(), &stored)
+	if livePortfolio.Outstanding.Principal != 700 || stored.Outstanding.Principal != 1000 || stored.SnapshotTakenAt == nil ||
+		stored.AsOf != monthEnd.Format(time.DateOnly) {
+		t.Errorf("Expected 700 live and 1000 from the snapshot, got %+v and %+v", livePortfolio.Outstanding, stored)
+	}
+
+	// Test case 4: Months without a snapshot, months not yet ended and bad parameters are rejected
+	if rr := doRequest(t, s, "GET", "/api/reports/portfolio?as_of_snapshot=true&as_of="+time.Now().UTC().Format(time.DateOnly), token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for this month, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/reports/portfolio?as_of_snapshot=maybe", token, ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+	for _, query := range []string{"?month=" + time.Now().UTC().Format("2006-01"), "?month=2026-1"} {
+		if rr := doAdminRequest(t, s, "POST", path+query, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+	if rr := doAdminRequest(t, s, "POST", "/api/admin/lenders/9999/loan-book-snapshots", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown lender, got %d", rr.Code)
+	}
+}
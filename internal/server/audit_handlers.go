@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// auditLogResponse is one page of a lender's audit log
+type auditLogResponse struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+}
+
+// getAuditLog returns the changes made to the caller's lender, newest first: by its accounts,
+// by admins and by background jobs. Accounts have no roles, so every account of the lender is
+// one of its owners and may read it. Supports action, resource_type and resource_id filters, a
+// from/to date range in the lender's time zone, and limit and offset.
+func (s *Server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query, "from", "to", loc)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	filter := repository.AuditFilter{
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		From:         from,
+		To:           to,
+	}
+	if v := query.Get("resource_id"); v != "" {
+		if filter.ResourceID, err = strconv.Atoi(v); err != nil || filter.ResourceID <= 0 {
+			s.writeServiceError(w, r, httperr.Validation("resource_id must be a positive integer"))
+			return
+		}
+	}
+
+	entries, total, err := s.auditRepo.ListAuditEntries(r.Context(), lenderID, filter, limit, offset)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, auditLogResponse{Entries: entries, Total: total, Limit: limit, Offset: offset})
+}
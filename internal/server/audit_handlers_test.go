@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestGetAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	accountID, lenderID, token := registerTestLender(t, s, "auditlender")
+	_, _, otherToken := registerTestLender(t, s, "otherlender")
+
+	rr := doRequest(t, s, "POST", "/api/borrowers", token, `{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "555"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var borrower models.Borrower
+	json.Unmarshal(rr.Body.Bytes(), &borrower)
+	doRequest(t, s, "PATCH", "/api/lenders/me", token, `{"business_name": "Audited Loans"}`)
+	doRequest(t, s, "POST", "/api/borrowers", otherToken, `{"fullnames": "Lineo K", "email": "lineo@example.com", "phone_number": "556"}`)
+	doAdminRequest(t, s, "POST", fmt.Sprintf("/api/admin/borrowers/%d/anonymize", borrower.BorrowerID), "")
+
+	// Test case 1: Handler and repository writes land in one log, newest first, with their source
+	rr = doRequest(t, s, "GET", "/api/audit-log", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page auditLogResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 2 || len(page.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", page)
+	}
+	updated, created := page.Entries[0], page.Entries[1]
+	if updated.Action != models.AuditLenderUpdated || created.Action != models.AuditBorrowerCreated {
+		t.Errorf("Unexpected actions %s and %s", updated.Action, created.Action)
+	}
+	for _, e := range page.Entries {
+		if e.AccountID.Int64 != int64(accountID) || e.LenderID.Int64 != int64(lenderID) {
+			t.Errorf("Expected the entry attributed to account %d: %+v", accountID, e)
+		}
+	}
+	if created.ResourceType != "borrower" || created.ResourceID.Int64 != int64(borrower.BorrowerID) {
+		t.Errorf("Unexpected resource: %+v", created)
+	}
+
+	// Test case 2: Filters
+	for query, want := range map[string]int{
+		"action=" + models.AuditBorrowerCreated:                                 1,
+		"resource_type=lender":                                                  1,
+		"resource_type=borrower&resource_id=" + fmt.Sprint(borrower.BorrowerID): 1,
+		"from=2000-01-01&to=2000-01-31":                                         0,
+		"limit=1":                                                               2,
+	} {
+		rr = doRequest(t, s, "GET", "/api/audit-log?"+query, token, "")
+		var filtered auditLogResponse
+		json.Unmarshal(rr.Body.Bytes(), &filtered)
+		if rr.Code != http.StatusOK || filtered.Total != want {
+			t.Errorf("%s: expected %d entries, got %d: %s", query, want, filtered.Total, rr.Body.String())
+		}
+	}
+
+	// Test case 3: Invalid filters
+	for _, query := range []string{"resource_id=abc", "from=yesterday", "limit=abc"} {
+		if rr := doRequest(t, s, "GET", "/api/audit-log?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", query, rr.Code)
+		}
+	}
+
+	// Test case 4: Admin changes outside any lender are audited but not shown to lenders
+	var anonymized int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Audit_Log WHERE Action = ? AND Actor = 'admin' AND Lender_ID IS NULL", models.AuditBorrowerAnonymized).Scan(&anonymized)
+	if anonymized != 1 {
+		t.Errorf("Expected the anonymization audited as admin, got %d entries", anonymized)
+	}
+}
+
+func TestLogin_Audited(t *testing.T) {
+	s := newTestServer(t)
+	registerBody := `{"business_name": "Login Loans", "email": "login@example.com", "phone_number": "555", "username": "loginlender", "password": "Str0ng!Passw0rd", "interest_rate_percent": 5}`
+	if rr := doRequest(t, s, "POST", "/api/auth/register", "", registerBody); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 1: Failed and successful logins are recorded against the account
+	doRequest(t, s, "POST", "/api/auth/login", "", `{"username": "loginlender", "password": "wrong"}`)
+	rr := doRequest(t, s, "POST", "/api/auth/login", "", `{"username": "loginlender", "password": "Str0ng!Passw0rd"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tokens loginResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+	rr = doRequest(t, s, "GET", "/api/audit-log", tokens.AccessToken, "")
+	var page auditLogResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	actions := []string{}
+	for _, e := range page.Entries {
+		actions = append(actions, e.Action)
+	}
+	want := []string{models.AuditAccountLogin, models.AuditAccountLoginFailed, models.AuditLenderRegistered}
+	if fmt.Sprint(actions) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, actions)
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/currency"
+	"wisetech-lms-api/internal/httpx"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/utils"
+)
+
+// loginRequest is the body accepted by the login endpoint
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Validate checks that both credentials were given
+func (req *loginRequest) Validate() error {
+	v := httpx.Violations{}
+	if req.Username == "" {
+		v.Add("username", "is required")
+	}
+	if req.Password == "" {
+		v.Add("password", "is required")
+	}
+	return v.Err()
+}
+
+// loginResponse carries the token pair issued on a successful login
+type loginResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// registerRequest is the body accepted by the registration endpoint. currency defaults to
+// Cfg.DefaultCurrency.
+type registerRequest struct {
+	BusinessName        string   `json:"business_name"`
+	Email               string   `json:"email"`
+	PhoneNumber         string   `json:"phone_number"`
+	Username            string   `json:"username"`
+	Password            string   `json:"password"`
+	InterestRatePercent *float64 `json:"interest_rate_percent"`
+	Currency            string   `json:"currency"`
+	Website             string   `json:"website"` // Honeypot: hidden from people by the signup form, so only bots fill it in
+}
+
+// Validate trims the text fields and checks them. Bodies filling in the honeypot pass unchecked, so
+// bots are answered the same whatever else they send.
+func (req *registerRequest) Validate() error {
+	if req.Website != "" {
+		return nil
+	}
+	req.BusinessName = strings.TrimSpace(req.BusinessName)
+	req.Email = strings.TrimSpace(req.Email)
+	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
+	req.Username = strings.TrimSpace(req.Username)
+
+	v := httpx.Violations{}
+	if req.BusinessName == "" {
+		v.Add("business_name", "is required")
+	}
+	if !strings.Contains(req.Email, "@") {
+		v.Add("email", "must be a valid email address")
+	}
+	if req.PhoneNumber == "" {
+		v.Add("phone_number", "is required")
+	}
+	if req.Username == "" {
+		v.Add("username", "is required")
+	}
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		v.Add("password", strings.TrimPrefix(err.Error(), "password "))
+	}
+	if req.InterestRatePercent == nil || *req.InterestRatePercent < 0 || *req.InterestRatePercent > 100 {
+		v.Add("interest_rate_percent", "must be between 0 and 100")
+	}
+	if _, ok := currency.Normalize(req.Currency); req.Currency != "" && !ok {
+		v.Add("currency", "must be an ISO 4217 currency code")
+	}
+	return v.Err()
+}
+
+// registerResponse carries the new lender and a token pair for its account
+type registerResponse struct {
+	loginResponse
+	Lender *models.Lender `json:"lender"`
+}
+
+// register creates a lender with its first account, starting it on the trial plan when one
+// exists, and logs the account in. The lender's currency is an ISO 4217 code that labels its loan
+// and receipt amounts; it is fixed at registration so existing amounts never change meaning.
+// Each client address may register Cfg.RegistrationDailyLimit lenders per 24 hours, counting only
+// those created, and gets 429 beyond that. The limit is checked up front to spare hashing the
+// password, and enforced again in the transaction creating the lender, so concurrent requests
+// cannot all slip under it. Requests filling in the website honeypot get 201 without
+// a lender being created.
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := httpx.Decode(w, r, &req); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	ip := clientIP(r)
+	if req.Website != "" {
+		s.logger.WarnContext(r.Context(), "Dropped registration that filled in the honeypot field", "ip", ip)
+		writeJSON(w, http.StatusCreated, registerResponse{})
+		return
+	}
+	limit := repository.RegistrationLimit{IP: ip, Max: s.Cfg.RegistrationDailyLimit, Since: time.Now().Add(-24 * time.Hour)}
+	if limit.Max > 0 {
+		count, err := s.authRepo.CountRegistrations(ip, limit.Since)
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		if count >= limit.Max {
+			writeRegistrationLimit(w)
+			return
+		}
+	}
+	code := s.Cfg.DefaultCurrency
+	if req.Currency != "" {
+		code, _ = currency.Normalize(req.Currency)
+	}
+	if err := s.checkPasswordBreach(r.Context(), req.Password); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	accountID, err := s.authRepo.RegisterLender(limit, req.BusinessName, req.Email, req.PhoneNumber, req.Username,
+		passwordHash, *req.InterestRatePercent, code)
+	if errors.Is(err, repository.ErrRegistrationLimit) {
+		writeRegistrationLimit(w)
+		return
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	lender, err := s.authRepo.GetLenderByAccountID(accountID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.features.Invalidate(lender.LenderID) // Registration started the lender's trial
+	ctx := audit.WithSource(r.Context(), audit.AccountSource(accountID, ip))
+	s.auditor.Record(ctx, audit.Event{LenderID: lender.LenderID, Action: models.AuditLenderRegistered, ResourceType: "lender", ResourceID: lender.LenderID})
+	tokens, err := auth.GenerateTokenPair(int64(accountID), int64(lender.LenderID), s.Cfg.JWTSecret)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, registerResponse{
+		loginResponse: loginResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken},
+		Lender:        lender,
+	})
+}
+
+// writeRegistrationLimit responds 429 to a client address that registered too many lenders
+func writeRegistrationLimit(w http.ResponseWriter) {
+	writeError(w, http.StatusTooManyRequests, "registration_limit_reached", "too many registrations from this address; try again later")
+}
+
+// login exchanges a username and password for a token pair.
+// Accounts are temporarily locked after Cfg.LoginMaxAttempts consecutive failures; while locked,
+// attempts get 429 with Retry-After without the password being checked. Hard-locked accounts
+// and suspended lenders get 403.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := httpx.Decode(w, r, &req); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	account, err := s.authRepo.GetAccountByUsername(req.Username)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountNotFound) {
+			writeError(w, http.StatusUnauthorized, "invalid_credentials", "invalid username or password")
+			return
+		}
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	ctx := audit.WithSource(r.Context(), audit.AccountSource(account.AccountID, clientIP(r)))
+	now := time.Now()
+	if account.TemporarilyLocked(now) {
+		writeLockedOut(w, account.LockedUntil.Time, now)
+		return
+	}
+
+	if err := utils.CheckPassword(account.PasswordHash, req.Password); err != nil {
+		lockedUntil, err := s.authRepo.RecordFailedLogin(account.AccountID, s.Cfg.LoginMaxAttempts, s.Cfg.LoginLockout, now)
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		if lockedUntil.Valid {
+			s.logger.WarnContext(r.Context(), "Account temporarily locked after failed logins", "account_id", account.AccountID, "locked_until", lockedUntil.Time.Format(time.RFC3339))
+		}
+		s.auditor.Record(ctx, audit.Event{LenderID: account.LenderID, Action: models.AuditAccountLoginFailed, ResourceType: "account", ResourceID: account.AccountID})
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "invalid username or password")
+		return
+	}
+
+	status, err := s.authRepo.GetAccountStatus(account.AccountID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if status.LenderSuspended {
+		writeError(w, http.StatusForbidden, "suspended", "this lender has been suspended")
+		return
+	}
+	if account.IsLocked {
+		writeError(w, http.StatusForbidden, "account_locked", "this account is locked")
+		return
+	}
+
+	tokens, err := auth.GenerateTokenPair(int64(account.AccountID), int64(account.LenderID), s.Cfg.JWTSecret)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.authRepo.UpdateLastLogin(account.AccountID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(ctx, audit.Event{LenderID: account.LenderID, Action: models.AuditAccountLogin, ResourceType: "account", ResourceID: account.AccountID})
+
+	writeJSON(w, http.StatusOK, loginResponse{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken})
+}
+
+// clientIP returns the address of the client that sent the request, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeLockedOut responds 429 with the seconds until the temporary lockout ends in Retry-After
+func writeLockedOut(w http.ResponseWriter, until, now time.Time) {
+	retryAfter := int(math.Ceil(until.Sub(now).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, http.StatusTooManyRequests, "account_temporarily_locked", "too many failed logins; try again later")
+}
+
+// meResponse is the payload returned by the /auth/me endpoint
+type meResponse struct {
+	Account      *models.Account    `json:"account"`
+	Lender       *models.Lender     `json:"lender"`
+	Subscription *subscriptionState `json:"subscription"`
+}
+
+// me returns the authenticated account, its lender and the lender's subscription state
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	account, err := s.authRepo.GetAccountByID(int(claims.AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	lender, err := s.authRepo.GetLenderByAccountID(account.AccountID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	state, err := s.loadSubscriptionState(r.Context(), lender.LenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, meResponse{
+		Account:      account,
+		Lender:       lender,
+		Subscription: state,
+	})
+}
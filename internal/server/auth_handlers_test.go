@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/httpx"
+	"wisetech-lms-api/internal/utils"
+)
+
+// registerLoginLender creates a lender whose account can log in with the given password.
+func registerLoginLender(t *testing.T, s *Server, username, password string) int {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountID, err := s.authRepo.CreateLenderAndAccount(username+" Business", username+"@example.com", "123", username, hash, 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to register lender: %v", err)
+	}
+	return accountID
+}
+
+func TestRegister(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	register := func(username, currency string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"business_name": "%s Loans", "email": "%s@example.com", "phone_number": "555",
+			"username": "%s", "password": "Secret123", "interest_rate_percent": 10, "currency": "%s"}`, username, username, username, currency)
+		return doRequest(t, s, "POST", "/api/auth/register", "", body)
+	}
+
+	// Test case 1: A valid currency is stored, normalized, and the new account is logged in
+	rr := register("rand", "zar")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp registerResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Lender == nil || resp.Lender.Currency != "ZAR" || resp.Lender.BusinessName != "rand Loans" || resp.AccessToken == "" {
+		t.Fatalf("Unexpected registration: %s", rr.Body.String())
+	}
+	if me := doRequest(t, s, "GET", "/api/auth/me", resp.AccessToken, ""); me.Code != http.StatusOK || !strings.Contains(me.Body.String(), `"currency":"ZAR"`) {
+		t.Errorf("Expected the token to work and the lender to be in ZAR, got %d %s", me.Code, me.Body.String())
+	}
+
+	// Test case 2: Without a currency the configured default is used
+	rr = register("maloti", "")
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusCreated || resp.Lender.Currency != "LSL" {
+		t.Errorf("Expected the default currency LSL, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Codes outside ISO 4217 are rejected and nothing is created
+	for _, code := range []string{"RAND", "XXX", "12"} {
+		if rr := register("invalid"+code, code); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "currency") {
+			t.Errorf("Expected status 422 for currency %q, got %d %s", code, rr.Code, rr.Body.String())
+		}
+	}
+	var lenders int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Lenders").Scan(&lenders)
+	if lenders != 2 {
+		t.Errorf("Expected 2 lenders, got %d", lenders)
+	}
+
+	// Test case 4: Taken usernames and weak passwords are refused
+	if rr := register("rand", "ZAR"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken username, got %d", rr.Code)
+	}
+	weak := `{"business_name": "Weak", "email": "weak@example.com", "phone_number": "555", "username": "weak", "password": "secret", "interest_rate_percent": 10}`
+	if rr := doRequest(t, s, "POST", "/api/auth/register", "", weak); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a weak password, got %d", rr.Code)
+	}
+}
+
+// bodyErrorCase is a request body a handler must reject with the given status, code and, when
+// set, the fields named in the error
+type bodyErrorCase struct {
+	name   string
+	body   string
+	status int
+	code   string
+	fields []string
+}
+
+// checkBodyErrors sends each case's body and checks the error envelope it gets back
+func checkBodyErrors(t *testing.T, s *Server, method, path, token string, cases []bodyErrorCase) {
+	t.Helper()
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doRequest(t, s, method, path, token, tt.body)
+			var resp errorResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if rr.Code != tt.status || resp.Error.Code != tt.code {
+				t.Fatalf("Expected %d %s, got %d: %s", tt.status, tt.code, rr.Code, rr.Body.String())
+			}
+			if len(resp.Error.Fields) != len(tt.fields) {
+				t.Errorf("Expected fields %v, got %v", tt.fields, resp.Error.Fields)
+			}
+			for _, field := range tt.fields {
+				if resp.Error.Fields[field] == "" {
+					t.Errorf("Expected %s named in the fields, got %v", field, resp.Error.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestRegister_InvalidBodies(t *testing.T) {
+	s := newTestServer(t)
+	valid := `"business_name": "Body Loans", "email": "body@example.com", "phone_number": "555", "username": "body", "password": "Secret123"`
+
+	checkBodyErrors(t, s, "POST", "/api/auth/register", "", []bodyErrorCase{
+		{"empty", "", http.StatusBadRequest, "empty_body", nil},
+		{"malformed", `{"business_name": "Body Loans",}`, http.StatusBadRequest, "malformed_json", nil},
+		{"truncated", `{` + valid, http.StatusBadRequest, "malformed_json", nil},
+		{"too large", `{"business_name": "` + strings.Repeat("a", httpx.MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", nil},
+		{"unknown field", `{` + valid + `, "interest_rate_percent": 10, "plan": "gold"}`, http.StatusUnprocessableEntity, "unknown_field", []string{"plan"}},
+		{"wrong type", `{` + valid + `, "interest_rate_percent": "10"}`, http.StatusUnprocessableEntity, "invalid_type", []string{"interest_rate_percent"}},
+		{"missing rate", `{` + valid + `}`, http.StatusUnprocessableEntity, "validation_error", []string{"interest_rate_percent"}},
+		{"every rule broken", `{"email": "nobody", "password": "secret", "interest_rate_percent": 101, "currency": "RAND"}`, http.StatusUnprocessableEntity, "validation_error",
+			[]string{"business_name", "email", "phone_number", "username", "password", "interest_rate_percent", "currency"}},
+	})
+
+	var lenders int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Lenders").Scan(&lenders)
+	if lenders != 0 {
+		t.Errorf("Expected no lenders created, got %d", lenders)
+	}
+}
+
+func TestLogin_InvalidBodies(t *testing.T) {
+	s := newTestServer(t)
+
+	checkBodyErrors(t, s, "POST", "/api/auth/login", "", []bodyErrorCase{
+		{"empty", "", http.StatusBadRequest, "empty_body", nil},
+		{"malformed", `username=me&password=secret`, http.StatusBadRequest, "malformed_json", nil},
+		{"two values", `{"username": "me", "password": "secret"} {}`, http.StatusBadRequest, "malformed_json", nil},
+		{"unknown field", `{"username": "me", "password": "secret", "remember": true}`, http.StatusUnprocessableEntity, "unknown_field", []string{"remember"}},
+		{"wrong type", `{"username": ["me"], "password": "secret"}`, http.StatusUnprocessableEntity, "invalid_type", []string{"username"}},
+		{"missing credentials", `{}`, http.StatusUnprocessableEntity, "validation_error", []string{"username", "password"}},
+	})
+}
+
+func TestRegister_RateLimitedPerAddress(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.RegistrationDailyLimit = 2
+	register := func(username, password, remoteAddr, extra string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"business_name": "%s Loans", "email": "%s@example.com", "phone_number": "555",
+			"username": "%s", "password": "%s", "interest_rate_percent": 10%s}`, username, username, username, password, extra)
+		req := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		s.NewRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Failed attempts do not count towards the limit
+	for i := 0; i < 3; i++ {
+		if rr := register("weak", "secret", "198.51.100.7:4000", ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("Expected status 422 for a weak password, got %d", rr.Code)
+		}
+	}
+	for _, username := range []string{"first", "second"} {
+		if rr := register(username, "Secret123", "198.51.100.7:4001", ""); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 for %s, got %d: %s", username, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 2: Past the limit the address gets 429, whatever its port
+	rr := register("third", "Secret123", "198.51.100.7:4002", "")
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "registration_limit_reached") {
+		t.Fatalf("Expected status 429, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Other addresses are unaffected, and registrations a day old no longer count
+	if rr := register("elsewhere", "Secret123", "203.0.113.9:4000", ""); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 from another address, got %d", rr.Code)
+	}
+	s.DB.Exec("UPDATE Registrations SET Created_At = ? WHERE IP_Address = '198.51.100.7'", time.Now().Add(-25*time.Hour).UTC().Format(time.RFC3339))
+	if rr := register("third", "Secret123", "198.51.100.7:4003", ""); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 once the earlier registrations expired, got %d", rr.Code)
+	}
+
+	// Test case 4: Filling in the honeypot looks like success but creates nothing and counts nothing
+	rr = register("bot", "Secret123", "192.0.2.50:4000", `, "website": "http://spam.example"`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for the honeypot, got %d", rr.Code)
+	}
+	var lenders, registrations int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Lenders WHERE Email = 'bot@example.com'").Scan(&lenders)
+	s.DB.QueryRow("SELECT COUNT(*) FROM Registrations WHERE IP_Address = '192.0.2.50'").Scan(&registrations)
+	if lenders != 0 || registrations != 0 {
+		t.Errorf("Expected no lender or registration for the bot, got %d and %d", lenders, registrations)
+	}
+}
+
+func TestLogin_TemporaryLockoutExpires(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.LoginMaxAttempts = 3
+	s.Cfg.LoginLockout = 15 * time.Minute
+	accountID := registerLoginLender(t, s, "forgetful", "Correct-Horse-1")
+	good := `{"username":"forgetful","password":"Correct-Horse-1"}`
+	bad := `{"username":"forgetful","password":"wrong"}`
+
+	// Test case 1: Failures below the threshold are plain 401s
+	for i := 0; i < 3; i++ {
+		if rr := doRequest(t, s, "POST", "/api/auth/login", "", bad); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401 on failure %d, got %d", i+1, rr.Code)
+		}
+	}
+
+	// Test case 2: Once locked even the right password is refused
+	rr := doRequest(t, s, "POST", "/api/auth/login", "", good)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected status 429 with Retry-After, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: After the lockout ends the account logs in and the lockout is cleared
+	if _, err := s.DB.Exec("UPDATE Accounts SET Locked_Until = ? WHERE Account_ID = ?", time.Now().Add(-time.Minute).UTC(), accountID); err != nil {
+		t.Fatal(err)
+	}
+	rr = doRequest(t, s, "POST", "/api/auth/login", "", good)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 after the lockout, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tokens loginResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("Expected a token pair, got %+v", tokens)
+	}
+	if rr := doRequest(t, s, "GET", "/api/auth/me", tokens.AccessToken, ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the new token to work, got %d", rr.Code)
+	}
+	account, _ := s.authRepo.GetAccountByID(accountID)
+	if account.LockedUntil.Valid || account.FailedLoginAttempts != 0 {
+		t.Errorf("Expected the lockout to be cleared, got %+v", account)
+	}
+}
+
+func TestLogin_HardLockDoesNotExpire(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.LoginMaxAttempts = 3
+	s.Cfg.LoginLockout = 15 * time.Minute
+	accountID := registerLoginLender(t, s, "hardlocked", "Correct-Horse-1")
+	if _, err := s.DB.Exec("UPDATE Accounts SET Is_Locked = 1, Locked_Until = ? WHERE Account_ID = ?", time.Now().Add(-time.Hour).UTC(), accountID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test case 1: The right password is refused with 403 even with no temporary lockout
+	rr := doRequest(t, s, "POST", "/api/auth/login", "", `{"username":"hardlocked","password":"Correct-Horse-1"}`)
+	var errResp errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if rr.Code != http.StatusForbidden || errResp.Error.Code != "account_locked" {
+		t.Errorf("Expected 403 account_locked, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: Unknown users get the same 401 as wrong passwords
+	rr = doRequest(t, s, "POST", "/api/auth/login", "", `{"username":"nobody","password":"x"}`)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
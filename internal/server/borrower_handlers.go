@@ -0,0 +1,339 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/httpx"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/scoring"
+)
+
+// borrowerRequest is the body accepted when creating or updating a borrower.
+// The structured address fields are preferred; residence is only stored as given when none are set.
+type borrowerRequest struct {
+	Fullnames    string `json:"fullnames"`
+	Email        string `json:"email"`
+	PhoneNumber  string `json:"phone_number"`
+	Residence    string `json:"residence"`
+	AddressLine1 string `json:"address_line1"`
+	City         string `json:"city"`
+	Region       string `json:"region"`
+	PostalCode   string `json:"postal_code"`
+	Country      string `json:"country"`
+
+	Custom map[string]json.RawMessage `json:"custom"` // Values of the lender's borrower custom fields
+}
+
+// Validate trims the required fields and checks them
+func (req *borrowerRequest) Validate() error {
+	req.Fullnames = strings.TrimSpace(req.Fullnames)
+	req.Email = strings.TrimSpace(req.Email)
+	req.PhoneNumber = strings.TrimSpace(req.PhoneNumber)
+
+	v := httpx.Violations{}
+	if req.Fullnames == "" {
+		v.Add("fullnames", "is required")
+	}
+	if !strings.Contains(req.Email, "@") {
+		v.Add("email", "must be a valid email address")
+	}
+	if req.PhoneNumber == "" {
+		v.Add("phone_number", "is required")
+	}
+	return v.Err()
+}
+
+// borrowerResponse is a borrower with the caller's custom field values merged in
+type borrowerResponse struct {
+	*models.Borrower
+	Custom map[string]any `json:"custom"`
+}
+
+// decodeBorrowerRequest reads and validates a borrower body into a Borrower model, returning
+// its custom values undecoded for validateCustomFields
+func decodeBorrowerRequest(w http.ResponseWriter, r *http.Request) (*models.Borrower, map[string]json.RawMessage, error) {
+	var req borrowerRequest
+	if err := httpx.Decode(w, r, &req); err != nil {
+		return nil, nil, err
+	}
+
+	return &models.Borrower{
+		Fullnames:    req.Fullnames,
+		Email:        req.Email,
+		PhoneNumber:  req.PhoneNumber,
+		Residence:    nullString(strings.TrimSpace(req.Residence)),
+		AddressLine1: nullString(strings.TrimSpace(req.AddressLine1)),
+		City:         nullString(strings.TrimSpace(req.City)),
+		Region:       nullString(strings.TrimSpace(req.Region)),
+		PostalCode:   nullString(strings.TrimSpace(req.PostalCode)),
+		Country:      nullString(strings.TrimSpace(req.Country)),
+	}, req.Custom, nil
+}
+
+// planLimitResponse is the 402 body returned when a plan limit is reached
+type planLimitResponse struct {
+	errorResponse
+	Limit int `json:"limit"`
+	Used  int `json:"used"`
+}
+
+// borrowerLimitReached writes 402 borrower_limit_reached and returns true when the lender's plan caps
+// max_borrowers and that many active borrowers already have loans with it. Borrowers are shared
+// between lenders and only count once lent to, so a borrowerID the lender has lent to before is
+// always allowed; pass 0 to check whether any new borrower can be taken on. Other failures are
+// written as errors and also return true.
+func (s *Server) borrowerLimitReached(w http.ResponseWriter, r *http.Request, lenderID, borrowerID int) bool {
+	features, err := s.features.Get(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return true
+	}
+	limit := features.MaxBorrowers
+	if limit <= 0 {
+		return false
+	}
+	if borrowerID != 0 {
+		lent, err := s.borrowerRepo.HasLoanWithLender(lenderID, borrowerID)
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return true
+		}
+		if lent {
+			return false
+		}
+	}
+	used, err := s.borrowerRepo.CountActiveByLender(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return true
+	}
+	if used < limit {
+		return false
+	}
+	writeJSON(w, http.StatusPaymentRequired, planLimitResponse{
+		errorResponse: newErrorResponse(w, "borrower_limit_reached", fmt.Sprintf("your plan allows at most %d borrowers", limit)),
+		Limit:         limit,
+		Used:          used,
+	})
+	return true
+}
+
+// createBorrower registers a new borrower with the caller's custom field values. Lenders whose plan
+// caps max_borrowers get 402 once that many active borrowers have loans with them.
+func (s *Server) createBorrower(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	borrower, input, err := decodeBorrowerRequest(w, r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if s.borrowerLimitReached(w, r, lenderID, 0) {
+		return
+	}
+	custom, err := s.validateCustomFields(lenderID, models.CustomFieldEntityBorrower, input, nil)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	borrowerID, err := s.borrowerRepo.CreateBorrower(borrower)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.customFieldRepo.SetValues(lenderID, models.CustomFieldEntityBorrower, borrowerID, custom); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditBorrowerCreated, ResourceType: "borrower", ResourceID: borrowerID})
+
+	s.writeBorrower(w, r, http.StatusCreated, lenderID, borrowerID)
+}
+
+// updateBorrower replaces the details of a borrower the caller has lent to. Custom fields left
+// out of the body keep their stored values; a null clears one.
+func (s *Server) updateBorrower(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	borrowerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid borrower id"))
+		return
+	}
+
+	borrower, input, err := decodeBorrowerRequest(w, r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	borrower.BorrowerID = borrowerID
+
+	stored, err := s.customFieldRepo.GetValues(lenderID, models.CustomFieldEntityBorrower, borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	custom, err := s.validateCustomFields(lenderID, models.CustomFieldEntityBorrower, input, stored)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	if err := s.borrowerRepo.UpdateBorrower(lenderID, borrower); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.customFieldRepo.SetValues(lenderID, models.CustomFieldEntityBorrower, borrowerID, custom); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditBorrowerUpdated, ResourceType: "borrower", ResourceID: borrowerID})
+
+	s.writeBorrower(w, r, http.StatusOK, lenderID, borrowerID)
+}
+
+// writeBorrower responds with the borrower and the caller's custom field values for it
+func (s *Server) writeBorrower(w http.ResponseWriter, r *http.Request, status, lenderID, borrowerID int) {
+	borrower, err := s.borrowerRepo.GetBorrowerByID(borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	custom, err := s.customFieldRepo.GetValues(lenderID, models.CustomFieldEntityBorrower, borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, status, borrowerResponse{Borrower: borrower, Custom: custom})
+}
+
+// borrowerRiskResponse is a borrower's risk score with the history it was computed from
+type borrowerRiskResponse struct {
+	BorrowerID int             `json:"borrower_id"`
+	AsOf       string          `json:"as_of"` // YYYY-MM-DD
+	History    scoring.History `json:"history"`
+	scoring.Score
+}
+
+// getBorrowerRisk scores one of the caller's borrowers from their history with the caller, with the
+// breakdown of each component so the score can be explained. Borrowers the caller has never lent to get 404.
+func (s *Server) getBorrowerRisk(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	borrowerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid borrower id"))
+		return
+	}
+	statements, err := s.loanRepo.ListBorrowerStatements(int(claims.LenderID), borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if len(statements) == 0 {
+		s.writeServiceError(w, r, repository.ErrBorrowerNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	history := scoring.BuildHistory(statements, now)
+	writeJSON(w, http.StatusOK, borrowerRiskResponse{
+		BorrowerID: borrowerID,
+		AsOf:       now.Format(time.DateOnly),
+		History:    history,
+		Score:      scoring.Compute(history),
+	})
+}
+
+// sendBorrowerVerification emails a borrower the caller has lent to a link confirming their email
+// address. The link carries a token from auth.GenerateEmailVerifyToken, valid for an hour.
+// Borrowers whose email is already verified get 409. The email is only queued, and the email
+// dispatcher delivers it, so the request succeeds even when the mailer is down.
+func (s *Server) sendBorrowerVerification(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	borrowerID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid borrower id"))
+		return
+	}
+	statements, err := s.loanRepo.ListBorrowerStatements(lenderID, borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if len(statements) == 0 {
+		s.writeServiceError(w, r, repository.ErrBorrowerNotFound)
+		return
+	}
+	borrower, err := s.borrowerRepo.GetBorrowerByID(borrowerID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if borrower.EmailVerified {
+		writeError(w, http.StatusConflict, "email_already_verified", "the borrower's email is already verified")
+		return
+	}
+
+	token, err := auth.GenerateEmailVerifyToken(int64(borrowerID), borrower.Email, s.Cfg.JWTSecret)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	link := strings.TrimRight(s.Cfg.AppBaseURL, "/") + "/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hello %s,\n\nUse the link below to confirm your email address. It expires in %d minutes.\n\n%s\n\nIf you did not expect this email, ignore it.\n",
+		borrower.Fullnames, int(auth.EmailVerifyTokenDuration.Minutes()), link)
+	if err := s.emails.Enqueue(r.Context(), lenderID, models.NotificationEmailVerification, borrower.Email, "Confirm your email address", body); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditBorrowerVerifySent, ResourceType: "borrower", ResourceID: borrowerID})
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "a verification link will be sent shortly"})
+}
+
+// verifyBorrowerEmail marks a borrower's email verified using the token from a verification email.
+// It needs no bearer token: the verification token is the only credential, and it cannot be used
+// for anything else. A token sent before the borrower's email changed is rejected, so it cannot
+// verify the new address.
+func (s *Server) verifyBorrowerEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		s.writeServiceError(w, r, httperr.Validation("token is required"))
+		return
+	}
+	claims, err := auth.ValidateEmailVerifyToken(token, s.Cfg.JWTSecret)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_verification_token", "verification token is invalid or expired")
+		return
+	}
+	borrower, err := s.borrowerRepo.GetBorrowerByID(int(claims.BorrowerID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if !claims.Verifies(borrower.Email) {
+		s.writeServiceError(w, r, repository.ErrBorrowerEmailChanged)
+		return
+	}
+	if err := s.borrowerRepo.VerifyBorrowerEmail(borrower.BorrowerID, borrower.Email); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"borrower_id": borrower.BorrowerID, "email_verified": true})
+}
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/httpx"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+func TestCreateBorrower_StructuredAddress(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "borrowerlender")
+
+	// Test case 1: Full address
+	rr := doRequest(t, s, "POST", "/api/borrowers", token,
+		`{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "555", "address_line1": "12 Kingsway", "city": "Maseru", "region": "Maseru District", "postal_code": "100", "country": "LS"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var full models.Borrower
+	json.Unmarshal(rr.Body.Bytes(), &full)
+	if full.City.String != "Maseru" || full.PostalCode.String != "100" || full.Residence.String != "12 Kingsway, Maseru, Maseru District, 100, LS" {
+		t.Errorf("Unexpected borrower: %+v", full)
+	}
+
+	// Test case 2: Partial address
+	rr = doRequest(t, s, "POST", "/api/borrowers", token,
+		`{"fullnames": "Lineo K", "email": "lineo@example.com", "phone_number": "555", "city": "Leribe"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var partial models.Borrower
+	json.Unmarshal(rr.Body.Bytes(), &partial)
+	if partial.City.String != "Leribe" || partial.Country.Valid || partial.Residence.String != "Leribe" {
+		t.Errorf("Unexpected borrower: %+v", partial)
+	}
+
+	// Test case 3: Duplicate email
+	rr = doRequest(t, s, "POST", "/api/borrowers", token,
+		`{"fullnames": "Other", "email": "lineo@example.com", "phone_number": "555"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rr.Code)
+	}
+
+	// Test case 4: Missing required fields
+	rr = doRequest(t, s, "POST", "/api/borrowers", token, `{"email": "x@example.com"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestBorrower_InvalidBodies(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "bodylender")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	cases := []bodyErrorCase{
+		{"empty", "", http.StatusBadRequest, "empty_body", nil},
+		{"malformed", `{"fullnames": "Body B"`, http.StatusBadRequest, "malformed_json", nil},
+		{"too large", `{"fullnames": "` + strings.Repeat("a", httpx.MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", nil},
+		{"unknown field", `{"fullnames": "Body B", "email": "body@example.com", "phone_number": "555", "nickname": "B"}`, http.StatusUnprocessableEntity, "unknown_field", []string{"nickname"}},
+		{"wrong type", `{"fullnames": "Body B", "email": "body@example.com", "phone_number": 555}`, http.StatusUnprocessableEntity, "invalid_type", []string{"phone_number"}},
+		{"blank fields", `{"fullnames": "  ", "email": "body", "phone_number": ""}`, http.StatusUnprocessableEntity, "validation_error", []string{"fullnames", "email", "phone_number"}},
+	}
+
+	// Test case 1: Creating a borrower
+	checkBodyErrors(t, s, "POST", "/api/borrowers", token, cases)
+
+	// Test case 2: Updating one
+	checkBodyErrors(t, s, "PUT", fmt.Sprintf("/api/borrowers/%d", borrowerID), token, cases)
+}
+
+func TestUpdateBorrower(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "updatelender")
+	_, _, otherToken := registerTestLender(t, s, "otherlender")
+
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	path := fmt.Sprintf("/api/borrowers/%d", borrowerID)
+	body := `{"fullnames": "Moved Borrower", "email": "moved@example.com", "phone_number": "555", "city": "Mafeteng", "country": "LS"}`
+
+	// Test case 1: Another lender cannot see the borrower
+	rr := doRequest(t, s, "PUT", path, otherToken, body)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender, got %d", rr.Code)
+	}
+
+	// Test case 2: The borrower's lender updates the address
+	rr = doRequest(t, s, "PUT", path, token, body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var updated models.Borrower
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.City.String != "Mafeteng" || updated.Residence.String != "Mafeteng, LS" || updated.Fullnames != "Moved Borrower" {
+		t.Errorf("Unexpected borrower: %+v", updated)
+	}
+}
+
+func TestBorrowerRisk(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "scorer")
+	_, _, otherToken := registerTestLender(t, s, "otherscorer")
+	loanID := seedLoan(t, s, lenderID, "defaulted", 1000, 10, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	path := fmt.Sprintf("/api/borrowers/%d/risk", borrowerID)
+
+	// Test case 1: The score comes with its components
+	rr := doRequest(t, s, "GET", path, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var risk borrowerRiskResponse
+	json.Unmarshal(rr.Body.Bytes(), &risk)
+	if risk.BorrowerID != borrowerID || risk.History.DefaultedLoans != 1 || len(risk.Components) != 4 {
+		t.Fatalf("Unexpected risk: %+v", risk)
+	}
+	// No instalments due yet and no tenure, but one default: 20 + 15 + 20 + 0
+	if risk.Score.Score != 55 {
+		t.Errorf("Expected a score of 55, got %d (%+v)", risk.Score.Score, risk.Components)
+	}
+
+	// Test case 2: Other lenders have never lent to the borrower
+	if rr := doRequest(t, s, "GET", path, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+
+	// Test case 3: A new loan to the borrower carries the score as advice
+	rr = doRequest(t, s, "POST", "/api/loans", token, fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6}`, borrowerID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created loanResponse
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.Risk == nil || created.Risk.Score != 55 {
+		t.Errorf("Expected the advisory score 55, got %+v", created.Risk)
+	}
+}
+
+func TestBorrowerEmailVerification(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	mail := &captureMailer{}
+	useMailer(s, mail)
+	_, lenderID, token := registerTestLender(t, s, "verifier")
+	_, _, otherToken := registerTestLender(t, s, "otherverifier")
+
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	sendPath := fmt.Sprintf("/api/borrowers/%d/send-verification", borrowerID)
+	verified := func() bool {
+		borrower, err := s.borrowerRepo.GetBorrowerByID(borrowerID)
+		if err != nil {
+			t.Fatalf("GetBorrowerByID failed: %v", err)
+		}
+		return borrower.EmailVerified
+	}
+
+	// Test case 1: Only lenders who lent to the borrower can send the link
+	if rr := doRequest(t, s, "POST", sendPath, otherToken, ""); rr.Code != http.StatusNotFound || len(mail.sent) != 0 {
+		t.Errorf("Expected 404 and no mail for another lender, got %d with %d sent", rr.Code, len(mail.sent))
+	}
+
+	// Test case 2: The link is queued and the dispatcher emails it to the borrower
+	rr := doRequest(t, s, "POST", sendPath, token, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mail.sent) != 0 {
+		t.Fatalf("Expected the request to only queue the email, got %+v", mail.sent)
+	}
+	if sent, err := s.emails.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the queued email sent, got %d, %v", sent, err)
+	}
+	borrower, _ := s.borrowerRepo.GetBorrowerByID(borrowerID)
+	if len(mail.sent) != 1 || mail.sent[0].To != borrower.Email {
+		t.Fatalf("Expected one email to the borrower, got %+v", mail.sent)
+	}
+	match := resetTokenPattern.FindStringSubmatch(mail.sent[0].Body)
+	if match == nil {
+		t.Fatalf("Expected the email to contain a token, got %q", mail.sent[0].Body)
+	}
+	verifyToken, _ := url.QueryUnescape(match[1])
+
+	// Test case 3: The verification token cannot act as an access token
+	if rr := doRequest(t, s, "GET", "/api/auth/me", verifyToken, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 using the verification token, got %d", rr.Code)
+	}
+
+	// Test case 4: Access tokens and malformed tokens do not verify the email
+	for _, bad := range []string{token, "not-a-token"} {
+		if rr := doRequest(t, s, "GET", "/api/borrowers/verify?token="+url.QueryEscape(bad), "", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rr.Code)
+		}
+	}
+	if verified() {
+		t.Fatal("Expected the email to be unverified")
+	}
+
+	// Test case 5: The token flips the flag, without a bearer token
+	rr = doRequest(t, s, "GET", "/api/borrowers/verify?token="+url.QueryEscape(verifyToken), "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !verified() {
+		t.Error("Expected the email to be verified")
+	}
+	if rr := doRequest(t, s, "POST", sendPath, token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 once verified, got %d", rr.Code)
+	}
+
+	// Test case 6: Changing the email clears the verification, other updates keep it
+	body := `{"fullnames": "Test Borrower", "email": %q, "phone_number": "777"}`
+	doRequest(t, s, "PUT", fmt.Sprintf("/api/borrowers/%d", borrowerID), token, fmt.Sprintf(body, borrower.Email))
+	if !verified() {
+		t.Error("Expected the verification to survive a phone number change")
+	}
+	doRequest(t, s, "PUT", fmt.Sprintf("/api/borrowers/%d", borrowerID), token, fmt.Sprintf(body, "new-address@example.com"))
+	if verified() {
+		t.Error("Expected a new email to be unverified")
+	}
+
+	// Test case 7: A link sent to the old address cannot verify the new one
+	rr = doRequest(t, s, "GET", "/api/borrowers/verify?token="+url.QueryEscape(verifyToken), "", "")
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_verification_token") {
+		t.Errorf("Expected 400 invalid_verification_token, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if verified() {
+		t.Error("Expected the new email to stay unverified")
+	}
+}
+
+func TestBorrowerEmailVerification_MailerDown(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	useMailer(s, failingMailer{})
+	_, lenderID, token := registerTestLender(t, s, "unsentverifier")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+
+	// Test case 1: The request succeeds without reaching the mailer
+	rr := doRequest(t, s, "POST", fmt.Sprintf("/api/borrowers/%d/send-verification", borrowerID), token, "")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "mail server unavailable") {
+		t.Errorf("Expected no delivery details in the response, got %s", rr.Body.String())
+	}
+
+	// Test case 2: A failed delivery leaves the email queued for a retry
+	if sent, err := s.emails.RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("Expected nothing sent, got %d, %v", sent, err)
+	}
+	pending, _, _ := s.notificationRepo.List(repository.NotificationFilter{Status: models.NotificationPending, LenderID: lenderID, Limit: 10})
+	if len(pending) != 1 || pending[0].Kind != models.NotificationEmailVerification || pending[0].LastError.String != "mail server unavailable" {
+		t.Errorf("Expected the verification email queued for a retry, got %+v", pending)
+	}
+}
+
+func TestCreateBorrower_PlanLimit(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "limitedlender")
+	var trialID int
+	s.DB.QueryRow("SELECT Plan_ID FROM Plans WHERE Is_Trial = 1").Scan(&trialID)
+	if err := s.planRepo.SetFeatures(trialID, models.PlanFeatures{MaxBorrowers: 2}); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	s.features.InvalidateAll()
+	seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	create := func(email string) *httptest.ResponseRecorder {
+		return doRequest(t, s, "POST", "/api/borrowers", token, `{"fullnames": "Limited", "email": "`+email+`", "phone_number": "555"}`)
+	}
+
+	// Test case 1: Under the limit, borrowers are created
+	if rr := create("under@example.com"); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: At the limit, creation is refused with the limit
+	paidLoan := seedLoan(t, s, lenderID, "paid", 1000, 10, 6)
+	rr := create("over@example.com")
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("Expected status 402, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var limited planLimitResponse
+	json.Unmarshal(rr.Body.Bytes(), &limited)
+	if limited.Error.Code != "borrower_limit_reached" || limited.Limit != 2 || limited.Used != 2 {
+		t.Errorf("Unexpected response: %+v", limited)
+	}
+
+	// Test case 3: Anonymized borrowers no longer count
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", paidLoan).Scan(&borrowerID)
+	if err := s.borrowerRepo.AnonymizeBorrower(borrowerID); err != nil {
+		t.Fatalf("AnonymizeBorrower failed: %v", err)
+	}
+	if rr := create("over@example.com"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 after anonymizing, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: A plan without a limit is unlimited
+	s.planRepo.SetFeatures(trialID, models.PlanFeatures{})
+	s.features.InvalidateAll()
+	seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	if rr := create("unlimited@example.com"); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 without a limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCreateLoan_BorrowerPlanLimit(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "loanlimited")
+	var trialID int
+	s.DB.QueryRow("SELECT Plan_ID FROM Plans WHERE Is_Trial = 1").Scan(&trialID)
+	if err := s.planRepo.SetFeatures(trialID, models.PlanFeatures{MaxBorrowers: 2}); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	s.features.InvalidateAll()
+	lend := func(borrowerID int) *httptest.ResponseRecorder {
+		return doRequest(t, s, "POST", "/api/loans", token, fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6}`, borrowerID))
+	}
+
+	// Test case 1: Borrowers nobody has lent to yet do not count, so more than the limit can be created
+	var borrowers []int
+	for i := 0; i < 3; i++ {
+		rr := doRequest(t, s, "POST", "/api/borrowers", token, fmt.Sprintf(`{"fullnames": "Borrower %d", "email": "limit%d@example.com", "phone_number": "555"}`, i, i))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating borrower %d, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+		var borrower models.Borrower
+		json.Unmarshal(rr.Body.Bytes(), &borrower)
+		borrowers = append(borrowers, borrower.BorrowerID)
+	}
+
+	// Test case 2: Lending to them is refused once the limit is reached
+	for _, borrowerID := range borrowers[:2] {
+		if rr := lend(borrowerID); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 under the limit, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	rr := lend(borrowers[2])
+	var limited planLimitResponse
+	json.Unmarshal(rr.Body.Bytes(), &limited)
+	if rr.Code != http.StatusPaymentRequired || limited.Error.Code != "borrower_limit_reached" || limited.Limit != 2 || limited.Used != 2 {
+		t.Errorf("Expected 402 borrower_limit_reached, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Borrowers already lent to can take further loans
+	if rr := lend(borrowers[0]); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for an existing borrower, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// customFieldRequest is the body accepted when defining or updating a custom field. Only name
+// and required can be changed after creation.
+type customFieldRequest struct {
+	Entity   string `json:"entity"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// listCustomFields returns the caller's custom field definitions, optionally for one ?entity=
+func (s *Server) listCustomFields(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	entity := r.URL.Query().Get("entity")
+	if entity != "" && entity != models.CustomFieldEntityBorrower && entity != models.CustomFieldEntityLoan {
+		s.writeServiceError(w, r, httperr.Validation("entity must be borrower or loan"))
+		return
+	}
+
+	defs, err := s.customFieldRepo.ListDefinitions(int(claims.LenderID), entity)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, defs)
+}
+
+// createCustomField defines a new custom field on the caller's borrowers or loans
+func (s *Server) createCustomField(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req customFieldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	switch {
+	case req.Entity != models.CustomFieldEntityBorrower && req.Entity != models.CustomFieldEntityLoan:
+		s.writeServiceError(w, r, httperr.Validation("entity must be borrower or loan"))
+		return
+	case !customValueName.MatchString(req.Name):
+		s.writeServiceError(w, r, httperr.Validation("name must start with a lowercase letter and contain only lowercase letters, digits and underscores (at most 64)"))
+		return
+	}
+	switch req.Type {
+	case models.CustomFieldTypeText, models.CustomFieldTypeNumber, models.CustomFieldTypeDate, models.CustomFieldTypeBool:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("type must be text, number, date or bool"))
+		return
+	}
+
+	def := &models.CustomFieldDefinition{
+		LenderID:  int(claims.LenderID),
+		Entity:    req.Entity,
+		Name:      req.Name,
+		FieldType: req.Type,
+		Required:  req.Required,
+	}
+	if err := s.customFieldRepo.CreateDefinition(def); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: def.LenderID, Action: models.AuditCustomFieldCreated, ResourceType: "custom_field", ResourceID: def.DefinitionID, Details: def})
+	writeJSON(w, http.StatusCreated, def)
+}
+
+// updateCustomField renames one of the caller's custom fields or changes whether it is required.
+// Making a field required does not backfill existing records; they must supply it on their next update.
+func (s *Server) updateCustomField(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	definitionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid custom field id"))
+		return
+	}
+
+	var req customFieldRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if !customValueName.MatchString(req.Name) {
+		s.writeServiceError(w, r, httperr.Validation("name must start with a lowercase letter and contain only lowercase letters, digits and underscores (at most 64)"))
+		return
+	}
+
+	def, err := s.customFieldRepo.GetDefinition(lenderID, definitionID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if (req.Entity != "" && req.Entity != def.Entity) || (req.Type != "" && req.Type != def.FieldType) {
+		s.writeServiceError(w, r, httperr.Validation("the entity and type of a custom field cannot be changed"))
+		return
+	}
+
+	def.Name, def.Required = req.Name, req.Required
+	if err := s.customFieldRepo.UpdateDefinition(def); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	updated, err := s.customFieldRepo.GetDefinition(lenderID, definitionID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditCustomFieldUpdated, ResourceType: "custom_field", ResourceID: definitionID, Details: updated})
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteCustomField removes one of the caller's custom fields and every value stored for it
+func (s *Server) deleteCustomField(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	definitionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid custom field id"))
+		return
+	}
+
+	if err := s.customFieldRepo.DeleteDefinition(int(claims.LenderID), definitionID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditCustomFieldDeleted, ResourceType: "custom_field", ResourceID: definitionID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCustomFields checks the custom object of a borrower or loan payload against the
+// lender's definitions for entity and returns the typed values to store, with nil for values
+// being cleared. stored holds the record's current values (nil when creating it); every required
+// field must have a value once input is applied over them.
+func (s *Server) validateCustomFields(lenderID int, entity string, input map[string]json.RawMessage, stored map[string]any) (map[string]any, error) {
+	defs, err := s.customFieldRepo.ListDefinitions(lenderID, entity)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.CustomFieldDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+
+	values := make(map[string]any, len(input))
+	for name, raw := range input {
+		def, ok := byName[name]
+		if !ok {
+			return nil, httperr.Field("custom."+name, "is not a defined "+entity+" field")
+		}
+		value, err := parseCustomFieldValue(def, raw)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+
+	for _, def := range defs {
+		if !def.Required {
+			continue
+		}
+		value, given := values[def.Name]
+		if !given {
+			value = stored[def.Name]
+		}
+		if value == nil {
+			return nil, httperr.Field("custom."+def.Name, "is required")
+		}
+	}
+	return values, nil
+}
+
+// parseCustomFieldValue decodes a JSON value of a custom field, checking it against the field's
+// type. JSON null decodes to nil.
+func parseCustomFieldValue(def models.CustomFieldDefinition, raw json.RawMessage) (any, error) {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, httperr.BadRequest("invalid value for custom." + def.Name)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	ok := false
+	switch def.FieldType {
+	case models.CustomFieldTypeText:
+		var text string
+		if text, ok = value.(string); ok {
+			value = strings.TrimSpace(text)
+		}
+	case models.CustomFieldTypeNumber:
+		_, ok = value.(float64)
+	case models.CustomFieldTypeDate:
+		var date string
+		if date, ok = value.(string); ok {
+			_, err := time.Parse(time.DateOnly, date)
+			ok = err == nil
+		}
+	case models.CustomFieldTypeBool:
+		_, ok = value.(bool)
+	}
+	if !ok {
+		return nil, httperr.Field("custom."+def.Name, "must be a "+def.FieldType)
+	}
+	return value, nil
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCustomFieldDefinitions(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "fielddefiner")
+	_, _, otherToken := registerTestLender(t, s, "otherdefiner")
+
+	// Test case 1: Define a field
+	rr := doRequest(t, s, "POST", "/api/custom-fields", token, `{"entity": "borrower", "name": "village", "type": "text", "required": true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var def models.CustomFieldDefinition
+	json.Unmarshal(rr.Body.Bytes(), &def)
+	path := fmt.Sprintf("/api/custom-fields/%d", def.DefinitionID)
+
+	// Test case 2: Duplicate names and invalid definitions are rejected
+	if rr := doRequest(t, s, "POST", "/api/custom-fields", token, `{"entity": "borrower", "name": "village", "type": "number"}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "POST", "/api/custom-fields", token, `{"entity": "lender", "name": "x", "type": "text"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown entity, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "POST", "/api/custom-fields", token, `{"entity": "loan", "name": "x", "type": "json"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown type, got %d", rr.Code)
+	}
+
+	// Test case 3: Rename and relax it, but not retype it
+	rr = doRequest(t, s, "PUT", path, token, `{"name": "home_village", "required": false}`)
+	json.Unmarshal(rr.Body.Bytes(), &def)
+	if rr.Code != http.StatusOK || def.Name != "home_village" || def.Required {
+		t.Errorf("Unexpected update: %d %+v", rr.Code, def)
+	}
+	if rr := doRequest(t, s, "PUT", path, token, `{"name": "home_village", "type": "number"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a type change, got %d", rr.Code)
+	}
+
+	// Test case 4: Listing is per lender and per entity
+	rr = doRequest(t, s, "GET", "/api/custom-fields?entity=borrower", token, "")
+	var defs []models.CustomFieldDefinition
+	json.Unmarshal(rr.Body.Bytes(), &defs)
+	if len(defs) != 1 || defs[0].Name != "home_village" {
+		t.Errorf("Unexpected definitions: %+v", defs)
+	}
+	rr = doRequest(t, s, "GET", "/api/custom-fields", otherToken, "")
+	if rr.Body.String() != "[]\n" {
+		t.Errorf("Expected no definitions for another lender, got %s", rr.Body.String())
+	}
+
+	// Test case 5: Delete
+	if rr := doRequest(t, s, "DELETE", path, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "DELETE", path, token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+}
+
+func TestCustomFieldValues(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "fieldvalues")
+
+	for _, body := range []string{
+		`{"entity": "borrower", "name": "village", "type": "text", "required": true}`,
+		`{"entity": "borrower", "name": "chiefs_reference", "type": "number"}`,
+		`{"entity": "loan", "name": "approved_on", "type": "date"}`,
+		`{"entity": "loan", "name": "guaranteed", "type": "bool"}`,
+	} {
+		if rr := doRequest(t, s, "POST", "/api/custom-fields", token, body); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 1: Required, unknown and mistyped values are rejected
+	for _, custom := range []string{
+		`{}`,
+		`{"village": "Ha Foso", "unknown": 1}`,
+		`{"village": 12}`,
+		`{"village": "Ha Foso", "chiefs_reference": "12"}`,
+	} {
+		rr := doRequest(t, s, "POST", "/api/borrowers", token,
+			`{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "555", "custom": `+custom+`}`)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", custom, rr.Code)
+		}
+	}
+
+	// Test case 2: Valid values are stored and merged into the borrower
+	rr := doRequest(t, s, "POST", "/api/borrowers", token,
+		`{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "555", "custom": {"village": "Ha Foso", "chiefs_reference": 42}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var borrower borrowerResponse
+	json.Unmarshal(rr.Body.Bytes(), &borrower)
+	if borrower.Fullnames != "Thabo M" || borrower.Custom["village"] != "Ha Foso" || borrower.Custom["chiefs_reference"] != 42.0 {
+		t.Errorf("Unexpected borrower: %s", rr.Body.String())
+	}
+
+	// Test case 3: An update keeps omitted values, clears nulls, and still requires required ones
+	borrowerPath := fmt.Sprintf("/api/borrowers/%d", borrower.BorrowerID)
+	loanBody := fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6, "custom": {"approved_on": "2026-03-01", "guaranteed": true}}`, borrower.BorrowerID)
+	rr = doRequest(t, s, "POST", "/api/loans", token, loanBody)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var loan loanResponse
+	json.Unmarshal(rr.Body.Bytes(), &loan)
+	if loan.Custom["approved_on"] != "2026-03-01" || loan.Custom["guaranteed"] != true {
+		t.Errorf("Unexpected loan: %s", rr.Body.String())
+	}
+
+	rr = doRequest(t, s, "PUT", borrowerPath, token,
+		`{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "556", "custom": {"chiefs_reference": null}}`)
+	borrower = borrowerResponse{}
+	json.Unmarshal(rr.Body.Bytes(), &borrower)
+	if rr.Code != http.StatusOK || borrower.Custom["village"] != "Ha Foso" || len(borrower.Custom) != 1 {
+		t.Errorf("Unexpected update: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = doRequest(t, s, "PUT", borrowerPath, token,
+		`{"fullnames": "Thabo M", "email": "thabo@example.com", "phone_number": "556", "custom": {"village": null}}`)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "custom.village is required") {
+		t.Errorf("Expected 422 clearing a required field, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: Loan dates must be YYYY-MM-DD
+	rr = doRequest(t, s, "POST", "/api/loans", token, fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6, "custom": {"approved_on": "01/03/2026"}}`, borrower.BorrowerID))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a malformed date, got %d", rr.Code)
+	}
+}
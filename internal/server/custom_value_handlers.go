@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// customValueName is the accepted shape of a custom value name, e.g. branch_code
+var customValueName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// customValueRequest is the body accepted when setting a custom value. A JSON string is stored
+// as text and a JSON number as a number.
+type customValueRequest struct {
+	Value any    `json:"value"`
+	Group string `json:"group"`
+}
+
+// listCustomValues returns the caller's custom values as a flat name to value map, optionally
+// limited to one group with ?group=
+func (s *Server) listCustomValues(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	group := r.URL.Query().Get("group")
+
+	values, err := s.customValueRepo.GetAllByLender(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	flat := make(map[string]any, len(values))
+	for _, v := range values {
+		if group != "" && v.Group.String != group {
+			continue
+		}
+		flat[v.Name] = v.Value
+	}
+	writeJSON(w, http.StatusOK, flat)
+}
+
+// getCustomValue returns one of the caller's custom values with its type and group
+func (s *Server) getCustomValue(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	value, err := s.customValueRepo.GetByName(int(claims.LenderID), chi.URLParam(r, "name"))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, value)
+}
+
+// setCustomValue creates or replaces one of the caller's custom values. Setting a value of a
+// different type than the stored one changes its type.
+func (s *Server) setCustomValue(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+	name := chi.URLParam(r, "name")
+	if !customValueName.MatchString(name) {
+		s.writeServiceError(w, r, httperr.Validation("name must start with a lowercase letter and contain only lowercase letters, digits and underscores (at most 64)"))
+		return
+	}
+
+	var req customValueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+
+	if name == models.SettingMaxActiveLoansPerBorrower {
+		if v, ok := req.Value.(float64); !ok || v < 0 || v != math.Trunc(v) {
+			s.writeServiceError(w, r, httperr.Validation(name+" must be a whole number, 0 for unlimited"))
+			return
+		}
+	}
+	if name == models.SettingFinanceOriginationFee {
+		if v, ok := req.Value.(float64); !ok || (v != 0 && v != 1) {
+			s.writeServiceError(w, r, httperr.Validation(name+" must be 0 or 1"))
+			return
+		}
+	}
+	if name == models.SettingMaxBorrowerExposure {
+		if v, ok := req.Value.(float64); !ok || v < 0 {
+			s.writeServiceError(w, r, httperr.Validation(name+" must be a non-negative amount, 0 for no limit"))
+			return
+		}
+	}
+
+	var err error
+	switch v := req.Value.(type) {
+	case string:
+		err = s.customValueRepo.UpsertText(lenderID, name, req.Group, v)
+	case float64:
+		err = s.customValueRepo.UpsertNumber(lenderID, name, req.Group, v)
+	default:
+		s.writeServiceError(w, r, httperr.Validation("value must be a string or a number"))
+		return
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(lenderID) // Settings such as max_borrower_exposure shape reports
+
+	value, err := s.customValueRepo.GetByName(lenderID, name)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditCustomValueSet, ResourceType: "custom_value", Details: value})
+	writeJSON(w, http.StatusOK, value)
+}
+
+// deleteCustomValue removes one of the caller's custom values
+func (s *Server) deleteCustomValue(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	name := chi.URLParam(r, "name")
+	if err := s.customValueRepo.Delete(int(claims.LenderID), name); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditCustomValueDeleted, ResourceType: "custom_value", Details: map[string]string{"name": name}})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestCustomValues(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "customvalues")
+
+	// Test case 1: Strings are stored as text and numbers as numbers
+	rr := doRequest(t, s, "PUT", "/api/custom-values/branch_code", token, `{"value": "MAS01", "group": "branch"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var value models.CustomValue
+	json.Unmarshal(rr.Body.Bytes(), &value)
+	if value.Type != models.CustomValueText || value.Value != "MAS01" || value.Group.String != "branch" {
+		t.Errorf("Unexpected value: %+v", value)
+	}
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/default_penalty", token, `{"value": 50}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: The listing is a flat map, optionally filtered by group
+	rr = doRequest(t, s, "GET", "/api/custom-values", token, "")
+	if rr.Body.String() != `{"branch_code":"MAS01","default_penalty":50}`+"\n" {
+		t.Errorf("Unexpected listing: %s", rr.Body.String())
+	}
+	rr = doRequest(t, s, "GET", "/api/custom-values?group=branch", token, "")
+	if rr.Body.String() != `{"branch_code":"MAS01"}`+"\n" {
+		t.Errorf("Unexpected group listing: %s", rr.Body.String())
+	}
+
+	// Test case 3: Get by name, then delete
+	rr = doRequest(t, s, "GET", "/api/custom-values/default_penalty", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &value)
+	if rr.Code != http.StatusOK || value.Type != models.CustomValueNumber || value.Value != 50.0 {
+		t.Errorf("Unexpected value: %d %+v", rr.Code, value)
+	}
+	if rr := doRequest(t, s, "DELETE", "/api/custom-values/default_penalty", token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/custom-values/default_penalty", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", rr.Code)
+	}
+
+	// Test case 4: Invalid names and values are rejected
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/Branch-Code", token, `{"value": "x"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid name, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/flag", token, `{"value": true}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a boolean value, got %d", rr.Code)
+	}
+}
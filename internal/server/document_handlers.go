@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/pdf"
+	"wisetech-lms-api/internal/reports"
+)
+
+// documentDate is how dates are printed on generated documents
+const documentDate = "2 January 2006"
+
+// getLoanStatement renders one of the caller's loans with its payments as a PDF statement,
+// branded with the lender's document settings
+func (s *Server) getLoanStatement(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	st, err := s.loanRepo.GetStatement(int(claims.LenderID), loanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	lender, brand, err := s.documentBranding(r.Context(), int(claims.AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	money := func(v float64) string { return fmt.Sprintf("%s %.2f", lender.Currency, v) }
+	loan := st.Loan
+	doc := pdf.New("Loan statement", brand)
+	doc.Field("Statement date", time.Now().UTC().Format(documentDate))
+	doc.Field("Loan number", strconv.Itoa(loan.LoanID))
+	doc.Field("Borrower", st.BorrowerName)
+	doc.Heading("Loan")
+	doc.Field("Status", loan.PaymentStatus)
+	doc.Field("Principal", money(loan.Amount))
+	doc.Field("Interest rate", strconv.FormatFloat(loan.InterestRate, 'f', -1, 64)+"%")
+	doc.Field("Term", fmt.Sprintf("%d months", loan.MonthsToPay))
+	if loan.MonthlyPayment.Valid {
+		doc.Field("Monthly payment", money(loan.MonthlyPayment.Float64))
+	}
+	doc.Field("Start date", loan.StartDate.Format(documentDate))
+	if loan.EndDate.Valid {
+		doc.Field("End date", loan.EndDate.Time.Format(documentDate))
+	}
+
+	doc.Heading("Payments")
+	if len(st.Receipts) == 0 {
+		doc.Field("No payments recorded", "")
+	} else {
+		rows := make([][]string, len(st.Receipts))
+		for i, receipt := range st.Receipts {
+			rows[i] = []string{receipt.Timestamp.Format(time.DateOnly), receipt.Status, receipt.PaymentMethod.String,
+				receipt.TransactionReference.String, money(receipt.Amount)}
+		}
+		doc.Table([]string{"Date", "Status", "Method", "Reference", "Amount"}, rows)
+	}
+	doc.Heading("Summary")
+	doc.Field("Total paid", money(st.TotalPaid))
+
+	s.writePDF(w, r, doc, fmt.Sprintf("loan-%d-statement.pdf", loan.LoanID))
+}
+
+// getReceiptPDF renders one of the caller's receipts as a PDF, branded with the lender's document settings
+func (s *Server) getReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	receiptID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid receipt id"))
+		return
+	}
+	receipt, err := s.receiptRepo.GetReceipt(int(claims.LenderID), receiptID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	lender, brand, err := s.documentBranding(r.Context(), int(claims.AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	doc := pdf.New("Payment receipt", brand)
+	receiptFields(doc, receipt, lender.Currency)
+
+	s.writePDF(w, r, doc, fmt.Sprintf("receipt-%d.pdf", receipt.ReceiptID))
+}
+
+// getLoanReceiptsPDF renders every paid receipt of one of the caller's loans as a single PDF, one
+// receipt per page, laid out like the receipt PDF. A loan without paid receipts gets a statement
+// page saying no payments were recorded.
+func (s *Server) getLoanReceiptsPDF(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	st, err := s.loanRepo.GetStatement(int(claims.LenderID), loanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	lender, brand, err := s.documentBranding(r.Context(), int(claims.AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	doc := pdf.New("Payment receipts", brand)
+	paid := 0
+	for _, receipt := range st.Receipts {
+		if receipt.Status != "paid" {
+			continue
+		}
+		doc.PageBreak()
+		receiptFields(doc, &receipt, lender.Currency)
+		paid++
+	}
+	if paid == 0 {
+		doc.Field("Statement date", time.Now().UTC().Format(documentDate))
+		doc.Field("Loan number", strconv.Itoa(st.Loan.LoanID))
+		doc.Field("Borrower", st.BorrowerName)
+		doc.Heading("Payments")
+		doc.Field("No payments recorded", "")
+	}
+
+	s.writePDF(w, r, doc, fmt.Sprintf("loan-%d-receipts.pdf", st.Loan.LoanID))
+}
+
+// receiptFields adds a receipt's details to doc, with amounts in currency
+func receiptFields(doc *pdf.Document, receipt *models.Receipt, currency string) {
+	doc.Field("Receipt number", strconv.Itoa(receipt.ReceiptID))
+	doc.Field("Date", receipt.Timestamp.Format(documentDate))
+	doc.Field("Loan number", strconv.Itoa(receipt.LoanID))
+	doc.Field("Amount", fmt.Sprintf("%s %.2f", currency, receipt.Amount))
+	doc.Field("Status", receipt.Status)
+	if receipt.PaymentMethod.Valid {
+		doc.Field("Payment method", receipt.PaymentMethod.String)
+	}
+	if receipt.TransactionReference.Valid {
+		doc.Field("Reference", receipt.TransactionReference.String)
+	}
+	if receipt.Notes.Valid {
+		doc.Field("Notes", receipt.Notes.String)
+	}
+}
+
+// writePortfolioPDF renders a portfolio summary as a PDF report, on plans with pdf_statements
+func (s *Server) writePortfolioPDF(w http.ResponseWriter, r *http.Request, summary *reports.Portfolio) {
+	lender, doc, ok := s.startReportPDF(w, r, "Portfolio report")
+	if !ok {
+		return
+	}
+	money := func(v float64) string { return fmt.Sprintf("%s %.2f", lender.Currency, v) }
+
+	asOf, _ := time.Parse(time.DateOnly, summary.AsOf)
+	doc.Field("As of", asOf.Format(documentDate))
+	doc.Heading("Loans by status")
+	rows := make([][]string, 0, len(summary.Loans)+1)
+	var count int
+	var principal float64
+	for _, total := range summary.Loans {
+		rows = append(rows, []string{total.Status, strconv.Itoa(total.Count), money(total.Principal)})
+		count += total.Count
+		principal += total.Principal
+	}
+	rows = append(rows, []string{"Total", strconv.Itoa(count), money(principal)})
+	doc.Table([]string{"Status", "Loans", "Principal"}, rows)
+
+	doc.Heading("Outstanding")
+	doc.Field("Principal", money(summary.Outstanding.Principal))
+	doc.Field("Interest", money(summary.Outstanding.Interest))
+	doc.Field("Total", money(summary.Outstanding.Total))
+	doc.Field("Portfolio at risk", fmt.Sprintf("%.2f%%", summary.PortfolioAtRisk))
+	doc.Heading("Collected")
+	doc.Field("Principal", money(summary.Collected.Principal))
+	doc.Field("Interest", money(summary.Collected.Interest))
+	doc.Field("Penalties", money(summary.Collected.Penalties))
+	doc.Field("Total", money(summary.Collected.Total))
+	doc.Field("Average loan size", money(summary.AverageLoanSize))
+
+	s.writePDF(w, r, doc, fmt.Sprintf("portfolio-%s.pdf", summary.AsOf))
+}
+
+// writeIncomePDF renders an income report as a PDF report, on plans with pdf_statements
+func (s *Server) writeIncomePDF(w http.ResponseWriter, r *http.Request, report *reports.Income) {
+	lender, doc, ok := s.startReportPDF(w, r, "Income report")
+	if !ok {
+		return
+	}
+	money := func(v float64) string { return fmt.Sprintf("%.2f", v) }
+
+	from, _ := time.Parse("2006-01", report.From)
+	to, _ := time.Parse("2006-01", report.To)
+	doc.Field("Period", from.Format("January 2006")+" to "+to.Format("January 2006"))
+	doc.Field("Currency", lender.Currency)
+	doc.Heading("Collected per month")
+	amounts := func(label string, a reports.Split) []string {
+		return []string{label, money(a.Principal), money(a.Interest), money(a.Penalties), money(a.Total)}
+	}
+	rows := make([][]string, 0, len(report.Months)+1)
+	for _, month := range report.Months {
+		rows = append(rows, amounts(month.Month, month.Split))
+	}
+	rows = append(rows, amounts("Total", report.Totals))
+	doc.Table([]string{"Month", "Principal", "Interest", "Penalties", "Total"}, rows)
+
+	doc.Heading("Totals")
+	doc.Field("Principal", lender.Currency+" "+money(report.Totals.Principal))
+	doc.Field("Interest", lender.Currency+" "+money(report.Totals.Interest))
+	doc.Field("Penalties", lender.Currency+" "+money(report.Totals.Penalties))
+	doc.Field("Total collected", lender.Currency+" "+money(report.Totals.Total))
+
+	s.writePDF(w, r, doc, fmt.Sprintf("income-%s-to-%s.pdf", report.From, report.To))
+}
+
+// startReportPDF checks the caller's plan includes PDF documents and starts a branded report with
+// the time it was generated. ok is false once a response has been written.
+func (s *Server) startReportPDF(w http.ResponseWriter, r *http.Request, title string) (*models.Lender, *pdf.Document, bool) {
+	allowed, err := s.hasFeature(r.Context(), models.FeaturePDFStatements)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return nil, nil, false
+	}
+	if !allowed {
+		writeError(w, http.StatusPaymentRequired, "feature_not_available", "your plan does not include "+models.FeaturePDFStatements)
+		return nil, nil, false
+	}
+	lender, brand, err := s.documentBranding(r.Context(), int(claimsFromContext(r.Context()).AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return nil, nil, false
+	}
+	doc := pdf.New(title, brand)
+	doc.Field("Generated", time.Now().UTC().Format(documentDate+" 15:04 UTC"))
+	return lender, doc, true
+}
+
+// documentBranding loads the caller's lender and how its documents present it. A logo that is
+// not yet scanned clean, or cannot be read, is left off rather than failing the document.
+func (s *Server) documentBranding(ctx context.Context, accountID int) (*models.Lender, pdf.Branding, error) {
+	lender, err := s.authRepo.GetLenderByAccountID(accountID)
+	if err != nil {
+		return nil, pdf.Branding{}, err
+	}
+	settings, err := s.lenderRepo.GetBranding(lender.LenderID)
+	if err != nil {
+		return nil, pdf.Branding{}, err
+	}
+
+	brand := pdf.Branding{BusinessName: lender.BusinessName, Footer: settings.FooterText}
+	if settings.ShowContactDetails {
+		brand.Contact = []string{lender.PhoneNumber, lender.Email}
+	}
+	if c := settings.PrimaryColor; c != "" {
+		if v, err := strconv.ParseUint(c[1:], 16, 32); err == nil {
+			brand.Color = color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}
+		}
+	}
+
+	logoID := settings.LogoFileID
+	if !logoID.Valid {
+		logoID = lender.LogoFileID
+	}
+	if logoID.Valid {
+		if brand.Logo, err = s.loadImage(ctx, lender.LenderID, int(logoID.Int64)); err != nil {
+			s.logger.WarnContext(ctx, "Leaving logo off the document", "file_id", logoID.Int64, "lender_id", lender.LenderID, "error", err)
+		}
+	}
+	return lender, brand, nil
+}
+
+// loadImage decodes one of the lender's clean image files
+func (s *Server) loadImage(ctx context.Context, lenderID, fileID int) (image.Image, error) {
+	file, err := s.fileRepo.GetFileByID(lenderID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("file status is %s", file.Status)
+	}
+	store, err := s.files.For(file.StorageBackend)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := store.Open(ctx, file.Value)
+	if err != nil {
+		return nil, err
+	}
+	defer contents.Close()
+	data, err := io.ReadAll(io.LimitReader(contents, maxLogoSize))
+	if err != nil {
+		return nil, err
+	}
+
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(header.Width)*int64(header.Height) > maxLogoPixels {
+		return nil, fmt.Errorf("image is %dx%d pixels", header.Width, header.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// writePDF renders doc and sends it inline as filename
+func (s *Server) writePDF(w http.ResponseWriter, r *http.Request, doc *pdf.Document, filename string) {
+	data, err := doc.Bytes()
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
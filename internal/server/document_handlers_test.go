@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// enablePDFStatements grants the trial plan the pdf_statements feature.
+func enablePDFStatements(t *testing.T, s *Server) {
+	t.Helper()
+	var trialID int
+	s.DB.QueryRow("SELECT Plan_ID FROM Plans WHERE Is_Trial = 1").Scan(&trialID)
+	if err := s.planRepo.SetFeatures(trialID, models.PlanFeatures{PDFStatements: true}); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	s.features.InvalidateAll()
+}
+
+func TestLoanStatementAndReceiptPDF(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "documents")
+	_, _, otherToken := registerTestLender(t, s, "otherdocs")
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 10, 12)
+	rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanID), token,
+		`{"status":"paid","amount":150,"payment_method":"M-Pesa","transaction_reference":"MP-778"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var receipt receiptResponse
+	json.Unmarshal(rr.Body.Bytes(), &receipt)
+	statementPath := fmt.Sprintf("/api/loans/%d/statement", loanID)
+	receiptPath := fmt.Sprintf("/api/receipts/%d/pdf", receipt.ReceiptID)
+
+	// Test case 1: Plans without PDF statements are refused
+	if rr := doRequest(t, s, "GET", statementPath, token, ""); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("Expected status 402, got %d", rr.Code)
+	}
+	enablePDFStatements(t, s)
+
+	// Test case 2: Without branding the documents carry the business name and contact details
+	rr = doRequest(t, s, "GET", statementPath, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected application/pdf, got %q", ct)
+	}
+	body := rr.Body.Bytes()
+	for _, want := range []string{"%PDF-", "(documents Business) Tj", "(documents@example.com) Tj", "(LSL 1200.00) Tj", "(MP-778) Tj", "(LSL 150.00) Tj"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("Expected %q in the statement", want)
+		}
+	}
+
+	// Test case 3: Branding changes the accent, footer, contact details and logo
+	logo := uploadLogo(t, s, token, testImage(t, "png", 8, 8))
+	if logo.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", logo.Code)
+	}
+	scanFiles(t, s)
+	rr = doRequest(t, s, "PUT", "/api/lenders/me/branding", token,
+		`{"primary_color":"#FF6600","footer_text":"Registered credit provider NCR-1234","show_contact_details":false}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{statementPath, receiptPath} {
+		rr = doRequest(t, s, "GET", path, token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		body = rr.Body.Bytes()
+		for _, want := range []string{"(Registered credit provider NCR-1234) Tj", "1 0.4 0 rg", "/Im1 Do", "(documents Business) Tj"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("Expected %q in %s", want, path)
+			}
+		}
+		if bytes.Contains(body, []byte("documents@example.com) Tj")) {
+			t.Errorf("Expected no contact details in %s", path)
+		}
+	}
+	if !bytes.Contains(body, []byte("(Payment receipt) Tj")) || !bytes.Contains(body, []byte("(M-Pesa) Tj")) {
+		t.Error("Expected the receipt details")
+	}
+
+	// Test case 4: Other lenders' loans and receipts are not found
+	if rr := doRequest(t, s, "GET", statementPath, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", receiptPath, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/receipts/abc/pdf", token, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestLoanReceiptsPDF(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "receiptbundle")
+	_, _, otherToken := registerTestLender(t, s, "otherbundle")
+	enablePDFStatements(t, s)
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 10, 12)
+	for _, body := range []string{
+		`{"status":"paid","amount":150,"transaction_reference":"MP-1"}`,
+		`{"status":"failed","amount":150,"transaction_reference":"MP-2"}`,
+		`{"status":"paid","amount":175,"transaction_reference":"MP-3"}`,
+	} {
+		if rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanID), token, body); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	path := fmt.Sprintf("/api/loans/%d/receipts.pdf", loanID)
+
+	// Test case 1: The two paid receipts are rendered on a page each of one valid PDF
+	rr := doRequest(t, s, "GET", path, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.Bytes()
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected application/pdf, got %q", ct)
+	}
+	if !bytes.HasPrefix(body, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Fatal("Expected a PDF header and trailer")
+	}
+	if pages := bytes.Count(body, []byte("/Type /Page /Parent")); pages != 2 || !bytes.Contains(body, []byte("(Page 2 of 2) Tj")) {
+		t.Errorf("Expected 2 numbered pages, got %d", pages)
+	}
+	for _, want := range []string{"(MP-1) Tj", "(LSL 150.00) Tj", "(MP-3) Tj", "(LSL 175.00) Tj"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("Expected %q in the receipts", want)
+		}
+	}
+	if bytes.Contains(body, []byte("(MP-2) Tj")) {
+		t.Error("Expected the failed receipt to be left out")
+	}
+
+	// Test case 2: A loan without paid receipts gets a single statement page
+	emptyID := seedLoan(t, s, lenderID, "active", 500, 10, 6)
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/loans/%d/receipts.pdf", emptyID), token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body := rr.Body.Bytes(); bytes.Count(body, []byte("/Type /Page /Parent")) != 1 || !bytes.Contains(body, []byte("(No payments recorded) Tj")) {
+		t.Error("Expected a one-page statement with no payments")
+	}
+
+	// Test case 3: Other lenders' loans are not found
+	if rr := doRequest(t, s, "GET", path, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
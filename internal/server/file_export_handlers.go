@@ -0,0 +1,187 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// exportBatchSize is how many File rows the export loads at a time
+const exportBatchSize = 100
+
+// exportManifestHeader are the columns of manifest.csv: one row per archive entry, or per file left out
+var exportManifestHeader = []string{"file_id", "path", "status", "file_type", "file_size"}
+
+// exportFiles streams the caller's files as a ZIP archive, in File_ID order, filtered like the file
+// list. Each file is stored once per record it is attached to, under borrowers/<name> (<id>)/,
+// loans/<id>/ or receipts/<id>/, or under unlinked/. Its name starts with its File_ID. manifest.csv
+// lists every matching file; files not scanned clean are listed without being included.
+//
+// The archive is written as it is read, so once it has started an error cannot change the status.
+// The export then ends with export_error.txt; files_after=<id> resumes after the last complete file.
+func (s *Server) exportFiles(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	filter, err := s.parseFileQuery(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	if v := query.Get("linked_to"); v != "" {
+		if filter.LinkedTo, err = parseFileLink(v); err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+	}
+	afterID := 0
+	if v := query.Get("files_after"); v != "" {
+		if afterID, err = strconv.Atoi(v); err != nil || afterID < 0 {
+			s.writeServiceError(w, r, httperr.Validation("files_after must be a file id"))
+			return
+		}
+	}
+
+	// The first batch is loaded before the response starts, so a bad filter still gets an error status
+	batch, err := s.fileRepo.ListFilesForExport(lenderID, filter, afterID, exportBatchSize)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="files-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	manifest := [][]string{exportManifestHeader}
+	for len(batch) > 0 {
+		for _, file := range batch {
+			rows, err := s.exportFile(r.Context(), zw, file)
+			if err != nil {
+				s.logger.ErrorContext(r.Context(), "File export stopped", "lender_id", lenderID, "file_id", file.File.FileID, "error", err)
+				exportStopped(zw, afterID)
+				return
+			}
+			manifest = append(manifest, rows...)
+			afterID = file.File.FileID
+		}
+		if len(batch) < exportBatchSize {
+			break
+		}
+		if batch, err = s.fileRepo.ListFilesForExport(lenderID, filter, afterID, exportBatchSize); err != nil {
+			s.logger.ErrorContext(r.Context(), "File export stopped", "lender_id", lenderID, "after_file_id", afterID, "error", err)
+			exportStopped(zw, afterID)
+			return
+		}
+	}
+
+	if mw, err := zw.Create("manifest.csv"); err == nil {
+		cw := csv.NewWriter(mw)
+		cw.WriteAll(manifest)
+	}
+	if err := zw.Close(); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to finish file export", "lender_id", lenderID, "error", err)
+	}
+}
+
+// exportFile adds one file to the archive under each of its paths and returns its manifest rows.
+// Files that are not clean, or whose contents are missing from the store, get a single row without
+// a path. An error means the archive itself could not be written.
+func (s *Server) exportFile(ctx context.Context, zw *zip.Writer, file models.ExportFile) ([][]string, error) {
+	f := file.File
+	row := []string{strconv.Itoa(f.FileID), "", f.Status, f.FileType.String, ""}
+	if f.FileSize.Valid {
+		row[4] = strconv.FormatInt(f.FileSize.Int64, 10)
+	}
+	if f.Status != models.FileStatusClean {
+		return [][]string{row}, nil
+	}
+	store, err := s.files.For(f.StorageBackend)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Leaving file out of the export", "file_id", f.FileID, "error", err)
+		row[2] = "missing"
+		return [][]string{row}, nil
+	}
+
+	var rows [][]string
+	for _, name := range exportPaths(file) {
+		contents, err := store.Open(ctx, f.Value)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Leaving file out of the export", "file_id", f.FileID, "error", err)
+			row[1], row[2] = "", "missing"
+			return append(rows, row), nil
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: f.UploadedAt.Time})
+		if err == nil {
+			_, err = io.Copy(entry, contents)
+		}
+		contents.Close()
+		if err != nil {
+			return nil, err
+		}
+		row[1] = name
+		rows = append(rows, slices.Clone(row))
+	}
+	return rows, nil
+}
+
+// exportStopped ends an interrupted archive with a note on how to resume it
+func exportStopped(zw *zip.Writer, afterID int) {
+	if note, err := zw.Create("export_error.txt"); err == nil {
+		fmt.Fprintf(note, "The export stopped early. Request it again with files_after=%d to continue after the last complete file.\n", afterID)
+	}
+	zw.Close()
+}
+
+// exportPaths returns the archive paths of a file: one per record it is attached to, or one under unlinked/
+func exportPaths(file models.ExportFile) []string {
+	base := path.Base(file.File.Value)
+	if file.File.OriginalFilename.Valid {
+		base = file.File.OriginalFilename.String
+	}
+	name := strconv.Itoa(file.File.FileID) + "-" + exportSafeName(base)
+	if len(file.Links) == 0 {
+		return []string{"unlinked/" + name}
+	}
+
+	paths := make([]string, 0, len(file.Links))
+	for _, link := range file.Links {
+		switch link.Type {
+		case models.FileLinkBorrower:
+			paths = append(paths, fmt.Sprintf("borrowers/%s (%d)/%s", exportSafeName(link.Name), link.ID, name))
+		case models.FileLinkLoan:
+			paths = append(paths, fmt.Sprintf("loans/%d/%s", link.ID, name))
+		case models.FileLinkReceipt:
+			paths = append(paths, fmt.Sprintf("receipts/%d/%s", link.ID, name))
+		}
+	}
+	return paths
+}
+
+// exportSafeName makes a user-supplied name usable as a single archive path element
+func exportSafeName(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if c == '/' || c == '\\' || c == ':' || unicode.IsControl(c) {
+			return '_'
+		}
+		return c
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
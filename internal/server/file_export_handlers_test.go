@@ -0,0 +1,145 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// readExport opens a ZIP export and returns its entries' contents by name.
+func readExport(t *testing.T, body []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to open the archive: %v", err)
+	}
+	entries := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		entries[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	return entries
+}
+
+func TestExportFiles(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "exporter")
+	_, _, otherToken := registerTestLender(t, s, "otherexporter")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	s.DB.Exec("UPDATE Borrowers SET Fullnames = 'Thabo M/okoena' WHERE Borrower_ID = ?", borrowerID)
+	res, _ := s.DB.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount) VALUES (?, ?, 'paid', 100)", loanID, lenderID)
+	receiptID, _ := res.LastInsertId()
+
+	upload := func(token, name string, data []byte) int {
+		t.Helper()
+		rr := uploadFile(t, s, token, "file", name, data)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var file models.File
+		json.Unmarshal(rr.Body.Bytes(), &file)
+		return file.FileID
+	}
+	idDocument := upload(token, "id.pdf", slices.Concat(pdfHeader, []byte("identity")))
+	slip := upload(token, "slip.pdf", slices.Concat(pdfHeader, []byte("deposit")))
+	loose := upload(token, "loose.pdf", slices.Concat(pdfHeader, []byte("loose")))
+	upload(otherToken, "other.pdf", pdfHeader)
+	scanFiles(t, s)
+	pending := upload(token, "pending.pdf", pdfHeader)
+	for _, attach := range []struct {
+		fileID int
+		body   string
+	}{
+		{idDocument, fmt.Sprintf(`{"type":"borrower","id":%d}`, borrowerID)},
+		{idDocument, fmt.Sprintf(`{"type":"loan","id":%d}`, loanID)},
+		{slip, fmt.Sprintf(`{"type":"receipt","id":%d}`, receiptID)},
+	} {
+		if rr := doRequest(t, s, "POST", fmt.Sprintf("/api/files/%d/attachments", attach.fileID), token, attach.body); rr.Code != http.StatusCreated {
+			t.Fatalf("Attach failed with %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 1: Every clean file is stored under each record it is attached to
+	rr := doRequest(t, s, "GET", "/api/files/export.zip", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Expected application/zip, got %q", ct)
+	}
+	entries := readExport(t, rr.Body.Bytes())
+	idName := fmt.Sprintf("%d-id.pdf", idDocument)
+	want := map[string]string{
+		fmt.Sprintf("borrowers/Thabo M_okoena (%d)/%s", borrowerID, idName): "identity",
+		fmt.Sprintf("loans/%d/%s", loanID, idName):                          "identity",
+		fmt.Sprintf("receipts/%d/%d-slip.pdf", receiptID, slip):             "deposit",
+		fmt.Sprintf("unlinked/%d-loose.pdf", loose):                         "loose",
+	}
+	for name, suffix := range want {
+		if !bytes.HasSuffix(entries[name], []byte(suffix)) {
+			t.Errorf("Expected %s to hold the %q file", name, suffix)
+		}
+	}
+	if len(entries) != len(want)+1 {
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		t.Errorf("Expected %d entries, got %v", len(want)+1, names)
+	}
+
+	// Test case 2: The manifest lists every entry, and the pending file without a path
+	records, err := csv.NewReader(bytes.NewReader(entries["manifest.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read the manifest: %v", err)
+	}
+	if len(records) != 6 || !slices.Equal(records[0], exportManifestHeader) {
+		t.Fatalf("Unexpected manifest: %v", records)
+	}
+	last := records[len(records)-1]
+	if last[0] != fmt.Sprint(pending) || last[1] != "" || last[2] != models.FileStatusPendingScan {
+		t.Errorf("Expected the pending file to be listed without a path, got %v", last)
+	}
+
+	// Test case 3: files_after and the list filters scope the export
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/files/export.zip?files_after=%d", slip), token, "")
+	entries = readExport(t, rr.Body.Bytes())
+	if len(entries) != 2 || entries[fmt.Sprintf("unlinked/%d-loose.pdf", loose)] == nil {
+		t.Errorf("Expected only the files after %d, got %d entries", slip, len(entries))
+	}
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/files/export.zip?linked_to=receipt:%d", receiptID), token, "")
+	entries = readExport(t, rr.Body.Bytes())
+	if len(entries) != 2 || entries[fmt.Sprintf("receipts/%d/%d-slip.pdf", receiptID, slip)] == nil {
+		t.Errorf("Expected only the receipt's file, got %d entries", len(entries))
+	}
+
+	// Test case 4: Invalid parameters and other lenders' records fail before the archive starts
+	for path, status := range map[string]int{
+		"/api/files/export.zip?files_after=-1":                                 http.StatusUnprocessableEntity,
+		"/api/files/export.zip?uploaded_after=yesterday":                       http.StatusUnprocessableEntity,
+		fmt.Sprintf("/api/files/export.zip?linked_to=borrower:%d", borrowerID): http.StatusOK,
+	} {
+		if rr := doRequest(t, s, "GET", path, token, ""); rr.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, path, rr.Code)
+		}
+	}
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/files/export.zip?linked_to=borrower:%d", borrowerID), otherToken, "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's borrower, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,612 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+const (
+	// defaultMaxUploadSize applies when the configuration does not set UploadMaxBytes
+	defaultMaxUploadSize = 10 << 20
+	// multipartOverhead allows for the boundaries and part headers around the uploaded file
+	multipartOverhead = 64 << 10
+	// maxBase64UploadSize caps the decoded size of base64 JSON uploads, which are held in memory
+	// while they are decoded, below the multipart limit
+	maxBase64UploadSize = 2 << 20
+	// base64Overhead allows for the JSON around the encoded data
+	base64Overhead = 4 << 10
+)
+
+// defaultUploadTypes applies when the configuration does not set UploadAllowedTypes
+var defaultUploadTypes = []string{"application/pdf", "image/png", "image/jpeg"}
+
+// uploadExtensions maps sniffed content types to the extension of the stored file
+var uploadExtensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"text/plain":      ".txt",
+	"application/zip": ".zip",
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// storageUsage is the total size of a lender's files against its plan's storage quota.
+// Quota and Remaining are null when the plan leaves storage unlimited.
+type storageUsage struct {
+	UsedBytes      int64  `json:"used_bytes"`
+	QuotaBytes     *int64 `json:"quota_bytes"`
+	RemainingBytes *int64 `json:"remaining_bytes"`
+}
+
+// quotaExceededResponse is the 413 body for an upload that would exceed the storage quota
+type quotaExceededResponse struct {
+	errorResponse
+	Usage storageUsage `json:"usage"`
+}
+
+// loadStorageUsage returns the lender's storage usage against its current plan's quota
+func (s *Server) loadStorageUsage(lenderID int) (storageUsage, error) {
+	features, err := s.features.Get(lenderID)
+	if err != nil {
+		return storageUsage{}, err
+	}
+	used, err := s.fileRepo.GetStorageUsage(lenderID)
+	if err != nil {
+		return storageUsage{}, err
+	}
+	usage := storageUsage{UsedBytes: used}
+	if quota := features.MaxStorageBytes; quota > 0 {
+		remaining := max(quota-used, 0)
+		usage.QuotaBytes = &quota
+		usage.RemainingBytes = &remaining
+	}
+	return usage, nil
+}
+
+// writeQuotaExceeded reports a full storage quota as 413 with the current usage
+func writeQuotaExceeded(w http.ResponseWriter, usage storageUsage) {
+	writeJSON(w, http.StatusRequestEntityTooLarge, quotaExceededResponse{
+		errorResponse: newErrorResponse(w, "storage_quota_exceeded", "upload would exceed your plan's storage quota"),
+		Usage:         usage,
+	})
+}
+
+// fileListItem is a listed file with a URL its contents can be downloaded from
+type fileListItem struct {
+	models.FileListing
+	URL string `json:"url,omitempty"` // Empty when the file's backend is not configured
+}
+
+// fileListResponse is one page of a lender's files
+type fileListResponse struct {
+	Files  []fileListItem `json:"files"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// listFiles returns the authenticated lender's files, newest first. Supports file_type,
+// uploaded_after, uploaded_before, filename (a substring of the original filename), linked_to
+// (borrower:{id}, loan:{id} or receipt:{id}), limit and offset query parameters.
+func (s *Server) listFiles(w http.ResponseWriter, r *http.Request) {
+	filter, err := s.parseFileFilter(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if v := r.URL.Query().Get("linked_to"); v != "" {
+		if filter.LinkedTo, err = parseFileLink(v); err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+	}
+	s.writeFileList(w, r, filter)
+}
+
+// listBorrowerFiles returns the files attached to one of the caller's borrowers or to receipts on
+// their loans, with the same filters as listFiles.
+func (s *Server) listBorrowerFiles(w http.ResponseWriter, r *http.Request) {
+	s.listLinkedFiles(w, r, models.FileLinkBorrower, "invalid borrower id")
+}
+
+// listLoanFiles returns the files attached to one of the caller's loans or to its receipts, with
+// the same filters as listFiles.
+func (s *Server) listLoanFiles(w http.ResponseWriter, r *http.Request) {
+	s.listLinkedFiles(w, r, models.FileLinkLoan, "invalid loan id")
+}
+
+// listLinkedFiles lists the files linked to the record of type named by the id URL parameter
+func (s *Server) listLinkedFiles(w http.ResponseWriter, r *http.Request, linkType, invalidID string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest(invalidID))
+		return
+	}
+	filter, err := s.parseFileFilter(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	filter.LinkedTo = repository.FileLink{Type: linkType, ID: id}
+	s.writeFileList(w, r, filter)
+}
+
+// parseFileFilter reads the file listing's filter and pagination query parameters, except linked_to
+func (s *Server) parseFileFilter(r *http.Request) (repository.FileFilter, error) {
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		return repository.FileFilter{}, err
+	}
+	filter, err := s.parseFileQuery(r)
+	if err != nil {
+		return repository.FileFilter{}, err
+	}
+	filter.Limit, filter.Offset = limit, offset
+	return filter, nil
+}
+
+// parseFileQuery reads the file listing's filter query parameters, except linked_to and pagination.
+// Upload dates are days in the caller's time zone.
+func (s *Server) parseFileQuery(r *http.Request) (repository.FileFilter, error) {
+	query := r.URL.Query()
+	filter := repository.FileFilter{
+		FileType: query.Get("file_type"),
+		Filename: query.Get("filename"),
+	}
+	loc, err := s.lenderLocation(int(claimsFromContext(r.Context()).LenderID))
+	if err != nil {
+		return repository.FileFilter{}, err
+	}
+	filter.UploadedAfter, filter.UploadedBefore, err = parseDateRange(query, "uploaded_after", "uploaded_before", loc)
+	if err != nil {
+		return repository.FileFilter{}, err
+	}
+	return filter, nil
+}
+
+// parseFileLink parses a "type:id" reference to a borrower, loan or receipt
+func parseFileLink(value string) (repository.FileLink, error) {
+	linkType, rawID, _ := strings.Cut(value, ":")
+	id, err := strconv.Atoi(rawID)
+	validType := linkType == models.FileLinkBorrower || linkType == models.FileLinkLoan || linkType == models.FileLinkReceipt
+	if !validType || err != nil || id <= 0 {
+		return repository.FileLink{}, httperr.Validation("linked_to must be borrower:{id}, loan:{id} or receipt:{id}")
+	}
+	return repository.FileLink{Type: linkType, ID: id}, nil
+}
+
+// writeFileList writes one page of the authenticated lender's files matching filter
+func (s *Server) writeFileList(w http.ResponseWriter, r *http.Request, filter repository.FileFilter) {
+	claims := claimsFromContext(r.Context())
+
+	files, total, err := s.fileRepo.ListFiles(int(claims.LenderID), filter)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	items := make([]fileListItem, 0, len(files))
+	for _, file := range files {
+		item := fileListItem{FileListing: file}
+		if store, err := s.files.For(file.StorageBackend); err != nil {
+			s.logger.WarnContext(r.Context(), "No download URL for file", "file_id", file.FileID, "error", err)
+		} else if item.URL, err = store.URL(r.Context(), file.Value); err != nil {
+			s.logger.WarnContext(r.Context(), "No download URL for file", "file_id", file.FileID, "error", err)
+		}
+		items = append(items, item)
+	}
+
+	writeJSON(w, http.StatusOK, fileListResponse{
+		Files:  items,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+// attachFileRequest is the body accepted when attaching a file to a record
+type attachFileRequest struct {
+	Type string `json:"type"` // borrower, loan or receipt
+	ID   int    `json:"id"`
+}
+
+// attachFile links one of the caller's files to one of its borrowers, loans or receipts.
+func (s *Server) attachFile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid file id"))
+		return
+	}
+	var req attachFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	link, err := parseFileLink(req.Type + ":" + strconv.Itoa(req.ID))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.Validation("type must be borrower, loan or receipt and id a positive integer"))
+		return
+	}
+
+	attachment, err := s.fileRepo.AttachFile(int(claims.LenderID), fileID, link)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditFileAttached, ResourceType: "file", ResourceID: fileID, Details: map[string]any{"type": link.Type, "id": link.ID}})
+	writeJSON(w, http.StatusCreated, attachment)
+}
+
+// detachFile removes the link between one of the caller's files and a record.
+func (s *Server) detachFile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid file id"))
+		return
+	}
+	link, err := parseFileLink(chi.URLParam(r, "type") + ":" + chi.URLParam(r, "targetID"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid attachment"))
+		return
+	}
+
+	if err := s.fileRepo.DetachFile(int(claims.LenderID), fileID, link); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditFileDetached, ResourceType: "file", ResourceID: fileID, Details: map[string]any{"type": link.Type, "id": link.ID}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFileUsage returns the bytes used by the authenticated lender's files against its storage quota
+func (s *Server) getFileUsage(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	usage, err := s.loadStorageUsage(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// uploadFile stores a file for the caller's lender, sent either in the "file" field of a
+// multipart form or, for clients that cannot send multipart, as a base64Upload JSON body. The file
+// is streamed to the file store under a generated name; its type is detected from the content and
+// must be in the configured allowlist. Lenders whose plan sets a storage quota are refused up front
+// once it is full, and the quota is checked again when the row is inserted.
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	usage, err := s.loadStorageUsage(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if usage.RemainingBytes != nil && *usage.RemainingBytes == 0 {
+		writeQuotaExceeded(w, usage)
+		return
+	}
+
+	maxSize := s.Cfg.UploadMaxBytes
+	if maxSize <= 0 {
+		maxSize = defaultMaxUploadSize
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		s.uploadBase64File(w, r, lenderID, usage, min(maxSize, maxBase64UploadSize))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("request must be multipart/form-data or JSON"))
+		return
+	}
+
+	// Skip any other fields up to the file
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			s.writeServiceError(w, r, httperr.Validation("file is required"))
+			return
+		}
+		if err != nil {
+			s.writeUploadError(w, r, err, maxSize, httperr.BadRequest("invalid multipart body"))
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		s.storeUpload(w, r, lenderID, usage, http.MaxBytesReader(w, part, maxSize), part.FileName(), maxSize)
+		return
+	}
+}
+
+// base64Upload is the JSON alternative to a multipart upload. ContentType is accepted for the
+// client's convenience only: the type is detected from the decoded content.
+type base64Upload struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	DataBase64  string `json:"data_base64"` // Standard base64, padded
+}
+
+// uploadBase64File stores the file in a base64Upload body, of at most maxSize decoded bytes. The
+// encoded data is decoded while it is written to the file store, so no decoded copy is held.
+func (s *Server) uploadBase64File(w http.ResponseWriter, r *http.Request, lenderID int, usage storageUsage, maxSize int64) {
+	var req base64Upload
+	body := http.MaxBytesReader(w, r.Body, int64(base64.StdEncoding.EncodedLen(int(maxSize)))+base64Overhead)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		s.writeUploadError(w, r, err, maxSize, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.DataBase64 == "" {
+		s.writeServiceError(w, r, httperr.Validation("data_base64 is required"))
+		return
+	}
+
+	decoded := base64Reader{base64.NewDecoder(base64.StdEncoding, strings.NewReader(req.DataBase64))}
+	s.storeUpload(w, r, lenderID, usage, http.MaxBytesReader(w, io.NopCloser(decoded), maxSize), req.Filename, maxSize)
+}
+
+// errInvalidBase64 is returned by base64Reader for malformed or truncated input
+var errInvalidBase64 = errors.New("data_base64 is not valid base64")
+
+// base64Reader reads from a base64 decoder, reporting any malformed input as errInvalidBase64
+type base64Reader struct {
+	r io.Reader
+}
+
+func (b base64Reader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = errInvalidBase64
+	}
+	return n, err
+}
+
+// storeUpload sniffs, stores and records one uploaded file read from body, which must fail with
+// *http.MaxBytesError past maxSize, and writes the response. It is shared by every upload format.
+func (s *Server) storeUpload(w http.ResponseWriter, r *http.Request, lenderID int, usage storageUsage, body io.Reader, filename string, maxSize int64) {
+	allowed := s.Cfg.UploadAllowedTypes
+	if len(allowed) == 0 {
+		allowed = defaultUploadTypes
+	}
+
+	// Trust the content, not the declared Content-Type
+	buffered := bufio.NewReaderSize(body, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		s.writeUploadError(w, r, err, maxSize, httperr.BadRequest("invalid upload body"))
+		return
+	}
+	if len(head) == 0 {
+		s.writeServiceError(w, r, httperr.Validation("file must not be empty"))
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !slices.Contains(allowed, contentType) {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("file type %s is not allowed", contentType)))
+		return
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	key := fmt.Sprintf("lenders/%d/files/%s%s", lenderID, hex.EncodeToString(suffix), uploadExtensions[contentType])
+	counter := &countingReader{r: buffered}
+	if err := s.files.Save(r.Context(), key, counter); err != nil {
+		s.writeUploadError(w, r, err, maxSize, err)
+		return
+	}
+
+	file := &models.File{
+		LenderID:         lenderID,
+		Value:            key,
+		FileType:         nullString(contentType),
+		FileSize:         sql.NullInt64{Int64: counter.n, Valid: true},
+		OriginalFilename: nullString(filename),
+		StorageBackend:   s.files.Default,
+	}
+	var quota int64
+	if usage.QuotaBytes != nil {
+		quota = *usage.QuotaBytes
+	}
+	if err := s.fileRepo.CreateFileWithinQuota(file, quota); err != nil {
+		if delErr := s.files.Delete(r.Context(), key); delErr != nil {
+			s.logger.WarnContext(r.Context(), "Failed to remove orphaned upload", "key", key, "error", delErr)
+		}
+		if errors.Is(err, repository.ErrStorageQuotaExceeded) {
+			if usage, err = s.loadStorageUsage(lenderID); err == nil {
+				writeQuotaExceeded(w, usage)
+				return
+			}
+		}
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	s.scans.Wake()
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditFileUploaded, ResourceType: "file", ResourceID: file.FileID})
+	writeJSON(w, http.StatusCreated, file)
+}
+
+// fileStatusResponse is the body of GET /api/files/{id}/status
+type fileStatusResponse struct {
+	FileID int    `json:"file_id"`
+	Status string `json:"status"`
+}
+
+// getFileStatus reports whether one of the caller's uploads is available yet. Uploads are scanned
+// for malware after they are stored: the status is pending_scan until then and clean once the file
+// can be downloaded. Quarantined files are reported with 422.
+func (s *Server) getFileStatus(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid file id"))
+		return
+	}
+	file, err := s.fileRepo.GetFileByID(int(claims.LenderID), fileID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if file.Status == models.FileStatusInfected {
+		writeError(w, http.StatusUnprocessableEntity, "file_infected", "file failed the malware scan and has been quarantined")
+		return
+	}
+	writeJSON(w, http.StatusOK, fileStatusResponse{FileID: file.FileID, Status: file.Status})
+}
+
+// downloadFile streams one of the caller's files.
+func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid file id"))
+		return
+	}
+	file, err := s.fileRepo.GetFileByID(int(claims.LenderID), fileID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.serveFile(w, r, file)
+}
+
+// serveFile streams the stored contents of file with its content type. Files are only served once
+// the malware scanner has found them clean; others are refused with 409.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if file.Status != models.FileStatusClean {
+		writeError(w, http.StatusConflict, "file_not_available", fmt.Sprintf("file is not available for download (status %s)", file.Status))
+		return
+	}
+	store, err := s.files.For(file.StorageBackend)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	contents, err := store.Open(r.Context(), file.Value)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	defer contents.Close()
+
+	w.Header().Set("Content-Type", file.FileType.String)
+	if file.FileSize.Valid {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize.Int64, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, contents); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to stream file", "file_id", file.FileID, "key", file.Value, "error", err)
+	}
+}
+
+// fileReferencedResponse is the 409 body for deleting a file that is still referenced
+type fileReferencedResponse struct {
+	errorResponse
+	References []models.FileReference `json:"references"`
+}
+
+// deleteFile deletes one of the authenticated lender's files and its stored contents. Files
+// still referenced elsewhere, such as the lender's logo, are refused with the referencing resources.
+func (s *Server) deleteFile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	fileID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid file id"))
+		return
+	}
+
+	actor := fmt.Sprintf("account:%d", claims.AccountID)
+	file, err := s.fileRepo.DeleteFile(r.Context(), lenderID, fileID, actor)
+	if errors.Is(err, repository.ErrFileReferenced) {
+		refs, refErr := s.fileRepo.ListFileReferences(lenderID, fileID)
+		if refErr == nil {
+			writeJSON(w, http.StatusConflict, fileReferencedResponse{
+				errorResponse: newErrorResponse(w, "file_referenced", "file is still in use"),
+				References:    refs,
+			})
+			return
+		}
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	// The row is gone, so a failure here leaves an orphaned object for the sweeper to report
+	store, err := s.files.For(file.StorageBackend)
+	if err == nil {
+		err = store.Delete(r.Context(), file.Value)
+	}
+	if err != nil {
+		s.logger.WarnContext(r.Context(), "Failed to remove stored contents of deleted file", "file_id", file.FileID, "key", file.Value, "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadError reports a body over the size limit as 413, invalid base64 data as 422 and any
+// other error as fallback
+func (s *Server) writeUploadError(w http.ResponseWriter, r *http.Request, err error, maxSize int64, fallback error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("file must be at most %d bytes", maxSize))
+		return
+	}
+	if errors.Is(err, errInvalidBase64) {
+		s.writeServiceError(w, r, httperr.Validation(errInvalidBase64.Error()))
+		return
+	}
+	s.writeServiceError(w, r, fallback)
+}
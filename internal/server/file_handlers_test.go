@@ -0,0 +1,576 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/scanner"
+	"wisetech-lms-api/internal/storage"
+)
+
+// pdfHeader is enough of a PDF for content sniffing
+var pdfHeader = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+// uploadFile POSTs data as the "file" field of a multipart form.
+func uploadFile(t *testing.T, s *Server, token, field, filename string, data []byte) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("description", "signed contract")
+	fw, err := mw.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/files", &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+// scanFiles runs the upload scanner over every file waiting for it.
+func scanFiles(t *testing.T, s *Server) {
+	t.Helper()
+	if _, err := s.FileScanner().RunOnce(context.Background()); err != nil {
+		t.Fatalf("Scanning files failed: %v", err)
+	}
+}
+
+// eicarScanner flags contents containing the EICAR test marker.
+type eicarScanner struct{}
+
+func (eicarScanner) Scan(ctx context.Context, r io.Reader) (scanner.Verdict, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return scanner.Verdict{}, err
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		return scanner.Verdict{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scanner.Verdict{}, nil
+}
+
+func TestUploadFile(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "uploader")
+	data := append(append([]byte{}, pdfHeader...), bytes.Repeat([]byte("x"), 2048)...)
+
+	rr := uploadFile(t, s, token, "file", "../../etc/contract.pdf", data)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var file models.File
+	json.Unmarshal(rr.Body.Bytes(), &file)
+
+	// Test case 1: Metadata comes from the content, and the client filename is kept only as metadata
+	if file.FileID == 0 || file.LenderID != lenderID || file.FileType.String != "application/pdf" || file.FileSize.Int64 != int64(len(data)) {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	if file.StorageBackend != "local" {
+		t.Errorf("Expected the file on the local backend, got '%s'", file.StorageBackend)
+	}
+	if file.OriginalFilename.String != "contract.pdf" {
+		t.Errorf("Expected original filename 'contract.pdf', got '%s'", file.OriginalFilename.String)
+	}
+	if strings.Contains(file.Value, "contract") || !strings.HasSuffix(file.Value, ".pdf") {
+		t.Errorf("Expected a generated storage name, got '%s'", file.Value)
+	}
+
+	// Test case 2: The contents were stored in full
+	rc, err := s.files.Open(context.Background(), file.Value)
+	if err != nil {
+		t.Fatalf("Expected the file to be stored, got %v", err)
+	}
+	stored, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(stored, data) {
+		t.Errorf("Expected %d stored bytes, got %d", len(data), len(stored))
+	}
+
+	// Test case 3: The row was recorded for the lender
+	saved, err := s.fileRepo.GetFileByID(lenderID, file.FileID)
+	if err != nil || saved.Value != file.Value {
+		t.Errorf("Expected the File row to be saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestUploadFile_Rejected(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.UploadMaxBytes = 4096
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "rejected")
+
+	tests := []struct {
+		name     string
+		field    string
+		data     []byte
+		wantCode int
+	}{
+		{"disallowed type", "file", []byte("<html><body>hi</body></html>"), http.StatusUnprocessableEntity},
+		{"empty file", "file", nil, http.StatusUnprocessableEntity},
+		{"missing file field", "attachment", pdfHeader, http.StatusUnprocessableEntity},
+		{"too large", "file", append(append([]byte{}, pdfHeader...), make([]byte, 8192)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := uploadFile(t, s, token, tt.field, "upload.bin", tt.data)
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Nothing was recorded for the rejected uploads
+	var count int
+	s.DB.QueryRow("SELECT COUNT(*) FROM File").Scan(&count)
+	if count != 0 {
+		t.Errorf("Expected no File rows, got %d", count)
+	}
+
+	// A body that is neither multipart nor JSON is a bad request
+	req := httptest.NewRequest("POST", "/api/files", strings.NewReader("file=nope"))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestUploadFile_Base64(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "mobile")
+	data := append(append([]byte{}, pdfHeader...), bytes.Repeat([]byte("x"), 1024)...)
+	upload := func(filename, encoded string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(base64Upload{Filename: filename, ContentType: "application/pdf", DataBase64: encoded})
+		return doRequest(t, s, "POST", "/api/files", token, string(body))
+	}
+
+	// Test case 1: The decoded file is stored like a multipart upload
+	rr := upload("contract.pdf", base64.StdEncoding.EncodeToString(data))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var file models.File
+	json.Unmarshal(rr.Body.Bytes(), &file)
+	if file.FileType.String != "application/pdf" || file.FileSize.Int64 != int64(len(data)) || file.OriginalFilename.String != "contract.pdf" {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	scanFiles(t, s)
+	if rr := doRequest(t, s, "GET", fmt.Sprintf("/api/files/%d/download", file.FileID), token, ""); !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("Expected the decoded contents back, got %d bytes", rr.Body.Len())
+	}
+
+	// Test case 2: Invalid base64, at the start and past the sniffed head
+	for _, encoded := range []string{"not base64!", base64.StdEncoding.EncodeToString(data) + "@@"} {
+		rr = upload("broken.pdf", encoded)
+		if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "data_base64") {
+			t.Errorf("Expected status 422 for invalid base64, got %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 3: Missing data
+	if rr := upload("empty.pdf", ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 without data, got %d", rr.Code)
+	}
+
+	// Test case 4: The base64 cap is below the multipart one
+	oversize := append(append([]byte{}, pdfHeader...), make([]byte, maxBase64UploadSize)...)
+	if rr := upload("big.pdf", base64.StdEncoding.EncodeToString(oversize)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized payload, got %d", rr.Code)
+	}
+	s.Cfg.UploadMaxBytes = 512
+	if rr := upload("over-config.pdf", base64.StdEncoding.EncodeToString(data)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 past the configured limit, got %d", rr.Code)
+	}
+
+	var count int
+	s.DB.QueryRow("SELECT COUNT(*) FROM File WHERE Lender_ID = ?", lenderID).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected only the valid upload recorded, got %d rows", count)
+	}
+}
+
+func TestUploadFile_StorageQuota(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Basic", 150)
+	_, lenderID, token := registerTestLender(t, s, "quotaed")
+	if _, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, planID, "LSL", time.Now(), time.Now().AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	data := append(append([]byte{}, pdfHeader...), bytes.Repeat([]byte("x"), 1000-len(pdfHeader))...)
+
+	usage := func() storageUsage {
+		t.Helper()
+		rr := doRequest(t, s, "GET", "/api/files/usage", token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var u storageUsage
+		json.Unmarshal(rr.Body.Bytes(), &u)
+		return u
+	}
+
+	// Test case 1: Without a quota storage is unlimited
+	if rr := uploadFile(t, s, token, "file", "a.pdf", data); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if u := usage(); u.UsedBytes != 1000 || u.QuotaBytes != nil || u.RemainingBytes != nil {
+		t.Errorf("Expected 1000 bytes used with no quota, got %+v", u)
+	}
+
+	// Test case 2: The plan's quota is reported and an upload that fits is accepted
+	doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d/features", planID), `{"max_storage_bytes": 2500}`)
+	if rr := uploadFile(t, s, token, "file", "b.pdf", data); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if u := usage(); u.UsedBytes != 2000 || *u.QuotaBytes != 2500 || *u.RemainingBytes != 500 {
+		t.Errorf("Unexpected usage: %+v", u)
+	}
+
+	// Test case 3: An upload that would exceed the quota is refused with the usage, and not kept
+	rr := uploadFile(t, s, token, "file", "c.pdf", data)
+	var body quotaExceededResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusRequestEntityTooLarge || body.Error.Code != "storage_quota_exceeded" || body.Usage.UsedBytes != 2000 {
+		t.Errorf("Expected 413 storage_quota_exceeded with 2000 bytes used, got %d %s", rr.Code, rr.Body.String())
+	}
+	var count int
+	s.DB.QueryRow("SELECT COUNT(*) FROM File WHERE Lender_ID = ?", lenderID).Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 File rows, got %d", count)
+	}
+	entries, _ := os.ReadDir(filepath.Join(s.Cfg.UploadDir, "lenders", fmt.Sprint(lenderID), "files"))
+	if len(entries) != 2 {
+		t.Errorf("Expected the refused upload to be removed from storage, found %d files", len(entries))
+	}
+
+	// Test case 4: Once the quota is full uploads are refused before the body is read
+	doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d/features", planID), `{"max_storage_bytes": 2000}`)
+	if rr := uploadFile(t, s, token, "file", "d.pdf", pdfHeader); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 with a full quota, got %d", rr.Code)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "filelister")
+	_, _, otherToken := registerTestLender(t, s, "otherfilelister")
+
+	for _, name := range []string{"contract.pdf", "statement.pdf"} {
+		if rr := uploadFile(t, s, token, "file", name, pdfHeader); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	uploadFile(t, s, otherToken, "file", "contract.pdf", pdfHeader)
+
+	list := func(query string) fileListResponse {
+		t.Helper()
+		rr := doRequest(t, s, "GET", "/api/files"+query, token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp fileListResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// Test case 1: The lender's own files, newest first, each with a download URL
+	resp := list("")
+	if resp.Total != 2 || len(resp.Files) != 2 || resp.Limit != 50 {
+		t.Fatalf("Unexpected listing: %+v", resp)
+	}
+	if resp.Files[0].OriginalFilename.String != "statement.pdf" {
+		t.Errorf("Expected the newest file first, got '%s'", resp.Files[0].OriginalFilename.String)
+	}
+	for _, f := range resp.Files {
+		if !strings.HasPrefix(f.URL, "file://") || !strings.HasSuffix(f.URL, f.Value) || f.References != 0 {
+			t.Errorf("Unexpected file: %+v", f)
+		}
+	}
+
+	// Test case 2: Filters
+	if resp := list("?filename=contr"); resp.Total != 1 || resp.Files[0].OriginalFilename.String != "contract.pdf" {
+		t.Errorf("Expected only contract.pdf, got %+v", resp.Files)
+	}
+	if resp := list("?file_type=image/png"); resp.Total != 0 || resp.Files == nil {
+		t.Errorf("Expected an empty list, got %+v", resp)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	if resp := list("?uploaded_after=" + tomorrow); resp.Total != 0 {
+		t.Errorf("Expected no files uploaded after %s, got %d", tomorrow, resp.Total)
+	}
+	if resp := list("?uploaded_before=" + tomorrow + "&limit=1"); resp.Total != 2 || len(resp.Files) != 1 {
+		t.Errorf("Expected a page of 1 of 2 files, got %d of %d", len(resp.Files), resp.Total)
+	}
+
+	// Test case 3: Invalid parameters
+	for _, query := range []string{"?uploaded_after=yesterday", "?uploaded_after=2026-05-02&uploaded_before=2026-05-01", "?limit=abc"} {
+		if rr := doRequest(t, s, "GET", "/api/files"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestFileAttachments(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "attacher")
+	_, otherLenderID, otherToken := registerTestLender(t, s, "otherattacher")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	otherLoanID := seedLoan(t, s, otherLenderID, "active", 1000, 10, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	res, _ := s.DB.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount) VALUES (?, ?, 'paid', 100)", loanID, lenderID)
+	receiptID, _ := res.LastInsertId()
+
+	upload := func(token, name string) int {
+		t.Helper()
+		rr := uploadFile(t, s, token, "file", name, pdfHeader)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var file models.File
+		json.Unmarshal(rr.Body.Bytes(), &file)
+		return file.FileID
+	}
+	idDocument := upload(token, "id-document.pdf")
+	slip := upload(token, "deposit-slip.pdf")
+	otherFile := upload(otherToken, "other.pdf")
+	attach := func(token string, fileID int, body string) *httptest.ResponseRecorder {
+		return doRequest(t, s, "POST", fmt.Sprintf("/api/files/%d/attachments", fileID), token, body)
+	}
+	list := func(token, path string) (int, fileListResponse) {
+		t.Helper()
+		rr := doRequest(t, s, "GET", path, token, "")
+		var resp fileListResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	// Test case 1: Files are attached to a borrower and a receipt
+	rr := attach(token, idDocument, fmt.Sprintf(`{"type":"borrower","id":%d}`, borrowerID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var attachment models.FileAttachment
+	json.Unmarshal(rr.Body.Bytes(), &attachment)
+	if attachment.FileID != idDocument || attachment.Type != "borrower" || attachment.ID != borrowerID || attachment.AttachedAt.IsZero() {
+		t.Errorf("Unexpected attachment: %+v", attachment)
+	}
+	if rr := attach(token, slip, fmt.Sprintf(`{"type":"receipt","id":%d}`, receiptID)); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: The borrower's and loan's files include those attached via receipts
+	if code, resp := list(token, fmt.Sprintf("/api/borrowers/%d/files", borrowerID)); code != http.StatusOK || resp.Total != 2 {
+		t.Errorf("Expected the borrower's 2 files, got %d %+v", code, resp)
+	}
+	if code, resp := list(token, fmt.Sprintf("/api/loans/%d/files", loanID)); code != http.StatusOK || resp.Total != 1 || resp.Files[0].FileID != slip {
+		t.Errorf("Expected the loan's receipt file, got %d %+v", code, resp)
+	}
+
+	// Test case 3: linked_to combines with the other filters
+	if _, resp := list(token, fmt.Sprintf("/api/files?linked_to=borrower:%d&filename=id-doc", borrowerID)); resp.Total != 1 || resp.Files[0].FileID != idDocument {
+		t.Errorf("Expected only the ID document, got %+v", resp)
+	}
+	if _, resp := list(token, fmt.Sprintf("/api/borrowers/%d/files?file_type=image/png", borrowerID)); resp.Total != 0 {
+		t.Errorf("Expected no PNG files, got %+v", resp)
+	}
+	for _, query := range []string{"?linked_to=lender:1", "?linked_to=borrower:x", "?linked_to=loan"} {
+		if code, _ := list(token, "/api/files"+query); code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, code)
+		}
+	}
+
+	// Test case 4: Other lenders' records and files stay out of reach
+	if code, _ := list(token, fmt.Sprintf("/api/loans/%d/files", otherLoanID)); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 listing another lender's loan, got %d", code)
+	}
+	if code, _ := list(otherToken, fmt.Sprintf("/api/borrowers/%d/files", borrowerID)); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a borrower the lender never lent to, got %d", code)
+	}
+	if rr := attach(token, idDocument, fmt.Sprintf(`{"type":"loan","id":%d}`, otherLoanID)); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "link_target_not_found") {
+		t.Errorf("Expected status 404 attaching to another lender's loan, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := attach(token, otherFile, fmt.Sprintf(`{"type":"loan","id":%d}`, loanID)); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "file_not_found") {
+		t.Errorf("Expected status 404 attaching another lender's file, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := attach(token, slip, `{"type":"lender","id":1}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown type, got %d", rr.Code)
+	}
+
+	// Test case 5: Attached files cannot be deleted until detached
+	if rr := doRequest(t, s, "DELETE", fmt.Sprintf("/api/files/%d", slip), token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 deleting an attached file, got %d", rr.Code)
+	}
+	path := fmt.Sprintf("/api/files/%d/attachments/receipt/%d", slip, receiptID)
+	if rr := doRequest(t, s, "DELETE", path, token, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(t, s, "DELETE", path, token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 detaching twice, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "DELETE", fmt.Sprintf("/api/files/%d", slip), token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting the detached file, got %d", rr.Code)
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	accountID, lenderID, token := registerTestLender(t, s, "filedeleter")
+	_, _, otherToken := registerTestLender(t, s, "otherfiledeleter")
+	ctx := context.Background()
+
+	upload := func() models.File {
+		t.Helper()
+		rr := uploadFile(t, s, token, "file", "contract.pdf", pdfHeader)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var file models.File
+		json.Unmarshal(rr.Body.Bytes(), &file)
+		return file
+	}
+	file := upload()
+	path := fmt.Sprintf("/api/files/%d", file.FileID)
+
+	// Test case 1: Other lenders cannot delete it
+	if rr := doRequest(t, s, "DELETE", path, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+
+	// Test case 2: The row and the stored object are removed, and the deletion audited
+	if rr := doRequest(t, s, "DELETE", path, token, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := s.files.Open(ctx, file.Value); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected the stored object to be removed, got %v", err)
+	}
+	var actor string
+	s.DB.QueryRow("SELECT Actor FROM Audit_Log WHERE Resource_ID = ? AND Action = ?", file.FileID, models.AuditFileDeleted).Scan(&actor)
+	if actor != fmt.Sprintf("account:%d", accountID) {
+		t.Errorf("Expected the deletion audited as account:%d, got '%s'", accountID, actor)
+	}
+	if rr := doRequest(t, s, "DELETE", path, token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 once deleted, got %d", rr.Code)
+	}
+
+	// Test case 3: An object that is already missing does not stop the deletion
+	missing := upload()
+	s.files.Delete(ctx, missing.Value)
+	if rr := doRequest(t, s, "DELETE", fmt.Sprintf("/api/files/%d", missing.FileID), token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 for a missing object, got %d", rr.Code)
+	}
+
+	// Test case 4: The lender's logo is referenced, so it is refused with the reference listed
+	rr := uploadLogo(t, s, token, testImage(t, "png", 8, 8))
+	var logo models.File
+	json.Unmarshal(rr.Body.Bytes(), &logo)
+	rr = doRequest(t, s, "DELETE", fmt.Sprintf("/api/files/%d", logo.FileID), token, "")
+	var body fileReferencedResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusConflict || body.Error.Code != "file_referenced" ||
+		len(body.References) != 1 || body.References[0] != (models.FileReference{Type: models.FileReferenceLenderLogo, ID: lenderID}) {
+		t.Errorf("Expected 409 listing the logo reference, got %d %s", rr.Code, rr.Body.String())
+	}
+	if _, err := s.files.Open(ctx, logo.Value); err != nil {
+		t.Errorf("Expected the logo to be kept, got %v", err)
+	}
+
+	// Test case 5: Invalid ID
+	if rr := doRequest(t, s, "DELETE", "/api/files/abc", token, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestFileScanning(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "scanned")
+	s.FileScanner().Scanner = eicarScanner{}
+
+	upload := func(data []byte) models.File {
+		rr := uploadFile(t, s, token, "file", "contract.pdf", data)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var file models.File
+		json.Unmarshal(rr.Body.Bytes(), &file)
+		return file
+	}
+	clean := append(append([]byte{}, pdfHeader...), []byte(" clean contract")...)
+	infected := append(append([]byte{}, pdfHeader...), []byte(" X5O!P%@AP-EICAR-STANDARD-ANTIVIRUS-TEST-FILE")...)
+
+	// Test case 1: A new upload waits for the scanner and cannot be downloaded yet
+	file := upload(clean)
+	if file.Status != models.FileStatusPendingScan {
+		t.Errorf("Expected a pending upload, got %q", file.Status)
+	}
+	statusPath := fmt.Sprintf("/api/files/%d/status", file.FileID)
+	downloadPath := fmt.Sprintf("/api/files/%d/download", file.FileID)
+	rr := doRequest(t, s, "GET", statusPath, token, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"pending_scan"`) {
+		t.Errorf("Expected a pending status, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(t, s, "GET", downloadPath, token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 before the scan, got %d", rr.Code)
+	}
+
+	// Test case 2: Once scanned clean it is available
+	scanFiles(t, s)
+	if rr := doRequest(t, s, "GET", statusPath, token, ""); !strings.Contains(rr.Body.String(), `"status":"clean"`) {
+		t.Errorf("Expected a clean status, got %s", rr.Body.String())
+	}
+	rr = doRequest(t, s, "GET", downloadPath, token, "")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), clean) || rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected the clean file, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	// Test case 3: An infected upload is quarantined: kept, reported with 422 and never served
+	file = upload(infected)
+	scanFiles(t, s)
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/files/%d/status", file.FileID), token, "")
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "file_infected") {
+		t.Errorf("Expected status 422 for an infected file, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(t, s, "GET", fmt.Sprintf("/api/files/%d/download", file.FileID), token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for an infected file, got %d", rr.Code)
+	}
+	if _, err := s.files.Open(context.Background(), file.Value); err != nil {
+		t.Errorf("Expected the quarantined contents to be kept, got %v", err)
+	}
+	var audits int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Audit_Log WHERE Lender_ID = ? AND Action = ?", lenderID, models.AuditFileQuarantined).Scan(&audits)
+	if audits != 1 {
+		t.Errorf("Expected the quarantine to be audited, got %d entries", audits)
+	}
+
+	// Test case 4: Other lenders' files are not found
+	_, _, otherToken := registerTestLender(t, s, "stranger")
+	if rr := doRequest(t, s, "GET", downloadPath, otherToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's file, got %d", rr.Code)
+	}
+}
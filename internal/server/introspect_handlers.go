@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/repository"
+)
+
+// tokenRoleLender is the only role tokens are currently issued for
+const tokenRoleLender = "lender"
+
+// introspectRequest is the body accepted by the token introspection endpoint
+type introspectRequest struct {
+	Token string `json:"token"`
+}
+
+// introspectResponse follows RFC 7662: only active is set for tokens that are not valid
+type introspectResponse struct {
+	Active   bool   `json:"active"`
+	UserID   int64  `json:"user_id,omitempty"`
+	LenderID int64  `json:"lender_id,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+}
+
+// introspectToken reports whether a token is valid and returns its claims.
+// Invalid, expired, malformed and revoked tokens, and tokens of suspended or locked accounts,
+// yield {"active": false} rather than an error.
+func (s *Server) introspectToken(w http.ResponseWriter, r *http.Request) {
+	var req introspectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.Token == "" {
+		s.writeServiceError(w, r, httperr.Validation("token is required"))
+		return
+	}
+
+	claims, err := auth.ValidateToken(req.Token, s.Cfg.JWTSecret)
+	if err != nil {
+		writeJSON(w, http.StatusOK, introspectResponse{Active: false})
+		return
+	}
+
+	status, err := s.authRepo.GetAccountStatus(int(claims.AccountID))
+	if err != nil && !errors.Is(err, repository.ErrAccountNotFound) {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err != nil || status.LenderSuspended || status.IsLocked || tokenRevoked(claims, status) {
+		writeJSON(w, http.StatusOK, introspectResponse{Active: false})
+		return
+	}
+
+	response := introspectResponse{
+		Active:   true,
+		UserID:   claims.AccountID,
+		LenderID: claims.LenderID,
+		Role:     tokenRoleLender,
+	}
+	if claims.ExpiresAt != nil {
+		response.Exp = claims.ExpiresAt.Unix()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
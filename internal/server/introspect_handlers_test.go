@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"wisetech-lms-api/internal/auth"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	s := newTestServer(t)
+	accountID, lenderID, token := registerTestLender(t, s, "introspected")
+
+	introspect := func(token string) introspectResponse {
+		rr := doAdminRequest(t, s, "POST", "/api/auth/introspect", fmt.Sprintf(`{"token": %q}`, token))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var body introspectResponse
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return body
+	}
+
+	// Test case 1: Active token returns its claims
+	active := introspect(token)
+	if !active.Active || active.UserID != int64(accountID) || active.LenderID != int64(lenderID) || active.Role != "lender" {
+		t.Errorf("Unexpected introspection: %+v", active)
+	}
+	if active.Exp <= time.Now().Unix() {
+		t.Errorf("Expected exp in the future, got %d", active.Exp)
+	}
+
+	// Test case 2: Expired token is inactive, not an error
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		AccountID: int64(accountID),
+		LenderID:  int64(lenderID),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	})
+	expiredToken, _ := expired.SignedString([]byte(testJWTSecret))
+	if got := introspect(expiredToken); got != (introspectResponse{Active: false}) {
+		t.Errorf("Expected only active=false for an expired token, got %+v", got)
+	}
+
+	// Test case 3: Garbage string
+	if got := introspect("not-a-jwt"); got.Active {
+		t.Errorf("Expected garbage token to be inactive, got %+v", got)
+	}
+
+	// Test case 4: Admin key is required
+	rr := doRequest(t, s, "POST", "/api/auth/introspect", token, fmt.Sprintf(`{"token": %q}`, token))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without the admin key, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/imaging"
+	"wisetech-lms-api/internal/models"
+)
+
+// maxLogoSize is the largest logo image accepted, in bytes
+const maxLogoSize = 10 << 20
+
+// maxLogoPixels bounds the decoded size of a logo. Dimensions are read from the image header
+// before decoding, so a small file claiming a huge canvas is rejected without allocating it.
+const maxLogoPixels = 50_000_000
+
+// logoJPEGQuality is the quality downscaled JPEG logos are re-encoded at
+const logoJPEGQuality = 85
+
+// logoExtensions maps the accepted sniffed logo content types to file extensions
+var logoExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// uploadLenderLogo replaces the caller's logo with the PNG or JPEG image in the request body.
+// Images larger than the configured maximum dimension are downscaled, keeping their format, and
+// the upload is stored too as the original. The optional X-Filename header is stored as the
+// original filename.
+func (s *Server) uploadLenderLogo(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogoSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("logo must be at most %d bytes", maxLogoSize))
+			return
+		}
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if len(data) == 0 {
+		s.writeServiceError(w, r, httperr.Validation("logo image is required"))
+		return
+	}
+
+	// Trust the content, not the declared Content-Type
+	contentType := http.DetectContentType(data)
+	ext, ok := logoExtensions[contentType]
+	if !ok {
+		s.writeServiceError(w, r, httperr.Validation("logo must be a PNG or JPEG image"))
+		return
+	}
+
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.Validation("logo image could not be decoded"))
+		return
+	}
+	if header.Width <= 0 || header.Height <= 0 || int64(header.Width)*int64(header.Height) > maxLogoPixels {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("logo must be at most %d pixels, got %dx%d", maxLogoPixels, header.Width, header.Height)))
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.Validation("logo image could not be decoded"))
+		return
+	}
+
+	// A downscaled logo is re-encoded from decoded pixels, so only the upload itself needs scanning
+	var resized []byte
+	if scaled := imaging.Fit(img, s.Cfg.LogoMaxDimension); scaled != img {
+		var buf bytes.Buffer
+		if contentType == "image/png" {
+			err = png.Encode(&buf, scaled)
+		} else {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: logoJPEGQuality})
+		}
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		resized = buf.Bytes()
+	}
+
+	var saved []string
+	removeSaved := func() {
+		for _, key := range saved {
+			if err := s.files.Delete(r.Context(), key); err != nil {
+				s.logger.WarnContext(r.Context(), "Failed to remove orphaned logo", "key", key, "error", err)
+			}
+		}
+	}
+	save := func(contents []byte) (*models.File, error) {
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("lenders/%d/logo-%s%s", lenderID, hex.EncodeToString(suffix), ext)
+		if err := s.files.Save(r.Context(), key, bytes.NewReader(contents)); err != nil {
+			return nil, err
+		}
+		saved = append(saved, key)
+		return &models.File{
+			Value:            key,
+			FileType:         nullString(contentType),
+			FileSize:         sql.NullInt64{Int64: int64(len(contents)), Valid: true},
+			OriginalFilename: nullString(r.Header.Get("X-Filename")),
+			StorageBackend:   s.files.Default,
+		}, nil
+	}
+
+	file, err := save(data)
+	if err != nil {
+		removeSaved()
+		s.writeServiceError(w, r, err)
+		return
+	}
+	var original *models.File
+	if resized != nil {
+		original = file
+		if file, err = save(resized); err != nil {
+			removeSaved()
+			s.writeServiceError(w, r, err)
+			return
+		}
+		file.Status = models.FileStatusClean
+	}
+
+	previous, err := s.lenderRepo.ReplaceLogo(lenderID, file, original)
+	if err != nil {
+		removeSaved()
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.scans.Wake()
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditLenderLogoUpdated, ResourceType: "file", ResourceID: file.FileID})
+	for _, old := range previous {
+		store, err := s.files.For(old.StorageBackend)
+		if err == nil {
+			err = store.Delete(r.Context(), old.Value)
+		}
+		if err != nil {
+			s.logger.WarnContext(r.Context(), "Failed to remove superseded logo", "key", old.Value, "error", err)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
+
+// getLenderLogo streams the caller's logo, or with ?original=true the image as uploaded. Like
+// any file, it is only served once the malware scanner has found it clean.
+func (s *Server) getLenderLogo(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	original := false
+	if v := r.URL.Query().Get("original"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			s.writeServiceError(w, r, httperr.Validation("original must be true or false"))
+			return
+		}
+		original = parsed
+	}
+
+	file, err := s.lenderRepo.GetLogo(int(claims.LenderID), original)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.serveFile(w, r, file)
+}
+
+// updateLenderProfile applies a partial update to the caller's lender profile and returns the
+// lender. Every change is recorded in the audit log with the account that made it.
+func (s *Server) updateLenderProfile(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req models.LenderProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	trim := func(v *string) *string {
+		if v == nil {
+			return nil
+		}
+		trimmed := strings.TrimSpace(*v)
+		return &trimmed
+	}
+	req.BusinessName, req.PhoneNumber, req.Email = trim(req.BusinessName), trim(req.PhoneNumber), trim(req.Email)
+	switch {
+	case req.BusinessName != nil && *req.BusinessName == "":
+		s.writeServiceError(w, r, httperr.Validation("business_name cannot be empty"))
+		return
+	case req.PhoneNumber != nil && *req.PhoneNumber == "":
+		s.writeServiceError(w, r, httperr.Validation("phone_number cannot be empty"))
+		return
+	case req.Email != nil && !strings.Contains(*req.Email, "@"):
+		s.writeServiceError(w, r, httperr.Validation("a valid email is required"))
+		return
+	case req.InterestRatePercent != nil && (*req.InterestRatePercent < 0 || *req.InterestRatePercent > 100):
+		s.writeServiceError(w, r, httperr.Validation("interest_rate_percent must be between 0 and 100"))
+		return
+	case req.Timezone != nil && !validTimezone(*req.Timezone):
+		s.writeServiceError(w, r, httperr.Validation("timezone must be an IANA time zone such as Africa/Maseru"))
+		return
+	}
+
+	actor := fmt.Sprintf("account:%d", claims.AccountID)
+	if _, err := s.lenderRepo.UpdateLender(r.Context(), int(claims.LenderID), req, actor); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	lender, err := s.authRepo.GetLenderByAccountID(int(claims.AccountID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lender)
+}
+
+// brandColor matches a #RRGGBB colour
+var brandColor = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// maxFooterLength is the longest document footer accepted, in characters
+const maxFooterLength = 300
+
+// brandingRequest is the body accepted when replacing the lender's document branding. Omitted
+// fields are reset: no logo, the default colour, no footer, and contact details shown.
+type brandingRequest struct {
+	LogoFileID         *int64 `json:"logo_file_id"`
+	PrimaryColor       string `json:"primary_color"`
+	FooterText         string `json:"footer_text"`
+	ShowContactDetails *bool  `json:"show_contact_details"`
+}
+
+// getLenderBranding returns how the caller's generated documents present the lender
+func (s *Server) getLenderBranding(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	branding, err := s.lenderRepo.GetBranding(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, branding)
+}
+
+// updateLenderBranding replaces the caller's document branding and returns it. The logo must be
+// one of the lender's PNG or JPEG files; every change is recorded in the audit log.
+func (s *Server) updateLenderBranding(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req brandingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	branding := models.LenderBranding{
+		PrimaryColor:       strings.ToUpper(strings.TrimSpace(req.PrimaryColor)),
+		FooterText:         strings.TrimSpace(req.FooterText),
+		ShowContactDetails: req.ShowContactDetails == nil || *req.ShowContactDetails,
+	}
+	if req.LogoFileID != nil {
+		branding.LogoFileID = sql.NullInt64{Int64: *req.LogoFileID, Valid: true}
+	}
+	switch {
+	case branding.PrimaryColor != "" && !brandColor.MatchString(branding.PrimaryColor):
+		s.writeServiceError(w, r, httperr.Validation("primary_color must be a hex colour such as #1F2937"))
+		return
+	case utf8.RuneCountInString(branding.FooterText) > maxFooterLength:
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("footer_text must be at most %d characters", maxFooterLength)))
+		return
+	case strings.IndexFunc(branding.FooterText, func(c rune) bool { return unicode.IsControl(c) && c != '\n' }) >= 0:
+		s.writeServiceError(w, r, httperr.Validation("footer_text cannot contain control characters other than line breaks"))
+		return
+	}
+
+	actor := fmt.Sprintf("account:%d", claims.AccountID)
+	if _, err := s.lenderRepo.UpdateBranding(r.Context(), int(claims.LenderID), branding, actor); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, branding)
+}
+
+// webhookRequest is the body accepted when setting the lender's webhook URL
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+// setLenderWebhook sets or, with an empty url, clears the URL that receives the caller's webhook events
+func (s *Server) setLenderWebhook(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.URL != "" {
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			s.writeServiceError(w, r, httperr.Validation("url must be an absolute http or https URL"))
+			return
+		}
+	}
+
+	if err := s.lenderRepo.SetWebhookURL(int(claims.LenderID), req.URL); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     int(claims.LenderID),
+		Action:       models.AuditLenderWebhookSet,
+		ResourceType: "lender",
+		ResourceID:   int(claims.LenderID),
+		Details:      map[string]string{"url": req.URL},
+	})
+	writeJSON(w, http.StatusOK, req)
+}
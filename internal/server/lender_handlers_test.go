@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/storage"
+)
+
+// testImage encodes a width x height gradient as "png" or "jpeg".
+func testImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// uploadLogo PUTs raw image bytes to the logo endpoint.
+func uploadLogo(t *testing.T, s *Server, token string, data []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", "/api/lenders/me/logo", bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("X-Filename", "logo.png")
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestUploadLenderLogo(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "branded")
+
+	// Test case 1: Valid PNG is stored and referenced from the profile
+	rr := uploadLogo(t, s, token, testImage(t, "png", 8, 8))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var first models.File
+	json.Unmarshal(rr.Body.Bytes(), &first)
+	if first.FileType.String != "image/png" || first.OriginalFilename.String != "logo.png" || first.Purpose.String != models.FilePurposeLogo {
+		t.Errorf("Unexpected file: %+v", first)
+	}
+	if _, err := s.files.Open(context.Background(), first.Value); err != nil {
+		t.Errorf("Expected the logo to be stored, got %v", err)
+	}
+
+	rr = doRequest(t, s, "GET", "/api/auth/me", token, "")
+	var me meResponse
+	json.Unmarshal(rr.Body.Bytes(), &me)
+	if me.Lender.LogoFileID.Int64 != int64(first.FileID) {
+		t.Errorf("Expected profile to reference logo %d, got %+v", first.FileID, me.Lender.LogoFileID)
+	}
+
+	// Test case 2: A new upload supersedes the old one
+	rr = uploadLogo(t, s, token, testImage(t, "jpeg", 8, 8))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a JPEG, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := s.files.Open(context.Background(), first.Value); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected the old logo to be removed, got %v", err)
+	}
+	var count int
+	s.DB.QueryRow("SELECT COUNT(*) FROM File WHERE Lender_ID = ? AND Purpose = 'logo'", lenderID).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected exactly one logo row, got %d", count)
+	}
+}
+
+func TestUploadLenderLogo_Rejected(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "unbranded")
+
+	// Test case 1: Not an image, whatever the Content-Type says
+	rr := uploadLogo(t, s, token, []byte("<html><body>not a logo</body></html>"))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a non-image, got %d", rr.Code)
+	}
+
+	// Test case 2: Over the size limit
+	rr = uploadLogo(t, s, token, append(testImage(t, "png", 8, 8), []byte(strings.Repeat("x", maxLogoSize))...))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for an oversized logo, got %d", rr.Code)
+	}
+
+	// Test case 3: Sniffed as a PNG but not decodable
+	rr = uploadLogo(t, s, token, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a truncated PNG, got %d", rr.Code)
+	}
+
+	// Test case 4: A small file claiming a huge canvas is refused from its header alone
+	bomb := testImage(t, "png", 8, 8)
+	binary.BigEndian.PutUint32(bomb[16:], 100000)
+	binary.BigEndian.PutUint32(bomb[20:], 100000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	rr = uploadLogo(t, s, token, bomb)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "100000x100000") {
+		t.Errorf("Expected status 422 for a decompression bomb, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUploadLenderLogo_Resized(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "photographer")
+	s.Cfg.LogoMaxDimension = 64
+
+	getLogo := func(path string) (*httptest.ResponseRecorder, image.Config) {
+		rr := doRequest(t, s, "GET", path, token, "")
+		config, _, _ := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+		return rr, config
+	}
+
+	// Test case 1: No logo yet
+	if rr := doRequest(t, s, "GET", "/api/lenders/me/logo", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without a logo, got %d", rr.Code)
+	}
+
+	// Test case 2: A large JPEG is downscaled, stays a JPEG and links to the stored original
+	source := testImage(t, "jpeg", 256, 128)
+	rr := uploadLogo(t, s, token, source)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var logo models.File
+	json.Unmarshal(rr.Body.Bytes(), &logo)
+	if !logo.OriginalFileID.Valid || logo.FileType.String != "image/jpeg" {
+		t.Errorf("Expected a JPEG variant linked to its original, got %+v", logo)
+	}
+
+	rr, config := getLogo("/api/lenders/me/logo")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" || config.Width != 64 || config.Height != 32 {
+		t.Errorf("Expected a 64x32 JPEG, got %d %s %dx%d", rr.Code, rr.Header().Get("Content-Type"), config.Width, config.Height)
+	}
+	// The upload itself is only served once scanned
+	if rr := doRequest(t, s, "GET", "/api/lenders/me/logo?original=true", token, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 before the original is scanned, got %d", rr.Code)
+	}
+	scanFiles(t, s)
+	rr = doRequest(t, s, "GET", "/api/lenders/me/logo?original=true", token, "")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), source) {
+		t.Errorf("Expected the uploaded bytes back, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	// Test case 3: A small PNG is stored as is and serves as its own original
+	rr = uploadLogo(t, s, token, testImage(t, "png", 32, 48))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	scanFiles(t, s)
+	if rr, config = getLogo("/api/lenders/me/logo?original=true"); config.Width != 32 || rr.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the 32x48 PNG, got %s %dx%d", rr.Header().Get("Content-Type"), config.Width, config.Height)
+	}
+	var rows int
+	s.DB.QueryRow("SELECT COUNT(*) FROM File WHERE Lender_ID = ?", lenderID).Scan(&rows)
+	if rows != 1 {
+		t.Errorf("Expected the superseded logo and original to be removed, got %d rows", rows)
+	}
+
+	// Test case 4: Invalid original flag
+	if rr := doRequest(t, s, "GET", "/api/lenders/me/logo?original=maybe", token, ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestSetLenderWebhook(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	accountID, _, token := registerTestLender(t, s, "hooked")
+
+	// Test case 1: Plans without webhooks are refused
+	rr := doRequest(t, s, "PUT", "/api/lenders/me/webhook", token, `{"url":"https://hooks.example.com/lms"}`)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("Expected status 402, got %d", rr.Code)
+	}
+
+	var trialID int
+	s.DB.QueryRow("SELECT Plan_ID FROM Plans WHERE Is_Trial = 1").Scan(&trialID)
+	if err := s.planRepo.SetFeatures(trialID, models.PlanFeatures{Webhooks: true}); err != nil {
+		t.Fatalf("SetFeatures failed: %v", err)
+	}
+	s.features.InvalidateAll()
+
+	// Test case 2: Only absolute http(s) URLs are accepted
+	rr = doRequest(t, s, "PUT", "/api/lenders/me/webhook", token, `{"url":"ftp://hooks.example.com"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+
+	// Test case 3: The URL is stored on the lender
+	rr = doRequest(t, s, "PUT", "/api/lenders/me/webhook", token, `{"url":"https://hooks.example.com/lms"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	lender, _ := s.authRepo.GetLenderByAccountID(accountID)
+	if lender.WebhookURL.String != "https://hooks.example.com/lms" {
+		t.Errorf("Expected the webhook URL to be stored, got %+v", lender.WebhookURL)
+	}
+}
+
+func TestLenderBranding(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "brandset")
+
+	// Test case 1: Defaults before anything is set
+	rr := doRequest(t, s, "GET", "/api/lenders/me/branding", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var branding models.LenderBranding
+	json.Unmarshal(rr.Body.Bytes(), &branding)
+	if branding != (models.LenderBranding{ShowContactDetails: true}) {
+		t.Errorf("Unexpected default branding: %+v", branding)
+	}
+
+	// Test case 2: Invalid colours, footers and logos are refused
+	for _, body := range []string{
+		`{"primary_color":"orange"}`,
+		`{"primary_color":"#FF660"}`,
+		`{"footer_text":"` + strings.Repeat("x", maxFooterLength+1) + `"}`,
+		`{"footer_text":"bell\u0007"}`,
+	} {
+		if rr := doRequest(t, s, "PUT", "/api/lenders/me/branding", token, body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %.40s, got %d", body, rr.Code)
+		}
+	}
+	if rr := doRequest(t, s, "PUT", "/api/lenders/me/branding", token, `{"logo_file_id":9999}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown logo, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "PUT", "/api/lenders/me/branding", token, `{bad json`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+
+	// Test case 3: A valid branding is normalised, stored and audited with the account
+	rr = uploadLogo(t, s, token, testImage(t, "png", 8, 8))
+	var logo models.File
+	json.Unmarshal(rr.Body.Bytes(), &logo)
+	body := fmt.Sprintf(`{"logo_file_id":%d,"primary_color":"#ff6600","footer_text":"  Thank you\nNCR-1234 ","show_contact_details":false}`, logo.FileID)
+	rr = doRequest(t, s, "PUT", "/api/lenders/me/branding", token, body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doRequest(t, s, "GET", "/api/lenders/me/branding", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &branding)
+	want := models.LenderBranding{
+		LogoFileID:   sql.NullInt64{Int64: int64(logo.FileID), Valid: true},
+		PrimaryColor: "#FF6600",
+		FooterText:   "Thank you\nNCR-1234",
+	}
+	if branding != want {
+		t.Errorf("Expected %+v, got %+v", want, branding)
+	}
+	var actor string
+	s.DB.QueryRow("SELECT Actor FROM Audit_Log WHERE Lender_ID = ? AND Action = ?", lenderID, models.AuditLenderBrandingUpdated).Scan(&actor)
+	if !strings.HasPrefix(actor, "account:") {
+		t.Errorf("Expected the change to be audited with the account, got %q", actor)
+	}
+
+	// Test case 4: Omitted fields are reset by the next PUT
+	doRequest(t, s, "PUT", "/api/lenders/me/branding", token, `{}`)
+	rr = doRequest(t, s, "GET", "/api/lenders/me/branding", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &branding)
+	if branding != (models.LenderBranding{ShowContactDetails: true}) {
+		t.Errorf("Expected the branding to be reset, got %+v", branding)
+	}
+}
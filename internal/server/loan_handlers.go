@@ -0,0 +1,747 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/export"
+	"wisetech-lms-api/internal/finance"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/scoring"
+)
+
+const (
+	defaultDueSoonDays = 7
+	maxDueSoonDays     = 90
+
+	maxDefaultLoanIDs = 500 // Loans one mark-defaulted request can name
+
+	defaultLoanMaxFutureDays = 365 // Used when the configuration does not set LoanMaxFutureDays
+)
+
+// dueSoonResponse is the collections worklist returned by the due-soon endpoint
+type dueSoonResponse struct {
+	Days     int              `json:"days"`
+	Currency string           `json:"currency"`
+	Loans    []models.DueLoan `json:"loans"`
+}
+
+// validLoanStatuses are the values of Loans.Payment_Status
+var validLoanStatuses = map[string]bool{
+	"pending":   true,
+	"active":    true,
+	"paid":      true,
+	"defaulted": true,
+	"cancelled": true,
+}
+
+// loanExportHeader names the columns of the CSV and XLSX loan listings
+var loanExportHeader = []string{
+	"loan_id", "borrower_id", "payment_status", "amount", "interest_rate", "monthly_payment",
+	"months_to_pay", "start_date", "end_date", "created_at", "currency",
+}
+
+// loanListResponse is one page of a lender's loans
+type loanListResponse struct {
+	Currency string        `json:"currency"` // Labels every amount in the page
+	Loans    []models.Loan `json:"loans"`
+	Total    int           `json:"total"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+}
+
+// Ways an origination fee can be given
+const (
+	feeTypeFlat    = "flat"    // An amount in the lender's currency
+	feeTypePercent = "percent" // A percentage of the loan amount
+)
+
+// createLoanRequest is the body accepted when originating a loan. start_date defaults to today,
+// and origination_fee_type to flat.
+type createLoanRequest struct {
+	BorrowerID         int      `json:"borrower_id"`
+	Amount             float64  `json:"amount"`
+	InterestRate       *float64 `json:"interest_rate"`
+	MonthsToPay        int      `json:"months_to_pay"`
+	StartDate          string   `json:"start_date"`
+	OriginationFee     float64  `json:"origination_fee"`
+	OriginationFeeType string   `json:"origination_fee_type"`
+
+	Custom map[string]json.RawMessage `json:"custom"` // Values of the lender's loan custom fields
+}
+
+// loanResponse is a loan with its lender's currency and the caller's custom field values merged in
+type loanResponse struct {
+	*models.Loan
+	Currency string         `json:"currency"`
+	Custom   map[string]any `json:"custom"`
+	Risk     *scoring.Score `json:"risk,omitempty"` // Advisory score of the borrower before the loan was made
+}
+
+// loanRecomputationResponse is a recomputed loan's figures in its lender's currency
+type loanRecomputationResponse struct {
+	*models.LoanRecomputation
+	Currency string `json:"currency"`
+}
+
+// repaymentTerms is what a loan costs the borrower at one interest rate
+type repaymentTerms struct {
+	InterestRate   float64 `json:"interest_rate"`
+	MonthlyPayment float64 `json:"monthly_payment"`
+	TotalInterest  float64 `json:"total_interest"`
+	TotalRepayable float64 `json:"total_repayable"` // Every instalment, plus the origination fee when it is paid upfront
+}
+
+// repricePreviewResponse compares a loan's current terms with those a reprice to a new rate would give
+type repricePreviewResponse struct {
+	LoanID   int            `json:"loan_id"`
+	Currency string         `json:"currency"`
+	Current  repaymentTerms `json:"current"`
+	Proposed repaymentTerms `json:"proposed"`
+}
+
+// loanDisclosure is a loan's total cost of credit, computed from its terms and repayment schedule
+type loanDisclosure struct {
+	LoanID           int     `json:"loan_id"`
+	Currency         string  `json:"currency"`
+	Principal        float64 `json:"principal"`    // What the instalments repay: the amount, plus the fee when it is financed
+	Fees             float64 `json:"fees"`         // The origination fee
+	FeeFinanced      bool    `json:"fee_financed"` // The fee is part of Principal rather than paid upfront
+	TotalInterest    float64 `json:"total_interest"`
+	TotalRepayable   float64 `json:"total_repayable"` // Principal plus TotalInterest, plus Fees when paid upfront
+	NumberOfPayments int     `json:"number_of_payments"`
+	MonthlyPayment   float64 `json:"monthly_payment"`
+	InterestRate     float64 `json:"interest_rate"` // Nominal annual rate, percent
+	APR              float64 `json:"apr"`           // Effective annual rate, percent, fees included
+}
+
+// bulkRepriceRequest is the body accepted by the bulk reprice endpoint
+type bulkRepriceRequest struct {
+	NewRate     *float64 `json:"new_rate"`
+	OnlyPending *bool    `json:"only_pending"`
+}
+
+// listLoans returns the caller's loans, newest first. Supports status, borrower_id, limit and
+// offset query parameters, and min_amount and max_amount to keep loans whose principal is within
+// a range, inclusive; either bound may be left out, and an invalid range gets 400. Responds with CSV or XLSX for format=csv or format=xlsx, or when the
+// Accept header prefers them, and JSON otherwise; clients accepting none of them get 406.
+func (s *Server) listLoans(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "loans can be listed as JSON, CSV or XLSX")
+		return
+	}
+
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	filter := repository.LoanFilter{Status: query.Get("status"), Limit: limit, Offset: offset}
+	if filter.Status != "" && !validLoanStatuses[filter.Status] {
+		s.writeServiceError(w, r, httperr.Validation("status must be one of pending, active, paid, defaulted, cancelled"))
+		return
+	}
+	if v := query.Get("borrower_id"); v != "" {
+		if filter.BorrowerID, err = strconv.Atoi(v); err != nil || filter.BorrowerID <= 0 {
+			s.writeServiceError(w, r, httperr.Validation("borrower_id must be a positive integer"))
+			return
+		}
+	}
+	if v := query.Get("min_amount"); v != "" {
+		if filter.MinAmount, err = parseAmountParam(v); err != nil {
+			s.writeServiceError(w, r, httperr.BadRequest("min_amount must be a non-negative number"))
+			return
+		}
+	}
+	if v := query.Get("max_amount"); v != "" {
+		max, err := parseAmountParam(v)
+		if err != nil {
+			s.writeServiceError(w, r, httperr.BadRequest("max_amount must be a non-negative number"))
+			return
+		}
+		filter.MaxAmount = &max
+	}
+	if filter.MaxAmount != nil && filter.MinAmount > *filter.MaxAmount {
+		s.writeServiceError(w, r, httperr.BadRequest("min_amount cannot be greater than max_amount"))
+		return
+	}
+
+	loans, total, err := s.loanRepo.ListLoans(int(claims.LenderID), filter)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	if format != mediaTypeJSON {
+		s.writeLoansExport(w, r, format, loans, total, code)
+		return
+	}
+	writeJSON(w, http.StatusOK, loanListResponse{Currency: code, Loans: loans, Total: total, Limit: limit, Offset: offset})
+}
+
+// parseAmountParam parses a non-negative, finite amount from a query parameter
+func parseAmountParam(v string) (float64, error) {
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	if amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("amount %q is not a non-negative number", v)
+	}
+	return amount, nil
+}
+
+// writeLoansExport sends the loans as a CSV or XLSX attachment, each labelled with the lender's
+// currency, with the total matching the filter in the X-Total-Count header
+func (s *Server) writeLoansExport(w http.ResponseWriter, r *http.Request, format string, loans []models.Loan, total int, currency string) {
+	rows := func(yield func([]export.Cell) bool) {
+		for _, l := range loans {
+			var payment, endDate export.Cell
+			if l.MonthlyPayment.Valid {
+				payment = export.Decimal(l.MonthlyPayment.Float64)
+			}
+			if l.EndDate.Valid {
+				endDate = export.Date(l.EndDate.Time)
+			}
+			row := []export.Cell{
+				export.Int(l.LoanID),
+				export.Int(l.BorrowerID),
+				export.Text(l.PaymentStatus),
+				export.Decimal(l.Amount),
+				export.Number(l.InterestRate),
+				payment,
+				export.Int(l.MonthsToPay),
+				export.Date(l.StartDate.Time),
+				endDate,
+				export.Time(l.CreatedAt.Time),
+				export.Text(currency),
+			}
+			if !yield(row) {
+				return
+			}
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	s.writeExport(w, r, format, "loans", export.Table{Name: "Loans", Header: loanExportHeader, Rows: rows})
+}
+
+// bulkRepriceLoans applies a new interest rate to the caller's pending loans.
+// Active loans are only repriced when only_pending is explicitly false; paid, defaulted
+// and cancelled loans are never repriced.
+func (s *Server) bulkRepriceLoans(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req bulkRepriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.NewRate == nil || *req.NewRate < 0 || *req.NewRate > 100 {
+		s.writeServiceError(w, r, httperr.Validation("new_rate must be between 0 and 100"))
+		return
+	}
+
+	statuses := []string{"pending"}
+	if req.OnlyPending != nil && !*req.OnlyPending {
+		statuses = append(statuses, "active")
+	}
+
+	updated, err := s.loanRepo.BulkReprice(int(claims.LenderID), *req.NewRate, statuses)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     int(claims.LenderID),
+		Action:       models.AuditLoansRepriced,
+		ResourceType: "loan",
+		Details:      map[string]any{"new_rate": *req.NewRate, "statuses": statuses, "updated": updated},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]int{"updated": updated})
+}
+
+// createLoan originates an active loan from the caller to an existing borrower, computing its
+// monthly payment and end date, and stores the caller's custom field values for it. Lenders can cap the active loans one borrower holds with the
+// max_active_loans_per_borrower custom value; originations past the cap get 409. The response
+// carries the borrower's risk score from before the loan as advice; it never blocks the loan.
+// Lending to a borrower the caller has not lent to before gets 402 once the plan's max_borrowers
+// is reached.
+// An optional origination_fee, flat or a percent of the amount, is recorded on the loan and counted
+// in its total_cost. It is paid upfront, and the instalments amortize the amount alone, unless the
+// lender sets the finance_origination_fee custom value to 1 to amortize it with the amount.
+// start_date defaults to today in the lender's time zone and must fall within the configured window
+// around it (see checkStartDate).
+func (s *Server) createLoan(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	var req createLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	switch {
+	case req.BorrowerID <= 0:
+		s.writeServiceError(w, r, httperr.Validation("borrower_id is required"))
+		return
+	case req.Amount <= 0:
+		s.writeServiceError(w, r, httperr.Validation("amount must be positive"))
+		return
+	case req.InterestRate == nil || *req.InterestRate < 0 || *req.InterestRate > 100:
+		s.writeServiceError(w, r, httperr.Validation("interest_rate must be between 0 and 100"))
+		return
+	case req.MonthsToPay <= 0:
+		s.writeServiceError(w, r, httperr.Validation("months_to_pay must be positive"))
+		return
+	}
+	fee := req.OriginationFee
+	switch req.OriginationFeeType {
+	case "", feeTypeFlat:
+		if fee < 0 {
+			s.writeServiceError(w, r, httperr.Validation("origination_fee must be zero or greater"))
+			return
+		}
+	case feeTypePercent:
+		if fee < 0 || fee > 100 {
+			s.writeServiceError(w, r, httperr.Validation("a percent origination_fee must be between 0 and 100"))
+			return
+		}
+		fee = req.Amount * fee / 100
+	default:
+		s.writeServiceError(w, r, httperr.Validation("origination_fee_type must be flat or percent"))
+		return
+	}
+
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	// Start dates are calendar days, stored as midnight UTC like the dates parsed from requests
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today
+	if req.StartDate != "" {
+		// A timestamp counts as the calendar day it was written in
+		if start, err = models.ParseTime(req.StartDate); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("start_date must be a YYYY-MM-DD date or an RFC3339 timestamp"))
+			return
+		}
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if err := s.checkStartDate(r, start, today); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	custom, err := s.validateCustomFields(lenderID, models.CustomFieldEntityLoan, req.Custom, nil)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if _, err := s.borrowerRepo.GetBorrowerByID(req.BorrowerID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if s.borrowerLimitReached(w, r, lenderID, req.BorrowerID) {
+		return
+	}
+	maxActive, err := s.maxActiveLoansPerBorrower(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	financed, err := s.financeOriginationFee(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	var risk *scoring.Score
+	if history, err := s.loanRepo.ListBorrowerStatements(lenderID, req.BorrowerID); err != nil {
+		s.logger.WarnContext(r.Context(), "Leaving the risk score off a loan", "borrower_id", req.BorrowerID, "error", err)
+	} else {
+		score := scoring.Compute(scoring.BuildHistory(history, time.Now()))
+		risk = &score
+	}
+
+	loan := &models.Loan{
+		BorrowerID:     req.BorrowerID,
+		LenderID:       lenderID,
+		MonthsToPay:    req.MonthsToPay,
+		PaymentStatus:  "active",
+		Amount:         req.Amount,
+		InterestRate:   *req.InterestRate,
+		OriginationFee: finance.RoundCents(fee),
+		FeeFinanced:    financed && fee > 0,
+		StartDate:      models.NewJSONTime(start),
+		EndDate:        models.NewNullTime(start.AddDate(0, req.MonthsToPay, 0)),
+	}
+	loan.MonthlyPayment = sql.NullFloat64{Float64: finance.MonthlyPayment(loan.Principal(), loan.InterestRate, loan.MonthsToPay), Valid: true}
+	if err := s.loanRepo.CreateLoan(loan, maxActive); err != nil {
+		if errors.Is(err, repository.ErrBorrowerLoanLimit) {
+			err = httperr.WithMessage(err, fmt.Sprintf("%s (limit %d)", err, maxActive))
+		}
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(lenderID)
+	if err := s.customFieldRepo.SetValues(lenderID, models.CustomFieldEntityLoan, loan.LoanID, custom); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditLoanCreated, ResourceType: "loan", ResourceID: loan.LoanID})
+
+	stored, err := s.customFieldRepo.GetValues(lenderID, models.CustomFieldEntityLoan, loan.LoanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, loanResponse{Loan: loan, Currency: code, Custom: stored, Risk: risk})
+}
+
+// checkStartDate rejects a new loan's start date more than LoanBackdateDays before today, unless the
+// request carries the admin API key, or more than LoanMaxFutureDays after it
+func (s *Server) checkStartDate(r *http.Request, start, today time.Time) error {
+	backdate := s.Cfg.LoanBackdateDays
+	if start.Before(today.AddDate(0, 0, -backdate)) && !s.isAdmin(r) {
+		if backdate == 0 {
+			return httperr.Validation("start_date cannot be in the past")
+		}
+		return httperr.Validation(fmt.Sprintf("start_date cannot be more than %d days in the past", backdate))
+	}
+	ahead := s.Cfg.LoanMaxFutureDays
+	if ahead <= 0 {
+		ahead = defaultLoanMaxFutureDays
+	}
+	if start.After(today.AddDate(0, 0, ahead)) {
+		return httperr.Validation(fmt.Sprintf("start_date cannot be more than %d days in the future", ahead))
+	}
+	return nil
+}
+
+// maxActiveLoansPerBorrower reads the lender's cap on active loans per borrower; 0 means unlimited
+func (s *Server) maxActiveLoansPerBorrower(lenderID int) (int, error) {
+	setting, err := s.customValueRepo.GetByName(lenderID, models.SettingMaxActiveLoansPerBorrower)
+	if errors.Is(err, repository.ErrCustomValueNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	limit, _ := setting.Value.(float64)
+	return int(limit), nil
+}
+
+// financeOriginationFee reads whether the lender adds origination fees to the amortized principal
+func (s *Server) financeOriginationFee(lenderID int) (bool, error) {
+	setting, err := s.customValueRepo.GetByName(lenderID, models.SettingFinanceOriginationFee)
+	if errors.Is(err, repository.ErrCustomValueNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	financed, _ := setting.Value.(float64)
+	return financed == 1, nil
+}
+
+// markLoanPaid marks one of the caller's pending or active loans as paid.
+// Lenders with a webhook URL are notified through the outbox.
+func (s *Server) markLoanPaid(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+
+	if err := s.loanRepo.MarkPaid(int(claims.LenderID), loanID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditLoanPaid, ResourceType: "loan", ResourceID: loanID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reassignLoanRequest is the body accepted by the reassign endpoint
+type reassignLoanRequest struct {
+	NewBorrowerID int `json:"new_borrower_id"`
+}
+
+// reassignLoan moves one of the caller's pending loans to another of its borrowers
+func (s *Server) reassignLoan(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	var req reassignLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.NewBorrowerID <= 0 {
+		s.writeServiceError(w, r, httperr.Validation("new_borrower_id is required"))
+		return
+	}
+
+	actor := fmt.Sprintf("account:%d", claims.AccountID)
+	if err := s.loanRepo.ReassignLoan(r.Context(), int(claims.LenderID), loanID, req.NewBorrowerID, actor); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// markDefaultedRequest is the body accepted by the mark-defaulted endpoint. as_of defaults to
+// today; without loan_ids every overdue loan is marked.
+type markDefaultedRequest struct {
+	AsOf    string `json:"as_of"`
+	LoanIDs []int  `json:"loan_ids"`
+}
+
+// markLoansDefaulted moves the caller's active loans that were overdue as of as_of, either those
+// listed in loan_ids or all of them, to defaulted in one transaction. Listed loans that are not
+// active and overdue are returned as skipped.
+func (s *Server) markLoansDefaulted(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req markDefaultedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	asOf := today
+	if req.AsOf != "" {
+		var err error
+		if asOf, err = time.Parse(time.DateOnly, req.AsOf); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("as_of must be a YYYY-MM-DD date"))
+			return
+		}
+		if asOf.After(today) {
+			s.writeServiceError(w, r, httperr.Validation("as_of cannot be in the future"))
+			return
+		}
+	}
+	if req.LoanIDs != nil && (len(req.LoanIDs) == 0 || len(req.LoanIDs) > maxDefaultLoanIDs) {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("loan_ids must list between 1 and %d loans, or be omitted", maxDefaultLoanIDs)))
+		return
+	}
+
+	result, err := s.loanRepo.MarkDefaulted(int(claims.LenderID), req.LoanIDs, asOf)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	for _, loanID := range result.LoanIDs {
+		s.auditor.Record(r.Context(), audit.Event{
+			LenderID:     int(claims.LenderID),
+			Action:       models.AuditLoansDefaulted,
+			ResourceType: "loan",
+			ResourceID:   loanID,
+			Details:      map[string]string{"as_of": asOf.Format(time.DateOnly)},
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// recomputeLoan corrects the monthly payment and end date of one of the caller's loans that is not
+// yet paid, and returns the corrected figures along with the ones they replaced.
+func (s *Server) recomputeLoan(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+
+	result, err := s.loanRepo.RecomputeLoan(int(claims.LenderID), loanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	if result.Changed {
+		s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditLoanRecomputed, ResourceType: "loan", ResourceID: loanID, Details: result})
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loanRecomputationResponse{LoanRecomputation: result, Currency: code})
+}
+
+// previewLoanReprice returns what one of the caller's loans would cost at the rate query parameter,
+// next to what it costs now, without changing it. The proposed monthly payment is the one a reprice
+// to that rate stores. Paid loans cannot be repriced and get 409.
+func (s *Server) previewLoanReprice(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	rate, err := strconv.ParseFloat(r.URL.Query().Get("rate"), 64)
+	if err != nil || rate < 0 || rate > 100 {
+		s.writeServiceError(w, r, httperr.Validation("rate must be between 0 and 100"))
+		return
+	}
+
+	st, err := s.loanRepo.GetStatement(int(claims.LenderID), loanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	current := st.Loan
+	if current.PaymentStatus == "paid" {
+		s.writeServiceError(w, r, repository.ErrLoanPaid)
+		return
+	}
+	proposed := current
+	proposed.InterestRate = rate
+	proposed.MonthlyPayment = sql.NullFloat64{Float64: finance.MonthlyPayment(current.Principal(), rate, current.MonthsToPay), Valid: true}
+
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, repricePreviewResponse{
+		LoanID:   loanID,
+		Currency: code,
+		Current:  termsOf(current),
+		Proposed: termsOf(proposed),
+	})
+}
+
+// getLoanDisclosure returns the total cost of credit of one of the caller's loans. Interest is summed
+// over the loan's repayment schedule, and the APR is the effective annual rate at which the scheduled
+// instalments repay what the borrower received: the amount, less the fee when it is paid upfront.
+func (s *Server) getLoanDisclosure(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	st, err := s.loanRepo.GetStatement(int(claims.LenderID), loanID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	loan := st.Loan
+	principal := loan.Principal()
+	payment := finance.Instalment(loan.MonthlyPayment, principal, loan.InterestRate, loan.MonthsToPay)
+	var interest float64
+	var instalments []float64
+	for _, p := range finance.Schedule(principal, loan.InterestRate, payment, loan.MonthsToPay) {
+		interest += p.Interest
+		instalments = append(instalments, p.Amount)
+	}
+	received := loan.Amount
+	repayable := principal + interest
+	if !loan.FeeFinanced {
+		received -= loan.OriginationFee
+		repayable += loan.OriginationFee
+	}
+
+	writeJSON(w, http.StatusOK, loanDisclosure{
+		LoanID:           loanID,
+		Currency:         code,
+		Principal:        principal,
+		Fees:             loan.OriginationFee,
+		FeeFinanced:      loan.FeeFinanced,
+		TotalInterest:    finance.RoundCents(interest),
+		TotalRepayable:   finance.RoundCents(repayable),
+		NumberOfPayments: loan.MonthsToPay,
+		MonthlyPayment:   payment,
+		InterestRate:     loan.InterestRate,
+		APR:              finance.EffectiveAnnualRate(received, instalments),
+	})
+}
+
+// termsOf returns the loan's rate, monthly payment and totals
+func termsOf(l models.Loan) repaymentTerms {
+	return repaymentTerms{
+		InterestRate:   l.InterestRate,
+		MonthlyPayment: l.MonthlyPayment.Float64,
+		TotalInterest:  l.Interest(),
+		TotalRepayable: l.Cost(),
+	}
+}
+
+// listLoansDueSoon returns the caller's active loans with an instalment due within the next days
+// days (default 7, today included), soonest first, with the borrower's contact details.
+func (s *Server) listLoansDueSoon(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	days := defaultDueSoonDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		var err error
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 0 || days > maxDueSoonDays {
+			s.writeServiceError(w, r, httperr.Validation("days must be between 0 and "+strconv.Itoa(maxDueSoonDays)))
+			return
+		}
+	}
+
+	now := time.Now()
+	loans, err := s.loanRepo.ListDueSoon(int(claims.LenderID), now, now.AddDate(0, 0, days))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dueSoonResponse{Days: days, Currency: code, Loans: loans})
+}
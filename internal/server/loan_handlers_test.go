@@ -0,0 +1,729 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/finance"
+	"wisetech-lms-api/internal/models"
+)
+
+// seedLoan inserts a loan for the lender with the given status and returns its ID.
+func seedLoan(t *testing.T, s *Server, lenderID int, status string, amount, rate float64, months int) int {
+	res, err := s.DB.Exec("INSERT INTO Borrowers (Fullnames, Email, Phone_Number) VALUES ('Borrower', 'b' || hex(randomblob(4)) || '@example.com', '555')")
+	if err != nil {
+		t.Fatalf("Failed to seed borrower: %v", err)
+	}
+	borrowerID, _ := res.LastInsertId()
+
+	res, err = s.DB.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Start_Date)
+		VALUES (?, ?, ?, ?, ?, ?, DATE('now'))`, borrowerID, lenderID, months, status, amount, rate)
+	if err != nil {
+		t.Fatalf("Failed to seed loan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestBulkRepriceLoans(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "repricer")
+
+	pendingID := seedLoan(t, s, lenderID, "pending", 10000, 5, 12)
+	activeID := seedLoan(t, s, lenderID, "active", 10000, 5, 12)
+
+	rr := doRequest(t, s, "POST", "/api/loans/bulk-reprice", token, `{"new_rate": 12, "only_pending": true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var body map[string]int
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body["updated"] != 1 {
+		t.Errorf("Expected 1 loan updated, got %d", body["updated"])
+	}
+
+	var rate, payment float64
+	s.DB.QueryRow("SELECT Interest_Rate, Monthly_Payment FROM Loans WHERE Loan_ID = ?", pendingID).Scan(&rate, &payment)
+	if rate != 12 || payment != 888.49 {
+		t.Errorf("Expected pending loan at 12%% paying 888.49, got %.2f%% paying %.2f", rate, payment)
+	}
+
+	s.DB.QueryRow("SELECT Interest_Rate FROM Loans WHERE Loan_ID = ?", activeID).Scan(&rate)
+	if rate != 5 {
+		t.Errorf("Expected active loan to keep rate 5, got %.2f", rate)
+	}
+}
+
+func TestBulkRepriceLoans_InvalidRate(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "badrate")
+
+	for _, body := range []string{`{"new_rate": -1}`, `{}`, `not json`} {
+		rr := doRequest(t, s, "POST", "/api/loans/bulk-reprice", token, body)
+		if rr.Code != http.StatusUnprocessableEntity && rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected a client error for body %s, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestMarkLoanPaid(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "payee")
+	_, _, otherToken := registerTestLender(t, s, "stranger")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	path := fmt.Sprintf("/api/loans/%d/paid", loanID)
+
+	// Test case 1: Other lenders cannot mark the loan paid
+	rr := doRequest(t, s, "POST", path, otherToken, "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+
+	// Test case 2: The owner can
+	rr = doRequest(t, s, "POST", path, token, "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Paid loans cannot be paid again
+	rr = doRequest(t, s, "POST", path, token, "")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rr.Code)
+	}
+}
+
+func TestReassignLoan(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "reassigner")
+	_, _, otherToken := registerTestLender(t, s, "strangerlender")
+	loanID := seedLoan(t, s, lenderID, "pending", 1000, 10, 12)
+	targetLoanID := seedLoan(t, s, lenderID, "active", 500, 10, 6)
+	var targetID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", targetLoanID).Scan(&targetID)
+	body := fmt.Sprintf(`{"new_borrower_id": %d}`, targetID)
+
+	// Test case 1: Other lenders cannot reassign the loan
+	rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/reassign", loanID), otherToken, body)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+
+	// Test case 2: The owner reassigns the pending loan
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/reassign", loanID), token, body)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", loanID).Scan(&borrowerID)
+	if borrowerID != targetID {
+		t.Errorf("Expected borrower %d, got %d", targetID, borrowerID)
+	}
+	var audits int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Audit_Log WHERE Lender_ID = ? AND Action = ?", lenderID, models.AuditLoanReassigned).Scan(&audits)
+	if audits != 1 {
+		t.Errorf("Expected 1 audit entry, got %d", audits)
+	}
+
+	// Test case 3: Active loans cannot be reassigned
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/reassign", targetLoanID), token, fmt.Sprintf(`{"new_borrower_id": %d}`, borrowerID))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "loan_not_pending") {
+		t.Errorf("Expected status 409 loan_not_pending, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: A missing borrower ID is rejected
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/reassign", loanID), token, `{}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestListLoansDueSoon(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "collections")
+	_, _, otherToken := registerTestLender(t, s, "othercollections")
+
+	// A loan started today is next due in about a month; one started 25 days ago is due within a week
+	laterID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	soonID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	s.DB.Exec("UPDATE Loans SET Start_Date = DATE('now', '-25 days') WHERE Loan_ID = ?", soonID)
+	seedLoan(t, s, lenderID, "pending", 1200, 0, 12)
+
+	// Test case 1: The default window of 7 days includes only the loan due soon
+	rr := doRequest(t, s, "GET", "/api/loans/due-soon", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body dueSoonResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Days != 7 || len(body.Loans) != 1 || body.Loans[0].LoanID != soonID {
+		t.Fatalf("Expected only loan %d in a 7-day window, got %+v", soonID, body)
+	}
+	if body.Loans[0].BorrowerEmail == "" || body.Loans[0].BorrowerPhone != "555" {
+		t.Errorf("Expected borrower contact details, got %+v", body.Loans[0])
+	}
+
+	// Test case 2: A wider window includes both, soonest first
+	rr = doRequest(t, s, "GET", "/api/loans/due-soon?days=40", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if len(body.Loans) != 2 || body.Loans[0].LoanID != soonID || body.Loans[1].LoanID != laterID {
+		t.Errorf("Expected loans %d then %d, got %+v", soonID, laterID, body.Loans)
+	}
+
+	// Test case 3: Other lenders see an empty list
+	rr = doRequest(t, s, "GET", "/api/loans/due-soon?days=40", otherToken, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"loans":[]`) {
+		t.Errorf("Expected an empty list, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: Invalid days are rejected
+	for _, days := range []string{"-1", "91", "soon"} {
+		rr = doRequest(t, s, "GET", "/api/loans/due-soon?days="+days, token, "")
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for days=%s, got %d", days, rr.Code)
+		}
+	}
+}
+
+func TestCreateLoan(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "originator")
+
+	existingID := seedLoan(t, s, lenderID, "active", 1000, 5, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", existingID).Scan(&borrowerID)
+	start := time.Now().UTC().AddDate(0, 0, 10)
+	body := fmt.Sprintf(`{"borrower_id": %d, "amount": 1200, "interest_rate": 0, "months_to_pay": 12, "start_date": %q}`, borrowerID, start.Format(time.DateOnly))
+
+	// Test case 1: Under the limit the loan is originated with its payment schedule
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/max_active_loans_per_borrower", token, `{"value": 2}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := doRequest(t, s, "POST", "/api/loans", token, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var loan models.Loan
+	json.Unmarshal(rr.Body.Bytes(), &loan)
+	if loan.PaymentStatus != "active" || loan.MonthlyPayment.Float64 != 100 || loan.EndDate.Time.Format("2006-01-02") != start.AddDate(0, 12, 0).Format("2006-01-02") {
+		t.Errorf("Unexpected loan: %+v", loan)
+	}
+	if !strings.Contains(rr.Body.String(), `"currency":"LSL"`) {
+		t.Errorf("Expected the amounts labelled with the lender's currency, got %s", rr.Body.String())
+	}
+
+	// Test case 2: At the limit the borrower is refused with 409
+	rr = doRequest(t, s, "POST", "/api/loans", token, body)
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "borrower_loan_limit") || !strings.Contains(rr.Body.String(), "limit 2") {
+		t.Errorf("Expected 409 borrower_loan_limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Zero lifts the limit
+	doRequest(t, s, "PUT", "/api/custom-values/max_active_loans_per_borrower", token, `{"value": 0}`)
+	if rr := doRequest(t, s, "POST", "/api/loans", token, body); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 without a limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: The setting must be a whole number, and loans need valid terms and a known borrower
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/max_active_loans_per_borrower", token, `{"value": -1}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a negative limit, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "POST", "/api/loans", token, fmt.Sprintf(`{"borrower_id": %d, "amount": 0, "interest_rate": 5, "months_to_pay": 12}`, borrowerID)); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a zero amount, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "POST", "/api/loans", token, `{"borrower_id": 9999, "amount": 100, "interest_rate": 5, "months_to_pay": 12}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown borrower, got %d", rr.Code)
+	}
+}
+
+func TestCreateLoan_OriginationFee(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "feecharger")
+	existingID := seedLoan(t, s, lenderID, "active", 1000, 5, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", existingID).Scan(&borrowerID)
+	create := func(fee string) (*httptest.ResponseRecorder, models.Loan) {
+		body := fmt.Sprintf(`{"borrower_id": %d, "amount": 1200, "interest_rate": 0, "months_to_pay": 12%s}`, borrowerID, fee)
+		rr := doRequest(t, s, "POST", "/api/loans", token, body)
+		var loan models.Loan
+		json.Unmarshal(rr.Body.Bytes(), &loan)
+		return rr, loan
+	}
+
+	// Test case 1: A flat fee is paid upfront, so it adds to the total cost but not the instalments
+	rr, loan := create(`, "origination_fee": 50`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if loan.OriginationFee != 50 || loan.FeeFinanced || loan.MonthlyPayment.Float64 != 100 || loan.TotalCost != 1250 {
+		t.Errorf("Unexpected loan: %+v", loan)
+	}
+	var stored float64
+	s.DB.QueryRow("SELECT Origination_Fee FROM Loans WHERE Loan_ID = ?", loan.LoanID).Scan(&stored)
+	if stored != 50 {
+		t.Errorf("Expected the fee stored, got %.2f", stored)
+	}
+
+	// Test case 2: A percent fee is taken of the amount
+	_, loan = create(`, "origination_fee": 2.5, "origination_fee_type": "percent"`)
+	if loan.OriginationFee != 30 || loan.TotalCost != 1230 {
+		t.Errorf("Unexpected loan: %+v", loan)
+	}
+
+	// Test case 3: With the setting on, the fee is amortized with the amount
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/finance_origination_fee", token, `{"value": 1}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	_, loan = create(`, "origination_fee": 60`)
+	if !loan.FeeFinanced || loan.MonthlyPayment.Float64 != 105 || loan.TotalCost != 1260 {
+		t.Errorf("Unexpected financed loan: %+v", loan)
+	}
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/recompute", loan.LoanID), token, "")
+	if !strings.Contains(rr.Body.String(), `"changed":false`) {
+		t.Errorf("Expected recomputing to keep the financed payment, got %s", rr.Body.String())
+	}
+
+	// Test case 4: Loans read back carry the fee and total cost
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/loans?borrower_id=%d", borrowerID), token, "")
+	var list loanListResponse
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Loans) != 4 || list.Loans[0].TotalCost != 1260 || list.Loans[2].TotalCost != 1250 {
+		t.Errorf("Unexpected loans: %+v", list.Loans)
+	}
+
+	// Test case 5: Invalid fees and settings
+	for _, fee := range []string{`, "origination_fee": -1`, `, "origination_fee": 101, "origination_fee_type": "percent"`, `, "origination_fee": 5, "origination_fee_type": "monthly"`} {
+		if rr, _ := create(fee); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", fee, rr.Code)
+		}
+	}
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/finance_origination_fee", token, `{"value": 2}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestCreateLoan_StartDate(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "backdater")
+	existingID := seedLoan(t, s, lenderID, "active", 1000, 5, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", existingID).Scan(&borrowerID)
+	today := time.Now().UTC()
+	create := func(start time.Time, admin bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6, "start_date": %q}`, borrowerID, start.Format(time.DateOnly))
+		req := httptest.NewRequest("POST", "/api/loans", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if admin {
+			req.Header.Set("X-Admin-Key", testAdminAPIKey)
+		}
+		rr := httptest.NewRecorder()
+		s.NewRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Loans can start today
+	if rr := create(today, false); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for today, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: Past dates are refused by default, and beyond the allowance once one is set
+	if rr := create(today.AddDate(0, 0, -1), false); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "in the past") {
+		t.Errorf("Expected status 422 for yesterday, got %d: %s", rr.Code, rr.Body.String())
+	}
+	s.Cfg.LoanBackdateDays = 3
+	if rr := create(today.AddDate(0, 0, -3), false); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 within the allowance, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := create(today.AddDate(0, 0, -4), false); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "3 days") {
+		t.Errorf("Expected status 422 beyond the allowance, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: The admin key allows backdating beyond the allowance
+	if rr := create(today.AddDate(0, -2, 0), true); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 for an admin backdate, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := create(today.AddDate(0, -2, 0), false); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 without the admin key, got %d", rr.Code)
+	}
+
+	// Test case 4: Dates too far ahead are refused, even for admins
+	s.Cfg.LoanMaxFutureDays = 30
+	if rr := create(today.AddDate(0, 0, 30), false); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201 at the limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := create(today.AddDate(0, 0, 31), true); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "30 days in the future") {
+		t.Errorf("Expected status 422 past the limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCreateLoan_TimestampFormat(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "timestamper")
+	existingID := seedLoan(t, s, lenderID, "active", 1000, 5, 12)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", existingID).Scan(&borrowerID)
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	// Test case 1: A full timestamp is accepted as the day it names
+	body := fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6, "start_date": %q}`, borrowerID, today+"T09:30:15.123Z")
+	rr := doRequest(t, s, "POST", "/api/loans", token, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: start_date and created_at serialize as RFC3339 in UTC at second precision
+	var raw map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &raw)
+	if raw["start_date"] != today+"T00:00:00Z" {
+		t.Errorf("Expected start_date %sT00:00:00Z, got %v", today, raw["start_date"])
+	}
+	createdAt, _ := raw["created_at"].(string)
+	if parsed, err := time.Parse(models.JSONTimeLayout, createdAt); err != nil || parsed.Nanosecond() != 0 {
+		t.Errorf("Expected created_at in %s, got %q", models.JSONTimeLayout, createdAt)
+	}
+
+	// Test case 3: Anything else is refused
+	body = fmt.Sprintf(`{"borrower_id": %d, "amount": 500, "interest_rate": 5, "months_to_pay": 6, "start_date": "15/10/2026"}`, borrowerID)
+	if rr := doRequest(t, s, "POST", "/api/loans", token, body); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown date format, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRecomputeLoan(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "recomputer")
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 12, 12)
+	paidID := seedLoan(t, s, lenderID, "paid", 1200, 12, 12)
+	s.DB.Exec("UPDATE Loans SET Monthly_Payment = 1 WHERE Loan_ID IN (?, ?)", loanID, paidID)
+
+	// Test case 1: The corrected figures are returned and stored
+	rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/recompute", loanID), token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result models.LoanRecomputation
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if result.MonthlyPayment != 106.62 || result.PreviousMonthlyPayment.Float64 != 1 || !result.Changed || result.EndDate.IsZero() {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// Test case 2: Paid loans are refused
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/recompute", paidID), token, "")
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "loan_paid") {
+		t.Errorf("Expected status 409 for a paid loan, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Unknown loan
+	if rr := doRequest(t, s, "POST", "/api/loans/99999/recompute", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestPreviewLoanReprice(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "previewer")
+	loanID := seedLoan(t, s, lenderID, "pending", 10000, 5, 12)
+	paidID := seedLoan(t, s, lenderID, "paid", 10000, 5, 12)
+	preview := func(query string) (*httptest.ResponseRecorder, repricePreviewResponse) {
+		rr := doRequest(t, s, "GET", fmt.Sprintf("/api/loans/%d/reprice-preview%s", loanID, query), token, "")
+		var body repricePreviewResponse
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr, body
+	}
+
+	// Test case 1: The current and proposed terms are returned and nothing is stored
+	rr, body := preview("?rate=12")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body.Current.InterestRate != 5 || body.Current.MonthlyPayment != 856.07 || body.Current.TotalInterest != 272.84 {
+		t.Errorf("Unexpected current terms: %+v", body.Current)
+	}
+	if body.Proposed.InterestRate != 12 || body.Proposed.MonthlyPayment != 888.49 || body.Proposed.TotalInterest != 661.88 ||
+		body.Proposed.TotalRepayable != 10661.88 || body.Currency == "" {
+		t.Errorf("Unexpected proposed terms: %+v", body)
+	}
+	var rate float64
+	s.DB.QueryRow("SELECT Interest_Rate FROM Loans WHERE Loan_ID = ?", loanID).Scan(&rate)
+	if rate != 5 {
+		t.Errorf("Expected the loan to keep rate 5, got %.2f", rate)
+	}
+
+	// Test case 2: The preview matches the loan after a reprice to the same rate
+	if rr := doRequest(t, s, "POST", "/api/loans/bulk-reprice", token, `{"new_rate": 12}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 repricing, got %d: %s", rr.Code, rr.Body.String())
+	}
+	st, err := s.loanRepo.GetStatement(lenderID, loanID)
+	if err != nil {
+		t.Fatalf("GetStatement failed: %v", err)
+	}
+	repriced := termsOf(st.Loan)
+	if repriced != body.Proposed {
+		t.Errorf("Expected the repriced loan to match the preview %+v, got %+v", body.Proposed, repriced)
+	}
+	if _, again := preview("?rate=12"); again.Current != body.Proposed {
+		t.Errorf("Expected the current terms to be the previewed ones, got %+v", again.Current)
+	}
+
+	// Test case 3: Missing or out of range rates are rejected
+	for _, query := range []string{"", "?rate=abc", "?rate=-1", "?rate=101"} {
+		if rr, _ := preview(query); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %q, got %d", query, rr.Code)
+		}
+	}
+
+	// Test case 4: Paid and unknown loans
+	rr = doRequest(t, s, "GET", fmt.Sprintf("/api/loans/%d/reprice-preview?rate=12", paidID), token, "")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a paid loan, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/loans/99999/reprice-preview?rate=12", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+// listLoansAs lists the lender's loans with the given Accept header
+func listLoansAs(t *testing.T, s *Server, token, query, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/loans"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetLoanDisclosure(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "discloser")
+	_, _, otherToken := registerTestLender(t, s, "outsider")
+	loanID := seedLoan(t, s, lenderID, "active", 10000, 12, 12)
+	feeID := seedLoan(t, s, lenderID, "active", 10000, 12, 12)
+	s.DB.Exec("UPDATE Loans SET Origination_Fee = 200 WHERE Loan_ID = ?", feeID)
+	disclose := func(id int, token string) (*httptest.ResponseRecorder, loanDisclosure) {
+		rr := doRequest(t, s, "GET", fmt.Sprintf("/api/loans/%d/disclosure", id), token, "")
+		var body loanDisclosure
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr, body
+	}
+
+	// Test case 1: The total repayable is the principal plus the schedule's interest
+	rr, body := disclose(loanID, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var interest float64
+	payment := finance.MonthlyPayment(10000, 12, 12)
+	for _, p := range finance.Schedule(10000, 12, payment, 12) {
+		interest += p.Interest
+	}
+	if body.Principal != 10000 || body.TotalInterest != finance.RoundCents(interest) || body.TotalRepayable != finance.RoundCents(10000+interest) ||
+		body.NumberOfPayments != 12 || body.MonthlyPayment != payment || body.Fees != 0 || body.Currency != "LSL" {
+		t.Errorf("Unexpected disclosure: %+v", body)
+	}
+
+	// Test case 2: Monthly compounding puts the APR above the nominal rate, but not by much
+	if body.APR <= body.InterestRate || body.APR > body.InterestRate+1 {
+		t.Errorf("Expected an APR a little above the nominal 12%%, got %.2f", body.APR)
+	}
+
+	// Test case 3: An upfront fee is disclosed, repaid on top and raises the APR further
+	_, withFee := disclose(feeID, token)
+	if withFee.Fees != 200 || withFee.FeeFinanced || withFee.TotalRepayable != finance.RoundCents(body.TotalRepayable+200) || withFee.APR <= body.APR {
+		t.Errorf("Unexpected disclosure with a fee: %+v", withFee)
+	}
+
+	// Test case 4: Other lenders' and unknown loans are not found
+	if rr, _ := disclose(loanID, otherToken); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's loan, got %d", rr.Code)
+	}
+	if rr, _ := disclose(99999, token); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown loan, got %d", rr.Code)
+	}
+}
+
+func TestListLoans_ContentNegotiation(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "negotiator")
+	activeID := seedLoan(t, s, lenderID, "active", 1200, 12, 12)
+	seedLoan(t, s, lenderID, "paid", 500, 10, 6)
+	s.DB.Exec("UPDATE Loans SET Monthly_Payment = 106.62 WHERE Loan_ID = ?", activeID)
+
+	// Test case 1: JSON when asked for, with the filter applied
+	rr := listLoansAs(t, s, token, "?status=active", "application/json")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("Expected a JSON 200, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var page loanListResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 1 || len(page.Loans) != 1 || page.Loans[0].LoanID != activeID || page.Currency != "LSL" {
+		t.Errorf("Expected only the active loan, got %+v", page)
+	}
+
+	// Test case 2: JSON is the default without an Accept header, and for */*
+	for _, accept := range []string{"", "*/*"} {
+		rr = listLoansAs(t, s, token, "", accept)
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") || page.Total != 2 {
+			t.Errorf("Accept %q: expected both loans as JSON, got %d %q", accept, rr.Code, rr.Header().Get("Content-Type"))
+		}
+	}
+
+	// Test case 3: CSV when asked for, with the same filter applied
+	rr = listLoansAs(t, s, token, "?status=active", "text/csv")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("Expected a CSV 200, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "loan_id" || records[1][0] != fmt.Sprint(activeID) ||
+		records[1][2] != "active" || records[1][3] != "1200.00" || records[1][5] != "106.62" {
+		t.Errorf("Unexpected CSV: %v", records)
+	}
+	if records[0][10] != "currency" || records[1][10] != "LSL" {
+		t.Errorf("Expected a currency column, got %v", records)
+	}
+	if rr.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("Expected X-Total-Count 1, got %q", rr.Header().Get("X-Total-Count"))
+	}
+
+	// Test case 4: q-values decide between the two
+	rr = listLoansAs(t, s, token, "", "application/json;q=0.5, text/csv")
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Expected CSV to win on q-value, got %q", rr.Header().Get("Content-Type"))
+	}
+
+	// Test case 5: Unsupported types are refused
+	for _, accept := range []string{"application/xml", "text/html, text/csv;q=0"} {
+		rr = listLoansAs(t, s, token, "", accept)
+		if rr.Code != http.StatusNotAcceptable || !strings.Contains(rr.Body.String(), "not_acceptable") {
+			t.Errorf("Accept %q: expected status 406, got %d %s", accept, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 6: Invalid filters are rejected in either format
+	if rr := listLoansAs(t, s, token, "?status=late", "text/csv"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an unknown status, got %d", rr.Code)
+	}
+
+	// Test case 7: A format query parameter overrides the Accept header
+	rr = listLoansAs(t, s, token, "?format=csv", "application/json")
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Expected format=csv to win, got %q", rr.Header().Get("Content-Type"))
+	}
+
+	// Test case 8: XLSX by format or Accept header, with the same rows as typed cells
+	for _, req := range []struct{ query, accept string }{{"?status=active&format=xlsx", ""}, {"?status=active", mediaTypeXLSX}} {
+		rr = listLoansAs(t, s, token, req.query, req.accept)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != mediaTypeXLSX {
+			t.Fatalf("%s %s: expected an XLSX 200, got %d %q", req.query, req.accept, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		cells := readXLSXSheet(t, rr.Body.Bytes(), 1)
+		if cells["A1"] != "loan_id" || cells["A2"] != fmt.Sprint(activeID) || cells["C2"] != "active" || cells["D2"] != "1200" || cells["K2"] != "LSL" {
+			t.Errorf("Unexpected workbook: %v", cells)
+		}
+		if _, ok := cells["A3"]; ok {
+			t.Errorf("Expected only the active loan, got %v", cells)
+		}
+	}
+}
+
+func TestListLoans_AmountRange(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "slicer")
+	small := seedLoan(t, s, lenderID, "active", 500, 10, 6)
+	medium := seedLoan(t, s, lenderID, "paid", 1500, 10, 12)
+	large := seedLoan(t, s, lenderID, "active", 5000, 10, 24)
+	list := func(query string) loanListResponse {
+		rr := doRequest(t, s, "GET", "/api/loans"+query, token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var page loanListResponse
+		json.Unmarshal(rr.Body.Bytes(), &page)
+		return page
+	}
+
+	// Test case 1: A bounded range is inclusive at both ends
+	if page := list("?min_amount=500&max_amount=1500"); page.Total != 2 || page.Loans[0].LoanID != medium || page.Loans[1].LoanID != small {
+		t.Errorf("Expected the loans of 500 and 1500, got %+v", page)
+	}
+
+	// Test case 2: Without max_amount the range is open-ended, and it combines with status and paging
+	if page := list("?min_amount=1000"); page.Total != 2 || page.Loans[0].LoanID != large {
+		t.Errorf("Expected the loans of 1500 and 5000, got %+v", page)
+	}
+	if page := list("?min_amount=100&status=active&limit=1&offset=1"); page.Total != 2 || len(page.Loans) != 1 || page.Loans[0].LoanID != small {
+		t.Errorf("Expected the second of 2 active loans, got %+v", page)
+	}
+
+	// Test case 3: Invalid ranges and amounts are rejected
+	for _, query := range []string{"?min_amount=2000&max_amount=1000", "?min_amount=-1", "?max_amount=abc", "?max_amount=NaN"} {
+		if rr := doRequest(t, s, "GET", "/api/loans"+query, token, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestMarkLoansDefaulted(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "collector")
+	overdueID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	currentID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	s.DB.Exec("UPDATE Loans SET Start_Date = DATE('now', '-1 year') WHERE Loan_ID = ?", overdueID)
+
+	// Test case 1: The overdue loan is defaulted and the current one skipped
+	rr := doRequest(t, s, "POST", "/api/loans/mark-defaulted", token, fmt.Sprintf(`{"loan_ids": [%d, %d]}`, overdueID, currentID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result models.LoanDefaultResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if result.Defaulted != 1 || len(result.LoanIDs) != 1 || result.LoanIDs[0] != overdueID || len(result.Skipped) != 1 || result.Skipped[0] != currentID {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	var status string
+	s.DB.QueryRow("SELECT Payment_Status FROM Loans WHERE Loan_ID = ?", overdueID).Scan(&status)
+	if status != "defaulted" {
+		t.Errorf("Expected the loan to be defaulted, got '%s'", status)
+	}
+
+	// Test case 2: Without a body every overdue loan is considered; none remain
+	rr = doRequest(t, s, "POST", "/api/loans/mark-defaulted", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if rr.Code != http.StatusOK || result.Defaulted != 0 {
+		t.Errorf("Expected nothing left to default, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Invalid requests
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(time.DateOnly)
+	for _, body := range []string{`{"as_of": "yesterday"}`, `{"as_of": "` + tomorrow + `"}`, `{"loan_ids": []}`} {
+		if rr := doRequest(t, s, "POST", "/api/loans/mark-defaulted", token, body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", body, rr.Code)
+		}
+	}
+}
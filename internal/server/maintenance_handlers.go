@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+)
+
+// getOrphanReport returns the latest report of stored objects without a File row and File rows
+// without a stored object, sweeping now if no sweep has finished yet
+func (s *Server) getOrphanReport(w http.ResponseWriter, r *http.Request) {
+	if report := s.orphans.Last(); report != nil {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	s.sweepOrphans(w, r)
+}
+
+// sweepOrphans compares storage with the File table now and returns the report. Nothing is deleted.
+func (s *Server) sweepOrphans(w http.ResponseWriter, r *http.Request) {
+	report, err := s.orphans.RunOnce(r.Context())
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/jobs"
+)
+
+func TestOrphanReport(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "sweeper")
+	ctx := context.Background()
+
+	if rr := uploadFile(t, s, token, "file", "kept.pdf", pdfHeader); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	s.files.Save(ctx, "lenders/1/files/leftover.pdf", strings.NewReader("leftover"))
+
+	report := func(method string) jobs.OrphanReport {
+		t.Helper()
+		rr := doAdminRequest(t, s, method, "/api/admin/maintenance/orphans", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var r jobs.OrphanReport
+		json.Unmarshal(rr.Body.Bytes(), &r)
+		return r
+	}
+
+	// Test case 1: The first GET sweeps and reports the leftover object
+	first := report("GET")
+	if len(first.Objects) != 1 || first.Objects[0].Key != "lenders/1/files/leftover.pdf" || len(first.Rows) != 0 {
+		t.Errorf("Unexpected report: %+v", first)
+	}
+
+	// Test case 2: Later GETs return the stored report until a sweep is requested
+	s.files.Delete(ctx, "lenders/1/files/leftover.pdf")
+	if again := report("GET"); len(again.Objects) != 1 || !again.CheckedAt.Equal(first.CheckedAt) {
+		t.Errorf("Expected the stored report, got %+v", again)
+	}
+	if swept := report("POST"); len(swept.Objects) != 0 {
+		t.Errorf("Expected a clean report after sweeping, got %+v", swept)
+	}
+
+	// Test case 3: Admin only
+	if rr := doRequest(t, s, "GET", "/api/admin/maintenance/orphans", token, ""); rr.Code == http.StatusOK {
+		t.Error("Expected lenders to be refused")
+	}
+}
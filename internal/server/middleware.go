@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/requestid"
+)
+
+type contextKey string
+
+const (
+	claimsContextKey     contextKey = "claims"
+	requestLogContextKey contextKey = "request_log"
+)
+
+// claimsFromContext returns the token claims stored by the authenticate middleware
+func claimsFromContext(ctx context.Context) *auth.Claims {
+	claims, _ := ctx.Value(claimsContextKey).(*auth.Claims)
+	return claims
+}
+
+// authenticate validates the bearer token and stores its claims in the request context, along
+// with the account and client address that audited changes are attributed to.
+// Tokens of suspended lenders are rejected with 403 and the "suspended" code, and tokens issued
+// before the account's tokens were revoked are rejected with 401.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if !found || tokenString == "" {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+			return
+		}
+
+		claims, err := auth.ValidateToken(tokenString, s.Cfg.JWTSecret)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "invalid or expired token")
+			return
+		}
+
+		status, err := s.authRepo.GetAccountStatus(int(claims.AccountID))
+		if err != nil {
+			if errors.Is(err, repository.ErrAccountNotFound) {
+				writeError(w, http.StatusUnauthorized, "unauthorized", "invalid or expired token")
+				return
+			}
+			s.writeServiceError(w, r, err)
+			return
+		}
+		if status.LenderSuspended {
+			writeError(w, http.StatusForbidden, "suspended", "this lender has been suspended")
+			return
+		}
+		if status.IsLocked {
+			writeError(w, http.StatusForbidden, "account_locked", "this account is locked")
+			return
+		}
+		if tokenRevoked(claims, status) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "token has been revoked")
+			return
+		}
+
+		if entry, ok := r.Context().Value(requestLogContextKey).(*requestLogEntry); ok {
+			entry.lenderID = int(claims.LenderID)
+		}
+		ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+		ctx = audit.WithSource(ctx, audit.AccountSource(int(claims.AccountID), clientIP(r)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenRevoked reports whether the token was issued before the account's tokens were revoked.
+// Tokens without an issued-at time count as revoked once any revocation has happened.
+func tokenRevoked(claims *auth.Claims, status *models.AccountStatus) bool {
+	if !status.TokensRevokedAt.Valid {
+		return false
+	}
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return claims.IssuedAt.Time.Before(status.TokensRevokedAt.Time)
+}
+
+// requestID gives every request an ID, taken from the load balancer's X-Request-ID header when it
+// sent a valid one. The ID is stored in the request context for log lines and echoed back in the
+// X-Request-ID response header, which error responses also read it from.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), id)))
+	})
+}
+
+// requestLogEntry carries the fields of a request's log line that are only known once the
+// handlers further down have run
+type requestLogEntry struct {
+	lenderID int // Set by authenticate; 0 for unauthenticated requests
+}
+
+// logRequests logs every request once it has been served, with its method, path, status, size,
+// duration and request ID, and the lender it was made for when authenticated. Server errors are
+// logged at error level.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLogEntry{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ctx := context.WithValue(r.Context(), requestLogContextKey, entry)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK // Nothing was written, which net/http sends as 200
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			}
+			if entry.lenderID != 0 {
+				attrs = append(attrs, slog.Int("lender_id", entry.lenderID))
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			s.logger.LogAttrs(ctx, level, "Request served", attrs...)
+		}()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+// recoverPanics answers a panicking handler with a 500 error envelope and logs the panic with its
+// stack. http.ErrAbortHandler is re-raised so net/http aborts the response as intended.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			s.logger.ErrorContext(r.Context(), "Handler panicked", "panic", rec, "stack", string(debug.Stack()))
+			writeError(w, http.StatusInternalServerError, "internal_error", "internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAllowedHost rejects requests whose Host header is not one of the configured AllowedHosts
+// with 421 Misdirected Request, so a production deployment only serves its own hostnames. An entry
+// without a port matches the host on any port. Every host is allowed when the list is empty.
+func (s *Server) requireAllowedHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Cfg != nil && len(s.Cfg.AllowedHosts) > 0 && !hostAllowed(r.Host, s.Cfg.AllowedHosts) {
+			writeError(w, http.StatusMisdirectedRequest, "misdirected_request", "this server does not serve the requested host")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hostAllowed reports whether a Host header matches one of the allowed hosts, ignoring case
+func hostAllowed(host string, allowed []string) bool {
+	if host == "" {
+		return false
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, host) || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin allows only requests carrying the configured admin API key in the X-Admin-Key header.
+// All admin requests are rejected when no key is configured. Changes made through them are audited
+// as the "admin" actor.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "admin API key required")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithSource(r.Context(), audit.Source{Actor: "admin", IP: clientIP(r)})))
+	})
+}
+
+// isAdmin reports whether the request carries the admin API key in its X-Admin-Key header
+func (s *Server) isAdmin(r *http.Request) bool {
+	key := r.Header.Get("X-Admin-Key")
+	return s.Cfg.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.Cfg.AdminAPIKey)) == 1
+}
+
+// requireActiveSubscription rejects requests from lenders without a current subscription.
+// Lapsed trials are reported with the distinct "trial_expired" code so clients can prompt an upgrade.
+// Requests during the post-expiry grace period are allowed but carry X-Subscription-Grace-Days-Remaining
+// and a Warning header.
+func (s *Server) requireActiveSubscription(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFromContext(r.Context())
+		if claims == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+			return
+		}
+
+		sub, err := s.ledgerRepo.GetCurrentSubscription(r.Context(), int(claims.LenderID))
+		if err != nil {
+			if errors.Is(err, repository.ErrSubscriptionNotFound) {
+				writeError(w, http.StatusPaymentRequired, "subscription_required", "an active subscription is required")
+				return
+			}
+			s.writeServiceError(w, r, err)
+			return
+		}
+
+		state := newSubscriptionState(sub, time.Now(), s.Cfg.SubscriptionGraceDays)
+		if state.InGracePeriod {
+			w.Header().Set("X-Subscription-Grace-Days-Remaining", strconv.Itoa(state.GraceDaysRemaining))
+			w.Header().Set("Warning", fmt.Sprintf("299 - %q", state.Warnings[0]))
+		} else if !state.Active {
+			if sub.IsTrial {
+				writeError(w, http.StatusPaymentRequired, "trial_expired", "your free trial has ended")
+				return
+			}
+			writeError(w, http.StatusPaymentRequired, "subscription_expired", "your subscription is not active")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasFeature reports whether the authenticated lender's plan enables the named feature.
+func (s *Server) hasFeature(ctx context.Context, name string) (bool, error) {
+	claims := claimsFromContext(ctx)
+	if claims == nil {
+		return false, nil
+	}
+	features, err := s.features.Get(int(claims.LenderID))
+	if err != nil {
+		return false, err
+	}
+	return features.Has(name), nil
+}
+
+// requireFeature rejects requests from lenders whose plan does not include the named feature
+// with 402 and the "feature_not_available" code.
+func (s *Server) requireFeature(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, err := s.hasFeature(r.Context(), name)
+			if err != nil {
+				s.writeServiceError(w, r, err)
+				return
+			}
+			if !ok {
+				writeError(w, http.StatusPaymentRequired, "feature_not_available", "your plan does not include "+name)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// notificationPreferencesResponse lists the caller's preference for every event and channel
+type notificationPreferencesResponse struct {
+	Preferences []models.NotificationPreference `json:"preferences"`
+}
+
+// notificationPreferenceRequest is one preference in the body accepted when setting them.
+// enabled is required.
+type notificationPreferenceRequest struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// getNotificationPreferences returns which events the caller is sent on each channel
+func (s *Server) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	prefs, err := s.notificationPrefRepo.List(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notificationPreferencesResponse{Preferences: prefs})
+}
+
+// setNotificationPreferences turns the listed events on or off per channel, leaving the others as
+// they were, and returns every preference. Events already queued are checked when they are sent.
+func (s *Server) setNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req struct {
+		Preferences []notificationPreferenceRequest `json:"preferences"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if len(req.Preferences) == 0 {
+		s.writeServiceError(w, r, httperr.Validation("preferences must list at least one event"))
+		return
+	}
+	prefs := make([]models.NotificationPreference, len(req.Preferences))
+	for i, pref := range req.Preferences {
+		channels, ok := models.NotificationChannels[pref.Event]
+		switch {
+		case !ok:
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("event %q cannot be configured", pref.Event)))
+			return
+		case !slices.Contains(channels, pref.Channel):
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("%s is not sent by %q", pref.Event, pref.Channel)))
+			return
+		case pref.Enabled == nil:
+			s.writeServiceError(w, r, httperr.Validation("enabled is required"))
+			return
+		}
+		prefs[i] = models.NotificationPreference{Event: pref.Event, Channel: pref.Channel, Enabled: *pref.Enabled}
+	}
+
+	lenderID := int(claims.LenderID)
+	if err := s.notificationPrefRepo.Set(lenderID, prefs); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	saved, err := s.notificationPrefRepo.List(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: lenderID, Action: models.AuditNotificationPreferencesSet, ResourceType: "lender", ResourceID: lenderID, Details: prefs})
+	writeJSON(w, http.StatusOK, notificationPreferencesResponse{Preferences: saved})
+}
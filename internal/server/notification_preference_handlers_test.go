@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "preferrer")
+	preferences := func(rr *httptest.ResponseRecorder) map[string]bool {
+		var resp notificationPreferencesResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		found := map[string]bool{}
+		for _, pref := range resp.Preferences {
+			found[pref.Event+" "+pref.Channel] = pref.Enabled
+		}
+		return found
+	}
+
+	// Test case 1: Every event is enabled by default
+	rr := doRequest(t, s, "GET", "/api/lenders/me/notification-preferences", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if found := preferences(rr); len(found) != 4 || !found["loan.paid webhook"] || !found["subscription.expiring email"] {
+		t.Errorf("Expected every preference enabled, got %v", found)
+	}
+
+	// Test case 2: Unknown events and channels, and a missing enabled, are rejected
+	for _, body := range []string{
+		`{"preferences": []}`,
+		`{"preferences": [{"event": "loan.created", "channel": "webhook", "enabled": false}]}`,
+		`{"preferences": [{"event": "loan.paid", "channel": "email", "enabled": false}]}`,
+		`{"preferences": [{"event": "loan.paid", "channel": "webhook"}]}`,
+	} {
+		if rr := doRequest(t, s, "PUT", "/api/lenders/me/notification-preferences", token, body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 3: Turning loan.paid off leaves the other events on
+	rr = doRequest(t, s, "PUT", "/api/lenders/me/notification-preferences", token,
+		`{"preferences": [{"event": "loan.paid", "channel": "webhook", "enabled": false}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if found := preferences(rr); found["loan.paid webhook"] || !found["loan.defaulted webhook"] {
+		t.Errorf("Expected only loan.paid turned off, got %v", found)
+	}
+
+	// Test case 4: The loan.paid webhook is suppressed while loan.defaulted still fires
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Webhook-Event"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	if err := s.lenderRepo.SetWebhookURL(lenderID, target.URL); err != nil {
+		t.Fatalf("SetWebhookURL failed: %v", err)
+	}
+	paidID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	overdueID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	s.DB.Exec("UPDATE Loans SET Start_Date = DATE('now', '-1 year') WHERE Loan_ID = ?", overdueID)
+	if rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/paid", paidID), token, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 marking the loan paid, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(t, s, "POST", "/api/loans/mark-defaulted", token, fmt.Sprintf(`{"loan_ids": [%d]}`, overdueID)); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 defaulting the loan, got %d: %s", rr.Code, rr.Body.String())
+	}
+	dispatcher := jobs.NewOutboxDispatcher(repository.NewOutboxRepository(s.DB), s.notificationPrefRepo)
+	if n, err := dispatcher.RunOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 delivery, got %d (%v)", n, err)
+	}
+	if len(received) != 1 || received[0] != models.EventLoanDefaulted {
+		t.Errorf("Expected only loan.defaulted posted, got %v", received)
+	}
+}
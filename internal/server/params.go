@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/url"
+	"time"
+
+	"wisetech-lms-api/internal/httperr"
+)
+
+// parseDateParam parses a YYYY-MM-DD date or an RFC3339 timestamp from a query parameter.
+// Date-only values are interpreted as midnight in loc. An empty value yields the zero time.
+func parseDateParam(name, value string, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, httperr.Validation(name + " must be a YYYY-MM-DD date or RFC3339 timestamp")
+}
+
+// parseDateRange parses the fromName and toName query parameters into a half-open [from, to) range
+// of UTC instants. Dates are days in loc, and a date-only to value includes that whole day. Either
+// end is the zero time when its parameter is omitted.
+func parseDateRange(query url.Values, fromName, toName string, loc *time.Location) (from, to time.Time, err error) {
+	from, _, err = parseDateParam(fromName, query.Get(fromName), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, dateOnly, err := parseDateParam(toName, query.Get(toName), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, httperr.Validation(fromName + " must be before " + toName)
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+// parseReportDays parses the from and to query parameters of a daily report into the first and last
+// day it covers, inclusive, as midnights in loc. A timestamp counts the day it falls on in loc. The
+// days default to the last days days up to today.
+func parseReportDays(query url.Values, loc *time.Location, days int) (first, last time.Time, err error) {
+	from, to, err := parseDateRange(query, "from", "to", loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	last = startOfDay(time.Now().In(loc))
+	first = last.AddDate(0, 0, -(days - 1))
+	if !to.IsZero() {
+		last = startOfDay(to.Add(-time.Nanosecond).In(loc))
+	}
+	if !from.IsZero() {
+		first = startOfDay(from.In(loc))
+	}
+	if first.After(last) {
+		return time.Time{}, time.Time{}, httperr.Validation("from must not be after to")
+	}
+	return first, last, nil
+}
+
+// startOfDay returns the midnight starting t's day in t's location
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// validTimezone reports whether name is an IANA time zone, such as Africa/Maseru or UTC
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// lenderLocation returns the time zone the lender's report dates are interpreted in
+func (s *Server) lenderLocation(lenderID int) (*time.Location, error) {
+	name, err := s.lenderRepo.GetTimezone(lenderID)
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/utils"
+)
+
+// passwordResetTTL is how long a reset link stays valid
+const passwordResetTTL = time.Hour
+
+// forgotPasswordRequest is the body accepted by the forgot-password endpoint
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// resetPasswordRequest is the body accepted by the reset-password endpoint
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// hashResetToken returns the hex SHA-256 of a reset token; only the hash is stored
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// forgotPassword emails a password reset link to the lender registered with the given email.
+// It always answers 202 so the endpoint cannot be used to discover registered emails. The email is
+// only queued, never sent inline, so a registered email takes no longer to answer than an unknown
+// one and a mailer outage is not visible; the email dispatcher delivers it.
+func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		s.writeServiceError(w, r, httperr.Validation("email is required"))
+		return
+	}
+
+	accepted := map[string]string{"message": "if the email is registered, a reset link has been sent"}
+
+	account, err := s.authRepo.GetAccountByEmail(email)
+	if err != nil {
+		if !errors.Is(err, repository.ErrAccountNotFound) {
+			s.logger.ErrorContext(r.Context(), "Forgot password lookup failed", "error", err)
+		}
+		writeJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	token := hex.EncodeToString(raw)
+	if err := s.authRepo.CreatePasswordReset(account.AccountID, hashResetToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	link := strings.TrimRight(s.Cfg.AppBaseURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hello %s,\n\nUse the link below to reset your password. It expires in %d minutes.\n\n%s\n\nIf you did not ask for a reset, ignore this email.\n",
+		account.Username, int(passwordResetTTL.Minutes()), link)
+	if err := s.emails.Enqueue(r.Context(), account.LenderID, models.NotificationPasswordReset, email, "Reset your password", body); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to queue password reset email", "account_id", account.AccountID, "error", err)
+	}
+
+	writeJSON(w, http.StatusAccepted, accepted)
+}
+
+// resetPassword sets a new password using a token from a reset email
+func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.Token == "" {
+		s.writeServiceError(w, r, httperr.Validation("token is required"))
+		return
+	}
+	if err := utils.ValidatePassword(req.Password); err != nil {
+		s.writeServiceError(w, r, httperr.Validation(err.Error()))
+		return
+	}
+	if err := s.checkPasswordBreach(r.Context(), req.Password); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if err := s.authRepo.ResetPassword(hashResetToken(req.Token), passwordHash); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPasswordBreach rejects a new password found in the Have I Been Pwned corpus when
+// Cfg.PasswordBreachCheck is set. The check fails open: if the range API cannot be reached the
+// password is accepted and the failure logged.
+func (s *Server) checkPasswordBreach(ctx context.Context, password string) error {
+	if !s.Cfg.PasswordBreachCheck {
+		return nil
+	}
+	pwned, err := utils.CheckPasswordPwned(ctx, password)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Password breach check failed", "error", err)
+		return nil
+	}
+	if pwned {
+		return httperr.Validation("password has appeared in a data breach; choose a different one")
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/utils"
+)
+
+// sentMail is a message captured by captureMailer.
+type sentMail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// captureMailer records every message instead of sending it.
+type captureMailer struct {
+	sent []sentMail
+}
+
+func (m *captureMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// failingMailer fails every send, as when the mail server is down.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, to, subject, body string) error {
+	return errors.New("mail server unavailable")
+}
+
+// useMailer sends the server's email through m, including the emails it queues
+func useMailer(s *Server, m mailer.Mailer) {
+	s.mailer = m
+	s.emails.Mailer = m
+}
+
+var resetTokenPattern = regexp.MustCompile(`token=([^\s]+)`)
+
+func TestForgotPassword_SendsResetLink(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.AppBaseURL = "https://app.example.com"
+	mail := &captureMailer{}
+	useMailer(s, mail)
+	accountID, _, _ := registerTestLender(t, s, "forgetful")
+
+	// Test case 1: Unknown email is accepted without sending anything
+	rr := doRequest(t, s, "POST", "/api/auth/forgot-password", "", `{"email": "nobody@example.com"}`)
+	if rr.Code != http.StatusAccepted || len(mail.sent) != 0 {
+		t.Fatalf("Expected 202 and no mail, got %d with %d sent", rr.Code, len(mail.sent))
+	}
+
+	// Test case 2: Registered email is queued, not sent inline, and the dispatcher sends the link
+	rr = doRequest(t, s, "POST", "/api/auth/forgot-password", "", `{"email": "forgetful@example.com"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mail.sent) != 0 {
+		t.Fatalf("Expected the request to only queue the email, got %+v", mail.sent)
+	}
+	if sent, err := s.emails.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the queued email sent, got %d, %v", sent, err)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "forgetful@example.com" {
+		t.Fatalf("Expected one email to the lender, got %+v", mail.sent)
+	}
+	match := resetTokenPattern.FindStringSubmatch(mail.sent[0].Body)
+	if match == nil {
+		t.Fatalf("Expected the email to contain a reset token, got %q", mail.sent[0].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	if !regexp.MustCompile(`https://app\.example\.com/reset-password\?token=`).MatchString(mail.sent[0].Body) {
+		t.Errorf("Expected a link on the app base URL, got %q", mail.sent[0].Body)
+	}
+
+	// Test case 3: The token resets the password once
+	rr = doRequest(t, s, "POST", "/api/auth/reset-password", "", fmt.Sprintf(`{"token": %q, "password": "NewPassw0rd"}`, token))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	account, _ := s.authRepo.GetAccountByID(accountID)
+	if utils.CheckPassword(account.PasswordHash, "NewPassw0rd") != nil {
+		t.Error("Expected the new password to be set")
+	}
+
+	rr = doRequest(t, s, "POST", "/api/auth/reset-password", "", fmt.Sprintf(`{"token": %q, "password": "0therPassword"}`, token))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when reusing a token, got %d", rr.Code)
+	}
+}
+
+func TestForgotPassword_MailerDown(t *testing.T) {
+	s := newTestServer(t)
+	useMailer(s, failingMailer{})
+	registerTestLender(t, s, "unlucky")
+
+	// Test case 1: The request succeeds although the email could not be sent
+	rr := doRequest(t, s, "POST", "/api/auth/forgot-password", "", `{"email": "unlucky@example.com"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: The failed delivery stays queued for the dispatcher to retry
+	if sent, err := s.emails.RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("Expected nothing sent, got %d, %v", sent, err)
+	}
+	pending, _, err := s.notificationRepo.List(repository.NotificationFilter{Status: models.NotificationPending, Kind: models.NotificationPasswordReset, Limit: 10})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Recipient != "unlucky@example.com" || pending[0].LastError.String != "mail server unavailable" {
+		t.Fatalf("Expected one pending reset email, got %+v", pending)
+	}
+
+	// Test case 3: Once the mailer is back the dispatcher delivers the queued link
+	mail := &captureMailer{}
+	useMailer(s, mail)
+	s.DB.Exec("UPDATE Notifications SET Next_Attempt_At = ? WHERE Notification_ID = ?", time.Now().UTC(), pending[0].NotificationID)
+	if sent, err := s.emails.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the queued email sent, got %d, %v", sent, err)
+	}
+	if len(mail.sent) != 1 || !resetTokenPattern.MatchString(mail.sent[0].Body) {
+		t.Errorf("Expected the reset link delivered, got %+v", mail.sent)
+	}
+}
+
+func TestResetPassword_Validation(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := doRequest(t, s, "POST", "/api/auth/reset-password", "", `{"token": "abc", "password": "short"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a weak password, got %d", rr.Code)
+	}
+
+	rr = doRequest(t, s, "POST", "/api/auth/reset-password", "", `{"token": "unknown", "password": "GoodPassw0rd"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown token, got %d", rr.Code)
+	}
+}
+
+func TestResetPassword_BreachCheck(t *testing.T) {
+	s := newTestServer(t)
+	mail := &captureMailer{}
+	useMailer(s, mail)
+	registerTestLender(t, s, "breached")
+
+	// SHA-1("Passw0rd123") starts 3F737; the stub lists its suffix for every prefix
+	pwnedRange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "65ECD65A96D49BA721A2D73EF0BBE792497:12\r\n")
+	}))
+	defer pwnedRange.Close()
+	rangeURL := utils.PwnedPasswordsURL
+	utils.PwnedPasswordsURL = pwnedRange.URL + "/range/"
+	t.Cleanup(func() { utils.PwnedPasswordsURL = rangeURL })
+
+	doRequest(t, s, "POST", "/api/auth/forgot-password", "", `{"email": "breached@example.com"}`)
+	s.emails.RunOnce(context.Background())
+	token, _ := url.QueryUnescape(resetTokenPattern.FindStringSubmatch(mail.sent[0].Body)[1])
+	reset := func(password string) int {
+		return doRequest(t, s, "POST", "/api/auth/reset-password", "", fmt.Sprintf(`{"token": %q, "password": %q}`, token, password)).Code
+	}
+
+	// Test case 1: A breached password is rejected when the check is enabled
+	s.Cfg.PasswordBreachCheck = true
+	if code := reset("Passw0rd123"); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a breached password, got %d", code)
+	}
+
+	// Test case 2: A password missing from the range is accepted
+	if code := reset("Unbreached9Pass"); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+}
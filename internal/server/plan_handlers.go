@@ -0,0 +1,317 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// currencyCodePattern matches a three-letter ISO 4217 style currency code
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// planResponse is a plan with either its price in one currency or all of its prices
+type planResponse struct {
+	models.Plan
+	Currency string             `json:"currency,omitempty"`
+	Prices   []models.PlanPrice `json:"prices,omitempty"`
+}
+
+// listPlans returns the active plans. With ?currency= each plan is priced in that currency;
+// without it a signed-in lender gets their own currency and anonymous callers every
+// per-currency price.
+func (s *Server) listPlans(w http.ResponseWriter, r *http.Request) {
+	currency := r.URL.Query().Get("currency")
+	if currency != "" && !currencyCodePattern.MatchString(currency) {
+		s.writeServiceError(w, r, httperr.Validation("currency must be a three-letter code"))
+		return
+	}
+	if currency == "" {
+		currency = s.callerCurrency(r)
+	}
+
+	plans, err := s.planRepo.ListActivePlans()
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	response := make([]planResponse, 0, len(plans))
+	if currency != "" {
+		for _, plan := range plans {
+			price, err := s.planRepo.GetPrice(plan.PlanID, currency)
+			if err != nil {
+				s.writeServiceError(w, r, err)
+				return
+			}
+			plan.Price = price
+			response = append(response, planResponse{Plan: plan, Currency: currency})
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	prices, err := s.planRepo.ListActivePlanPrices()
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	byPlan := make(map[int][]models.PlanPrice)
+	for _, price := range prices {
+		byPlan[price.PlanID] = append(byPlan[price.PlanID], price)
+	}
+	for _, plan := range plans {
+		response = append(response, planResponse{Plan: plan, Prices: byPlan[plan.PlanID]})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// callerCurrency returns the currency of the lender whose bearer token accompanies a request to
+// a public route, or "" when there is no valid token. The route stays public, so a bad token is
+// treated as anonymous rather than rejected.
+func (s *Server) callerCurrency(r *http.Request) string {
+	tokenString, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || tokenString == "" {
+		return ""
+	}
+	claims, err := auth.ValidateToken(tokenString, s.Cfg.JWTSecret)
+	if err != nil {
+		return ""
+	}
+	currency, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		return ""
+	}
+	return currency
+}
+
+// listPlanPrices returns every per-currency price of a plan
+func (s *Server) listPlanPrices(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid plan id"))
+		return
+	}
+	if _, err := s.planRepo.GetPlanByID(planID); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	prices, err := s.planRepo.ListPrices(planID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if prices == nil {
+		prices = []models.PlanPrice{}
+	}
+	writeJSON(w, http.StatusOK, prices)
+}
+
+// setPlanPrice creates or updates a plan's price in one currency
+func (s *Server) setPlanPrice(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid plan id"))
+		return
+	}
+	currency := chi.URLParam(r, "currency")
+	if !currencyCodePattern.MatchString(currency) {
+		s.writeServiceError(w, r, httperr.Validation("currency must be a three-letter code"))
+		return
+	}
+
+	var req struct {
+		Amount *float64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if req.Amount == nil || *req.Amount < 0 {
+		s.writeServiceError(w, r, httperr.Validation("amount must be zero or greater"))
+		return
+	}
+
+	if err := s.planRepo.SetPrice(planID, currency, *req.Amount); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{
+		Action:       models.AuditPlanPriceSet,
+		ResourceType: "plan",
+		ResourceID:   planID,
+		Details:      map[string]any{"currency": currency, "amount": *req.Amount},
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"plan_id":  planID,
+		"currency": currency,
+		"amount":   *req.Amount,
+	})
+}
+
+// deletePlanPrice removes a plan's price in one currency
+func (s *Server) deletePlanPrice(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid plan id"))
+		return
+	}
+
+	currency := chi.URLParam(r, "currency")
+	if err := s.planRepo.DeletePrice(planID, currency); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{Action: models.AuditPlanPriceDeleted, ResourceType: "plan", ResourceID: planID, Details: map[string]string{"currency": currency}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setPlanFeatures replaces a plan's feature flags and limits. Unknown keys are rejected so
+// typos don't silently grant nothing.
+func (s *Server) setPlanFeatures(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid plan id"))
+		return
+	}
+
+	var features models.PlanFeatures
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&features); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			s.writeServiceError(w, r, httperr.Field(strings.Trim(field, `"`), "is not a known feature"))
+			return
+		}
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if features.MaxUsers < 0 || features.MaxActiveLoans < 0 || features.MaxBorrowers < 0 ||
+		features.MaxLoanAmount < 0 || features.MaxLoanMonths < 0 || features.MaxStorageBytes < 0 {
+		s.writeServiceError(w, r, httperr.Validation("limits must be zero (unlimited) or greater"))
+		return
+	}
+
+	if err := s.planRepo.SetFeatures(planID, features); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.features.InvalidateAll()
+	s.auditor.Record(r.Context(), audit.Event{Action: models.AuditPlanFeaturesSet, ResourceType: "plan", ResourceID: planID, Details: features})
+
+	plan, err := s.planRepo.GetPlanByID(planID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// listAllPlans returns every plan, including deactivated ones
+func (s *Server) listAllPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := s.planRepo.ListAllPlans()
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if plans == nil {
+		plans = []models.Plan{}
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+// createPlan adds a plan to the catalog. Plans are active unless is_active is false.
+func (s *Server) createPlan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Plan      string              `json:"plan"`
+		Price     *float64            `json:"price"`
+		IsTrial   bool                `json:"is_trial"`
+		TrialDays int                 `json:"trial_days"`
+		Features  models.PlanFeatures `json:"features"`
+		IsActive  *bool               `json:"is_active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	plan := models.Plan{
+		Plan:      strings.TrimSpace(req.Plan),
+		IsTrial:   req.IsTrial,
+		TrialDays: req.TrialDays,
+		Features:  req.Features,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+	}
+	if req.Price != nil {
+		plan.Price = *req.Price
+	}
+	switch {
+	case plan.Plan == "":
+		s.writeServiceError(w, r, httperr.Validation("plan is required"))
+		return
+	case req.Price == nil || *req.Price < 0:
+		s.writeServiceError(w, r, httperr.Validation("price must be zero or greater"))
+		return
+	case plan.TrialDays < 0:
+		s.writeServiceError(w, r, httperr.Validation("trial_days must be zero or greater"))
+		return
+	}
+
+	if err := s.planRepo.CreatePlan(&plan); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{Action: models.AuditPlanCreated, ResourceType: "plan", ResourceID: plan.PlanID, Details: plan})
+	writeJSON(w, http.StatusCreated, plan)
+}
+
+// updatePlan renames, reprices or activates/deactivates a plan. Deactivating a plan hides it
+// from /api/plans, but lenders already on it keep it.
+func (s *Server) updatePlan(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid plan id"))
+		return
+	}
+
+	var update models.PlanUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if update.Plan != nil {
+		name := strings.TrimSpace(*update.Plan)
+		update.Plan = &name
+		if name == "" {
+			s.writeServiceError(w, r, httperr.Validation("plan must not be empty"))
+			return
+		}
+	}
+	if update.Price != nil && *update.Price < 0 {
+		s.writeServiceError(w, r, httperr.Validation("price must be zero or greater"))
+		return
+	}
+	if update.TrialDays != nil && *update.TrialDays < 0 {
+		s.writeServiceError(w, r, httperr.Validation("trial_days must be zero or greater"))
+		return
+	}
+
+	if err := s.planRepo.UpdatePlan(planID, update); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{Action: models.AuditPlanUpdated, ResourceType: "plan", ResourceID: planID, Details: update})
+	plan, err := s.planRepo.GetPlanByID(planID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// doAdminRequest serves a request through the router with the test admin API key.
+func doAdminRequest(t *testing.T, s *Server, method, path, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Admin-Key", testAdminAPIKey)
+
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+// seedPlan inserts an active plan with a legacy single price and returns its ID.
+func seedPlan(t *testing.T, s *Server, name string, price float64) int {
+	res, err := s.DB.Exec("INSERT INTO Plans (Plan, Price) VALUES (?, ?)", name, price)
+	if err != nil {
+		t.Fatalf("Failed to seed plan: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+func TestListPlans(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Basic", 100)
+	s.planRepo.SetPrice(planID, "LSL", 100)
+	s.planRepo.SetPrice(planID, "ZAR", 110)
+
+	// Test case 1: Unauthenticated listing includes every price
+	rr := doRequest(t, s, "GET", "/api/plans", "", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var all []planResponse
+	json.Unmarshal(rr.Body.Bytes(), &all)
+	if len(all) != 1 || len(all[0].Prices) != 2 {
+		t.Fatalf("Expected one plan with two prices, got %+v", all)
+	}
+
+	// Test case 2: A single currency resolves the price
+	rr = doRequest(t, s, "GET", "/api/plans?currency=ZAR", "", "")
+	var zar []planResponse
+	json.Unmarshal(rr.Body.Bytes(), &zar)
+	if len(zar) != 1 || zar[0].Price != 110 || zar[0].Currency != "ZAR" || zar[0].Prices != nil {
+		t.Errorf("Expected ZAR 110, got %+v", zar)
+	}
+
+	// Test case 3: Invalid currency code
+	rr = doRequest(t, s, "GET", "/api/plans?currency=rand", "", "")
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+
+	// Test case 4: A signed-in lender is priced in their own currency by default
+	_, _, token := registerTestLender(t, s, "pricer")
+	rr = doRequest(t, s, "GET", "/api/plans", token, "")
+	var own []planResponse
+	json.Unmarshal(rr.Body.Bytes(), &own)
+	if len(own) != 1 || own[0].Price != 100 || own[0].Currency != "LSL" || own[0].Prices != nil {
+		t.Errorf("Expected the lender's LSL 100, got %+v", own)
+	}
+
+	// Test case 5: An invalid token is treated as anonymous
+	rr = doRequest(t, s, "GET", "/api/plans", "not-a-token", "")
+	var anonymous []planResponse
+	json.Unmarshal(rr.Body.Bytes(), &anonymous)
+	if rr.Code != http.StatusOK || len(anonymous) != 1 || len(anonymous[0].Prices) != 2 {
+		t.Errorf("Expected every price for an invalid token, got %d %+v", rr.Code, anonymous)
+	}
+}
+
+func TestAdminPlanPrices(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Premium", 300)
+	path := fmt.Sprintf("/api/admin/plans/%d/prices", planID)
+
+	// Test case 1: Admin key is required
+	rr := doRequest(t, s, "PUT", path+"/ZAR", "", `{"amount": 280}`)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without admin key, got %d", rr.Code)
+	}
+
+	// Test case 2: Set and list prices
+	rr = doAdminRequest(t, s, "PUT", path+"/ZAR", `{"amount": 280}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doAdminRequest(t, s, "GET", path, "")
+	var prices []map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &prices)
+	if len(prices) != 1 || prices[0]["currency"] != "ZAR" {
+		t.Errorf("Expected only the ZAR price, got %v", prices)
+	}
+
+	// Test case 3: Validation
+	rr = doAdminRequest(t, s, "PUT", path+"/ZAR", `{"amount": -1}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a negative amount, got %d", rr.Code)
+	}
+	rr = doAdminRequest(t, s, "PUT", "/api/admin/plans/99999/prices/ZAR", `{"amount": 1}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing plan, got %d", rr.Code)
+	}
+
+	// Test case 4: Delete
+	rr = doAdminRequest(t, s, "DELETE", path+"/ZAR", "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+	rr = doAdminRequest(t, s, "DELETE", path+"/ZAR", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted price, got %d", rr.Code)
+	}
+}
+
+func TestAdminSetPlanFeatures(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Pro", 500)
+	path := fmt.Sprintf("/api/admin/plans/%d/features", planID)
+
+	// Test case 1: Valid features round-trip
+	rr := doAdminRequest(t, s, "PUT", path, `{"webhooks": true, "pdf_statements": true, "max_users": 5}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var plan models.Plan
+	json.Unmarshal(rr.Body.Bytes(), &plan)
+	if !plan.Features.Webhooks || !plan.Features.PDFStatements || plan.Features.BulkImport || plan.Features.MaxUsers != 5 {
+		t.Errorf("Unexpected features: %+v", plan.Features)
+	}
+
+	// Test case 2: Unknown keys are rejected
+	rr = doAdminRequest(t, s, "PUT", path, `{"webhook": true}`)
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(body.Error.Message, "webhook") || body.Error.Fields["webhook"] == "" {
+		t.Errorf("Expected 422 naming the unknown key, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Wrong types and negative limits
+	rr = doAdminRequest(t, s, "PUT", path, `{"webhooks": "yes"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a non-boolean flag, got %d", rr.Code)
+	}
+	rr = doAdminRequest(t, s, "PUT", path, `{"max_active_loans": -1}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a negative limit, got %d", rr.Code)
+	}
+
+	// Test case 4: Unknown plan
+	rr = doAdminRequest(t, s, "PUT", "/api/admin/plans/9999/features", `{}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+func TestAdminManagePlans(t *testing.T) {
+	s := newTestServer(t)
+	seedPlan(t, s, "Basic", 100)
+
+	// Test case 1: Creating a plan
+	rr := doAdminRequest(t, s, "POST", "/api/admin/plans", `{"plan": "Growth", "price": 250, "features": {"max_users": 5}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created models.Plan
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created.PlanID == 0 || !created.IsActive || created.Features.MaxUsers != 5 {
+		t.Fatalf("Unexpected plan: %+v", created)
+	}
+
+	// Test case 2: Invalid plans are rejected
+	for _, body := range []string{`{"plan": "Growth", "price": -1}`, `{"plan": " ", "price": 10}`, `{"plan": "Growth"}`} {
+		if rr := doAdminRequest(t, s, "POST", "/api/admin/plans", body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", body, rr.Code)
+		}
+	}
+	if rr := doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d", created.PlanID), `{"price": -5}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a negative price, got %d", rr.Code)
+	}
+
+	// Test case 3: Deactivating hides the plan from the public list but not the admin list
+	var public []planResponse
+	json.Unmarshal(doRequest(t, s, "GET", "/api/plans", "", "").Body.Bytes(), &public)
+	if len(public) != 2 {
+		t.Fatalf("Expected both plans in the public list before deactivating, got %+v", public)
+	}
+	rr = doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d", created.PlanID), `{"is_active": false}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	public = nil
+	json.Unmarshal(doRequest(t, s, "GET", "/api/plans", "", "").Body.Bytes(), &public)
+	if len(public) != 1 || public[0].Plan.Plan != "Basic" {
+		t.Errorf("Expected only Basic in the public list, got %+v", public)
+	}
+	rr = doAdminRequest(t, s, "GET", "/api/admin/plans", "")
+	var all []models.Plan
+	json.Unmarshal(rr.Body.Bytes(), &all)
+	if len(all) != 2 || all[1].PlanID != created.PlanID || all[1].IsActive {
+		t.Errorf("Expected both plans with Growth inactive, got %+v", all)
+	}
+
+	// Test case 4: Unknown plan and missing admin key
+	if rr := doAdminRequest(t, s, "PUT", "/api/admin/plans/9999", `{"is_active": true}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/admin/plans", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
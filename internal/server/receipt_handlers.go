@@ -0,0 +1,141 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// validReceiptStatuses mirrors the Recipets.Status CHECK constraint
+var validReceiptStatuses = map[string]bool{
+	"paid":     true,
+	"pending":  true,
+	"failed":   true,
+	"refunded": true,
+}
+
+// createReceiptRequest is the body accepted when recording a receipt
+type createReceiptRequest struct {
+	Status               string  `json:"status"`
+	Amount               float64 `json:"amount"`
+	PaymentMethod        string  `json:"payment_method"`
+	TransactionReference string  `json:"transaction_reference"`
+	Notes                string  `json:"notes"`
+}
+
+// receiptResponse is a receipt with its lender's currency
+type receiptResponse struct {
+	*models.Receipt
+	Currency string `json:"currency"`
+}
+
+// receiptListResponse is one page of a loan's receipts
+type receiptListResponse struct {
+	Currency string           `json:"currency"` // Labels every amount in the page
+	Receipts []models.Receipt `json:"receipts"`
+	Total    int              `json:"total"`
+	Limit    int              `json:"limit"`
+	Offset   int              `json:"offset"`
+}
+
+// listReceipts returns one page of the receipts on one of the caller's loans, newest first.
+// Supports status, limit and offset query parameters.
+func (s *Server) listReceipts(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	filter := repository.ReceiptFilter{Status: r.URL.Query().Get("status"), Limit: limit, Offset: offset}
+	if filter.Status != "" && !validReceiptStatuses[filter.Status] {
+		s.writeServiceError(w, r, httperr.Validation("status must be one of paid, pending, failed, refunded"))
+		return
+	}
+
+	receipts, total, err := s.receiptRepo.ListReceipts(int(claims.LenderID), loanID, filter)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, receiptListResponse{Currency: code, Receipts: receipts, Total: total, Limit: limit, Offset: offset})
+}
+
+// createReceipt records a payment against one of the caller's loans
+func (s *Server) createReceipt(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loanID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid loan id"))
+		return
+	}
+
+	var req createReceiptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	if !validReceiptStatuses[req.Status] {
+		s.writeServiceError(w, r, httperr.Validation("status must be one of paid, pending, failed, refunded"))
+		return
+	}
+	if req.Amount <= 0 {
+		s.writeServiceError(w, r, httperr.Validation("amount must be greater than zero"))
+		return
+	}
+
+	receipt := &models.Receipt{
+		LoanID:               loanID,
+		LenderID:             int(claims.LenderID),
+		Status:               req.Status,
+		Amount:               req.Amount,
+		PaymentMethod:        nullString(req.PaymentMethod),
+		TransactionReference: nullString(req.TransactionReference),
+		Notes:                nullString(req.Notes),
+	}
+
+	receipt.ReceiptID, err = s.receiptRepo.CreateReceipt(int(claims.LenderID), receipt)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.reportCache.Invalidate(int(claims.LenderID))
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     int(claims.LenderID),
+		Action:       models.AuditReceiptCreated,
+		ResourceType: "receipt",
+		ResourceID:   receipt.ReceiptID,
+		Details:      map[string]any{"loan_id": loanID, "status": receipt.Status, "amount": receipt.Amount},
+	})
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, receiptResponse{Receipt: receipt, Currency: code})
+}
+
+// nullString converts an optional string field to a sql.NullString
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCreateReceipt_DuplicateReference(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderA, tokenA := registerTestLender(t, s, "receipta")
+	_, lenderB, tokenB := registerTestLender(t, s, "receiptb")
+	loanA := seedLoan(t, s, lenderA, "active", 1000, 10, 6)
+	loanB := seedLoan(t, s, lenderB, "active", 1000, 10, 6)
+
+	body := `{"status": "paid", "amount": 100, "transaction_reference": "REF-42"}`
+
+	// Test case 1: First use of a reference, labelled with the lender's currency
+	rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanA), tokenA, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"currency":"LSL"`) {
+		t.Errorf("Expected the currency in the receipt, got %s", rr.Body.String())
+	}
+
+	// Test case 2: Another lender may reuse it
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanB), tokenB, body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 for another lender, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: The same lender gets a clear conflict
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanA), tokenA, body)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var errBody errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &errBody)
+	if errBody.Error.Code != "duplicate_transaction_reference" {
+		t.Errorf("Expected code 'duplicate_transaction_reference', got '%s'", errBody.Error.Code)
+	}
+
+	// Test case 4: Cross-tenant loan is not found
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanB), tokenA, `{"status": "paid", "amount": 100}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's loan, got %d", rr.Code)
+	}
+}
+
+func TestCreateReceipt_Validation(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "receiptvalidation")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	path := fmt.Sprintf("/api/loans/%d/receipts", loanID)
+
+	for _, body := range []string{`{"status": "bogus", "amount": 100}`, `{"status": "paid", "amount": 0}`} {
+		rr := doRequest(t, s, "POST", path, token, body)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestListReceipts(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderA, tokenA := registerTestLender(t, s, "receiptlista")
+	_, lenderB, tokenB := registerTestLender(t, s, "receiptlistb")
+	loanA := seedLoan(t, s, lenderA, "active", 1000, 10, 6)
+	loanB := seedLoan(t, s, lenderB, "active", 1000, 10, 6)
+	for i, status := range []string{"paid", "failed", "paid", "paid"} {
+		s.DB.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Timestamp, Status, Amount) VALUES (?, ?, DATETIME('now', ?), ?, 100)",
+			loanA, lenderA, fmt.Sprintf("-%d days", 10-i), status)
+	}
+	path := fmt.Sprintf("/api/loans/%d/receipts", loanA)
+
+	// Test case 1: Filtering by paid, newest first
+	rr := doRequest(t, s, "GET", path+"?status=paid", tokenA, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page receiptListResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 3 || len(page.Receipts) != 3 || page.Currency != "LSL" || page.Limit != 50 {
+		t.Fatalf("Expected 3 paid receipts, got %+v", page)
+	}
+	for _, receipt := range page.Receipts {
+		if receipt.Status != "paid" || receipt.LoanID != loanA {
+			t.Errorf("Expected only the loan's paid receipts, got %+v", receipt)
+		}
+	}
+	if !page.Receipts[0].Timestamp.After(page.Receipts[2].Timestamp.Time) {
+		t.Errorf("Expected the newest receipt first, got %+v", page.Receipts)
+	}
+
+	// Test case 2: Paging keeps the total
+	rr = doRequest(t, s, "GET", path+"?limit=3&offset=3", tokenA, "")
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 4 || len(page.Receipts) != 1 || page.Offset != 3 {
+		t.Errorf("Expected the last of 4 receipts, got %+v", page)
+	}
+
+	// Test case 3: Invalid status and paging are rejected
+	for _, query := range []string{"status=bounced", "limit=abc", "offset=x"} {
+		if rr := doRequest(t, s, "GET", path+"?"+query, tokenA, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+
+	// Test case 4: Another lender's loan is not found, in either direction
+	if rr := doRequest(t, s, "GET", path, tokenB, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's loan, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", fmt.Sprintf("/api/loans/%d/receipts", loanB), tokenA, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another lender's loan, got %d", rr.Code)
+	}
+}
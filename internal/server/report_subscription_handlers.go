@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/export"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+)
+
+// maxReportRecipients caps the addresses one lender's month-end reports are emailed to
+const maxReportRecipients = 10
+
+// subscribableReports are the reports a lender can have emailed, and reportFormats the formats
+var (
+	subscribableReports = []string{models.ReportPortfolio, models.ReportIncome}
+	reportFormats       = map[string]string{"csv": mediaTypeCSV, "xlsx": mediaTypeXLSX}
+)
+
+// portfolioStatusHeader names the columns of the loans-by-status sheet of an exported portfolio report
+var portfolioStatusHeader = []string{"status", "loans", "principal", "currency"}
+
+// reportSubscriptionRequest is the body accepted when setting the lender's report subscription.
+// enabled defaults to true.
+type reportSubscriptionRequest struct {
+	Reports    []string `json:"reports"`
+	Format     string   `json:"format"`
+	Recipients []string `json:"recipients"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// getReportSubscription returns which month-end reports the caller has emailed, and to whom
+func (s *Server) getReportSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	sub, err := s.reportSubscriptionRepo.Get(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// setReportSubscription creates or replaces the caller's report subscription: the reports emailed
+// on the first of every month for the month just ended, their format and the recipients
+func (s *Server) setReportSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var req reportSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	sub := models.ReportSubscription{
+		LenderID: int(claims.LenderID),
+		Format:   strings.ToLower(strings.TrimSpace(req.Format)),
+		Enabled:  req.Enabled == nil || *req.Enabled,
+	}
+	for _, report := range req.Reports {
+		if !slices.Contains(subscribableReports, report) {
+			s.writeServiceError(w, r, httperr.Validation("reports must be among "+strings.Join(subscribableReports, ", ")))
+			return
+		}
+		if !slices.Contains(sub.Reports, report) {
+			sub.Reports = append(sub.Reports, report)
+		}
+	}
+	for _, recipient := range req.Recipients {
+		address, err := mail.ParseAddress(strings.TrimSpace(recipient))
+		if err != nil || address.Name != "" || strings.Contains(address.Address, ",") {
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("recipient %q is not an email address", recipient)))
+			return
+		}
+		if !slices.Contains(sub.Recipients, address.Address) {
+			sub.Recipients = append(sub.Recipients, address.Address)
+		}
+	}
+	switch {
+	case len(sub.Reports) == 0:
+		s.writeServiceError(w, r, httperr.Validation("reports must name at least one report"))
+		return
+	case reportFormats[sub.Format] == "":
+		s.writeServiceError(w, r, httperr.Validation("format must be csv or xlsx"))
+		return
+	case len(sub.Recipients) == 0 || len(sub.Recipients) > maxReportRecipients:
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("recipients must list between 1 and %d email addresses", maxReportRecipients)))
+		return
+	}
+
+	if err := s.reportSubscriptionRepo.Upsert(sub); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	saved, err := s.reportSubscriptionRepo.Get(sub.LenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: sub.LenderID, Action: models.AuditReportSubscriptionSet, ResourceType: "lender", ResourceID: sub.LenderID, Details: saved})
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// deleteReportSubscription stops the caller's month-end report emails. Emails already queued are still sent.
+func (s *Server) deleteReportSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	if err := s.reportSubscriptionRepo.Delete(int(claims.LenderID)); err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{LenderID: int(claims.LenderID), Action: models.AuditReportSubscriptionDeleted, ResourceType: "lender", ResourceID: int(claims.LenderID)})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenderReport renders one of the lender's month-end reports for a YYYY-MM month of its time zone
+// as a csv or xlsx file, with the same layout as the report endpoints' exports. The portfolio is
+// reported as of the month's last day, and income over the month.
+func (s *Server) RenderReport(lenderID int, report, format, month string) (mailer.Attachment, error) {
+	mediaType := reportFormats[format]
+	if mediaType == "" {
+		return mailer.Attachment{}, fmt.Errorf("unknown report format %q", format)
+	}
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		return mailer.Attachment{}, err
+	}
+	start, err := time.ParseInLocation("2006-01", month, loc)
+	if err != nil {
+		return mailer.Attachment{}, err
+	}
+	code, err := s.lenderRepo.GetCurrency(lenderID)
+	if err != nil {
+		return mailer.Attachment{}, err
+	}
+
+	var tables []export.Table
+	switch report {
+	case models.ReportPortfolio:
+		summary, err := s.reports.Portfolio(lenderID, start.AddDate(0, 1, -1))
+		if err != nil {
+			return mailer.Attachment{}, err
+		}
+		tables = portfolioExportTables(summary, code)
+	case models.ReportIncome:
+		income, err := s.reports.Income(lenderID, start, start)
+		if err != nil {
+			return mailer.Attachment{}, err
+		}
+		tables = incomeExportTables(income, code)
+	default:
+		return mailer.Attachment{}, fmt.Errorf("unknown report %q", report)
+	}
+
+	writer := exportWriters[mediaType]
+	var buf bytes.Buffer
+	if err := writer.Write(&buf, tables...); err != nil {
+		return mailer.Attachment{}, err
+	}
+	return mailer.Attachment{
+		Filename:    report + "-" + month + "." + writer.Extension(),
+		ContentType: writer.ContentType(),
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// portfolioExportTables lays out the portfolio report for CSV and XLSX: a summary, which is all a
+// CSV carries, and the loans by status
+func portfolioExportTables(summary *reports.Portfolio, code string) []export.Table {
+	figures := [][]export.Cell{
+		{export.Text("as_of"), export.Text(summary.AsOf)},
+		{export.Text("currency"), export.Text(code)},
+		{export.Text("outstanding_principal"), export.Decimal(summary.Outstanding.Principal)},
+		{export.Text("outstanding_interest"), export.Decimal(summary.Outstanding.Interest)},
+		{export.Text("outstanding_total"), export.Decimal(summary.Outstanding.Total)},
+		{export.Text("collected_principal"), export.Decimal(summary.Collected.Principal)},
+		{export.Text("collected_interest"), export.Decimal(summary.Collected.Interest)},
+		{export.Text("collected_penalties"), export.Decimal(summary.Collected.Penalties)},
+		{export.Text("collected_total"), export.Decimal(summary.Collected.Total)},
+		{export.Text("average_loan_size"), export.Decimal(summary.AverageLoanSize)},
+		{export.Text("portfolio_at_risk"), export.Number(summary.PortfolioAtRisk)},
+	}
+	statuses := make([][]export.Cell, len(summary.Loans))
+	for i, total := range summary.Loans {
+		statuses[i] = []export.Cell{export.Text(total.Status), export.Int(total.Count), export.Decimal(total.Principal), export.Text(code)}
+	}
+	return []export.Table{
+		{Name: "Summary", Header: summaryExportHeader, Rows: export.Rows(figures)},
+		{Name: "Loans", Header: portfolioStatusHeader, Rows: export.Rows(statuses)},
+	}
+}
+
+// notificationListResponse is one page of the admin notification list
+type notificationListResponse struct {
+	Notifications []models.Notification `json:"notifications"`
+	Total         int                   `json:"total"`
+	Limit         int                   `json:"limit"`
+	Offset        int                   `json:"offset"`
+}
+
+// validNotificationStatuses are the status filters the admin notification list accepts
+var validNotificationStatuses = map[string]bool{
+	models.NotificationPending: true,
+	models.NotificationSent:    true,
+	models.NotificationFailed:  true,
+}
+
+// listNotifications returns the emails background jobs have queued, newest first, optionally
+// filtered by status, kind and lender. Failed notifications carry the last error.
+func (s *Server) listNotifications(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := s.parsePagination(r)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.NotificationFilter{Kind: query.Get("kind"), Limit: limit, Offset: offset}
+	if status := query.Get("status"); status != "" {
+		if !validNotificationStatuses[status] {
+			s.writeServiceError(w, r, httperr.Validation("status must be one of pending, sent, failed"))
+			return
+		}
+		filter.Status = status
+	}
+	if v := query.Get("lender_id"); v != "" {
+		filter.LenderID, err = strconv.Atoi(v)
+		if err != nil || filter.LenderID < 1 {
+			s.writeServiceError(w, r, httperr.Validation("lender_id must be a positive integer"))
+			return
+		}
+	}
+
+	notifications, total, err := s.notificationRepo.List(filter)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	writeJSON(w, http.StatusOK, notificationListResponse{
+		Notifications: notifications,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	})
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestReportSubscription(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "reportsub")
+
+	// Test case 1: No subscription until one is set
+	if rr := doRequest(t, s, "GET", "/api/lenders/me/report-subscription", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 2: Unknown reports and formats, and bad or missing recipients, are rejected
+	for _, body := range []string{
+		`{"reports": ["balance_sheet"], "format": "csv", "recipients": ["owner@example.com"]}`,
+		`{"reports": [], "format": "csv", "recipients": ["owner@example.com"]}`,
+		`{"reports": ["income"], "format": "pdf", "recipients": ["owner@example.com"]}`,
+		`{"reports": ["income"], "format": "csv", "recipients": ["not an address"]}`,
+		`{"reports": ["income"], "format": "csv", "recipients": ["a@example.com, b@example.com"]}`,
+		`{"reports": ["income"], "format": "csv", "recipients": []}`,
+	} {
+		if rr := doRequest(t, s, "PUT", "/api/lenders/me/report-subscription", token, body); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 3: A subscription is saved with duplicates dropped, enabled by default
+	rr := doRequest(t, s, "PUT", "/api/lenders/me/report-subscription", token,
+		`{"reports": ["portfolio", "income", "income"], "format": "XLSX", "recipients": ["owner@example.com", " owner@example.com"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var sub models.ReportSubscription
+	json.Unmarshal(rr.Body.Bytes(), &sub)
+	if len(sub.Reports) != 2 || sub.Format != "xlsx" || len(sub.Recipients) != 1 || !sub.Enabled {
+		t.Errorf("Unexpected subscription: %+v", sub)
+	}
+	rr = doRequest(t, s, "GET", "/api/lenders/me/report-subscription", token, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"recipients":["owner@example.com"]`) {
+		t.Errorf("Expected the saved subscription, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: Deleting stops the emails
+	if rr := doRequest(t, s, "DELETE", "/api/lenders/me/report-subscription", token, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "DELETE", "/api/lenders/me/report-subscription", token, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting again, got %d", rr.Code)
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "rendered")
+	loanID := seedLoan(t, s, lenderID, "active", 2000, 10, 12)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 500}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+	month := time.Now().UTC().Format("2006-01")
+
+	// Test case 1: The income report covers the month, as the income export lays it out
+	income, err := s.RenderReport(lenderID, models.ReportIncome, "csv", month)
+	if err != nil {
+		t.Fatalf("RenderReport failed: %v", err)
+	}
+	if income.Filename != "income-"+month+".csv" || !strings.HasPrefix(income.ContentType, "text/csv") {
+		t.Errorf("Unexpected attachment %s (%s)", income.Filename, income.ContentType)
+	}
+	if csv := string(income.Data); !strings.Contains(csv, month+",") || !strings.Contains(csv, "500.00,LSL") {
+		t.Errorf("Expected the month's 500 collected, got:\n%s", csv)
+	}
+
+	// Test case 2: The portfolio is reported as of the month's last day, with a summary sheet first
+	portfolio, err := s.RenderReport(lenderID, models.ReportPortfolio, "xlsx", month)
+	if err != nil {
+		t.Fatalf("RenderReport failed: %v", err)
+	}
+	summary := readXLSXSheet(t, portfolio.Data, 1)
+	start, _ := time.Parse("2006-01", month)
+	if summary["B2"] != start.AddDate(0, 1, -1).Format(time.DateOnly) || summary["A4"] != "outstanding_principal" || summary["B4"] != "1500" {
+		t.Errorf("Unexpected portfolio summary: %v", summary)
+	}
+	if statuses := readXLSXSheet(t, portfolio.Data, 2); statuses["A1"] != "status" {
+		t.Errorf("Expected a loans-by-status sheet, got %v", statuses)
+	}
+
+	// Test case 3: Unknown reports and formats are errors
+	if _, err := s.RenderReport(lenderID, "balance_sheet", "csv", month); err == nil {
+		t.Error("Expected an error for an unknown report")
+	}
+	if _, err := s.RenderReport(lenderID, models.ReportIncome, "pdf", month); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestListNotifications(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "notifiedlender")
+	now := time.Now()
+	for _, recipient := range []string{"a@example.com", "b@example.com"} {
+		s.notificationRepo.Enqueue(models.Notification{LenderID: lenderID, Kind: models.NotificationMonthlyReports, Period: "2026-09", Recipient: recipient, Payload: "{}"}, now)
+	}
+	due, _ := s.notificationRepo.ListDue(models.NotificationMonthlyReports, now, 10)
+	s.notificationRepo.ScheduleRetry(due[0].NotificationID, sql.NullTime{}, "relay denied")
+
+	// Test case 1: Failed notifications surface with their last error
+	rr := doAdminRequest(t, s, "GET", "/api/admin/notifications?status=failed", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page notificationListResponse
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if page.Total != 1 || len(page.Notifications) != 1 || page.Notifications[0].Recipient != "a@example.com" || page.Notifications[0].LastError.String != "relay denied" {
+		t.Errorf("Expected the failed notification, got %+v", page)
+	}
+
+	// Test case 2: Filters are validated, and the list needs the admin key
+	if rr := doAdminRequest(t, s, "GET", "/api/admin/notifications?status=lost", ""); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/admin/notifications", "", ""); rr.Code == http.StatusOK {
+		t.Error("Expected the list to require the admin key")
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"wisetech-lms-api/internal/export"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/requestid"
+)
+
+// Media types list endpoints can be negotiated to
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeCSV  = "text/csv"
+	mediaTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mediaTypePDF  = "application/pdf"
+)
+
+// formatMediaTypes maps the values of the format query parameter to the media types they ask for
+var formatMediaTypes = map[string]string{
+	"json": mediaTypeJSON,
+	"csv":  mediaTypeCSV,
+	"xlsx": mediaTypeXLSX,
+	"pdf":  mediaTypePDF,
+}
+
+// exportWriters renders each exportable media type other than JSON
+var exportWriters = map[string]export.Writer{
+	mediaTypeCSV:  export.CSVWriter{},
+	mediaTypeXLSX: export.XLSXWriter{},
+}
+
+// errorBody describes a failed request. Fields names the offending input fields of a validation
+// error, and RequestID lets support find the request in the logs.
+type errorBody struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// errorResponse is the JSON body returned for every failed request:
+// {"error": {"code": "...", "message": "...", "fields": {...}, "request_id": "..."}}. Responses
+// with more detail, such as the plan limit reached, embed it and add their own fields.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+// newErrorResponse returns the error body for code and message, with the request's ID read back
+// from the response header the requestID middleware set
+func newErrorResponse(w http.ResponseWriter, code, message string) errorResponse {
+	return errorResponse{Error: errorBody{Code: code, Message: message, RequestID: w.Header().Get(requestid.Header)}}
+}
+
+// writeJSON encodes v as JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error envelope with a machine-readable code
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, newErrorResponse(w, code, message))
+}
+
+// writeServiceError writes the status, code, message and fields httperr resolves err to. Neither
+// the text of unexpected errors nor that of database driver errors is sent to the client; unexpected
+// errors are logged with the request's context instead, so the record carries its request_id.
+func (s *Server) writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	resolved := httperr.Resolve(err)
+	if resolved.Unexpected {
+		s.logger.ErrorContext(r.Context(), "Unexpected error", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+	resp := newErrorResponse(w, resolved.Code, resolved.Message)
+	resp.Error.Fields = resolved.Fields
+	writeJSON(w, resolved.Status, resp)
+}
+
+// negotiate picks the offer the request's Accept header ranks highest, honouring q-values and
+// wildcards; ties go to the earlier offer, and a request without an Accept header gets the first.
+// ok is false when the header accepts none of the offers.
+func negotiate(r *http.Request, offers ...string) (mediaType string, ok bool) {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return offers[0], true
+	}
+	best := 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(header, offer); q > best {
+			mediaType, best = offer, q
+		}
+	}
+	return mediaType, best > 0
+}
+
+// exportFormat picks how an exportable endpoint responds: a format query parameter of json, csv or
+// xlsx wins, and otherwise the Accept header is negotiated. ok is false for an unknown format or
+// when the header accepts none of them.
+func exportFormat(r *http.Request) (mediaType string, ok bool) {
+	return responseFormat(r, mediaTypeJSON, mediaTypeCSV, mediaTypeXLSX)
+}
+
+// responseFormat picks one of the offered media types: the one a format query parameter names
+// wins, and otherwise the Accept header is negotiated. ok is false when the format parameter names
+// one not offered or the header accepts none of them.
+func responseFormat(r *http.Request, offers ...string) (mediaType string, ok bool) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		return negotiate(r, offers...)
+	}
+	mediaType = formatMediaTypes[name]
+	return mediaType, mediaType != "" && slices.Contains(offers, mediaType)
+}
+
+// writeExport streams tables as an attachment in the given export media type, named name plus the
+// format's extension. CSV carries only the first table; the others become extra workbook sheets.
+func (s *Server) writeExport(w http.ResponseWriter, r *http.Request, mediaType, name string, tables ...export.Table) {
+	writer := exportWriters[mediaType]
+	w.Header().Set("Content-Type", writer.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+writer.Extension()))
+	w.WriteHeader(http.StatusOK)
+
+	// The status is sent, so a failure part way can only be logged; the client gets a truncated file
+	if err := writer.Write(w, tables...); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to write export", "name", name, "error", err)
+	}
+}
+
+// acceptQuality returns the q-value of the most specific range in the Accept header matching
+// mediaType, or 0 when none does
+func acceptQuality(header, mediaType string) float64 {
+	family, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(header, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		var s int
+		switch rng {
+		case mediaType:
+			s = 2
+		case family + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, quality = s, 1
+		if v, ok := params["q"]; ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil && q >= 0 && q <= 1 {
+				quality = q
+			}
+		}
+	}
+	return quality
+}
@@ -1,11 +1,12 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"wisetech-lms-api/internal/models"
 )
 
 // NewRouter creates a new chi router and sets up middleware and routes
@@ -13,21 +14,181 @@ func (s *Server) NewRouter() *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(requestID)
+	r.Use(s.logRequests)
+	r.Use(s.recoverPanics)
+	r.Use(s.requireAllowedHost)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed for this endpoint")
+	})
 
 	// Health check endpoint
 	r.Get("/health", s.healthCheck)
+	r.Get("/readyz", s.readinessCheck)
+
+	// Public API
+	r.Get("/api/plans", s.listPlans)
+	r.Post("/api/auth/register", s.register)
+	r.Post("/api/auth/login", s.login)
+	r.Post("/api/auth/forgot-password", s.forgotPassword)
+	r.Post("/api/auth/reset-password", s.resetPassword)
+	r.Get("/api/borrowers/verify", s.verifyBorrowerEmail)
+
+	// Admin API
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(s.requireAdmin)
+
+		r.Get("/lenders", s.listLenders)
+		r.Get("/lenders/{id}", s.getLender)
+		r.Get("/lenders/{id}/history", s.getLenderHistory)
+		r.Post("/lenders/{id}/suspend", s.suspendLender)
+		r.Post("/lenders/{id}/unsuspend", s.unsuspendLender)
+		r.Post("/lenders/{id}/loan-book-snapshots", s.snapshotLoanBook)
+
+		r.Get("/plans", s.listAllPlans)
+		r.Post("/plans", s.createPlan)
+		r.Put("/plans/{id}", s.updatePlan)
+		r.Get("/plans/{id}/prices", s.listPlanPrices)
+		r.Put("/plans/{id}/prices/{currency}", s.setPlanPrice)
+		r.Delete("/plans/{id}/prices/{currency}", s.deletePlanPrice)
+		r.Put("/plans/{id}/features", s.setPlanFeatures)
+
+		r.Get("/subscription-payments", s.listSubscriptionPayments)
+		r.Post("/subscription-payments", s.recordSubscriptionPayment)
+
+		r.Post("/borrowers/{id}/anonymize", s.anonymizeBorrower)
+
+		r.Get("/notifications", s.listNotifications)
+
+		r.Get("/analytics", s.getPlatformAnalytics)
+		r.Get("/analytics/timeseries", s.getPlatformTimeSeries)
+
+		r.Get("/maintenance/orphans", s.getOrphanReport)
+		r.Post("/maintenance/orphans", s.sweepOrphans)
+	})
+
+	// Token introspection for gateways and other services, authenticated with the admin API key
+	r.With(s.requireAdmin).Post("/api/auth/introspect", s.introspectToken)
+
+	// Authenticated API
+	r.Route("/api", func(r chi.Router) {
+		r.Use(s.authenticate)
+
+		r.Get("/auth/me", s.me)
+		r.Patch("/lenders/me", s.updateLenderProfile)
+		r.Get("/lenders/me/logo", s.getLenderLogo)
+		r.Get("/lenders/me/branding", s.getLenderBranding)
+		r.Get("/lenders/me/report-subscription", s.getReportSubscription)
+		r.Get("/lenders/me/notification-preferences", s.getNotificationPreferences)
+		r.Get("/subscription", s.getSubscription)
+		r.Get("/subscriptions/current", s.getCurrentSubscription)
+		r.Get("/subscriptions/features", s.getSubscriptionFeatures)
+		r.With(s.transactional).Post("/subscription/cancel", s.cancelSubscription)
+		r.Get("/loans", s.listLoans)
+		r.Get("/loans/due-soon", s.listLoansDueSoon)
+		r.Get("/loans/{id}/files", s.listLoanFiles)
+		r.Get("/loans/{id}/receipts", s.listReceipts)
+		r.Get("/loans/{id}/reprice-preview", s.previewLoanReprice)
+		r.Get("/loans/{id}/disclosure", s.getLoanDisclosure)
+		r.With(s.requireFeature(models.FeaturePDFStatements)).Get("/loans/{id}/statement", s.getLoanStatement)
+		r.With(s.requireFeature(models.FeaturePDFStatements)).Get("/loans/{id}/receipts.pdf", s.getLoanReceiptsPDF)
+		r.With(s.requireFeature(models.FeaturePDFStatements)).Get("/receipts/{id}/pdf", s.getReceiptPDF)
+		r.Get("/borrowers/{id}/files", s.listBorrowerFiles)
+		r.Get("/borrowers/{id}/risk", s.getBorrowerRisk)
+		r.Get("/stats/exposure", s.getExposure)
+		r.Get("/stats/collections", s.getCollections)
+		r.Get("/reports/portfolio", s.getPortfolioReport)
+		r.Get("/reports/income", s.getIncomeReport)
+		r.Get("/reports/vintages", s.getVintages)
+		r.Get("/reports/borrower-retention", s.getBorrowerRetention)
+		r.Get("/reports/collections-vs-expected", s.getCollectionsVsExpected)
+		r.Get("/reports/concentration", s.getConcentration)
+		r.Get("/reports/cashflow-projection", s.getCashflowProjection)
+		r.Get("/reports/payment-methods", s.getPaymentMethodReport)
+		r.Post("/reports/query", s.queryReport)
+		r.Get("/dashboard/timeseries", s.getTimeSeries)
+		r.Get("/files", s.listFiles)
+		r.Get("/files/usage", s.getFileUsage)
+		r.Get("/files/export.zip", s.exportFiles)
+		r.Get("/files/{id}/status", s.getFileStatus)
+		r.Get("/files/{id}/download", s.downloadFile)
+		r.Delete("/files/{id}", s.deleteFile)
+		r.Delete("/files/{id}/attachments/{type}/{targetID}", s.detachFile)
+		r.Get("/custom-values", s.listCustomValues)
+		r.Get("/custom-values/{name}", s.getCustomValue)
+		r.Get("/custom-fields", s.listCustomFields)
+		r.Get("/audit-log", s.getAuditLog)
+
+		// Endpoints below require an active subscription
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireActiveSubscription)
+
+			r.Put("/lenders/me/logo", s.uploadLenderLogo)
+			r.Put("/lenders/me/branding", s.updateLenderBranding)
+			r.Put("/lenders/me/report-subscription", s.setReportSubscription)
+			r.Delete("/lenders/me/report-subscription", s.deleteReportSubscription)
+			r.Put("/lenders/me/notification-preferences", s.setNotificationPreferences)
+			r.Post("/files", s.uploadFile)
+			r.Post("/files/{id}/attachments", s.attachFile)
+			r.Put("/custom-values/{name}", s.setCustomValue)
+			r.Delete("/custom-values/{name}", s.deleteCustomValue)
+			r.Post("/custom-fields", s.createCustomField)
+			r.Put("/custom-fields/{id}", s.updateCustomField)
+			r.Delete("/custom-fields/{id}", s.deleteCustomField)
+			r.With(s.requireFeature(models.FeatureWebhooks)).Put("/lenders/me/webhook", s.setLenderWebhook)
+			r.Post("/borrowers", s.createBorrower)
+			r.Put("/borrowers/{id}", s.updateBorrower)
+			r.Post("/borrowers/{id}/send-verification", s.sendBorrowerVerification)
+			r.Post("/loans", s.createLoan)
+			r.Post("/loans/bulk-reprice", s.bulkRepriceLoans)
+			r.Post("/loans/mark-defaulted", s.markLoansDefaulted)
+			r.Post("/loans/{id}/paid", s.markLoanPaid)
+			r.Post("/loans/{id}/recompute", s.recomputeLoan)
+			r.Post("/loans/{id}/reassign", s.reassignLoan)
+			r.Post("/loans/{id}/receipts", s.createReceipt)
+		})
+	})
 
 	return r
 }
 
 // healthCheck is a simple handler to check the service status
 func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status": "ok",
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readinessResponse is the /readyz body; the sub-checks are omitted until migrations have completed
+type readinessResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database,omitempty"` // ok or down
+	Storage  string `json:"storage,omitempty"`  // ok or down
+}
+
+// readinessCheck reports whether the server should receive traffic: 200 once migrations have
+// completed, the database answers a ping and the default file store accepts a write and delete
+// probe, 503 otherwise
+func (s *Server) readinessCheck(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readinessResponse{Status: "starting"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := readinessResponse{Status: "ready", Database: "ok", Storage: "ok"}
+	if err := s.files.Probe(ctx); err != nil {
+		s.logger.WarnContext(r.Context(), "Readiness storage probe failed", "error", err)
+		resp.Status, resp.Storage = "storage_unavailable", "down"
+	}
+	if err := s.DB.PingContext(ctx); err != nil {
+		resp.Status, resp.Database = "database_unavailable", "down"
+	}
+	if resp.Status != "ready" {
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, resp)
 }
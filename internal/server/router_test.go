@@ -1,14 +1,28 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/config"
+	"wisetech-lms-api/internal/database"
 )
 
 func TestHealthEndpoint(t *testing.T) {
 	// Create a router
-	s := &Server{}
+	s := &Server{logger: slog.New(slog.DiscardHandler)}
 	router := s.NewRouter()
 
 	// Create a new HTTP request
@@ -36,3 +50,316 @@ func TestHealthEndpoint(t *testing.T) {
 			rr.Body.String(), expected)
 	}
 }
+
+func TestReadinessEndpoint(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := New(db, &config.Config{JWTSecret: testJWTSecret, UploadDir: t.TempDir()}, slog.New(slog.DiscardHandler))
+	router := s.NewRouter()
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+		return rr.Code
+	}
+
+	// Test case 1: Not ready before migrations, while /health already answers
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before migrations, got %d", code)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected /health to answer 200, got %d", rr.Code)
+	}
+
+	// Test case 2: Ready once migrations have completed
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	s.SetReady()
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected status 200 after migrations, got %d", code)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if body := rr.Body.String(); body != `{"status":"ready","database":"ok","storage":"ok"}`+"\n" {
+		t.Errorf("Unexpected readiness body: %s", body)
+	}
+
+	// Test case 3: Not ready when the database is gone
+	db.Close()
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a database, got %d", code)
+	}
+}
+
+func TestReadinessEndpoint_StorageDown(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	// The upload directory is a regular file, so nothing can be written under it
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	if err := os.WriteFile(uploadDir, []byte("not a directory"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(db, &config.Config{JWTSecret: testJWTSecret, UploadDir: uploadDir}, slog.New(slog.DiscardHandler))
+	s.SetReady()
+
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rr.Code)
+	}
+	if body := rr.Body.String(); body != `{"status":"storage_unavailable","database":"ok","storage":"down"}`+"\n" {
+		t.Errorf("Unexpected readiness body: %s", body)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	s := &Server{Cfg: &config.Config{AllowedHosts: []string{"api.example.com", "localhost:8080"}}, logger: slog.New(slog.DiscardHandler)}
+	router := s.NewRouter()
+	get := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Allowed hosts are served, on any port unless the entry names one, ignoring case
+	for _, host := range []string{"api.example.com", "API.Example.com:443", "localhost:8080"} {
+		if rr := get(host); rr.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %q, got %d", host, rr.Code)
+		}
+	}
+
+	// Test case 2: Other hosts, other ports of a host:port entry and a missing host are misdirected
+	for _, host := range []string{"evil.example.com", "localhost:9090", ""} {
+		if rr := get(host); rr.Code != http.StatusMisdirectedRequest || !strings.Contains(rr.Body.String(), "misdirected_request") {
+			t.Errorf("Expected status 421 for %q, got %d: %s", host, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 3: An empty allowlist serves every host
+	s.Cfg.AllowedHosts = nil
+	if rr := get("evil.example.com"); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 without an allowlist, got %d", rr.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	s := &Server{Cfg: &config.Config{AllowedHosts: []string{"api.example.com"}}, logger: slog.New(slog.DiscardHandler)}
+	router := s.NewRouter()
+	get := func(host, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Host = host
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Every response carries a generated ID
+	first, second := get("api.example.com", ""), get("api.example.com", "")
+	if id := first.Header().Get("X-Request-ID"); id == "" || id == second.Header().Get("X-Request-ID") {
+		t.Errorf("Expected distinct generated IDs, got %q and %q", id, second.Header().Get("X-Request-ID"))
+	}
+
+	// Test case 2: The load balancer's ID is echoed back, and an invalid one replaced
+	if rr := get("api.example.com", "lb-7f3a"); rr.Header().Get("X-Request-ID") != "lb-7f3a" {
+		t.Errorf("Expected the incoming ID echoed, got %q", rr.Header().Get("X-Request-ID"))
+	}
+	if rr := get("api.example.com", "forged id"); rr.Header().Get("X-Request-ID") == "forged id" {
+		t.Error("Expected an invalid incoming ID to be replaced")
+	}
+
+	// Test case 3: Error bodies carry the ID of their request
+	rr := get("evil.example.com", "lb-8c1d")
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusMisdirectedRequest || body.Error.RequestID != "lb-8c1d" || body.Error.Code != "misdirected_request" {
+		t.Errorf("Expected the request ID in the error body, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	s := newTestServer(t)
+	router := s.NewRouter()
+	decode := func(rr *httptest.ResponseRecorder) errorBody {
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || len(body) != 1 {
+			t.Fatalf("Expected only the error envelope, got %s", rr.Body.String())
+		}
+		var envelope errorBody
+		json.Unmarshal(body["error"], &envelope)
+		if envelope.Code == "" || envelope.Message == "" || envelope.RequestID != rr.Header().Get("X-Request-ID") {
+			t.Errorf("Expected a code, message and the request ID, got %s", rr.Body.String())
+		}
+		return envelope
+	}
+
+	// Test case 1: Unknown endpoints and methods answer with the envelope
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/nowhere", http.StatusNotFound, "not_found"},
+		{"DELETE", "/health", http.StatusMethodNotAllowed, "method_not_allowed"},
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if body := decode(rr); rr.Code != tt.status || body.Code != tt.code {
+			t.Errorf("Expected %d %s for %s %s, got %d %s", tt.status, tt.code, tt.method, tt.path, rr.Code, body.Code)
+		}
+	}
+
+	// Test case 2: Service errors carry their code and message, never a driver's text
+	_, _, token := registerTestLender(t, s, "enveloped")
+	if rr := doRequest(t, s, "GET", "/api/loans/999/files", token, ""); decode(rr).Code != "link_target_not_found" {
+		t.Errorf("Expected link_target_not_found, got %d %s", rr.Code, rr.Body.String())
+	}
+	s.DB.Exec("DROP TABLE Loans")
+	rr := doRequest(t, s, "GET", "/api/loans", token, "")
+	if body := decode(rr); rr.Code != http.StatusInternalServerError || body.Message != "internal server error" {
+		t.Errorf("Expected a bare 500, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: Panics answer 500 with the envelope
+	panicking := requestID(s.recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	rr = httptest.NewRecorder()
+	panicking.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if body := decode(rr); rr.Code != http.StatusInternalServerError || body.Code != "internal_error" {
+		t.Errorf("Expected 500 internal_error for a panic, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "logger")
+	var buf bytes.Buffer
+	s.logger = NewLogger(&config.Config{LogFormat: "json"}, &buf)
+	records := func() []map[string]any {
+		var out []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("Expected JSON log lines, got %q: %v", line, err)
+			}
+			out = append(out, record)
+		}
+		buf.Reset()
+		return out
+	}
+
+	// Test case 1: An authenticated request is logged with its lender and request ID
+	req := httptest.NewRequest("GET", "/api/loans", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "lb-1234")
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	logged := records()
+	if len(logged) != 1 {
+		t.Fatalf("Expected one request log line, got %v", logged)
+	}
+	for _, field := range []string{"time", "level", "msg", "method", "path", "status", "bytes", "duration_ms", "lender_id", "request_id"} {
+		if _, ok := logged[0][field]; !ok {
+			t.Errorf("Expected %s in the request log line, got %v", field, logged[0])
+		}
+	}
+	if logged[0]["method"] != "GET" || logged[0]["path"] != "/api/loans" || logged[0]["status"] != float64(http.StatusOK) ||
+		logged[0]["lender_id"] != float64(lenderID) || logged[0]["request_id"] != "lb-1234" || logged[0]["level"] != "INFO" {
+		t.Errorf("Unexpected request log line: %v", logged[0])
+	}
+
+	// Test case 2: A rejected request is logged without a lender
+	rr = doRequest(t, s, "GET", "/api/loans", "not-a-token", "")
+	logged = records()
+	if rr.Code != http.StatusUnauthorized || len(logged) != 1 || logged[0]["status"] != float64(http.StatusUnauthorized) {
+		t.Fatalf("Expected the 401 logged, got %d and %v", rr.Code, logged)
+	}
+	if _, ok := logged[0]["lender_id"]; ok || logged[0]["request_id"] != rr.Header().Get("X-Request-ID") {
+		t.Errorf("Expected the generated request ID and no lender, got %v", logged[0])
+	}
+
+	// Test case 3: Server errors are logged at error level
+	s.DB.Exec("DROP TABLE Loans")
+	rr = doRequest(t, s, "GET", "/api/loans", token, "")
+	logged = records()
+	if rr.Code != http.StatusInternalServerError || len(logged) != 2 || logged[1]["level"] != "ERROR" || logged[1]["status"] != float64(http.StatusInternalServerError) {
+		t.Fatalf("Expected the error and the 500 logged at error level, got %d and %v", rr.Code, logged)
+	}
+
+	// Test case 4: The unexpected error is logged with its text and the request's ID
+	errText, _ := logged[0]["error"].(string)
+	if logged[0]["level"] != "ERROR" || logged[0]["msg"] != "Unexpected error" || logged[0]["request_id"] != rr.Header().Get("X-Request-ID") ||
+		logged[0]["path"] != "/api/loans" || !strings.Contains(errText, "Loans") {
+		t.Errorf("Expected the unexpected error logged with the request ID, got %v", logged[0])
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.ShutdownTimeout = 5 * time.Second
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.serve(ctx, ln, slow) }()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	// Test case 1: A request in flight when shutdown starts still completes
+	<-started
+	cancel()
+	res := <-responses
+	if res.err != nil || res.status != http.StatusOK || res.body != "done" {
+		t.Fatalf("Expected the slow request to complete, got %d %q, %v", res.status, res.body, res.err)
+	}
+
+	// Test case 2: serve returns cleanly rather than http.ErrServerClosed, and stops accepting connections
+	if err := <-served; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+}
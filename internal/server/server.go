@@ -1,40 +1,281 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"wisetech-lms-api/internal/audit"
 	"wisetech-lms-api/internal/config"
+	"wisetech-lms-api/internal/features"
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/mailer"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+	"wisetech-lms-api/internal/requestid"
+	"wisetech-lms-api/internal/scanner"
+	"wisetech-lms-api/internal/storage"
+	"wisetech-lms-api/internal/subscription"
 )
 
 // Server holds the dependencies for the HTTP server
 type Server struct {
 	DB  *sql.DB
 	Cfg *config.Config
+
+	logger *slog.Logger
+
+	authRepo     repository.AuthRepository
+	borrowerRepo repository.BorrowerRepository
+	fileRepo     repository.FileRepository
+	ledgerRepo   repository.LedgerRepository
+	lenderRepo   repository.LenderRepository
+	loanRepo     repository.LoanRepository
+	receiptRepo  repository.ReceiptRepository
+	planRepo     repository.PlanRepository
+
+	subscriptionPaymentRepo repository.SubscriptionPaymentRepository
+	customValueRepo         repository.CustomValueRepository
+	customFieldRepo         repository.CustomFieldRepository
+	auditRepo               repository.AuditRepository
+	reportSubscriptionRepo  repository.ReportSubscriptionRepository
+	notificationRepo        repository.NotificationRepository
+	snapshotRepo            repository.LoanBookSnapshotRepository
+	notificationPrefRepo    repository.NotificationPreferenceRepository
+
+	subscriptions *subscription.Service
+	reports       *reports.Reporter
+	reportCache   *reports.Cache // nil when REPORT_CACHE_ENABLED is off
+	auditor       *audit.Auditor
+
+	mailer       mailer.Mailer
+	features     *features.Cache
+	expiry       *jobs.SubscriptionExpiry
+	files        *storage.Backends
+	orphans      *jobs.OrphanSweeper
+	scans        *jobs.FileScanner
+	reportMailer *jobs.ReportMailer
+	emails       *jobs.EmailDispatcher
+	snapshots    *jobs.LoanBookSnapshotter
+
+	ready atomic.Bool // Set once the schema is migrated; /readyz reports 503 until then
+}
+
+// New creates a new Server instance. Handlers and the jobs it creates log to logger, or to
+// slog.Default() when it is nil.
+func New(db *sql.DB, cfg *config.Config, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	planRepo := repository.NewCachedPlanRepository(repository.NewPlanRepository(db), repository.DefaultPlanCacheTTL)
+	ledgerRepo := repository.NewLedgerRepository(db)
+	lenderRepo := repository.NewLenderRepository(db)
+	fileRepo := repository.NewFileRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	files := NewFileStorage(cfg)
+	mail := NewMailer(cfg)
+	s := &Server{
+		DB:           db,
+		Cfg:          cfg,
+		logger:       logger,
+		authRepo:     repository.NewAuthRepository(db),
+		borrowerRepo: repository.NewBorrowerRepository(db),
+		fileRepo:     fileRepo,
+		ledgerRepo:   ledgerRepo,
+		lenderRepo:   lenderRepo,
+		loanRepo:     repository.NewLoanRepository(db),
+		receiptRepo:  repository.NewReceiptRepository(db),
+		planRepo:     planRepo,
+
+		subscriptionPaymentRepo: repository.NewSubscriptionPaymentRepository(db),
+		customValueRepo:         repository.NewCustomValueRepository(db),
+		customFieldRepo:         repository.NewCustomFieldRepository(db),
+		auditRepo:               auditRepo,
+		reportSubscriptionRepo:  repository.NewReportSubscriptionRepository(db),
+		notificationRepo:        repository.NewNotificationRepository(db),
+		snapshotRepo:            repository.NewLoanBookSnapshotRepository(db),
+		notificationPrefRepo:    repository.NewNotificationPreferenceRepository(db),
+
+		subscriptions: subscription.NewService(db, ledgerRepo, lenderRepo),
+		reports:       reports.NewReporter(db),
+		reportCache:   NewReportCache(cfg),
+		auditor:       audit.NewAuditor(auditRepo),
+
+		mailer:   mail,
+		features: features.NewCache(planRepo),
+		files:    files,
+		orphans:  jobs.NewOrphanSweeper(fileRepo, files),
+		scans:    jobs.NewFileScanner(fileRepo, files, NewScanner(cfg)),
+	}
+	s.subscriptions.Features = s.features
+	s.expiry = jobs.NewSubscriptionExpiry(s.subscriptions)
+	s.reportMailer = jobs.NewReportMailer(s.reportSubscriptionRepo, s.notificationRepo, s, mail)
+	s.emails = jobs.NewEmailDispatcher(s.notificationRepo, mail)
+	s.snapshots = jobs.NewLoanBookSnapshotter(lenderRepo, s.reports, s.snapshotRepo)
+	s.expiry.Logger = logger
+	s.orphans.Logger = logger
+	s.scans.Logger = logger
+	s.reportMailer.Logger = logger
+	s.emails.Logger = logger
+	s.snapshots.Logger = logger
+	return s
 }
 
-// New creates a new Server instance
-func New(db *sql.DB, cfg *config.Config) *Server {
-	return &Server{
-		DB:  db,
-		Cfg: cfg,
+// SubscriptionExpiry returns the job that expires subscriptions past their End_Date, dropping the
+// cached features of each lender it expires. Start it alongside the server.
+func (s *Server) SubscriptionExpiry() *jobs.SubscriptionExpiry {
+	return s.expiry
+}
+
+// OrphanSweeper returns the sweeper whose reports the maintenance endpoints serve. Start it
+// alongside the server to keep the report current.
+func (s *Server) OrphanSweeper() *jobs.OrphanSweeper {
+	return s.orphans
+}
+
+// FileScanner returns the worker that scans uploads for malware. Start it alongside the server;
+// uploads wake it, and stay unavailable until it has scanned them.
+func (s *Server) FileScanner() *jobs.FileScanner {
+	return s.scans
+}
+
+// ReportMailer returns the job that emails lenders' month-end reports. Start it alongside the server.
+func (s *Server) ReportMailer() *jobs.ReportMailer {
+	return s.reportMailer
+}
+
+// EmailDispatcher returns the job that delivers queued password reset and verification emails.
+// Start it alongside the server.
+func (s *Server) EmailDispatcher() *jobs.EmailDispatcher {
+	return s.emails
+}
+
+// LoanBookSnapshotter returns the job that stores each lender's month-end loan book. Start it
+// alongside the server.
+func (s *Server) LoanBookSnapshotter() *jobs.LoanBookSnapshotter {
+	return s.snapshots
+}
+
+// NewLogger returns the application logger writing to w: JSON lines when cfg.LogFormat is json and
+// text otherwise. Records logged with a request's context carry its request_id.
+func NewLogger(cfg *config.Config, w io.Writer) *slog.Logger {
+	var h slog.Handler
+	if cfg.LogFormat == "json" {
+		h = slog.NewJSONHandler(w, nil)
+	} else {
+		h = slog.NewTextHandler(w, nil)
 	}
+	return slog.New(requestid.NewLogHandler(h))
 }
 
-// Start runs the HTTP server
+// NewFileStorage returns the configured storage backends. The local disk is always available
+// so files stored before switching to S3 stay readable; new files go to cfg.StorageBackend.
+func NewFileStorage(cfg *config.Config) *storage.Backends {
+	stores := map[string]storage.FileStore{storage.BackendLocal: storage.NewDisk(cfg.UploadDir)}
+	if cfg.S3Bucket != "" || cfg.StorageBackend == storage.BackendS3 {
+		stores[storage.BackendS3] = storage.NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKeyID, cfg.S3SecretAccessKey)
+	}
+	defaultName := storage.BackendLocal
+	if cfg.StorageBackend == storage.BackendS3 {
+		defaultName = storage.BackendS3
+	}
+	backends, _ := storage.NewBackends(defaultName, stores) // The default is always registered above
+	return backends
+}
+
+// NewScanner returns a ClamAV scanner, or one that reports every file clean when no clamd
+// address is configured
+func NewScanner(cfg *config.Config) scanner.Scanner {
+	if cfg.ClamAVAddr == "" {
+		return scanner.Noop{}
+	}
+	return &scanner.ClamAV{Addr: cfg.ClamAVAddr}
+}
+
+// NewReportCache returns the cache of computed reports, or nil when it is disabled
+func NewReportCache(cfg *config.Config) *reports.Cache {
+	if !cfg.ReportCacheEnabled {
+		return nil
+	}
+	return reports.NewCache(cfg.ReportCacheTTL)
+}
+
+// NewMailer returns an SMTP mailer with retries, or a logging mailer when no SMTP host is configured
+func NewMailer(cfg *config.Config) mailer.Mailer {
+	if cfg.SMTPHost == "" {
+		return mailer.Log{}
+	}
+	return mailer.NewRetrying(&mailer.SMTP{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	})
+}
+
+// SetReady marks the server ready to take traffic. Call it once migrations have completed.
+func (s *Server) SetReady() {
+	s.ready.Store(true)
+}
+
+// defaultShutdownTimeout is how long Run waits for in-flight requests when Cfg.ShutdownTimeout is unset
+const defaultShutdownTimeout = 30 * time.Second
+
+// Start runs the HTTP server until it fails. It may be started before the schema is migrated:
+// /health answers straight away, while /readyz reports 503 until SetReady is called.
 func (s *Server) Start() error {
-	outer := s.NewRouter()
+	return s.Run(context.Background())
+}
+
+// Run serves HTTP on the configured port until ctx is cancelled, then shuts down gracefully: it
+// stops accepting connections and waits up to Cfg.ShutdownTimeout for in-flight requests to
+// finish. It returns nil once they have, and an error when serving fails or the wait times out.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(s.Cfg.ServerPort))
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Server listening", "port", s.Cfg.ServerPort)
+	return s.serve(ctx, ln, s.NewRouter())
+}
 
+// serve runs handler on ln until ctx is cancelled, then drains it as described on Run
+func (s *Server) serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
 	httpServer := &http.Server{
-		Addr:         ":" + strconv.Itoa(s.Cfg.ServerPort),
-		Handler:      outer,
+		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
-	fmt.Printf("Server listening on port %d\n", s.Cfg.ServerPort)
-	return httpServer.ListenAndServe()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := s.Cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
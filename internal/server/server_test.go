@@ -0,0 +1,108 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"wisetech-lms-api/internal/auth"
+	"wisetech-lms-api/internal/config"
+	"wisetech-lms-api/internal/database"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	testJWTSecret   = "test-secret"
+	testAdminAPIKey = "test-admin-key"
+)
+
+// newTestServer creates a Server backed by a fresh SQLite database file.
+func newTestServer(t *testing.T) *Server {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+
+	return New(db, &config.Config{JWTSecret: testJWTSecret, AdminAPIKey: testAdminAPIKey, UploadDir: t.TempDir(), DefaultCurrency: "LSL"}, slog.New(slog.DiscardHandler))
+}
+
+// registerTestLender creates a lender with an account and returns an access token for it.
+func registerTestLender(t *testing.T, s *Server, username string) (accountID, lenderID int, token string) {
+	accountID, err := s.authRepo.CreateLenderAndAccount(username+" Business", username+"@example.com", "123", username, "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to register lender: %v", err)
+	}
+	account, err := s.authRepo.GetAccountByID(accountID)
+	if err != nil {
+		t.Fatalf("Failed to load account: %v", err)
+	}
+	token, err = auth.GenerateAccessToken(int64(accountID), int64(account.LenderID), testJWTSecret)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	return accountID, account.LenderID, token
+}
+
+// doRequest serves a request through the router, authenticating with token when non-empty.
+func doRequest(t *testing.T, s *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	s.NewRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+// readXLSXSheet returns the values of one sheet of an XLSX workbook by cell reference, such as "B2":
+// the text of inline strings and the stored value of numbers and dates
+func readXLSXSheet(t *testing.T, data []byte, sheet int) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Not an XLSX file: %v", err)
+	}
+	f, err := zr.Open(fmt.Sprintf("xl/worksheets/sheet%d.xml", sheet))
+	if err != nil {
+		t.Fatalf("Missing sheet %d: %v", sheet, err)
+	}
+	defer f.Close()
+	var ws struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"sheetData>row>c"`
+	}
+	raw, _ := io.ReadAll(f)
+	if err := xml.Unmarshal(raw, &ws); err != nil {
+		t.Fatalf("Invalid sheet XML: %v", err)
+	}
+	cells := make(map[string]string)
+	for _, c := range ws.Cells {
+		cells[c.Ref] = c.Value + c.Inline
+	}
+	return cells
+}
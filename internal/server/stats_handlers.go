@@ -0,0 +1,881 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wisetech-lms-api/internal/export"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/jobs"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+	"wisetech-lms-api/internal/repository"
+)
+
+// maxIncomeMonths is the longest range the income report covers in one request
+const maxIncomeMonths = 120
+
+// defaultCollectionMonths and maxCollectionMonths bound the months of the collections series
+const (
+	defaultCollectionMonths = 12
+	maxCollectionMonths     = 60
+)
+
+// defaultRetentionMonths and maxRetentionMonths bound the cohorts of the borrower retention report,
+// and so the size of its matrix
+const (
+	defaultRetentionMonths = 12
+	maxRetentionMonths     = 36
+)
+
+// defaultProjectionMonths and maxProjectionMonths bound the months of the cash flow projection
+const (
+	defaultProjectionMonths = 6
+	maxProjectionMonths     = 24
+)
+
+// defaultConcentrationTop and maxConcentrationTop bound how many borrowers the concentration report lists
+const (
+	defaultConcentrationTop = 10
+	maxConcentrationTop     = 100
+)
+
+// incomeExportHeader names the columns of the CSV and XLSX income report
+var incomeExportHeader = []string{"month", "principal", "interest", "penalties", "total", "currency"}
+
+// defaultExpectedDays and maxExpectedDays bound the range of the collections-vs-expected report
+const (
+	defaultExpectedDays = 30
+	maxExpectedDays     = 366
+)
+
+// defaultTimeSeriesDays is the range of the dashboard time series when from is not given, and
+// defaultTimeSeriesMaxPoints caps its points when the configuration does not set TimeSeriesMaxPoints
+const (
+	defaultTimeSeriesDays      = 30
+	defaultTimeSeriesMaxPoints = 366
+)
+
+// collectionsVsExpectedExportHeader names the columns of the CSV and XLSX collections-vs-expected report
+var collectionsVsExpectedExportHeader = []string{"start", "end",
+	"expected_principal", "expected_interest", "expected_penalties", "expected",
+	"collected_principal", "collected_interest", "collected_penalties", "collected",
+	"gap", "collected_pct", "cumulative_expected", "cumulative_collected", "cumulative_gap", "cumulative_collected_pct", "currency"}
+
+// collectionsResponse is a lender's monthly collections in its currency, oldest month first
+type collectionsResponse struct {
+	Currency string                      `json:"currency"`
+	Series   []reports.MonthlyCollection `json:"series"`
+}
+
+// incomeReportResponse is an income report in its lender's currency
+type incomeReportResponse struct {
+	*reports.Income
+	Currency string `json:"currency"`
+}
+
+// vintagesResponse is a lender's loan cohorts in its currency, oldest first
+type vintagesResponse struct {
+	Currency string           `json:"currency"`
+	Cohorts  []models.Vintage `json:"cohorts"`
+}
+
+// cashflowProjectionResponse is a cash flow projection in its lender's currency
+type cashflowProjectionResponse struct {
+	*reports.CashflowProjection
+	Currency string `json:"currency"`
+}
+
+// concentrationResponse is a concentration report in its lender's currency
+type concentrationResponse struct {
+	*reports.Concentration
+	Currency string `json:"currency"`
+}
+
+// collectionsVsExpectedResponse is a collections-vs-expected report in its lender's currency
+type collectionsVsExpectedResponse struct {
+	*reports.CollectionsVsExpected
+	Currency string `json:"currency"`
+}
+
+// vintagesExportHeader names the columns of the CSV and XLSX vintage report
+var vintagesExportHeader = []string{"cohort", "loans_issued", "principal_issued", "paid_pct", "active_pct", "defaulted_pct", "collection_ratio", "currency"}
+
+// timeSeriesExportHeader names the columns of the CSV and XLSX time series
+var timeSeriesExportHeader = []string{"period", "value", "currency"}
+
+// concentrationExportHeader names the columns of the CSV and XLSX concentration report
+var concentrationExportHeader = []string{"rank", "borrower_id", "fullnames", "active_loans",
+	"outstanding_principal", "outstanding_interest", "outstanding", "share_pct", "over_limit", "currency"}
+
+// paymentMethodExportHeader names the columns of the CSV and XLSX payment method report
+var paymentMethodExportHeader = []string{"period", "method", "amount", "count", "share_pct", "currency"}
+
+// defaultPaymentMethodDays is the range of the payment method report when from is not given
+const defaultPaymentMethodDays = 365
+
+// summaryExportHeader names the columns of the summary sheet of XLSX reports: one figure per row
+var summaryExportHeader = []string{"field", "value"}
+
+// paymentMethodReportResponse is a payment method report in its lender's currency
+type paymentMethodReportResponse struct {
+	*reports.PaymentMethodReport
+	Currency string `json:"currency"`
+}
+
+// timeSeriesResponse is one metric of a lender's book over time, in its currency, oldest period first
+type timeSeriesResponse struct {
+	Metric      string          `json:"metric"`
+	Granularity string          `json:"granularity"`
+	From        string          `json:"from"` // YYYY-MM-DD
+	To          string          `json:"to"`   // YYYY-MM-DD, inclusive
+	Currency    string          `json:"currency"`
+	Series      []reports.Point `json:"series"`
+}
+
+// cacheStatusHeader tells clients whether a report came from the report cache ("hit") or was
+// computed for the request ("miss"). It is not sent while the cache is disabled.
+const cacheStatusHeader = "Cache-Status"
+
+// cachedReport returns the lender's report for the request's endpoint and query from the report
+// cache, calling load and caching what it returns on a miss. Cached reports are shared between
+// requests, so handlers must not modify them.
+func cachedReport[T any](s *Server, w http.ResponseWriter, r *http.Request, lenderID int, load func() (T, error)) (T, error) {
+	if s.reportCache == nil {
+		return load()
+	}
+	key := reports.CacheKey(r.URL.Path, r.URL.Query())
+	if report, ok := s.reportCache.Get(lenderID, key); ok {
+		if report, ok := report.(T); ok {
+			w.Header().Set(cacheStatusHeader, "hit")
+			return report, nil
+		}
+	}
+	report, err := load()
+	if err != nil {
+		return report, err
+	}
+	s.reportCache.Set(lenderID, key, report)
+	w.Header().Set(cacheStatusHeader, "miss")
+	return report, nil
+}
+
+// getExposure returns a risk snapshot of the authenticated lender's loan book: outstanding and
+// overdue principal, the default rate and the largest borrower's share of what is outstanding
+func (s *Server) getExposure(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	exposure, err := cachedReport(s, w, r, int(claims.LenderID), func() (*reports.Exposure, error) {
+		return s.reports.Exposure(int(claims.LenderID), time.Now().In(loc))
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, exposure)
+}
+
+// getCollections returns what the authenticated lender collected in paid receipts in each of the
+// last months calendar months of its time zone, the current one included, for charting collections over time
+func (s *Server) getCollections(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	months := defaultCollectionMonths
+	if value := r.URL.Query().Get("months"); value != "" {
+		var err error
+		if months, err = strconv.Atoi(value); err != nil || months < 1 || months > maxCollectionMonths {
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("months must be between 1 and %d", maxCollectionMonths)))
+			return
+		}
+	}
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	now := time.Now().In(loc)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	series, err := cachedReport(s, w, r, int(claims.LenderID), func() ([]reports.MonthlyCollection, error) {
+		return s.reports.Collections(int(claims.LenderID), thisMonth.AddDate(0, -(months-1), 0), months)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, collectionsResponse{Currency: code, Series: series})
+}
+
+// getPortfolioReport summarises the authenticated lender's loan book as of the end of the as_of day,
+// today by default: loans by status, what is outstanding, what has been collected and the share of
+// the outstanding balance at risk. Days run midnight to midnight in the lender's time zone.
+// as_of_snapshot=true serves the figures stored at the end of as_of's month, the last month by
+// default, instead of recomputing them, so they do not change when back-dated receipts are entered;
+// months without a snapshot get 404 snapshot_not_found.
+// Responds with a branded PDF for format=pdf or Accept: application/pdf, on plans with pdf_statements.
+func (s *Server) getPortfolioReport(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := responseFormat(r, mediaTypeJSON, mediaTypePDF)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the portfolio report is available as JSON or PDF")
+		return
+	}
+
+	location, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	query := r.URL.Query()
+	fromSnapshot := false
+	if value := query.Get("as_of_snapshot"); value != "" {
+		if fromSnapshot, err = strconv.ParseBool(value); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("as_of_snapshot must be true or false"))
+			return
+		}
+	}
+	today := startOfDay(time.Now().In(location))
+	day := today
+	if fromSnapshot {
+		day = jobs.LastMonth(today)
+	}
+	if value := query.Get("as_of"); value != "" {
+		if day, err = time.ParseInLocation(time.DateOnly, value, location); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("as_of must be a YYYY-MM-DD date"))
+			return
+		}
+		if day.After(today) {
+			s.writeServiceError(w, r, httperr.Validation("as_of cannot be in the future"))
+			return
+		}
+	}
+
+	var summary *reports.Portfolio
+	if fromSnapshot {
+		summary, err = s.snapshotPortfolio(int(claims.LenderID), day)
+	} else {
+		summary, err = cachedReport(s, w, r, int(claims.LenderID), func() (*reports.Portfolio, error) {
+			return s.reports.Portfolio(int(claims.LenderID), day)
+		})
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if format == mediaTypePDF {
+		s.writePortfolioPDF(w, r, summary)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// snapshotPortfolio returns the portfolio report stored in the lender's loan book snapshot of the
+// month day falls in, as of that month's last day
+func (s *Server) snapshotPortfolio(lenderID int, day time.Time) (*reports.Portfolio, error) {
+	snapshot, err := s.snapshotRepo.Get(lenderID, day.Format("2006-01"))
+	if err != nil {
+		return nil, err
+	}
+	var summary reports.Portfolio
+	if err := json.Unmarshal([]byte(snapshot.Portfolio), &summary); err != nil {
+		return nil, err
+	}
+	takenAt := snapshot.CreatedAt.Time
+	summary.SnapshotTakenAt = &takenAt
+	return &summary, nil
+}
+
+// getIncomeReport returns what the authenticated lender collected per calendar month between the
+// from and to months (YYYY-MM, inclusive; the last 12 months by default) of the lender's time zone, split into principal,
+// interest and penalties by receipt allocation. Responds with CSV or XLSX for format=csv or
+// format=xlsx, or the matching Accept header, with a final row for the range's totals; workbooks
+// also get a summary sheet. format=pdf renders a branded PDF, on plans with pdf_statements.
+func (s *Server) getIncomeReport(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := responseFormat(r, mediaTypeJSON, mediaTypeCSV, mediaTypeXLSX, mediaTypePDF)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the income report is available as JSON, CSV, XLSX or PDF")
+		return
+	}
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	from := to.AddDate(0, -11, 0)
+	query := r.URL.Query()
+	for _, param := range []struct {
+		name  string
+		month *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := query.Get(param.name); value != "" {
+			month, err := time.ParseInLocation("2006-01", value, loc)
+			if err != nil {
+				s.writeServiceError(w, r, httperr.Validation(param.name+" must be a YYYY-MM month"))
+				return
+			}
+			*param.month = month
+		}
+	}
+	if from.After(to) {
+		s.writeServiceError(w, r, httperr.Validation("from must not be after to"))
+		return
+	}
+	if months := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1; months > maxIncomeMonths {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("the report covers at most %d months", maxIncomeMonths)))
+		return
+	}
+
+	report, err := cachedReport(s, w, r, int(claims.LenderID), func() (*reports.Income, error) {
+		return s.reports.Income(int(claims.LenderID), from, to)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	if format == mediaTypePDF {
+		s.writeIncomePDF(w, r, report)
+		return
+	}
+	if format != mediaTypeJSON {
+		s.writeExport(w, r, format, fmt.Sprintf("income-%s-to-%s", report.From, report.To), incomeExportTables(report, code)...)
+		return
+	}
+	writeJSON(w, http.StatusOK, incomeReportResponse{Income: report, Currency: code})
+}
+
+// incomeExportTables lays out the income report for CSV and XLSX: a row per month and one for the
+// totals, and a summary sheet
+func incomeExportTables(report *reports.Income, code string) []export.Table {
+	amounts := func(label string, a reports.Split) []export.Cell {
+		return []export.Cell{export.Text(label), export.Decimal(a.Principal), export.Decimal(a.Interest),
+			export.Decimal(a.Penalties), export.Decimal(a.Total), export.Text(code)}
+	}
+	rows := make([][]export.Cell, 0, len(report.Months)+1)
+	for _, month := range report.Months {
+		rows = append(rows, amounts(month.Month, month.Split))
+	}
+	rows = append(rows, amounts("total", report.Totals))
+	summary := [][]export.Cell{
+		{export.Text("from"), export.Text(report.From)},
+		{export.Text("to"), export.Text(report.To)},
+		{export.Text("currency"), export.Text(code)},
+		{export.Text("principal"), export.Decimal(report.Totals.Principal)},
+		{export.Text("interest"), export.Decimal(report.Totals.Interest)},
+		{export.Text("penalties"), export.Decimal(report.Totals.Penalties)},
+		{export.Text("total"), export.Decimal(report.Totals.Total)},
+	}
+	return []export.Table{
+		{Name: "Income", Header: incomeExportHeader, Rows: export.Rows(rows)},
+		{Name: "Summary", Header: summaryExportHeader, Rows: export.Rows(summary)},
+	}
+}
+
+// getVintages reports how the authenticated lender's loans fared by the month they started: how many
+// were issued, what share is paid, active or defaulted today, and how much has been collected on them.
+// Responds with CSV or XLSX for format=csv or format=xlsx, or the matching Accept header.
+func (s *Server) getVintages(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the vintage report is available as JSON, CSV or XLSX")
+		return
+	}
+
+	vintages, err := s.loanRepo.GetVintages(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if format != mediaTypeJSON {
+		rows := make([][]export.Cell, len(vintages))
+		for i, v := range vintages {
+			rows[i] = []export.Cell{export.Text(v.Cohort), export.Int(v.LoansIssued), export.Decimal(v.PrincipalIssued),
+				export.Decimal(v.PaidPct), export.Decimal(v.ActivePct), export.Decimal(v.DefaultedPct),
+				export.Number(v.CollectionRatio), export.Text(code)}
+		}
+		s.writeExport(w, r, format, "vintages", export.Table{Name: "Vintages", Header: vintagesExportHeader, Rows: export.Rows(rows)})
+		return
+	}
+	writeJSON(w, http.StatusOK, vintagesResponse{Currency: code, Cohorts: vintages})
+}
+
+// getBorrowerRetention groups the authenticated lender's borrowers by the month of their first loan
+// and reports, for each of the last months months (12 by default) up to the current month of the
+// lender's time zone, how many came back for another loan in every month since, with the overall
+// share of repeat borrowers.
+func (s *Server) getBorrowerRetention(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	months := defaultRetentionMonths
+	if value := r.URL.Query().Get("months"); value != "" {
+		var err error
+		if months, err = strconv.Atoi(value); err != nil || months < 1 || months > maxRetentionMonths {
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("months must be between 1 and %d", maxRetentionMonths)))
+			return
+		}
+	}
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	report, err := cachedReport(s, w, r, int(claims.LenderID), func() (*reports.Retention, error) {
+		return s.reports.Retention(int(claims.LenderID), to.AddDate(0, -(months-1), 0), to)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// getCashflowProjection projects what the authenticated lender's active loans are scheduled to pay
+// over the coming months, starting with the current month in the lender's time zone. months sets
+// how many, 6 by default. Figures are also discounted by the lender's collection rate over the last
+// six months unless adjust=false.
+func (s *Server) getCashflowProjection(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+	query := r.URL.Query()
+
+	months := defaultProjectionMonths
+	if value := query.Get("months"); value != "" {
+		var err error
+		if months, err = strconv.Atoi(value); err != nil || months < 1 || months > maxProjectionMonths {
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("months must be between 1 and %d", maxProjectionMonths)))
+			return
+		}
+	}
+	adjust := true
+	if value := query.Get("adjust"); value != "" {
+		var err error
+		if adjust, err = strconv.ParseBool(value); err != nil {
+			s.writeServiceError(w, r, httperr.Validation("adjust must be true or false"))
+			return
+		}
+	}
+
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	report, err := cachedReport(s, w, r, lenderID, func() (*reports.CashflowProjection, error) {
+		return s.reports.CashflowProjection(lenderID, time.Now().In(loc), months, adjust)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, cashflowProjectionResponse{CashflowProjection: report, Currency: code})
+}
+
+// getConcentration lists the authenticated lender's top borrowers by outstanding principal as of
+// today in its time zone, with their share of the book, the concentration index and the borrowers
+// over the lender's max_borrower_exposure. top sets how many are listed, 10 by default.
+func (s *Server) getConcentration(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the concentration report is available as JSON, CSV or XLSX")
+		return
+	}
+
+	top := defaultConcentrationTop
+	if value := r.URL.Query().Get("top"); value != "" {
+		var err error
+		if top, err = strconv.Atoi(value); err != nil || top < 1 || top > maxConcentrationTop {
+			s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("top must be between 1 and %d", maxConcentrationTop)))
+			return
+		}
+	}
+
+	limit, err := s.maxBorrowerExposure(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	loc, err := s.lenderLocation(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	report, err := cachedReport(s, w, r, lenderID, func() (*reports.Concentration, error) {
+		return s.reports.Concentration(lenderID, time.Now().In(loc), top, limit)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	if format != mediaTypeJSON {
+		rows := make([][]export.Cell, 0, len(report.Top))
+		for i, b := range report.Top {
+			rows = append(rows, []export.Cell{
+				export.Int(i + 1),
+				export.Int(b.BorrowerID),
+				export.Text(b.Fullnames),
+				export.Int(b.ActiveLoans),
+				export.Decimal(b.Outstanding.Principal),
+				export.Decimal(b.Outstanding.Interest),
+				export.Decimal(b.Outstanding.Total),
+				export.Decimal(b.Share),
+				export.Text(strconv.FormatBool(b.OverLimit)),
+				export.Text(code),
+			})
+		}
+		asOf, _ := time.Parse(time.DateOnly, report.AsOf)
+		summary := [][]export.Cell{
+			{export.Text("as_of"), export.Date(asOf)},
+			{export.Text("outstanding_principal"), export.Decimal(report.OutstandingPrincipal)},
+			{export.Text("borrowers"), export.Int(report.Borrowers)},
+			{export.Text("top_share_pct"), export.Decimal(report.TopShare)},
+			{export.Text("hhi"), export.Number(report.HHI)},
+			{export.Text("exposure_limit"), export.Decimal(report.ExposureLimit)},
+			{export.Text("borrowers_over_limit"), export.Int(report.BorrowersOverLimit)},
+			{export.Text("currency"), export.Text(code)},
+		}
+		s.writeExport(w, r, format, "concentration-"+report.AsOf,
+			export.Table{Name: "Concentration", Header: concentrationExportHeader, Rows: export.Rows(rows)},
+			export.Table{Name: "Summary", Header: summaryExportHeader, Rows: export.Rows(summary)})
+		return
+	}
+	writeJSON(w, http.StatusOK, concentrationResponse{Concentration: report, Currency: code})
+}
+
+// maxBorrowerExposure reads the lender's limit on one borrower's outstanding principal; 0 means none
+func (s *Server) maxBorrowerExposure(lenderID int) (float64, error) {
+	setting, err := s.customValueRepo.GetByName(lenderID, models.SettingMaxBorrowerExposure)
+	if errors.Is(err, repository.ErrCustomValueNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	limit, _ := setting.Value.(float64)
+	return limit, nil
+}
+
+// getCollectionsVsExpected compares what the authenticated lender's loans were scheduled to pay with
+// what was collected, per day or week, with the running gap between the two. from and to are
+// YYYY-MM-DD days or RFC3339 timestamps, the last 30 days up to today by default, and days run
+// midnight to midnight in the lender's time zone.
+func (s *Server) getCollectionsVsExpected(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the collections report is available as JSON, CSV or XLSX")
+		return
+	}
+
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = reports.GranularityDay
+	case reports.GranularityDay, reports.GranularityWeek:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("granularity must be day or week"))
+		return
+	}
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	from, to, err := parseReportDays(query, loc, defaultExpectedDays)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if !to.Before(from.AddDate(0, 0, maxExpectedDays)) {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("the report covers at most %d days", maxExpectedDays)))
+		return
+	}
+
+	report, err := cachedReport(s, w, r, int(claims.LenderID), func() (*reports.CollectionsVsExpected, error) {
+		return s.reports.CollectionsVsExpected(int(claims.LenderID), from, to, granularity)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	if format != mediaTypeJSON {
+		rows := make([][]export.Cell, 0, len(report.Buckets))
+		for _, b := range report.Buckets {
+			start, _ := time.Parse(time.DateOnly, b.Start)
+			end, _ := time.Parse(time.DateOnly, b.End)
+			row := []export.Cell{export.Date(start), export.Date(end)}
+			for _, v := range []float64{b.Expected.Principal, b.Expected.Interest, b.Expected.Penalties, b.Expected.Total,
+				b.Collected.Principal, b.Collected.Interest, b.Collected.Penalties, b.Collected.Total, b.Gap, b.CollectedPct,
+				b.CumulativeExpected, b.CumulativeCollected, b.CumulativeGap, b.CumulativeCollectedPct} {
+				row = append(row, export.Decimal(v))
+			}
+			rows = append(rows, append(row, export.Text(code)))
+		}
+		summary := [][]export.Cell{
+			{export.Text("from"), export.Date(from)},
+			{export.Text("to"), export.Date(to)},
+			{export.Text("granularity"), export.Text(report.Granularity)},
+			{export.Text("currency"), export.Text(code)},
+		}
+		if n := len(report.Buckets); n > 0 {
+			last := report.Buckets[n-1]
+			summary = append(summary,
+				[]export.Cell{export.Text("expected"), export.Decimal(last.CumulativeExpected)},
+				[]export.Cell{export.Text("collected"), export.Decimal(last.CumulativeCollected)},
+				[]export.Cell{export.Text("gap"), export.Decimal(last.CumulativeGap)},
+				[]export.Cell{export.Text("collected_pct"), export.Decimal(last.CumulativeCollectedPct)})
+		}
+		s.writeExport(w, r, format, fmt.Sprintf("collections-vs-expected-%s-to-%s", report.From, report.To),
+			export.Table{Name: "Collections vs expected", Header: collectionsVsExpectedExportHeader, Rows: export.Rows(rows)},
+			export.Table{Name: "Summary", Header: summaryExportHeader, Rows: export.Rows(summary)})
+		return
+	}
+	writeJSON(w, http.StatusOK, collectionsVsExpectedResponse{CollectionsVsExpected: report, Currency: code})
+}
+
+// getTimeSeries charts collections, disbursements or the outstanding balance of the authenticated
+// lender's book per day, week or month from from to to, inclusive, for the dashboard's line charts.
+// Periods run in the lender's time zone. The range defaults to the last 30 days and is capped at the configured number of points. Responds
+// with CSV or XLSX for format=csv or format=xlsx, or the matching Accept header.
+func (s *Server) getTimeSeries(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the time series is available as JSON, CSV or XLSX")
+		return
+	}
+
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	switch metric {
+	case reports.MetricCollections, reports.MetricDisbursements, reports.MetricOutstanding:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("metric must be collections, disbursements or outstanding"))
+		return
+	}
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = reports.GranularityDay
+	case reports.GranularityDay, reports.GranularityWeek, reports.GranularityMonth:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("granularity must be day, week or month"))
+		return
+	}
+
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	from, to, err := parseReportDays(query, loc, defaultTimeSeriesDays)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	maxPoints := s.Cfg.TimeSeriesMaxPoints
+	if maxPoints <= 0 {
+		maxPoints = defaultTimeSeriesMaxPoints
+	}
+	if reports.PeriodCount(from, to, granularity) > maxPoints {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("the series covers at most %d %ss", maxPoints, granularity)))
+		return
+	}
+
+	series, err := cachedReport(s, w, r, int(claims.LenderID), func() ([]reports.Point, error) {
+		return s.reports.TimeSeries(int(claims.LenderID), metric, granularity, from, to)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if format != mediaTypeJSON {
+		rows := func(yield func([]export.Cell) bool) {
+			for _, p := range series {
+				if !yield([]export.Cell{export.Text(p.Period), export.Decimal(p.Value), export.Text(code)}) {
+					return
+				}
+			}
+		}
+		s.writeExport(w, r, format, fmt.Sprintf("%s-%s-to-%s", metric, from.Format(time.DateOnly), to.Format(time.DateOnly)),
+			export.Table{Name: "Time series", Header: timeSeriesExportHeader, Rows: rows})
+		return
+	}
+	writeJSON(w, http.StatusOK, timeSeriesResponse{
+		Metric:      metric,
+		Granularity: granularity,
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Currency:    code,
+		Series:      series,
+	})
+}
+
+// getPaymentMethodReport breaks the authenticated lender's paid receipts down by payment method per
+// day, week or month from from to to, inclusive, with each method's amount, count and share and a
+// totals row. Free-text methods are normalized, and those not recognised are reported as other.
+// Periods run in the lender's time zone; granularity defaults to month and the range to the last 365
+// days, capped at the configured number of points. Responds with CSV or XLSX, one row per period and
+// method, for format=csv or format=xlsx, or the matching Accept header.
+func (s *Server) getPaymentMethodReport(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	w.Header().Add("Vary", "Accept")
+	format, ok := exportFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, "not_acceptable", "the payment method report is available as JSON, CSV or XLSX")
+		return
+	}
+
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	switch granularity {
+	case "":
+		granularity = reports.GranularityMonth
+	case reports.GranularityDay, reports.GranularityWeek, reports.GranularityMonth:
+	default:
+		s.writeServiceError(w, r, httperr.Validation("granularity must be day, week or month"))
+		return
+	}
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	from, to, err := parseReportDays(query, loc, defaultPaymentMethodDays)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	maxPoints := s.Cfg.TimeSeriesMaxPoints
+	if maxPoints <= 0 {
+		maxPoints = defaultTimeSeriesMaxPoints
+	}
+	if reports.PeriodCount(from, to, granularity) > maxPoints {
+		s.writeServiceError(w, r, httperr.Validation(fmt.Sprintf("the report covers at most %d %ss", maxPoints, granularity)))
+		return
+	}
+
+	report, err := cachedReport(s, w, r, int(claims.LenderID), func() (*reports.PaymentMethodReport, error) {
+		return s.reports.PaymentMethods(int(claims.LenderID), granularity, from, to)
+	})
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	code, err := s.lenderRepo.GetCurrency(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	if format != mediaTypeJSON {
+		rows := func(yield func([]export.Cell) bool) {
+			for _, p := range append(report.Periods, report.Totals) {
+				for _, m := range p.Methods {
+					if !yield([]export.Cell{export.Text(p.Period), export.Text(m.Method), export.Decimal(m.Amount),
+						export.Int(m.Count), export.Number(m.SharePct), export.Text(code)}) {
+						return
+					}
+				}
+			}
+		}
+		s.writeExport(w, r, format, fmt.Sprintf("payment-methods-%s-to-%s", report.From, report.To),
+			export.Table{Name: "Payment methods", Header: paymentMethodExportHeader, Rows: rows})
+		return
+	}
+	writeJSON(w, http.StatusOK, paymentMethodReportResponse{PaymentMethodReport: report, Currency: code})
+}
+
+// queryReport runs a report specification posted by the authenticated lender: an entity (loans,
+// receipts or borrowers), filters, group_by fields and aggregates, each named from the reports
+// package's allowlists. Dates given for timestamp filters start in the lender's time zone. The rows
+// are returned with the specification they answer.
+func (s *Server) queryReport(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	var spec reports.QuerySpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	loc, err := s.lenderLocation(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	result, err := s.reports.Query(int(claims.LenderID), spec, loc)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,793 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/reports"
+)
+
+func TestGetExposure(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "exposure")
+
+	activeID := seedLoan(t, s, lenderID, "active", 6000, 10, 12)
+	seedLoan(t, s, lenderID, "active", 2000, 10, 12)
+	overdueID := seedLoan(t, s, lenderID, "active", 2000, 10, 3)
+	s.DB.Exec("UPDATE Loans SET Start_Date = DATE('now', '-6 months') WHERE Loan_ID = ?", overdueID)
+	s.DB.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Status, Amount) VALUES (?, ?, 'paid', 1000)", activeID, lenderID)
+	seedLoan(t, s, lenderID, "defaulted", 1000, 10, 12)
+	seedLoan(t, s, lenderID, "paid", 1000, 10, 12)
+	seedLoan(t, s, lenderID, "pending", 1000, 10, 12)
+
+	// Test case 1: Every metric is reported
+	rr := doRequest(t, s, "GET", "/api/stats/exposure", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var e reports.Exposure
+	json.Unmarshal(rr.Body.Bytes(), &e)
+	if e.OutstandingPrincipal != 9000 || e.OverduePrincipal != 2000 || e.ActiveLoans != 3 || e.OverdueLoans != 1 {
+		t.Errorf("Unexpected outstanding: %+v", e)
+	}
+	if e.OriginatedLoans != 5 || e.DefaultedLoans != 1 || e.DefaultRate != 0.2 {
+		t.Errorf("Unexpected defaults: %+v", e)
+	}
+	// seedLoan gives every loan its own borrower, so the largest is the 5000 left on the first loan
+	if e.LargestBorrowerOutstanding != 5000 || e.Concentration != 5000.0/9000 {
+		t.Errorf("Unexpected concentration: %+v", e)
+	}
+
+	// Test case 2: Requires authentication
+	if rr := doRequest(t, s, "GET", "/api/stats/exposure", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestGetPortfolioReport(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "portfolio")
+
+	// Test case 1: A lender with no loans gets zeros rather than nulls
+	rr := doRequest(t, s, "GET", "/api/reports/portfolio", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "null") {
+		t.Errorf("Expected no nulls, got %s", rr.Body.String())
+	}
+	var summary reports.Portfolio
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	if len(summary.Loans) != 5 || summary.Outstanding.Total != 0 || summary.PortfolioAtRisk != 0 {
+		t.Errorf("Expected an empty report, got %+v", summary)
+	}
+
+	// Test case 2: Loans and receipts are reported
+	loanID := seedLoan(t, s, lenderID, "active", 2000, 10, 12)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 500}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+	rr = doRequest(t, s, "GET", "/api/reports/portfolio", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	if summary.Outstanding.Principal != 1500 || summary.TotalCollected != 500 || summary.Collected.Principal != 500 || summary.AverageLoanSize != 2000 {
+		t.Errorf("Unexpected report: %+v", summary)
+	}
+
+	// Test case 3: as_of must be a past or current date
+	for _, asOf := range []string{"yesterday", "2999-01-01"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/portfolio?as_of="+asOf, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", asOf, rr.Code)
+		}
+	}
+	rr = doRequest(t, s, "GET", "/api/reports/portfolio?as_of=2020-01-01", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	if rr.Code != http.StatusOK || summary.AsOf != "2020-01-01" || summary.Loans[1].Count != 0 {
+		t.Errorf("Expected the loan left out of a 2020 report, got %d %+v", rr.Code, summary)
+	}
+}
+
+func TestGetIncomeReport(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "income")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 20, 12)
+	s.DB.Exec("UPDATE Loans SET Monthly_Payment = 100 WHERE Loan_ID = ?", loanID)
+	for _, receipt := range []struct {
+		amount float64
+		at     time.Time
+	}{
+		{800, time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)},
+		{300, time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC)},
+	} {
+		if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: receipt.amount, Timestamp: models.NewJSONTime(receipt.at)}); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+
+	// Test case 1: One row per month, including the empty one, with totals
+	rr := doRequest(t, s, "GET", "/api/reports/income?from=2026-01&to=2026-03", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report reports.Income
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if len(report.Months) != 3 || report.Months[1].Total != 0 || report.Months[2].Interest != 100 || report.Totals.Total != 1100 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// Test case 2: format=csv returns the same rows and a total row
+	rr = doRequest(t, s, "GET", "/api/reports/income?from=2026-01&to=2026-03&format=csv", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV response, got %d %s", rr.Code, ct)
+	}
+	want := "month,principal,interest,penalties,total,currency\n" +
+		"2026-01,800.00,0.00,0.00,800.00,LSL\n" +
+		"2026-02,0.00,0.00,0.00,0.00,LSL\n" +
+		"2026-03,200.00,100.00,0.00,300.00,LSL\n" +
+		"total,1000.00,100.00,0.00,1100.00,LSL\n"
+	if rr.Body.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", rr.Body.String())
+	}
+
+	// Test case 3: format=xlsx returns a workbook with typed amounts and a summary sheet
+	rr = doRequest(t, s, "GET", "/api/reports/income?from=2026-01&to=2026-03&format=xlsx", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || ct != mediaTypeXLSX {
+		t.Fatalf("Expected an XLSX response, got %d %s", rr.Code, ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="income-2026-01-to-2026-03.xlsx"` {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+	cells := readXLSXSheet(t, rr.Body.Bytes(), 1)
+	for ref, want := range map[string]string{"A1": "month", "A4": "2026-03", "B4": "200", "C4": "100", "E5": "1100", "F5": "LSL"} {
+		if cells[ref] != want {
+			t.Errorf("Income %s: expected %q, got %q", ref, want, cells[ref])
+		}
+	}
+	summary := readXLSXSheet(t, rr.Body.Bytes(), 2)
+	if summary["A8"] != "total" || summary["B8"] != "1100" || summary["B4"] != "LSL" {
+		t.Errorf("Unexpected summary sheet: %v", summary)
+	}
+
+	// Test case 4: Invalid months and ranges are rejected
+	for _, query := range []string{"from=2026-1", "from=2026-03&to=2026-01", "from=2000-01&to=2026-01"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/income?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+	if rr := doRequest(t, s, "GET", "/api/reports/income?format=xml", token, ""); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406 for format=xml, got %d", rr.Code)
+	}
+}
+
+// checkPDF verifies a response is a complete PDF whose cross-reference table is where the trailer says
+func checkPDF(t *testing.T, body []byte) {
+	t.Helper()
+	if !bytes.HasPrefix(body, []byte("%PDF-")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Fatalf("Expected a PDF header and trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(body)
+	if m == nil {
+		t.Fatal("Expected startxref")
+	}
+	if xref, _ := strconv.Atoi(string(m[1])); xref >= len(body) || !bytes.HasPrefix(body[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+}
+
+func TestReportPDFs(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "reportpdf")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 20, 12)
+	s.DB.Exec("UPDATE Loans SET Monthly_Payment = 100 WHERE Loan_ID = ?", loanID)
+	at := time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 1100, Timestamp: models.NewJSONTime(at)}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+	incomePath := "/api/reports/income?from=2026-01&to=2026-03&format=pdf"
+
+	// Test case 1: Plans without PDF statements are refused
+	for _, path := range []string{incomePath, "/api/reports/portfolio?format=pdf"} {
+		if rr := doRequest(t, s, "GET", path, token, ""); rr.Code != http.StatusPaymentRequired {
+			t.Errorf("Expected status 402 for %s, got %d", path, rr.Code)
+		}
+	}
+	enablePDFStatements(t, s)
+
+	// Test case 2: The income report carries its period, monthly rows and totals
+	rr := doRequest(t, s, "GET", incomePath, token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != mediaTypePDF {
+		t.Errorf("Expected application/pdf, got %q", ct)
+	}
+	body := rr.Body.Bytes()
+	checkPDF(t, body)
+	for _, want := range []string{"(Income report) Tj", "(January 2026 to March 2026) Tj", "(2026-03) Tj", "(1000.00) Tj", "(LSL 1100.00) Tj", "(Generated) Tj"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("Expected %q in the income report", want)
+		}
+	}
+
+	// Test case 3: The portfolio report carries its date, loans and balances
+	rr = doRequest(t, s, "GET", "/api/reports/portfolio?as_of=2026-06-30", token, "")
+	var summary reports.Portfolio
+	json.Unmarshal(rr.Body.Bytes(), &summary)
+	rr = doRequest(t, s, "GET", "/api/reports/portfolio?as_of=2026-06-30&format=pdf", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body = rr.Body.Bytes()
+	checkPDF(t, body)
+	for _, want := range []string{"(Portfolio report) Tj", "(30 June 2026) Tj", "(active) Tj", "(LSL 1000.00) Tj",
+		fmt.Sprintf("(LSL %.2f) Tj", summary.Outstanding.Total), "(LSL 1100.00) Tj"} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("Expected %q in the portfolio report", want)
+		}
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "portfolio-2026-06-30.pdf") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	// Test case 4: Long tables run over several pages
+	rr = doRequest(t, s, "GET", "/api/reports/income?from=2017-01&to=2026-12&format=pdf", token, "")
+	if rr.Code != http.StatusOK || !bytes.Contains(rr.Body.Bytes(), []byte("(Page 2 of ")) {
+		t.Errorf("Expected a multi-page report, got %d", rr.Code)
+	}
+	checkPDF(t, rr.Body.Bytes())
+
+	// Test case 5: Other reports are not offered as PDF
+	if rr := doRequest(t, s, "GET", "/api/reports/portfolio?format=csv", token, ""); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406 for a CSV portfolio, got %d", rr.Code)
+	}
+	if rr := doRequest(t, s, "GET", "/api/reports/vintages?format=pdf", token, ""); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406 for PDF vintages, got %d", rr.Code)
+	}
+}
+
+func TestReports_LenderTimezone(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "maseru")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 20, 12)
+
+	// Test case 1: Time zones must be IANA names
+	for _, name := range []string{"", "Local", "Mars/Olympus"} {
+		if rr := doRequest(t, s, "PATCH", "/api/lenders/me", token, fmt.Sprintf(`{"timezone":%q}`, name)); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %q, got %d", name, rr.Code)
+		}
+	}
+	rr := doRequest(t, s, "PATCH", "/api/lenders/me", token, `{"timezone":"Africa/Maseru"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"timezone":"Africa/Maseru"`) {
+		t.Fatalf("Expected the time zone to be set, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Receipts 30 minutes either side of midnight on 1 March in Maseru, UTC+2
+	for _, receipt := range []struct {
+		amount float64
+		at     time.Time
+	}{
+		{100, time.Date(2026, 2, 28, 21, 30, 0, 0, time.UTC)},
+		{250, time.Date(2026, 2, 28, 22, 30, 0, 0, time.UTC)},
+	} {
+		if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: receipt.amount, Timestamp: models.NewJSONTime(receipt.at)}); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+
+	// Test case 2: Months run in the lender's time zone
+	rr = doRequest(t, s, "GET", "/api/reports/income?from=2026-02&to=2026-03", token, "")
+	var income reports.Income
+	json.Unmarshal(rr.Body.Bytes(), &income)
+	if len(income.Months) != 2 || income.Months[0].Total != 100 || income.Months[1].Total != 250 {
+		t.Errorf("Expected 100 in February and 250 in March, got %+v", income.Months)
+	}
+
+	// Test case 3: Days run in the lender's time zone, with the end date included
+	rr = doRequest(t, s, "GET", "/api/reports/collections-vs-expected?from=2026-02-28&to=2026-03-01", token, "")
+	var report reports.CollectionsVsExpected
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if len(report.Buckets) != 2 || report.Buckets[0].Collected.Total != 100 || report.Buckets[1].Collected.Total != 250 {
+		t.Errorf("Expected 100 on 28 February and 250 on 1 March, got %+v", report.Buckets)
+	}
+	rr = doRequest(t, s, "GET", "/api/dashboard/timeseries?metric=collections&from=2026-03-01&to=2026-03-01", token, "")
+	var series timeSeriesResponse
+	json.Unmarshal(rr.Body.Bytes(), &series)
+	if len(series.Series) != 1 || series.Series[0].Value != 250 {
+		t.Errorf("Expected 250 on 1 March, got %+v", series.Series)
+	}
+
+	// Test case 4: An RFC3339 timestamp counts the lender's day it falls on
+	rr = doRequest(t, s, "GET", "/api/dashboard/timeseries?metric=collections&from=2026-02-28T22:00:00Z&to=2026-03-01T12:00:00%2B02:00", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &series)
+	if rr.Code != http.StatusOK || series.From != "2026-03-01" || series.To != "2026-03-01" || series.Series[0].Value != 250 {
+		t.Errorf("Expected 1 March alone, got %d %+v", rr.Code, series)
+	}
+
+	// Test case 5: Ranges ending before they start are rejected
+	for _, path := range []string{
+		"/api/reports/collections-vs-expected?from=2026-03-02&to=2026-03-01",
+		"/api/dashboard/timeseries?metric=collections&from=2026-03-01T00:00:00Z&to=2026-02-28T00:00:00Z",
+		"/api/reports/income?from=2026-03&to=2026-02",
+		"/api/files?uploaded_after=2026-03-02&uploaded_before=2026-03-01",
+	} {
+		if rr := doRequest(t, s, "GET", path, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestGetBorrowerRetention(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "retention")
+	firstID := seedLoan(t, s, lenderID, "active", 1000, 10, 6)
+	var borrowerID int
+	s.DB.QueryRow("SELECT Borrower_ID FROM Loans WHERE Loan_ID = ?", firstID).Scan(&borrowerID)
+	thisMonth := time.Now().UTC().AddDate(0, 0, -time.Now().UTC().Day()+1)
+	s.DB.Exec("UPDATE Loans SET Start_Date = ? WHERE Loan_ID = ?", thisMonth.AddDate(0, -1, 0).Format(time.DateOnly), firstID)
+	s.DB.Exec(`INSERT INTO Loans (Borrower_ID, Lender_ID, Months_To_Pay, Payment_Status, Amount, Interest_Rate, Start_Date)
+		VALUES (?, ?, 6, 'active', 500, 10, ?)`, borrowerID, lenderID, thisMonth.Format(time.DateOnly))
+
+	// Test case 1: The last months cohorts, with the borrower returning a month after their first loan
+	rr := doRequest(t, s, "GET", "/api/reports/borrower-retention?months=2", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report reports.Retention
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if len(report.Cohorts) != 2 || report.Cohorts[0].Borrowers != 1 || len(report.Cohorts[0].Returned) != 2 || report.Cohorts[0].Returned[1] != 1 {
+		t.Errorf("Unexpected matrix: %+v", report.Cohorts)
+	}
+	if report.To != thisMonth.Format("2006-01") || report.RepeatRate != 100 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	// Test case 2: Twelve cohorts by default, and the matrix size is capped
+	rr = doRequest(t, s, "GET", "/api/reports/borrower-retention", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if len(report.Cohorts) != 12 {
+		t.Errorf("Expected 12 cohorts, got %d", len(report.Cohorts))
+	}
+	for _, months := range []string{"0", "37", "x"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/borrower-retention?months="+months, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for months=%s, got %d", months, rr.Code)
+		}
+	}
+}
+
+func TestGetConcentration(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "concentration")
+	// seedLoan gives every loan its own borrower
+	seedLoan(t, s, lenderID, "active", 6000, 10, 12)
+	seedLoan(t, s, lenderID, "active", 3000, 10, 12)
+	seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	seedLoan(t, s, lenderID, "paid", 9000, 10, 12)
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/max_borrower_exposure", token, `{"value": 5000}`); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to set the exposure limit: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 1: The top borrowers with their shares, the index and the limit breaches
+	rr := doRequest(t, s, "GET", "/api/reports/concentration?top=2", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report concentrationResponse
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if report.Concentration == nil || len(report.Top) != 2 || report.Top[0].Share != 60 || !report.Top[0].OverLimit || report.Top[1].OverLimit {
+		t.Fatalf("Unexpected top borrowers: %s", rr.Body.String())
+	}
+	if report.Borrowers != 3 || report.TopShare != 90 || report.BorrowersOverLimit != 1 || report.ExposureLimit != 5000 || report.Currency != "LSL" {
+		t.Errorf("Unexpected report: %s", rr.Body.String())
+	}
+
+	// Test case 2: format=csv returns the top borrowers
+	rr = doRequest(t, s, "GET", "/api/reports/concentration?top=2&format=csv", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV response, got %d %s", rr.Code, ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 || lines[0] != strings.Join(concentrationExportHeader, ",") ||
+		!strings.HasPrefix(lines[1], "1,") || !strings.Contains(lines[1], ",6000.00,") || !strings.HasSuffix(lines[1], ",60.00,true,LSL") {
+		t.Errorf("Unexpected CSV:\n%s", rr.Body.String())
+	}
+
+	// Test case 3: top is capped
+	for _, top := range []string{"0", "101", "x"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/concentration?top="+top, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for top=%s, got %d", top, rr.Code)
+		}
+	}
+
+	// Test case 4: The exposure limit must not be negative
+	if rr := doRequest(t, s, "PUT", "/api/custom-values/max_borrower_exposure", token, `{"value": -1}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestGetCashflowProjection(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "projection")
+	// Starting today, the first of 12 instalments of 100 falls due a month from now
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	s.DB.Exec("UPDATE Loans SET Monthly_Payment = 100 WHERE Loan_ID = ?", loanID)
+	seedLoan(t, s, lenderID, "defaulted", 5000, 0, 5)
+
+	// Test case 1: One month per requested month, without history to discount by
+	rr := doRequest(t, s, "GET", "/api/reports/cashflow-projection?months=3", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var p cashflowProjectionResponse
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	if p.CashflowProjection == nil || len(p.Months) != 3 || p.Gross != 200 || p.RiskAdjusted != 200 || p.CollectionRate != 100 || !p.Adjusted || p.Currency != "LSL" {
+		t.Fatalf("Unexpected projection: %s", rr.Body.String())
+	}
+
+	// Test case 2: Six months by default, and the adjustment can be turned off
+	rr = doRequest(t, s, "GET", "/api/reports/cashflow-projection?adjust=false", token, "")
+	var unadjusted cashflowProjectionResponse
+	json.Unmarshal(rr.Body.Bytes(), &unadjusted)
+	if unadjusted.CashflowProjection == nil || len(unadjusted.Months) != 6 || unadjusted.Adjusted || unadjusted.HistoryFrom != "" {
+		t.Errorf("Unexpected projection: %s", rr.Body.String())
+	}
+
+	// Test case 3: Invalid parameters
+	for _, query := range []string{"months=0", "months=25", "adjust=maybe"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/cashflow-projection?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestGetCollections(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "collections")
+	loanID := seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 250, Timestamp: models.NewJSONTime(thisMonth)}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+
+	// Test case 1: Twelve months by default, ending with this month's payment, the rest empty
+	rr := doRequest(t, s, "GET", "/api/stats/collections", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body collectionsResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Currency != "LSL" || len(body.Series) != 12 {
+		t.Fatalf("Expected 12 months in LSL, got %+v", body)
+	}
+	last := body.Series[11]
+	if last.Month != thisMonth.Format("2006-01") || last.TotalCollected != 250 || last.PaymentCount != 1 {
+		t.Errorf("Expected this month's payment, got %+v", last)
+	}
+	if first := body.Series[0]; first.Month != thisMonth.AddDate(0, -11, 0).Format("2006-01") || first.PaymentCount != 0 {
+		t.Errorf("Expected an empty first month, got %+v", first)
+	}
+
+	// Test case 2: months chooses the length of the series
+	rr = doRequest(t, s, "GET", "/api/stats/collections?months=2", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if len(body.Series) != 2 || body.Series[0].TotalCollected != 0 || body.Series[1].TotalCollected != 250 {
+		t.Errorf("Expected an empty month then this month, got %+v", body.Series)
+	}
+
+	// Test case 3: months must be in range
+	for _, months := range []string{"0", "61", "x"} {
+		if rr := doRequest(t, s, "GET", "/api/stats/collections?months="+months, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for months=%s, got %d", months, rr.Code)
+		}
+	}
+}
+
+func TestGetVintages(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "vintages")
+	loanID := seedLoan(t, s, lenderID, "defaulted", 1000, 10, 12)
+	s.DB.Exec("UPDATE Loans SET Start_Date = '2026-02-14' WHERE Loan_ID = ?", loanID)
+	s.DB.Exec("INSERT INTO Recipets (Loan_ID, Lender_ID, Timestamp, Status, Amount) VALUES (?, ?, DATETIME('now'), 'paid', 250)", loanID, lenderID)
+
+	// Test case 1: The loan's cohort in the lender's currency
+	rr := doRequest(t, s, "GET", "/api/reports/vintages", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body vintagesResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Currency != "LSL" || len(body.Cohorts) != 1 {
+		t.Fatalf("Expected one cohort in LSL, got %+v", body)
+	}
+	if c := body.Cohorts[0]; c.Cohort != "2026-02" || c.LoansIssued != 1 || c.DefaultedPct != 100 || c.CollectionRatio != 0.25 {
+		t.Errorf("Unexpected cohort: %+v", c)
+	}
+
+	// Test case 2: Authentication is required
+	if rr := doRequest(t, s, "GET", "/api/reports/vintages", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestGetCollectionsVsExpected(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "expected")
+	// Repays 100 a month, stored without a monthly payment
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	s.DB.Exec("UPDATE Loans SET Start_Date = '2026-01-10' WHERE Loan_ID = ?", loanID)
+	at := time.Date(2026, 2, 12, 9, 0, 0, 0, time.UTC)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 75, Timestamp: models.NewJSONTime(at)}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+
+	// Test case 1: Days by default, with the instalment due and the late partial payment
+	rr := doRequest(t, s, "GET", "/api/reports/collections-vs-expected?from=2026-02-09&to=2026-02-12", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body collectionsVsExpectedResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Currency != "LSL" || body.Granularity != reports.GranularityDay || len(body.Buckets) != 4 {
+		t.Fatalf("Expected 4 days in LSL, got %+v", body)
+	}
+	if due, paid := body.Buckets[1], body.Buckets[3]; due.Expected.Total != 100 || paid.Collected.Principal != 75 || paid.CumulativeGap != 25 || paid.CumulativeCollectedPct != 75 {
+		t.Errorf("Unexpected buckets: %+v", body.Buckets)
+	}
+
+	// Test case 2: Weekly, as CSV
+	rr = doRequest(t, s, "GET", "/api/reports/collections-vs-expected?from=2026-02-09&to=2026-02-12&granularity=week&format=csv", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV response, got %d %s", rr.Code, ct)
+	}
+	want := "start,end,expected_principal,expected_interest,expected_penalties,expected," +
+		"collected_principal,collected_interest,collected_penalties,collected," +
+		"gap,collected_pct,cumulative_expected,cumulative_collected,cumulative_gap,cumulative_collected_pct,currency\n" +
+		"2026-02-09,2026-02-12,100.00,0.00,0.00,100.00,75.00,0.00,0.00,75.00,25.00,75.00,100.00,75.00,25.00,75.00,LSL\n"
+	if rr.Body.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", rr.Body.String())
+	}
+
+	// Test case 3: As a workbook, days are date cells and the summary holds the running totals
+	rr = doRequest(t, s, "GET", "/api/reports/collections-vs-expected?from=2026-02-09&to=2026-02-12&format=xlsx", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || ct != mediaTypeXLSX {
+		t.Fatalf("Expected an XLSX response, got %d %s", rr.Code, ct)
+	}
+	cells := readXLSXSheet(t, rr.Body.Bytes(), 1)
+	if cells["A2"] != "46062" || cells["F3"] != "100" || cells["J5"] != "75" || cells["Q5"] != "LSL" {
+		t.Errorf("Unexpected buckets: %v", cells)
+	}
+	if summary := readXLSXSheet(t, rr.Body.Bytes(), 2); summary["B7"] != "75" || summary["B8"] != "25" {
+		t.Errorf("Unexpected summary sheet: %v", summary)
+	}
+
+	// Test case 4: Invalid granularities, days and ranges are rejected
+	for _, query := range []string{"granularity=month", "from=2026-2-01", "from=2026-02-12&to=2026-02-09", "from=2025-01-01&to=2026-02-01"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/collections-vs-expected?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestGetTimeSeries(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "timeseries")
+	loanID := seedLoan(t, s, lenderID, "active", 1200, 0, 12)
+	s.DB.Exec("UPDATE Loans SET Start_Date = '2026-01-10' WHERE Loan_ID = ?", loanID)
+	at := time.Date(2026, 2, 12, 9, 0, 0, 0, time.UTC)
+	if _, err := s.receiptRepo.CreateReceipt(lenderID, &models.Receipt{LoanID: loanID, Status: "paid", Amount: 75, Timestamp: models.NewJSONTime(at)}); err != nil {
+		t.Fatalf("CreateReceipt failed: %v", err)
+	}
+
+	// Test case 1: Monthly outstanding balance, in the lender's currency
+	rr := doRequest(t, s, "GET", "/api/dashboard/timeseries?metric=outstanding&granularity=month&from=2025-12-01&to=2026-02-28", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body timeSeriesResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	want := []reports.Point{{Period: "2025-12", Value: 0}, {Period: "2026-01", Value: 1200}, {Period: "2026-02", Value: 1125}}
+	if body.Currency != "LSL" || body.Metric != reports.MetricOutstanding || len(body.Series) != len(want) {
+		t.Fatalf("Expected 3 months in LSL, got %+v", body)
+	}
+	for i := range want {
+		if body.Series[i] != want[i] {
+			t.Errorf("Point %d: expected %+v, got %+v", i, want[i], body.Series[i])
+		}
+	}
+
+	// Test case 2: Daily by default
+	rr = doRequest(t, s, "GET", "/api/dashboard/timeseries?metric=collections&from=2026-02-11&to=2026-02-13", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusOK || body.Granularity != reports.GranularityDay || len(body.Series) != 3 || body.Series[1].Value != 75 {
+		t.Errorf("Expected 75 collected on the second of 3 days, got %d %+v", rr.Code, body)
+	}
+
+	// Test case 3: Invalid metrics, granularities, days and ranges are rejected
+	for _, query := range []string{"", "metric=income", "metric=collections&granularity=year", "metric=collections&from=2026-2-01",
+		"metric=collections&from=2026-02-12&to=2026-02-09", "metric=collections&from=2025-01-01&to=2026-02-01"} {
+		if rr := doRequest(t, s, "GET", "/api/dashboard/timeseries?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %q, got %d", query, rr.Code)
+		}
+	}
+
+	// Test case 4: The cap counts points, so a longer range fits in months
+	rr = doRequest(t, s, "GET", "/api/dashboard/timeseries?metric=disbursements&granularity=month&from=2020-01-01&to=2026-02-01", token, "")
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusOK || len(body.Series) != 74 || body.Series[72].Value != 1200 {
+		t.Errorf("Expected 74 months with 1200 disbursed in January 2026, got %d %+v", rr.Code, body.Series)
+	}
+}
+
+func TestReportCache(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "reportcache")
+	_, _, otherToken := registerTestLender(t, s, "otherreportcache")
+	loanID := seedLoan(t, s, lenderID, "active", 2000, 10, 12)
+
+	// Test case 1: The cache is off unless configured, and then no Cache-Status is sent
+	rr := doRequest(t, s, "GET", "/api/reports/portfolio", token, "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Status") != "" {
+		t.Fatalf("Expected an uncached report, got %d with Cache-Status %q", rr.Code, rr.Header().Get("Cache-Status"))
+	}
+
+	// Test case 2: A repeated request is served from the cache, per lender and parameters
+	s.reportCache = reports.NewCache(time.Minute)
+	portfolio := func(token, query string) (reports.Portfolio, string) {
+		t.Helper()
+		rr := doRequest(t, s, "GET", "/api/reports/portfolio"+query, token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var summary reports.Portfolio
+		json.Unmarshal(rr.Body.Bytes(), &summary)
+		return summary, rr.Header().Get("Cache-Status")
+	}
+	if _, status := portfolio(token, ""); status != "miss" {
+		t.Errorf("Expected a miss, got %q", status)
+	}
+	if summary, status := portfolio(token, ""); status != "hit" || summary.Outstanding.Principal != 2000 {
+		t.Errorf("Expected a hit with 2000 outstanding, got %q and %+v", status, summary.Outstanding)
+	}
+	if _, status := portfolio(otherToken, ""); status != "miss" {
+		t.Errorf("Expected another lender to miss, got %q", status)
+	}
+	if _, status := portfolio(token, "?as_of=2020-01-01"); status != "miss" {
+		t.Errorf("Expected other parameters to miss, got %q", status)
+	}
+
+	// Test case 3: Recording a receipt invalidates the lender's reports
+	rr = doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/receipts", loanID), token, `{"status": "paid", "amount": 500}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if summary, status := portfolio(token, ""); status != "miss" || summary.Outstanding.Principal != 1500 {
+		t.Errorf("Expected a fresh report with 1500 outstanding, got %q and %+v", status, summary.Outstanding)
+	}
+	if _, status := portfolio(otherToken, ""); status != "hit" {
+		t.Errorf("Expected the other lender to stay cached, got %q", status)
+	}
+
+	// Test case 4: Changing a loan invalidates them too
+	if rr := doRequest(t, s, "POST", fmt.Sprintf("/api/loans/%d/paid", loanID), token, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if summary, status := portfolio(token, ""); status != "miss" || summary.Outstanding.Principal != 0 {
+		t.Errorf("Expected a fresh report with nothing outstanding, got %q and %+v", status, summary.Outstanding)
+	}
+
+	// Test case 5: Other reports are cached under their own keys
+	rr = doRequest(t, s, "GET", "/api/stats/exposure", token, "")
+	if rr.Header().Get("Cache-Status") != "miss" {
+		t.Errorf("Expected the exposure report to miss, got %q", rr.Header().Get("Cache-Status"))
+	}
+	rr = doRequest(t, s, "GET", "/api/stats/exposure", token, "")
+	if rr.Header().Get("Cache-Status") != "hit" {
+		t.Errorf("Expected the exposure report to hit, got %q", rr.Header().Get("Cache-Status"))
+	}
+}
+
+func TestQueryReport(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "querier")
+	_, otherID, _ := registerTestLender(t, s, "otherquerier")
+	seedLoan(t, s, lenderID, "active", 1000, 10, 12)
+	seedLoan(t, s, lenderID, "active", 400, 10, 12)
+	seedLoan(t, s, lenderID, "paid", 200, 10, 6)
+	seedLoan(t, s, otherID, "active", 9000, 10, 12)
+
+	// Test case 1: Rows are grouped and scoped to the caller, with the spec echoed
+	rr := doRequest(t, s, "POST", "/api/reports/query", token,
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "gte", "value": 300}], "group_by": ["status"], "aggregates": [{"func": "count"}, {"func": "sum", "field": "amount"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result reports.QueryResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if len(result.Rows) != 1 || result.Rows[0][0] != "active" || result.Rows[0][1] != 2.0 || result.Rows[0][2] != 1400.0 {
+		t.Errorf("Expected the caller's two active loans, got %v", result.Rows)
+	}
+	if result.Spec.Entity != "loans" || len(result.Spec.Filters) != 1 || result.Spec.GroupBy[0] != "status" {
+		t.Errorf("Expected the spec echoed, got %+v", result.Spec)
+	}
+
+	// Test case 2: Names outside the allowlists are rejected with 422
+	for _, body := range []string{
+		`{"entity": "accounts", "aggregates": [{"func": "count"}]}`,
+		`{"entity": "loans", "filters": [{"field": "Lender_ID", "op": "eq", "value": 1}], "aggregates": [{"func": "count"}]}`,
+		`{"entity": "loans", "filters": [{"field": "amount", "op": "OR 1=1 --", "value": 1}], "aggregates": [{"func": "count"}]}`,
+		`{"entity": "loans", "aggregates": [{"func": "sum", "field": "(SELECT Password_Hash FROM Accounts)"}]}`,
+	} {
+		rr := doRequest(t, s, "POST", "/api/reports/query", token, body)
+		if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "invalid_report_query") {
+			t.Errorf("Expected status 422 for %s, got %d: %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 3: A malformed body is a bad request
+	if rr := doRequest(t, s, "POST", "/api/reports/query", token, `{"entity":`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestPaymentMethodReport(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "paymentmethods")
+	loanID := seedLoan(t, s, lenderID, "active", 2000, 10, 12)
+	at := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	for _, r := range []struct {
+		method string
+		amount float64
+	}{{"cash", 100}, {"M-Pesa", 200}, {"mobile_money", 100}, {"left at the office", 100}} {
+		receipt := &models.Receipt{LoanID: loanID, Status: "paid", Amount: r.amount, Timestamp: models.NewJSONTime(at),
+			PaymentMethod: sql.NullString{String: r.method, Valid: true}}
+		if _, err := s.receiptRepo.CreateReceipt(lenderID, receipt); err != nil {
+			t.Fatalf("CreateReceipt failed: %v", err)
+		}
+	}
+
+	// Test case 1: Monthly shares per method, legacy values under other
+	rr := doRequest(t, s, "GET", "/api/reports/payment-methods?from=2026-02-01&to=2026-03-31", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body paymentMethodReportResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Currency != "LSL" || body.Granularity != reports.GranularityMonth || len(body.Periods) != 2 || body.Periods[1].Amount != 500 {
+		t.Fatalf("Expected 500 in March of 2 months in LSL, got %+v", body)
+	}
+	for _, m := range body.Totals.Methods {
+		want := map[string]float64{reports.PaymentMethodCash: 20, reports.PaymentMethodMobileMoney: 60, reports.PaymentMethodOther: 20}[m.Method]
+		if m.SharePct != want {
+			t.Errorf("Expected %s to be %v%% of the total, got %+v", m.Method, want, m)
+		}
+	}
+
+	// Test case 2: CSV lists each method per period, then the totals
+	rr = doRequest(t, s, "GET", "/api/reports/payment-methods?from=2026-03-01&to=2026-03-31&format=csv", token, "")
+	if ct := rr.Header().Get("Content-Type"); rr.Code != http.StatusOK || !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV, got %d %s", rr.Code, ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 1+2*len(reports.PaymentMethods) || !strings.HasPrefix(lines[2], "2026-03,mobile_money,300.00,2,60") ||
+		!strings.HasPrefix(lines[len(lines)-1], "total,other,100.00,1,20") {
+		t.Errorf("Unexpected CSV: %s", rr.Body.String())
+	}
+
+	// Test case 3: Invalid granularities and ranges are rejected
+	for _, query := range []string{"granularity=year", "from=2026-03-10&to=2026-03-01"} {
+		if rr := doRequest(t, s, "GET", "/api/reports/payment-methods?"+query, token, ""); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %q, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// subscriptionState is a lender's subscription together with its computed trial and grace state
+type subscriptionState struct {
+	*models.Subscription
+	Active             bool     `json:"active"`
+	TrialExpired       bool     `json:"trial_expired"`
+	TrialDaysRemaining int      `json:"trial_days_remaining"`
+	ExpiresInDays      *int     `json:"expires_in_days"` // Days until End_Date while active; null otherwise
+	InGracePeriod      bool     `json:"in_grace_period"`
+	GraceDaysRemaining int      `json:"grace_days_remaining"`
+	Warnings           []string `json:"warnings,omitempty"`
+}
+
+// newSubscriptionState computes whether a subscription is usable at the given time.
+// A paid subscription that ran out by reaching its End_Date stays usable for graceDays
+// afterwards; trials and suspended or cancelled subscriptions get no grace.
+func newSubscriptionState(sub *models.Subscription, now time.Time, graceDays int) *subscriptionState {
+	state := &subscriptionState{Subscription: sub}
+
+	lapsed := sub.EndDate.Valid && !now.Before(sub.EndDate.Time)
+	state.Active = sub.Status == "active" && !lapsed
+	if state.Active && sub.EndDate.Valid {
+		days := daysUntil(now, sub.EndDate.Time)
+		state.ExpiresInDays = &days
+	}
+
+	if sub.IsTrial {
+		state.TrialExpired = !state.Active
+		if state.Active && sub.EndDate.Valid {
+			state.TrialDaysRemaining = daysUntil(now, sub.EndDate.Time)
+		}
+		return state
+	}
+
+	endedByDate := sub.Status == "expired" || (sub.Status == "active" && lapsed)
+	if !state.Active && endedByDate && sub.EndDate.Valid && graceDays > 0 {
+		graceEnd := sub.EndDate.Time.AddDate(0, 0, graceDays)
+		if now.Before(graceEnd) {
+			state.InGracePeriod = true
+			state.GraceDaysRemaining = daysUntil(now, graceEnd)
+			state.Warnings = append(state.Warnings, fmt.Sprintf("your subscription has expired; access ends in %d day(s) unless you renew", state.GraceDaysRemaining))
+		}
+	}
+	return state
+}
+
+// daysUntil returns the whole days left until t, counting a partial day as one
+func daysUntil(now, t time.Time) int {
+	return int(math.Ceil(t.Sub(now).Hours() / 24))
+}
+
+// loadSubscriptionState returns the lender's subscription state, or nil if the lender has never subscribed
+func (s *Server) loadSubscriptionState(ctx context.Context, lenderID int) (*subscriptionState, error) {
+	sub, err := s.ledgerRepo.GetCurrentSubscription(ctx, lenderID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return newSubscriptionState(sub, time.Now(), s.Cfg.SubscriptionGraceDays), nil
+}
+
+// getCurrentSubscription returns the authenticated lender's current subscription
+func (s *Server) getCurrentSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	sub, err := s.ledgerRepo.GetCurrentSubscription(r.Context(), int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSubscriptionState(sub, time.Now(), s.Cfg.SubscriptionGraceDays))
+}
+
+// getSubscriptionFeatures returns the feature flags and limits of the lender's current plan
+func (s *Server) getSubscriptionFeatures(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+
+	features, err := s.features.Get(int(claims.LenderID))
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, features)
+}
+
+// usageCount is how much of one plan limit a lender uses. Limit and Remaining are null when the
+// plan leaves it unlimited.
+type usageCount struct {
+	Used      int  `json:"used"`
+	Limit     *int `json:"limit"`
+	Remaining *int `json:"remaining"`
+}
+
+// newUsageCount reports used against limit, where a zero limit means unlimited
+func newUsageCount(used, limit int) usageCount {
+	count := usageCount{Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		count.Limit = &limit
+		count.Remaining = &remaining
+	}
+	return count
+}
+
+// subscriptionUsage is the lender's current plan, its limits and how much of them is used
+type subscriptionUsage struct {
+	PlanID  int                 `json:"plan_id"`
+	Plan    string              `json:"plan"`
+	Status  string              `json:"status"`
+	IsTrial bool                `json:"is_trial"`
+	Active  bool                `json:"active"`
+	EndDate models.NullTime     `json:"end_date"`
+	Limits  models.PlanFeatures `json:"limits"`
+	Usage   struct {
+		Users       usageCount `json:"users"`
+		ActiveLoans usageCount `json:"active_loans"`
+		Borrowers   usageCount `json:"borrowers"`
+	} `json:"usage"`
+}
+
+// getSubscription returns the authenticated lender's current plan and limits with current usage
+func (s *Server) getSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	sub, err := s.ledgerRepo.GetCurrentSubscription(r.Context(), lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	limits, err := s.features.Get(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	usage, err := s.lenderRepo.GetUsage(lenderID)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	state := newSubscriptionState(sub, time.Now(), s.Cfg.SubscriptionGraceDays)
+	resp := subscriptionUsage{
+		PlanID:  sub.PlanID,
+		Plan:    sub.PlanName,
+		Status:  sub.Status,
+		IsTrial: sub.IsTrial,
+		Active:  state.Active,
+		EndDate: sub.EndDate,
+		Limits:  limits,
+	}
+	resp.Usage.Users = newUsageCount(usage.Users, limits.MaxUsers)
+	resp.Usage.ActiveLoans = newUsageCount(usage.ActiveLoans, limits.MaxActiveLoans)
+	resp.Usage.Borrowers = newUsageCount(usage.Borrowers, limits.MaxBorrowers)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// cancelSubscription cancels the caller's active subscription without deleting the account. The
+// lender is moved to the free plan when one is offered, and otherwise left without an active
+// subscription. It returns the subscription the lender is left on.
+func (s *Server) cancelSubscription(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r.Context())
+	lenderID := int(claims.LenderID)
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	actor := fmt.Sprintf("account:%d", claims.AccountID)
+	sub, err := s.subscriptions.Cancel(r.Context(), lenderID, actor, req.Reason)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+	s.auditor.Record(r.Context(), audit.Event{
+		LenderID:     lenderID,
+		Action:       models.AuditSubscriptionCancelled,
+		ResourceType: "lender",
+		ResourceID:   lenderID,
+		Details:      map[string]string{"reason": req.Reason},
+	})
+	writeJSON(w, http.StatusOK, newSubscriptionState(sub, time.Now(), s.Cfg.SubscriptionGraceDays))
+}
@@ -0,0 +1,401 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+// seedTrialPlan inserts an active trial plan with the given length.
+func seedTrialPlan(t *testing.T, s *Server, trialDays int) {
+	if _, err := s.DB.Exec("INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days) VALUES ('Trial', 0, 1, ?)", trialDays); err != nil {
+		t.Fatalf("Failed to seed trial plan: %v", err)
+	}
+}
+
+// expireAllSubscriptions moves every active ledger row to expired.
+func expireAllSubscriptions(t *testing.T, s *Server) {
+	due, err := s.ledgerRepo.ListDueForExpiry(context.Background(), time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("ListDueForExpiry failed: %v", err)
+	}
+	for _, ledger := range due {
+		if err := s.ledgerRepo.TransitionStatus(context.Background(), ledger.LedgerID, ledger.Status, "expired", "system", ""); err != nil {
+			t.Fatalf("TransitionStatus failed: %v", err)
+		}
+	}
+}
+
+func TestGetCurrentSubscription_Trial(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, _, token := registerTestLender(t, s, "trialer")
+
+	rr := doRequest(t, s, "GET", "/api/subscriptions/current", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var body subscriptionState
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !body.IsTrial || !body.Active || body.TrialExpired {
+		t.Errorf("Expected an active trial, got %+v", body)
+	}
+	if body.TrialDaysRemaining != 14 {
+		t.Errorf("Expected 14 trial days remaining, got %d", body.TrialDaysRemaining)
+	}
+	if body.ExpiresInDays == nil || *body.ExpiresInDays != 14 {
+		t.Errorf("Expected expires_in_days 14, got %v", body.ExpiresInDays)
+	}
+}
+
+func TestGetCurrentSubscription_RequiresAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := doRequest(t, s, "GET", "/api/subscriptions/current", "", "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestMe_IncludesTrialState(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+	_, lenderID, token := registerTestLender(t, s, "meuser")
+
+	rr := doRequest(t, s, "GET", "/api/auth/me", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var body struct {
+		Lender struct {
+			LenderID int `json:"lender_id"`
+		} `json:"lender"`
+		Subscription struct {
+			IsTrial      bool `json:"is_trial"`
+			TrialExpired bool `json:"trial_expired"`
+		} `json:"subscription"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Lender.LenderID != lenderID {
+		t.Errorf("Expected lender %d, got %d", lenderID, body.Lender.LenderID)
+	}
+	if !body.Subscription.IsTrial || body.Subscription.TrialExpired {
+		t.Errorf("Expected an unexpired trial, got %+v", body.Subscription)
+	}
+}
+
+func TestRequireActiveSubscription(t *testing.T) {
+	s := newTestServer(t)
+	seedTrialPlan(t, s, 14)
+
+	protected := s.authenticate(s.requireActiveSubscription(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Active trial passes through
+	_, _, token := registerTestLender(t, s, "activetrial")
+	if rr := serve(token); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 for an active trial, got %d", rr.Code)
+	}
+
+	// Test case 2: Expired trial reports trial_expired
+	expireAllSubscriptions(t, s)
+	rr := serve(token)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("Expected status 402 for an expired trial, got %d", rr.Code)
+	}
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if body.Error.Code != "trial_expired" {
+		t.Errorf("Expected code 'trial_expired', got '%s'", body.Error.Code)
+	}
+
+	// Test case 3: Lender with no subscription at all
+	s.DB.Exec("UPDATE Plans SET Is_Active = 0")
+	_, _, token = registerTestLender(t, s, "notrial")
+	rr = serve(token)
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusPaymentRequired || body.Error.Code != "subscription_required" {
+		t.Errorf("Expected 402 subscription_required, got %d %s", rr.Code, body.Error.Code)
+	}
+}
+
+func TestNewSubscriptionState_GracePeriod(t *testing.T) {
+	end := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	paid := func(status string) *models.Subscription {
+		return &models.Subscription{Status: status, EndDate: models.NewNullTime(end)}
+	}
+
+	tests := []struct {
+		name          string
+		sub           *models.Subscription
+		now           time.Time
+		wantActive    bool
+		wantGrace     bool
+		wantDaysLeft  int
+		wantWarnCount int
+	}{
+		{"before expiry", paid("active"), end.Add(-time.Hour), true, false, 0, 0},
+		{"at expiry", paid("active"), end, false, true, 7, 1},
+		{"during grace after job ran", paid("expired"), end.AddDate(0, 0, 6).Add(time.Hour), false, true, 1, 1},
+		{"grace ends", paid("expired"), end.AddDate(0, 0, 7), false, false, 0, 0},
+		{"suspended gets no grace", paid("suspended"), end.Add(time.Hour), false, false, 0, 0},
+		{"trial gets no grace", &models.Subscription{Status: "expired", IsTrial: true, EndDate: models.NewNullTime(end)}, end.Add(time.Hour), false, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newSubscriptionState(tt.sub, tt.now, 7)
+			if state.Active != tt.wantActive || state.InGracePeriod != tt.wantGrace ||
+				state.GraceDaysRemaining != tt.wantDaysLeft || len(state.Warnings) != tt.wantWarnCount {
+				t.Errorf("Got active=%v grace=%v days=%d warnings=%v", state.Active, state.InGracePeriod, state.GraceDaysRemaining, state.Warnings)
+			}
+			if (state.ExpiresInDays != nil) != tt.wantActive {
+				t.Errorf("Expected expires_in_days only while active, got %v", state.ExpiresInDays)
+			}
+		})
+	}
+}
+
+func TestRequireActiveSubscription_GracePeriod(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.SubscriptionGraceDays = 7
+	_, lenderID, token := registerTestLender(t, s, "gracelender")
+	planID := seedPlan(t, s, "Basic", 300)
+	sub, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, planID, "LSL", time.Now().AddDate(0, -1, 0), time.Now().AddDate(0, 0, -2))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	s.ledgerRepo.TransitionStatus(context.Background(), sub.LedgerID, "active", "expired", "system", "")
+
+	// Test case 1: Writes are allowed during grace with a warning header
+	rr := doRequest(t, s, "POST", "/api/loans/bulk-reprice", token, `{"new_rate": 10}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 during grace, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Subscription-Grace-Days-Remaining"); got != "5" {
+		t.Errorf("Expected 5 grace days remaining, got %q", got)
+	}
+	if rr.Header().Get("Warning") == "" {
+		t.Error("Expected a Warning header during grace")
+	}
+
+	// Test case 2: The subscription endpoint surfaces the banner data
+	rr = doRequest(t, s, "GET", "/api/subscriptions/current", token, "")
+	var state subscriptionState
+	json.Unmarshal(rr.Body.Bytes(), &state)
+	if !state.InGracePeriod || state.GraceDaysRemaining != 5 || len(state.Warnings) != 1 {
+		t.Errorf("Unexpected subscription state: %+v", state)
+	}
+
+	// Test case 3: After grace the lender is locked out
+	s.DB.Exec("UPDATE Lender_Ledger SET End_Date = ? WHERE Ledger_ID = ?", time.Now().UTC().AddDate(0, 0, -8), sub.LedgerID)
+	rr = doRequest(t, s, "POST", "/api/loans/bulk-reprice", token, `{"new_rate": 10}`)
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusPaymentRequired || body.Error.Code != "subscription_expired" {
+		t.Errorf("Expected 402 subscription_expired after grace, got %d %s", rr.Code, body.Error.Code)
+	}
+}
+
+func TestSubscriptionFeatures(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "featured")
+	planID := seedPlan(t, s, "Pro", 500)
+	if _, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, planID, "LSL", time.Now(), time.Now().AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+
+	gated := s.authenticate(s.requireFeature(models.FeatureWebhooks)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		gated.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Test case 1: Plans start with no features
+	rr := serve()
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusPaymentRequired || body.Error.Code != "feature_not_available" {
+		t.Errorf("Expected 402 feature_not_available, got %d %s", rr.Code, body.Error.Code)
+	}
+
+	// Test case 2: Enabling the feature invalidates the cached set
+	doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d/features", planID), `{"webhooks": true, "max_active_loans": 50}`)
+	if rr := serve(); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 once the plan has webhooks, got %d", rr.Code)
+	}
+
+	// Test case 3: Lender-facing features endpoint
+	rr = doRequest(t, s, "GET", "/api/subscriptions/features", token, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var features models.PlanFeatures
+	json.Unmarshal(rr.Body.Bytes(), &features)
+	if !features.Webhooks || features.MaxActiveLoans != 50 {
+		t.Errorf("Unexpected features: %+v", features)
+	}
+}
+
+func TestGetSubscription_Usage(t *testing.T) {
+	s := newTestServer(t)
+	planID := seedPlan(t, s, "Basic", 150)
+	doAdminRequest(t, s, "PUT", fmt.Sprintf("/api/admin/plans/%d/features", planID),
+		`{"max_users": 1, "max_active_loans": 3, "max_loan_amount": 50000, "max_loan_months": 24}`)
+
+	_, nearID, nearToken := registerTestLender(t, s, "nearlimit")
+	_, underID, underToken := registerTestLender(t, s, "underlimit")
+	end := time.Now().AddDate(0, 1, 0)
+	for _, lenderID := range []int{nearID, underID} {
+		if _, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, planID, "LSL", time.Now(), end); err != nil {
+			t.Fatalf("CreateSubscription failed: %v", err)
+		}
+	}
+	for range 3 {
+		seedLoan(t, s, nearID, "active", 10000, 5, 12)
+	}
+	seedLoan(t, s, nearID, "paid", 10000, 5, 12)
+	seedLoan(t, s, underID, "active", 10000, 5, 12)
+
+	get := func(token string) subscriptionUsage {
+		t.Helper()
+		rr := doRequest(t, s, "GET", "/api/subscription", token, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp subscriptionUsage
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+	remaining := func(c usageCount) int {
+		if c.Remaining == nil {
+			return -1
+		}
+		return *c.Remaining
+	}
+
+	// Test case 1: A lender at its limits has nothing remaining; paid loans do not count
+	near := get(nearToken)
+	if near.PlanID != planID || near.Plan != "Basic" || !near.Active || !near.EndDate.Valid {
+		t.Errorf("Unexpected subscription: %+v", near)
+	}
+	if near.Limits.MaxLoanAmount != 50000 || near.Limits.MaxLoanMonths != 24 {
+		t.Errorf("Unexpected limits: %+v", near.Limits)
+	}
+	if near.Usage.Users.Used != 1 || remaining(near.Usage.Users) != 0 {
+		t.Errorf("Unexpected user usage: %+v", near.Usage.Users)
+	}
+	if near.Usage.ActiveLoans.Used != 3 || remaining(near.Usage.ActiveLoans) != 0 {
+		t.Errorf("Unexpected active loan usage: %+v", near.Usage.ActiveLoans)
+	}
+	if near.Usage.Borrowers.Used != 4 || near.Usage.Borrowers.Limit != nil || near.Usage.Borrowers.Remaining != nil {
+		t.Errorf("Expected unlimited borrowers with 4 used, got %+v", near.Usage.Borrowers)
+	}
+
+	// Test case 2: A lender under its limits sees what is left, unaffected by the other lender
+	under := get(underToken)
+	if under.Usage.ActiveLoans.Used != 1 || remaining(under.Usage.ActiveLoans) != 2 || *under.Usage.ActiveLoans.Limit != 3 {
+		t.Errorf("Unexpected active loan usage: %+v", under.Usage.ActiveLoans)
+	}
+	if under.Usage.Borrowers.Used != 1 {
+		t.Errorf("Expected 1 borrower, got %d", under.Usage.Borrowers.Used)
+	}
+
+	// Test case 3: Lenders that never subscribed get 404
+	_, _, noneToken := registerTestLender(t, s, "unsubscribed")
+	if rr := doRequest(t, s, "GET", "/api/subscription", noneToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+
+	// Test case 4: Requires authentication
+	if rr := doRequest(t, s, "GET", "/api/subscription", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestCancelSubscription(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, token := registerTestLender(t, s, "canceller") // No trial plan, so it starts unsubscribed
+	res, err := s.DB.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Basic', 150)")
+	if err != nil {
+		t.Fatalf("Failed to seed paid plan: %v", err)
+	}
+	basicID, _ := res.LastInsertId()
+	now := time.Now()
+	paid, err := s.ledgerRepo.CreateSubscription(context.Background(), lenderID, int(basicID), "LSL", now.AddDate(0, 0, -5), now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	if _, err := s.DB.Exec("INSERT INTO Plans (Plan, Price) VALUES ('Free', 0)"); err != nil {
+		t.Fatalf("Failed to seed free plan: %v", err)
+	}
+
+	// Test case 1: Cancelling deactivates the paid plan and activates the free one
+	rr := doRequest(t, s, "POST", "/api/subscription/cancel", token, `{"reason": "too expensive"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var state subscriptionState
+	json.Unmarshal(rr.Body.Bytes(), &state)
+	if state.Subscription == nil || state.PlanName != "Free" || state.Status != "active" || !state.Active || state.EndDate.Valid {
+		t.Errorf("Expected an open-ended active free plan, got %s", rr.Body.String())
+	}
+	ledger, _ := s.ledgerRepo.GetLedgerByID(context.Background(), paid.LedgerID)
+	if ledger.Status != "inactive" {
+		t.Errorf("Expected the paid plan inactive, got %s", ledger.Status)
+	}
+	var audited int
+	s.DB.QueryRow("SELECT COUNT(*) FROM Audit_Log WHERE Lender_ID = ? AND Action = ?", lenderID, models.AuditSubscriptionCancelled).Scan(&audited)
+	if audited != 1 {
+		t.Errorf("Expected the cancellation audited in its transaction, got %d entries", audited)
+	}
+
+	// Test case 2: The free plan keeps basic access
+	if rr := doRequest(t, s, "DELETE", "/api/lenders/me/report-subscription", token, ""); rr.Code == http.StatusPaymentRequired {
+		t.Errorf("Expected access on the free plan, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 3: The free plan itself cannot be cancelled
+	rr = doRequest(t, s, "POST", "/api/subscription/cancel", token, "")
+	var body errorResponse
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if rr.Code != http.StatusConflict || body.Error.Code != "already_on_free_plan" {
+		t.Errorf("Expected 409 already_on_free_plan, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Test case 4: Without a free plan the lender is left without an active subscription
+	s.DB.Exec("UPDATE Plans SET Is_Active = 0 WHERE Plan = 'Free'")
+	_, otherLenderID, otherToken := registerTestLender(t, s, "othercanceller")
+	s.ledgerRepo.CreateSubscription(context.Background(), otherLenderID, int(basicID), "LSL", now.AddDate(0, 0, -5), now.AddDate(0, 1, 0))
+	if rr := doRequest(t, s, "POST", "/api/subscription/cancel", otherToken, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doRequest(t, s, "DELETE", "/api/lenders/me/report-subscription", otherToken, ""); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("Expected 402 once cancelled, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
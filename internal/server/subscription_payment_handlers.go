@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"wisetech-lms-api/internal/audit"
+	"wisetech-lms-api/internal/httperr"
+	"wisetech-lms-api/internal/models"
+)
+
+// recordSubscriptionPaymentRequest is the body accepted when recording a subscription payment
+type recordSubscriptionPaymentRequest struct {
+	LedgerID   int              `json:"ledger_id"`
+	Amount     float64          `json:"amount"`
+	Currency   string           `json:"currency"`
+	Method     string           `json:"method"`
+	Reference  string           `json:"reference"`
+	PaidAt     *models.JSONTime `json:"paid_at"`
+	Months     int              `json:"months"`
+	RecordedBy string           `json:"recorded_by"`
+}
+
+// subscriptionPaymentsResponse lists payments with per-currency totals for revenue reporting
+type subscriptionPaymentsResponse struct {
+	Payments []models.SubscriptionPayment `json:"payments"`
+	Totals   map[string]float64           `json:"totals"`
+}
+
+// recordSubscriptionPayment records a payment made to us by a lender and renews the subscription.
+// Re-posting an existing reference returns the original payment with 200 instead of 201.
+func (s *Server) recordSubscriptionPayment(w http.ResponseWriter, r *http.Request) {
+	var req recordSubscriptionPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeServiceError(w, r, httperr.BadRequest("invalid request body"))
+		return
+	}
+
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Method = strings.TrimSpace(req.Method)
+	switch {
+	case req.LedgerID <= 0:
+		s.writeServiceError(w, r, httperr.Validation("ledger_id is required"))
+		return
+	case req.Amount <= 0:
+		s.writeServiceError(w, r, httperr.Validation("amount must be greater than zero"))
+		return
+	case !currencyCodePattern.MatchString(req.Currency):
+		s.writeServiceError(w, r, httperr.Validation("currency must be a three-letter code"))
+		return
+	case req.Method == "":
+		s.writeServiceError(w, r, httperr.Validation("method is required"))
+		return
+	case req.Reference == "":
+		s.writeServiceError(w, r, httperr.Validation("reference is required"))
+		return
+	case req.Months < 0 || req.Months > 36:
+		s.writeServiceError(w, r, httperr.Validation("months must be between 1 and 36"))
+		return
+	}
+	if req.Months == 0 {
+		req.Months = 1
+	}
+	if req.RecordedBy == "" {
+		req.RecordedBy = "admin"
+	}
+	paidAt := time.Now()
+	if req.PaidAt != nil {
+		paidAt = req.PaidAt.Time
+	}
+
+	payment, created, err := s.subscriptionPaymentRepo.RecordPayment(&models.SubscriptionPayment{
+		LedgerID:   req.LedgerID,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		Method:     req.Method,
+		Reference:  req.Reference,
+		PaidAt:     models.NewJSONTime(paidAt),
+		RecordedBy: req.RecordedBy,
+	}, req.Months)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		event := audit.Event{
+			Actor:        req.RecordedBy,
+			Action:       models.AuditSubscriptionPaymentRecorded,
+			ResourceType: "subscription_payment",
+			ResourceID:   payment.PaymentID,
+			Details:      map[string]int{"months": req.Months},
+		}
+		if ledger, err := s.ledgerRepo.GetLedgerByID(r.Context(), payment.LedgerID); err == nil {
+			event.LenderID = ledger.LenderID
+			s.features.Invalidate(ledger.LenderID)
+		}
+		s.auditor.Record(r.Context(), event)
+	}
+	writeJSON(w, status, payment)
+}
+
+// listSubscriptionPayments returns payments in an optional from/to date range with per-currency totals.
+// Payments span every lender, so dates run midnight to midnight UTC.
+func (s *Server) listSubscriptionPayments(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r.URL.Query(), "from", "to", time.UTC)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	payments, err := s.subscriptionPaymentRepo.ListPayments(from, to)
+	if err != nil {
+		s.writeServiceError(w, r, err)
+		return
+	}
+
+	response := subscriptionPaymentsResponse{
+		Payments: make([]models.SubscriptionPayment, 0, len(payments)),
+		Totals:   make(map[string]float64),
+	}
+	for _, payment := range payments {
+		response.Payments = append(response.Payments, payment)
+		response.Totals[payment.Currency] += payment.Amount
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+)
+
+func TestRecordSubscriptionPayment(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "payinglender")
+	planID := seedPlan(t, s, "Basic", 300)
+	start := time.Now().UTC()
+	sub, err := s.ledgerRepo.CreateSubscription(context.Background(), int(lenderID), planID, "LSL", start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	body := fmt.Sprintf(`{"ledger_id": %d, "amount": 300, "currency": "LSL", "method": "bank_transfer", "reference": "EFT-100"}`, sub.LedgerID)
+
+	// Test case 1: Admin key is required
+	rr := doRequest(t, s, "POST", "/api/admin/subscription-payments", "", body)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without admin key, got %d", rr.Code)
+	}
+
+	// Test case 2: First delivery creates the payment
+	rr = doAdminRequest(t, s, "POST", "/api/admin/subscription-payments", body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var payment models.SubscriptionPayment
+	json.Unmarshal(rr.Body.Bytes(), &payment)
+	if payment.LedgerID != sub.LedgerID || payment.RecordedBy != "admin" {
+		t.Errorf("Unexpected payment: %+v", payment)
+	}
+
+	// Test case 3: Re-posting the same reference is idempotent
+	rr = doAdminRequest(t, s, "POST", "/api/admin/subscription-payments", body)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a duplicate reference, got %d", rr.Code)
+	}
+
+	// Test case 4: Validation
+	rr = doAdminRequest(t, s, "POST", "/api/admin/subscription-payments",
+		fmt.Sprintf(`{"ledger_id": %d, "amount": 0, "currency": "LSL", "method": "cash", "reference": "EFT-101"}`, sub.LedgerID))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a zero amount, got %d", rr.Code)
+	}
+
+	// Test case 5: Unknown ledger row
+	rr = doAdminRequest(t, s, "POST", "/api/admin/subscription-payments",
+		`{"ledger_id": 9999, "amount": 300, "currency": "LSL", "method": "cash", "reference": "EFT-102"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown ledger, got %d", rr.Code)
+	}
+}
+
+func TestListSubscriptionPayments(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "reportlender")
+	planID := seedPlan(t, s, "Basic", 300)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	sub, err := s.ledgerRepo.CreateSubscription(context.Background(), int(lenderID), planID, "LSL", start, start.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("CreateSubscription failed: %v", err)
+	}
+	for i, currency := range []string{"LSL", "LSL", "ZAR"} {
+		body := fmt.Sprintf(`{"ledger_id": %d, "amount": 100, "currency": %q, "method": "cash", "reference": "REF-%d", "paid_at": %q}`,
+			sub.LedgerID, currency, i, start.AddDate(0, 0, i*10).Format(time.RFC3339))
+		if rr := doAdminRequest(t, s, "POST", "/api/admin/subscription-payments", body); rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to record payment: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Test case 1: Totals per currency across all payments
+	rr := doAdminRequest(t, s, "GET", "/api/admin/subscription-payments", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var all subscriptionPaymentsResponse
+	json.Unmarshal(rr.Body.Bytes(), &all)
+	if len(all.Payments) != 3 || all.Totals["LSL"] != 200 || all.Totals["ZAR"] != 100 {
+		t.Errorf("Unexpected report: %+v", all)
+	}
+
+	// Test case 2: A date-only to includes the whole day
+	rr = doAdminRequest(t, s, "GET", "/api/admin/subscription-payments?from=2026-03-05&to=2026-03-11", "")
+	var ranged subscriptionPaymentsResponse
+	json.Unmarshal(rr.Body.Bytes(), &ranged)
+	if len(ranged.Payments) != 1 || ranged.Payments[0].Reference != "REF-1" {
+		t.Errorf("Expected only REF-1, got %+v", ranged.Payments)
+	}
+
+	// Test case 3: Invalid date
+	rr = doAdminRequest(t, s, "GET", "/api/admin/subscription-payments?from=March", "")
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an invalid date, got %d", rr.Code)
+	}
+}
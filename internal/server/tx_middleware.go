@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+
+	"wisetech-lms-api/internal/repository"
+)
+
+// bufferedResponse holds a handler's response until its transaction has been resolved
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// transactional runs the handler inside a database transaction carried by the request context
+// (see repository.ContextWithTx). The transaction commits when the handler responds 2xx and rolls
+// back otherwise. The response is held until then, so a failed commit is reported as an error
+// instead of a success the database does not reflect. Functions registered with
+// repository.AfterCommit run once the commit succeeds.
+//
+// Only use repositories that read the transaction from the context inside such handlers: a
+// repository using the pool directly runs outside the transaction and may wait on its locks.
+func (s *Server) transactional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, err := s.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		defer tx.Rollback() // Rollback on error, panic or a non-2xx response
+
+		ctx := repository.ContextWithTx(r.Context(), tx)
+		buf := &bufferedResponse{header: make(http.Header)}
+		next.ServeHTTP(buf, r.WithContext(ctx))
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+
+		if buf.status >= 200 && buf.status < 300 {
+			if err := tx.Commit(); err != nil {
+				s.writeServiceError(w, r, err)
+				return
+			}
+			repository.RunAfterCommit(ctx)
+		}
+
+		for key, values := range buf.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+	})
+}
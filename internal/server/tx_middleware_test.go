@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/repository"
+)
+
+// subscribeAndPrice creates a subscription and then writes a plan price, both through the
+// request transaction. A negative price violates the Plan_Prices CHECK constraint.
+func subscribeAndPrice(s *Server, lenderID, planID int, amount float64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		now := time.Now()
+		if _, err := s.ledgerRepo.CreateSubscription(ctx, lenderID, planID, "LSL", now, now.AddDate(0, 1, 0)); err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		_, err := repository.Conn(ctx, s.DB).ExecContext(ctx, "INSERT INTO Plan_Prices (Plan_ID, Currency, Amount) VALUES (?, 'USD', ?)", planID, amount)
+		if err != nil {
+			s.writeServiceError(w, r, err)
+			return
+		}
+		w.Header().Set("X-Subscribed", "yes")
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "subscribed"})
+	})
+}
+
+func TestTransactional(t *testing.T) {
+	s := newTestServer(t)
+	_, lenderID, _ := registerTestLender(t, s, "atomic")
+	planID := seedPlan(t, s, "Basic", 100)
+
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		s.transactional(h).ServeHTTP(rr, httptest.NewRequest("POST", "/", nil))
+		return rr
+	}
+	countPrices := func() int {
+		var n int
+		s.DB.QueryRow("SELECT COUNT(*) FROM Plan_Prices WHERE Currency = 'USD'").Scan(&n)
+		return n
+	}
+
+	// Test case 1: The second write fails, so the first is rolled back with it
+	rr := serve(subscribeAndPrice(s, lenderID, planID, -1))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := s.ledgerRepo.GetCurrentSubscription(context.Background(), lenderID); !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		t.Errorf("Expected the subscription to be rolled back, got %v", err)
+	}
+	if n := countPrices(); n != 0 {
+		t.Errorf("Expected no USD price, got %d", n)
+	}
+
+	// Test case 2: A 2xx response commits both writes and is passed through unchanged
+	rr = serve(subscribeAndPrice(s, lenderID, planID, 25))
+	if rr.Code != http.StatusCreated || rr.Header().Get("X-Subscribed") != "yes" || rr.Body.String() == "" {
+		t.Fatalf("Expected the handler's 201 response, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if _, err := s.ledgerRepo.GetCurrentSubscription(context.Background(), lenderID); err != nil {
+		t.Errorf("Expected the subscription to be committed, got %v", err)
+	}
+	if n := countPrices(); n != 1 {
+		t.Errorf("Expected 1 USD price, got %d", n)
+	}
+
+	// Test case 3: A client error rolls back writes made before it
+	rr = serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repository.Conn(r.Context(), s.DB).ExecContext(r.Context(), "DELETE FROM Plan_Prices WHERE Currency = 'USD'")
+		writeError(w, http.StatusUnprocessableEntity, "validation_error", "rejected")
+	}))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+	if n := countPrices(); n != 1 {
+		t.Errorf("Expected the delete to be rolled back, got %d USD prices", n)
+	}
+
+	// Test case 4: After-commit functions run only when the transaction commits
+	ran := 0
+	afterCommit := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			repository.AfterCommit(r.Context(), func() { ran++ })
+			if ran != 0 {
+				t.Error("Expected the function deferred until the commit")
+			}
+			w.WriteHeader(status)
+		})
+	}
+	serve(afterCommit(http.StatusConflict))
+	if ran != 0 {
+		t.Errorf("Expected nothing run after a rollback, got %d", ran)
+	}
+	serve(afterCommit(http.StatusOK))
+	if ran != 1 {
+		t.Errorf("Expected the function run once after the commit, got %d", ran)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// Backends holds every configured FileStore by backend name. New files are written to the
+// default backend; existing files are read from the backend recorded on their File row, so
+// files can move between backends gradually. Backends itself is a FileStore for the default.
+type Backends struct {
+	Default string
+	stores  map[string]FileStore
+}
+
+// NewBackends creates a new Backends writing to defaultName, which must be one of stores.
+func NewBackends(defaultName string, stores map[string]FileStore) (*Backends, error) {
+	if _, ok := stores[defaultName]; !ok {
+		return nil, fmt.Errorf("storage backend %q is not configured", defaultName)
+	}
+	return &Backends{Default: defaultName, stores: stores}, nil
+}
+
+// For returns the store of the named backend. An empty name means the local disk, where files
+// were stored before backends were recorded.
+func (b *Backends) For(name string) (FileStore, error) {
+	if name == "" {
+		name = BackendLocal
+	}
+	store, ok := b.stores[name]
+	if !ok {
+		return nil, fmt.Errorf("storage backend %q is not configured", name)
+	}
+	return store, nil
+}
+
+// Names returns the names of every configured backend, sorted.
+func (b *Backends) Names() []string {
+	return slices.Sorted(maps.Keys(b.stores))
+}
+
+// Probe checks that the default backend, where new files are written, is available.
+func (b *Backends) Probe(ctx context.Context) error {
+	return Probe(ctx, b.stores[b.Default])
+}
+
+// Save writes to the default backend.
+func (b *Backends) Save(ctx context.Context, key string, r io.Reader) error {
+	return b.stores[b.Default].Save(ctx, key, r)
+}
+
+// Open reads from the default backend.
+func (b *Backends) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return b.stores[b.Default].Open(ctx, key)
+}
+
+// Delete removes from the default backend.
+func (b *Backends) Delete(ctx context.Context, key string) error {
+	return b.stores[b.Default].Delete(ctx, key)
+}
+
+// URL returns a URL on the default backend.
+func (b *Backends) URL(ctx context.Context, key string) (string, error) {
+	return b.stores[b.Default].URL(ctx, key)
+}
+
+// List lists the default backend.
+func (b *Backends) List(ctx context.Context, prefix string) ([]string, error) {
+	return b.stores[b.Default].List(ctx, prefix)
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDisk(t *testing.T) {
+	ctx := context.Background()
+	store := NewDisk(t.TempDir())
+
+	// Test case 1: Save and read back
+	if err := store.Save(ctx, "lenders/1/logo.png", strings.NewReader("image bytes")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	f, err := store.Open(ctx, "lenders/1/logo.png")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "image bytes" {
+		t.Errorf("Expected stored contents, got %q", data)
+	}
+
+	// Test case 2: Delete is idempotent and Open reports ErrNotFound afterwards
+	if err := store.Delete(ctx, "lenders/1/logo.png"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "lenders/1/logo.png"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+	}
+	if _, err := store.Open(ctx, "lenders/1/logo.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Test case 3: Keys cannot escape the root
+	for _, key := range []string{"../outside", "/etc/passwd", ""} {
+		if err := store.Save(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+
+	// Test case 4: List returns keys under the prefix and skips uploads in progress
+	store.Save(ctx, "lenders/1/logo.png", strings.NewReader("image bytes"))
+	store.Save(ctx, "lenders/2/files/a.pdf", strings.NewReader("pdf"))
+	os.WriteFile(filepath.Join(store.Root, "lenders", "2", "files", ".upload-123"), []byte("partial"), 0o644)
+	keys, err := store.List(ctx, "")
+	slices.Sort(keys)
+	if err != nil || !slices.Equal(keys, []string{"lenders/1/logo.png", "lenders/2/files/a.pdf"}) {
+		t.Errorf("Unexpected keys: %v (%v)", keys, err)
+	}
+	if keys, _ := store.List(ctx, "lenders/2/"); len(keys) != 1 {
+		t.Errorf("Expected 1 key under lenders/2/, got %v", keys)
+	}
+	if keys, err := NewDisk(filepath.Join(t.TempDir(), "missing")).List(ctx, ""); err != nil || len(keys) != 0 {
+		t.Errorf("Expected no keys in a missing root, got %v (%v)", keys, err)
+	}
+
+	// Test case 5: URL points at the file on disk
+	if u, err := store.URL(ctx, "lenders/1/logo.png"); err != nil || !strings.HasPrefix(u, "file:///") || !strings.HasSuffix(u, "/lenders/1/logo.png") {
+		t.Errorf("Expected a file URL, got %q (%v)", u, err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+
+	// Test case 1: A writable store passes and keeps no probe object
+	store := NewDisk(t.TempDir())
+	if err := Probe(ctx, store); err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if keys, _ := store.List(ctx, ""); len(keys) != 0 {
+		t.Errorf("Expected the probe object to be deleted, got %v", keys)
+	}
+
+	// Test case 2: A root that is a regular file cannot be written
+	root := filepath.Join(t.TempDir(), "not-a-directory")
+	if err := os.WriteFile(root, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Probe(ctx, NewDisk(root)); err == nil {
+		t.Error("Expected the probe to fail")
+	}
+}
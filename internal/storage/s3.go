@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultPresignExpiry is how long URLs returned by S3.URL stay valid
+const DefaultPresignExpiry = 15 * time.Minute
+
+// S3 is a FileStore backed by a bucket on an S3-compatible service such as AWS S3 or MinIO.
+// Objects are addressed path-style (endpoint/bucket/key) and requests are signed with
+// Signature Version 4.
+type S3 struct {
+	Endpoint      string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Bucket        string
+	PresignExpiry time.Duration
+	Client        *http.Client
+
+	creds credentials
+	now   func() time.Time
+}
+
+// NewS3 creates a new S3 store for bucket at endpoint.
+func NewS3(endpoint, region, bucket, accessKeyID, secretAccessKey string) *S3 {
+	return &S3{
+		Endpoint:      strings.TrimSuffix(endpoint, "/"),
+		Bucket:        bucket,
+		PresignExpiry: DefaultPresignExpiry,
+		Client:        http.DefaultClient,
+		creds:         credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, Region: region},
+		now:           time.Now,
+	}
+}
+
+// objectURL returns the path-style URL of key
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, fmt.Errorf("invalid storage key %q", key)
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	u.Path = "/" + s.Bucket + "/" + key
+	u.RawPath = canonicalURI(u) // Send the path exactly as it is signed
+	return u, nil
+}
+
+// do signs and sends a request for key
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.send(ctx, method, u, body, size)
+}
+
+// send signs and sends a request for u
+func (s *S3) send(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = unsignedPayload
+	}
+	signRequest(req, s.creds, payloadHash, s.now())
+	return s.Client.Do(req)
+}
+
+// Save uploads the contents of r to key, replacing any existing object. S3 needs the length up
+// front, so the contents are spooled to a temporary file first.
+func (s *S3) Save(ctx context.Context, key string, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, tmp, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", key, resp)
+	}
+	return nil
+}
+
+// Open downloads the object stored under key.
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error("GET", key, resp)
+	}
+}
+
+// Delete removes the object stored under key. Deleting a missing key is not an error.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("DELETE", key, resp)
+	}
+	return nil
+}
+
+// URL returns a presigned GET URL for key, valid for PresignExpiry.
+func (s *S3) URL(ctx context.Context, key string) (string, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	return presignURL(http.MethodGet, u, s.creds, s.now(), s.PresignExpiry), nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response List reads
+type listBucketResult struct {
+	Keys                  []string `xml:"Contents>Key"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List returns every key in the bucket starting with prefix, following ListObjectsV2 pages.
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	u.Path = "/" + s.Bucket
+	u.RawPath = canonicalURI(u)
+
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = canonicalQuery(query)
+
+		resp, err := s.send(ctx, http.MethodGet, u, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("LIST", prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 LIST %s: %w", prefix, err)
+		}
+
+		keys = append(keys, page.Keys...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// s3Error describes an unexpected response, including the start of its error document
+func s3Error(method, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(body)))
+}
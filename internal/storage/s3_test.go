@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory S3-compatible server for a single bucket that checks request signatures.
+type fakeS3 struct {
+	bucket   string
+	creds    credentials
+	pageSize int // Keys per ListObjectsV2 page
+	mu       sync.Mutex
+	objects  map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/"+f.bucket && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r.URL.Query())
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list serves one ListObjectsV2 page in key order, continuing after the key in continuation-token
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	f.mu.Lock()
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.Unlock()
+	slices.Sort(keys)
+
+	page := listBucketResult{Keys: keys}
+	if len(keys) > f.pageSize {
+		page = listBucketResult{Keys: keys[:f.pageSize], IsTruncated: true, NextContinuationToken: keys[f.pageSize-1]}
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listBucketResult
+	}{listBucketResult: page})
+}
+
+// validSignature recomputes the header signature from the request as received
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	at, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil || !strings.HasPrefix(auth, sigV4Algorithm+" Credential="+f.creds.AccessKeyID+"/") {
+		return false
+	}
+	_, signedPart, _ := strings.Cut(auth, "SignedHeaders=")
+	signedHeaders, _, _ := strings.Cut(signedPart, ",")
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method, r.URL.EscapedPath(), canonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(), signedHeaders, r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := credentialScope(at, f.creds.Region)
+	return strings.HasSuffix(auth, "Signature="+sign(f.creds, at, stringToSign(at, scope, canonicalRequest)))
+}
+
+// newFakeS3Store starts a fake S3 server and returns a store pointed at it.
+func newFakeS3Store(t *testing.T) (*S3, *fakeS3) {
+	fake := &fakeS3{
+		bucket:   "uploads",
+		creds:    credentials{AccessKeyID: "minio", SecretAccessKey: "minio-secret", Region: "us-east-1"},
+		pageSize: 1000,
+		objects:  make(map[string][]byte),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewS3(server.URL, "us-east-1", "uploads", "minio", "minio-secret"), fake
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newFakeS3Store(t)
+
+	// Test case 1: Save and read back, including a key that needs escaping
+	for _, key := range []string{"lenders/1/files/abc.pdf", "lenders/1/files/a b+c.pdf"} {
+		if err := store.Save(ctx, key, strings.NewReader("pdf bytes")); err != nil {
+			t.Fatalf("Save %q failed: %v", key, err)
+		}
+		rc, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatalf("Open %q failed: %v", key, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != "pdf bytes" {
+			t.Errorf("Expected stored contents for %q, got %q", key, data)
+		}
+	}
+	if len(fake.objects) != 2 {
+		t.Errorf("Expected 2 objects in the bucket, got %d", len(fake.objects))
+	}
+
+	// Test case 2: Delete is idempotent and Open reports ErrNotFound afterwards
+	if err := store.Delete(ctx, "lenders/1/files/abc.pdf"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "lenders/1/files/abc.pdf"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+	}
+	if _, err := store.Open(ctx, "lenders/1/files/abc.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// Test case 3: Bad credentials are reported, not mistaken for a missing object
+	store.creds.SecretAccessKey = "wrong"
+	if _, err := store.Open(ctx, "lenders/1/files/a b+c.pdf"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a signature error, got %v", err)
+	}
+}
+
+func TestS3_List(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newFakeS3Store(t)
+	fake.pageSize = 2
+	for _, key := range []string{"lenders/1/files/a.pdf", "lenders/1/files/b c.pdf", "lenders/1/logo.png", "lenders/2/files/d.pdf"} {
+		if err := store.Save(ctx, key, strings.NewReader("x")); err != nil {
+			t.Fatalf("Save %q failed: %v", key, err)
+		}
+	}
+
+	// Test case 1: Every page is followed
+	keys, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 4 {
+		t.Errorf("Expected 4 keys, got %v", keys)
+	}
+
+	// Test case 2: Only keys under the prefix
+	keys, err = store.List(ctx, "lenders/1/files/")
+	slices.Sort(keys)
+	if err != nil || !slices.Equal(keys, []string{"lenders/1/files/a.pdf", "lenders/1/files/b c.pdf"}) {
+		t.Errorf("Unexpected keys under the prefix: %v (%v)", keys, err)
+	}
+}
+
+func TestS3_URL(t *testing.T) {
+	store := NewS3("http://minio:9000", "us-east-1", "uploads", "minio", "minio-secret")
+
+	raw, err := store.URL(context.Background(), "lenders/1/files/abc.pdf")
+	if err != nil {
+		t.Fatalf("URL failed: %v", err)
+	}
+	u, _ := url.Parse(raw)
+	if u.Host != "minio:9000" || u.Path != "/uploads/lenders/1/files/abc.pdf" {
+		t.Errorf("Unexpected URL %s", raw)
+	}
+	if u.Query().Get("X-Amz-Expires") != "900" || u.Query().Get("X-Amz-Signature") == "" {
+		t.Errorf("Expected a presigned URL valid for 15 minutes, got %s", raw)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	ctx := context.Background()
+	local := NewDisk(t.TempDir())
+	remote, _ := newFakeS3Store(t)
+
+	if _, err := NewBackends(BackendS3, map[string]FileStore{BackendLocal: local}); err == nil {
+		t.Error("Expected an error for an unconfigured default backend")
+	}
+
+	backends, err := NewBackends(BackendS3, map[string]FileStore{BackendLocal: local, BackendS3: remote})
+	if err != nil {
+		t.Fatalf("NewBackends failed: %v", err)
+	}
+
+	// Test case 1: Writes go to the default backend
+	backends.Save(ctx, "a.txt", strings.NewReader("remote"))
+	if _, err := local.Open(ctx, "a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected nothing on local disk, got %v", err)
+	}
+	if rc, err := remote.Open(ctx, "a.txt"); err != nil {
+		t.Errorf("Expected the file on the remote backend, got %v", err)
+	} else {
+		rc.Close()
+	}
+
+	// Test case 2: Files recorded before backends existed resolve to the local disk
+	store, err := backends.For("")
+	if err != nil || store != local {
+		t.Errorf("Expected the local store for an empty backend, got %v (%v)", store, err)
+	}
+	if _, err := backends.For("gcs"); err == nil {
+		t.Error("Expected an error for an unknown backend")
+	}
+}
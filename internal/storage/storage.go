@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("stored file not found")
+
+// Names of the storage backends, as recorded in File.Storage_Backend
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// FileStore stores uploaded file contents under slash-separated keys. File metadata lives in
+// the File table; the store only holds the bytes.
+type FileStore interface {
+	Save(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL the contents can be fetched from, which may expire
+	URL(ctx context.Context, key string) (string, error)
+	// List returns every stored key starting with prefix, in no particular order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// probePrefix is where Probe writes its short-lived objects
+const probePrefix = "healthcheck/"
+
+// Probe checks that store is available by saving a small object under a unique key and deleting it again.
+func Probe(ctx context.Context, store FileStore) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	key := probePrefix + hex.EncodeToString(suffix)
+	if err := store.Save(ctx, key, strings.NewReader("ok")); err != nil {
+		return fmt.Errorf("write probe: %w", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete probe: %w", err)
+	}
+	return nil
+}
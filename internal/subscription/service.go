@@ -0,0 +1,217 @@
+package subscription
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"wisetech-lms-api/internal/models"
+	"wisetech-lms-api/internal/repository"
+)
+
+// Ledger statuses allowed by the Lender_Ledger CHECK constraint.
+const (
+	StatusActive    = "active"
+	StatusInactive  = "inactive"
+	StatusSuspended = "suspended"
+	StatusExpired   = "expired"
+)
+
+// ActorSystem identifies transitions made by background jobs.
+const ActorSystem = "system"
+
+// ErrIllegalTransition is matched by every TransitionError via errors.Is.
+var ErrIllegalTransition = errors.New("illegal subscription status transition")
+
+// TransitionError reports a status change the subscription lifecycle does not allow.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move subscription from %s to %s", e.From, e.To)
+}
+
+// PublicMessage reports the transition to clients, who see only ErrIllegalTransition's text otherwise.
+func (e *TransitionError) PublicMessage() string {
+	return e.Error()
+}
+
+// Is lets errors.Is(err, ErrIllegalTransition) match any TransitionError.
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// transitions lists the legal status changes. Expired and inactive rows are terminal:
+// renewing creates a new ledger row instead of reviving the old one.
+var transitions = map[string][]string{
+	StatusActive:    {StatusInactive, StatusSuspended, StatusExpired},
+	StatusSuspended: {StatusActive, StatusExpired},
+}
+
+// CanTransition reports whether a ledger row may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Invalidator drops state cached from a lender's subscription, such as its plan's features.
+type Invalidator interface {
+	Invalidate(lenderID int)
+}
+
+// Service owns every change to a Lender_Ledger row's status.
+type Service struct {
+	db      *sql.DB
+	ledgers repository.LedgerRepository
+	lenders repository.LenderRepository
+	now     func() time.Time
+
+	// Features, when set, is invalidated for every lender whose subscription changes.
+	Features Invalidator
+}
+
+// NewService creates a new subscription Service. Changes spanning the lender and its ledger run
+// in one transaction on db, which the repositories join through the context.
+func NewService(db *sql.DB, ledgers repository.LedgerRepository, lenders repository.LenderRepository) *Service {
+	return &Service{db: db, ledgers: ledgers, lenders: lenders, now: time.Now}
+}
+
+// Transition moves a ledger row to a new status, recording the actor and reason.
+// It returns a *TransitionError when the lifecycle does not allow the change.
+func (s *Service) Transition(ctx context.Context, ledgerID int, to, actor, reason string) error {
+	ledger, err := s.ledgers.GetLedgerByID(ctx, ledgerID)
+	if err != nil {
+		return err
+	}
+	if !CanTransition(ledger.Status, to) {
+		return &TransitionError{From: ledger.Status, To: to}
+	}
+	if err := s.ledgers.TransitionStatus(ctx, ledgerID, ledger.Status, to, actor, reason); err != nil {
+		return err
+	}
+	s.invalidate(ledger.LenderID)
+	return nil
+}
+
+// invalidate drops the lender's cached features, if a cache is attached.
+func (s *Service) invalidate(lenderID int) {
+	if s.Features != nil {
+		s.Features.Invalidate(lenderID)
+	}
+}
+
+// Suspend moves an active subscription to suspended.
+func (s *Service) Suspend(ctx context.Context, ledgerID int, actor, reason string) error {
+	return s.Transition(ctx, ledgerID, StatusSuspended, actor, reason)
+}
+
+// Unsuspend restores a suspended subscription to active.
+func (s *Service) Unsuspend(ctx context.Context, ledgerID int, actor, reason string) error {
+	return s.Transition(ctx, ledgerID, StatusActive, actor, reason)
+}
+
+// SuspendLender suspends a lender: its accounts are locked, their tokens revoked and its
+// current subscription, if active, is suspended, all in one transaction.
+func (s *Service) SuspendLender(ctx context.Context, lenderID int, actor, reason string) error {
+	defer s.invalidate(lenderID)
+	return repository.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx := repository.ContextWithTx(ctx, tx)
+		if err := s.lenders.SuspendLender(ctx, lenderID, actor, reason, s.now()); err != nil {
+			return err
+		}
+
+		sub, err := s.ledgers.GetCurrentSubscription(ctx, lenderID)
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if sub.Status != StatusActive {
+			return nil
+		}
+		return s.ledgers.TransitionStatus(ctx, sub.LedgerID, sub.Status, StatusSuspended, actor, reason)
+	})
+}
+
+// UnsuspendLender lifts a lender's suspension and unlocks the accounts it locked, in one
+// transaction. A suspended subscription returns to active, or to expired if its End_Date passed
+// while the lender was suspended.
+func (s *Service) UnsuspendLender(ctx context.Context, lenderID int, actor, reason string) error {
+	defer s.invalidate(lenderID)
+	return repository.WithTx(ctx, s.db, func(tx *sql.Tx) error {
+		ctx := repository.ContextWithTx(ctx, tx)
+		if err := s.lenders.UnsuspendLender(ctx, lenderID); err != nil {
+			return err
+		}
+
+		sub, err := s.ledgers.GetCurrentSubscription(ctx, lenderID)
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if sub.Status != StatusSuspended {
+			return nil
+		}
+		to := StatusActive
+		if sub.EndDate.Valid && !sub.EndDate.Time.After(s.now()) {
+			to = StatusExpired
+		}
+		return s.ledgers.TransitionStatus(ctx, sub.LedgerID, sub.Status, to, actor, reason)
+	})
+}
+
+// Cancel ends the lender's current subscription without deleting the account: an active row moves
+// to inactive and, when a free plan is offered, the lender is started on it to keep basic access.
+// It returns the lender's subscription afterwards. Subscriptions that are not active cannot be
+// cancelled and are reported with a *TransitionError. When ctx carries a transaction, the lender's
+// features are invalidated only once it commits, so the cache is never refilled from, or left
+// disagreeing with, a cancellation that does not persist.
+func (s *Service) Cancel(ctx context.Context, lenderID int, actor, reason string) (*models.Subscription, error) {
+	sub, err := s.ledgers.GetCurrentSubscription(ctx, lenderID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(sub.Status, StatusInactive) {
+		return nil, &TransitionError{From: sub.Status, To: StatusInactive}
+	}
+	cancelled, err := s.ledgers.CancelSubscription(ctx, sub.LedgerID, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+	repository.AfterCommit(ctx, func() { s.invalidate(lenderID) })
+	return cancelled, nil
+}
+
+// ExpireDue expires every active subscription whose End_Date has passed and returns how many were expired.
+// Rows whose status changed since they were listed are skipped.
+func (s *Service) ExpireDue(ctx context.Context) (int, error) {
+	due, err := s.ledgers.ListDueForExpiry(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, ledger := range due {
+		err := s.ledgers.TransitionStatus(ctx, ledger.LedgerID, ledger.Status, StatusExpired, ActorSystem, "end date reached")
+		if errors.Is(err, repository.ErrLedgerStatusChanged) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		s.invalidate(ledger.LenderID)
+		expired++
+	}
+	return expired, nil
+}
@@ -0,0 +1,331 @@
+package subscription
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wisetech-lms-api/internal/database"
+	"wisetech-lms-api/internal/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupService creates a Service over an in-memory database with one lender on a 14 day trial.
+func setupService(t *testing.T) (*Service, repository.LedgerRepository, int) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.InitializeSchema(db); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO Plans (Plan, Price, Is_Trial, Trial_Days) VALUES ('Trial', 0, 1, 14)"); err != nil {
+		t.Fatalf("Failed to seed trial plan: %v", err)
+	}
+	accountID, err := repository.NewAuthRepository(db).CreateLenderAndAccount("Lender", "lender@example.com", "123", "lender", "hash", 5.0, "LSL")
+	if err != nil {
+		t.Fatalf("Failed to seed lender: %v", err)
+	}
+
+	ledgers := repository.NewLedgerRepository(db)
+	var ledgerID int
+	if err := db.QueryRow("SELECT l.Ledger_ID FROM Lender_Ledger l JOIN Accounts a ON a.Lender_ID = l.Lender_ID WHERE a.Account_ID = ?", accountID).Scan(&ledgerID); err != nil {
+		t.Fatalf("Failed to find seeded ledger: %v", err)
+	}
+	return NewService(db, ledgers, repository.NewLenderRepository(db)), ledgers, ledgerID
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusActive, StatusInactive, true},
+		{StatusActive, StatusSuspended, true},
+		{StatusActive, StatusExpired, true},
+		{StatusSuspended, StatusActive, true},
+		{StatusSuspended, StatusExpired, true},
+		{StatusExpired, StatusActive, false},
+		{StatusInactive, StatusActive, false},
+		{StatusActive, StatusActive, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSuspendAndUnsuspend(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+
+	if err := svc.Suspend(context.Background(), ledgerID, "admin:1", "chargeback"); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	if err := svc.Unsuspend(context.Background(), ledgerID, "admin:1", "resolved"); err != nil {
+		t.Fatalf("Unsuspend failed: %v", err)
+	}
+
+	events, err := ledgers.ListEvents(context.Background(), ledgerID)
+	if err != nil {
+		t.Fatalf("ListEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[1].FromStatus != StatusSuspended || events[1].ToStatus != StatusActive || events[1].Reason.String != "resolved" {
+		t.Errorf("Unexpected unsuspend event: %+v", events[1])
+	}
+}
+
+func TestTransition_IllegalFromExpired(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+
+	if err := svc.Transition(context.Background(), ledgerID, StatusExpired, ActorSystem, ""); err != nil {
+		t.Fatalf("Transition to expired failed: %v", err)
+	}
+
+	err := svc.Transition(context.Background(), ledgerID, StatusActive, "admin:1", "revive")
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("Expected ErrIllegalTransition, got %v", err)
+	}
+	var transitionErr *TransitionError
+	if !errors.As(err, &transitionErr) || transitionErr.From != StatusExpired || transitionErr.To != StatusActive {
+		t.Errorf("Expected a TransitionError from expired to active, got %v", err)
+	}
+
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+	if ledger.Status != StatusExpired {
+		t.Errorf("Expected status to remain 'expired', got '%s'", ledger.Status)
+	}
+}
+
+func TestExpireDue(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+
+	// Test case 1: Trial still running
+	n, err := svc.ExpireDue(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireDue failed: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Expected nothing to expire, got %d", n)
+	}
+
+	// Test case 2: After the trial ends the row expires with a system event
+	svc.now = func() time.Time { return time.Now().AddDate(0, 0, 15) }
+	n, err = svc.ExpireDue(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireDue failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 subscription to expire, got %d", n)
+	}
+
+	events, _ := ledgers.ListEvents(context.Background(), ledgerID)
+	if len(events) != 1 || events[0].Actor != ActorSystem || events[0].ToStatus != StatusExpired {
+		t.Errorf("Expected a system expiry event, got %+v", events)
+	}
+}
+
+func TestSuspendLender_Cascade(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+	lenderID := ledger.LenderID
+
+	// Test case 1: Suspending the lender suspends its active subscription
+	if err := svc.SuspendLender(context.Background(), lenderID, "admin", "fraud review"); err != nil {
+		t.Fatalf("SuspendLender failed: %v", err)
+	}
+	ledger, _ = ledgers.GetLedgerByID(context.Background(), ledgerID)
+	if ledger.Status != StatusSuspended {
+		t.Errorf("Expected status 'suspended', got '%s'", ledger.Status)
+	}
+
+	// Test case 2: Suspending twice is rejected
+	if err := svc.SuspendLender(context.Background(), lenderID, "admin", "again"); !errors.Is(err, repository.ErrLenderAlreadySuspended) {
+		t.Errorf("Expected ErrLenderAlreadySuspended, got %v", err)
+	}
+
+	// Test case 3: Unsuspending before End_Date restores the subscription
+	if err := svc.UnsuspendLender(context.Background(), lenderID, "admin", "cleared"); err != nil {
+		t.Fatalf("UnsuspendLender failed: %v", err)
+	}
+	ledger, _ = ledgers.GetLedgerByID(context.Background(), ledgerID)
+	if ledger.Status != StatusActive {
+		t.Errorf("Expected status 'active', got '%s'", ledger.Status)
+	}
+
+	// Test case 4: Unsuspending a lender that is not suspended is rejected
+	if err := svc.UnsuspendLender(context.Background(), lenderID, "admin", "again"); !errors.Is(err, repository.ErrLenderNotSuspended) {
+		t.Errorf("Expected ErrLenderNotSuspended, got %v", err)
+	}
+}
+
+// failingLedgers fails every status transition
+type failingLedgers struct {
+	repository.LedgerRepository
+}
+
+func (failingLedgers) TransitionStatus(ctx context.Context, ledgerID int, from, to, actor, reason string) error {
+	return errors.New("transition failed")
+}
+
+func TestSuspendLender_RollsBackTogether(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+	svc.ledgers = failingLedgers{ledgers}
+
+	// Test case 1: A failed subscription transition leaves the lender unsuspended
+	if err := svc.SuspendLender(context.Background(), ledger.LenderID, "admin", "review"); err == nil {
+		t.Fatal("Expected SuspendLender to fail")
+	}
+	svc.ledgers = ledgers
+	if err := svc.UnsuspendLender(context.Background(), ledger.LenderID, "admin", ""); !errors.Is(err, repository.ErrLenderNotSuspended) {
+		t.Errorf("Expected ErrLenderNotSuspended after the rollback, got %v", err)
+	}
+	ledger, _ = ledgers.GetLedgerByID(context.Background(), ledgerID)
+	if ledger.Status != StatusActive {
+		t.Errorf("Expected status 'active', got '%s'", ledger.Status)
+	}
+}
+
+func TestUnsuspendLender_AfterEndDate(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+
+	if err := svc.SuspendLender(context.Background(), ledger.LenderID, "admin", "fraud review"); err != nil {
+		t.Fatalf("SuspendLender failed: %v", err)
+	}
+
+	// The 14 day trial ends while the lender is suspended
+	svc.now = func() time.Time { return time.Now().AddDate(0, 0, 15) }
+	if err := svc.UnsuspendLender(context.Background(), ledger.LenderID, "admin", "cleared"); err != nil {
+		t.Fatalf("UnsuspendLender failed: %v", err)
+	}
+
+	ledger, _ = ledgers.GetLedgerByID(context.Background(), ledgerID)
+	if ledger.Status != StatusExpired {
+		t.Errorf("Expected status 'expired', got '%s'", ledger.Status)
+	}
+	events, _ := ledgers.ListEvents(context.Background(), ledgerID)
+	if len(events) != 2 || events[1].FromStatus != StatusSuspended || events[1].ToStatus != StatusExpired {
+		t.Errorf("Expected a suspended to expired event, got %+v", events)
+	}
+}
+
+func TestSuspendLender_NotFound(t *testing.T) {
+	svc, _, _ := setupService(t)
+
+	if err := svc.SuspendLender(context.Background(), 999, "admin", "fraud review"); !errors.Is(err, repository.ErrLenderNotFound) {
+		t.Errorf("Expected ErrLenderNotFound, got %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+
+	// Test case 1: The active subscription is deactivated with the lender's event
+	sub, err := svc.Cancel(context.Background(), ledger.LenderID, "account:1", "closing shop")
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if sub.LedgerID != ledgerID || sub.Status != StatusInactive {
+		t.Errorf("Expected the trial left inactive, got %+v", sub)
+	}
+	events, _ := ledgers.ListEvents(context.Background(), ledgerID)
+	if len(events) != 1 || events[0].Actor != "account:1" || events[0].ToStatus != StatusInactive {
+		t.Errorf("Expected a cancellation event, got %+v", events)
+	}
+
+	// Test case 2: A cancelled subscription cannot be cancelled again
+	if _, err := svc.Cancel(context.Background(), ledger.LenderID, "account:1", ""); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Expected ErrIllegalTransition, got %v", err)
+	}
+}
+
+func TestCancel_InvalidatesAfterCommit(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	invalidator := &recordingInvalidator{}
+	svc.Features = invalidator
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+
+	tx, err := svc.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	defer tx.Rollback()
+	ctx := repository.ContextWithTx(context.Background(), tx)
+
+	// Test case 1: A cancellation inside a transaction leaves the cache alone until it commits
+	if _, err := svc.Cancel(ctx, ledger.LenderID, "account:1", ""); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if len(invalidator.lenders) != 0 {
+		t.Fatalf("Expected no invalidation before the commit, got %v", invalidator.lenders)
+	}
+
+	// Test case 2: The features are dropped once the transaction commits
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	repository.RunAfterCommit(ctx)
+	if len(invalidator.lenders) != 1 || invalidator.lenders[0] != ledger.LenderID {
+		t.Errorf("Expected lender %d invalidated after the commit, got %v", ledger.LenderID, invalidator.lenders)
+	}
+}
+
+// recordingInvalidator records the lenders whose cached features were dropped
+type recordingInvalidator struct {
+	lenders []int
+}
+
+func (r *recordingInvalidator) Invalidate(lenderID int) {
+	r.lenders = append(r.lenders, lenderID)
+}
+
+func TestService_InvalidatesFeatures(t *testing.T) {
+	svc, ledgers, ledgerID := setupService(t)
+	invalidator := &recordingInvalidator{}
+	svc.Features = invalidator
+	ledger, _ := ledgers.GetLedgerByID(context.Background(), ledgerID)
+	lenderID := ledger.LenderID
+
+	// Test case 1: Suspending and unsuspending the lender drop its features
+	if err := svc.SuspendLender(context.Background(), lenderID, "admin", "review"); err != nil {
+		t.Fatalf("SuspendLender failed: %v", err)
+	}
+	if err := svc.UnsuspendLender(context.Background(), lenderID, "admin", "cleared"); err != nil {
+		t.Fatalf("UnsuspendLender failed: %v", err)
+	}
+	if len(invalidator.lenders) != 2 || invalidator.lenders[0] != lenderID || invalidator.lenders[1] != lenderID {
+		t.Errorf("Expected two invalidations of lender %d, got %v", lenderID, invalidator.lenders)
+	}
+
+	// Test case 2: So does expiring the subscription
+	invalidator.lenders = nil
+	svc.now = func() time.Time { return time.Now().AddDate(0, 0, 15) }
+	if _, err := svc.ExpireDue(context.Background()); err != nil {
+		t.Fatalf("ExpireDue failed: %v", err)
+	}
+	if len(invalidator.lenders) != 1 || invalidator.lenders[0] != lenderID {
+		t.Errorf("Expected lender %d invalidated on expiry, got %v", lenderID, invalidator.lenders)
+	}
+
+	// Test case 3: A rejected transition leaves the cache alone
+	invalidator.lenders = nil
+	if err := svc.Unsuspend(context.Background(), ledgerID, "admin", ""); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("Expected ErrIllegalTransition, got %v", err)
+	}
+	if len(invalidator.lenders) != 0 {
+		t.Errorf("Expected no invalidation, got %v", invalidator.lenders)
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PwnedPasswordsURL is the Have I Been Pwned range endpoint; the 5-character hash prefix is appended.
+var PwnedPasswordsURL = "https://api.pwnedpasswords.com/range/"
+
+// PwnedPasswordsClient is the HTTP client used by CheckPasswordPwned.
+var PwnedPasswordsClient = &http.Client{Timeout: 5 * time.Second}
+
+// CheckPasswordPwned reports whether a password appears in the Have I Been Pwned breach corpus.
+// Only the first 5 characters of the password's SHA-1 hash leave the process (k-anonymity); the
+// response lists every known suffix for that prefix and the match is made locally.
+func CheckPasswordPwned(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, PwnedPasswordsURL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real number of suffixes from anyone watching response sizes
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := PwnedPasswordsClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("pwned passwords range request failed: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Each line is SUFFIX:COUNT; padding entries have a count of 0
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(candidate, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
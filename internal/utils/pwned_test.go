@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc stubs an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubPwnedPasswords serves body for every range request and records the requested paths.
+func stubPwnedPasswords(t *testing.T, status int, body string) *[]string {
+	t.Helper()
+	var paths []string
+	client := PwnedPasswordsClient
+	PwnedPasswordsClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(body))}, nil
+	})}
+	t.Cleanup(func() { PwnedPasswordsClient = client })
+	return &paths
+}
+
+func TestCheckPasswordPwned(t *testing.T) {
+	// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	const rangeBody = "003D68EB55068C33ACE09247EE4C639306B:3\r\n" +
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n" +
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0\r\n"
+
+	// Test case 1: A breached password is found, and only the hash prefix is sent
+	paths := stubPwnedPasswords(t, http.StatusOK, rangeBody)
+	pwned, err := CheckPasswordPwned(context.Background(), "password")
+	if err != nil || !pwned {
+		t.Errorf("Expected 'password' to be pwned, got %v (%v)", pwned, err)
+	}
+	if len(*paths) != 1 || (*paths)[0] != "/range/5BAA6" {
+		t.Errorf("Expected a single request for /range/5BAA6, got %v", *paths)
+	}
+
+	// Test case 2: A suffix missing from the range is not pwned
+	if pwned, err := CheckPasswordPwned(context.Background(), "StrongPass123"); err != nil || pwned {
+		t.Errorf("Expected 'StrongPass123' not to be pwned, got %v (%v)", pwned, err)
+	}
+
+	// Test case 3: Padding entries with a zero count do not match
+	stubPwnedPasswords(t, http.StatusOK, "1E4C9B93F3F0682250B6CF8331B7EE68FD8:0\r\n")
+	if pwned, _ := CheckPasswordPwned(context.Background(), "password"); pwned {
+		t.Error("Expected a padding entry not to count as a match")
+	}
+
+	// Test case 4: Upstream errors are returned
+	stubPwnedPasswords(t, http.StatusServiceUnavailable, "")
+	if _, err := CheckPasswordPwned(context.Background(), "password"); err == nil {
+		t.Error("Expected an error for a failed range request")
+	}
+}